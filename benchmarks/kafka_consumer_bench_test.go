@@ -2,6 +2,7 @@ package benchmarks
 
 import (
 	"encoding/json"
+	"io"
 	"testing"
 	"time"
 
@@ -52,6 +53,59 @@ func BenchmarkBaseEventDeserialization(b *testing.B) {
 	}
 }
 
+// BenchmarkBaseEventCodecs compares JSON and MessagePack marshalling of a
+// representative event, reporting the encoded size of each
+func BenchmarkBaseEventCodecs(b *testing.B) {
+	event := events.NewBaseEvent("order.placed", "us-west-2", map[string]interface{}{
+		"order_id":    "order-12345",
+		"customer_id": "cust-12345",
+		"email":       "test@example.com",
+		"total":       149.97,
+		"quantity":    3,
+		"items": []interface{}{
+			map[string]interface{}{"sku": "SKU-1", "price": 49.99},
+			map[string]interface{}{"sku": "SKU-2", "price": 99.98},
+		},
+	})
+	event.Metadata.TenantID = "tenant-1"
+	event.Metadata.TraceID = "trace-abc123"
+
+	for _, format := range []string{events.CodecJSON, events.CodecMsgPack} {
+		codec, err := events.NewCodec(format)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(format+"/marshal", func(b *testing.B) {
+			data, err := codec.Marshal(event)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = codec.Marshal(event)
+			}
+			b.ReportMetric(float64(len(data)), "bytes/event")
+		})
+
+		b.Run(format+"/unmarshal", func(b *testing.B) {
+			data, err := codec.Marshal(event)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var decoded events.BaseEvent
+				_ = codec.Unmarshal(data, &decoded)
+			}
+		})
+	}
+}
+
 // BenchmarkCDCEventCreation benchmarks CDC event creation
 func BenchmarkCDCEventCreation(b *testing.B) {
 	after := map[string]interface{}{
@@ -96,6 +150,48 @@ func BenchmarkLargePayloadSerialization(b *testing.B) {
 	}
 }
 
+// newLargeEventBatch builds a 100-event batch for serialization benchmarks
+func newLargeEventBatch() *events.EventBatch {
+	batch := &events.EventBatch{
+		BatchID:   "batch-12345",
+		Timestamp: time.Now(),
+		Region:    "us-west-2",
+	}
+	for i := 0; i < 100; i++ {
+		event := events.NewBaseEvent("order.created", "us-west-2", map[string]interface{}{
+			"order_id":    "order-12345",
+			"customer_id": "cust-67890",
+			"description": "A detailed description of the order that contains multiple sentences.",
+			"total":       9999.00,
+		})
+		batch.Events = append(batch.Events, *event)
+	}
+	batch.Size = len(batch.Events)
+	return batch
+}
+
+// BenchmarkEventBatchMarshal benchmarks serializing a 100-event batch with json.Marshal
+func BenchmarkEventBatchMarshal(b *testing.B) {
+	batch := newLargeEventBatch()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = json.Marshal(batch)
+	}
+}
+
+// BenchmarkEventBatchStreaming benchmarks streaming a 100-event batch through pooled buffers
+func BenchmarkEventBatchStreaming(b *testing.B) {
+	batch := newLargeEventBatch()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = batch.WriteJSON(io.Discard)
+	}
+}
+
 // BenchmarkCrossRegionEventCreation benchmarks cross-region event creation
 func BenchmarkCrossRegionEventCreation(b *testing.B) {
 	base := events.NewBaseEvent("customer.created", "us-west-2", map[string]interface{}{
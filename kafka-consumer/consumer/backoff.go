@@ -0,0 +1,102 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Backoff strategies, as named in KafkaConfig.Backoff
+const (
+	BackoffNone        = "none"
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+)
+
+const (
+	defaultBackoffBase = 100 * time.Millisecond
+	defaultBackoffMax  = 30 * time.Second
+)
+
+// BackoffStrategy decides how long the consumer waits before polling again
+// after consecutive processing failures, so a persistently failing partition
+// doesn't spin
+type BackoffStrategy interface {
+	// Delay returns the wait after the given number of consecutive failures,
+	// starting from 1
+	Delay(failures int) time.Duration
+}
+
+// NoBackoff polls again immediately
+type NoBackoff struct{}
+
+// Delay returns zero
+func (NoBackoff) Delay(failures int) time.Duration { return 0 }
+
+// FixedBackoff waits the same time after every failure
+type FixedBackoff struct {
+	Interval time.Duration
+}
+
+// Delay returns the fixed interval
+func (b FixedBackoff) Delay(failures int) time.Duration { return b.Interval }
+
+// ExponentialBackoff doubles the wait with each consecutive failure, from
+// Base up to Max
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay returns Base doubled for each failure after the first, capped at Max
+func (b ExponentialBackoff) Delay(failures int) time.Duration {
+	delay := b.Base
+	for i := 1; i < failures && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+// NewBackoffStrategy returns the named strategy, exponential when name is
+// empty. A zero base or max uses 100ms or 30s; fixed backoff waits base.
+func NewBackoffStrategy(name string, base, max time.Duration) (BackoffStrategy, error) {
+	if base <= 0 {
+		base = defaultBackoffBase
+	}
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+	if max < base {
+		max = base
+	}
+
+	switch name {
+	case BackoffNone:
+		return NoBackoff{}, nil
+	case BackoffFixed:
+		return FixedBackoff{Interval: base}, nil
+	case "", BackoffExponential:
+		return ExponentialBackoff{Base: base, Max: max}, nil
+	default:
+		return nil, fmt.Errorf("unknown backoff strategy: %s", name)
+	}
+}
+
+// sleepContext sleeps for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
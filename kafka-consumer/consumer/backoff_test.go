@@ -0,0 +1,83 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBackoffStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		expected BackoffStrategy
+	}{
+		{"default", "", ExponentialBackoff{Base: time.Second, Max: time.Minute}},
+		{"exponential", BackoffExponential, ExponentialBackoff{Base: time.Second, Max: time.Minute}},
+		{"fixed", BackoffFixed, FixedBackoff{Interval: time.Second}},
+		{"none", BackoffNone, NoBackoff{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := NewBackoffStrategy(tt.strategy, time.Second, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, strategy)
+		})
+	}
+}
+
+func TestNewBackoffStrategy_Defaults(t *testing.T) {
+	strategy, err := NewBackoffStrategy("", 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, ExponentialBackoff{Base: defaultBackoffBase, Max: defaultBackoffMax}, strategy)
+
+	// A max below the base is raised to it
+	strategy, err = NewBackoffStrategy(BackoffExponential, time.Minute, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, ExponentialBackoff{Base: time.Minute, Max: time.Minute}, strategy)
+}
+
+func TestNewBackoffStrategy_Unknown(t *testing.T) {
+	_, err := NewBackoffStrategy("linear", 0, 0)
+	assert.ErrorContains(t, err, "unknown backoff strategy: linear")
+}
+
+func TestExponentialBackoff_Delay(t *testing.T) {
+	backoff := ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second}
+
+	var delays []time.Duration
+	for failures := 1; failures <= 6; failures++ {
+		delays = append(delays, backoff.Delay(failures))
+	}
+
+	assert.Equal(t, []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}, delays)
+}
+
+func TestFixedAndNoBackoff_Delay(t *testing.T) {
+	fixed := FixedBackoff{Interval: time.Second}
+	assert.Equal(t, time.Second, fixed.Delay(1))
+	assert.Equal(t, time.Second, fixed.Delay(10))
+	assert.Zero(t, NoBackoff{}.Delay(10))
+}
+
+func TestSleepContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	err := sleepContext(ctx, time.Minute)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
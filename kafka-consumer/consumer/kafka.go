@@ -2,8 +2,11 @@ package consumer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -11,41 +14,135 @@ import (
 	"go.uber.org/zap"
 )
 
-// KafkaConfig holds Kafka consumer configuration
+// KafkaConfig holds Kafka consumer configuration for a single cluster
 type KafkaConfig struct {
-	BootstrapServers string
-	GroupID          string
-	Topics           []string
-	SecurityProtocol string
-	SASLMechanism    string
-	SASLUsername     string
-	SASLPassword     string
-	SchemaRegistry   string
-	AutoOffsetReset  string
+	Name             string   `json:"name"`
+	BootstrapServers string   `json:"bootstrap_servers"`
+	GroupID          string   `json:"group_id"`
+	Topics           []string `json:"topics"`
+	SecurityProtocol string   `json:"security_protocol"`
+	SASLMechanism    string   `json:"sasl_mechanism"`
+	SASLUsername     string   `json:"sasl_username"`
+	SASLPassword     string   `json:"sasl_password"`
+	SchemaRegistry   string   `json:"schema_registry"`
+	AutoOffsetReset  string   `json:"auto_offset_reset"`
+
+	// PollTimeout is how long each read waits for a message, a second when
+	// zero. IdleTimeout is how long without messages before the idle handler
+	// runs; zero disables it. Both are set from the environment for every
+	// cluster.
+	PollTimeout time.Duration `json:"-"`
+	IdleTimeout time.Duration `json:"-"`
+
+	// Backoff names the strategy for waiting after a processing failure:
+	// "none", "fixed" or "exponential" (the default). BackoffBase is the
+	// fixed or initial wait and BackoffMax caps exponential growth. These
+	// are also set from the environment for every cluster.
+	Backoff     string        `json:"-"`
+	BackoffBase time.Duration `json:"-"`
+	BackoffMax  time.Duration `json:"-"`
+
+	// Properties holds further librdkafka properties, such as ssl.* or fetch
+	// settings, passed to the consumer as-is. They override the consumer's
+	// default timeouts but not the fields above or manual offset commit.
+	Properties map[string]string `json:"-"`
+}
+
+// ClusterName returns the name used to label the cluster in logs and metrics,
+// falling back to the bootstrap servers when no name is configured
+func (c *KafkaConfig) ClusterName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.BootstrapServers
+}
+
+// Validate checks the configuration is usable. An empty topic list is
+// rejected because subscribing to no topics runs a healthy-looking consumer
+// that never receives a message.
+func (c *KafkaConfig) Validate() error {
+	if len(c.Topics) == 0 {
+		return fmt.Errorf("cluster %s: no Kafka topics configured; set KAFKA_TOPICS to a non-empty JSON array", c.ClusterName())
+	}
+	for i, topic := range c.Topics {
+		if strings.TrimSpace(topic) == "" {
+			return fmt.Errorf("cluster %s: topic %d is empty", c.ClusterName(), i)
+		}
+		// A leading ^ subscribes by regular expression
+		if topic == "^" {
+			return fmt.Errorf("cluster %s: topic %d is an empty pattern", c.ClusterName(), i)
+		}
+	}
+	if _, err := NewBackoffStrategy(c.Backoff, c.BackoffBase, c.BackoffMax); err != nil {
+		return fmt.Errorf("cluster %s: %w", c.ClusterName(), err)
+	}
+	return nil
 }
 
+// defaultPollTimeout is how long each read waits for a message
+const defaultPollTimeout = time.Second
+
 // MessageProcessor defines the interface for processing Kafka messages
 type MessageProcessor interface {
 	Process(ctx context.Context, msg *kafka.Message) error
 }
 
+// MessageReader reads and commits messages. *kafka.Consumer satisfies it.
+type MessageReader interface {
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	CommitMessage(m *kafka.Message) ([]kafka.TopicPartition, error)
+	CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+}
+
+// pendingKey identifies a topic partition in the pending offsets
+type pendingKey struct {
+	topic     string
+	partition int32
+}
+
+// IdleHandler runs when no message has arrived for the idle timeout, for
+// work such as flushing buffered output while the topics are quiet
+type IdleHandler func(ctx context.Context)
+
 // KafkaConsumer wraps Confluent Kafka consumer
 type KafkaConsumer struct {
 	consumer *kafka.Consumer
+	reader   MessageReader
+	cluster  string
+	groupID  string
 	topics   []string
 	logger   *zap.Logger
+
+	pollTimeout time.Duration
+	idleTimeout time.Duration
+	onIdle      IdleHandler
+	lastActive  time.Time
+	now         func() time.Time
+
+	backoff  BackoffStrategy
+	failures int
+	sleep    func(ctx context.Context, d time.Duration) error
+
+	// pending holds the offsets of processed messages not yet committed,
+	// per partition
+	mu      sync.Mutex
+	pending map[pendingKey]kafka.TopicPartition
 }
 
-// NewKafkaConsumer creates a new Kafka consumer
-func NewKafkaConsumer(config *KafkaConfig, logger *zap.Logger) (*KafkaConsumer, error) {
+// newConfigMap builds the librdkafka configuration for config
+func newConfigMap(config *KafkaConfig) *kafka.ConfigMap {
 	kafkaConfig := &kafka.ConfigMap{
-		"bootstrap.servers":  config.BootstrapServers,
-		"group.id":           config.GroupID,
-		"auto.offset.reset":  config.AutoOffsetReset,
-		"enable.auto.commit": false, // Manual offset commit for better control
-		"session.timeout.ms": 30000,
+		"session.timeout.ms":   30000,
 		"max.poll.interval.ms": 300000,
 	}
+	for key, value := range config.Properties {
+		kafkaConfig.SetKey(key, value)
+	}
+
+	kafkaConfig.SetKey("bootstrap.servers", config.BootstrapServers)
+	kafkaConfig.SetKey("group.id", config.GroupID)
+	kafkaConfig.SetKey("auto.offset.reset", config.AutoOffsetReset)
+	kafkaConfig.SetKey("enable.auto.commit", false) // Manual offset commit for better control
 
 	// Add security configuration if needed
 	if config.SecurityProtocol != "PLAINTEXT" {
@@ -54,39 +151,92 @@ func NewKafkaConsumer(config *KafkaConfig, logger *zap.Logger) (*KafkaConsumer,
 		kafkaConfig.SetKey("sasl.username", config.SASLUsername)
 		kafkaConfig.SetKey("sasl.password", config.SASLPassword)
 	}
+	return kafkaConfig
+}
+
+// NewKafkaConsumer creates a new Kafka consumer
+func NewKafkaConsumer(config *KafkaConfig, logger *zap.Logger) (*KafkaConsumer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka configuration: %w", err)
+	}
 
-	consumer, err := kafka.NewConsumer(kafkaConfig)
+	consumer, err := kafka.NewConsumer(newConfigMap(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka consumer: %w", err)
 	}
 
 	logger.Info("created Kafka consumer",
+		zap.String("cluster", config.ClusterName()),
 		zap.String("bootstrap_servers", config.BootstrapServers),
 		zap.String("group_id", config.GroupID),
 		zap.Strings("topics", config.Topics),
 	)
 
+	pollTimeout := config.PollTimeout
+	if pollTimeout <= 0 {
+		pollTimeout = defaultPollTimeout
+	}
+	// Validated above
+	backoff, _ := NewBackoffStrategy(config.Backoff, config.BackoffBase, config.BackoffMax)
+
 	return &KafkaConsumer{
-		consumer: consumer,
-		topics:   config.Topics,
-		logger:   logger,
+		consumer:    consumer,
+		reader:      consumer,
+		cluster:     config.ClusterName(),
+		groupID:     config.GroupID,
+		topics:      config.Topics,
+		logger:      logger,
+		pollTimeout: pollTimeout,
+		idleTimeout: config.IdleTimeout,
+		now:         time.Now,
+		backoff:     backoff,
+		sleep:       sleepContext,
 	}, nil
 }
 
+// SetIdleHandler registers fn to run each time the consumer has gone the
+// configured idle timeout without a message. It runs on the consuming
+// goroutine, so reads wait for it to return.
+func (kc *KafkaConsumer) SetIdleHandler(fn IdleHandler) {
+	kc.onIdle = fn
+}
+
 // Consume starts consuming messages from Kafka
 func (kc *KafkaConsumer) Consume(ctx context.Context, processor MessageProcessor) error {
-	// Subscribe to topics
-	if err := kc.consumer.SubscribeTopics(kc.topics, nil); err != nil {
+	// Report lag for all assigned partitions, not just those delivering messages
+	lagPoller := NewLagPoller(kc.consumer, kc.groupID, defaultLagPollInterval, kc.logger)
+
+	// Subscribe to topics. The client still assigns and unassigns partitions
+	// itself because the callback doesn't.
+	rebalance := func(_ *kafka.Consumer, event kafka.Event) error {
+		if revoked, ok := event.(kafka.RevokedPartitions); ok {
+			lagPoller.Revoke(revoked.Partitions)
+		}
+		return nil
+	}
+	if err := kc.consumer.SubscribeTopics(kc.topics, rebalance); err != nil {
 		return fmt.Errorf("failed to subscribe to topics: %w", err)
 	}
 
 	kc.logger.Info("subscribed to topics", zap.Strings("topics", kc.topics))
+	kc.lastActive = kc.now()
+
+	pollerDone := make(chan struct{})
+	go func() {
+		defer close(pollerDone)
+		lagPoller.Run(ctx)
+	}()
+	defer func() { <-pollerDone }()
 
 	// Start consuming loop
 	for {
 		select {
 		case <-ctx.Done():
 			kc.logger.Info("stopping consumer due to context cancellation")
+			// Commit what was processed before stopping, even though ctx is done
+			if err := kc.Commit(context.WithoutCancel(ctx)); err != nil {
+				kc.logger.Error("failed to commit offsets on shutdown", zap.Error(err))
+			}
 			return ctx.Err()
 		default:
 			if err := kc.consumeMessage(ctx, processor); err != nil {
@@ -102,14 +252,17 @@ func (kc *KafkaConsumer) consumeMessage(ctx context.Context, processor MessagePr
 	start := time.Now()
 
 	// Poll for message with timeout
-	msg, err := kc.consumer.ReadMessage(1 * time.Second)
+	msg, err := kc.reader.ReadMessage(kc.pollTimeout)
 	if err != nil {
 		// Timeout is not an error, just no messages available
-		if err.(kafka.Error).Code() == kafka.ErrTimedOut {
+		var kafkaErr kafka.Error
+		if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut {
+			kc.checkIdle(ctx)
 			return nil
 		}
 		return fmt.Errorf("failed to read message: %w", err)
 	}
+	kc.lastActive = kc.now()
 
 	topic := *msg.TopicPartition.Topic
 	partition := strconv.Itoa(int(msg.TopicPartition.Partition))
@@ -133,30 +286,37 @@ func (kc *KafkaConsumer) consumeMessage(ctx context.Context, processor MessagePr
 			zap.Int64("offset", int64(msg.TopicPartition.Offset)),
 		)
 		
-		metrics.RecordKafkaMessage(topic, partition, "go-cdc-consumers", processingDuration, err)
+		metrics.RecordKafkaMessage(topic, partition, kc.groupID, processingDuration, err)
+		metrics.RecordKafkaClusterMessage(kc.cluster, topic, err)
 		
 		// Don't commit offset on error - message will be reprocessed
+		kc.backOff(ctx)
 		return err
 	}
+	kc.failures = 0
 
-	// Commit offset after successful processing
-	if _, err := kc.consumer.CommitMessage(msg); err != nil {
+	// Commit offset after successful processing. A failed commit stays
+	// pending for the next Commit.
+	if _, err := kc.reader.CommitMessage(msg); err != nil {
 		kc.logger.Error("failed to commit offset",
 			zap.Error(err),
 			zap.String("topic", topic),
 			zap.Int64("offset", int64(msg.TopicPartition.Offset)),
 		)
+		kc.setPending(msg.TopicPartition)
 		return fmt.Errorf("failed to commit offset: %w", err)
 	}
+	kc.clearPending(msg.TopicPartition)
 
 	// Record metrics
 	totalDuration := time.Since(start)
-	metrics.RecordKafkaMessage(topic, partition, "go-cdc-consumers", processingDuration, nil)
+	metrics.RecordKafkaMessage(topic, partition, kc.groupID, processingDuration, nil)
+	metrics.RecordKafkaClusterMessage(kc.cluster, topic, nil)
 
 	// Calculate and record consumer lag
 	if !msg.Timestamp.IsZero() {
 		lag := time.Since(msg.Timestamp)
-		metrics.KafkaConsumerLag.WithLabelValues(topic, partition, "go-cdc-consumers").Set(lag.Seconds())
+		metrics.KafkaConsumerLag.WithLabelValues(topic, partition, kc.groupID).Set(lag.Seconds())
 	}
 
 	kc.logger.Debug("successfully processed message",
@@ -168,6 +328,96 @@ func (kc *KafkaConsumer) consumeMessage(ctx context.Context, processor MessagePr
 	return nil
 }
 
+// Commit commits the offsets of processed messages that haven't been
+// committed yet, so they aren't redelivered after a restart. It returns nil
+// without contacting the broker when nothing is pending. Offsets that fail
+// to commit stay pending.
+func (kc *KafkaConsumer) Commit(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	if len(kc.pending) == 0 {
+		return nil
+	}
+
+	offsets := make([]kafka.TopicPartition, 0, len(kc.pending))
+	for _, tp := range kc.pending {
+		offsets = append(offsets, tp)
+	}
+	if _, err := kc.reader.CommitOffsets(offsets); err != nil {
+		return fmt.Errorf("failed to commit %d pending offsets: %w", len(offsets), err)
+	}
+
+	kc.logger.Info("committed pending offsets", zap.Int("partitions", len(offsets)))
+	kc.pending = nil
+	return nil
+}
+
+// setPending records a processed message's position as pending, as the
+// offset of the next message to read, which is what Kafka commits
+func (kc *KafkaConsumer) setPending(tp kafka.TopicPartition) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+
+	if kc.pending == nil {
+		kc.pending = make(map[pendingKey]kafka.TopicPartition)
+	}
+	tp.Offset++
+	kc.pending[pendingKey{topic: *tp.Topic, partition: tp.Partition}] = tp
+}
+
+// clearPending drops the pending offset of a partition once a later message
+// on it has been committed
+func (kc *KafkaConsumer) clearPending(tp kafka.TopicPartition) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	delete(kc.pending, pendingKey{topic: *tp.Topic, partition: tp.Partition})
+}
+
+// backOff waits before the next poll after a processing failure, longer with
+// each consecutive failure depending on the strategy
+func (kc *KafkaConsumer) backOff(ctx context.Context) {
+	if kc.backoff == nil {
+		return
+	}
+	kc.failures++
+	delay := kc.backoff.Delay(kc.failures)
+	if delay <= 0 {
+		return
+	}
+
+	kc.logger.Debug("backing off after processing failure",
+		zap.Int("consecutive_failures", kc.failures),
+		zap.Duration("delay", delay),
+	)
+	// Cancellation ends the wait early; Consume then stops
+	_ = kc.sleep(ctx, delay)
+}
+
+// checkIdle runs the idle handler once the consumer has been idle for the
+// idle timeout, then restarts the idle period so it runs again after another
+// idle timeout without messages
+func (kc *KafkaConsumer) checkIdle(ctx context.Context) {
+	if kc.onIdle == nil || kc.idleTimeout <= 0 {
+		return
+	}
+	now := kc.now()
+	if kc.lastActive.IsZero() {
+		kc.lastActive = now
+	}
+	idle := now.Sub(kc.lastActive)
+	if idle < kc.idleTimeout {
+		return
+	}
+
+	kc.logger.Debug("consumer idle", zap.Duration("idle", idle))
+	kc.onIdle(ctx)
+	kc.lastActive = now
+}
+
 // Close closes the Kafka consumer
 func (kc *KafkaConsumer) Close() error {
 	kc.logger.Info("closing Kafka consumer")
@@ -0,0 +1,407 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestKafkaConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		topics  []string
+		wantErr string
+	}{
+		{"nil topics", nil, "no Kafka topics configured"},
+		{"empty topics", []string{}, "no Kafka topics configured"},
+		{"empty topic name", []string{"qlik.customers", ""}, "topic 1 is empty"},
+		{"blank topic name", []string{"  "}, "topic 0 is empty"},
+		{"empty pattern", []string{"^"}, "topic 0 is an empty pattern"},
+		{"topics", []string{"qlik.customers", "qlik.orders"}, ""},
+		{"pattern", []string{"^qlik\\..*"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KafkaConfig{Name: "on-prem", Topics: tt.topics}
+			err := config.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+			assert.Contains(t, err.Error(), "on-prem")
+		})
+	}
+}
+
+func TestNewKafkaConsumer_RejectsEmptyTopics(t *testing.T) {
+	config := &KafkaConfig{
+		BootstrapServers: "localhost:9092",
+		GroupID:          "test-group",
+		Topics:           []string{},
+		SecurityProtocol: "PLAINTEXT",
+		AutoOffsetReset:  "earliest",
+	}
+
+	_, err := NewKafkaConsumer(config, zap.NewNop())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no Kafka topics configured")
+}
+
+func TestNewKafkaConsumer_WithTopics(t *testing.T) {
+	config := &KafkaConfig{
+		BootstrapServers: "localhost:9092",
+		GroupID:          "test-group",
+		Topics:           []string{"qlik.customers"},
+		SecurityProtocol: "PLAINTEXT",
+		AutoOffsetReset:  "earliest",
+	}
+
+	kc, err := NewKafkaConsumer(config, zap.NewNop())
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"qlik.customers"}, kc.topics)
+	assert.Equal(t, defaultPollTimeout, kc.pollTimeout)
+	assert.NoError(t, kc.Close())
+}
+
+func TestNewConfigMap_Properties(t *testing.T) {
+	config := &KafkaConfig{
+		BootstrapServers: "localhost:9092",
+		GroupID:          "test-group",
+		SecurityProtocol: "PLAINTEXT",
+		AutoOffsetReset:  "earliest",
+		Properties: map[string]string{
+			"session.timeout.ms": "45000",
+			"fetch.min.bytes":    "1024",
+			"group.id":           "other-group",
+			"enable.auto.commit": "true",
+		},
+	}
+
+	configMap := newConfigMap(config)
+
+	get := func(key string) kafka.ConfigValue {
+		value, err := configMap.Get(key, nil)
+		require.NoError(t, err)
+		return value
+	}
+	assert.Equal(t, "45000", get("session.timeout.ms"))
+	assert.Equal(t, "1024", get("fetch.min.bytes"))
+	assert.Equal(t, 300000, get("max.poll.interval.ms"))
+	// Fields and manual offset commit win over properties
+	assert.Equal(t, "test-group", get("group.id"))
+	assert.Equal(t, false, get("enable.auto.commit"))
+}
+
+func TestNewKafkaConsumer_WithProperties(t *testing.T) {
+	config := &KafkaConfig{
+		BootstrapServers: "localhost:9092",
+		GroupID:          "test-group",
+		Topics:           []string{"qlik.customers"},
+		SecurityProtocol: "PLAINTEXT",
+		AutoOffsetReset:  "earliest",
+		Properties:       map[string]string{"fetch.min.bytes": "1024"},
+	}
+
+	kc, err := NewKafkaConsumer(config, zap.NewNop())
+	require.NoError(t, err)
+	assert.NoError(t, kc.Close())
+
+	config.Properties = map[string]string{"no.such.property": "1"}
+	_, err = NewKafkaConsumer(config, zap.NewNop())
+	assert.Error(t, err)
+}
+
+func TestNewKafkaConsumer_PollAndIdleTimeouts(t *testing.T) {
+	config := &KafkaConfig{
+		BootstrapServers: "localhost:9092",
+		GroupID:          "test-group",
+		Topics:           []string{"qlik.customers"},
+		SecurityProtocol: "PLAINTEXT",
+		AutoOffsetReset:  "earliest",
+		PollTimeout:      250 * time.Millisecond,
+		IdleTimeout:      time.Minute,
+	}
+
+	kc, err := NewKafkaConsumer(config, zap.NewNop())
+
+	require.NoError(t, err)
+	assert.Equal(t, 250*time.Millisecond, kc.pollTimeout)
+	assert.Equal(t, time.Minute, kc.idleTimeout)
+	assert.NoError(t, kc.Close())
+}
+
+// mockReader returns queued messages, then times out, recording each read's
+// timeout and the offsets committed. commitErr fails commits.
+type mockReader struct {
+	messages  []*kafka.Message
+	timeouts  []time.Duration
+	committed int
+	offsets   [][]kafka.TopicPartition
+	commitErr error
+}
+
+func (m *mockReader) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	m.timeouts = append(m.timeouts, timeout)
+	if len(m.messages) == 0 {
+		return nil, kafka.NewError(kafka.ErrTimedOut, "timed out", false)
+	}
+	msg := m.messages[0]
+	m.messages = m.messages[1:]
+	return msg, nil
+}
+
+func (m *mockReader) CommitMessage(msg *kafka.Message) ([]kafka.TopicPartition, error) {
+	if m.commitErr != nil {
+		return nil, m.commitErr
+	}
+	m.committed++
+	return []kafka.TopicPartition{msg.TopicPartition}, nil
+}
+
+func (m *mockReader) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	if m.commitErr != nil {
+		return nil, m.commitErr
+	}
+	m.offsets = append(m.offsets, offsets)
+	return offsets, nil
+}
+
+func testMessage() *kafka.Message {
+	topic := "qlik.customers"
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 1},
+		Value:          []byte(`{}`),
+	}
+}
+
+// idleTestConsumer returns a consumer reading from reader whose clock advances
+// by step on every reading
+func idleTestConsumer(reader MessageReader, pollTimeout, idleTimeout, step time.Duration) *KafkaConsumer {
+	clock := time.Unix(0, 0)
+	return &KafkaConsumer{
+		reader:      reader,
+		cluster:     "test",
+		groupID:     "test-group",
+		logger:      zap.NewNop(),
+		pollTimeout: pollTimeout,
+		idleTimeout: idleTimeout,
+		now: func() time.Time {
+			clock = clock.Add(step)
+			return clock
+		},
+	}
+}
+
+func TestConsumeMessage_UsesPollTimeout(t *testing.T) {
+	reader := &mockReader{}
+	kc := idleTestConsumer(reader, 250*time.Millisecond, 0, time.Second)
+
+	require.NoError(t, kc.consumeMessage(context.Background(), noopProcessor{}))
+
+	assert.Equal(t, []time.Duration{250 * time.Millisecond}, reader.timeouts)
+}
+
+func TestConsumeMessage_IdleHandlerFiresAfterIdleTimeout(t *testing.T) {
+	reader := &mockReader{}
+	kc := idleTestConsumer(reader, time.Second, 3*time.Second, time.Second)
+	idle := 0
+	kc.SetIdleHandler(func(ctx context.Context) { idle++ })
+	ctx := context.Background()
+
+	// The first timeout starts the idle period; each read advances a second
+	for i := 0; i < 3; i++ {
+		require.NoError(t, kc.consumeMessage(ctx, noopProcessor{}))
+	}
+	assert.Equal(t, 0, idle)
+
+	require.NoError(t, kc.consumeMessage(ctx, noopProcessor{}))
+	assert.Equal(t, 1, idle)
+
+	// Firing restarts the idle period
+	for i := 0; i < 2; i++ {
+		require.NoError(t, kc.consumeMessage(ctx, noopProcessor{}))
+	}
+	assert.Equal(t, 1, idle)
+	require.NoError(t, kc.consumeMessage(ctx, noopProcessor{}))
+	assert.Equal(t, 2, idle)
+}
+
+func TestConsumeMessage_MessageResetsIdlePeriod(t *testing.T) {
+	reader := &mockReader{}
+	kc := idleTestConsumer(reader, time.Second, 3*time.Second, time.Second)
+	idle := 0
+	kc.SetIdleHandler(func(ctx context.Context) { idle++ })
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, kc.consumeMessage(ctx, noopProcessor{}))
+	}
+
+	// A message just before the idle timeout restarts the idle period
+	reader.messages = []*kafka.Message{testMessage()}
+	require.NoError(t, kc.consumeMessage(ctx, noopProcessor{}))
+	assert.Equal(t, 1, reader.committed)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, kc.consumeMessage(ctx, noopProcessor{}))
+	}
+	assert.Equal(t, 0, idle)
+
+	require.NoError(t, kc.consumeMessage(ctx, noopProcessor{}))
+	assert.Equal(t, 1, idle)
+}
+
+func TestConsumeMessage_NoIdleHandlerWithoutTimeout(t *testing.T) {
+	reader := &mockReader{}
+	kc := idleTestConsumer(reader, time.Second, 0, time.Hour)
+	idle := 0
+	kc.SetIdleHandler(func(ctx context.Context) { idle++ })
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, kc.consumeMessage(context.Background(), noopProcessor{}))
+	}
+
+	assert.Equal(t, 0, idle)
+}
+
+// failingProcessor fails while fail is set
+type failingProcessor struct {
+	fail bool
+}
+
+func (p *failingProcessor) Process(ctx context.Context, msg *kafka.Message) error {
+	if p.fail {
+		return errors.New("downstream unavailable")
+	}
+	return nil
+}
+
+func TestConsumeMessage_BacksOffAfterFailures(t *testing.T) {
+	reader := &mockReader{}
+	kc := idleTestConsumer(reader, time.Second, 0, time.Second)
+	kc.backoff = ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second}
+	var sleeps []time.Duration
+	kc.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	processor := &failingProcessor{fail: true}
+	ctx := context.Background()
+
+	consume := func() error {
+		reader.messages = []*kafka.Message{testMessage()}
+		return kc.consumeMessage(ctx, processor)
+	}
+
+	// Each consecutive failure waits longer before the next poll
+	for i := 0; i < 3; i++ {
+		assert.Error(t, consume())
+	}
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}, sleeps)
+	assert.Zero(t, reader.committed)
+
+	// A success resets the backoff, and doesn't wait
+	processor.fail = false
+	require.NoError(t, consume())
+	assert.Len(t, sleeps, 3)
+
+	processor.fail = true
+	assert.Error(t, consume())
+	assert.Equal(t, 100*time.Millisecond, sleeps[3])
+}
+
+func TestConsumeMessage_NoBackoff(t *testing.T) {
+	reader := &mockReader{messages: []*kafka.Message{testMessage()}}
+	kc := idleTestConsumer(reader, time.Second, 0, time.Second)
+	kc.backoff = NoBackoff{}
+	slept := false
+	kc.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = true
+		return nil
+	}
+
+	assert.Error(t, kc.consumeMessage(context.Background(), &failingProcessor{fail: true}))
+	assert.False(t, slept)
+}
+
+func TestKafkaConfig_ValidateBackoff(t *testing.T) {
+	config := &KafkaConfig{Name: "on-prem", Topics: []string{"qlik.customers"}, Backoff: "linear"}
+
+	err := config.Validate()
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown backoff strategy: linear")
+	assert.Contains(t, err.Error(), "on-prem")
+}
+
+func TestCommit_NothingPending(t *testing.T) {
+	reader := &mockReader{}
+	kc := idleTestConsumer(reader, time.Second, 0, time.Second)
+
+	require.NoError(t, kc.Commit(context.Background()))
+
+	assert.Empty(t, reader.offsets)
+}
+
+func TestCommit_FlushesPendingOffsets(t *testing.T) {
+	reader := &mockReader{commitErr: errors.New("coordinator not available")}
+	kc := idleTestConsumer(reader, time.Second, 0, time.Second)
+	msg := testMessage()
+	reader.messages = []*kafka.Message{msg}
+
+	// The message is processed but its commit fails, leaving it pending
+	assert.Error(t, kc.consumeMessage(context.Background(), noopProcessor{}))
+	assert.Error(t, kc.Commit(context.Background()))
+
+	reader.commitErr = nil
+	require.NoError(t, kc.Commit(context.Background()))
+
+	require.Len(t, reader.offsets, 1)
+	require.Len(t, reader.offsets[0], 1)
+	assert.Equal(t, *msg.TopicPartition.Topic, *reader.offsets[0][0].Topic)
+	// Kafka commits the offset of the next message to read
+	assert.Equal(t, msg.TopicPartition.Offset+1, reader.offsets[0][0].Offset)
+
+	// Once committed, nothing is left pending
+	require.NoError(t, kc.Commit(context.Background()))
+	assert.Len(t, reader.offsets, 1)
+}
+
+func TestCommit_LaterCommitSupersedesPending(t *testing.T) {
+	reader := &mockReader{commitErr: errors.New("coordinator not available")}
+	kc := idleTestConsumer(reader, time.Second, 0, time.Second)
+	reader.messages = []*kafka.Message{testMessage()}
+	assert.Error(t, kc.consumeMessage(context.Background(), noopProcessor{}))
+
+	// A later message on the same partition commits past the pending offset
+	reader.commitErr = nil
+	next := testMessage()
+	next.TopicPartition.Offset = 2
+	reader.messages = []*kafka.Message{next}
+	require.NoError(t, kc.consumeMessage(context.Background(), noopProcessor{}))
+
+	require.NoError(t, kc.Commit(context.Background()))
+	assert.Empty(t, reader.offsets)
+}
+
+func TestCommit_CancelledContext(t *testing.T) {
+	reader := &mockReader{}
+	kc := idleTestConsumer(reader, time.Second, 0, time.Second)
+	kc.setPending(testMessage().TopicPartition)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, kc.Commit(ctx), context.Canceled)
+	assert.Empty(t, reader.offsets)
+}
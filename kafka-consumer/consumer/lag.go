@@ -0,0 +1,160 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLagPollInterval = 30 * time.Second
+	offsetQueryTimeoutMs   = 5000
+)
+
+// OffsetProvider reports assigned partitions and their offsets.
+// *kafka.Consumer satisfies it.
+type OffsetProvider interface {
+	Assignment() ([]kafka.TopicPartition, error)
+	Committed(partitions []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error)
+	QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+}
+
+// LagPoller periodically updates the offset lag gauge for every assigned
+// partition, so idle or stuck partitions still report lag even when they
+// deliver no messages. Partitions that leave the assignment have their
+// series deleted, so they don't keep reporting their last lag.
+type LagPoller struct {
+	provider OffsetProvider
+	groupID  string
+	interval time.Duration
+	logger   *zap.Logger
+
+	mu       sync.Mutex
+	reported map[pendingKey]struct{}
+}
+
+// NewLagPoller creates a new lag poller
+func NewLagPoller(provider OffsetProvider, groupID string, interval time.Duration, logger *zap.Logger) *LagPoller {
+	if interval <= 0 {
+		interval = defaultLagPollInterval
+	}
+	return &LagPoller{
+		provider: provider,
+		groupID:  groupID,
+		interval: interval,
+		logger:   logger,
+		reported: make(map[pendingKey]struct{}),
+	}
+}
+
+// Run polls lag until ctx is cancelled
+func (p *LagPoller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Poll(); err != nil {
+				p.logger.Warn("failed to poll consumer lag", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Poll updates the lag gauge once for all assigned partitions
+func (p *LagPoller) Poll() error {
+	assigned, err := p.provider.Assignment()
+	if err != nil {
+		return fmt.Errorf("failed to get assignment: %w", err)
+	}
+	p.forgetUnassigned(assigned)
+	if len(assigned) == 0 {
+		return nil
+	}
+
+	committed, err := p.provider.Committed(assigned, offsetQueryTimeoutMs)
+	if err != nil {
+		return fmt.Errorf("failed to get committed offsets: %w", err)
+	}
+
+	for _, tp := range committed {
+		if tp.Topic == nil {
+			continue
+		}
+		low, high, err := p.provider.QueryWatermarkOffsets(*tp.Topic, tp.Partition, offsetQueryTimeoutMs)
+		if err != nil {
+			p.logger.Warn("failed to query watermark offsets",
+				zap.Error(err),
+				zap.String("topic", *tp.Topic),
+				zap.Int32("partition", tp.Partition),
+			)
+			continue
+		}
+
+		lag := offsetLag(int64(tp.Offset), low, high)
+		p.mu.Lock()
+		metrics.KafkaConsumerOffsetLag.WithLabelValues(*tp.Topic, strconv.Itoa(int(tp.Partition)), p.groupID).Set(float64(lag))
+		p.reported[pendingKey{*tp.Topic, tp.Partition}] = struct{}{}
+		p.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Revoke deletes the lag series of revoked partitions
+func (p *LagPoller) Revoke(partitions []kafka.TopicPartition) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, tp := range partitions {
+		if tp.Topic == nil {
+			continue
+		}
+		p.forget(pendingKey{*tp.Topic, tp.Partition})
+	}
+}
+
+// forgetUnassigned deletes the lag series of reported partitions missing
+// from assigned, catching revokes that raced a poll
+func (p *LagPoller) forgetUnassigned(assigned []kafka.TopicPartition) {
+	current := make(map[pendingKey]struct{}, len(assigned))
+	for _, tp := range assigned {
+		if tp.Topic != nil {
+			current[pendingKey{*tp.Topic, tp.Partition}] = struct{}{}
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.reported {
+		if _, ok := current[key]; !ok {
+			p.forget(key)
+		}
+	}
+}
+
+// forget deletes one partition's lag series. Callers hold p.mu.
+func (p *LagPoller) forget(key pendingKey) {
+	metrics.KafkaConsumerOffsetLag.DeleteLabelValues(key.topic, strconv.Itoa(int(key.partition)), p.groupID)
+	delete(p.reported, key)
+}
+
+// offsetLag returns the number of messages between the committed offset and
+// the high-water mark. Without a committed offset the whole retained range is lag.
+func offsetLag(committed, low, high int64) int64 {
+	if committed < 0 {
+		committed = low
+	}
+	if lag := high - committed; lag > 0 {
+		return lag
+	}
+	return 0
+}
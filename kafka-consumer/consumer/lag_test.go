@@ -0,0 +1,223 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+type watermarks struct {
+	low, high int64
+}
+
+// fakeOffsetProvider serves fixed assignments, commits and watermarks
+type fakeOffsetProvider struct {
+	assigned   []kafka.TopicPartition
+	committed  map[string]kafka.Offset
+	watermarks map[string]watermarks
+}
+
+func partitionKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
+
+func (f *fakeOffsetProvider) Assignment() ([]kafka.TopicPartition, error) {
+	return f.assigned, nil
+}
+
+func (f *fakeOffsetProvider) Committed(partitions []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error) {
+	result := make([]kafka.TopicPartition, len(partitions))
+	for i, tp := range partitions {
+		tp.Offset = kafka.OffsetInvalid
+		if offset, ok := f.committed[partitionKey(*tp.Topic, tp.Partition)]; ok {
+			tp.Offset = offset
+		}
+		result[i] = tp
+	}
+	return result, nil
+}
+
+func (f *fakeOffsetProvider) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (int64, int64, error) {
+	w, ok := f.watermarks[partitionKey(topic, partition)]
+	if !ok {
+		return 0, 0, errors.New("unknown partition")
+	}
+	return w.low, w.high, nil
+}
+
+func topicPartition(topic string, partition int32) kafka.TopicPartition {
+	return kafka.TopicPartition{Topic: &topic, Partition: partition}
+}
+
+func TestLagPoller_ReportsIdlePartitions(t *testing.T) {
+	metrics.KafkaConsumerOffsetLag.Reset()
+
+	// Partition 1 is stuck: nothing is consumed from it, but it has a backlog
+	provider := &fakeOffsetProvider{
+		assigned: []kafka.TopicPartition{
+			topicPartition("qlik.customers", 0),
+			topicPartition("qlik.customers", 1),
+		},
+		committed: map[string]kafka.Offset{
+			"qlik.customers/0": 100,
+			"qlik.customers/1": 40,
+		},
+		watermarks: map[string]watermarks{
+			"qlik.customers/0": {low: 0, high: 100},
+			"qlik.customers/1": {low: 0, high: 250},
+		},
+	}
+
+	poller := NewLagPoller(provider, "go-cdc-consumers", time.Second, zap.NewNop())
+	assert.NoError(t, poller.Poll())
+
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.KafkaConsumerOffsetLag.WithLabelValues("qlik.customers", "0", "go-cdc-consumers")))
+	assert.Equal(t, float64(210), testutil.ToFloat64(metrics.KafkaConsumerOffsetLag.WithLabelValues("qlik.customers", "1", "go-cdc-consumers")))
+}
+
+func TestLagPoller_NoCommittedOffset(t *testing.T) {
+	metrics.KafkaConsumerOffsetLag.Reset()
+
+	provider := &fakeOffsetProvider{
+		assigned: []kafka.TopicPartition{topicPartition("qlik.orders", 3)},
+		watermarks: map[string]watermarks{
+			"qlik.orders/3": {low: 20, high: 75},
+		},
+	}
+
+	poller := NewLagPoller(provider, "go-cdc-consumers", time.Second, zap.NewNop())
+	assert.NoError(t, poller.Poll())
+
+	assert.Equal(t, float64(55), testutil.ToFloat64(metrics.KafkaConsumerOffsetLag.WithLabelValues("qlik.orders", "3", "go-cdc-consumers")))
+}
+
+func TestLagPoller_SkipsFailedWatermarkQuery(t *testing.T) {
+	metrics.KafkaConsumerOffsetLag.Reset()
+
+	provider := &fakeOffsetProvider{
+		assigned: []kafka.TopicPartition{
+			topicPartition("qlik.orders", 0),
+			topicPartition("qlik.orders", 1),
+		},
+		committed: map[string]kafka.Offset{"qlik.orders/1": 5},
+		watermarks: map[string]watermarks{
+			"qlik.orders/1": {low: 0, high: 10},
+		},
+	}
+
+	poller := NewLagPoller(provider, "go-cdc-consumers", time.Second, zap.NewNop())
+	assert.NoError(t, poller.Poll())
+
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.KafkaConsumerOffsetLag))
+	assert.Equal(t, float64(5), testutil.ToFloat64(metrics.KafkaConsumerOffsetLag.WithLabelValues("qlik.orders", "1", "go-cdc-consumers")))
+}
+
+func TestLagPoller_RevokeDeletesSeries(t *testing.T) {
+	metrics.KafkaConsumerOffsetLag.Reset()
+
+	provider := &fakeOffsetProvider{
+		assigned: []kafka.TopicPartition{
+			topicPartition("qlik.orders", 0),
+			topicPartition("qlik.orders", 1),
+		},
+		committed: map[string]kafka.Offset{"qlik.orders/0": 5, "qlik.orders/1": 5},
+		watermarks: map[string]watermarks{
+			"qlik.orders/0": {low: 0, high: 10},
+			"qlik.orders/1": {low: 0, high: 30},
+		},
+	}
+
+	poller := NewLagPoller(provider, "go-cdc-consumers", time.Second, zap.NewNop())
+	assert.NoError(t, poller.Poll())
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.KafkaConsumerOffsetLag))
+
+	poller.Revoke([]kafka.TopicPartition{topicPartition("qlik.orders", 0)})
+
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.KafkaConsumerOffsetLag))
+	assert.Equal(t, float64(25), testutil.ToFloat64(metrics.KafkaConsumerOffsetLag.WithLabelValues("qlik.orders", "1", "go-cdc-consumers")))
+}
+
+func TestLagPoller_PollDeletesUnassignedSeries(t *testing.T) {
+	metrics.KafkaConsumerOffsetLag.Reset()
+
+	provider := &fakeOffsetProvider{
+		assigned: []kafka.TopicPartition{
+			topicPartition("qlik.orders", 0),
+			topicPartition("qlik.orders", 1),
+		},
+		watermarks: map[string]watermarks{
+			"qlik.orders/0": {low: 0, high: 10},
+			"qlik.orders/1": {low: 0, high: 30},
+		},
+	}
+
+	poller := NewLagPoller(provider, "go-cdc-consumers", time.Second, zap.NewNop())
+	assert.NoError(t, poller.Poll())
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.KafkaConsumerOffsetLag))
+
+	// Partition 0 moved to another consumer without a revoke reaching us
+	provider.assigned = provider.assigned[1:]
+	assert.NoError(t, poller.Poll())
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.KafkaConsumerOffsetLag))
+
+	provider.assigned = nil
+	assert.NoError(t, poller.Poll())
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.KafkaConsumerOffsetLag))
+}
+
+func TestLagPoller_RunPollsUntilCancelled(t *testing.T) {
+	metrics.KafkaConsumerOffsetLag.Reset()
+
+	provider := &fakeOffsetProvider{
+		assigned:   []kafka.TopicPartition{topicPartition("qlik.products", 0)},
+		committed:  map[string]kafka.Offset{"qlik.products/0": 1},
+		watermarks: map[string]watermarks{"qlik.products/0": {low: 0, high: 8}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewLagPoller(provider, "go-cdc-consumers", 10*time.Millisecond, zap.NewNop()).Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.KafkaConsumerOffsetLag.WithLabelValues("qlik.products", "0", "go-cdc-consumers")) == 7
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("poller did not stop after cancellation")
+	}
+}
+
+func TestOffsetLag(t *testing.T) {
+	tests := []struct {
+		name      string
+		committed int64
+		low       int64
+		high      int64
+		expected  int64
+	}{
+		{name: "caught up", committed: 100, low: 0, high: 100, expected: 0},
+		{name: "behind", committed: 60, low: 0, high: 100, expected: 40},
+		{name: "no commit", committed: int64(kafka.OffsetInvalid), low: 10, high: 100, expected: 90},
+		{name: "committed past high-water mark", committed: 120, low: 0, high: 100, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, offsetLag(tt.committed, tt.low, tt.high))
+		})
+	}
+}
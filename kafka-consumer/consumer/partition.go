@@ -0,0 +1,54 @@
+package consumer
+
+// murmur2Seed is the seed Kafka's default partitioner uses
+const murmur2Seed uint32 = 0x9747b28c
+
+// PartitionForKey returns the partition Kafka's default partitioner assigns a
+// keyed message to: murmur2 of the key, made positive, modulo the partition
+// count. Records with the same key always land on the same partition, which is
+// what per-key ordering relies on. Returns -1 if numPartitions is not positive.
+func PartitionForKey(key []byte, numPartitions int) int {
+	if numPartitions <= 0 {
+		return -1
+	}
+	return int(murmur2(key)&0x7fffffff) % numPartitions
+}
+
+// murmur2 is the 32-bit MurmurHash2 variant implemented by Kafka's
+// org.apache.kafka.common.utils.Utils.murmur2
+func murmur2(data []byte) uint32 {
+	const (
+		m = 0x5bd1e995
+		r = 24
+	)
+
+	length := len(data)
+	h := murmur2Seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
@@ -0,0 +1,64 @@
+package consumer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur2_MatchesKafka(t *testing.T) {
+	// Expected values from Kafka's UtilsTest.testMurmur2, as signed 32-bit ints
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+
+	for key, expected := range tests {
+		t.Run(key, func(t *testing.T) {
+			assert.Equal(t, expected, int32(murmur2([]byte(key))))
+		})
+	}
+}
+
+func TestPartitionForKey(t *testing.T) {
+	tests := []struct {
+		key           string
+		numPartitions int
+		expected      int
+	}{
+		// Positive murmur2 of the Kafka reference keys, modulo the partition count
+		{"21", 16, 12},
+		{"21", 7, 3},
+		{"foobar", 10, 6},
+		{"abc", 24, 3},
+		{"a-little-bit-long-string", 3, 2},
+		{"abc", 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.key, tt.numPartitions), func(t *testing.T) {
+			assert.Equal(t, tt.expected, PartitionForKey([]byte(tt.key), tt.numPartitions))
+		})
+	}
+}
+
+func TestPartitionForKey_Stable(t *testing.T) {
+	key := []byte(`{"customer_id":"cust-123"}`)
+	first := PartitionForKey(key, 24)
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, first, PartitionForKey(key, 24))
+	}
+	assert.GreaterOrEqual(t, first, 0)
+	assert.Less(t, first, 24)
+}
+
+func TestPartitionForKey_InvalidPartitionCount(t *testing.T) {
+	assert.Equal(t, -1, PartitionForKey([]byte("abc"), 0))
+	assert.Equal(t, -1, PartitionForKey([]byte("abc"), -3))
+}
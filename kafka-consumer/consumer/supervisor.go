@@ -0,0 +1,110 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// Consumer is a cluster consumer managed by the Supervisor
+type Consumer interface {
+	Consume(ctx context.Context, processor MessageProcessor) error
+	Close() error
+}
+
+// ConsumerFactory creates a Consumer for a single cluster
+type ConsumerFactory func(config *KafkaConfig, logger *zap.Logger) (Consumer, error)
+
+// NewConsumer is the default ConsumerFactory, backed by KafkaConsumer
+func NewConsumer(config *KafkaConfig, logger *zap.Logger) (Consumer, error) {
+	kc, err := NewKafkaConsumer(config, logger)
+	if err != nil {
+		return nil, err
+	}
+	return kc, nil
+}
+
+// Supervisor runs one consumer per configured Kafka cluster
+type Supervisor struct {
+	clusters []*KafkaConfig
+	factory  ConsumerFactory
+	logger   *zap.Logger
+}
+
+// NewSupervisor creates a supervisor for the given clusters
+func NewSupervisor(clusters []*KafkaConfig, factory ConsumerFactory, logger *zap.Logger) *Supervisor {
+	return &Supervisor{
+		clusters: clusters,
+		factory:  factory,
+		logger:   logger,
+	}
+}
+
+// Run starts a consumer for every cluster and blocks until ctx is cancelled or
+// any consumer fails. All consumers are then stopped and closed before Run
+// returns.
+func (s *Supervisor) Run(ctx context.Context, processor MessageProcessor) error {
+	if len(s.clusters) == 0 {
+		return fmt.Errorf("no Kafka clusters configured")
+	}
+
+	consumers := make([]Consumer, 0, len(s.clusters))
+	for _, config := range s.clusters {
+		c, err := s.factory(config, s.logger.With(zap.String("cluster", config.ClusterName())))
+		if err != nil {
+			s.closeAll(consumers)
+			return fmt.Errorf("failed to create consumer for cluster %s: %w", config.ClusterName(), err)
+		}
+		consumers = append(consumers, c)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, len(consumers))
+	var wg sync.WaitGroup
+	for i, c := range consumers {
+		cluster := s.clusters[i].ClusterName()
+		wg.Add(1)
+		go func(c Consumer) {
+			defer wg.Done()
+			metrics.KafkaClusterConsumersActive.WithLabelValues(cluster).Set(1)
+			defer metrics.KafkaClusterConsumersActive.WithLabelValues(cluster).Set(0)
+
+			s.logger.Info("starting cluster consumer", zap.String("cluster", cluster))
+			if err := c.Consume(runCtx, processor); err != nil && !errors.Is(err, context.Canceled) {
+				s.logger.Error("cluster consumer failed", zap.Error(err), zap.String("cluster", cluster))
+				errCh <- fmt.Errorf("cluster %s: %w", cluster, err)
+				// One failed cluster stops the process so it can be restarted
+				cancel()
+			}
+		}(c)
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+	if err := s.closeAll(consumers); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// closeAll closes every consumer, collecting any errors
+func (s *Supervisor) closeAll(consumers []Consumer) error {
+	var errs []error
+	for _, c := range consumers {
+		if err := c.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close consumer: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,196 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// mockConsumer blocks in Consume until its context is cancelled or it is told to fail
+type mockConsumer struct {
+	config  *KafkaConfig
+	started chan struct{}
+	fail    chan error
+	mu      sync.Mutex
+	closed  bool
+}
+
+func (m *mockConsumer) Consume(ctx context.Context, processor MessageProcessor) error {
+	close(m.started)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-m.fail:
+		return err
+	}
+}
+
+func (m *mockConsumer) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func (m *mockConsumer) isClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+// mockFactory records every consumer it creates
+type mockFactory struct {
+	mu        sync.Mutex
+	consumers []*mockConsumer
+	failFor   string
+}
+
+func (f *mockFactory) create(config *KafkaConfig, logger *zap.Logger) (Consumer, error) {
+	if config.ClusterName() == f.failFor {
+		return nil, errors.New("broker unreachable")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := &mockConsumer{config: config, started: make(chan struct{}), fail: make(chan error, 1)}
+	f.consumers = append(f.consumers, c)
+	return c, nil
+}
+
+type noopProcessor struct{}
+
+func (noopProcessor) Process(ctx context.Context, msg *kafka.Message) error { return nil }
+
+func testClusters() []*KafkaConfig {
+	return []*KafkaConfig{
+		{Name: "on-prem", BootstrapServers: "onprem:9092", Topics: []string{"qlik.customers"}},
+		{Name: "cloud", BootstrapServers: "cloud:9092", Topics: []string{"qlik.orders"}},
+	}
+}
+
+func waitStarted(t *testing.T, c *mockConsumer) {
+	select {
+	case <-c.started:
+	case <-time.After(time.Second):
+		t.Fatalf("consumer for %s never started", c.config.Name)
+	}
+}
+
+func TestSupervisor_StartsConsumerPerCluster(t *testing.T) {
+	factory := &mockFactory{}
+	supervisor := NewSupervisor(testClusters(), factory.create, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- supervisor.Run(ctx, noopProcessor{}) }()
+
+	require.Eventually(t, func() bool {
+		factory.mu.Lock()
+		defer factory.mu.Unlock()
+		return len(factory.consumers) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	for _, c := range factory.consumers {
+		waitStarted(t, c)
+	}
+	assert.Equal(t, "on-prem", factory.consumers[0].config.Name)
+	assert.Equal(t, "cloud", factory.consumers[1].config.Name)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.KafkaClusterConsumersActive.WithLabelValues("on-prem")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.KafkaClusterConsumersActive.WithLabelValues("cloud")))
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not stop after cancellation")
+	}
+}
+
+func TestSupervisor_ShutdownClosesAllConsumers(t *testing.T) {
+	factory := &mockFactory{}
+	supervisor := NewSupervisor(testClusters(), factory.create, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- supervisor.Run(ctx, noopProcessor{}) }()
+
+	require.Eventually(t, func() bool {
+		factory.mu.Lock()
+		defer factory.mu.Unlock()
+		return len(factory.consumers) == 2
+	}, time.Second, 10*time.Millisecond)
+	for _, c := range factory.consumers {
+		waitStarted(t, c)
+	}
+
+	cancel()
+	<-done
+
+	for _, c := range factory.consumers {
+		assert.True(t, c.isClosed(), "consumer for %s should be closed", c.config.Name)
+	}
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.KafkaClusterConsumersActive.WithLabelValues("on-prem")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.KafkaClusterConsumersActive.WithLabelValues("cloud")))
+}
+
+func TestSupervisor_ConsumerFailureStopsAll(t *testing.T) {
+	factory := &mockFactory{}
+	supervisor := NewSupervisor(testClusters(), factory.create, zap.NewNop())
+
+	done := make(chan error, 1)
+	go func() { done <- supervisor.Run(context.Background(), noopProcessor{}) }()
+
+	require.Eventually(t, func() bool {
+		factory.mu.Lock()
+		defer factory.mu.Unlock()
+		return len(factory.consumers) == 2
+	}, time.Second, 10*time.Millisecond)
+	for _, c := range factory.consumers {
+		waitStarted(t, c)
+	}
+
+	factory.consumers[1].fail <- errors.New("subscription lost")
+
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "cluster cloud")
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not stop after consumer failure")
+	}
+	for _, c := range factory.consumers {
+		assert.True(t, c.isClosed())
+	}
+}
+
+func TestSupervisor_FactoryErrorClosesCreatedConsumers(t *testing.T) {
+	factory := &mockFactory{failFor: "cloud"}
+	supervisor := NewSupervisor(testClusters(), factory.create, zap.NewNop())
+
+	err := supervisor.Run(context.Background(), noopProcessor{})
+
+	assert.ErrorContains(t, err, "failed to create consumer for cluster cloud")
+	require.Len(t, factory.consumers, 1)
+	assert.True(t, factory.consumers[0].isClosed())
+}
+
+func TestSupervisor_NoClusters(t *testing.T) {
+	supervisor := NewSupervisor(nil, (&mockFactory{}).create, zap.NewNop())
+
+	err := supervisor.Run(context.Background(), noopProcessor{})
+
+	assert.Error(t, err)
+}
+
+func TestKafkaConfig_ClusterName(t *testing.T) {
+	assert.Equal(t, "cloud", (&KafkaConfig{Name: "cloud", BootstrapServers: "cloud:9092"}).ClusterName())
+	assert.Equal(t, "cloud:9092", (&KafkaConfig{BootstrapServers: "cloud:9092"}).ClusterName())
+}
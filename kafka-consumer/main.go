@@ -6,13 +6,24 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry"
 	"github.com/wgu/go-performance-enablement/kafka-consumer/consumer"
 	"github.com/wgu/go-performance-enablement/kafka-consumer/processor"
+	"github.com/wgu/go-performance-enablement/kafka-consumer/shutdown"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/logging"
 	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 )
 
 const (
@@ -21,8 +32,8 @@ const (
 )
 
 func main() {
-	// Initialize logger
-	logger, err := zap.NewProduction()
+	// Initialize logger from LOG_LEVEL and LOG_FORMAT
+	logger, err := logging.New()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
 		os.Exit(1)
@@ -31,8 +42,18 @@ func main() {
 
 	logger.Info("starting Kafka CDC consumer")
 
-	// Load configuration from environment
-	config := loadConfig()
+	// Load configuration from the environment and KAFKA_CONFIG_FILE
+	config, err := loadConfig()
+	if err != nil {
+		logger.Fatal("failed to load configuration", zap.Error(err))
+	}
+	if err := config.Validate(); err != nil {
+		logger.Fatal("invalid configuration", zap.Error(err))
+	}
+	if len(config.IgnoredProperties) > 0 {
+		logger.Warn("ignoring unsupported Kafka config file properties",
+			zap.Strings("properties", config.IgnoredProperties))
+	}
 
 	// Start metrics server
 	metricsServer := metrics.NewMetricsServer(config.MetricsPort)
@@ -43,15 +64,79 @@ func main() {
 		}
 	}()
 
-	// Create Kafka consumer
-	kafkaConsumer, err := consumer.NewKafkaConsumer(config.KafkaConfig, logger)
+	// Create CDC processor
+	cdcProcessor := processor.NewCDCProcessor(logger)
+
+	serializer, err := newSerializer(config)
 	if err != nil {
-		logger.Fatal("failed to create Kafka consumer", zap.Error(err))
+		logger.Fatal("failed to create output serializer", zap.Error(err))
 	}
-	defer kafkaConsumer.Close()
+	cdcProcessor.SetSerializer(serializer)
+	cdcProcessor.SetMaxMessageSize(config.MaxMessageSize)
+	cdcProcessor.SetUTF8Policy(config.UTF8Policy)
 
-	// Create CDC processor
-	cdcProcessor := processor.NewCDCProcessor(logger)
+	// Skip changes older, by LSN/SCN or timestamp, than the last applied per row
+	cdcProcessor.SetSourceOrdering(processor.NewSourceOrderGuard(config.SourceOrderRows))
+
+	// Reload tables in REFRESH_TABLE_NAME from REFRESH full loads, removing
+	// rows a load no longer contains once every partition has delivered it
+	if config.RefreshTable != "" {
+		awsClients, err := awsutils.NewAWSClients(context.Background())
+		if err != nil {
+			logger.Fatal("failed to create AWS clients", zap.Error(err))
+		}
+		cdcProcessor.SetRefreshCoordinator(processor.NewRefreshCoordinator(
+			processor.NewDynamoDBRefreshTarget(awsClients.DynamoDB, config.RefreshTable),
+			processor.NewDynamoDBRefreshStore(awsClients.DynamoDB, config.RefreshStateTable),
+			logger,
+		))
+	}
+
+	// Decode Avro input with codecs resolved from the registry by schema ID
+	if config.KafkaConfig.SchemaRegistry != "" {
+		registry, err := newSchemaRegistry(config)
+		if err != nil {
+			logger.Fatal("failed to create schema registry client", zap.Error(err))
+		}
+		cdcProcessor.SetCodecCache(processor.NewCodecCache(registry))
+	}
+
+	// Dead-letter messages the processor rejects, when a DLQ topic is configured
+	var dlqProducer *kafka.Producer
+	if config.DLQTopic != "" {
+		dlqProducer, err = newProducer(config.KafkaConfig)
+		if err != nil {
+			logger.Fatal("failed to create dead-letter producer", zap.Error(err))
+		}
+		cdcProcessor.SetDeadLetterQueue(processor.NewKafkaDeadLetterQueue(dlqProducer, config.DLQTopic))
+	}
+
+	// Publish processed events to KAFKA_OUTPUT_TOPIC, encoded as OUTPUT_FORMAT
+	var outputProducer *kafka.Producer
+	if config.OutputTopic != "" {
+		outputProducer, err = newProducer(config.KafkaConfig)
+		if err != nil {
+			logger.Fatal("failed to create output producer", zap.Error(err))
+		}
+		cdcProcessor.SetOutput(outputProducer, config.OutputTopic)
+	}
+
+	// Supervise one consumer per configured cluster. While a cluster is idle,
+	// deliver any dead letters still queued in the producer.
+	factory := consumer.NewConsumer
+	if dlqProducer != nil {
+		factory = func(config *consumer.KafkaConfig, logger *zap.Logger) (consumer.Consumer, error) {
+			kc, err := consumer.NewKafkaConsumer(config, logger)
+			if err != nil {
+				return nil, err
+			}
+			kc.SetIdleHandler(func(ctx context.Context) {
+				dlqProducer.Flush(0)
+			})
+			return kc, nil
+		}
+	}
+	supervisor := consumer.NewSupervisor(config.Clusters, factory, logger)
 
 	// Setup graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -60,27 +145,66 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start consuming messages
+	// Start consuming messages from all clusters
+	consumersDone := make(chan struct{})
 	go func() {
-		if err := kafkaConsumer.Consume(ctx, cdcProcessor); err != nil {
+		defer close(consumersDone)
+		if err := supervisor.Run(ctx, cdcProcessor); err != nil {
 			logger.Error("consumer error", zap.Error(err))
-			cancel()
 		}
 	}()
 
-	// Wait for shutdown signal
-	sig := <-sigChan
-	logger.Info("received shutdown signal", zap.String("signal", sig.String()))
-
-	// Initiate graceful shutdown
-	cancel()
+	// Wait for shutdown signal or for the consumers to stop on their own
+	select {
+	case sig := <-sigChan:
+		logger.Info("received shutdown signal", zap.String("signal", sig.String()))
+	case <-consumersDone:
+		logger.Info("consumers stopped")
+	}
 
-	// Shutdown metrics server
-	_, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
-	defer shutdownCancel()
+	// Stop components in order: consumers first so in-flight commits finish,
+	// then flush dead letters and output, the metrics server, and the logger
+	coordinator := shutdown.NewCoordinator(shutdownTimeout, logger)
+	coordinator.Register("consumers", func(ctx context.Context) error {
+		cancel()
+		select {
+		case <-consumersDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if dlqProducer != nil {
+		coordinator.Register("dlq-producer", func(ctx context.Context) error {
+			defer dlqProducer.Close()
+			deadline, _ := ctx.Deadline()
+			if remaining := dlqProducer.Flush(int(time.Until(deadline).Milliseconds())); remaining > 0 {
+				return fmt.Errorf("%d dead-letter messages not delivered", remaining)
+			}
+			return nil
+		})
+	}
+	if outputProducer != nil {
+		coordinator.Register("output-producer", func(ctx context.Context) error {
+			defer outputProducer.Close()
+			deadline, _ := ctx.Deadline()
+			if remaining := outputProducer.Flush(int(time.Until(deadline).Milliseconds())); remaining > 0 {
+				return fmt.Errorf("%d output messages not delivered", remaining)
+			}
+			return nil
+		})
+	}
+	coordinator.Register("metrics-server", func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		return metricsServer.Shutdown(time.Until(deadline))
+	})
+	coordinator.Register("logger", func(ctx context.Context) error {
+		logger.Sync()
+		return nil
+	})
 
-	if err := metricsServer.Shutdown(shutdownTimeout); err != nil {
-		logger.Error("failed to shutdown metrics server", zap.Error(err))
+	if err := coordinator.Shutdown(context.Background()); err != nil {
+		logger.Error("shutdown incomplete", zap.Error(err))
 	}
 
 	logger.Info("shutdown complete", zap.Duration("timeout", shutdownTimeout))
@@ -88,26 +212,329 @@ func main() {
 
 // Config holds application configuration
 type Config struct {
-	KafkaConfig *consumer.KafkaConfig
-	MetricsPort string
+	KafkaConfig    *consumer.KafkaConfig
+	Clusters       []*consumer.KafkaConfig
+	MetricsPort    string
+	OutputFormat   string
+	OutputTopic    string
+	MaxMessageSize int
+	DLQTopic       string
+
+	// SourceOrderRows bounds how many rows source ordering remembers
+	SourceOrderRows int
+
+	// UTF8Policy says whether events with invalid UTF-8 have it replaced or
+	// are dead-lettered
+	UTF8Policy events.UTF8Policy
+
+	// RefreshTable receives REFRESH full loads, with each table's refresh
+	// tracked in RefreshStateTable. Both or neither are set.
+	RefreshTable      string
+	RefreshStateTable string
+
+	// IgnoredProperties lists config file keys neither loadConfig nor
+	// librdkafka uses
+	IgnoredProperties []string
 }
 
-// loadConfig loads configuration from environment variables
-func loadConfig() *Config {
+// Validate checks every cluster configuration
+func (c *Config) Validate() error {
+	for _, cluster := range c.Clusters {
+		if err := cluster.Validate(); err != nil {
+			return err
+		}
+	}
+	if (c.RefreshTable == "") != (c.RefreshStateTable == "") {
+		return fmt.Errorf("REFRESH_TABLE_NAME and REFRESH_STATE_TABLE_NAME must be set together")
+	}
+	return nil
+}
+
+// loadConfig loads configuration from KAFKA_CONFIG_FILE, when set, and
+// environment variables. Environment variables take precedence over the file.
+func loadConfig() (*Config, error) {
+	file, err := readKafkaConfigFile(os.Getenv("KAFKA_CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	setting := func(key, property, fallback string) string {
+		if value := file[property]; value != "" {
+			fallback = value
+		}
+		return getEnv(key, fallback)
+	}
+
+	topics := []string{"qlik.customers", "qlik.orders"}
+	if value := file["topics"]; value != "" {
+		topics = splitList(value)
+	}
+
+	properties, ignored := passthroughProperties(file)
+
+	kafkaConfig := &consumer.KafkaConfig{
+		Name:             getEnv("KAFKA_CLUSTER_NAME", "default"),
+		BootstrapServers: setting("KAFKA_BOOTSTRAP_SERVERS", "bootstrap.servers", "localhost:9092"),
+		GroupID:          setting("KAFKA_GROUP_ID", "group.id", "go-cdc-consumers"),
+		Topics:           getEnvSlice("KAFKA_TOPICS", topics),
+		SecurityProtocol: setting("KAFKA_SECURITY_PROTOCOL", "security.protocol", "PLAINTEXT"),
+		SASLMechanism:    setting("KAFKA_SASL_MECHANISM", "sasl.mechanism", "PLAIN"),
+		SASLUsername:     setting("KAFKA_SASL_USERNAME", "sasl.username", ""),
+		SASLPassword:     setting("KAFKA_SASL_PASSWORD", "sasl.password", ""),
+		SchemaRegistry:   setting("SCHEMA_REGISTRY_URL", "schema.registry.url", "http://localhost:8081"),
+		AutoOffsetReset:  setting("KAFKA_AUTO_OFFSET_RESET", "auto.offset.reset", "earliest"),
+		PollTimeout:      getEnvDuration("KAFKA_POLL_TIMEOUT", time.Second),
+		IdleTimeout:      getEnvDuration("KAFKA_IDLE_TIMEOUT", time.Minute),
+		Backoff:          getEnv("KAFKA_ERROR_BACKOFF", consumer.BackoffExponential),
+		BackoffBase:      getEnvDuration("KAFKA_ERROR_BACKOFF_BASE", 100*time.Millisecond),
+		BackoffMax:       getEnvDuration("KAFKA_ERROR_BACKOFF_MAX", 30*time.Second),
+		Properties:       properties,
+	}
+
+	clusters, err := getEnvClusters("KAFKA_CLUSTERS", kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// INVALID_UTF8_POLICY is "replace" (the default) or "dlq"
+	utf8Policy, err := events.ParseUTF8Policy(os.Getenv("INVALID_UTF8_POLICY"))
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		KafkaConfig: &consumer.KafkaConfig{
-			BootstrapServers: getEnv("KAFKA_BOOTSTRAP_SERVERS", "localhost:9092"),
-			GroupID:          getEnv("KAFKA_GROUP_ID", "go-cdc-consumers"),
-			Topics:           getEnvSlice("KAFKA_TOPICS", []string{"qlik.customers", "qlik.orders"}),
-			SecurityProtocol: getEnv("KAFKA_SECURITY_PROTOCOL", "PLAINTEXT"),
-			SASLMechanism:    getEnv("KAFKA_SASL_MECHANISM", "PLAIN"),
-			SASLUsername:     getEnv("KAFKA_SASL_USERNAME", ""),
-			SASLPassword:     getEnv("KAFKA_SASL_PASSWORD", ""),
-			SchemaRegistry:   getEnv("SCHEMA_REGISTRY_URL", "http://localhost:8081"),
-			AutoOffsetReset:  getEnv("KAFKA_AUTO_OFFSET_RESET", "earliest"),
-		},
-		MetricsPort: getEnv("METRICS_PORT", defaultMetricsPort),
+		KafkaConfig:       kafkaConfig,
+		Clusters:          clusters,
+		MetricsPort:       getEnv("METRICS_PORT", defaultMetricsPort),
+		OutputFormat:      getEnv("OUTPUT_FORMAT", processor.OutputFormatJSON),
+		OutputTopic:       getEnv("KAFKA_OUTPUT_TOPIC", ""),
+		MaxMessageSize:    getEnvInt("MAX_MESSAGE_SIZE", processor.DefaultMaxMessageSize),
+		DLQTopic:          getEnv("KAFKA_DLQ_TOPIC", ""),
+		SourceOrderRows:   getEnvInt("SOURCE_ORDER_MAX_ROWS", processor.DefaultSourceOrderRows),
+		UTF8Policy:        utf8Policy,
+		RefreshTable:      getEnv("REFRESH_TABLE_NAME", ""),
+		RefreshStateTable: getEnv("REFRESH_STATE_TABLE_NAME", ""),
+		IgnoredProperties: ignored,
+	}, nil
+}
+
+// kafkaPropertyAliases maps alternative librdkafka property names to the
+// name loadConfig reads
+var kafkaPropertyAliases = map[string]string{
+	"metadata.broker.list": "bootstrap.servers",
+	"sasl.mechanisms":      "sasl.mechanism",
+	"sasl.user":            "sasl.username",
+}
+
+// loadedProperties lists the config file keys loadConfig reads into
+// KafkaConfig fields rather than passing through to librdkafka
+var loadedProperties = map[string]bool{
+	"bootstrap.servers":   true,
+	"group.id":            true,
+	"security.protocol":   true,
+	"sasl.mechanism":      true,
+	"sasl.username":       true,
+	"sasl.password":       true,
+	"schema.registry.url": true,
+	"auto.offset.reset":   true,
+	"topics":              true,
+}
+
+// passthroughProperties returns the config file properties loadConfig doesn't
+// read itself, such as ssl.* or fetch settings, for the consumer to pass to
+// librdkafka. Other schema.registry.* keys are returned, sorted, as ignored
+// because librdkafka rejects properties it doesn't know.
+func passthroughProperties(file map[string]string) (properties map[string]string, ignored []string) {
+	for key, value := range file {
+		if loadedProperties[key] {
+			continue
+		}
+		if strings.HasPrefix(key, "schema.registry.") {
+			ignored = append(ignored, key)
+			continue
+		}
+		if _, alias := kafkaPropertyAliases[key]; alias {
+			continue
+		}
+		if properties == nil {
+			properties = make(map[string]string)
+		}
+		properties[key] = value
 	}
+	sort.Strings(ignored)
+	return properties, ignored
+}
+
+// readKafkaConfigFile reads Kafka settings keyed by librdkafka property name
+// from a .properties file or, for a .yaml or .yml extension, a flat YAML map.
+// Topics are listed under "topics", comma-separated or as a YAML sequence.
+// An empty path reads nothing.
+func readKafkaConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kafka config file: %w", err)
+	}
+
+	var properties map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		properties, err = parseYAMLProperties(data)
+	default:
+		properties, err = parseProperties(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka config file %s: %w", path, err)
+	}
+
+	for alias, name := range kafkaPropertyAliases {
+		if value, ok := properties[alias]; ok {
+			if _, set := properties[name]; !set {
+				properties[name] = value
+			}
+		}
+	}
+	return properties, nil
+}
+
+// parseProperties parses key=value lines in Java properties style, skipping
+// blank lines and # or ! comments
+func parseProperties(data []byte) (map[string]string, error) {
+	properties := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		end := strings.IndexAny(line, "=:")
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: want key=value, got %q", i+1, line)
+		}
+		key := strings.TrimSpace(line[:end])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: empty key", i+1)
+		}
+		properties[key] = strings.TrimSpace(line[end+1:])
+	}
+	return properties, nil
+}
+
+// parseYAMLProperties parses a flat YAML map of scalars. A sequence value is
+// joined with commas, matching the properties form.
+func parseYAMLProperties(data []byte) (map[string]string, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			properties[key] = ""
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			properties[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s: nested maps are not supported", key)
+		default:
+			properties[key] = fmt.Sprint(v)
+		}
+	}
+	return properties, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newSerializer creates the output serializer selected by config
+func newSerializer(config *Config) (processor.Serializer, error) {
+	if config.OutputFormat != processor.OutputFormatAvro {
+		return processor.NewSerializer(config.OutputFormat, nil)
+	}
+
+	registry, err := newSchemaRegistry(config)
+	if err != nil {
+		return nil, err
+	}
+	return processor.NewSerializer(config.OutputFormat, registry)
+}
+
+// newSchemaRegistry creates a schema registry client for the configured URL
+func newSchemaRegistry(config *Config) (schemaregistry.Client, error) {
+	registry, err := schemaregistry.NewClient(schemaregistry.NewConfig(config.KafkaConfig.SchemaRegistry))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema registry client: %w", err)
+	}
+	return registry, nil
+}
+
+// newProducer creates a Kafka producer for the given cluster
+func newProducer(config *consumer.KafkaConfig) (*kafka.Producer, error) {
+	producerConfig := &kafka.ConfigMap{
+		"bootstrap.servers": config.BootstrapServers,
+		"acks":              "all",
+	}
+	if config.SecurityProtocol != "PLAINTEXT" {
+		producerConfig.SetKey("security.protocol", config.SecurityProtocol)
+		producerConfig.SetKey("sasl.mechanism", config.SASLMechanism)
+		producerConfig.SetKey("sasl.username", config.SASLUsername)
+		producerConfig.SetKey("sasl.password", config.SASLPassword)
+	}
+
+	producer, err := kafka.NewProducer(producerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka producer: %w", err)
+	}
+	return producer, nil
+}
+
+// getEnvClusters gets a JSON array of cluster configs from the environment.
+// Each cluster inherits any field it leaves unset from base. Returns base
+// alone if the variable is unset, and an error if it is invalid or empty.
+func getEnvClusters(key string, base *consumer.KafkaConfig) ([]*consumer.KafkaConfig, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return []*consumer.KafkaConfig{base}, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("invalid %s: no clusters listed", key)
+	}
+
+	clusters := make([]*consumer.KafkaConfig, 0, len(raw))
+	for i, data := range raw {
+		cluster := *base
+		cluster.Name = ""
+		// Clear Topics so decoding can't write into base's backing array
+		cluster.Topics = nil
+		if err := json.Unmarshal(data, &cluster); err != nil {
+			return nil, fmt.Errorf("invalid %s: cluster %d: %w", key, i, err)
+		}
+		if cluster.Topics == nil {
+			cluster.Topics = append([]string(nil), base.Topics...)
+		}
+		clusters = append(clusters, &cluster)
+	}
+	return clusters, nil
 }
 
 // getEnv gets environment variable with fallback
@@ -118,6 +545,27 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvInt gets environment variable as an integer with fallback
+func getEnvInt(key string, fallback int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
+
+// getEnvDuration gets environment variable as a duration, such as "500ms",
+// with fallback
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return fallback
+}
+
 // getEnvSlice gets environment variable as JSON array with fallback
 func getEnvSlice(key string, fallback []string) []string {
 	if value := os.Getenv(key); value != "" {
@@ -2,9 +2,13 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/wgu/go-performance-enablement/kafka-consumer/processor"
+	"github.com/wgu/go-performance-enablement/pkg/events"
 )
 
 func TestGetEnv_WithValue(t *testing.T) {
@@ -112,14 +116,23 @@ func TestLoadConfig_Defaults(t *testing.T) {
 		"KAFKA_SASL_PASSWORD",
 		"SCHEMA_REGISTRY_URL",
 		"KAFKA_AUTO_OFFSET_RESET",
+		"KAFKA_CLUSTER_NAME",
+		"KAFKA_CLUSTERS",
 		"METRICS_PORT",
+		"OUTPUT_FORMAT",
+		"KAFKA_OUTPUT_TOPIC",
+		"MAX_MESSAGE_SIZE",
+		"KAFKA_DLQ_TOPIC",
+		"KAFKA_CONFIG_FILE",
+		"INVALID_UTF8_POLICY",
 	}
 	
 	for _, key := range envVars {
 		os.Unsetenv(key)
 	}
 	
-	config := loadConfig()
+	config, err := loadConfig()
+	assert.NoError(t, err)
 	
 	assert.NotNil(t, config)
 	assert.NotNil(t, config.KafkaConfig)
@@ -135,6 +148,214 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	assert.Equal(t, "http://localhost:8081", config.KafkaConfig.SchemaRegistry)
 	assert.Equal(t, "earliest", config.KafkaConfig.AutoOffsetReset)
 	assert.Equal(t, defaultMetricsPort, config.MetricsPort)
+	assert.Equal(t, "json", config.OutputFormat)
+	assert.Equal(t, "", config.OutputTopic)
+	assert.Equal(t, processor.DefaultMaxMessageSize, config.MaxMessageSize)
+	assert.Equal(t, "", config.DLQTopic)
+	assert.Equal(t, processor.DefaultSourceOrderRows, config.SourceOrderRows)
+	assert.Equal(t, events.UTF8Replace, config.UTF8Policy)
+	
+	// Without KAFKA_CLUSTERS the single cluster config is used
+	assert.Equal(t, "default", config.KafkaConfig.Name)
+	assert.Len(t, config.Clusters, 1)
+	assert.Same(t, config.KafkaConfig, config.Clusters[0])
+}
+
+func TestLoadConfig_MultipleClusters(t *testing.T) {
+	os.Setenv("KAFKA_GROUP_ID", "federated-group")
+	os.Setenv("KAFKA_CLUSTERS", `[
+		{"name": "on-prem", "bootstrap_servers": "onprem:9092", "topics": ["qlik.customers"]},
+		{"name": "cloud", "bootstrap_servers": "cloud:9092", "topics": ["qlik.orders"], "security_protocol": "SASL_SSL"}
+	]`)
+	defer func() {
+		os.Unsetenv("KAFKA_GROUP_ID")
+		os.Unsetenv("KAFKA_CLUSTERS")
+	}()
+	
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	
+	assert.Len(t, config.Clusters, 2)
+	
+	onPrem := config.Clusters[0]
+	assert.Equal(t, "on-prem", onPrem.Name)
+	assert.Equal(t, "onprem:9092", onPrem.BootstrapServers)
+	assert.Equal(t, []string{"qlik.customers"}, onPrem.Topics)
+	assert.Equal(t, "PLAINTEXT", onPrem.SecurityProtocol)
+	
+	cloud := config.Clusters[1]
+	assert.Equal(t, "cloud", cloud.Name)
+	assert.Equal(t, "cloud:9092", cloud.BootstrapServers)
+	assert.Equal(t, []string{"qlik.orders"}, cloud.Topics)
+	assert.Equal(t, "SASL_SSL", cloud.SecurityProtocol)
+	
+	// Unset fields are inherited from the base config
+	assert.Equal(t, "federated-group", onPrem.GroupID)
+	assert.Equal(t, "federated-group", cloud.GroupID)
+	assert.Equal(t, "earliest", cloud.AutoOffsetReset)
+}
+
+func TestLoadConfig_InvalidClusters(t *testing.T) {
+	defer os.Unsetenv("KAFKA_CLUSTERS")
+	
+	// A misconfigured cluster list fails rather than falling back to one cluster
+	for _, value := range []string{`not json`, `[]`, `[{"name": "us-west-2"}, {"topics": "qlik.orders"}]`} {
+		os.Setenv("KAFKA_CLUSTERS", value)
+	
+		config, err := loadConfig()
+		assert.Error(t, err, value)
+		assert.ErrorContains(t, err, "KAFKA_CLUSTERS", value)
+		assert.Nil(t, config, value)
+	}
+}
+
+func TestLoadConfig_MessageLimits(t *testing.T) {
+	os.Setenv("MAX_MESSAGE_SIZE", "65536")
+	os.Setenv("KAFKA_DLQ_TOPIC", "qlik.dlq")
+	defer func() {
+		os.Unsetenv("MAX_MESSAGE_SIZE")
+		os.Unsetenv("KAFKA_DLQ_TOPIC")
+	}()
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 65536, config.MaxMessageSize)
+	assert.Equal(t, "qlik.dlq", config.DLQTopic)
+}
+
+func TestLoadConfig_SourceOrderRows(t *testing.T) {
+	t.Setenv("SOURCE_ORDER_MAX_ROWS", "5000")
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 5000, config.SourceOrderRows)
+}
+
+func TestLoadConfig_UTF8Policy(t *testing.T) {
+	t.Setenv("INVALID_UTF8_POLICY", "DLQ")
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, events.UTF8DeadLetter, config.UTF8Policy)
+
+	t.Setenv("INVALID_UTF8_POLICY", "drop")
+	_, err = loadConfig()
+	assert.ErrorContains(t, err, "unknown UTF-8 policy")
+}
+
+func TestLoadConfig_PollAndIdleTimeouts(t *testing.T) {
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, config.KafkaConfig.PollTimeout)
+	assert.Equal(t, time.Minute, config.KafkaConfig.IdleTimeout)
+
+	os.Setenv("KAFKA_POLL_TIMEOUT", "250ms")
+	os.Setenv("KAFKA_IDLE_TIMEOUT", "0s")
+	os.Setenv("KAFKA_CLUSTERS", `[{"name":"on-prem"},{"name":"cloud"}]`)
+	defer func() {
+		os.Unsetenv("KAFKA_POLL_TIMEOUT")
+		os.Unsetenv("KAFKA_IDLE_TIMEOUT")
+		os.Unsetenv("KAFKA_CLUSTERS")
+	}()
+
+	config, err = loadConfig()
+	assert.NoError(t, err)
+	for _, cluster := range config.Clusters {
+		assert.Equal(t, 250*time.Millisecond, cluster.PollTimeout, cluster.Name)
+		assert.Equal(t, time.Duration(0), cluster.IdleTimeout, cluster.Name)
+	}
+}
+
+func TestLoadConfig_ErrorBackoff(t *testing.T) {
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "exponential", config.KafkaConfig.Backoff)
+	assert.Equal(t, 100*time.Millisecond, config.KafkaConfig.BackoffBase)
+	assert.Equal(t, 30*time.Second, config.KafkaConfig.BackoffMax)
+
+	os.Setenv("KAFKA_ERROR_BACKOFF", "fixed")
+	os.Setenv("KAFKA_ERROR_BACKOFF_BASE", "2s")
+	defer func() {
+		os.Unsetenv("KAFKA_ERROR_BACKOFF")
+		os.Unsetenv("KAFKA_ERROR_BACKOFF_BASE")
+	}()
+
+	config, err = loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "fixed", config.KafkaConfig.Backoff)
+	assert.Equal(t, 2*time.Second, config.KafkaConfig.BackoffBase)
+	assert.NoError(t, config.Validate())
+
+	os.Setenv("KAFKA_ERROR_BACKOFF", "linear")
+	config, err = loadConfig()
+	assert.NoError(t, err)
+	assert.Error(t, config.Validate())
+}
+
+func TestGetEnvInt(t *testing.T) {
+	os.Setenv("TEST_ENV_INT", "not-a-number")
+	defer os.Unsetenv("TEST_ENV_INT")
+	assert.Equal(t, 10, getEnvInt("TEST_ENV_INT", 10))
+
+	os.Setenv("TEST_ENV_INT", "42")
+	assert.Equal(t, 42, getEnvInt("TEST_ENV_INT", 10))
+}
+
+func TestConfig_Validate_EmptyTopics(t *testing.T) {
+	os.Setenv("KAFKA_TOPICS", `[]`)
+	defer os.Unsetenv("KAFKA_TOPICS")
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	err = config.Validate()
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no Kafka topics configured")
+}
+
+func TestConfig_Validate_ClusterWithEmptyTopic(t *testing.T) {
+	os.Setenv("KAFKA_CLUSTERS", `[
+		{"name": "on-prem", "topics": ["qlik.customers"]},
+		{"name": "cloud", "topics": [""]}
+	]`)
+	defer os.Unsetenv("KAFKA_CLUSTERS")
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	err = config.Validate()
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cluster cloud")
+}
+
+func TestConfig_Validate_Defaults(t *testing.T) {
+	os.Unsetenv("KAFKA_TOPICS")
+	os.Unsetenv("KAFKA_CLUSTERS")
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	assert.NoError(t, config.Validate())
+}
+
+func TestConfig_Validate_RefreshTables(t *testing.T) {
+	os.Setenv("REFRESH_TABLE_NAME", "cdc-refresh-rows")
+	defer os.Unsetenv("REFRESH_TABLE_NAME")
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+	err = config.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "REFRESH_STATE_TABLE_NAME")
+
+	os.Setenv("REFRESH_STATE_TABLE_NAME", "cdc-refresh-state")
+	defer os.Unsetenv("REFRESH_STATE_TABLE_NAME")
+
+	config, err = loadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "cdc-refresh-rows", config.RefreshTable)
+	assert.Equal(t, "cdc-refresh-state", config.RefreshStateTable)
+	assert.NoError(t, config.Validate())
 }
 
 func TestLoadConfig_CustomValues(t *testing.T) {
@@ -163,7 +384,8 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 		os.Unsetenv("METRICS_PORT")
 	}()
 	
-	config := loadConfig()
+	config, err := loadConfig()
+	assert.NoError(t, err)
 	
 	assert.NotNil(t, config)
 	assert.Equal(t, "kafka:9092", config.KafkaConfig.BootstrapServers)
@@ -255,3 +477,114 @@ func TestGetEnvSlice_MultipleFormats(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfig_PropertiesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kafka.properties")
+	err := os.WriteFile(path, []byte(`# Confluent Cloud cluster
+bootstrap.servers=broker1:9092,broker2:9092
+group.id=file-group
+security.protocol=SASL_SSL
+sasl.mechanisms=SCRAM-SHA-512
+sasl.username = svc-cdc
+sasl.password=secret
+auto.offset.reset=latest
+schema.registry.url=https://registry:8081
+topics=qlik.customers, qlik.orders,qlik.products
+`), 0o600)
+	assert.NoError(t, err)
+	t.Setenv("KAFKA_CONFIG_FILE", path)
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "broker1:9092,broker2:9092", config.KafkaConfig.BootstrapServers)
+	assert.Equal(t, "file-group", config.KafkaConfig.GroupID)
+	assert.Equal(t, "SASL_SSL", config.KafkaConfig.SecurityProtocol)
+	assert.Equal(t, "SCRAM-SHA-512", config.KafkaConfig.SASLMechanism)
+	assert.Equal(t, "svc-cdc", config.KafkaConfig.SASLUsername)
+	assert.Equal(t, "secret", config.KafkaConfig.SASLPassword)
+	assert.Equal(t, "latest", config.KafkaConfig.AutoOffsetReset)
+	assert.Equal(t, "https://registry:8081", config.KafkaConfig.SchemaRegistry)
+	assert.Equal(t, []string{"qlik.customers", "qlik.orders", "qlik.products"}, config.KafkaConfig.Topics)
+	assert.Empty(t, config.KafkaConfig.Properties)
+}
+
+func TestLoadConfig_PassesThroughOtherProperties(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kafka.properties")
+	err := os.WriteFile(path, []byte(`bootstrap.servers=broker:9092
+sasl.mechanisms=PLAIN
+ssl.ca.location=/etc/ssl/certs/ca.pem
+session.timeout.ms=45000
+fetch.min.bytes=1024
+schema.registry.url=https://registry:8081
+schema.registry.basic.auth.user.info=key:secret
+`), 0o600)
+	assert.NoError(t, err)
+	t.Setenv("KAFKA_CONFIG_FILE", path)
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"ssl.ca.location":    "/etc/ssl/certs/ca.pem",
+		"session.timeout.ms": "45000",
+		"fetch.min.bytes":    "1024",
+	}, config.KafkaConfig.Properties)
+	assert.Equal(t, []string{"schema.registry.basic.auth.user.info"}, config.IgnoredProperties)
+}
+
+func TestLoadConfig_YAMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kafka.yaml")
+	err := os.WriteFile(path, []byte(`bootstrap.servers: broker:9092
+group.id: yaml-group
+topics:
+  - qlik.customers
+  - qlik.orders
+`), 0o600)
+	assert.NoError(t, err)
+	t.Setenv("KAFKA_CONFIG_FILE", path)
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "broker:9092", config.KafkaConfig.BootstrapServers)
+	assert.Equal(t, "yaml-group", config.KafkaConfig.GroupID)
+	assert.Equal(t, []string{"qlik.customers", "qlik.orders"}, config.KafkaConfig.Topics)
+	// Properties missing from the file keep their defaults
+	assert.Equal(t, "PLAINTEXT", config.KafkaConfig.SecurityProtocol)
+}
+
+func TestLoadConfig_EnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kafka.properties")
+	err := os.WriteFile(path, []byte("bootstrap.servers=file:9092\ngroup.id=file-group\ntopics=from.file\n"), 0o600)
+	assert.NoError(t, err)
+	t.Setenv("KAFKA_CONFIG_FILE", path)
+	t.Setenv("KAFKA_BOOTSTRAP_SERVERS", "env:9092")
+	t.Setenv("KAFKA_TOPICS", `["from.env"]`)
+
+	config, err := loadConfig()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "env:9092", config.KafkaConfig.BootstrapServers)
+	assert.Equal(t, []string{"from.env"}, config.KafkaConfig.Topics)
+	assert.Equal(t, "file-group", config.KafkaConfig.GroupID)
+}
+
+func TestLoadConfig_InvalidFile(t *testing.T) {
+	t.Setenv("KAFKA_CONFIG_FILE", filepath.Join(t.TempDir(), "missing.properties"))
+	_, err := loadConfig()
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "kafka.properties")
+	assert.NoError(t, os.WriteFile(path, []byte("bootstrap.servers\n"), 0o600))
+	t.Setenv("KAFKA_CONFIG_FILE", path)
+	_, err = loadConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 1")
+
+	path = filepath.Join(t.TempDir(), "kafka.yml")
+	assert.NoError(t, os.WriteFile(path, []byte("sasl:\n  username: svc\n"), 0o600))
+	t.Setenv("KAFKA_CONFIG_FILE", path)
+	_, err = loadConfig()
+	assert.Error(t, err)
+}
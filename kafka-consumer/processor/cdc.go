@@ -3,26 +3,58 @@ package processor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
-	"github.com/linkedin/goavro/v2"
 	"github.com/wgu/go-performance-enablement/pkg/events"
 	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"go.uber.org/zap"
 )
 
+const (
+	// DefaultMaxMessageSize is the largest message value parsed by default
+	DefaultMaxMessageSize = 1 << 20
+
+	// maxLoggedFieldSize bounds the encoded size of row images in logs
+	maxLoggedFieldSize = 1024
+)
+
+// Kafka message headers that carry CDC provenance. When present they override
+// the values in the message body.
+const (
+	HeaderSourceDatabase = "source_database"
+	HeaderSourceTable    = "source_table"
+	HeaderLSN            = "lsn"
+	HeaderSCN            = "scn"
+)
+
+// ErrMessageTooLarge is returned for messages over the size limit
+var ErrMessageTooLarge = errors.New("message exceeds maximum size")
+
 // CDCProcessor processes CDC events from Kafka
 type CDCProcessor struct {
-	logger *zap.Logger
-	codec  *goavro.Codec
+	logger         *zap.Logger
+	codecs         *CodecCache
+	serializer     Serializer
+	output         Producer
+	outputTopic    string
+	dlq            DeadLetterQueue
+	refresh        *RefreshCoordinator
+	ordering       *SourceOrderGuard
+	utf8Policy     events.UTF8Policy
+	maxMessageSize int
 }
 
 // NewCDCProcessor creates a new CDC processor
 func NewCDCProcessor(logger *zap.Logger) *CDCProcessor {
 	return &CDCProcessor{
-		logger: logger,
+		logger:         logger,
+		serializer:     JSONSerializer{},
+		utf8Policy:     events.UTF8Replace,
+		maxMessageSize: DefaultMaxMessageSize,
 	}
 }
 
@@ -30,12 +62,31 @@ func NewCDCProcessor(logger *zap.Logger) *CDCProcessor {
 func (p *CDCProcessor) Process(ctx context.Context, msg *kafka.Message) error {
 	start := time.Now()
 
+	// Reject oversized messages before parsing allocates for them
+	if p.maxMessageSize > 0 && len(msg.Value) > p.maxMessageSize {
+		return p.rejectOversized(ctx, msg)
+	}
+
 	// Parse CDC event from message
 	cdcEvent, err := p.parseCDCEvent(msg)
+	if errors.Is(err, events.ErrInvalidUTF8) {
+		return p.rejectInvalidUTF8(ctx, msg, err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to parse CDC event: %w", err)
 	}
 
+	// Skip changes older than the last one applied to the same row
+	if p.ordering != nil && cdcEvent.Operation != events.OperationRefresh && !p.ordering.Admit(cdcEvent) {
+		p.logger.Debug("skipping stale CDC event",
+			zap.String("operation", cdcEvent.Operation),
+			zap.String("table", cdcEvent.TableName),
+			zap.String("lsn", cdcEvent.Metadata.LSN),
+			zap.String("scn", cdcEvent.Metadata.SCN),
+		)
+		return nil
+	}
+
 	// Process based on operation type
 	switch cdcEvent.Operation {
 	case events.OperationInsert:
@@ -46,6 +97,8 @@ func (p *CDCProcessor) Process(ctx context.Context, msg *kafka.Message) error {
 		err = p.handleDelete(ctx, cdcEvent)
 	case events.OperationRefresh:
 		err = p.handleRefresh(ctx, cdcEvent)
+	case events.OperationRefreshEnd:
+		err = p.handleRefreshEnd(ctx, msg, cdcEvent)
 	default:
 		err = fmt.Errorf("unknown operation: %s", cdcEvent.Operation)
 	}
@@ -54,9 +107,16 @@ func (p *CDCProcessor) Process(ctx context.Context, msg *kafka.Message) error {
 		return fmt.Errorf("failed to process CDC event: %w", err)
 	}
 
+	if p.output != nil && publishedOperations[cdcEvent.Operation] {
+		if err := p.publish(ctx, msg, cdcEvent); err != nil {
+			return fmt.Errorf("failed to publish CDC event: %w", err)
+		}
+	}
+
 	// Record metrics
 	duration := time.Since(start)
 	metrics.RecordCDCEvent(cdcEvent.Operation, cdcEvent.TableName, "qlik", duration)
+	metrics.RecordEventLatency("kafka-consumer", cdcEvent.Operation, cdcEvent.CapturedAt())
 
 	p.logger.Debug("processed CDC event",
 		zap.String("operation", cdcEvent.Operation),
@@ -67,20 +127,49 @@ func (p *CDCProcessor) Process(ctx context.Context, msg *kafka.Message) error {
 	return nil
 }
 
-// parseCDCEvent parses a CDC event from a Kafka message
+// parseCDCEvent parses a CDC event from a Kafka message, taking provenance
+// metadata from the message headers when present
 func (p *CDCProcessor) parseCDCEvent(msg *kafka.Message) (*events.CDCEvent, error) {
+	cdcEvent, err := p.parseCDCBody(msg)
+	if err != nil {
+		return nil, err
+	}
+	applyHeaders(&cdcEvent.Metadata, msg.Headers)
+	return cdcEvent, nil
+}
+
+// parseCDCBody parses a CDC event from a Kafka message value. The UTF-8
+// policy is applied before decoding, since encoding/json would otherwise
+// replace invalid sequences unseen.
+func (p *CDCProcessor) parseCDCBody(msg *kafka.Message) (*events.CDCEvent, error) {
+	// A null value is a tombstone: a delete of the row identified by the key
+	if len(msg.Value) == 0 {
+		return parseTombstone(msg)
+	}
+
 	var cdcEvent events.CDCEvent
 
 	// Try JSON first (for local development)
-	if err := json.Unmarshal(msg.Value, &cdcEvent); err == nil {
-		return &cdcEvent, nil
+	if json.Valid(msg.Value) {
+		value, err := p.utf8Policy.ApplyToText("kafka-consumer", msg.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(value, &cdcEvent); err == nil {
+			return &cdcEvent, nil
+		}
 	}
 
 	// If JSON fails, try Avro deserialization
-	if p.codec != nil {
-		native, _, err := p.codec.NativeFromBinary(msg.Value)
+	if p.codecs != nil {
+		native, err := p.codecs.Decode(msg.Value)
 		if err != nil {
-			return nil, fmt.Errorf("failed to deserialize Avro: %w", err)
+			return nil, err
+		}
+		if record, ok := native.(map[string]interface{}); ok {
+			if err := p.utf8Policy.Apply("kafka-consumer", record); err != nil {
+				return nil, err
+			}
 		}
 
 		// Convert native to CDCEvent
@@ -99,11 +188,100 @@ func (p *CDCProcessor) parseCDCEvent(msg *kafka.Message) (*events.CDCEvent, erro
 	return nil, fmt.Errorf("failed to parse CDC event: unsupported format")
 }
 
+// applyHeaders overrides metadata with non-empty provenance headers
+func applyHeaders(metadata *events.CDCMetadata, headers []kafka.Header) {
+	for _, h := range headers {
+		if len(h.Value) == 0 {
+			continue
+		}
+		value := string(h.Value)
+		switch strings.ToLower(h.Key) {
+		case HeaderSourceDatabase:
+			metadata.SourceDatabase = value
+		case HeaderSourceTable:
+			metadata.SourceTable = value
+		case HeaderLSN:
+			metadata.LSN = value
+		case HeaderSCN:
+			metadata.SCN = value
+		}
+	}
+}
+
+// rejectOversized routes a message over the size limit to the dead-letter
+// queue. Without one configured the message is reported as an error.
+func (p *CDCProcessor) rejectOversized(ctx context.Context, msg *kafka.Message) error {
+	cause := fmt.Errorf("%w: %d bytes, limit %d", ErrMessageTooLarge, len(msg.Value), p.maxMessageSize)
+
+	p.logger.Warn("rejecting oversized message",
+		zap.Int("size", len(msg.Value)),
+		zap.Int("max_size", p.maxMessageSize),
+		zap.Int64("offset", int64(msg.TopicPartition.Offset)),
+	)
+
+	if p.dlq == nil {
+		return cause
+	}
+	if err := p.dlq.Send(ctx, msg, ErrorTypeMessageTooLarge, cause); err != nil {
+		return fmt.Errorf("failed to dead-letter oversized message: %w", err)
+	}
+	return nil
+}
+
+// rejectInvalidUTF8 routes a message the UTF-8 policy dead-letters to the
+// dead-letter queue. Without one configured the message is reported as an
+// error.
+func (p *CDCProcessor) rejectInvalidUTF8(ctx context.Context, msg *kafka.Message, cause error) error {
+	p.logger.Warn("rejecting message with invalid UTF-8",
+		zap.Int64("offset", int64(msg.TopicPartition.Offset)),
+	)
+
+	if p.dlq == nil {
+		return cause
+	}
+	if err := p.dlq.Send(ctx, msg, ErrorTypeInvalidUTF8, cause); err != nil {
+		return fmt.Errorf("failed to dead-letter message with invalid UTF-8: %w", err)
+	}
+	return nil
+}
+
+// parseTombstone builds a DELETE event from a tombstone message. A JSON object
+// key supplies the primary keys directly; any other key is kept under "key".
+func parseTombstone(msg *kafka.Message) (*events.CDCEvent, error) {
+	if len(msg.Key) == 0 {
+		return nil, fmt.Errorf("tombstone message has no key")
+	}
+
+	primaryKeys := make(map[string]interface{})
+	if err := json.Unmarshal(msg.Key, &primaryKeys); err != nil {
+		primaryKeys = map[string]interface{}{"key": string(msg.Key)}
+	}
+
+	var topic string
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
+	}
+	table := topic[strings.LastIndex(topic, ".")+1:]
+
+	return &events.CDCEvent{
+		Operation:   events.OperationDelete,
+		TableName:   table,
+		Timestamp:   msg.Timestamp,
+		PrimaryKeys: primaryKeys,
+		Metadata: events.CDCMetadata{
+			SourceTable: table,
+			Offset:      int64(msg.TopicPartition.Offset),
+			Partition:   msg.TopicPartition.Partition,
+			CaptureTime: msg.Timestamp,
+		},
+	}, nil
+}
+
 // handleInsert processes an INSERT operation
 func (p *CDCProcessor) handleInsert(ctx context.Context, event *events.CDCEvent) error {
 	p.logger.Info("handling INSERT",
 		zap.String("table", event.TableName),
-		zap.Any("after", event.After),
+		boundedField("after", event.After),
 	)
 
 	// Business logic for INSERT
@@ -119,8 +297,8 @@ func (p *CDCProcessor) handleInsert(ctx context.Context, event *events.CDCEvent)
 func (p *CDCProcessor) handleUpdate(ctx context.Context, event *events.CDCEvent) error {
 	p.logger.Info("handling UPDATE",
 		zap.String("table", event.TableName),
-		zap.Any("before", event.Before),
-		zap.Any("after", event.After),
+		boundedField("before", event.Before),
+		boundedField("after", event.After),
 	)
 
 	// Business logic for UPDATE
@@ -136,7 +314,7 @@ func (p *CDCProcessor) handleUpdate(ctx context.Context, event *events.CDCEvent)
 func (p *CDCProcessor) handleDelete(ctx context.Context, event *events.CDCEvent) error {
 	p.logger.Info("handling DELETE",
 		zap.String("table", event.TableName),
-		zap.Any("before", event.Before),
+		boundedField("before", event.Before),
 	)
 
 	// Business logic for DELETE
@@ -152,9 +330,14 @@ func (p *CDCProcessor) handleDelete(ctx context.Context, event *events.CDCEvent)
 func (p *CDCProcessor) handleRefresh(ctx context.Context, event *events.CDCEvent) error {
 	p.logger.Info("handling REFRESH",
 		zap.String("table", event.TableName),
-		zap.Any("after", event.After),
+		boundedField("after", event.After),
 	)
 
+	// Truncate-and-reload through the refresh coordinator when configured
+	if p.refresh != nil {
+		return p.refresh.Refresh(ctx, event)
+	}
+
 	// Business logic for REFRESH (full load)
 	// - Truncate and reload data
 	// - Clear all caches
@@ -163,7 +346,74 @@ func (p *CDCProcessor) handleRefresh(ctx context.Context, event *events.CDCEvent
 	return nil
 }
 
-// SetAvroCodec sets the Avro codec for deserialization
-func (p *CDCProcessor) SetAvroCodec(codec *goavro.Codec) {
-	p.codec = codec
+// handleRefreshEnd processes the end-of-load marker of one partition
+func (p *CDCProcessor) handleRefreshEnd(ctx context.Context, msg *kafka.Message, event *events.CDCEvent) error {
+	partitions, err := refreshPartitions(msg)
+	if err != nil {
+		return err
+	}
+
+	p.logger.Info("handling REFRESH_END",
+		zap.String("table", event.TableName),
+		zap.Int32("partition", msg.TopicPartition.Partition),
+		zap.Int("partitions", partitions),
+	)
+
+	if p.refresh != nil {
+		return p.refresh.EndOfSnapshot(ctx, event.TableName, msg.TopicPartition.Partition, partitions)
+	}
+	return nil
+}
+
+// boundedField logs a row image as JSON, truncated so a huge row can't flood
+// the logs
+func boundedField(key string, value map[string]interface{}) zap.Field {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return zap.String(key, fmt.Sprintf("<unencodable: %v>", err))
+	}
+	if len(encoded) > maxLoggedFieldSize {
+		return zap.String(key, string(encoded[:maxLoggedFieldSize])+"...(truncated)")
+	}
+	return zap.Any(key, value)
+}
+
+// SetCodecCache sets the cache that resolves Avro codecs by schema ID for
+// deserialization
+func (p *CDCProcessor) SetCodecCache(codecs *CodecCache) {
+	p.codecs = codecs
+}
+
+// SetSerializer sets the serializer used for events published to the output
+// topic
+func (p *CDCProcessor) SetSerializer(serializer Serializer) {
+	p.serializer = serializer
+}
+
+// SetDeadLetterQueue sets where rejected messages are sent
+func (p *CDCProcessor) SetDeadLetterQueue(dlq DeadLetterQueue) {
+	p.dlq = dlq
+}
+
+// SetRefreshCoordinator sets the coordinator that applies REFRESH events
+func (p *CDCProcessor) SetRefreshCoordinator(refresh *RefreshCoordinator) {
+	p.refresh = refresh
+}
+
+// SetSourceOrdering sets the guard that skips changes older than the last
+// one applied to the same row. REFRESH events are not checked.
+func (p *CDCProcessor) SetSourceOrdering(ordering *SourceOrderGuard) {
+	p.ordering = ordering
+}
+
+// SetUTF8Policy sets what happens to events with strings that aren't valid
+// UTF-8. The default replaces invalid sequences.
+func (p *CDCProcessor) SetUTF8Policy(policy events.UTF8Policy) {
+	p.utf8Policy = policy
+}
+
+// SetMaxMessageSize sets the largest message value, in bytes, that is parsed.
+// Zero disables the limit.
+func (p *CDCProcessor) SetMaxMessageSize(size int) {
+	p.maxMessageSize = size
 }
@@ -3,6 +3,8 @@ package processor
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/wgu/go-performance-enablement/pkg/events"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func TestNewCDCProcessor(t *testing.T) {
@@ -19,21 +22,19 @@ func TestNewCDCProcessor(t *testing.T) {
 	
 	assert.NotNil(t, processor)
 	assert.NotNil(t, processor.logger)
-	assert.Nil(t, processor.codec)
+	assert.Nil(t, processor.codecs)
 }
 
-func TestSetAvroCodec(t *testing.T) {
+func TestSetCodecCache(t *testing.T) {
 	logger, _ := zap.NewProduction()
 	processor := NewCDCProcessor(logger)
 	
-	// Codec is initially nil
-	assert.Nil(t, processor.codec)
+	// Codec cache is initially nil
+	assert.Nil(t, processor.codecs)
 	
-	// Setting codec should work (we can't create real codec without schema)
-	// Just test that SetAvroCodec doesn't panic
-	assert.NotPanics(t, func() {
-		processor.SetAvroCodec(nil)
-	})
+	cache := NewCodecCache(nil)
+	processor.SetCodecCache(cache)
+	assert.Same(t, cache, processor.codecs)
 }
 
 func TestParseCDCEvent_ValidJSON(t *testing.T) {
@@ -337,3 +338,311 @@ func TestParseCDCEvent_AllOperations(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCDCEvent_Tombstone(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	
+	topic := "qlik.customers"
+	timestamp := time.Now()
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: 2,
+			Offset:    kafka.Offset(1234),
+		},
+		Key:       []byte(`{"id": "cust-123"}`),
+		Value:     nil,
+		Timestamp: timestamp,
+	}
+	
+	parsed, err := processor.parseCDCEvent(msg)
+	
+	assert.NoError(t, err)
+	assert.NotNil(t, parsed)
+	assert.Equal(t, events.OperationDelete, parsed.Operation)
+	assert.Equal(t, "customers", parsed.TableName)
+	assert.Equal(t, map[string]interface{}{"id": "cust-123"}, parsed.PrimaryKeys)
+	assert.Nil(t, parsed.After)
+	assert.Equal(t, int64(1234), parsed.Metadata.Offset)
+	assert.Equal(t, int32(2), parsed.Metadata.Partition)
+	assert.Equal(t, timestamp, parsed.Timestamp)
+}
+
+func TestParseCDCEvent_TombstonePlainKey(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	
+	msg := &kafka.Message{
+		Key:   []byte("cust-456"),
+		Value: []byte{},
+	}
+	
+	parsed, err := processor.parseCDCEvent(msg)
+	
+	assert.NoError(t, err)
+	assert.Equal(t, events.OperationDelete, parsed.Operation)
+	assert.Equal(t, map[string]interface{}{"key": "cust-456"}, parsed.PrimaryKeys)
+}
+
+func TestParseCDCEvent_TombstoneWithoutKey(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	
+	parsed, err := processor.parseCDCEvent(&kafka.Message{})
+	
+	assert.Error(t, err)
+	assert.Nil(t, parsed)
+}
+
+func TestProcess_Tombstone(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	
+	topic := "qlik.orders"
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Key:            []byte(`{"order_id": "ord-1"}`),
+	}
+	
+	err := processor.Process(context.Background(), msg)
+	
+	assert.NoError(t, err)
+}
+
+// fakeDLQ records messages sent to the dead-letter queue
+type fakeDLQ struct {
+	messages   []*kafka.Message
+	errorTypes []string
+	err        error
+}
+
+func (f *fakeDLQ) Send(ctx context.Context, msg *kafka.Message, errorType string, cause error) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.messages = append(f.messages, msg)
+	f.errorTypes = append(f.errorTypes, errorType)
+	return nil
+}
+
+// paddedInsert returns a JSON INSERT message padded to exactly size bytes
+func paddedInsert(t *testing.T, size int) *kafka.Message {
+	event := &events.CDCEvent{
+		Operation: events.OperationInsert,
+		TableName: "customers",
+		After:     map[string]interface{}{"notes": ""},
+	}
+	base, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	event.After["notes"] = strings.Repeat("x", size-len(base))
+	value, err := json.Marshal(event)
+	assert.NoError(t, err)
+	assert.Len(t, value, size)
+
+	topic := "qlik.customers"
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7},
+		Value:          value,
+	}
+}
+
+func TestProcess_MaxMessageSize(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	processor.SetMaxMessageSize(4096)
+	dlq := &fakeDLQ{}
+	processor.SetDeadLetterQueue(dlq)
+
+	// Just under the limit processes normally
+	err := processor.Process(context.Background(), paddedInsert(t, 4095))
+	assert.NoError(t, err)
+	assert.Empty(t, dlq.messages)
+
+	// At the limit is still accepted
+	err = processor.Process(context.Background(), paddedInsert(t, 4096))
+	assert.NoError(t, err)
+	assert.Empty(t, dlq.messages)
+
+	// Just over the limit is dead-lettered without being parsed
+	oversized := paddedInsert(t, 4097)
+	err = processor.Process(context.Background(), oversized)
+	assert.NoError(t, err)
+	assert.Equal(t, []*kafka.Message{oversized}, dlq.messages)
+	assert.Equal(t, []string{ErrorTypeMessageTooLarge}, dlq.errorTypes)
+}
+
+func TestProcess_DefaultMaxMessageSizeDeadLetters(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	producer := &fakeProducer{}
+	processor.SetDeadLetterQueue(NewKafkaDeadLetterQueue(producer, "qlik.dlq"))
+
+	err := processor.Process(context.Background(), paddedInsert(t, DefaultMaxMessageSize+1))
+
+	assert.NoError(t, err)
+	if assert.Len(t, producer.produced, 1) {
+		assert.Equal(t, "true", headerValue(producer.produced[0], "dlq_value_truncated"))
+	}
+}
+
+func TestProcess_MaxMessageSizeWithoutDLQ(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	processor.SetMaxMessageSize(1024)
+
+	err := processor.Process(context.Background(), paddedInsert(t, 2048))
+
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+func TestProcess_MaxMessageSizeDLQFailure(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	processor.SetMaxMessageSize(1024)
+	processor.SetDeadLetterQueue(&fakeDLQ{err: errors.New("broker unavailable")})
+
+	err := processor.Process(context.Background(), paddedInsert(t, 2048))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to dead-letter oversized message")
+}
+
+// invalidUTF8Insert returns a JSON INSERT message whose name isn't valid UTF-8
+func invalidUTF8Insert() *kafka.Message {
+	topic := "qlik.customers"
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 9},
+		Value: []byte(`{"event_id":"evt-1","operation":"INSERT","table_name":"customers",` +
+			`"after":{"id":"cust-1","name":"caf` + "\xe9" + `"},"primary_keys":{"id":"cust-1"}}`),
+	}
+}
+
+func TestProcess_InvalidUTF8Replaced(t *testing.T) {
+	processor := NewCDCProcessor(zap.NewNop())
+	producer := &fakeProducer{}
+	processor.SetOutput(producer, "cdc.processed")
+
+	err := processor.Process(context.Background(), invalidUTF8Insert())
+	assert.NoError(t, err)
+
+	if assert.Len(t, producer.produced, 1) {
+		var published events.CDCEvent
+		assert.NoError(t, json.Unmarshal(producer.produced[0].Value, &published))
+		assert.Equal(t, "caf\uFFFD", published.After["name"])
+	}
+}
+
+func TestProcess_InvalidUTF8DeadLettered(t *testing.T) {
+	processor := NewCDCProcessor(zap.NewNop())
+	processor.SetUTF8Policy(events.UTF8DeadLetter)
+	producer := &fakeProducer{}
+	processor.SetOutput(producer, "cdc.processed")
+	dlq := &fakeDLQ{}
+	processor.SetDeadLetterQueue(dlq)
+
+	msg := invalidUTF8Insert()
+	err := processor.Process(context.Background(), msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*kafka.Message{msg}, dlq.messages)
+	assert.Equal(t, []string{ErrorTypeInvalidUTF8}, dlq.errorTypes)
+	assert.Empty(t, producer.produced)
+}
+
+func TestProcess_InvalidUTF8WithoutDLQ(t *testing.T) {
+	processor := NewCDCProcessor(zap.NewNop())
+	processor.SetUTF8Policy(events.UTF8DeadLetter)
+
+	err := processor.Process(context.Background(), invalidUTF8Insert())
+
+	assert.ErrorIs(t, err, events.ErrInvalidUTF8)
+}
+
+func TestBoundedField(t *testing.T) {
+	small := boundedField("after", map[string]interface{}{"id": "cust-123"})
+	assert.Equal(t, zapcore.ReflectType, small.Type)
+
+	large := boundedField("after", map[string]interface{}{"notes": strings.Repeat("x", 4*maxLoggedFieldSize)})
+	assert.Equal(t, zapcore.StringType, large.Type)
+	assert.True(t, strings.HasSuffix(large.String, "...(truncated)"))
+	assert.LessOrEqual(t, len(large.String), maxLoggedFieldSize+len("...(truncated)"))
+}
+
+func TestParseCDCEvent_Headers(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+
+	value, err := json.Marshal(&events.CDCEvent{
+		Operation: events.OperationUpdate,
+		TableName: "customers",
+		Metadata: events.CDCMetadata{
+			SourceDatabase: "body-db",
+			SourceTable:    "body_customers",
+			LSN:            "body-lsn",
+			SCN:            "body-scn",
+		},
+	})
+	assert.NoError(t, err)
+
+	msg := &kafka.Message{
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: HeaderSourceDatabase, Value: []byte("crm")},
+			{Key: "Source_Table", Value: []byte("dbo.customers")},
+			{Key: HeaderLSN, Value: []byte("00000027:00000b38:0003")},
+			{Key: HeaderSCN, Value: []byte("")},
+			{Key: "connector", Value: []byte("qlik-replicate")},
+		},
+	}
+
+	event, err := processor.parseCDCEvent(msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "crm", event.Metadata.SourceDatabase)
+	assert.Equal(t, "dbo.customers", event.Metadata.SourceTable)
+	assert.Equal(t, "00000027:00000b38:0003", event.Metadata.LSN)
+	// Empty headers fall back to the body
+	assert.Equal(t, "body-scn", event.Metadata.SCN)
+}
+
+func TestParseCDCEvent_NoHeaders(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+
+	value, err := json.Marshal(&events.CDCEvent{
+		Operation: events.OperationInsert,
+		TableName: "customers",
+		Metadata: events.CDCMetadata{
+			SourceDatabase: "body-db",
+			SourceTable:    "body_customers",
+			SCN:            "body-scn",
+		},
+	})
+	assert.NoError(t, err)
+
+	event, err := processor.parseCDCEvent(&kafka.Message{Value: value})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "body-db", event.Metadata.SourceDatabase)
+	assert.Equal(t, "body_customers", event.Metadata.SourceTable)
+	assert.Equal(t, "body-scn", event.Metadata.SCN)
+	assert.Empty(t, event.Metadata.LSN)
+}
+
+func TestParseCDCEvent_TombstoneHeaders(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	processor := NewCDCProcessor(logger)
+	topic := "qlik.customers"
+
+	event, err := processor.parseCDCEvent(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Key:            []byte(`{"id":"cust-1"}`),
+		Headers:        []kafka.Header{{Key: HeaderSourceDatabase, Value: []byte("crm")}},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "crm", event.Metadata.SourceDatabase)
+	assert.Equal(t, "customers", event.Metadata.SourceTable)
+}
@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry"
+	"github.com/linkedin/goavro/v2"
+	"golang.org/x/sync/singleflight"
+)
+
+// wireHeaderSize is the magic byte plus the 4-byte schema ID
+const wireHeaderSize = 5
+
+// errNotWireFormat is returned for payloads without a Confluent wire header
+var errNotWireFormat = errors.New("payload is not in Confluent wire format")
+
+// SchemaLookup resolves a schema by its registry ID. schemaregistry.Client
+// implements it.
+type SchemaLookup interface {
+	GetBySubjectAndID(subject string, id int) (schemaregistry.SchemaInfo, error)
+}
+
+// CodecCache resolves Avro codecs by schema ID and caches them. Concurrent
+// lookups of an uncached ID share a single registry request.
+type CodecCache struct {
+	registry SchemaLookup
+	mu       sync.RWMutex
+	codecs   map[int]*goavro.Codec
+	group    singleflight.Group
+}
+
+// NewCodecCache creates a codec cache backed by registry
+func NewCodecCache(registry SchemaLookup) *CodecCache {
+	return &CodecCache{
+		registry: registry,
+		codecs:   make(map[int]*goavro.Codec),
+	}
+}
+
+// Codec returns the codec for schema id, fetching it from the registry on
+// first use. Failed lookups are not cached, so a later message retries.
+func (c *CodecCache) Codec(id int) (*goavro.Codec, error) {
+	c.mu.RLock()
+	codec, ok := c.codecs[id]
+	c.mu.RUnlock()
+	if ok {
+		return codec, nil
+	}
+
+	v, err, _ := c.group.Do(strconv.Itoa(id), func() (interface{}, error) {
+		// Another caller may have filled the cache while we waited
+		c.mu.RLock()
+		codec, ok := c.codecs[id]
+		c.mu.RUnlock()
+		if ok {
+			return codec, nil
+		}
+
+		info, err := c.registry.GetBySubjectAndID("", id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch schema %d: %w", id, err)
+		}
+		codec, err = goavro.NewCodec(info.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Avro codec for schema %d: %w", id, err)
+		}
+
+		c.mu.Lock()
+		c.codecs[id] = codec
+		c.mu.Unlock()
+		return codec, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*goavro.Codec), nil
+}
+
+// Decode decodes a Confluent wire-format payload with the codec for its schema ID
+func (c *CodecCache) Decode(value []byte) (interface{}, error) {
+	if len(value) < wireHeaderSize || value[0] != confluentMagicByte {
+		return nil, errNotWireFormat
+	}
+
+	codec, err := c.Codec(int(binary.BigEndian.Uint32(value[1:wireHeaderSize])))
+	if err != nil {
+		return nil, err
+	}
+
+	native, _, err := codec.NativeFromBinary(value[wireHeaderSize:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize Avro: %w", err)
+	}
+	return native, nil
+}
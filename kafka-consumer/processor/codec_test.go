@@ -0,0 +1,124 @@
+package processor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+const (
+	testSchemaV1 = `{"type":"record","name":"Change","fields":[
+		{"name":"operation","type":"string"},
+		{"name":"table_name","type":"string"}]}`
+	testSchemaV2 = `{"type":"record","name":"Change","fields":[
+		{"name":"operation","type":"string"},
+		{"name":"table_name","type":"string"},
+		{"name":"schema","type":"string","default":"dbo"}]}`
+)
+
+// countingRegistry serves fixed schemas by ID and counts lookups
+type countingRegistry struct {
+	schemas map[int]string
+	lookups atomic.Int32
+}
+
+func (r *countingRegistry) GetBySubjectAndID(subject string, id int) (schemaregistry.SchemaInfo, error) {
+	r.lookups.Add(1)
+	// Widen the window for concurrent callers to pile up on a miss
+	time.Sleep(10 * time.Millisecond)
+	schema, ok := r.schemas[id]
+	if !ok {
+		return schemaregistry.SchemaInfo{}, fmt.Errorf("schema %d not found", id)
+	}
+	return schemaregistry.SchemaInfo{Schema: schema}, nil
+}
+
+// wireMessage encodes native with schema into a Confluent wire-format message
+func wireMessage(t *testing.T, id int, schema string, native map[string]interface{}) *kafka.Message {
+	codec, err := goavro.NewCodec(schema)
+	require.NoError(t, err)
+
+	buf := make([]byte, wireHeaderSize)
+	buf[0] = confluentMagicByte
+	binary.BigEndian.PutUint32(buf[1:], uint32(id))
+	value, err := codec.BinaryFromNative(buf, native)
+	require.NoError(t, err)
+	return &kafka.Message{Value: value}
+}
+
+func TestCodecCache_ConcurrentLookupsQueryRegistryOncePerSchema(t *testing.T) {
+	registry := &countingRegistry{schemas: map[int]string{1: testSchemaV1, 2: testSchemaV2}}
+	processor := NewCDCProcessor(zap.NewNop())
+	processor.SetCodecCache(NewCodecCache(registry))
+
+	messages := []*kafka.Message{
+		wireMessage(t, 1, testSchemaV1, map[string]interface{}{"operation": "INSERT", "table_name": "customers"}),
+		wireMessage(t, 2, testSchemaV2, map[string]interface{}{"operation": "UPDATE", "table_name": "orders", "schema": "sales"}),
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(msg *kafka.Message) {
+			defer wg.Done()
+			if _, err := processor.parseCDCEvent(msg); err != nil {
+				errs <- err
+			}
+		}(messages[i%len(messages)])
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected parse error: %v", err)
+	}
+	assert.Equal(t, int32(2), registry.lookups.Load())
+}
+
+func TestCodecCache_DecodesBySchemaID(t *testing.T) {
+	registry := &countingRegistry{schemas: map[int]string{1: testSchemaV1, 2: testSchemaV2}}
+	processor := NewCDCProcessor(zap.NewNop())
+	processor.SetCodecCache(NewCodecCache(registry))
+
+	event, err := processor.parseCDCEvent(wireMessage(t, 2, testSchemaV2,
+		map[string]interface{}{"operation": "UPDATE", "table_name": "orders", "schema": "sales"}))
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATE", event.Operation)
+	assert.Equal(t, "orders", event.TableName)
+	assert.Equal(t, "sales", event.Schema)
+}
+
+func TestCodecCache_FailedLookupIsRetried(t *testing.T) {
+	registry := &countingRegistry{schemas: map[int]string{}}
+	cache := NewCodecCache(registry)
+
+	_, err := cache.Codec(7)
+	assert.Error(t, err)
+
+	registry.schemas[7] = testSchemaV1
+	codec, err := cache.Codec(7)
+	require.NoError(t, err)
+	assert.NotNil(t, codec)
+	assert.Equal(t, int32(2), registry.lookups.Load())
+}
+
+func TestCodecCache_RejectsNonWireFormat(t *testing.T) {
+	cache := NewCodecCache(&countingRegistry{})
+
+	_, err := cache.Decode([]byte{0x01, 0x00, 0x00, 0x00, 0x01, 0x02})
+	assert.ErrorIs(t, err, errNotWireFormat)
+
+	_, err = cache.Decode([]byte{0x00, 0x01})
+	assert.ErrorIs(t, err, errNotWireFormat)
+}
@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+)
+
+// Error types recorded on dead-lettered messages
+const (
+	ErrorTypeMessageTooLarge = "MESSAGE_TOO_LARGE"
+	ErrorTypeInvalidUTF8     = "INVALID_UTF8"
+)
+
+// DefaultMaxDeadLetterValueSize is the most of a message value forwarded to the
+// dead-letter topic. Longer values are truncated so that messages rejected for
+// their size still fit under the producer's message.max.bytes, 1,000,000 by
+// default; the dlq_source_* headers locate the full message.
+const DefaultMaxDeadLetterValueSize = 64 << 10
+
+// DeadLetterQueue receives messages the processor rejects without parsing
+type DeadLetterQueue interface {
+	Send(ctx context.Context, msg *kafka.Message, errorType string, cause error) error
+}
+
+// Producer is the part of a Kafka producer the dead-letter queue uses
+type Producer interface {
+	Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error
+}
+
+// KafkaDeadLetterQueue forwards rejected messages to a dead-letter topic,
+// keeping the original key and up to a maximum size of the value, and
+// describing the failure in headers
+type KafkaDeadLetterQueue struct {
+	producer     Producer
+	topic        string
+	maxValueSize int
+}
+
+// NewKafkaDeadLetterQueue creates a dead-letter queue publishing to topic
+func NewKafkaDeadLetterQueue(producer Producer, topic string) *KafkaDeadLetterQueue {
+	return &KafkaDeadLetterQueue{
+		producer:     producer,
+		topic:        topic,
+		maxValueSize: DefaultMaxDeadLetterValueSize,
+	}
+}
+
+// SetMaxValueSize sets how many bytes of a message value are forwarded. Keep
+// it well under the producer's message.max.bytes and the dead-letter topic's
+// max.message.bytes.
+func (q *KafkaDeadLetterQueue) SetMaxValueSize(size int) {
+	q.maxValueSize = size
+}
+
+// Send publishes msg to the dead-letter topic and waits for delivery
+func (q *KafkaDeadLetterQueue) Send(ctx context.Context, msg *kafka.Message, errorType string, cause error) error {
+	var sourceTopic string
+	if msg.TopicPartition.Topic != nil {
+		sourceTopic = *msg.TopicPartition.Topic
+	}
+
+	dlqMsg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &q.topic, Partition: kafka.PartitionAny},
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Headers: append(append([]kafka.Header(nil), msg.Headers...),
+			kafka.Header{Key: "dlq_error_type", Value: []byte(errorType)},
+			kafka.Header{Key: "dlq_error_message", Value: []byte(cause.Error())},
+			kafka.Header{Key: "dlq_source_topic", Value: []byte(sourceTopic)},
+			kafka.Header{Key: "dlq_source_partition", Value: []byte(strconv.Itoa(int(msg.TopicPartition.Partition)))},
+			kafka.Header{Key: "dlq_source_offset", Value: []byte(strconv.FormatInt(int64(msg.TopicPartition.Offset), 10))},
+		),
+	}
+	if len(msg.Value) > q.maxValueSize {
+		dlqMsg.Value = msg.Value[:q.maxValueSize]
+		dlqMsg.Headers = append(dlqMsg.Headers,
+			kafka.Header{Key: "dlq_value_truncated", Value: []byte("true")},
+			kafka.Header{Key: "dlq_value_size", Value: []byte(strconv.Itoa(len(msg.Value)))},
+		)
+	}
+
+	delivery := make(chan kafka.Event, 1)
+	if err := q.producer.Produce(dlqMsg, delivery); err != nil {
+		return fmt.Errorf("failed to produce to dead-letter topic: %w", err)
+	}
+
+	select {
+	case e := <-delivery:
+		if m, ok := e.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+			return fmt.Errorf("failed to deliver to dead-letter topic: %w", m.TopicPartition.Error)
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	metrics.DLQMessages.WithLabelValues("kafka-consumer", errorType).Inc()
+	return nil
+}
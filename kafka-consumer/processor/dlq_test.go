@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// producerMaxMessageBytes is librdkafka's default message.max.bytes
+const producerMaxMessageBytes = 1000000
+
+// fakeProducer delivers every produced message with deliveryErr. Like
+// librdkafka, it rejects messages over message.max.bytes.
+type fakeProducer struct {
+	produced    []*kafka.Message
+	produceErr  error
+	deliveryErr error
+}
+
+func (f *fakeProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	if f.produceErr != nil {
+		return f.produceErr
+	}
+	size := len(msg.Key) + len(msg.Value)
+	for _, h := range msg.Headers {
+		size += len(h.Key) + len(h.Value)
+	}
+	if size > producerMaxMessageBytes {
+		return kafka.NewError(kafka.ErrMsgSizeTooLarge, "Broker: Message size too large", false)
+	}
+	f.produced = append(f.produced, msg)
+	delivered := *msg
+	delivered.TopicPartition.Error = f.deliveryErr
+	deliveryChan <- &delivered
+	return nil
+}
+
+func headerValue(msg *kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestKafkaDeadLetterQueue_Send(t *testing.T) {
+	producer := &fakeProducer{}
+	dlq := NewKafkaDeadLetterQueue(producer, "qlik.dlq")
+
+	topic := "qlik.customers"
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 3, Offset: 42},
+		Key:            []byte("cust-123"),
+		Value:          []byte(`{"operation":"INSERT"}`),
+		Headers:        []kafka.Header{{Key: "trace_id", Value: []byte("trace-1")}},
+	}
+
+	err := dlq.Send(context.Background(), msg, ErrorTypeMessageTooLarge, ErrMessageTooLarge)
+	require.NoError(t, err)
+	require.Len(t, producer.produced, 1)
+
+	sent := producer.produced[0]
+	assert.Equal(t, "qlik.dlq", *sent.TopicPartition.Topic)
+	assert.Equal(t, msg.Key, sent.Key)
+	assert.Equal(t, msg.Value, sent.Value)
+	assert.Equal(t, "trace-1", headerValue(sent, "trace_id"))
+	assert.Equal(t, ErrorTypeMessageTooLarge, headerValue(sent, "dlq_error_type"))
+	assert.Equal(t, ErrMessageTooLarge.Error(), headerValue(sent, "dlq_error_message"))
+	assert.Equal(t, "qlik.customers", headerValue(sent, "dlq_source_topic"))
+	assert.Equal(t, "3", headerValue(sent, "dlq_source_partition"))
+	assert.Equal(t, "42", headerValue(sent, "dlq_source_offset"))
+
+	// The source message's headers are left untouched
+	assert.Len(t, msg.Headers, 1)
+}
+
+func TestKafkaDeadLetterQueue_SendTruncatesOversizedValue(t *testing.T) {
+	producer := &fakeProducer{}
+	dlq := NewKafkaDeadLetterQueue(producer, "qlik.dlq")
+
+	// Rejected by the processor's default limit, and too large to produce whole
+	topic := "qlik.customers"
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 9},
+		Key:            []byte("cust-123"),
+		Value:          bytes.Repeat([]byte("x"), DefaultMaxMessageSize+1),
+	}
+
+	err := dlq.Send(context.Background(), msg, ErrorTypeMessageTooLarge, ErrMessageTooLarge)
+	require.NoError(t, err)
+	require.Len(t, producer.produced, 1)
+
+	sent := producer.produced[0]
+	assert.Len(t, sent.Value, DefaultMaxDeadLetterValueSize)
+	assert.Equal(t, msg.Value[:DefaultMaxDeadLetterValueSize], sent.Value)
+	assert.Equal(t, "true", headerValue(sent, "dlq_value_truncated"))
+	assert.Equal(t, strconv.Itoa(DefaultMaxMessageSize+1), headerValue(sent, "dlq_value_size"))
+	assert.Equal(t, "9", headerValue(sent, "dlq_source_offset"))
+
+	// Forwarded whole, the value is over message.max.bytes
+	producer.produced = nil
+	dlq.SetMaxValueSize(len(msg.Value))
+	err = dlq.Send(context.Background(), msg, ErrorTypeMessageTooLarge, ErrMessageTooLarge)
+	assert.ErrorContains(t, err, "failed to produce to dead-letter topic")
+}
+
+func TestKafkaDeadLetterQueue_SendErrors(t *testing.T) {
+	topic := "qlik.customers"
+	msg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}}
+
+	err := NewKafkaDeadLetterQueue(&fakeProducer{produceErr: errors.New("queue full")}, "qlik.dlq").
+		Send(context.Background(), msg, ErrorTypeMessageTooLarge, ErrMessageTooLarge)
+	assert.ErrorContains(t, err, "failed to produce to dead-letter topic")
+
+	err = NewKafkaDeadLetterQueue(&fakeProducer{deliveryErr: errors.New("broker down")}, "qlik.dlq").
+		Send(context.Background(), msg, ErrorTypeMessageTooLarge, ErrMessageTooLarge)
+	assert.ErrorContains(t, err, "failed to deliver to dead-letter topic")
+}
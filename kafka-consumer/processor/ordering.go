@@ -0,0 +1,190 @@
+package processor
+
+import (
+	"container/list"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+)
+
+// Orderings a change can be compared by, from most to least precise
+const (
+	OrderingLSN       = "lsn"
+	OrderingSCN       = "scn"
+	OrderingTimestamp = "timestamp"
+)
+
+// sourcePosition is where a change was read from the source log
+type sourcePosition struct {
+	lsn       string
+	scn       string
+	timestamp time.Time
+}
+
+func positionOf(event *events.CDCEvent) sourcePosition {
+	return sourcePosition{
+		lsn:       event.Metadata.LSN,
+		scn:       event.Metadata.SCN,
+		timestamp: event.Timestamp,
+	}
+}
+
+// CompareSourcePositions compares two changes to the same row by LSN, then
+// SCN, then timestamp, using the first that both carry. It returns -1 if a
+// precedes b, 1 if a follows b, and 0 if they are at the same position or
+// can't be ordered, along with the ordering used ("" when none applied).
+func CompareSourcePositions(a, b *events.CDCEvent) (int, string) {
+	return comparePositions(positionOf(a), positionOf(b))
+}
+
+func comparePositions(a, b sourcePosition) (int, string) {
+	switch {
+	case a.lsn != "" && b.lsn != "":
+		return compareLogPosition(a.lsn, b.lsn), OrderingLSN
+	case a.scn != "" && b.scn != "":
+		return compareLogPosition(a.scn, b.scn), OrderingSCN
+	case !a.timestamp.IsZero() && !b.timestamp.IsZero():
+		return a.timestamp.Compare(b.timestamp), OrderingTimestamp
+	}
+	return 0, ""
+}
+
+// compareLogPosition compares LSN or SCN strings. Positions are split into
+// components on ':', '/', '.' and '-', as in SQL Server ("0000002a:00000120:0003")
+// and PostgreSQL ("16/B374D848") LSNs, and components compare as unsigned hex
+// numbers of any length. Decimal SCNs order correctly read as hex.
+func compareLogPosition(a, b string) int {
+	aParts := strings.FieldsFunc(a, isPositionSeparator)
+	bParts := strings.FieldsFunc(b, isPositionSeparator)
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if c := compareHexComponent(aParts[i], bParts[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(aParts) < len(bParts):
+		return -1
+	case len(aParts) > len(bParts):
+		return 1
+	}
+	return 0
+}
+
+func isPositionSeparator(r rune) bool {
+	return r == ':' || r == '/' || r == '.' || r == '-'
+}
+
+// compareHexComponent compares two hex numbers without parsing them, so
+// components wider than 64 bits still compare correctly. Components that
+// aren't hex compare as strings.
+func compareHexComponent(a, b string) int {
+	if !isHex(a) || !isHex(b) {
+		return strings.Compare(a, b)
+	}
+	a = strings.TrimLeft(strings.ToLower(a), "0")
+	b = strings.TrimLeft(strings.ToLower(b), "0")
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// DefaultSourceOrderRows is how many rows a SourceOrderGuard remembers when
+// no limit is given
+const DefaultSourceOrderRows = 100000
+
+// SourceOrderGuard rejects changes older than the last change applied to the
+// same row, so a redelivered or reordered change can't overwrite a newer one.
+// Rows are identified by table and primary keys; changes without primary keys
+// are always applied. It is safe for concurrent use.
+//
+// The guard remembers a bounded number of rows, forgetting the least recently
+// changed first. A stale change to a forgotten row is applied.
+type SourceOrderGuard struct {
+	mu      sync.Mutex
+	maxRows int
+	last    map[string]*list.Element
+	// order holds *guardEntry values, most recently changed first
+	order *list.List
+}
+
+type guardEntry struct {
+	key      string
+	position sourcePosition
+}
+
+// NewSourceOrderGuard creates a guard with no rows applied that remembers up
+// to maxRows rows, or DefaultSourceOrderRows when maxRows isn't positive
+func NewSourceOrderGuard(maxRows int) *SourceOrderGuard {
+	if maxRows <= 0 {
+		maxRows = DefaultSourceOrderRows
+	}
+	return &SourceOrderGuard{
+		maxRows: maxRows,
+		last:    make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Admit reports whether event should be applied, recording its position when
+// it is. A change at the same position as the last one applied is admitted so
+// that retries of a failed apply go through. Skipped changes are counted by
+// table and the ordering that rejected them.
+func (g *SourceOrderGuard) Admit(event *events.CDCEvent) bool {
+	key, ok := rowKey(event)
+	if !ok {
+		return true
+	}
+	position := positionOf(event)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if elem, seen := g.last[key]; seen {
+		entry := elem.Value.(*guardEntry)
+		if c, ordering := comparePositions(position, entry.position); c < 0 {
+			metrics.CDCStaleChangesSkipped.WithLabelValues(event.TableName, ordering).Inc()
+			return false
+		}
+		entry.position = position
+		g.order.MoveToFront(elem)
+		return true
+	}
+
+	g.last[key] = g.order.PushFront(&guardEntry{key: key, position: position})
+	if g.order.Len() > g.maxRows {
+		oldest := g.order.Back()
+		g.order.Remove(oldest)
+		delete(g.last, oldest.Value.(*guardEntry).key)
+	}
+	return true
+}
+
+// rowKey identifies the row a change applies to. encoding/json sorts map
+// keys, so equal primary keys always encode the same way.
+func rowKey(event *events.CDCEvent) (string, bool) {
+	if len(event.PrimaryKeys) == 0 {
+		return "", false
+	}
+	keys, err := json.Marshal(event.PrimaryKeys)
+	if err != nil {
+		return "", false
+	}
+	return event.TableName + "\x00" + string(keys), true
+}
@@ -0,0 +1,176 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+func orderedChange(id, lsn string, timestamp time.Time) *events.CDCEvent {
+	return &events.CDCEvent{
+		Operation:   events.OperationUpdate,
+		TableName:   "orders",
+		Timestamp:   timestamp,
+		PrimaryKeys: map[string]interface{}{"id": id},
+		Metadata:    events.CDCMetadata{LSN: lsn},
+	}
+}
+
+func TestSourceOrderGuard_AppliesNewerLSN(t *testing.T) {
+	guard := NewSourceOrderGuard(0)
+	now := time.Now()
+
+	assert.True(t, guard.Admit(orderedChange("order-1", "0000002a:00000120:0003", now)))
+	assert.True(t, guard.Admit(orderedChange("order-1", "0000002a:00000121:0001", now)))
+	// Retrying the last change applied is allowed
+	assert.True(t, guard.Admit(orderedChange("order-1", "0000002a:00000121:0001", now)))
+}
+
+func TestSourceOrderGuard_SkipsStaleLSN(t *testing.T) {
+	metrics.CDCStaleChangesSkipped.Reset()
+	guard := NewSourceOrderGuard(0)
+	now := time.Now()
+
+	require.True(t, guard.Admit(orderedChange("order-1", "16/B374D848", now)))
+	// An older LSN is skipped even though its timestamp is later
+	assert.False(t, guard.Admit(orderedChange("order-1", "16/B374D847", now.Add(time.Second))))
+	// Other rows are tracked separately
+	assert.True(t, guard.Admit(orderedChange("order-2", "16/B374D847", now)))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.CDCStaleChangesSkipped.WithLabelValues("orders", OrderingLSN)))
+}
+
+func TestSourceOrderGuard_FallsBackToTimestamp(t *testing.T) {
+	metrics.CDCStaleChangesSkipped.Reset()
+	guard := NewSourceOrderGuard(0)
+	now := time.Now()
+
+	require.True(t, guard.Admit(orderedChange("order-1", "", now)))
+	assert.True(t, guard.Admit(orderedChange("order-1", "", now.Add(time.Second))))
+	assert.False(t, guard.Admit(orderedChange("order-1", "", now)))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.CDCStaleChangesSkipped.WithLabelValues("orders", OrderingTimestamp)))
+}
+
+func TestSourceOrderGuard_NoPrimaryKeys(t *testing.T) {
+	guard := NewSourceOrderGuard(0)
+	now := time.Now()
+
+	change := orderedChange("", "00000002", now)
+	change.PrimaryKeys = nil
+	require.True(t, guard.Admit(change))
+
+	change.Metadata.LSN = "00000001"
+	assert.True(t, guard.Admit(change))
+}
+
+func TestSourceOrderGuard_ForgetsLeastRecentlyChangedRows(t *testing.T) {
+	guard := NewSourceOrderGuard(2)
+	now := time.Now()
+
+	require.True(t, guard.Admit(orderedChange("order-1", "00000010", now)))
+	require.True(t, guard.Admit(orderedChange("order-2", "00000010", now)))
+	// Changing order-1 again makes order-2 the least recently changed
+	require.True(t, guard.Admit(orderedChange("order-1", "00000011", now)))
+	require.True(t, guard.Admit(orderedChange("order-3", "00000010", now)))
+
+	assert.Len(t, guard.last, 2)
+	assert.Equal(t, 2, guard.order.Len())
+	// order-2 was forgotten, so its stale change is applied
+	assert.True(t, guard.Admit(orderedChange("order-2", "00000001", now)))
+	// order-3 is still remembered
+	assert.False(t, guard.Admit(orderedChange("order-3", "00000001", now)))
+	// and order-1 was forgotten to make room for order-2
+	assert.True(t, guard.Admit(orderedChange("order-1", "00000001", now)))
+}
+
+func TestNewSourceOrderGuard_DefaultRows(t *testing.T) {
+	assert.Equal(t, DefaultSourceOrderRows, NewSourceOrderGuard(0).maxRows)
+	assert.Equal(t, DefaultSourceOrderRows, NewSourceOrderGuard(-1).maxRows)
+	assert.Equal(t, 10, NewSourceOrderGuard(10).maxRows)
+}
+
+func TestCompareSourcePositions(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name             string
+		a, b             *events.CDCEvent
+		expected         int
+		expectedOrdering string
+	}{
+		{
+			name:             "hex LSN components",
+			a:                orderedChange("1", "0000002a:0000000f:0001", now),
+			b:                orderedChange("1", "0000002a:00000010:0001", now),
+			expected:         -1,
+			expectedOrdering: OrderingLSN,
+		},
+		{
+			name:             "unpadded LSN components",
+			a:                orderedChange("1", "16/FFFFFFF", now),
+			b:                orderedChange("1", "16/B374D848", now),
+			expected:         -1,
+			expectedOrdering: OrderingLSN,
+		},
+		{
+			name:             "decimal SCN",
+			a:                &events.CDCEvent{Metadata: events.CDCMetadata{SCN: "1000"}},
+			b:                &events.CDCEvent{Metadata: events.CDCMetadata{SCN: "999"}},
+			expected:         1,
+			expectedOrdering: OrderingSCN,
+		},
+		{
+			name:             "one side without LSN uses timestamp",
+			a:                orderedChange("1", "00000001", now.Add(time.Second)),
+			b:                orderedChange("1", "", now),
+			expected:         1,
+			expectedOrdering: OrderingTimestamp,
+		},
+		{
+			name:             "nothing to compare",
+			a:                &events.CDCEvent{},
+			b:                &events.CDCEvent{},
+			expected:         0,
+			expectedOrdering: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ordering := CompareSourcePositions(tt.a, tt.b)
+			assert.Equal(t, tt.expected, result)
+			assert.Equal(t, tt.expectedOrdering, ordering)
+		})
+	}
+}
+
+func TestProcess_SkipsStaleChange(t *testing.T) {
+	metrics.CDCStaleChangesSkipped.Reset()
+	processor := NewCDCProcessor(zap.NewNop())
+	processor.SetSourceOrdering(NewSourceOrderGuard(0))
+	ctx := context.Background()
+
+	message := func(lsn string) *kafka.Message {
+		value, err := json.Marshal(orderedChange("order-1", "", time.Now()))
+		require.NoError(t, err)
+		return &kafka.Message{
+			Value:   value,
+			Headers: []kafka.Header{{Key: HeaderLSN, Value: []byte(lsn)}},
+		}
+	}
+
+	require.NoError(t, processor.Process(ctx, message("00000002")))
+	require.NoError(t, processor.Process(ctx, message("00000001")))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.CDCStaleChangesSkipped.WithLabelValues("orders", OrderingLSN)))
+}
@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+)
+
+// publishedOperations are the operations whose events are published onward.
+// REFRESH_END markers only coordinate the load and are not.
+var publishedOperations = map[string]bool{
+	events.OperationInsert:  true,
+	events.OperationUpdate:  true,
+	events.OperationDelete:  true,
+	events.OperationRefresh: true,
+}
+
+// SetOutput publishes processed events to topic through producer, encoded by
+// the serializer
+func (p *CDCProcessor) SetOutput(producer Producer, topic string) {
+	p.output = producer
+	p.outputTopic = topic
+}
+
+// publish produces a processed event to the output topic, keyed like the
+// message it came from, and waits for delivery
+func (p *CDCProcessor) publish(ctx context.Context, msg *kafka.Message, event *events.CDCEvent) error {
+	value, err := p.serializer.Serialize(p.outputTopic, event)
+	if err != nil {
+		return fmt.Errorf("failed to serialize CDC event: %w", err)
+	}
+
+	out := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &p.outputTopic, Partition: kafka.PartitionAny},
+		Key:            msg.Key,
+		Value:          value,
+	}
+
+	delivery := make(chan kafka.Event, 1)
+	if err := p.output.Produce(out, delivery); err != nil {
+		return fmt.Errorf("failed to produce to output topic: %w", err)
+	}
+
+	select {
+	case e := <-delivery:
+		if m, ok := e.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+			return fmt.Errorf("failed to deliver to output topic: %w", m.TopicPartition.Error)
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
+)
+
+const testOutputTopic = "cdc.processed"
+
+// eventMessage builds the Kafka message a Qlik task would write for event
+func eventMessage(t *testing.T, event *events.CDCEvent) *kafka.Message {
+	value, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	topic := "qlik." + event.TableName
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: event.Metadata.Partition},
+		Key:            []byte(`{"id":"cust-123"}`),
+		Value:          value,
+	}
+}
+
+func TestCDCProcessor_PublishesJSON(t *testing.T) {
+	producer := &fakeProducer{}
+	processor := NewCDCProcessor(zap.NewNop())
+	processor.SetOutput(producer, testOutputTopic)
+
+	event := testCDCEvent()
+	msg := eventMessage(t, event)
+	require.NoError(t, processor.Process(context.Background(), msg))
+
+	require.Len(t, producer.produced, 1)
+	out := producer.produced[0]
+	assert.Equal(t, testOutputTopic, *out.TopicPartition.Topic)
+	assert.Equal(t, msg.Key, out.Key)
+
+	var published events.CDCEvent
+	require.NoError(t, json.Unmarshal(out.Value, &published))
+	assert.Equal(t, event.EventID, published.EventID)
+	assert.Equal(t, event.Operation, published.Operation)
+	assert.Equal(t, event.TableName, published.TableName)
+	assert.Equal(t, event.After, published.After)
+	assert.Equal(t, event.PrimaryKeys, published.PrimaryKeys)
+	assert.Equal(t, event.Metadata.Offset, published.Metadata.Offset)
+}
+
+func TestCDCProcessor_PublishesAvro(t *testing.T) {
+	registry := newMockRegistry(t)
+	serializer, err := NewAvroSerializer(registry)
+	require.NoError(t, err)
+
+	producer := &fakeProducer{}
+	processor := NewCDCProcessor(zap.NewNop())
+	processor.SetSerializer(serializer)
+	processor.SetOutput(producer, testOutputTopic)
+
+	event := testCDCEvent()
+	require.NoError(t, processor.Process(context.Background(), eventMessage(t, event)))
+
+	require.Len(t, producer.produced, 1)
+	data := producer.produced[0].Value
+
+	// Confluent wire format, with the schema registered for the output topic
+	require.Greater(t, len(data), 5)
+	assert.Equal(t, byte(0), data[0])
+	info, err := registry.GetBySubjectAndID(testOutputTopic+"-value", int(binary.BigEndian.Uint32(data[1:5])))
+	require.NoError(t, err)
+
+	codec, err := goavro.NewCodec(info.Schema)
+	require.NoError(t, err)
+	native, remaining, err := codec.NativeFromBinary(data[5:])
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+
+	record := native.(map[string]interface{})
+	assert.Equal(t, event.EventID, record["event_id"])
+	assert.Equal(t, event.Operation, record["operation"])
+	assert.Equal(t, event.TableName, record["table_name"])
+	assert.Equal(t, int64(1001), record["offset"])
+}
+
+func TestCDCProcessor_DoesNotPublishRefreshEnd(t *testing.T) {
+	producer := &fakeProducer{}
+	processor := refreshProcessor(newMemoryTarget(), newMemoryStore())
+	processor.SetOutput(producer, testOutputTopic)
+	ctx := context.Background()
+
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-1", 0)))
+	require.NoError(t, processor.Process(ctx, refreshEnd(t, "customers", 0, 1)))
+
+	require.Len(t, producer.produced, 1)
+	var published events.CDCEvent
+	require.NoError(t, json.Unmarshal(producer.produced[0].Value, &published))
+	assert.Equal(t, events.OperationRefresh, published.Operation)
+}
+
+func TestCDCProcessor_PublishFailures(t *testing.T) {
+	ctx := context.Background()
+	event := testCDCEvent()
+
+	// Without an output nothing is published
+	processor := NewCDCProcessor(zap.NewNop())
+	require.NoError(t, processor.Process(ctx, eventMessage(t, event)))
+
+	processor.SetOutput(&fakeProducer{produceErr: errors.New("queue full")}, testOutputTopic)
+	err := processor.Process(ctx, eventMessage(t, event))
+	assert.ErrorContains(t, err, "failed to produce to output topic")
+
+	deliveryErr := kafka.NewError(kafka.ErrMsgTimedOut, "Local: Message timed out", false)
+	processor.SetOutput(&fakeProducer{deliveryErr: deliveryErr}, testOutputTopic)
+	err = processor.Process(ctx, eventMessage(t, event))
+	assert.ErrorIs(t, err, deliveryErr)
+}
@@ -0,0 +1,178 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
+)
+
+// HeaderRefreshPartitions carries, on a REFRESH_END marker, the number of
+// partitions the full load was written to
+const HeaderRefreshPartitions = "refresh_partitions"
+
+// RefreshTarget is a store that can be reloaded by a full-load REFRESH. Rows
+// are tagged with the refresh generation that last wrote them so rows missing
+// from a new load can be found and removed.
+type RefreshTarget interface {
+	// Upsert writes a row tagged with generation
+	Upsert(ctx context.Context, table string, primaryKeys, row map[string]interface{}, generation int64) error
+	// DeleteStale deletes rows of table tagged with a generation older than
+	// generation and returns how many were deleted
+	DeleteStale(ctx context.Context, table string, generation int64) (int, error)
+}
+
+// RefreshStore tracks the refresh in progress for each table. It is shared by
+// every consumer instance, so all partitions of a load use one generation and
+// a restart picks up the refresh it left.
+type RefreshStore interface {
+	// Begin returns the generation of the refresh in progress for table,
+	// starting one at generation if none is
+	Begin(ctx context.Context, table string, generation int64) (int64, error)
+	// Active returns the generation of the refresh in progress for table
+	Active(ctx context.Context, table string) (int64, bool, error)
+	// MarkLoaded records that partition finished loading generation of
+	// table and reports whether all partitions have
+	MarkLoaded(ctx context.Context, table string, generation int64, partition int32, partitions int) (bool, error)
+	// Finish ends the refresh of table if it is still at generation
+	Finish(ctx context.Context, table string, generation int64) error
+}
+
+// RefreshCoordinator gives Qlik full-load REFRESH events truncate-and-reload
+// semantics. The first REFRESH row for a table starts a new generation in the
+// store; every REFRESH row is upserted with it. Once every partition of the
+// load has delivered its REFRESH_END marker, rows from prior generations
+// (those absent from the new load) are deleted.
+type RefreshCoordinator struct {
+	target RefreshTarget
+	store  RefreshStore
+	logger *zap.Logger
+	now    func() time.Time
+
+	// active caches the store's generation per table until this instance
+	// sees one of the table's markers
+	mu     sync.Mutex
+	active map[string]int64
+}
+
+// NewRefreshCoordinator creates a coordinator reloading target, with
+// refreshes tracked in store
+func NewRefreshCoordinator(target RefreshTarget, store RefreshStore, logger *zap.Logger) *RefreshCoordinator {
+	return &RefreshCoordinator{
+		target: target,
+		store:  store,
+		logger: logger,
+		now:    time.Now,
+		active: make(map[string]int64),
+	}
+}
+
+// Refresh upserts a REFRESH row, starting a new generation for its table if
+// no refresh is in progress
+func (c *RefreshCoordinator) Refresh(ctx context.Context, event *events.CDCEvent) error {
+	generation, err := c.begin(ctx, event.TableName)
+	if err != nil {
+		return err
+	}
+
+	if err := c.target.Upsert(ctx, event.TableName, event.PrimaryKeys, event.After, generation); err != nil {
+		return fmt.Errorf("failed to upsert refresh row: %w", err)
+	}
+	return nil
+}
+
+// EndOfSnapshot records that partition finished the load of table, out of
+// partitions in total. The partition that completes the load deletes the rows
+// it didn't contain and finishes the refresh. A marker with no refresh in
+// progress, such as a redelivered one, does nothing.
+func (c *RefreshCoordinator) EndOfSnapshot(ctx context.Context, table string, partition int32, partitions int) error {
+	// Later REFRESH rows on this partition belong to the next load
+	c.mu.Lock()
+	delete(c.active, table)
+	c.mu.Unlock()
+
+	generation, ok, err := c.store.Active(ctx, table)
+	if err != nil {
+		return fmt.Errorf("failed to read refresh of %s: %w", table, err)
+	}
+	if !ok {
+		return nil
+	}
+
+	loaded, err := c.store.MarkLoaded(ctx, table, generation, partition, partitions)
+	if err != nil {
+		return fmt.Errorf("failed to mark partition %d loaded for refresh of %s: %w", partition, table, err)
+	}
+	c.logger.Info("partition finished table refresh",
+		zap.String("table", table),
+		zap.Int64("generation", generation),
+		zap.Int32("partition", partition),
+		zap.Int("partitions", partitions),
+	)
+	if !loaded {
+		return nil
+	}
+
+	// Deleting is idempotent, so a redelivered last marker can repeat it
+	deleted, err := c.target.DeleteStale(ctx, table, generation)
+	if err != nil {
+		return fmt.Errorf("failed to delete rows from previous refresh of %s: %w", table, err)
+	}
+	if err := c.store.Finish(ctx, table, generation); err != nil {
+		return fmt.Errorf("failed to finish refresh of %s: %w", table, err)
+	}
+
+	c.logger.Info("completed table refresh",
+		zap.String("table", table),
+		zap.Int64("generation", generation),
+		zap.Int("stale_rows_deleted", deleted),
+	)
+	return nil
+}
+
+// begin returns the generation of the refresh in progress for table, starting
+// one if needed. Generations are clock-based so they keep increasing across
+// restarts.
+func (c *RefreshCoordinator) begin(ctx context.Context, table string) (int64, error) {
+	c.mu.Lock()
+	generation, ok := c.active[table]
+	c.mu.Unlock()
+	if ok {
+		return generation, nil
+	}
+
+	generation, err := c.store.Begin(ctx, table, c.now().UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin refresh of %s: %w", table, err)
+	}
+
+	c.mu.Lock()
+	c.active[table] = generation
+	c.mu.Unlock()
+
+	c.logger.Info("loading table refresh",
+		zap.String("table", table),
+		zap.Int64("generation", generation),
+	)
+	return generation, nil
+}
+
+// refreshPartitions reads the partition count from a REFRESH_END marker
+func refreshPartitions(msg *kafka.Message) (int, error) {
+	for _, h := range msg.Headers {
+		if h.Key != HeaderRefreshPartitions {
+			continue
+		}
+		partitions, err := strconv.Atoi(string(h.Value))
+		if err != nil || partitions < 1 {
+			return 0, fmt.Errorf("invalid %s header %q", HeaderRefreshPartitions, h.Value)
+		}
+		return partitions, nil
+	}
+	return 0, fmt.Errorf("%s marker has no %s header", events.OperationRefreshEnd, HeaderRefreshPartitions)
+}
@@ -0,0 +1,247 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+)
+
+// DynamoDBRefreshTarget keeps refreshed rows in a DynamoDB table with the
+// source table name as partition key "table_name" and the row's primary keys,
+// as JSON, as sort key "row_key". The row is stored under "row".
+type DynamoDBRefreshTarget struct {
+	client    awsutils.DynamoDBAPI
+	tableName string
+}
+
+// NewDynamoDBRefreshTarget creates a target writing to tableName
+func NewDynamoDBRefreshTarget(client awsutils.DynamoDBAPI, tableName string) *DynamoDBRefreshTarget {
+	return &DynamoDBRefreshTarget{client: client, tableName: tableName}
+}
+
+// Upsert writes a row tagged with generation, unless a later generation
+// already wrote it
+func (t *DynamoDBRefreshTarget) Upsert(ctx context.Context, table string, primaryKeys, row map[string]interface{}, generation int64) error {
+	// encoding/json sorts map keys, so equal primary keys encode the same way
+	rowKey, err := json.Marshal(primaryKeys)
+	if err != nil {
+		return fmt.Errorf("failed to marshal primary keys: %w", err)
+	}
+	rowValue, err := attributevalue.MarshalMap(row)
+	if err != nil {
+		return fmt.Errorf("failed to marshal row: %w", err)
+	}
+
+	_, err = t.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(t.tableName),
+		Item: map[string]types.AttributeValue{
+			"table_name":         &types.AttributeValueMemberS{Value: table},
+			"row_key":            &types.AttributeValueMemberS{Value: string(rowKey)},
+			"row":                &types.AttributeValueMemberM{Value: rowValue},
+			"refresh_generation": generationValue(generation),
+		},
+		ConditionExpression:      aws.String("attribute_not_exists(#generation) OR #generation <= :generation"),
+		ExpressionAttributeNames: map[string]string{"#generation": "refresh_generation"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":generation": generationValue(generation),
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put refresh row: %w", err)
+	}
+	return nil
+}
+
+// DeleteStale deletes rows of table tagged with a generation older than
+// generation. Each delete rechecks the generation, so a row reloaded
+// meanwhile is kept.
+func (t *DynamoDBRefreshTarget) DeleteStale(ctx context.Context, table string, generation int64) (int, error) {
+	deleted := 0
+	var startKey map[string]types.AttributeValue
+	for {
+		output, err := t.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                aws.String(t.tableName),
+			KeyConditionExpression:   aws.String("table_name = :table"),
+			FilterExpression:         aws.String("#generation < :generation"),
+			ProjectionExpression:     aws.String("table_name, row_key"),
+			ExpressionAttributeNames: map[string]string{"#generation": "refresh_generation"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":table":      &types.AttributeValueMemberS{Value: table},
+				":generation": generationValue(generation),
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("failed to query stale rows: %w", err)
+		}
+
+		for _, key := range output.Items {
+			_, err := t.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName:                aws.String(t.tableName),
+				Key:                      key,
+				ConditionExpression:      aws.String("#generation < :generation"),
+				ExpressionAttributeNames: map[string]string{"#generation": "refresh_generation"},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":generation": generationValue(generation),
+				},
+			})
+			var conditionFailed *types.ConditionalCheckFailedException
+			if errors.As(err, &conditionFailed) {
+				continue
+			}
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete stale row: %w", err)
+			}
+			deleted++
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return deleted, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
+
+// DynamoDBRefreshStore tracks refreshes in a DynamoDB table keyed by
+// "table_name", one item per table with a refresh in progress holding its
+// "generation", the partition count and the partitions already loaded
+type DynamoDBRefreshStore struct {
+	client    awsutils.DynamoDBAPI
+	tableName string
+}
+
+// NewDynamoDBRefreshStore creates a store in tableName
+func NewDynamoDBRefreshStore(client awsutils.DynamoDBAPI, tableName string) *DynamoDBRefreshStore {
+	return &DynamoDBRefreshStore{client: client, tableName: tableName}
+}
+
+// Begin returns the generation of the refresh in progress for table, starting
+// one at generation if none is
+func (s *DynamoDBRefreshStore) Begin(ctx context.Context, table string, generation int64) (int64, error) {
+	// Retry once in case the refresh we lost to finished before we read it
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(s.tableName),
+			Item: map[string]types.AttributeValue{
+				"table_name": &types.AttributeValueMemberS{Value: table},
+				"generation": generationValue(generation),
+			},
+			ConditionExpression: aws.String("attribute_not_exists(table_name)"),
+		})
+		var conditionFailed *types.ConditionalCheckFailedException
+		if !errors.As(err, &conditionFailed) {
+			if err != nil {
+				return 0, fmt.Errorf("failed to start refresh: %w", err)
+			}
+			return generation, nil
+		}
+
+		active, ok, err := s.Active(ctx, table)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return active, nil
+		}
+	}
+	return 0, fmt.Errorf("refresh of %s kept changing while starting", table)
+}
+
+// Active returns the generation of the refresh in progress for table
+func (s *DynamoDBRefreshStore) Active(ctx context.Context, table string) (int64, bool, error) {
+	output, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tableName),
+		Key:            s.key(table),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get refresh: %w", err)
+	}
+	if output.Item == nil {
+		return 0, false, nil
+	}
+
+	var state struct {
+		Generation int64 `dynamodbav:"generation"`
+	}
+	if err := attributevalue.UnmarshalMap(output.Item, &state); err != nil {
+		return 0, false, fmt.Errorf("failed to unmarshal refresh: %w", err)
+	}
+	return state.Generation, true, nil
+}
+
+// MarkLoaded adds partition to the partitions that finished loading
+// generation and reports whether all partitions have
+func (s *DynamoDBRefreshStore) MarkLoaded(ctx context.Context, table string, generation int64, partition int32, partitions int) (bool, error) {
+	output, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tableName),
+		Key:                 s.key(table),
+		UpdateExpression:    aws.String("ADD #loaded :partition SET #partitions = :partitions"),
+		ConditionExpression: aws.String("#generation = :generation"),
+		ExpressionAttributeNames: map[string]string{
+			"#loaded":     "loaded_partitions",
+			"#partitions": "partitions",
+			"#generation": "generation",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":partition":  &types.AttributeValueMemberNS{Value: []string{strconv.Itoa(int(partition))}},
+			":partitions": &types.AttributeValueMemberN{Value: strconv.Itoa(partitions)},
+			":generation": generationValue(generation),
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	// The refresh finished or was replaced meanwhile
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to mark partition loaded: %w", err)
+	}
+
+	loaded, _ := output.Attributes["loaded_partitions"].(*types.AttributeValueMemberNS)
+	return loaded != nil && len(loaded.Value) >= partitions, nil
+}
+
+// Finish ends the refresh of table if it is still at generation
+func (s *DynamoDBRefreshStore) Finish(ctx context.Context, table string, generation int64) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(s.tableName),
+		Key:                      s.key(table),
+		ConditionExpression:      aws.String("#generation = :generation"),
+		ExpressionAttributeNames: map[string]string{"#generation": "generation"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":generation": generationValue(generation),
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish refresh: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoDBRefreshStore) key(table string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"table_name": &types.AttributeValueMemberS{Value: table},
+	}
+}
+
+func generationValue(generation int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(generation, 10)}
+}
@@ -0,0 +1,198 @@
+package processor
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+)
+
+// mockRefreshTable records the calls the refresh target and store make and
+// answers them from canned outputs
+type mockRefreshTable struct {
+	awsutils.DynamoDBAPI
+	putErrs    []error
+	puts       []dynamodb.PutItemInput
+	item       map[string]types.AttributeValue
+	updated    map[string]types.AttributeValue
+	updateErr  error
+	updates    []dynamodb.UpdateItemInput
+	pages      [][]map[string]types.AttributeValue
+	deleteErrs map[string]error
+	deletes    []dynamodb.DeleteItemInput
+}
+
+func (m *mockRefreshTable) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.puts = append(m.puts, *params)
+	if len(m.putErrs) > 0 {
+		err := m.putErrs[0]
+		m.putErrs = m.putErrs[1:]
+		return nil, err
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockRefreshTable) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func (m *mockRefreshTable) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updates = append(m.updates, *params)
+	if m.updateErr != nil {
+		return nil, m.updateErr
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: m.updated}, nil
+}
+
+func (m *mockRefreshTable) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	page := 0
+	if start, ok := params.ExclusiveStartKey["page"].(*types.AttributeValueMemberN); ok {
+		page, _ = strconv.Atoi(start.Value)
+	}
+	output := &dynamodb.QueryOutput{Items: m.pages[page]}
+	if page+1 < len(m.pages) {
+		output.LastEvaluatedKey = map[string]types.AttributeValue{
+			"page": &types.AttributeValueMemberN{Value: strconv.Itoa(page + 1)},
+		}
+	}
+	return output, nil
+}
+
+func (m *mockRefreshTable) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.deletes = append(m.deletes, *params)
+	if rowKey, ok := params.Key["row_key"].(*types.AttributeValueMemberS); ok {
+		if err := m.deleteErrs[rowKey.Value]; err != nil {
+			return nil, err
+		}
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func refreshRowKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"table_name": &types.AttributeValueMemberS{Value: "customers"},
+		"row_key":    &types.AttributeValueMemberS{Value: id},
+	}
+}
+
+func TestDynamoDBRefreshTarget_UpsertTagsGeneration(t *testing.T) {
+	client := &mockRefreshTable{}
+	target := NewDynamoDBRefreshTarget(client, "cdc-refresh-rows")
+
+	err := target.Upsert(context.Background(), "customers",
+		map[string]interface{}{"id": "cust-1"}, map[string]interface{}{"id": "cust-1", "name": "Ada"}, 42)
+	require.NoError(t, err)
+
+	require.Len(t, client.puts, 1)
+	put := client.puts[0]
+	assert.Equal(t, "cdc-refresh-rows", aws.ToString(put.TableName))
+	assert.Equal(t, &types.AttributeValueMemberS{Value: `{"id":"cust-1"}`}, put.Item["row_key"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "42"}, put.Item["refresh_generation"])
+	assert.Contains(t, aws.ToString(put.ConditionExpression), "#generation <= :generation")
+}
+
+func TestDynamoDBRefreshTarget_UpsertKeepsNewerGeneration(t *testing.T) {
+	client := &mockRefreshTable{putErrs: []error{&types.ConditionalCheckFailedException{}}}
+	target := NewDynamoDBRefreshTarget(client, "cdc-refresh-rows")
+
+	err := target.Upsert(context.Background(), "customers", map[string]interface{}{"id": "cust-1"}, nil, 41)
+	assert.NoError(t, err)
+}
+
+func TestDynamoDBRefreshTarget_DeleteStaleAcrossPages(t *testing.T) {
+	client := &mockRefreshTable{
+		pages: [][]map[string]types.AttributeValue{
+			{refreshRowKey("cust-1"), refreshRowKey("cust-2")},
+			{refreshRowKey("cust-3")},
+		},
+		// cust-2 was reloaded after the query
+		deleteErrs: map[string]error{"cust-2": &types.ConditionalCheckFailedException{}},
+	}
+	target := NewDynamoDBRefreshTarget(client, "cdc-refresh-rows")
+
+	deleted, err := target.DeleteStale(context.Background(), "customers", 42)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, deleted)
+	require.Len(t, client.deletes, 3)
+	for _, input := range client.deletes {
+		assert.Equal(t, &types.AttributeValueMemberN{Value: "42"}, input.ExpressionAttributeValues[":generation"])
+	}
+}
+
+func TestDynamoDBRefreshStore_BeginStartsRefresh(t *testing.T) {
+	client := &mockRefreshTable{}
+	store := NewDynamoDBRefreshStore(client, "cdc-refresh-state")
+
+	generation, err := store.Begin(context.Background(), "customers", 42)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(42), generation)
+	require.Len(t, client.puts, 1)
+	assert.Equal(t, "attribute_not_exists(table_name)", aws.ToString(client.puts[0].ConditionExpression))
+}
+
+func TestDynamoDBRefreshStore_BeginJoinsActiveRefresh(t *testing.T) {
+	client := &mockRefreshTable{
+		putErrs: []error{&types.ConditionalCheckFailedException{}},
+		item: map[string]types.AttributeValue{
+			"table_name": &types.AttributeValueMemberS{Value: "customers"},
+			"generation": &types.AttributeValueMemberN{Value: "7"},
+		},
+	}
+	store := NewDynamoDBRefreshStore(client, "cdc-refresh-state")
+
+	generation, err := store.Begin(context.Background(), "customers", 42)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), generation)
+}
+
+func TestDynamoDBRefreshStore_ActiveWithoutRefresh(t *testing.T) {
+	store := NewDynamoDBRefreshStore(&mockRefreshTable{}, "cdc-refresh-state")
+
+	_, ok, err := store.Active(context.Background(), "customers")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestDynamoDBRefreshStore_MarkLoaded(t *testing.T) {
+	client := &mockRefreshTable{updated: map[string]types.AttributeValue{
+		"loaded_partitions": &types.AttributeValueMemberNS{Value: []string{"0"}},
+	}}
+	store := NewDynamoDBRefreshStore(client, "cdc-refresh-state")
+	ctx := context.Background()
+
+	loaded, err := store.MarkLoaded(ctx, "customers", 42, 0, 2)
+	require.NoError(t, err)
+	assert.False(t, loaded)
+	assert.Equal(t, &types.AttributeValueMemberNS{Value: []string{"0"}}, client.updates[0].ExpressionAttributeValues[":partition"])
+
+	client.updated["loaded_partitions"] = &types.AttributeValueMemberNS{Value: []string{"0", "1"}}
+	loaded, err = store.MarkLoaded(ctx, "customers", 42, 1, 2)
+	require.NoError(t, err)
+	assert.True(t, loaded)
+
+	// A marker for a refresh that was replaced loads nothing
+	client.updateErr = &types.ConditionalCheckFailedException{}
+	loaded, err = store.MarkLoaded(ctx, "customers", 41, 1, 2)
+	require.NoError(t, err)
+	assert.False(t, loaded)
+}
+
+func TestDynamoDBRefreshStore_FinishChecksGeneration(t *testing.T) {
+	client := &mockRefreshTable{}
+	store := NewDynamoDBRefreshStore(client, "cdc-refresh-state")
+
+	require.NoError(t, store.Finish(context.Background(), "customers", 42))
+
+	require.Len(t, client.deletes, 1)
+	assert.Equal(t, "#generation = :generation", aws.ToString(client.deletes[0].ConditionExpression))
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "42"}, client.deletes[0].ExpressionAttributeValues[":generation"])
+}
@@ -0,0 +1,298 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
+)
+
+// storedRow is a row in memoryTarget with the generation that wrote it
+type storedRow struct {
+	row        map[string]interface{}
+	generation int64
+}
+
+// memoryTarget is an in-memory RefreshTarget keyed by the "id" primary key
+type memoryTarget struct {
+	mu        sync.Mutex
+	tables    map[string]map[string]storedRow
+	deleteErr error
+}
+
+func newMemoryTarget() *memoryTarget {
+	return &memoryTarget{tables: make(map[string]map[string]storedRow)}
+}
+
+func (m *memoryTarget) Upsert(ctx context.Context, table string, primaryKeys, row map[string]interface{}, generation int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tables[table] == nil {
+		m.tables[table] = make(map[string]storedRow)
+	}
+	m.tables[table][fmt.Sprint(primaryKeys["id"])] = storedRow{row: row, generation: generation}
+	return nil
+}
+
+func (m *memoryTarget) DeleteStale(ctx context.Context, table string, generation int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deleteErr != nil {
+		return 0, m.deleteErr
+	}
+	deleted := 0
+	for id, stored := range m.tables[table] {
+		if stored.generation < generation {
+			delete(m.tables[table], id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *memoryTarget) ids(table string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []string
+	for id := range m.tables[table] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// memoryStore is an in-memory RefreshStore shared by coordinators standing in
+// for separate consumer instances
+type memoryStore struct {
+	mu     sync.Mutex
+	active map[string]int64
+	loaded map[string]map[int32]bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{active: make(map[string]int64), loaded: make(map[string]map[int32]bool)}
+}
+
+func (m *memoryStore) Begin(ctx context.Context, table string, generation int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if active, ok := m.active[table]; ok {
+		return active, nil
+	}
+	m.active[table] = generation
+	m.loaded[table] = make(map[int32]bool)
+	return generation, nil
+}
+
+func (m *memoryStore) Active(ctx context.Context, table string) (int64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	generation, ok := m.active[table]
+	return generation, ok, nil
+}
+
+func (m *memoryStore) MarkLoaded(ctx context.Context, table string, generation int64, partition int32, partitions int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if active, ok := m.active[table]; !ok || active != generation {
+		return false, nil
+	}
+	m.loaded[table][partition] = true
+	return len(m.loaded[table]) >= partitions, nil
+}
+
+func (m *memoryStore) Finish(ctx context.Context, table string, generation int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active[table] == generation {
+		delete(m.active, table)
+		delete(m.loaded, table)
+	}
+	return nil
+}
+
+func cdcMessage(t *testing.T, operation, table, id string, partition int32) *kafka.Message {
+	event := &events.CDCEvent{
+		Operation:   operation,
+		TableName:   table,
+		Timestamp:   time.Now(),
+		PrimaryKeys: map[string]interface{}{"id": id},
+		After:       map[string]interface{}{"id": id},
+	}
+	value, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	topic := "qlik." + table
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition},
+		Value:          value,
+	}
+}
+
+// refreshEnd builds the REFRESH_END marker for one of partitions
+func refreshEnd(t *testing.T, table string, partition int32, partitions int) *kafka.Message {
+	value, err := json.Marshal(&events.CDCEvent{Operation: events.OperationRefreshEnd, TableName: table})
+	require.NoError(t, err)
+
+	topic := "qlik." + table
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition},
+		Value:          value,
+		Headers:        []kafka.Header{{Key: HeaderRefreshPartitions, Value: []byte(strconv.Itoa(partitions))}},
+	}
+}
+
+func refreshProcessor(target RefreshTarget, store RefreshStore) *CDCProcessor {
+	processor := NewCDCProcessor(zap.NewNop())
+	processor.SetRefreshCoordinator(NewRefreshCoordinator(target, store, zap.NewNop()))
+	return processor
+}
+
+func TestRefresh_RemovesRowsMissingFromNewLoad(t *testing.T) {
+	target := newMemoryTarget()
+	store := newMemoryStore()
+	processor := refreshProcessor(target, store)
+	ctx := context.Background()
+
+	// First full load has three customers over two partitions
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-1", 0)))
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-2", 1)))
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-3", 1)))
+	require.NoError(t, processor.Process(ctx, refreshEnd(t, "customers", 0, 2)))
+	require.NoError(t, processor.Process(ctx, refreshEnd(t, "customers", 1, 2)))
+	assert.Equal(t, []string{"cust-1", "cust-2", "cust-3"}, target.ids("customers"))
+
+	// The reload no longer contains cust-2
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-1", 0)))
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-3", 1)))
+
+	// Change capture on a partition doesn't complete the refresh
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationUpdate, "customers", "cust-1", 0)))
+	require.NoError(t, processor.Process(ctx, refreshEnd(t, "customers", 0, 2)))
+	_, active, _ := store.Active(ctx, "customers")
+	assert.True(t, active)
+	assert.Equal(t, []string{"cust-1", "cust-2", "cust-3"}, target.ids("customers"), "stale rows stay until every partition is loaded")
+
+	require.NoError(t, processor.Process(ctx, refreshEnd(t, "customers", 1, 2)))
+
+	_, active, _ = store.Active(ctx, "customers")
+	assert.False(t, active)
+	assert.Equal(t, []string{"cust-1", "cust-3"}, target.ids("customers"))
+}
+
+func TestRefresh_SharedAcrossInstances(t *testing.T) {
+	target := newMemoryTarget()
+	store := newMemoryStore()
+	first, second := refreshProcessor(target, store), refreshProcessor(target, store)
+	ctx := context.Background()
+
+	target.Upsert(ctx, "customers", map[string]interface{}{"id": "cust-old"}, nil, 0)
+
+	// Each instance consumes one partition of the load
+	require.NoError(t, first.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-1", 0)))
+	require.NoError(t, second.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-2", 1)))
+	require.NoError(t, first.Process(ctx, refreshEnd(t, "customers", 0, 2)))
+
+	// The first instance finishing doesn't delete the second's rows
+	assert.Equal(t, []string{"cust-1", "cust-2", "cust-old"}, target.ids("customers"))
+
+	require.NoError(t, second.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-3", 1)))
+	require.NoError(t, second.Process(ctx, refreshEnd(t, "customers", 1, 2)))
+
+	assert.Equal(t, []string{"cust-1", "cust-2", "cust-3"}, target.ids("customers"))
+}
+
+func TestRefresh_ResumesAfterRestart(t *testing.T) {
+	target := newMemoryTarget()
+	store := newMemoryStore()
+	ctx := context.Background()
+
+	before := refreshProcessor(target, store)
+	require.NoError(t, before.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-1", 0)))
+
+	// The restarted instance joins the refresh in progress
+	after := refreshProcessor(target, store)
+	require.NoError(t, after.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-2", 0)))
+	require.NoError(t, after.Process(ctx, refreshEnd(t, "customers", 0, 1)))
+
+	assert.Equal(t, []string{"cust-1", "cust-2"}, target.ids("customers"))
+}
+
+func TestRefresh_TablesAreIndependent(t *testing.T) {
+	target := newMemoryTarget()
+	processor := refreshProcessor(target, newMemoryStore())
+	ctx := context.Background()
+
+	target.Upsert(ctx, "orders", map[string]interface{}{"id": "order-1"}, nil, 0)
+
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-1", 0)))
+	require.NoError(t, processor.Process(ctx, refreshEnd(t, "customers", 0, 1)))
+
+	// A marker for a table that isn't refreshing leaves it alone
+	require.NoError(t, processor.Process(ctx, refreshEnd(t, "orders", 0, 1)))
+
+	assert.Equal(t, []string{"cust-1"}, target.ids("customers"))
+	assert.Equal(t, []string{"order-1"}, target.ids("orders"))
+}
+
+func TestRefresh_NextLoadStartsNewGeneration(t *testing.T) {
+	store := newMemoryStore()
+	refresh := NewRefreshCoordinator(newMemoryTarget(), store, zap.NewNop())
+	clock := time.Unix(1700000000, 0)
+	refresh.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	first, err := refresh.begin(ctx, "customers")
+	require.NoError(t, err)
+	clock = clock.Add(time.Second)
+	again, err := refresh.begin(ctx, "customers")
+	require.NoError(t, err)
+	assert.Equal(t, first, again, "rows of one refresh share a generation")
+
+	require.NoError(t, refresh.EndOfSnapshot(ctx, "customers", 0, 1))
+	second, err := refresh.begin(ctx, "customers")
+	require.NoError(t, err)
+	assert.Greater(t, second, first)
+}
+
+func TestRefresh_DeleteFailureKeepsRefreshActive(t *testing.T) {
+	target := newMemoryTarget()
+	target.deleteErr = errors.New("throttled")
+	store := newMemoryStore()
+	processor := refreshProcessor(target, store)
+	ctx := context.Background()
+
+	target.Upsert(ctx, "customers", map[string]interface{}{"id": "cust-old"}, nil, 0)
+	require.NoError(t, processor.Process(ctx, cdcMessage(t, events.OperationRefresh, "customers", "cust-1", 0)))
+
+	assert.Error(t, processor.Process(ctx, refreshEnd(t, "customers", 0, 1)))
+	_, active, _ := store.Active(ctx, "customers")
+	assert.True(t, active)
+
+	// The redelivered marker completes the refresh
+	target.deleteErr = nil
+	require.NoError(t, processor.Process(ctx, refreshEnd(t, "customers", 0, 1)))
+	assert.Equal(t, []string{"cust-1"}, target.ids("customers"))
+}
+
+func TestRefresh_MarkerNeedsPartitionCount(t *testing.T) {
+	processor := refreshProcessor(newMemoryTarget(), newMemoryStore())
+
+	msg := refreshEnd(t, "customers", 0, 1)
+	msg.Headers = nil
+	assert.ErrorContains(t, processor.Process(context.Background(), msg), HeaderRefreshPartitions)
+
+	msg.Headers = []kafka.Header{{Key: HeaderRefreshPartitions, Value: []byte("0")}}
+	assert.ErrorContains(t, processor.Process(context.Background(), msg), "invalid refresh_partitions header")
+}
@@ -0,0 +1,196 @@
+package processor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry"
+	"github.com/linkedin/goavro/v2"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+)
+
+// Output formats for published CDC events
+const (
+	OutputFormatJSON = "json"
+	OutputFormatAvro = "avro"
+)
+
+// confluentMagicByte prefixes every Confluent wire-format payload
+const confluentMagicByte byte = 0
+
+// CDCEventAvroSchema is the Avro schema for published CDC events. Row images
+// are carried as JSON strings since their columns vary by table.
+const CDCEventAvroSchema = `{
+  "type": "record",
+  "name": "CDCEvent",
+  "namespace": "com.wgu.cdc",
+  "fields": [
+    {"name": "event_id", "type": "string", "default": ""},
+    {"name": "operation", "type": "string"},
+    {"name": "table_name", "type": "string"},
+    {"name": "schema", "type": "string", "default": ""},
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "transaction_id", "type": ["null", "string"], "default": null},
+    {"name": "before", "type": ["null", "string"], "default": null},
+    {"name": "after", "type": ["null", "string"], "default": null},
+    {"name": "primary_keys", "type": ["null", "string"], "default": null},
+    {"name": "source_database", "type": "string", "default": ""},
+    {"name": "source_table", "type": "string", "default": ""},
+    {"name": "offset", "type": "long", "default": 0},
+    {"name": "partition", "type": "int", "default": 0}
+  ]
+}`
+
+// Serializer encodes CDC events for publishing to a topic
+type Serializer interface {
+	Serialize(topic string, event *events.CDCEvent) ([]byte, error)
+}
+
+// NewSerializer returns the serializer for the given output format. The
+// schema registry client is only required for Avro.
+func NewSerializer(format string, registry schemaregistry.Client) (Serializer, error) {
+	switch format {
+	case "", OutputFormatJSON:
+		return JSONSerializer{}, nil
+	case OutputFormatAvro:
+		if registry == nil {
+			return nil, fmt.Errorf("schema registry client required for %s output", OutputFormatAvro)
+		}
+		return NewAvroSerializer(registry)
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// JSONSerializer encodes events as plain JSON
+type JSONSerializer struct{}
+
+// Serialize encodes the event as JSON
+func (JSONSerializer) Serialize(topic string, event *events.CDCEvent) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CDC event: %w", err)
+	}
+	return data, nil
+}
+
+// AvroSerializer encodes events as Avro in the Confluent wire format: a zero
+// magic byte, the 4-byte big-endian schema ID, then the Avro binary.
+type AvroSerializer struct {
+	registry schemaregistry.Client
+	codec    *goavro.Codec
+	mu       sync.Mutex
+	ids      map[string]int
+}
+
+// NewAvroSerializer creates an Avro serializer using CDCEventAvroSchema
+func NewAvroSerializer(registry schemaregistry.Client) (*AvroSerializer, error) {
+	codec, err := goavro.NewCodec(CDCEventAvroSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Avro codec: %w", err)
+	}
+
+	return &AvroSerializer{
+		registry: registry,
+		codec:    codec,
+		ids:      make(map[string]int),
+	}, nil
+}
+
+// Serialize encodes the event for topic, registering the schema under the
+// topic's value subject on first use
+func (s *AvroSerializer) Serialize(topic string, event *events.CDCEvent) ([]byte, error) {
+	id, err := s.schemaID(topic + "-value")
+	if err != nil {
+		return nil, err
+	}
+
+	native, err := cdcEventToAvroNative(event)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 5, 256)
+	buf[0] = confluentMagicByte
+	binary.BigEndian.PutUint32(buf[1:5], uint32(id))
+
+	data, err := s.codec.BinaryFromNative(buf, native)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Avro: %w", err)
+	}
+	return data, nil
+}
+
+// schemaID looks up the schema ID for subject, registering the schema if the
+// registry doesn't know it yet. IDs are cached per subject.
+func (s *AvroSerializer) schemaID(subject string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.ids[subject]; ok {
+		return id, nil
+	}
+
+	info := schemaregistry.SchemaInfo{Schema: s.codec.Schema()}
+	id, err := s.registry.GetID(subject, info, false)
+	if err != nil {
+		id, err = s.registry.Register(subject, info, false)
+		if err != nil {
+			return 0, fmt.Errorf("failed to register schema for subject %s: %w", subject, err)
+		}
+	}
+
+	s.ids[subject] = id
+	return id, nil
+}
+
+// cdcEventToAvroNative converts an event to the native form of CDCEventAvroSchema
+func cdcEventToAvroNative(event *events.CDCEvent) (map[string]interface{}, error) {
+	before, err := jsonUnion(event.Before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode before image: %w", err)
+	}
+	after, err := jsonUnion(event.After)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode after image: %w", err)
+	}
+	primaryKeys, err := jsonUnion(event.PrimaryKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode primary keys: %w", err)
+	}
+
+	var transactionID interface{}
+	if event.TransactionID != "" {
+		transactionID = goavro.Union("string", event.TransactionID)
+	}
+
+	return map[string]interface{}{
+		"event_id":        event.EventID,
+		"operation":       event.Operation,
+		"table_name":      event.TableName,
+		"schema":          event.Schema,
+		"timestamp":       event.Timestamp,
+		"transaction_id":  transactionID,
+		"before":          before,
+		"after":           after,
+		"primary_keys":    primaryKeys,
+		"source_database": event.Metadata.SourceDatabase,
+		"source_table":    event.Metadata.SourceTable,
+		"offset":          event.Metadata.Offset,
+		"partition":       event.Metadata.Partition,
+	}, nil
+}
+
+// jsonUnion encodes a row image as a nullable JSON string
+func jsonUnion(image map[string]interface{}) (interface{}, error) {
+	if image == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(image)
+	if err != nil {
+		return nil, err
+	}
+	return goavro.Union("string", string(data)), nil
+}
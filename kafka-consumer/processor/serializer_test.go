@@ -0,0 +1,155 @@
+package processor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/schemaregistry"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+)
+
+func newMockRegistry(t *testing.T) schemaregistry.Client {
+	client, err := schemaregistry.NewClient(schemaregistry.NewConfig("mock://"))
+	require.NoError(t, err)
+	return client
+}
+
+func testCDCEvent() *events.CDCEvent {
+	return &events.CDCEvent{
+		EventID:       "01J0000000000000000000000",
+		Operation:     events.OperationUpdate,
+		TableName:     "customers",
+		Schema:        "dbo",
+		Timestamp:     time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		TransactionID: "tx-42",
+		Before:        map[string]interface{}{"id": "cust-123", "name": "John"},
+		After:         map[string]interface{}{"id": "cust-123", "name": "Johnny"},
+		PrimaryKeys:   map[string]interface{}{"id": "cust-123"},
+		Metadata: events.CDCMetadata{
+			SourceDatabase: "qlik",
+			SourceTable:    "customers",
+			Offset:         1001,
+			Partition:      2,
+		},
+	}
+}
+
+func TestNewSerializer(t *testing.T) {
+	s, err := NewSerializer(OutputFormatJSON, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, JSONSerializer{}, s)
+
+	s, err = NewSerializer("", nil)
+	assert.NoError(t, err)
+	assert.IsType(t, JSONSerializer{}, s)
+
+	s, err = NewSerializer(OutputFormatAvro, newMockRegistry(t))
+	assert.NoError(t, err)
+	assert.IsType(t, &AvroSerializer{}, s)
+
+	_, err = NewSerializer(OutputFormatAvro, nil)
+	assert.Error(t, err)
+
+	_, err = NewSerializer("protobuf", nil)
+	assert.Error(t, err)
+}
+
+func TestJSONSerializer(t *testing.T) {
+	event := testCDCEvent()
+
+	data, err := JSONSerializer{}.Serialize("cdc.customers", event)
+	require.NoError(t, err)
+
+	var decoded events.CDCEvent
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, event.EventID, decoded.EventID)
+	assert.Equal(t, event.Operation, decoded.Operation)
+	assert.Equal(t, event.After, decoded.After)
+}
+
+func TestAvroSerializer_WireFormat(t *testing.T) {
+	registry := newMockRegistry(t)
+	serializer, err := NewAvroSerializer(registry)
+	require.NoError(t, err)
+
+	event := testCDCEvent()
+	data, err := serializer.Serialize("cdc.customers", event)
+	require.NoError(t, err)
+
+	// Confluent wire format: magic byte, 4-byte schema ID, Avro binary
+	require.Greater(t, len(data), 5)
+	assert.Equal(t, byte(0), data[0])
+	schemaID := int(binary.BigEndian.Uint32(data[1:5]))
+
+	info, err := registry.GetBySubjectAndID("cdc.customers-value", schemaID)
+	require.NoError(t, err)
+
+	codec, err := goavro.NewCodec(info.Schema)
+	require.NoError(t, err)
+	native, remaining, err := codec.NativeFromBinary(data[5:])
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+
+	record := native.(map[string]interface{})
+	assert.Equal(t, event.EventID, record["event_id"])
+	assert.Equal(t, event.Operation, record["operation"])
+	assert.Equal(t, event.TableName, record["table_name"])
+	assert.True(t, event.Timestamp.Equal(record["timestamp"].(time.Time)))
+	assert.Equal(t, map[string]interface{}{"string": "tx-42"}, record["transaction_id"])
+	assert.Equal(t, int64(1001), record["offset"])
+	assert.Equal(t, int32(2), record["partition"])
+
+	var after map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(record["after"].(map[string]interface{})["string"].(string)), &after))
+	assert.Equal(t, event.After, after)
+}
+
+func TestAvroSerializer_ReusesRegisteredSchema(t *testing.T) {
+	registry := newMockRegistry(t)
+	serializer, err := NewAvroSerializer(registry)
+	require.NoError(t, err)
+
+	first, err := serializer.Serialize("cdc.customers", testCDCEvent())
+	require.NoError(t, err)
+
+	// A second serializer looks up the schema already registered for the subject
+	other, err := NewAvroSerializer(registry)
+	require.NoError(t, err)
+	second, err := other.Serialize("cdc.customers", testCDCEvent())
+	require.NoError(t, err)
+
+	assert.Equal(t, first[1:5], second[1:5])
+}
+
+func TestAvroSerializer_NullImages(t *testing.T) {
+	serializer, err := NewAvroSerializer(newMockRegistry(t))
+	require.NoError(t, err)
+
+	event := testCDCEvent()
+	event.Before = nil
+	event.TransactionID = ""
+
+	data, err := serializer.Serialize("cdc.customers", event)
+	require.NoError(t, err)
+
+	native, _, err := serializer.codec.NativeFromBinary(data[5:])
+	require.NoError(t, err)
+	record := native.(map[string]interface{})
+	assert.Nil(t, record["before"])
+	assert.Nil(t, record["transaction_id"])
+}
+
+func TestCDCProcessor_DefaultsToJSONSerializer(t *testing.T) {
+	processor := NewCDCProcessor(nil)
+	assert.IsType(t, JSONSerializer{}, processor.serializer)
+
+	avro, err := NewAvroSerializer(newMockRegistry(t))
+	require.NoError(t, err)
+	processor.SetSerializer(avro)
+	assert.Same(t, avro, processor.serializer)
+}
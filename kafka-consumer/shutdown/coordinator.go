@@ -0,0 +1,100 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Func stops a component. It should return once the component has fully
+// stopped, or when ctx is done.
+type Func func(ctx context.Context) error
+
+// component is a registered shutdown step
+type component struct {
+	name     string
+	shutdown Func
+}
+
+// Coordinator shuts registered components down one at a time, in registration
+// order, within a single global deadline
+type Coordinator struct {
+	timeout    time.Duration
+	logger     *zap.Logger
+	mu         sync.Mutex
+	components []component
+}
+
+// NewCoordinator creates a coordinator whose Shutdown must finish within timeout
+func NewCoordinator(timeout time.Duration, logger *zap.Logger) *Coordinator {
+	return &Coordinator{
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Register adds a component to be stopped after every component registered
+// before it
+func (c *Coordinator) Register(name string, fn Func) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.components = append(c.components, component{name: name, shutdown: fn})
+}
+
+// Shutdown stops every registered component in order, waiting for each to
+// finish before starting the next. Once the deadline passes the remaining
+// components are abandoned. The returned error joins every component failure.
+func (c *Coordinator) Shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	c.mu.Lock()
+	components := append([]component(nil), c.components...)
+	c.mu.Unlock()
+
+	var errs []error
+	for _, comp := range components {
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("failed to shut down %s: %w", comp.name, ctx.Err()))
+			continue
+		}
+
+		start := time.Now()
+		if err := c.stop(ctx, comp); err != nil {
+			c.logger.Error("component shutdown failed",
+				zap.String("component", comp.name),
+				zap.Duration("duration", time.Since(start)),
+				zap.Error(err),
+			)
+			errs = append(errs, fmt.Errorf("failed to shut down %s: %w", comp.name, err))
+			continue
+		}
+
+		c.logger.Info("component stopped",
+			zap.String("component", comp.name),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}
+
+	return errors.Join(errs...)
+}
+
+// stop runs one component's shutdown, giving up when ctx is done even if the
+// component ignores it
+func (c *Coordinator) stop(ctx context.Context, comp component) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- comp.shutdown(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
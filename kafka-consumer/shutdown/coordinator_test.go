@@ -0,0 +1,103 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// recorder tracks the order in which fake components stop
+type recorder struct {
+	mu      sync.Mutex
+	stopped []string
+}
+
+func (r *recorder) component(name string, delay time.Duration, err error) Func {
+	return func(ctx context.Context) error {
+		time.Sleep(delay)
+		r.mu.Lock()
+		r.stopped = append(r.stopped, name)
+		r.mu.Unlock()
+		return err
+	}
+}
+
+func (r *recorder) order() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.stopped...)
+}
+
+func TestCoordinator_StopsInOrder(t *testing.T) {
+	rec := &recorder{}
+	c := NewCoordinator(time.Second, zap.NewNop())
+	c.Register("consumer", rec.component("consumer", 30*time.Millisecond, nil))
+	c.Register("metrics-server", rec.component("metrics-server", 0, nil))
+	c.Register("logger", rec.component("logger", 10*time.Millisecond, nil))
+
+	err := c.Shutdown(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"consumer", "metrics-server", "logger"}, rec.order())
+}
+
+func TestCoordinator_AggregatesErrors(t *testing.T) {
+	errConsumer := errors.New("commit failed")
+	errMetrics := errors.New("listener stuck")
+
+	rec := &recorder{}
+	c := NewCoordinator(time.Second, zap.NewNop())
+	c.Register("consumer", rec.component("consumer", 0, errConsumer))
+	c.Register("metrics-server", rec.component("metrics-server", 0, errMetrics))
+	c.Register("logger", rec.component("logger", 0, nil))
+
+	err := c.Shutdown(context.Background())
+
+	assert.ErrorIs(t, err, errConsumer)
+	assert.ErrorIs(t, err, errMetrics)
+	assert.Contains(t, err.Error(), "failed to shut down consumer")
+	assert.Equal(t, []string{"consumer", "metrics-server", "logger"}, rec.order())
+}
+
+func TestCoordinator_RespectsDeadline(t *testing.T) {
+	rec := &recorder{}
+	c := NewCoordinator(50*time.Millisecond, zap.NewNop())
+	c.Register("fast", rec.component("fast", 0, nil))
+	// Ignores ctx and outlives the deadline
+	c.Register("slow", rec.component("slow", 500*time.Millisecond, nil))
+	c.Register("never", rec.component("never", 0, nil))
+
+	start := time.Now()
+	err := c.Shutdown(context.Background())
+	elapsed := time.Since(start)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "failed to shut down slow")
+	assert.Contains(t, err.Error(), "failed to shut down never")
+	assert.Less(t, elapsed, 400*time.Millisecond)
+	assert.Equal(t, []string{"fast"}, rec.order())
+}
+
+func TestCoordinator_ComponentSeesDeadline(t *testing.T) {
+	c := NewCoordinator(time.Second, zap.NewNop())
+
+	var hasDeadline bool
+	c.Register("consumer", func(ctx context.Context) error {
+		_, hasDeadline = ctx.Deadline()
+		return nil
+	})
+
+	assert.NoError(t, c.Shutdown(context.Background()))
+	assert.True(t, hasDeadline)
+}
+
+func TestCoordinator_NoComponents(t *testing.T) {
+	c := NewCoordinator(time.Second, zap.NewNop())
+
+	assert.NoError(t, c.Shutdown(context.Background()))
+}
@@ -12,8 +12,12 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+	"github.com/wgu/go-performance-enablement/pkg/logging"
 	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"go.uber.org/zap"
 )
@@ -26,19 +30,59 @@ var (
 	jwtPublicKey  *rsa.PublicKey
 	issuer        string
 	audience      string
+
+	// Secrets Manager fetch state. The secret survives warm starts in
+	// jwtSecret, so a failed refresh keeps serving the previous value.
+	jwtSecretName     string
+	fetchSecret       secretFetcher
+	secretDegraded    bool
+	lastSecretAttempt time.Time
+	sleep             = time.Sleep
+
+	// Replay protection for one-time tokens, enabled by REPLAY_PROTECTION_TABLE
+	replayTable string
+	replayStore putItemAPI
+)
+
+const (
+	secretFetchAttempts  = 4
+	secretFetchBaseDelay = 100 * time.Millisecond
+	secretRetryInterval  = time.Minute
+)
+
+// secretFetcher retrieves a secret value by name
+type secretFetcher func(ctx context.Context, name string) (string, error)
+
+// putItemAPI is the part of the DynamoDB client used to record token IDs
+type putItemAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// errTokenReplayed is returned when a one-time token's jti was already used
+var errTokenReplayed = errors.New("token already used")
+
+// Reasons extractToken finds no token, logged when a request is denied
+var (
+	errNoAuthorizationHeader  = errors.New("no Authorization header")
+	errMalformedAuthorization = errors.New("malformed Authorization header")
 )
 
 func init() {
 	var err error
 
-	// Initialize logger
-	logger, _ = zap.NewProduction()
+	// Initialize logger from LOG_LEVEL and LOG_FORMAT
+	logger, err = logging.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Get environment variables
 	currentRegion = os.Getenv("AWS_REGION")
 	issuer = os.Getenv("JWT_ISSUER")
 	audience = os.Getenv("JWT_AUDIENCE")
-	jwtSecretName := os.Getenv("JWT_SECRET_NAME")
+	jwtSecretName = os.Getenv("JWT_SECRET_NAME")
+	replayTable = os.Getenv("REPLAY_PROTECTION_TABLE")
 
 	// Initialize AWS clients
 	ctx := context.Background()
@@ -46,21 +90,97 @@ func init() {
 	if err != nil {
 		logger.Fatal("failed to create AWS clients", zap.Error(err))
 	}
+	fetchSecret = awsClients.GetSecret
+	replayStore = awsClients.DynamoDB
+
+	awsutils.ConfigureSlowCallWarnings(logger)
 
 	// Retrieve JWT secret from Secrets Manager
-	if jwtSecretName != "" {
-		jwtSecret, err = awsClients.GetSecret(ctx, jwtSecretName)
-		if err != nil {
-			logger.Fatal("failed to retrieve JWT secret", zap.Error(err))
-		}
-		logger.Info("JWT secret loaded from Secrets Manager")
-	} else {
+	initJWTSecret(ctx)
+}
+
+// initJWTSecret loads the JWT secret at cold start. A Secrets Manager outage
+// degrades to a bootstrap secret (or denies all requests) instead of crashing,
+// and the fetch is retried from the handler.
+func initJWTSecret(ctx context.Context) {
+	if jwtSecretName == "" {
 		// For local development
 		jwtSecret = os.Getenv("JWT_SECRET")
 		if jwtSecret == "" {
 			logger.Warn("no JWT secret configured")
 		}
+		return
+	}
+
+	jwtSecret = loadJWTSecret(ctx, os.Getenv("JWT_BOOTSTRAP_SECRET"))
+	if secretDegraded {
+		return
 	}
+	logger.Info("JWT secret loaded from Secrets Manager")
+}
+
+// refreshJWTSecret retries the Secrets Manager fetch while running degraded,
+// at most once per secretRetryInterval
+func refreshJWTSecret(ctx context.Context) {
+	if !secretDegraded || jwtSecretName == "" || time.Since(lastSecretAttempt) < secretRetryInterval {
+		return
+	}
+
+	jwtSecret = loadJWTSecret(ctx, jwtSecret)
+	if !secretDegraded {
+		logger.Info("JWT secret recovered from Secrets Manager")
+	}
+}
+
+// loadJWTSecret fetches the secret with retries. On failure it returns
+// fallback (a previously loaded or bootstrap secret) and marks the
+// authorizer degraded.
+func loadJWTSecret(ctx context.Context, fallback string) string {
+	lastSecretAttempt = time.Now()
+
+	value, err := fetchSecretWithRetry(ctx, jwtSecretName)
+	if err == nil {
+		secretDegraded = false
+		return value
+	}
+
+	secretDegraded = true
+	if fallback != "" {
+		logger.Error("failed to retrieve JWT secret, using fallback secret",
+			zap.Error(err),
+			zap.String("secret_name", jwtSecretName),
+		)
+		return fallback
+	}
+
+	logger.Error("failed to retrieve JWT secret and no fallback configured, denying all requests",
+		zap.Error(err),
+		zap.String("secret_name", jwtSecretName),
+	)
+	return ""
+}
+
+// fetchSecretWithRetry fetches a secret, retrying with exponential backoff
+func fetchSecretWithRetry(ctx context.Context, name string) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt < secretFetchAttempts; attempt++ {
+		if attempt > 0 {
+			sleep(secretFetchBaseDelay << (attempt - 1))
+		}
+
+		value, err := fetchSecret(ctx, name)
+		if err == nil {
+			return value, nil
+		}
+		lastErr = err
+
+		logger.Warn("failed to fetch JWT secret",
+			zap.Error(err),
+			zap.Int("attempt", attempt+1),
+		)
+	}
+
+	return "", fmt.Errorf("failed to fetch secret after %d attempts: %w", secretFetchAttempts, lastErr)
 }
 
 // Claims represents JWT claims
@@ -82,10 +202,12 @@ func Handler(ctx context.Context, request events.APIGatewayCustomAuthorizerReque
 		zap.String("path", request.Path),
 	)
 
+	refreshJWTSecret(ctx)
+
 	// Extract token from Authorization header
-	token := extractToken(request.Headers)
-	if token == "" {
-		logger.Warn("no authorization token provided")
+	token, err := extractToken(request.Headers)
+	if err != nil {
+		logger.Warn("no authorization token provided", zap.Error(err))
 		duration := time.Since(start)
 		metrics.RecordLambdaInvocation(functionName, currentRegion, duration, errors.New("unauthorized"))
 		return generatePolicy("", "Deny", request.MethodArn), nil
@@ -133,6 +255,18 @@ func Handler(ctx context.Context, request events.APIGatewayCustomAuthorizerReque
 		return generatePolicy(claims.UserID, "Deny", request.MethodArn), nil
 	}
 
+	// Tokens carrying a jti are one-time when replay protection is enabled
+	if err := checkReplay(ctx, claims); err != nil {
+		logger.Warn("token replay check failed",
+			zap.Error(err),
+			zap.String("user_id", claims.UserID),
+			zap.String("jti", claims.ID),
+		)
+		duration := time.Since(start)
+		metrics.RecordLambdaInvocation(functionName, currentRegion, duration, err)
+		return generatePolicy(claims.UserID, "Deny", request.MethodArn), nil
+	}
+
 	// Authorization successful
 	duration := time.Since(start)
 	metrics.RecordLambdaInvocation(functionName, currentRegion, duration, nil)
@@ -156,25 +290,98 @@ func Handler(ctx context.Context, request events.APIGatewayCustomAuthorizerReque
 	return policy, nil
 }
 
-// extractToken extracts JWT token from Authorization header
-func extractToken(headers map[string]string) string {
-	// Try Authorization header
-	if auth, ok := headers["Authorization"]; ok {
-		parts := strings.Split(auth, " ")
-		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
-			return parts[1]
+// checkReplay records the token's jti with a conditional put so a second use
+// of the same token fails. The record expires with the token; tokens without
+// an expiry are remembered until removed. Store errors deny the request, since
+// a one-time token must not be accepted unchecked.
+func checkReplay(ctx context.Context, claims *Claims) error {
+	if replayTable == "" || claims.ID == "" {
+		return nil
+	}
+
+	item := map[string]types.AttributeValue{
+		"jti": &types.AttributeValueMemberS{Value: claims.ID},
+	}
+	if claims.ExpiresAt != nil {
+		awsutils.SetTTLAt(item, "ttl", claims.ExpiresAt.Time)
+	}
+
+	_, err := replayStore.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(replayTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(jti)"),
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return errTokenReplayed
 		}
+		return fmt.Errorf("failed to record token ID: %w", err)
 	}
+	return nil
+}
 
-	// Try lowercase authorization header
-	if auth, ok := headers["authorization"]; ok {
-		parts := strings.Split(auth, " ")
-		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
-			return parts[1]
+// extractToken extracts the JWT from an RFC 6750 "Bearer <token>"
+// Authorization header. The header name and scheme match case-insensitively
+// and any run of spaces or tabs separates them from the token. A missing or
+// malformed header returns an error giving the reason.
+func extractToken(headers map[string]string) (string, error) {
+	auth, ok := authorizationHeader(headers)
+	if !ok {
+		return "", errNoAuthorizationHeader
+	}
+
+	fields := strings.Fields(auth)
+	switch {
+	case len(fields) == 0:
+		return "", fmt.Errorf("%w: empty value", errMalformedAuthorization)
+	case !strings.EqualFold(fields[0], "bearer"):
+		if len(fields) == 1 {
+			return "", fmt.Errorf("%w: missing scheme", errMalformedAuthorization)
 		}
+		return "", fmt.Errorf("%w: unsupported scheme %q", errMalformedAuthorization, fields[0])
+	case len(fields) == 1:
+		return "", fmt.Errorf("%w: missing bearer token", errMalformedAuthorization)
+	case len(fields) > 2:
+		return "", fmt.Errorf("%w: unexpected content after bearer token", errMalformedAuthorization)
 	}
 
-	return ""
+	token := fields[1]
+	if !isBearerToken(token) {
+		return "", fmt.Errorf("%w: bearer token contains invalid characters", errMalformedAuthorization)
+	}
+	return token, nil
+}
+
+// authorizationHeader returns the Authorization header, whatever its case
+func authorizationHeader(headers map[string]string) (string, bool) {
+	if auth, ok := headers["Authorization"]; ok {
+		return auth, true
+	}
+	for name, value := range headers {
+		if strings.EqualFold(name, "Authorization") {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// isBearerToken reports whether token matches RFC 6750's b64token syntax:
+// letters, digits and "-._~+/", followed by optional "=" padding
+func isBearerToken(token string) bool {
+	padded := strings.TrimRight(token, "=")
+	if padded == "" {
+		return false
+	}
+	for _, r := range padded {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-._~+/", r):
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // validateToken validates and parses JWT token
@@ -195,7 +402,11 @@ func validateToken(tokenString string) (*Claims, error) {
 			return nil, errors.New("RSA public key not configured")
 		}
 
-		// Return HMAC secret
+		// Return HMAC secret. An empty key would verify tokens signed with
+		// an empty key, so refuse it.
+		if jwtSecret == "" {
+			return nil, errors.New("HMAC secret not configured")
+		}
 		return []byte(jwtSecret), nil
 	})
 
@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
@@ -65,12 +70,72 @@ func TestExtractToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := extractToken(tt.headers)
+			result, err := extractToken(tt.headers)
 			assert.Equal(t, tt.expected, result)
+			assert.Equal(t, tt.expected == "", err != nil)
 		})
 	}
 }
 
+func TestExtractToken_Whitespace(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"tab separator", "Bearer\ttest-token"},
+		{"multiple spaces", "Bearer    test-token"},
+		{"surrounding whitespace", "  Bearer test-token \t"},
+		{"lowercase scheme", "bearer test-token"},
+		{"uppercase scheme", "BEARER test-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := extractToken(map[string]string{"Authorization": tt.value})
+			assert.NoError(t, err)
+			assert.Equal(t, "test-token", token)
+		})
+	}
+}
+
+func TestExtractToken_Malformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr error
+		reason  string
+	}{
+		{"no header", map[string]string{}, errNoAuthorizationHeader, "no Authorization header"},
+		{"blank value", map[string]string{"Authorization": " \t "}, errMalformedAuthorization, "empty value"},
+		{"missing scheme", map[string]string{"Authorization": "test-token"}, errMalformedAuthorization, "missing scheme"},
+		{"scheme only", map[string]string{"Authorization": "Bearer"}, errMalformedAuthorization, "missing bearer token"},
+		{"other scheme", map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, errMalformedAuthorization, `unsupported scheme "Basic"`},
+		{"extra content", map[string]string{"Authorization": "Bearer test-token extra"}, errMalformedAuthorization, "unexpected content after bearer token"},
+		{"invalid characters", map[string]string{"Authorization": "Bearer test,token"}, errMalformedAuthorization, "invalid characters"},
+		{"padding only", map[string]string{"Authorization": "Bearer =="}, errMalformedAuthorization, "invalid characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := extractToken(tt.headers)
+			assert.Empty(t, token)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Contains(t, err.Error(), tt.reason)
+		})
+	}
+}
+
+func TestExtractToken_HeaderNameCase(t *testing.T) {
+	token, err := extractToken(map[string]string{"AUTHORIZATION": "Bearer test-token"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test-token", token)
+
+	// Base64 padding is part of the token
+	token, err = extractToken(map[string]string{"Authorization": "Bearer dGVzdA=="})
+	assert.NoError(t, err)
+	assert.Equal(t, "dGVzdA==", token)
+}
+
 func TestValidateToken(t *testing.T) {
 	// Create a valid token for testing
 	validClaims := &Claims{
@@ -393,3 +458,184 @@ func TestHandler(t *testing.T) {
 		})
 	}
 }
+
+// withSecretFetcher swaps the secret fetch state for a test and restores it after
+func withSecretFetcher(t *testing.T, name string, fetch secretFetcher) *[]time.Duration {
+	origName, origFetch, origSleep, origSecret := jwtSecretName, fetchSecret, sleep, jwtSecret
+	origDegraded, origAttempt := secretDegraded, lastSecretAttempt
+
+	var sleeps []time.Duration
+	jwtSecretName = name
+	fetchSecret = fetch
+	sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	secretDegraded = false
+	lastSecretAttempt = time.Time{}
+
+	t.Cleanup(func() {
+		jwtSecretName, fetchSecret, sleep, jwtSecret = origName, origFetch, origSleep, origSecret
+		secretDegraded, lastSecretAttempt = origDegraded, origAttempt
+	})
+	return &sleeps
+}
+
+func TestInitJWTSecret_RetriesTransientFailure(t *testing.T) {
+	calls := 0
+	sleeps := withSecretFetcher(t, "jwt-secret", func(ctx context.Context, name string) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", errors.New("service unavailable")
+		}
+		return "fetched-secret", nil
+	})
+
+	assert.NotPanics(t, func() { initJWTSecret(context.Background()) })
+
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, "fetched-secret", jwtSecret)
+	assert.False(t, secretDegraded)
+	assert.Equal(t, []time.Duration{secretFetchBaseDelay, 2 * secretFetchBaseDelay}, *sleeps)
+}
+
+func TestInitJWTSecret_PermanentFailureUsesBootstrap(t *testing.T) {
+	calls := 0
+	withSecretFetcher(t, "jwt-secret", func(ctx context.Context, name string) (string, error) {
+		calls++
+		return "", errors.New("service unavailable")
+	})
+	t.Setenv("JWT_BOOTSTRAP_SECRET", "bootstrap-secret")
+
+	assert.NotPanics(t, func() { initJWTSecret(context.Background()) })
+
+	assert.Equal(t, secretFetchAttempts, calls)
+	assert.Equal(t, "bootstrap-secret", jwtSecret)
+	assert.True(t, secretDegraded)
+}
+
+func TestInitJWTSecret_PermanentFailureWithoutFallbackDeniesAll(t *testing.T) {
+	withSecretFetcher(t, "jwt-secret", func(ctx context.Context, name string) (string, error) {
+		return "", errors.New("service unavailable")
+	})
+	t.Setenv("JWT_BOOTSTRAP_SECRET", "")
+
+	assert.NotPanics(t, func() { initJWTSecret(context.Background()) })
+	assert.Equal(t, "", jwtSecret)
+	assert.True(t, secretDegraded)
+
+	// A token signed with an empty key must not validate
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "user-1"})
+	tokenString, err := token.SignedString([]byte(""))
+	assert.NoError(t, err)
+
+	_, err = validateToken(tokenString)
+	assert.Error(t, err)
+}
+
+func TestRefreshJWTSecret_KeepsCachedValueOnFailure(t *testing.T) {
+	healthy := true
+	withSecretFetcher(t, "jwt-secret", func(ctx context.Context, name string) (string, error) {
+		if healthy {
+			return "rotated-secret", nil
+		}
+		return "", errors.New("service unavailable")
+	})
+
+	// Degraded with a previously loaded secret still in memory
+	jwtSecret = "cached-secret"
+	secretDegraded = true
+	healthy = false
+
+	refreshJWTSecret(context.Background())
+	assert.Equal(t, "cached-secret", jwtSecret)
+	assert.True(t, secretDegraded)
+
+	// Retries are rate limited
+	healthy = true
+	refreshJWTSecret(context.Background())
+	assert.Equal(t, "cached-secret", jwtSecret)
+
+	lastSecretAttempt = time.Now().Add(-secretRetryInterval)
+	refreshJWTSecret(context.Background())
+	assert.Equal(t, "rotated-secret", jwtSecret)
+	assert.False(t, secretDegraded)
+}
+
+// mockReplayStore fails conditional puts for token IDs it has already seen
+type mockReplayStore struct {
+	seen   map[string]bool
+	inputs []*dynamodb.PutItemInput
+}
+
+func (m *mockReplayStore) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.inputs = append(m.inputs, params)
+	jti := params.Item["jti"].(*types.AttributeValueMemberS).Value
+	if m.seen[jti] {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	m.seen[jti] = true
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestHandler_ReplayProtection(t *testing.T) {
+	store := &mockReplayStore{seen: map[string]bool{}}
+	origTable, origStore := replayTable, replayStore
+	replayTable, replayStore = "used-tokens", store
+	t.Cleanup(func() { replayTable, replayStore = origTable, origStore })
+
+	expiresAt := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	sign := func(jti string) events.APIGatewayCustomAuthorizerRequestTypeRequest {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+			UserID: "user-123",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        jti,
+				Issuer:    issuer,
+				Audience:  jwt.ClaimStrings{audience},
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+			},
+		}).SignedString([]byte(jwtSecret))
+		return events.APIGatewayCustomAuthorizerRequestTypeRequest{
+			MethodArn: "arn:aws:execute-api:us-west-2:123456789012:api/prod/POST/actions",
+			Headers:   map[string]string{"Authorization": "Bearer " + token},
+		}
+	}
+
+	// The first use of a jti is allowed and recorded until the token expires
+	response, err := Handler(context.Background(), sign("action-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", response.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, "used-tokens", aws.ToString(store.inputs[0].TableName))
+	assert.Equal(t, "attribute_not_exists(jti)", aws.ToString(store.inputs[0].ConditionExpression))
+	assert.Equal(t, strconv.FormatInt(expiresAt.Unix(), 10), store.inputs[0].Item["ttl"].(*types.AttributeValueMemberN).Value)
+
+	// Replaying the same token is denied
+	response, err = Handler(context.Background(), sign("action-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Deny", response.PolicyDocument.Statement[0].Effect)
+
+	// Another one-time token is still allowed
+	response, err = Handler(context.Background(), sign("action-2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", response.PolicyDocument.Statement[0].Effect)
+
+	// Tokens without a jti are not tracked
+	response, err = Handler(context.Background(), sign(""))
+	assert.NoError(t, err)
+	assert.Equal(t, "Allow", response.PolicyDocument.Statement[0].Effect)
+	assert.Len(t, store.inputs, 3)
+}
+
+func TestCheckReplay_StoreErrorDenies(t *testing.T) {
+	origTable, origStore := replayTable, replayStore
+	replayTable, replayStore = "used-tokens", failingReplayStore{}
+	t.Cleanup(func() { replayTable, replayStore = origTable, origStore })
+
+	err := checkReplay(context.Background(), &Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "action-1"}})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, errTokenReplayed)
+}
+
+// failingReplayStore fails every put as if DynamoDB were unavailable
+type failingReplayStore struct{}
+
+func (failingReplayStore) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return nil, errors.New("service unavailable")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+	"github.com/wgu/go-performance-enablement/pkg/logging"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+const defaultDLQMaxAge = time.Hour
+
+var (
+	logger        *zap.Logger
+	awsClients    *awsutils.AWSClients
+	monitor       *awsutils.DLQAgeMonitor
+	currentRegion string
+)
+
+func init() {
+	var err error
+
+	// Initialize logger from LOG_LEVEL and LOG_FORMAT
+	logger, err = logging.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Get environment variables
+	currentRegion = os.Getenv("AWS_REGION")
+	dlqURL := os.Getenv("DLQ_URL")
+	eventBusName := os.Getenv("EVENT_BUS_NAME")
+
+	// Escalate once the oldest DLQ message is older than DLQ_MAX_AGE, e.g. "2h"
+	maxAge := defaultDLQMaxAge
+	if value := os.Getenv("DLQ_MAX_AGE"); value != "" {
+		maxAge, err = time.ParseDuration(value)
+		if err != nil || maxAge <= 0 {
+			logger.Fatal("invalid DLQ_MAX_AGE", zap.String("value", value), zap.Error(err))
+		}
+	}
+
+	// Initialize AWS clients
+	ctx := context.Background()
+	awsClients, err = awsutils.NewAWSClients(ctx)
+	if err != nil {
+		logger.Fatal("failed to create AWS clients", zap.Error(err))
+	}
+
+	awsutils.ConfigureSlowCallWarnings(logger)
+
+	// Initialize EventBridge publisher
+	eventBridge := awsutils.NewEventBridgePublisher(
+		awsClients.EventBridge,
+		eventBusName,
+		"dlq-monitor",
+	)
+
+	// EVENT_SINK=file writes escalations to EVENT_SINK_PATH instead
+	publisher, err := awsutils.SelectEventSink(os.Getenv("EVENT_SINK"), os.Getenv("EVENT_SINK_PATH"), eventBridge, "dlq-monitor")
+	if err != nil {
+		logger.Fatal("failed to create event sink", zap.Error(err))
+	}
+
+	monitor = awsutils.NewDLQAgeMonitor(awsClients.SQS, publisher, dlqURL, maxAge)
+}
+
+// Handler checks the age of the oldest DLQ message on a schedule
+func Handler(ctx context.Context) error {
+	start := time.Now()
+	functionName := "dlq-monitor"
+
+	escalation, err := monitor.Check(ctx)
+	metrics.RecordLambdaInvocation(functionName, currentRegion, time.Since(start), err)
+	if err != nil {
+		logger.Error("DLQ age check failed", zap.Error(err), awsutils.ErrorField(err))
+		return err
+	}
+
+	if escalation != nil {
+		logger.Warn("DLQ message exceeded maximum age",
+			zap.String("queue_url", escalation.QueueURL),
+			zap.String("message_id", escalation.OldestMessageID),
+			zap.Int64("age_seconds", escalation.AgeSeconds),
+			zap.Int64("max_age_seconds", escalation.MaxAgeSeconds),
+		)
+		return nil
+	}
+
+	logger.Info("DLQ age check complete", zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+func main() {
+	lambda.Start(Handler)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+)
+
+// mockDLQ returns a single message sent at sentAt
+type mockDLQ struct {
+	sentAt time.Time
+}
+
+func (m *mockDLQ) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	return &sqs.ReceiveMessageOutput{Messages: []sqstypes.Message{{
+		MessageId:  aws.String("msg-1"),
+		Attributes: map[string]string{"SentTimestamp": strconv.FormatInt(m.sentAt.UnixMilli(), 10)},
+	}}}, nil
+}
+
+func (m *mockDLQ) ChangeMessageVisibilityBatch(ctx context.Context, params *sqs.ChangeMessageVisibilityBatchInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+}
+
+// recordingSink records the detail types published to it
+type recordingSink struct {
+	detailTypes []string
+}
+
+func (s *recordingSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	s.detailTypes = append(s.detailTypes, detailType)
+	return nil
+}
+
+func useMonitor(t *testing.T, sentAt time.Time) *recordingSink {
+	previous := monitor
+	t.Cleanup(func() { monitor = previous })
+
+	sink := &recordingSink{}
+	monitor = awsutils.NewDLQAgeMonitor(&mockDLQ{sentAt: sentAt}, sink, "https://sqs.us-west-2.amazonaws.com/123456789012/event-dlq", time.Hour)
+	return sink
+}
+
+func TestHandler_EscalatesOldMessage(t *testing.T) {
+	sink := useMonitor(t, time.Now().Add(-2*time.Hour))
+
+	err := Handler(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{wguevents.EventTypeDLQEscalation}, sink.detailTypes)
+}
+
+func TestHandler_RecentMessage(t *testing.T) {
+	sink := useMonitor(t, time.Now().Add(-time.Minute))
+
+	err := Handler(context.Background())
+
+	assert.NoError(t, err)
+	assert.Empty(t, sink.detailTypes)
+}
@@ -3,16 +3,24 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/klauspost/compress/zstd"
 	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+	"github.com/wgu/go-performance-enablement/pkg/circuitbreaker"
+	"github.com/wgu/go-performance-enablement/pkg/batch"
 	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/logging"
 	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"go.uber.org/zap"
 )
@@ -21,25 +29,99 @@ var (
 	logger           *zap.Logger
 	awsClients       *awsutils.AWSClients
 	partnerClients   *awsutils.AWSClients
-	publisher        *awsutils.EventBridgePublisher
-	circuitBreaker   *CircuitBreaker
+	publisher        awsutils.EventSink
+	routes           wguevents.RoutingTable
+	regionPublishers map[string]awsutils.EventSink
+	circuitBreakers  *circuitbreaker.Group
 	currentRegion    string
 	partnerRegion    string
 	eventBusName     string
 	dlqURL           string
+	dlqRouter        *awsutils.DeadLetterRouter
+	dlqBatcher       *awsutils.DeadLetterBatcher
+	dlqReplayer      *awsutils.DeadLetterReplayer
+	batchWorkers     int
+	retryBudget      int
+	maxAgePolicy     wguevents.MaxAgePolicy
+	utf8Policy       = wguevents.UTF8Replace
+	eventBuffer      *EventBuffer
+	payloadFormat    string
+	reconciliation   *awsutils.ReconciliationLog
+)
+
+// functionMetrics holds the function's metric series, resolved once in init
+// for the per-record path
+var functionMetrics *metrics.FunctionMetrics
+
+// defaultReconciliationTTL is how long reconciliation records are kept
+const defaultReconciliationTTL = 7 * 24 * time.Hour
+
+// defaultBreakerPolicy applies to target regions without a policy in
+// CIRCUIT_BREAKER_POLICIES
+var defaultBreakerPolicy = circuitbreaker.Policy{MaxFailures: 5, Timeout: 30 * time.Second}
+
+// Payload formats for routed events: plain JSON values, or DynamoDB's
+// type-tagged attribute values ({"S": "x"}) for consumers that need them
+const (
+	payloadFormatSimple = "simple"
+	payloadFormatTyped  = "typed"
 )
 
 func init() {
 	var err error
 	
-	// Initialize logger
-	logger, _ = zap.NewProduction()
+	// Initialize logger from LOG_LEVEL and LOG_FORMAT
+	logger, err = logging.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
 	
 	// Get environment variables
 	currentRegion = os.Getenv("AWS_REGION")
+	functionMetrics = metrics.NewFunctionMetrics("event-router", currentRegion)
 	partnerRegion = os.Getenv("PARTNER_REGION")
 	eventBusName = os.Getenv("EVENT_BUS_NAME")
 	dlqURL = os.Getenv("DLQ_URL")
+	batchWorkers = 1
+	if n, err := strconv.Atoi(os.Getenv("BATCH_WORKERS")); err == nil && n > 0 {
+		batchWorkers = n
+	}
+	
+	// Cap publish retries across all records of an invocation
+	if n, err := strconv.Atoi(os.Getenv("RETRY_BUDGET")); err == nil && n > 0 {
+		retryBudget = n
+	}
+	
+	// Drop events older than their type's max age, e.g. "INSERT=1h,*=6h"
+	maxAgePolicy, err = wguevents.ParseMaxAgePolicy(os.Getenv("EVENT_MAX_AGE"))
+	if err != nil {
+		logger.Fatal("invalid EVENT_MAX_AGE", zap.Error(err))
+	}
+	
+	// Strings with invalid UTF-8 are replaced or dead-lettered, e.g. "dlq"; defaults to "replace"
+	utf8Policy, err = wguevents.ParseUTF8Policy(os.Getenv("INVALID_UTF8_POLICY"))
+	if err != nil {
+		logger.Fatal("invalid INVALID_UTF8_POLICY", zap.Error(err))
+	}
+	
+	// Route payloads as plain values unless ROUTER_PAYLOAD_FORMAT=typed
+	payloadFormat = os.Getenv("ROUTER_PAYLOAD_FORMAT")
+	if payloadFormat == "" {
+		payloadFormat = payloadFormatSimple
+	}
+	if payloadFormat != payloadFormatSimple && payloadFormat != payloadFormatTyped {
+		logger.Fatal("invalid ROUTER_PAYLOAD_FORMAT", zap.String("format", payloadFormat))
+	}
+	
+	// Truncate payload values nested deeper than this, e.g. "16"; defaults to 32
+	if value := os.Getenv("MAX_ATTRIBUTE_DEPTH"); value != "" {
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 1 {
+			logger.Fatal("invalid MAX_ATTRIBUTE_DEPTH", zap.String("value", value), zap.Error(err))
+		}
+		awsutils.SetMaxStreamAttributeDepth(depth)
+	}
 	
 	// Initialize AWS clients for current region
 	ctx := context.Background()
@@ -48,54 +130,191 @@ func init() {
 		logger.Fatal("failed to create AWS clients", zap.Error(err))
 	}
 	
+	awsutils.ConfigureSlowCallWarnings(logger)
+	
+	// Events that keep failing are parked in PERMANENT_FAILURE_QUEUE_URL once
+	// they reach MAX_FAILURE_COUNT attempts, e.g. "5"
+	maxFailures, err := awsutils.ParseMaxFailures(os.Getenv("MAX_FAILURE_COUNT"))
+	if err != nil {
+		logger.Fatal("invalid MAX_FAILURE_COUNT", zap.Error(err))
+	}
+	
+	// Send error types to their own queues instead of DLQ_URL, e.g.
+	// "validation_failure=https://sqs.us-west-2.amazonaws.com/123456789012/review"
+	errorQueueURLs, err := awsutils.ParseErrorQueueURLs(os.Getenv("DLQ_ERROR_QUEUE_URLS"))
+	if err != nil {
+		logger.Fatal("invalid DLQ_ERROR_QUEUE_URLS", zap.Error(err))
+	}
+	dlqPolicy := awsutils.DeadLetterPolicy{
+		RetryQueueURL:     dlqURL,
+		PermanentQueueURL: os.Getenv("PERMANENT_FAILURE_QUEUE_URL"),
+		MaxFailures:       maxFailures,
+		ErrorQueueURLs:    errorQueueURLs,
+	}
+	dlqRouter = awsutils.NewDeadLetterRouter(awsClients.SQS, dlqPolicy, "event-router")
+	
+	// Failed records are dead-lettered in batches, sent before Handler returns
+	dlqBatcher = awsutils.NewDeadLetterBatcher(awsClients.SQS, dlqPolicy, "event-router")
+	
+	// Replayed events that fail again go back with their failure counted
+	dlqReplayer = awsutils.NewDeadLetterReplayer(dlqRouter, logger)
+	
+	// RECONCILIATION_ENABLED=true records each publish outcome in
+	// RECONCILIATION_TABLE_NAME, kept for RECONCILIATION_TTL (e.g. "72h")
+	if os.Getenv("RECONCILIATION_ENABLED") == "true" {
+		tableName := os.Getenv("RECONCILIATION_TABLE_NAME")
+		if tableName == "" {
+			logger.Fatal("RECONCILIATION_TABLE_NAME is required when reconciliation is enabled")
+		}
+		ttl := defaultReconciliationTTL
+		if value := os.Getenv("RECONCILIATION_TTL"); value != "" {
+			ttl, err = time.ParseDuration(value)
+			if err != nil || ttl < 0 {
+				logger.Fatal("invalid RECONCILIATION_TTL", zap.String("value", value), zap.Error(err))
+			}
+		}
+		reconciliation = awsutils.NewReconciliationLog(awsutils.NewDynamoDBHelper(awsClients.DynamoDB, tableName), ttl)
+	}
+	
 	// Initialize AWS clients for partner region
 	partnerClients, err = awsutils.NewAWSClientsWithRegion(ctx, partnerRegion)
 	if err != nil {
 		logger.Fatal("failed to create partner AWS clients", zap.Error(err))
 	}
+	publisher, err = newPartnerPublisher(partnerClients)
+	if err != nil {
+		logger.Fatal("failed to create event sink", zap.Error(err))
+	}
+	
+	// Route event types and tenants to other regions than PARTNER_REGION,
+	// e.g. "INSERT=us-east-1,tenant:acme=eu-west-1,*=us-east-2"; routes back
+	// to AWS_REGION are rejected
+	routes, err = wguevents.ParseRoutingTable(os.Getenv("ROUTING_TABLE"), currentRegion)
+	if err != nil {
+		logger.Fatal("invalid ROUTING_TABLE", zap.Error(err))
+	}
+	regionPublishers = make(map[string]awsutils.EventSink)
+	for _, region := range routes.Regions() {
+		if region == partnerRegion {
+			continue
+		}
+		clients, err := awsutils.NewAWSClientsWithRegion(ctx, region)
+		if err != nil {
+			logger.Fatal("failed to create AWS clients", zap.String("region", region), zap.Error(err))
+		}
+		regionPublishers[region], err = newPartnerPublisher(clients)
+		if err != nil {
+			logger.Fatal("failed to create event sink", zap.String("region", region), zap.Error(err))
+		}
+	}
 	
-	// Initialize EventBridge publisher
-	publisher = awsutils.NewEventBridgePublisher(
-		partnerClients.EventBridge,
+	// Initialize a circuit breaker per target region, so one failing region
+	// doesn't stop routing to the others
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", defaultBreakerPolicy, logger)
+	
+	// Override the breaker policy of target regions, e.g. "eu-west-1=3/10s,us-east-1=10/1m"
+	policies, err := circuitbreaker.ParsePolicies(os.Getenv("CIRCUIT_BREAKER_POLICIES"))
+	if err != nil {
+		logger.Fatal("invalid CIRCUIT_BREAKER_POLICIES", zap.Error(err))
+	}
+	for region, policy := range policies {
+		circuitBreakers.SetPolicy(region, policy)
+	}
+
+	// Buffer events while their target region is unreachable in the dedicated
+	// SPILL_QUEUE_URL, draining up to ROUTER_BUFFER_DRAIN_LIMIT (e.g. "500")
+	// of them per invocation once it recovers
+	if spillURL := os.Getenv("SPILL_QUEUE_URL"); spillURL != "" {
+		if spillURL == dlqURL {
+			logger.Fatal("SPILL_QUEUE_URL must not be the DLQ")
+		}
+		drainLimit := defaultBufferDrainLimit
+		if value := os.Getenv("ROUTER_BUFFER_DRAIN_LIMIT"); value != "" {
+			drainLimit, err = strconv.Atoi(value)
+			if err != nil || drainLimit < 1 {
+				logger.Fatal("invalid ROUTER_BUFFER_DRAIN_LIMIT", zap.String("value", value), zap.Error(err))
+			}
+		}
+		eventBuffer = NewEventBuffer(awsClients.SQS, spillURL, drainLimit)
+	}
+}
+
+// newPartnerPublisher creates the sink publishing routed events through the
+// EventBridge client of a partner region
+func newPartnerPublisher(clients *awsutils.AWSClients) (awsutils.EventSink, error) {
+	eventBridge := awsutils.NewEventBridgePublisher(
+		clients.EventBridge,
 		eventBusName,
 		"event-router",
 	)
+	eventBridge.SetWrapEnvelope(true)
 	
-	// Initialize circuit breaker
-	circuitBreaker = NewCircuitBreaker(5, 30*time.Second)
+	// Skip events already published by an earlier attempt, tracked in ROUTER_DEDUP_TABLE_NAME
+	if tableName := os.Getenv("ROUTER_DEDUP_TABLE_NAME"); tableName != "" {
+		eventBridge.SetDeduplicator(awsutils.NewDedupStore(awsClients.DynamoDB, tableName, 0))
+		// Keyed by stream record ID, which a retry keeps while the routed event's timestamp changes
+		eventBridge.SetIdempotencyKeyFunc(wguevents.EventIDIdempotencyKey)
+	}
+	
+	// EVENT_SINK=file swaps EventBridge for a local NDJSON sink
+	return awsutils.SelectEventSink(os.Getenv("EVENT_SINK"), os.Getenv("EVENT_SINK_PATH"), eventBridge, "event-router")
 }
 
-// Handler processes events and routes them to the partner region
+// Handler processes events and routes them to their target regions
 func Handler(ctx context.Context, event events.DynamoDBEvent) error {
 	start := time.Now()
-	functionName := "event-router"
 	
 	logger.Info("processing event batch",
 		zap.Int("record_count", len(event.Records)),
 		zap.String("source_region", currentRegion),
-		zap.String("target_region", partnerRegion),
+		zap.String("partner_region", partnerRegion),
 	)
 	
+	// Replay events buffered during an outage once a circuit lets them through
+	if eventBuffer != nil && !circuitBreakers.AllOpen() {
+		drained, err := eventBuffer.Drain(ctx, regionRoutable, publishBuffered)
+		if err != nil {
+			logger.Warn("failed to drain event buffer",
+				zap.Error(err),
+				zap.Int("drained", drained),
+			)
+		} else if drained > 0 {
+			logger.Info("drained event buffer", zap.Int("drained", drained))
+		}
+	}
+	
+	// Records share one retry budget so a failing batch fails fast
+	if retryBudget > 0 {
+		ctx = awsutils.WithRetryBudget(ctx, awsutils.NewRetryBudget(retryBudget))
+	}
+	
 	var errors []error
 	
-	for _, record := range event.Records {
-		if err := processRecord(ctx, record); err != nil {
+	for i, err := range processBatch(ctx, event.Records, processRecord) {
+		if err != nil {
 			errors = append(errors, err)
 			logger.Error("failed to process record",
 				zap.Error(err),
-				zap.String("event_id", record.EventID),
+				awsutils.ErrorField(err),
+				zap.String("event_id", event.Records[i].EventID),
 			)
 		}
 	}
 	
+	// An event that wasn't dead-lettered fails the batch so it's retried
+	dlqErr := dlqBatcher.FlushAndLog(ctx, logger)
+	
 	duration := time.Since(start)
 	
 	var finalErr error
 	if len(errors) > 0 {
 		finalErr = fmt.Errorf("failed to process %d/%d records", len(errors), len(event.Records))
+	} else if dlqErr != nil {
+		finalErr = dlqErr
 	}
 	
-	metrics.RecordLambdaInvocation(functionName, currentRegion, duration, finalErr)
+	functionMetrics.RecordInvocation(duration, finalErr)
+	logOpenBreakers(circuitbreaker.DefaultRegistry)
 	
 	if finalErr != nil {
 		return finalErr
@@ -109,17 +328,105 @@ func Handler(ctx context.Context, event events.DynamoDBEvent) error {
 	return nil
 }
 
+// processBatch runs process over the records with up to batchWorkers in
+// parallel, keeping records for the same item in stream order. The returned
+// errors are indexed like records.
+func processBatch(ctx context.Context, records []events.DynamoDBEventRecord, process func(context.Context, events.DynamoDBEventRecord) error) []error {
+	errs := batch.Process(ctx, len(records), batchWorkers,
+		func(i int) string { return awsutils.StreamRecordKey(records[i].Change.Keys) },
+		func(ctx context.Context, i int) error { return process(ctx, records[i]) },
+	)
+	
+	// A panic fails only its own record, which is dead-lettered with the stack
+	for i, err := range errs {
+		var panicErr *batch.PanicError
+		if errors.As(err, &panicErr) {
+			errs[i] = deadLetterPanic(ctx, records[i], panicErr)
+		}
+	}
+	return errs
+}
+
 func processRecord(ctx context.Context, record events.DynamoDBEventRecord) error {
+	if isStale(record) || isNoOp(record) {
+		return nil
+	}
+	
 	// Parse the DynamoDB record into our event structure
 	baseEvent, err := parseRecord(record)
 	if err != nil {
 		return fmt.Errorf("failed to parse record: %w", err)
 	}
 	
-	// Create cross-region event
+	if err := applyUTF8Policy(record, baseEvent); err != nil {
+		reconcile(ctx, record.EventID, record.EventSourceArn, "", awsutils.ReconciliationFailed, err)
+		return deadLetter(ctx, baseEvent, err, record.EventSourceArn)
+	}
+	
+	crossRegionEvent := newCrossRegionEvent(baseEvent)
+	targetRegion := crossRegionEvent.TargetRegion
+	
+	recordSize(record, crossRegionEvent)
+	
+	// Route through the target region's circuit breaker
+	publishedEventID, err := publishCrossRegion(ctx, crossRegionEvent)
+	
+	// Spill the event while the target region is down; its record is
+	// acknowledged once the event is persisted
+	if err != nil && eventBuffer != nil && circuitBreakers.For(targetRegion).GetState() == wguevents.CircuitBreakerOpen {
+		bufErr := eventBuffer.Add(ctx, crossRegionEvent, record.EventSourceArn)
+		if bufErr == nil {
+			logger.Debug("buffered event while circuit is open",
+				zap.String("event_id", baseEvent.EventID),
+			)
+			reconcile(ctx, record.EventID, record.EventSourceArn, "", awsutils.ReconciliationBuffered, err)
+			return nil
+		}
+		logger.Warn("failed to buffer event",
+			zap.Error(bufErr),
+			zap.String("event_id", baseEvent.EventID),
+		)
+	}
+	
+	if err != nil {
+		reconcile(ctx, record.EventID, record.EventSourceArn, "", awsutils.ReconciliationFailed, err)
+		
+		// Send to DLQ
+		if dlqErr := deadLetter(ctx, baseEvent, err, record.EventSourceArn); dlqErr != nil {
+			logger.Error("failed to send to DLQ",
+				zap.Error(dlqErr),
+				awsutils.ErrorField(dlqErr),
+				zap.String("event_id", baseEvent.EventID),
+			)
+		}
+		
+		metrics.CrossRegionEvents.WithLabelValues(currentRegion, targetRegion).Inc()
+		return fmt.Errorf("failed to route event: %w", err)
+	}
+	
+	reconcile(ctx, record.EventID, record.EventSourceArn, publishedEventID, awsutils.ReconciliationPublished, nil)
+	
+	// Record successful routing
+	latency := time.Since(crossRegionEvent.OriginalTimestamp)
+	metrics.CrossRegionLatency.WithLabelValues(currentRegion, targetRegion).Observe(latency.Seconds())
+	metrics.CrossRegionEvents.WithLabelValues(currentRegion, targetRegion).Inc()
+	
+	logger.Debug("successfully routed event",
+		zap.String("event_id", baseEvent.EventID),
+		zap.String("event_type", baseEvent.EventType),
+		zap.String("target_region", targetRegion),
+		zap.Duration("latency", latency),
+	)
+	
+	return nil
+}
+
+// newCrossRegionEvent wraps an event for its target region, with the payload
+// compressed
+func newCrossRegionEvent(baseEvent *wguevents.BaseEvent) *wguevents.CrossRegionEvent {
 	crossRegionEvent := &wguevents.CrossRegionEvent{
 		BaseEvent:         *baseEvent,
-		TargetRegion:      partnerRegion,
+		TargetRegion:      routeRegion(baseEvent),
 		OriginalTimestamp: baseEvent.Timestamp,
 		CompressionType:   "zstd",
 	}
@@ -137,45 +444,207 @@ func processRecord(ctx context.Context, record events.DynamoDBEventRecord) error
 			"compressed_data": compressedPayload,
 		}
 	}
+	return crossRegionEvent
+}
+
+// ReplayHandler routes events delivered from the DLQ again. An event that
+// fails again is dead-lettered with its failure count increased.
+func ReplayHandler(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	logger.Info("replaying dead-lettered events",
+		zap.Int("message_count", len(event.Records)),
+		zap.String("source_region", currentRegion),
+	)
 	
-	// Route through circuit breaker
-	err = circuitBreaker.Execute(func() error {
-		return publisher.PublishCrossRegionEvent(ctx, partnerRegion, crossRegionEvent)
-	})
-	
-	if err != nil {
-		// Send to DLQ
-		if dlqErr := sendToDLQ(ctx, baseEvent, err); dlqErr != nil {
-			logger.Error("failed to send to DLQ",
-				zap.Error(dlqErr),
-				zap.String("event_id", baseEvent.EventID),
-			)
+	return dlqReplayer.Replay(ctx, event, replayDeadLetter), nil
+}
+
+// replayDeadLetter routes a dead-lettered event again. A panicked record was
+// dead-lettered as the raw stream record, any other failure as its event.
+func replayDeadLetter(ctx context.Context, dlqEvent *wguevents.DeadLetterEvent) error {
+	baseEvent := &wguevents.BaseEvent{}
+	if dlqEvent.ErrorType == wguevents.ErrorTypePanic {
+		var record events.DynamoDBEventRecord
+		if err := json.Unmarshal(dlqEvent.OriginalEvent, &record); err != nil {
+			return fmt.Errorf("failed to unmarshal dead-lettered record: %w", err)
 		}
-		
-		metrics.CrossRegionEvents.WithLabelValues(currentRegion, partnerRegion).Inc()
+		var err error
+		if baseEvent, err = parseRecord(record); err != nil {
+			return fmt.Errorf("failed to parse record: %w", err)
+		}
+	} else if err := json.Unmarshal(dlqEvent.OriginalEvent, baseEvent); err != nil {
+		return fmt.Errorf("failed to unmarshal dead-lettered event: %w", err)
+	}
+	
+	if _, err := publishCrossRegion(ctx, newCrossRegionEvent(baseEvent)); err != nil {
 		return fmt.Errorf("failed to route event: %w", err)
 	}
+	return nil
+}
+
+// isNoOp reports whether a record is a MODIFY that left the item unchanged,
+// recording it as skipped so nothing is replicated for it
+func isNoOp(record events.DynamoDBEventRecord) bool {
+	if !awsutils.IsNoOpModify(record) {
+		return false
+	}
 	
-	// Record successful routing
-	latency := time.Since(crossRegionEvent.OriginalTimestamp)
-	metrics.CrossRegionLatency.WithLabelValues(currentRegion, partnerRegion).Observe(latency.Seconds())
-	metrics.CrossRegionEvents.WithLabelValues(currentRegion, partnerRegion).Inc()
+	logger.Debug("skipping unchanged MODIFY",
+		zap.String("event_id", record.EventID),
+	)
+	functionMetrics.NoOpSkipped.Inc()
+	return true
+}
+
+// isStale reports whether a record is older than the max age for its event
+// type, recording it as dropped if so
+func isStale(record events.DynamoDBEventRecord) bool {
+	occurredAt := record.Change.ApproximateCreationDateTime.Time
+	if !maxAgePolicy.IsStale(record.EventName, occurredAt, time.Now()) {
+		return false
+	}
 	
-	logger.Debug("successfully routed event",
-		zap.String("event_id", baseEvent.EventID),
-		zap.String("event_type", baseEvent.EventType),
-		zap.Duration("latency", latency),
+	logger.Warn("dropping stale event",
+		zap.String("event_id", record.EventID),
+		zap.String("event_name", record.EventName),
+		zap.Duration("age", time.Since(occurredAt)),
 	)
+	metrics.StaleEventsDropped.WithLabelValues("event-router", record.EventName).Inc()
+	return true
+}
+
+// recordSize observes the size of a stream record and of the event routed
+// for it, labeled by source table
+func recordSize(record events.DynamoDBEventRecord, event *wguevents.CrossRegionEvent) {
+	table := awsutils.StreamTableName(record.EventSourceArn)
+	if table == "" {
+		table = "unknown"
+	}
 	
+	data, err := json.Marshal(event)
+	if err != nil {
+		logger.Debug("failed to measure event size",
+			zap.Error(err),
+			zap.String("event_id", event.EventID),
+		)
+		return
+	}
+	metrics.RecordStreamRecordSize(table, record.Change.SizeBytes, int64(len(data)))
+}
+
+// crossRegionPublisher is implemented by sinks with cross-region handling,
+// such as deduplication, that report the ID of the event they published
+type crossRegionPublisher interface {
+	PublishCrossRegionEventResult(ctx context.Context, targetRegion string, event interface{}) (*awsutils.PublishResult, error)
+}
+
+// routeRegion returns the region an event is routed to: its entry in the
+// routing table, or the partner region if it has none
+func routeRegion(event *wguevents.BaseEvent) string {
+	if region, ok := routes.Region(event.EventType, event.Metadata.TenantID); ok {
+		return region
+	}
+	return partnerRegion
+}
+
+// publisherFor returns the sink publishing to region, falling back to the
+// partner region's
+func publisherFor(region string) awsutils.EventSink {
+	if sink, ok := regionPublishers[region]; ok {
+		return sink
+	}
+	return publisher
+}
+
+// publishCrossRegion publishes an event to its target region through that
+// region's circuit breaker, returning the ID EventBridge assigned it when the
+// sink reports one
+func publishCrossRegion(ctx context.Context, event *wguevents.CrossRegionEvent) (string, error) {
+	sink := publisherFor(event.TargetRegion)
+	var publishedEventID string
+	err := circuitBreakers.Execute(event.TargetRegion, func() error {
+		if p, ok := sink.(crossRegionPublisher); ok {
+			result, err := p.PublishCrossRegionEventResult(ctx, event.TargetRegion, event)
+			if result != nil {
+				publishedEventID = result.EventID
+			}
+			return err
+		}
+		return sink.Publish(ctx, awsutils.CrossRegionDetailType(event.TargetRegion), event)
+	})
+	return publishedEventID, err
+}
+
+// logOpenBreakers logs the state of every breaker in r while any of them
+// isn't closed. The router has no endpoint to inspect them, so this is where
+// an outage's breaker states show up.
+func logOpenBreakers(r *circuitbreaker.Registry) {
+	snapshot := r.Snapshot()
+	for _, state := range snapshot {
+		if state.State != wguevents.CircuitBreakerClosed {
+			logger.Warn("circuit breakers not closed", zap.Any("circuit_breakers", snapshot))
+			return
+		}
+	}
+}
+
+// regionRoutable reports whether region's circuit breaker lets a call through
+func regionRoutable(region string) bool {
+	return circuitBreakers.For(region).Allows()
+}
+
+// publishBuffered publishes an event held in the buffer, recording it as
+// published for reconciliation against the stream record it was buffered
+// for. Buffered events keep their source EventID.
+func publishBuffered(ctx context.Context, event *wguevents.CrossRegionEvent, eventSourceARN string) error {
+	publishedEventID, err := publishCrossRegion(ctx, event)
+	if err != nil {
+		return err
+	}
+	reconcile(ctx, event.EventID, eventSourceARN, publishedEventID, awsutils.ReconciliationPublished, nil)
 	return nil
 }
 
+// reconcile records the outcome of publishing the event for the stream record
+// sourceEventID when reconciliation is enabled. publishedEventID is the ID
+// EventBridge assigned, empty when nothing was published or the sink doesn't
+// report it. Write failures are logged but don't fail the record.
+func reconcile(ctx context.Context, sourceEventID, eventSourceARN, publishedEventID, status string, publishErr error) {
+	if reconciliation == nil {
+		return
+	}
+	
+	entry := awsutils.ReconciliationRecord{
+		SourceEventID:    sourceEventID,
+		PublishedEventID: publishedEventID,
+		EventSourceARN:   eventSourceARN,
+		Status:           status,
+	}
+	if publishErr != nil {
+		entry.Error = publishErr.Error()
+	}
+	if err := reconciliation.Write(ctx, entry); err != nil {
+		logger.Warn("failed to write reconciliation record",
+			zap.Error(err),
+			awsutils.ErrorField(err),
+			zap.String("event_id", sourceEventID),
+		)
+	}
+}
+
 func parseRecord(record events.DynamoDBEventRecord) (*wguevents.BaseEvent, error) {
 	// Convert DynamoDB attribute values to BaseEvent
-	payload := make(map[string]interface{})
-	
-	for key, value := range record.Change.NewImage {
-		payload[key] = value
+	image := streamImage(record)
+	var payload map[string]interface{}
+	if payloadFormat == payloadFormatTyped {
+		payload = make(map[string]interface{}, len(image))
+		for key, value := range image {
+			payload[key] = value
+		}
+	} else {
+		payload = awsutils.StreamImageToMap(image)
+		if payload == nil {
+			payload = make(map[string]interface{})
+		}
 	}
 	
 	event := wguevents.NewBaseEvent(
@@ -187,9 +656,55 @@ func parseRecord(record events.DynamoDBEventRecord) (*wguevents.BaseEvent, error
 	event.EventID = record.EventID
 	event.Metadata.SourceService = "dynamodb-streams"
 	
+	// Tenant-specific routes match on the item's tenant_id attribute
+	if tenant, ok := image["tenant_id"]; ok && tenant.DataType() == events.DataTypeString {
+		event.Metadata.TenantID = tenant.String()
+	}
+	
 	return event, nil
 }
 
+// applyUTF8Policy enforces utf8Policy on a record's payload before encoding it
+// replaces invalid sequences unseen. Typed payloads are checked as plain
+// values and left for the encoder to replace.
+func applyUTF8Policy(record events.DynamoDBEventRecord, event *wguevents.BaseEvent) error {
+	if payloadFormat == payloadFormatTyped {
+		return utf8Policy.Apply("event-router", awsutils.StreamImageToMap(streamImage(record)))
+	}
+	return utf8Policy.Apply("event-router", event.Payload)
+}
+
+// streamImage selects the attributes to route for a record based on its stream
+// view type: keys for KEYS_ONLY streams, the old image for removals on streams
+// that carry it, and the new image otherwise.
+func streamImage(record events.DynamoDBEventRecord) map[string]events.DynamoDBAttributeValue {
+	change := record.Change
+	
+	if change.StreamViewType == wguevents.StreamViewKeysOnly {
+		return change.Keys
+	}
+	
+	missing := wguevents.MissingStreamImages(
+		change.StreamViewType,
+		record.EventName,
+		len(change.NewImage) > 0,
+		len(change.OldImage) > 0,
+	)
+	if len(missing) > 0 {
+		logger.Warn("stream record is missing expected images",
+			zap.String("event_id", record.EventID),
+			zap.String("event_name", record.EventName),
+			zap.String("stream_view_type", change.StreamViewType),
+			zap.Strings("missing_images", missing),
+		)
+	}
+	
+	if record.EventName == "REMOVE" && len(change.NewImage) == 0 && len(change.OldImage) > 0 {
+		return change.OldImage
+	}
+	return change.NewImage
+}
+
 func compressEvent(event *wguevents.CrossRegionEvent) ([]byte, error) {
 	// Serialize event to JSON
 	jsonData, err := json.Marshal(event)
@@ -215,131 +730,190 @@ func compressEvent(event *wguevents.CrossRegionEvent) ([]byte, error) {
 	return compressed, nil
 }
 
-func sendToDLQ(ctx context.Context, event *wguevents.BaseEvent, processingError error) error {
+// deadLetterErrorType returns the DLQ error type for err. EventBridge rejecting
+// the event as invalid, or invalid UTF-8 in it, won't be fixed by a retry, so
+// it needs review.
+func deadLetterErrorType(err error) string {
+	if errors.Is(err, wguevents.ErrInvalidUTF8) || awsutils.ExtractErrorDetails(err).Code == "ValidationException" {
+		return wguevents.ErrorTypeValidationFailure
+	}
+	return wguevents.ErrorTypeRoutingFailure
+}
+
+// newDLQEvent wraps a failed event with its error and invocation diagnostics
+func newDLQEvent(ctx context.Context, event *wguevents.BaseEvent, processingError error, eventSourceARN string) (*wguevents.DeadLetterEvent, error) {
 	dlqEvent := &wguevents.DeadLetterEvent{
 		ErrorMessage:  processingError.Error(),
-		ErrorType:     "routing_failure",
+		ErrorType:     deadLetterErrorType(processingError),
 		FailureCount:  1,
 		FirstFailure:  time.Now(),
 		LastFailure:   time.Now(),
 		SourceHandler: "event-router",
 	}
+	awsutils.EnrichDeadLetterEvent(ctx, dlqEvent, currentRegion, eventSourceARN)
+	awsutils.AnnotateDeadLetterEvent(dlqEvent, processingError)
 	
 	originalJSON, err := json.Marshal(event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal original event: %w", err)
+		return nil, fmt.Errorf("failed to marshal original event: %w", err)
 	}
 	dlqEvent.OriginalEvent = originalJSON
 	
-	messageBody, err := json.Marshal(dlqEvent)
+	return dlqEvent, nil
+}
+
+// deadLetter queues a failed event for the DLQ; tests replace it
+var deadLetter = sendToDLQ
+
+func sendToDLQ(ctx context.Context, event *wguevents.BaseEvent, processingError error, eventSourceARN string) error {
+	dlqEvent, err := newDLQEvent(ctx, event, processingError, eventSourceARN)
 	if err != nil {
-		return fmt.Errorf("failed to marshal DLQ event: %w", err)
+		return err
 	}
 	
-	err = awsClients.SendToDeadLetterQueue(ctx, dlqURL, string(messageBody), processingError.Error())
+	return dlqBatcher.Add(ctx, dlqEvent)
+}
+
+// defaultBufferDrainLimit is the most buffered events an invocation drains
+const defaultBufferDrainLimit = 100
+
+// SpillQueue is the part of the SQS client used to buffer events
+type SpillQueue interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// EventBuffer holds events that could not be routed while their target
+// region's circuit is open. Each event is persisted to a dedicated SQS spill
+// queue before its stream record is acknowledged, so a buffered event
+// survives the container being recycled and nothing is held in memory. On a
+// FIFO queue events are grouped by target region, so each region drains in
+// order.
+type EventBuffer struct {
+	queue      SpillQueue
+	queueURL   string
+	fifo       bool
+	drainLimit int
+}
+
+// NewEventBuffer creates a buffer spilling to queueURL and draining up to
+// drainLimit events per call to Drain
+func NewEventBuffer(queue SpillQueue, queueURL string, drainLimit int) *EventBuffer {
+	if drainLimit <= 0 {
+		drainLimit = defaultBufferDrainLimit
+	}
+	return &EventBuffer{
+		queue:      queue,
+		queueURL:   queueURL,
+		fifo:       strings.HasSuffix(queueURL, ".fifo"),
+		drainLimit: drainLimit,
+	}
+}
+
+// spillSourceARNAttribute is the spilled message attribute carrying the ARN
+// of the stream the event's record came from
+const spillSourceARNAttribute = "EventSourceArn"
+
+// Add persists an event to the spill queue along with the ARN of the stream
+// its record came from
+func (b *EventBuffer) Add(ctx context.Context, event *wguevents.CrossRegionEvent, eventSourceARN string) error {
+	body, err := json.Marshal(event)
 	if err != nil {
-		return fmt.Errorf("failed to send to DLQ: %w", err)
+		return fmt.Errorf("failed to marshal spilled event: %w", err)
 	}
-	
-	metrics.DLQMessages.WithLabelValues("event-router", "routing_failure").Inc()
-	
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(b.queueURL),
+		MessageBody: aws.String(string(body)),
+	}
+	if eventSourceARN != "" {
+		input.MessageAttributes = map[string]sqstypes.MessageAttributeValue{
+			spillSourceARNAttribute: {DataType: aws.String("String"), StringValue: aws.String(eventSourceARN)},
+		}
+	}
+	if b.fifo {
+		input.MessageGroupId = aws.String(event.TargetRegion)
+		input.MessageDeduplicationId = aws.String(event.EventID)
+	}
+	if _, err := b.queue.SendMessage(ctx, input); err != nil {
+		return fmt.Errorf("failed to spill event: %w", err)
+	}
+
+	metrics.EventBufferSpilled.WithLabelValues("event-router").Inc()
 	return nil
 }
 
-// CircuitBreaker implements the circuit breaker pattern
-type CircuitBreaker struct {
-	maxFailures    int
-	timeout        time.Duration
-	state          string
-	failureCount   int
-	successCount   int
-	lastFailure    time.Time
-	lastStateChange time.Time
-	mu             sync.RWMutex
-}
-
-// NewCircuitBreaker creates a new circuit breaker
-func NewCircuitBreaker(maxFailures int, timeout time.Duration) *CircuitBreaker {
-	return &CircuitBreaker{
-		maxFailures:     maxFailures,
-		timeout:         timeout,
-		state:           wguevents.CircuitBreakerClosed,
-		lastStateChange: time.Now(),
-	}
-}
-
-// Execute runs the function through the circuit breaker
-func (cb *CircuitBreaker) Execute(fn func() error) error {
-	cb.mu.Lock()
-	defer cb.mu.Unlock()
-	
-	// Check if circuit is open
-	if cb.state == wguevents.CircuitBreakerOpen {
-		if time.Since(cb.lastStateChange) > cb.timeout {
-			// Transition to half-open
-			cb.state = wguevents.CircuitBreakerHalfOpen
-			cb.successCount = 0
-			cb.lastStateChange = time.Now()
-			metrics.SetCircuitBreakerState("cross-region", currentRegion, cb.state)
-			logger.Info("circuit breaker transitioning to half-open")
-		} else {
-			return fmt.Errorf("circuit breaker is open")
+// Drain receives buffered events oldest first and publishes those whose
+// target region ready accepts, deleting each from the spill queue once
+// published, until the queue is empty or the drain limit is reached. Events
+// for a region that isn't ready, or that already failed to publish during
+// this drain, are skipped and received again after the queue's visibility
+// timeout, so a region still down doesn't hold back the others. Returns the
+// number of events published.
+func (b *EventBuffer) Drain(ctx context.Context, ready func(region string) bool, publish func(ctx context.Context, event *wguevents.CrossRegionEvent, eventSourceARN string) error) (int, error) {
+	drained := 0
+	defer func() {
+		metrics.EventBufferDrained.WithLabelValues("event-router").Add(float64(drained))
+	}()
+
+	failed := make(map[string]bool)
+	var errs []error
+	for received := 0; received < b.drainLimit; {
+		output, err := b.queue.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(b.queueURL),
+			MaxNumberOfMessages:   int32(min(10, b.drainLimit-received)),
+			MessageAttributeNames: []string{spillSourceARNAttribute},
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to receive buffered events: %w", err))
+			break
 		}
-	}
-	
-	// Execute function
-	err := fn()
-	
-	if err != nil {
-		cb.failureCount++
-		cb.lastFailure = time.Now()
-		metrics.CircuitBreakerFailures.WithLabelValues("cross-region", currentRegion).Inc()
-		
-		if cb.state == wguevents.CircuitBreakerHalfOpen {
-			// Go back to open on any failure in half-open
-			cb.state = wguevents.CircuitBreakerOpen
-			cb.lastStateChange = time.Now()
-			metrics.SetCircuitBreakerState("cross-region", currentRegion, cb.state)
-			logger.Warn("circuit breaker opened",
-				zap.Int("failure_count", cb.failureCount),
-			)
-		} else if cb.failureCount >= cb.maxFailures {
-			// Open circuit
-			cb.state = wguevents.CircuitBreakerOpen
-			cb.lastStateChange = time.Now()
-			metrics.SetCircuitBreakerState("cross-region", currentRegion, cb.state)
-			logger.Warn("circuit breaker opened",
-				zap.Int("failure_count", cb.failureCount),
-			)
+		if len(output.Messages) == 0 {
+			break
 		}
-		
-		return err
-	}
-	
-	// Success
-	cb.successCount++
-	
-	if cb.state == wguevents.CircuitBreakerHalfOpen {
-		// After successful attempt in half-open, close circuit
-		if cb.successCount >= 2 {
-			cb.state = wguevents.CircuitBreakerClosed
-			cb.failureCount = 0
-			cb.lastStateChange = time.Now()
-			metrics.SetCircuitBreakerState("cross-region", currentRegion, cb.state)
-			logger.Info("circuit breaker closed")
+		received += len(output.Messages)
+
+		for _, message := range output.Messages {
+			var event wguevents.CrossRegionEvent
+			if err := json.Unmarshal([]byte(aws.ToString(message.Body)), &event); err != nil {
+				errs = append(errs, fmt.Errorf("failed to unmarshal buffered event: %w", err))
+				continue
+			}
+			if failed[event.TargetRegion] || !ready(event.TargetRegion) {
+				continue
+			}
+			eventSourceARN := aws.ToString(message.MessageAttributes[spillSourceARNAttribute].StringValue)
+			if err := publish(ctx, &event, eventSourceARN); err != nil {
+				failed[event.TargetRegion] = true
+				errs = append(errs, fmt.Errorf("failed to publish buffered event %s: %w", event.EventID, err))
+				continue
+			}
+			_, err := b.queue.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(b.queueURL),
+				ReceiptHandle: message.ReceiptHandle,
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete buffered event %s: %w", event.EventID, err))
+				continue
+			}
+			drained++
 		}
 	}
-	
-	return nil
+	return drained, errors.Join(errs...)
 }
 
-// GetState returns the current circuit breaker state
-func (cb *CircuitBreaker) GetState() string {
-	cb.mu.RLock()
-	defer cb.mu.RUnlock()
-	return cb.state
+// deadLetterPanic sends a record whose processing panicked to the DLQ; tests
+// replace it
+var deadLetterPanic = func(ctx context.Context, record events.DynamoDBEventRecord, panicErr *batch.PanicError) error {
+	return dlqRouter.SendPanic(ctx, logger, currentRegion, record, panicErr)
 }
 
 func main() {
+	// DLQ_REPLAY=true runs the function on the DLQ's messages instead of the stream
+	if os.Getenv("DLQ_REPLAY") == "true" {
+		lambda.Start(ReplayHandler)
+		return
+	}
 	lambda.Start(Handler)
 }
@@ -1,14 +1,34 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+	"github.com/wgu/go-performance-enablement/pkg/batch"
+	"github.com/wgu/go-performance-enablement/pkg/circuitbreaker"
 	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func init() {
@@ -20,212 +40,6 @@ func init() {
 	dlqURL = "https://sqs.us-west-2.amazonaws.com/123456789012/test-dlq"
 }
 
-func TestNewCircuitBreaker(t *testing.T) {
-	tests := []struct {
-		name        string
-		maxFailures int
-		timeout     time.Duration
-	}{
-		{
-			name:        "standard config",
-			maxFailures: 5,
-			timeout:     30 * time.Second,
-		},
-		{
-			name:        "aggressive config",
-			maxFailures: 3,
-			timeout:     10 * time.Second,
-		},
-		{
-			name:        "lenient config",
-			maxFailures: 10,
-			timeout:     60 * time.Second,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			cb := NewCircuitBreaker(tt.maxFailures, tt.timeout)
-			
-			assert.NotNil(t, cb)
-			assert.Equal(t, tt.maxFailures, cb.maxFailures)
-			assert.Equal(t, tt.timeout, cb.timeout)
-			assert.Equal(t, wguevents.CircuitBreakerClosed, cb.state)
-			assert.Equal(t, 0, cb.failureCount)
-			assert.Equal(t, 0, cb.successCount)
-		})
-	}
-}
-
-func TestCircuitBreaker_GetState(t *testing.T) {
-	cb := NewCircuitBreaker(5, 30*time.Second)
-	
-	state := cb.GetState()
-	assert.Equal(t, wguevents.CircuitBreakerClosed, state)
-}
-
-func TestCircuitBreaker_Execute_SuccessPath(t *testing.T) {
-	cb := NewCircuitBreaker(5, 30*time.Second)
-	
-	// Test successful execution
-	err := cb.Execute(func() error {
-		return nil
-	})
-	
-	assert.NoError(t, err)
-	assert.Equal(t, wguevents.CircuitBreakerClosed, cb.GetState())
-	assert.Equal(t, 0, cb.failureCount)
-	assert.Equal(t, 1, cb.successCount)
-}
-
-func TestCircuitBreaker_Execute_FailureAccumulation(t *testing.T) {
-	cb := NewCircuitBreaker(3, 30*time.Second)
-	
-	// Cause failures but not enough to open circuit
-	for i := 0; i < 2; i++ {
-		err := cb.Execute(func() error {
-			return assert.AnError
-		})
-		assert.Error(t, err)
-		assert.Equal(t, wguevents.CircuitBreakerClosed, cb.GetState())
-	}
-	
-	assert.Equal(t, 2, cb.failureCount)
-	
-	// One more failure should open the circuit
-	err := cb.Execute(func() error {
-		return assert.AnError
-	})
-	assert.Error(t, err)
-	assert.Equal(t, wguevents.CircuitBreakerOpen, cb.GetState())
-	assert.Equal(t, 3, cb.failureCount)
-}
-
-func TestCircuitBreaker_Execute_OpenCircuit(t *testing.T) {
-	cb := NewCircuitBreaker(2, 100*time.Millisecond)
-	
-	// Open the circuit
-	for i := 0; i < 2; i++ {
-		_ = cb.Execute(func() error {
-			return assert.AnError
-		})
-	}
-	
-	assert.Equal(t, wguevents.CircuitBreakerOpen, cb.GetState())
-	
-	// Circuit should reject calls when open
-	err := cb.Execute(func() error {
-		t.Error("Function should not be called when circuit is open")
-		return nil
-	})
-	
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "circuit breaker is open")
-}
-
-func TestCircuitBreaker_Execute_HalfOpenTransition(t *testing.T) {
-	cb := NewCircuitBreaker(2, 100*time.Millisecond)
-	
-	// Open the circuit
-	for i := 0; i < 2; i++ {
-		_ = cb.Execute(func() error {
-			return assert.AnError
-		})
-	}
-	
-	assert.Equal(t, wguevents.CircuitBreakerOpen, cb.GetState())
-	
-	// Wait for timeout
-	time.Sleep(150 * time.Millisecond)
-	
-	// Next call should transition to half-open
-	callCount := 0
-	err := cb.Execute(func() error {
-		callCount++
-		return nil
-	})
-	
-	assert.NoError(t, err)
-	assert.Equal(t, 1, callCount, "Function should be called once in half-open state")
-	assert.Equal(t, wguevents.CircuitBreakerHalfOpen, cb.GetState())
-}
-
-func TestCircuitBreaker_Execute_HalfOpenToClosedTransition(t *testing.T) {
-	cb := NewCircuitBreaker(2, 50*time.Millisecond)
-	
-	// Open the circuit
-	for i := 0; i < 2; i++ {
-		_ = cb.Execute(func() error {
-			return assert.AnError
-		})
-	}
-	
-	// Wait for timeout and transition to half-open
-	time.Sleep(100 * time.Millisecond)
-	
-	// First successful call in half-open
-	err := cb.Execute(func() error {
-		return nil
-	})
-	assert.NoError(t, err)
-	assert.Equal(t, wguevents.CircuitBreakerHalfOpen, cb.GetState())
-	
-	// Second successful call should close the circuit
-	err = cb.Execute(func() error {
-		return nil
-	})
-	assert.NoError(t, err)
-	assert.Equal(t, wguevents.CircuitBreakerClosed, cb.GetState())
-	assert.Equal(t, 0, cb.failureCount)
-}
-
-func TestCircuitBreaker_Execute_HalfOpenToOpenTransition(t *testing.T) {
-	cb := NewCircuitBreaker(2, 50*time.Millisecond)
-	
-	// Open the circuit
-	for i := 0; i < 2; i++ {
-		_ = cb.Execute(func() error {
-			return assert.AnError
-		})
-	}
-	
-	// Wait for timeout and transition to half-open
-	time.Sleep(100 * time.Millisecond)
-	
-	// Failure in half-open should immediately open circuit
-	err := cb.Execute(func() error {
-		return assert.AnError
-	})
-	
-	assert.Error(t, err)
-	assert.Equal(t, wguevents.CircuitBreakerOpen, cb.GetState())
-}
-
-func TestCircuitBreaker_Concurrency(t *testing.T) {
-	cb := NewCircuitBreaker(10, 30*time.Second)
-	
-	// Test that circuit breaker is thread-safe
-	done := make(chan bool, 10)
-	
-	for i := 0; i < 10; i++ {
-		go func() {
-			_ = cb.Execute(func() error {
-				time.Sleep(1 * time.Millisecond)
-				return nil
-			})
-			done <- true
-		}()
-	}
-	
-	// Wait for all goroutines
-	for i := 0; i < 10; i++ {
-		<-done
-	}
-	
-	assert.Equal(t, wguevents.CircuitBreakerClosed, cb.GetState())
-	assert.Equal(t, 10, cb.successCount)
-}
-
 func TestParseRecord(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -358,57 +172,6 @@ func TestSendToDLQ_EventCreation(t *testing.T) {
 	assert.Equal(t, 1, parsedDLQ.FailureCount)
 }
 
-func TestCircuitBreaker_StateTransitions(t *testing.T) {
-	// Test complete state machine: Closed -> Open -> Half-Open -> Closed
-	cb := NewCircuitBreaker(2, 50*time.Millisecond)
-	
-	// Initial state: Closed
-	assert.Equal(t, wguevents.CircuitBreakerClosed, cb.GetState())
-	
-	// Cause failures to open circuit
-	_ = cb.Execute(func() error { return assert.AnError })
-	assert.Equal(t, wguevents.CircuitBreakerClosed, cb.GetState()) // Still closed after 1 failure
-	
-	_ = cb.Execute(func() error { return assert.AnError })
-	assert.Equal(t, wguevents.CircuitBreakerOpen, cb.GetState()) // Now open after 2 failures
-	
-	// Try to execute while open (should fail immediately)
-	err := cb.Execute(func() error {
-		t.Error("Should not execute when circuit is open")
-		return nil
-	})
-	assert.Error(t, err)
-	assert.Equal(t, wguevents.CircuitBreakerOpen, cb.GetState())
-	
-	// Wait for timeout
-	time.Sleep(100 * time.Millisecond)
-	
-	// Execute should transition to half-open
-	_ = cb.Execute(func() error { return nil })
-	assert.Equal(t, wguevents.CircuitBreakerHalfOpen, cb.GetState())
-	
-	// Second success should close circuit
-	_ = cb.Execute(func() error { return nil })
-	assert.Equal(t, wguevents.CircuitBreakerClosed, cb.GetState())
-}
-
-func TestCircuitBreaker_ResetOnClose(t *testing.T) {
-	cb := NewCircuitBreaker(2, 50*time.Millisecond)
-	
-	// Open circuit
-	_ = cb.Execute(func() error { return assert.AnError })
-	_ = cb.Execute(func() error { return assert.AnError })
-	assert.Equal(t, 2, cb.failureCount)
-	
-	// Transition to half-open and then closed
-	time.Sleep(100 * time.Millisecond)
-	_ = cb.Execute(func() error { return nil })
-	_ = cb.Execute(func() error { return nil })
-	
-	assert.Equal(t, wguevents.CircuitBreakerClosed, cb.GetState())
-	assert.Equal(t, 0, cb.failureCount) // Should be reset
-}
-
 func TestParseRecord_MetadataPopulation(t *testing.T) {
 	record := events.DynamoDBEventRecord{
 		EventID:   "test-event-id",
@@ -431,3 +194,1096 @@ func TestParseRecord_MetadataPopulation(t *testing.T) {
 	assert.Equal(t, "dynamodb-streams", event.Metadata.SourceService)
 	assert.NotEmpty(t, event.Payload)
 }
+
+func TestParseRecord_StreamViewTypes(t *testing.T) {
+	keys := map[string]events.DynamoDBAttributeValue{
+		"id": events.NewStringAttribute("item-1"),
+	}
+	oldImage := map[string]events.DynamoDBAttributeValue{
+		"id":   events.NewStringAttribute("item-1"),
+		"name": events.NewStringAttribute("old"),
+	}
+
+	t.Run("keys only uses keys", func(t *testing.T) {
+		record := events.DynamoDBEventRecord{
+			EventID:   "keys-only",
+			EventName: "MODIFY",
+			Change: events.DynamoDBStreamRecord{
+				Keys:           keys,
+				StreamViewType: wguevents.StreamViewKeysOnly,
+			},
+		}
+
+		event, err := parseRecord(record)
+
+		assert.NoError(t, err)
+		assert.Len(t, event.Payload, 1)
+		assert.Contains(t, event.Payload, "id")
+	})
+
+	t.Run("remove uses old image", func(t *testing.T) {
+		record := events.DynamoDBEventRecord{
+			EventID:   "remove",
+			EventName: "REMOVE",
+			Change: events.DynamoDBStreamRecord{
+				Keys:           keys,
+				OldImage:       oldImage,
+				StreamViewType: wguevents.StreamViewNewAndOldImages,
+			},
+		}
+
+		event, err := parseRecord(record)
+
+		assert.NoError(t, err)
+		assert.Len(t, event.Payload, 2)
+		assert.Contains(t, event.Payload, "name")
+	})
+}
+
+func mixedTypeRecord() events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventID:   "mixed",
+		EventName: "INSERT",
+		Change: events.DynamoDBStreamRecord{
+			StreamViewType: wguevents.StreamViewNewImage,
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"id":       events.NewStringAttribute("order-1"),
+				"total":    events.NewNumberAttribute("129.95"),
+				"paid":     events.NewBooleanAttribute(true),
+				"coupon":   events.NewNullAttribute(),
+				"tags":     events.NewStringSetAttribute([]string{"gift", "express"}),
+				"quantity": events.NewListAttribute([]events.DynamoDBAttributeValue{events.NewNumberAttribute("2")}),
+				"address": events.NewMapAttribute(map[string]events.DynamoDBAttributeValue{
+					"city": events.NewStringAttribute("Salt Lake City"),
+					"zip":  events.NewStringAttribute("84101"),
+				}),
+			},
+		},
+	}
+}
+
+func TestParseRecord_PayloadFormats(t *testing.T) {
+	defer func(previous string) { payloadFormat = previous }(payloadFormat)
+
+	payloadFormat = payloadFormatSimple
+	simple, err := parseRecord(mixedTypeRecord())
+	require.NoError(t, err)
+	simpleJSON, err := json.Marshal(simple.Payload)
+	require.NoError(t, err)
+
+	payloadFormat = payloadFormatTyped
+	typed, err := parseRecord(mixedTypeRecord())
+	require.NoError(t, err)
+	typedJSON, err := json.Marshal(typed.Payload)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"id": "order-1",
+		"total": 129.95,
+		"paid": true,
+		"coupon": null,
+		"tags": ["gift", "express"],
+		"quantity": [2],
+		"address": {"city": "Salt Lake City", "zip": "84101"}
+	}`, string(simpleJSON))
+
+	var tagged map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(typedJSON, &tagged))
+	assert.Equal(t, "order-1", tagged["id"]["S"])
+	assert.Equal(t, "129.95", tagged["total"]["N"])
+	assert.Contains(t, tagged["address"], "M")
+
+	// Dropping the type descriptors shrinks the payload
+	assert.Less(t, len(simpleJSON), len(typedJSON))
+}
+
+func TestSendToDLQ_RoutesByErrorType(t *testing.T) {
+	originalBatcher := dlqBatcher
+	defer func() { dlqBatcher = originalBatcher }()
+
+	client := &mockSQS{}
+	dlqBatcher = awsutils.NewDeadLetterBatcher(client, awsutils.DeadLetterPolicy{
+		RetryQueueURL: dlqURL,
+		ErrorQueueURLs: map[string]string{
+			wguevents.ErrorTypeValidationFailure: "https://sqs.us-west-2.amazonaws.com/123456789012/review",
+			wguevents.ErrorTypeRoutingFailure:    "https://sqs.us-west-2.amazonaws.com/123456789012/retry",
+		},
+	}, "event-router")
+
+	event := &wguevents.BaseEvent{EventID: "test-event-123", EventType: "test.event"}
+	invalid := fmt.Errorf("publish: %w", &smithy.GenericAPIError{Code: "ValidationException", Message: "detail is not valid JSON"})
+	require.NoError(t, sendToDLQ(context.Background(), event, invalid, ""))
+	require.NoError(t, sendToDLQ(context.Background(), event, assert.AnError, ""))
+
+	// Events are sent on flush
+	assert.Empty(t, client.queues)
+	require.NoError(t, dlqBatcher.Flush(context.Background()))
+
+	sent := make(map[string]string)
+	for i, queueURL := range client.queues {
+		var dlqEvent wguevents.DeadLetterEvent
+		require.NoError(t, json.Unmarshal([]byte(client.bodies[i]), &dlqEvent))
+		sent[queueURL] = dlqEvent.ErrorType
+	}
+	assert.Equal(t, map[string]string{
+		"https://sqs.us-west-2.amazonaws.com/123456789012/review": wguevents.ErrorTypeValidationFailure,
+		"https://sqs.us-west-2.amazonaws.com/123456789012/retry":  wguevents.ErrorTypeRoutingFailure,
+	}, sent)
+}
+
+func TestHandler_FailsWhenDeadLettersArentSent(t *testing.T) {
+	originalBatcher := dlqBatcher
+	defer func() { dlqBatcher = originalBatcher }()
+
+	dlqBatcher = awsutils.NewDeadLetterBatcher(&mockSQS{}, awsutils.DeadLetterPolicy{RetryQueueURL: dlqURL}, "event-router")
+	assert.NoError(t, Handler(context.Background(), events.DynamoDBEvent{}))
+
+	dlqBatcher = awsutils.NewDeadLetterBatcher(&mockSQS{err: assert.AnError}, awsutils.DeadLetterPolicy{RetryQueueURL: dlqURL}, "event-router")
+	event := &wguevents.BaseEvent{EventID: "test-event-123", EventType: "test.event"}
+	require.NoError(t, sendToDLQ(context.Background(), event, assert.AnError, ""))
+
+	err := Handler(context.Background(), events.DynamoDBEvent{})
+	var batchErr *awsutils.DeadLetterBatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 0, dlqBatcher.Pending())
+}
+
+func TestNewDLQEvent_DiagnosticContext(t *testing.T) {
+	arn := "arn:aws:dynamodb:us-west-2:123456789012:table/events/stream/2024-01-01T00:00:00.000"
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID: "req-abc-123",
+	})
+
+	dlqEvent, err := newDLQEvent(ctx, &wguevents.BaseEvent{EventID: "test-event-123", EventType: "test.event"}, assert.AnError, arn)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "routing_failure", dlqEvent.ErrorType)
+	assert.Equal(t, "req-abc-123", dlqEvent.RequestID)
+	assert.Equal(t, currentRegion, dlqEvent.Region)
+	assert.Equal(t, arn, dlqEvent.EventSourceARN)
+	assert.NotEmpty(t, dlqEvent.OriginalEvent)
+}
+
+func TestNewDLQEvent_WithoutLambdaContext(t *testing.T) {
+	dlqEvent, err := newDLQEvent(context.Background(), &wguevents.BaseEvent{EventID: "test-event-123", EventType: "test.event"}, assert.AnError, "")
+
+	assert.NoError(t, err)
+	assert.Empty(t, dlqEvent.RequestID)
+	assert.Empty(t, dlqEvent.EventSourceARN)
+
+	body, err := json.Marshal(dlqEvent)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "request_id")
+}
+
+func TestProcessBatch_Concurrent(t *testing.T) {
+	originalWorkers := batchWorkers
+	batchWorkers = 10
+	defer func() { batchWorkers = originalWorkers }()
+
+	records := make([]events.DynamoDBEventRecord, 50)
+	for i := range records {
+		records[i] = events.DynamoDBEventRecord{
+			EventID:   fmt.Sprintf("event-%d", i),
+			EventName: "INSERT",
+			Change: events.DynamoDBStreamRecord{
+				Keys: map[string]events.DynamoDBAttributeValue{
+					"id": events.NewStringAttribute(fmt.Sprintf("item-%d", i%20)),
+				},
+			},
+		}
+	}
+
+	var mu sync.Mutex
+	processed := make(map[string]int)
+
+	errs := processBatch(context.Background(), records, func(ctx context.Context, record events.DynamoDBEventRecord) error {
+		mu.Lock()
+		processed[record.EventID]++
+		mu.Unlock()
+		if strings.HasSuffix(record.EventID, "7") {
+			return fmt.Errorf("failed %s", record.EventID)
+		}
+		return nil
+	})
+
+	assert.Len(t, errs, len(records))
+	assert.Len(t, processed, len(records))
+	for i, record := range records {
+		assert.Equal(t, 1, processed[record.EventID])
+		if strings.HasSuffix(record.EventID, "7") {
+			assert.EqualError(t, errs[i], "failed "+record.EventID)
+		} else {
+			assert.NoError(t, errs[i])
+		}
+	}
+}
+
+// mockSQS records DLQ message bodies and the queues they were sent to
+type mockSQS struct {
+	mu     sync.Mutex
+	bodies []string
+	queues []string
+	err    error
+}
+
+func (m *mockSQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.bodies = append(m.bodies, aws.ToString(params.MessageBody))
+	m.queues = append(m.queues, aws.ToString(params.QueueUrl))
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (m *mockSQS) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	output := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		m.bodies = append(m.bodies, aws.ToString(entry.MessageBody))
+		m.queues = append(m.queues, aws.ToString(params.QueueUrl))
+		output.Successful = append(output.Successful, sqstypes.SendMessageBatchResultEntry{Id: entry.Id})
+	}
+	return output, nil
+}
+
+// allRegionsReady lets Drain publish to every region
+func allRegionsReady(string) bool { return true }
+
+func bufferedEvent(id string) *wguevents.CrossRegionEvent {
+	return &wguevents.CrossRegionEvent{
+		BaseEvent:    wguevents.BaseEvent{EventID: id, EventType: "INSERT"},
+		TargetRegion: "us-east-1",
+	}
+}
+
+func TestProcessBatch_RecoversPanic(t *testing.T) {
+	originalWorkers, originalDeadLetterPanic := batchWorkers, deadLetterPanic
+	batchWorkers = 4
+	defer func() { batchWorkers, deadLetterPanic = originalWorkers, originalDeadLetterPanic }()
+
+	var mu sync.Mutex
+	deadLettered := make(map[string]*batch.PanicError)
+	deadLetterPanic = func(ctx context.Context, record events.DynamoDBEventRecord, panicErr *batch.PanicError) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deadLettered[record.EventID] = panicErr
+		return nil
+	}
+
+	records := make([]events.DynamoDBEventRecord, 6)
+	for i := range records {
+		records[i] = events.DynamoDBEventRecord{
+			EventID:   fmt.Sprintf("event-%d", i),
+			EventName: "INSERT",
+		}
+	}
+
+	var processed sync.Map
+	errs := processBatch(context.Background(), records, func(ctx context.Context, record events.DynamoDBEventRecord) error {
+		if record.EventID == "event-3" {
+			var payload map[string]interface{}
+			_ = payload["id"].(string)
+		}
+		processed.Store(record.EventID, true)
+		return nil
+	})
+
+	// The panicking record is dead-lettered, so the whole batch succeeds
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	for _, record := range records {
+		_, ok := processed.Load(record.EventID)
+		assert.Equal(t, record.EventID != "event-3", ok, record.EventID)
+	}
+	assert.Len(t, deadLettered, 1)
+	if panicErr := deadLettered["event-3"]; assert.NotNil(t, panicErr) {
+		assert.Contains(t, panicErr.Error(), "interface conversion")
+		assert.NotEmpty(t, panicErr.Stack)
+	}
+}
+
+func TestProcessBatch_PanicFailsRecordWhenDLQFails(t *testing.T) {
+	originalDeadLetterPanic := deadLetterPanic
+	defer func() { deadLetterPanic = originalDeadLetterPanic }()
+
+	deadLetterPanic = func(ctx context.Context, record events.DynamoDBEventRecord, panicErr *batch.PanicError) error {
+		return panicErr
+	}
+
+	records := []events.DynamoDBEventRecord{{EventID: "event-0"}, {EventID: "event-1"}}
+	errs := processBatch(context.Background(), records, func(ctx context.Context, record events.DynamoDBEventRecord) error {
+		if record.EventID == "event-1" {
+			panic("unexpected payload")
+		}
+		return nil
+	})
+
+	assert.NoError(t, errs[0])
+	assert.EqualError(t, errs[1], "panic: unexpected payload")
+}
+
+const (
+	testSpillURL  = "https://sqs.us-west-2.amazonaws.com/123456789012/spill"
+	testStreamARN = "arn:aws:dynamodb:us-west-2:123456789012:table/events/stream/2024-01-15T10:00:00.000"
+)
+
+// mockSpillQueue is an in-memory SQS queue. Received messages stay in flight
+// until deleted or returned by expireVisibility.
+type mockSpillQueue struct {
+	mu       sync.Mutex
+	messages []*spilledMessage
+	inputs   []*sqs.SendMessageInput
+	nextID   int
+	sendErr  error
+}
+
+type spilledMessage struct {
+	receipt    string
+	body       string
+	attributes map[string]sqstypes.MessageAttributeValue
+	inFlight   bool
+}
+
+func (q *mockSpillQueue) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.sendErr != nil {
+		return nil, q.sendErr
+	}
+	q.nextID++
+	q.inputs = append(q.inputs, params)
+	q.messages = append(q.messages, &spilledMessage{
+		receipt:    fmt.Sprintf("receipt-%d", q.nextID),
+		body:       aws.ToString(params.MessageBody),
+		attributes: params.MessageAttributes,
+	})
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (q *mockSpillQueue) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	output := &sqs.ReceiveMessageOutput{}
+	for _, message := range q.messages {
+		if len(output.Messages) == int(params.MaxNumberOfMessages) {
+			break
+		}
+		if !message.inFlight {
+			message.inFlight = true
+			received := sqstypes.Message{ReceiptHandle: aws.String(message.receipt), Body: aws.String(message.body)}
+			// Only the requested attributes are returned
+			for _, name := range params.MessageAttributeNames {
+				if value, ok := message.attributes[name]; ok {
+					if received.MessageAttributes == nil {
+						received.MessageAttributes = make(map[string]sqstypes.MessageAttributeValue)
+					}
+					received.MessageAttributes[name] = value
+				}
+			}
+			output.Messages = append(output.Messages, received)
+		}
+	}
+	return output, nil
+}
+
+func (q *mockSpillQueue) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, message := range q.messages {
+		if message.receipt == aws.ToString(params.ReceiptHandle) {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			break
+		}
+	}
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+// expireVisibility makes in-flight messages receivable again
+func (q *mockSpillQueue) expireVisibility() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, message := range q.messages {
+		message.inFlight = false
+	}
+}
+
+func (q *mockSpillQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+func TestEventBuffer_PersistsToSpillQueue(t *testing.T) {
+	queue := &mockSpillQueue{}
+	buf := NewEventBuffer(queue, testSpillURL, 0)
+
+	require.NoError(t, buf.Add(context.Background(), bufferedEvent("evt-0"), testStreamARN))
+
+	require.Len(t, queue.inputs, 1)
+	assert.Equal(t, testSpillURL, aws.ToString(queue.inputs[0].QueueUrl))
+	assert.Nil(t, queue.inputs[0].MessageGroupId)
+	assert.Equal(t, testStreamARN, aws.ToString(queue.inputs[0].MessageAttributes["EventSourceArn"].StringValue))
+
+	var spilled wguevents.CrossRegionEvent
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(queue.inputs[0].MessageBody)), &spilled))
+	assert.Equal(t, "evt-0", spilled.EventID)
+	assert.Equal(t, "us-east-1", spilled.TargetRegion)
+}
+
+func TestEventBuffer_GroupsFIFOQueueByRegion(t *testing.T) {
+	queue := &mockSpillQueue{}
+	buf := NewEventBuffer(queue, testSpillURL+".fifo", 0)
+
+	require.NoError(t, buf.Add(context.Background(), bufferedEvent("evt-0"), ""))
+
+	assert.Equal(t, "us-east-1", aws.ToString(queue.inputs[0].MessageGroupId))
+	assert.Equal(t, "evt-0", aws.ToString(queue.inputs[0].MessageDeduplicationId))
+}
+
+func TestEventBuffer_SpillFailure(t *testing.T) {
+	buf := NewEventBuffer(&mockSpillQueue{sendErr: fmt.Errorf("sqs unavailable")}, testSpillURL, 0)
+
+	assert.Error(t, buf.Add(context.Background(), bufferedEvent("evt-0"), ""))
+}
+
+func TestEventBuffer_DrainsInFIFOOrder(t *testing.T) {
+	queue := &mockSpillQueue{}
+	buf := NewEventBuffer(queue, testSpillURL, 0)
+	for i := 0; i < 12; i++ {
+		require.NoError(t, buf.Add(context.Background(), bufferedEvent(fmt.Sprintf("evt-%d", i)), ""))
+	}
+
+	var published []string
+	drained, err := buf.Drain(context.Background(), allRegionsReady, func(ctx context.Context, event *wguevents.CrossRegionEvent, eventSourceARN string) error {
+		published = append(published, event.EventID)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 12, drained)
+	assert.Equal(t, []string{"evt-0", "evt-1", "evt-2", "evt-3", "evt-4", "evt-5", "evt-6", "evt-7", "evt-8", "evt-9", "evt-10", "evt-11"}, published)
+	assert.Equal(t, 0, queue.len())
+}
+
+func TestEventBuffer_DrainLimit(t *testing.T) {
+	queue := &mockSpillQueue{}
+	buf := NewEventBuffer(queue, testSpillURL, 3)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, buf.Add(context.Background(), bufferedEvent(fmt.Sprintf("evt-%d", i)), ""))
+	}
+
+	drained, err := buf.Drain(context.Background(), allRegionsReady, func(ctx context.Context, event *wguevents.CrossRegionEvent, eventSourceARN string) error { return nil })
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, drained)
+	assert.Equal(t, 2, queue.len())
+}
+
+func TestEventBuffer_DrainSkipsOpenRegions(t *testing.T) {
+	queue := &mockSpillQueue{}
+	buf := NewEventBuffer(queue, testSpillURL, 0)
+	for i, region := range []string{"eu-west-1", "us-east-1", "eu-west-1", "us-east-2"} {
+		event := bufferedEvent(fmt.Sprintf("evt-%d", i))
+		event.TargetRegion = region
+		require.NoError(t, buf.Add(context.Background(), event, ""))
+	}
+
+	// eu-west-1 is still down and us-east-2 fails to publish
+	ready := func(region string) bool { return region != "eu-west-1" }
+	var published []string
+	drained, err := buf.Drain(context.Background(), ready, func(ctx context.Context, event *wguevents.CrossRegionEvent, eventSourceARN string) error {
+		if event.TargetRegion == "us-east-2" {
+			return fmt.Errorf("partner region unavailable")
+		}
+		published = append(published, event.EventID)
+		return nil
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, drained)
+	assert.Equal(t, []string{"evt-1"}, published)
+	assert.Equal(t, 3, queue.len())
+}
+
+func TestRegionRoutable(t *testing.T) {
+	original := circuitBreakers
+	circuitBreakers = circuitbreaker.NewGroup("cross-region-test", circuitbreaker.Policy{MaxFailures: 1, Timeout: time.Minute}, nil)
+	defer func() { circuitBreakers = original }()
+
+	_ = circuitBreakers.Execute("eu-west-1", func() error { return assert.AnError })
+
+	assert.False(t, regionRoutable("eu-west-1"))
+	assert.True(t, regionRoutable("us-east-1"))
+}
+
+func TestLogOpenBreakers(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	originalLogger := logger
+	logger = zap.New(core)
+	defer func() { logger = originalLogger }()
+
+	registry := circuitbreaker.NewRegistry()
+	closed := circuitbreaker.New("cross-region-test", "us-east-1", 1, time.Minute, nil)
+	registry.Register(closed)
+
+	logOpenBreakers(registry)
+	assert.Zero(t, logs.Len())
+
+	open := circuitbreaker.New("cross-region-test", "eu-west-1", 1, time.Minute, nil)
+	_ = open.Execute(func() error { return assert.AnError })
+	registry.Register(open)
+
+	logOpenBreakers(registry)
+	entries := logs.FilterMessage("circuit breakers not closed").All()
+	if assert.Len(t, entries, 1) {
+		snapshot, ok := entries[0].ContextMap()["circuit_breakers"].(map[string]wguevents.CircuitBreakerState)
+		if assert.True(t, ok) {
+			assert.Equal(t, wguevents.CircuitBreakerOpen, snapshot["cross-region-test/eu-west-1"].State)
+			assert.Equal(t, wguevents.CircuitBreakerClosed, snapshot["cross-region-test/us-east-1"].State)
+		}
+	}
+}
+
+func TestEventBuffer_DrainSkipsRegionAfterFailure(t *testing.T) {
+	queue := &mockSpillQueue{}
+	buf := NewEventBuffer(queue, testSpillURL, 0)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, buf.Add(context.Background(), bufferedEvent(fmt.Sprintf("evt-%d", i)), ""))
+	}
+
+	var published []string
+	drained, err := buf.Drain(context.Background(), allRegionsReady, func(ctx context.Context, event *wguevents.CrossRegionEvent, eventSourceARN string) error {
+		if event.EventID == "evt-1" {
+			return fmt.Errorf("partner region unavailable")
+		}
+		published = append(published, event.EventID)
+		return nil
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, drained)
+	// evt-2 targets the same region as the failure, so it waits behind it
+	assert.Equal(t, []string{"evt-0"}, published)
+	assert.Equal(t, 2, queue.len())
+
+	// Recovery resumes with the event that failed once it is visible again
+	queue.expireVisibility()
+	published = nil
+	_, err = buf.Drain(context.Background(), allRegionsReady, func(ctx context.Context, event *wguevents.CrossRegionEvent, eventSourceARN string) error {
+		published = append(published, event.EventID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"evt-1", "evt-2"}, published)
+	assert.Equal(t, 0, queue.len())
+}
+
+func TestIsStale(t *testing.T) {
+	maxAgePolicy = wguevents.MaxAgePolicy{"INSERT": time.Hour}
+	defer func() { maxAgePolicy = nil }()
+	metrics.StaleEventsDropped.Reset()
+
+	record := func(eventName string, age time.Duration) events.DynamoDBEventRecord {
+		return events.DynamoDBEventRecord{
+			EventID:   "event-" + eventName,
+			EventName: eventName,
+			Change: events.DynamoDBStreamRecord{
+				ApproximateCreationDateTime: events.SecondsEpochTime{Time: time.Now().Add(-age)},
+				Keys: map[string]events.DynamoDBAttributeValue{
+					"id": events.NewStringAttribute("item-123"),
+				},
+			},
+		}
+	}
+
+	// Fresh events and event types without a max age are processed
+	assert.False(t, isStale(record("INSERT", time.Minute)))
+	assert.False(t, isStale(record("MODIFY", 48*time.Hour)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.StaleEventsDropped.WithLabelValues("event-router", "INSERT")))
+
+	// An event older than its max age is dropped and metered without being applied
+	assert.NoError(t, processRecord(context.Background(), record("INSERT", 2*time.Hour)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.StaleEventsDropped.WithLabelValues("event-router", "INSERT")))
+}
+
+// failingEventBridge fails every PutEvents call and counts them
+type failingEventBridge struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *failingEventBridge) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return nil, fmt.Errorf("partner region unavailable")
+}
+
+func TestHandler_RetryBudgetCapsPublishAttempts(t *testing.T) {
+	client := &failingEventBridge{}
+	originalPublisher, originalBreakers, originalDeadLetter := publisher, circuitBreakers, deadLetter
+	defer func() {
+		publisher, circuitBreakers, deadLetter = originalPublisher, originalBreakers, originalDeadLetter
+		retryBudget = 0
+	}()
+
+	publisher = awsutils.NewEventBridgePublisher(client, eventBusName, "event-router")
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 100, Timeout: time.Minute}, logger)
+	retryBudget = 2
+
+	var mu sync.Mutex
+	var deadLettered []error
+	deadLetter = func(ctx context.Context, event *wguevents.BaseEvent, processingError error, eventSourceARN string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deadLettered = append(deadLettered, processingError)
+		return nil
+	}
+
+	var records []events.DynamoDBEventRecord
+	for i := 0; i < 5; i++ {
+		records = append(records, events.DynamoDBEventRecord{
+			EventID:   fmt.Sprintf("event-%d", i),
+			EventName: "INSERT",
+			Change: events.DynamoDBStreamRecord{
+				Keys: map[string]events.DynamoDBAttributeValue{
+					"id": events.NewStringAttribute(fmt.Sprintf("item-%d", i)),
+				},
+			},
+		})
+	}
+
+	err := Handler(context.Background(), events.DynamoDBEvent{Records: records})
+
+	assert.Error(t, err)
+	// One attempt plus the two budgeted retries; later records never publish
+	assert.Equal(t, 3, client.calls)
+	require.Len(t, deadLettered, 5)
+	for _, dlqErr := range deadLettered[1:] {
+		assert.ErrorIs(t, dlqErr, awsutils.ErrRetryBudgetExhausted)
+	}
+}
+
+// recordingSink records the detail types published to it
+type recordingSink struct {
+	mu          sync.Mutex
+	detailTypes []string
+}
+
+func (s *recordingSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.detailTypes = append(s.detailTypes, detailType)
+	return nil
+}
+
+func TestProcessRecord_SkipsNoOpModify(t *testing.T) {
+	originalPublisher, originalBreakers := publisher, circuitBreakers
+	defer func() { publisher, circuitBreakers = originalPublisher, originalBreakers }()
+	sink := &recordingSink{}
+	publisher = sink
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 5, Timeout: time.Minute}, logger)
+	skipped := testutil.ToFloat64(functionMetrics.NoOpSkipped)
+
+	record := func(newStatus string) events.DynamoDBEventRecord {
+		return events.DynamoDBEventRecord{
+			EventID:   "modify-" + newStatus,
+			EventName: "MODIFY",
+			Change: events.DynamoDBStreamRecord{
+				StreamViewType: wguevents.StreamViewNewAndOldImages,
+				Keys:           map[string]events.DynamoDBAttributeValue{"id": events.NewStringAttribute("item-1")},
+				OldImage: map[string]events.DynamoDBAttributeValue{
+					"id":     events.NewStringAttribute("item-1"),
+					"status": events.NewStringAttribute("active"),
+				},
+				NewImage: map[string]events.DynamoDBAttributeValue{
+					"id":     events.NewStringAttribute("item-1"),
+					"status": events.NewStringAttribute(newStatus),
+				},
+			},
+		}
+	}
+
+	// An identical before/after image is never routed cross-region
+	assert.NoError(t, processRecord(context.Background(), record("active")))
+	assert.Empty(t, sink.detailTypes)
+	assert.Equal(t, skipped+1, testutil.ToFloat64(metrics.NoOpSkipped.WithLabelValues("event-router")))
+
+	// A real change is routed
+	assert.NoError(t, processRecord(context.Background(), record("inactive")))
+	assert.Equal(t, []string{awsutils.CrossRegionDetailType(partnerRegion)}, sink.detailTypes)
+}
+
+// recordingReconciliationStore records the reconciliation records written to it
+type recordingReconciliationStore struct {
+	mu      sync.Mutex
+	records []awsutils.ReconciliationRecord
+}
+
+func (s *recordingReconciliationStore) PutItem(ctx context.Context, item interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, item.(awsutils.ReconciliationRecord))
+	return nil
+}
+
+func (s *recordingReconciliationStore) GetItem(ctx context.Context, key map[string]types.AttributeValue, result interface{}) error {
+	return awsutils.ErrItemNotFound
+}
+
+// failingSink fails every publish
+type failingSink struct{}
+
+func (failingSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	return fmt.Errorf("partner region unavailable")
+}
+
+func useReconciliation(t *testing.T) *recordingReconciliationStore {
+	original := reconciliation
+	t.Cleanup(func() { reconciliation = original })
+
+	store := &recordingReconciliationStore{}
+	reconciliation = awsutils.NewReconciliationLog(store, time.Hour)
+	return store
+}
+
+func insertRecord(eventID string) events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventID:        eventID,
+		EventName:      "INSERT",
+		EventSourceArn: "arn:aws:dynamodb:us-west-2:123456789012:table/events/stream/2024-01-15T10:00:00.000",
+		Change: events.DynamoDBStreamRecord{
+			Keys:     map[string]events.DynamoDBAttributeValue{"id": events.NewStringAttribute("item-1")},
+			NewImage: map[string]events.DynamoDBAttributeValue{"id": events.NewStringAttribute("item-1")},
+		},
+	}
+}
+
+// resultSink reports an EventBridge event ID for each cross-region event
+type resultSink struct {
+	mu        sync.Mutex
+	published []*wguevents.CrossRegionEvent
+}
+
+func (s *resultSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	_, err := s.PublishCrossRegionEventResult(ctx, "", detail)
+	return err
+}
+
+func (s *resultSink) PublishCrossRegionEventResult(ctx context.Context, targetRegion string, event interface{}) (*awsutils.PublishResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = append(s.published, event.(*wguevents.CrossRegionEvent))
+	return &awsutils.PublishResult{EventID: fmt.Sprintf("eb-event-%d", len(s.published))}, nil
+}
+
+func TestProcessRecord_ReconcilesPublishedEvent(t *testing.T) {
+	originalPublisher, originalBreakers := publisher, circuitBreakers
+	defer func() { publisher, circuitBreakers = originalPublisher, originalBreakers }()
+	publisher = &resultSink{}
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 5, Timeout: time.Minute}, logger)
+	store := useReconciliation(t)
+
+	record := insertRecord("stream-event-1")
+	require.NoError(t, processRecord(context.Background(), record))
+
+	require.Len(t, store.records, 1)
+	entry := store.records[0]
+	assert.Equal(t, "stream-event-1", entry.SourceEventID)
+	assert.Equal(t, "eb-event-1", entry.PublishedEventID)
+	assert.Equal(t, record.EventSourceArn, entry.EventSourceARN)
+	assert.Equal(t, awsutils.ReconciliationPublished, entry.Status)
+	assert.Empty(t, entry.Error)
+	assert.False(t, entry.Timestamp.IsZero())
+}
+
+// invalidUTF8Record returns an INSERT record whose name isn't valid UTF-8
+func invalidUTF8Record(eventID string) events.DynamoDBEventRecord {
+	record := insertRecord(eventID)
+	record.Change.NewImage["name"] = events.NewStringAttribute("caf\xe9")
+	return record
+}
+
+func TestApplyUTF8Policy_Replaces(t *testing.T) {
+	metrics.InvalidUTF8Events.Reset()
+	record := invalidUTF8Record("stream-event-5")
+
+	event, err := parseRecord(record)
+	require.NoError(t, err)
+	require.NoError(t, applyUTF8Policy(record, event))
+
+	assert.Equal(t, "caf\uFFFD", event.Payload["name"])
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.InvalidUTF8Events.WithLabelValues("event-router", "sanitized")))
+}
+
+func TestApplyUTF8Policy_ChecksTypedPayload(t *testing.T) {
+	defer func() { payloadFormat, utf8Policy = payloadFormatSimple, wguevents.UTF8Replace }()
+	payloadFormat = payloadFormatTyped
+	utf8Policy = wguevents.UTF8DeadLetter
+	record := invalidUTF8Record("stream-event-6")
+
+	event, err := parseRecord(record)
+	require.NoError(t, err)
+	assert.ErrorIs(t, applyUTF8Policy(record, event), wguevents.ErrInvalidUTF8)
+}
+
+func TestProcessRecord_InvalidUTF8DeadLettered(t *testing.T) {
+	originalPublisher, originalBreakers, originalDeadLetter := publisher, circuitBreakers, deadLetter
+	defer func() {
+		publisher, circuitBreakers, deadLetter = originalPublisher, originalBreakers, originalDeadLetter
+		utf8Policy = wguevents.UTF8Replace
+	}()
+	sink := &resultSink{}
+	publisher = sink
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 5, Timeout: time.Minute}, logger)
+	utf8Policy = wguevents.UTF8DeadLetter
+	metrics.InvalidUTF8Events.Reset()
+
+	var deadLettered []error
+	deadLetter = func(ctx context.Context, event *wguevents.BaseEvent, processingError error, eventSourceARN string) error {
+		deadLettered = append(deadLettered, processingError)
+		return nil
+	}
+
+	require.NoError(t, processRecord(context.Background(), invalidUTF8Record("stream-event-7")))
+
+	assert.Empty(t, sink.published)
+	require.Len(t, deadLettered, 1)
+	assert.ErrorIs(t, deadLettered[0], wguevents.ErrInvalidUTF8)
+	assert.Equal(t, wguevents.ErrorTypeValidationFailure, deadLetterErrorType(deadLettered[0]))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.InvalidUTF8Events.WithLabelValues("event-router", "dead_lettered")))
+}
+
+func TestPublishBuffered_ReconcilesWithSourceARN(t *testing.T) {
+	originalPublisher, originalBreakers := publisher, circuitBreakers
+	defer func() { publisher, circuitBreakers = originalPublisher, originalBreakers }()
+	publisher = &resultSink{}
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 5, Timeout: time.Minute}, logger)
+	store := useReconciliation(t)
+
+	buf := NewEventBuffer(&mockSpillQueue{}, testSpillURL, 0)
+	require.NoError(t, buf.Add(context.Background(), bufferedEvent("stream-event-4"), testStreamARN))
+
+	drained, err := buf.Drain(context.Background(), allRegionsReady, publishBuffered)
+	require.NoError(t, err)
+	assert.Equal(t, 1, drained)
+
+	require.Len(t, store.records, 1)
+	entry := store.records[0]
+	assert.Equal(t, "stream-event-4", entry.SourceEventID)
+	assert.Equal(t, "eb-event-1", entry.PublishedEventID)
+	assert.Equal(t, testStreamARN, entry.EventSourceARN)
+	assert.Equal(t, awsutils.ReconciliationPublished, entry.Status)
+}
+
+func TestProcessRecord_ReconcilesFailedPublish(t *testing.T) {
+	originalPublisher, originalBreakers, originalDeadLetter := publisher, circuitBreakers, deadLetter
+	defer func() { publisher, circuitBreakers, deadLetter = originalPublisher, originalBreakers, originalDeadLetter }()
+	publisher = failingSink{}
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 100, Timeout: time.Minute}, logger)
+	deadLetter = func(ctx context.Context, event *wguevents.BaseEvent, processingError error, eventSourceARN string) error {
+		return nil
+	}
+	store := useReconciliation(t)
+
+	err := processRecord(context.Background(), insertRecord("stream-event-2"))
+
+	assert.Error(t, err)
+	require.Len(t, store.records, 1)
+	entry := store.records[0]
+	assert.Equal(t, "stream-event-2", entry.SourceEventID)
+	assert.Equal(t, awsutils.ReconciliationFailed, entry.Status)
+	assert.Contains(t, entry.Error, "partner region unavailable")
+}
+
+func useRoutes(t *testing.T, table wguevents.RoutingTable, sinks map[string]awsutils.EventSink) {
+	originalRoutes, originalPublishers := routes, regionPublishers
+	t.Cleanup(func() { routes, regionPublishers = originalRoutes, originalPublishers })
+	routes = table
+	regionPublishers = sinks
+}
+
+func TestRouteRegion(t *testing.T) {
+	useRoutes(t, wguevents.RoutingTable{
+		"INSERT":      "eu-west-1",
+		"tenant:acme": "ap-southeast-2",
+	}, nil)
+
+	tests := []struct {
+		name      string
+		eventType string
+		tenantID  string
+		region    string
+	}{
+		{"mapped type", "INSERT", "", "eu-west-1"},
+		{"mapped tenant", "INSERT", "acme", "ap-southeast-2"},
+		{"unmapped type uses partner region", "REMOVE", "", partnerRegion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := wguevents.NewBaseEvent(tt.eventType, currentRegion, nil)
+			event.Metadata.TenantID = tt.tenantID
+			assert.Equal(t, tt.region, routeRegion(event))
+		})
+	}
+}
+
+func TestProcessRecord_RoutesToRegionPublisher(t *testing.T) {
+	originalPublisher, originalBreakers := publisher, circuitBreakers
+	defer func() { publisher, circuitBreakers = originalPublisher, originalBreakers }()
+	partnerSink, euSink, apSink := &recordingSink{}, &recordingSink{}, &recordingSink{}
+	publisher = partnerSink
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 5, Timeout: time.Minute}, logger)
+	useRoutes(t, wguevents.RoutingTable{
+		"INSERT":      "eu-west-1",
+		"tenant:acme": "ap-southeast-2",
+	}, map[string]awsutils.EventSink{
+		"eu-west-1":      euSink,
+		"ap-southeast-2": apSink,
+	})
+
+	// INSERTs go to their mapped region
+	require.NoError(t, processRecord(context.Background(), insertRecord("insert-1")))
+	assert.Equal(t, []string{awsutils.CrossRegionDetailType("eu-west-1")}, euSink.detailTypes)
+
+	// A tenant's route wins over its event type's, matched on tenant_id
+	tenantRecord := insertRecord("insert-2")
+	tenantRecord.Change.NewImage["tenant_id"] = events.NewStringAttribute("acme")
+	require.NoError(t, processRecord(context.Background(), tenantRecord))
+	assert.Equal(t, []string{awsutils.CrossRegionDetailType("ap-southeast-2")}, apSink.detailTypes)
+
+	// Unmapped types fall back to the partner region
+	removeRecord := insertRecord("remove-1")
+	removeRecord.EventName = "REMOVE"
+	require.NoError(t, processRecord(context.Background(), removeRecord))
+	assert.Equal(t, []string{awsutils.CrossRegionDetailType(partnerRegion)}, partnerSink.detailTypes)
+	assert.Len(t, euSink.detailTypes, 1)
+	assert.Len(t, apSink.detailTypes, 1)
+}
+
+func TestProcessRecord_BreakersArePerRegion(t *testing.T) {
+	originalPublisher, originalBreakers, originalDeadLetter := publisher, circuitBreakers, deadLetter
+	defer func() { publisher, circuitBreakers, deadLetter = originalPublisher, originalBreakers, originalDeadLetter }()
+	partnerSink := &recordingSink{}
+	publisher = partnerSink
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 2, Timeout: time.Minute}, logger)
+	metrics.CircuitBreakerFailures.Reset()
+	deadLetter = func(ctx context.Context, event *wguevents.BaseEvent, processingError error, eventSourceARN string) error {
+		return nil
+	}
+	// INSERTs go to a failing region; everything else to the partner region
+	useRoutes(t, wguevents.RoutingTable{"INSERT": "eu-west-1"}, map[string]awsutils.EventSink{
+		"eu-west-1": failingSink{},
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Error(t, processRecord(context.Background(), insertRecord(fmt.Sprintf("insert-%d", i))))
+	}
+	assert.Equal(t, wguevents.CircuitBreakerOpen, circuitBreakers.For("eu-west-1").GetState())
+
+	// The partner region keeps routing behind its own closed breaker
+	removeRecord := insertRecord("remove-1")
+	removeRecord.EventName = "REMOVE"
+	require.NoError(t, processRecord(context.Background(), removeRecord))
+	assert.Equal(t, []string{awsutils.CrossRegionDetailType(partnerRegion)}, partnerSink.detailTypes)
+	assert.Equal(t, wguevents.CircuitBreakerClosed, circuitBreakers.For(partnerRegion).GetState())
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.CircuitBreakerFailures.WithLabelValues("cross-region", "eu-west-1")))
+}
+
+// sizingSink records the serialized size of each published detail
+type sizingSink struct {
+	sizes []int
+}
+
+func (s *sizingSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+	s.sizes = append(s.sizes, len(data))
+	return nil
+}
+
+func TestProcessRecord_RecordsStreamRecordSize(t *testing.T) {
+	originalPublisher, originalBreakers := publisher, circuitBreakers
+	defer func() { publisher, circuitBreakers = originalPublisher, originalBreakers }()
+	sink := &sizingSink{}
+	publisher = sink
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 5, Timeout: time.Minute}, logger)
+	metrics.StreamRecordSize.Reset()
+
+	for i, size := range []int64{512, 2048} {
+		record := insertRecord(fmt.Sprintf("insert-%d", i))
+		record.Change.SizeBytes = size
+		require.NoError(t, processRecord(context.Background(), record))
+	}
+
+	histogram := func(stage string) *dto.Histogram {
+		metric := &dto.Metric{}
+		require.NoError(t, metrics.StreamRecordSize.WithLabelValues("events", stage).(prometheus.Histogram).Write(metric))
+		return metric.GetHistogram()
+	}
+
+	// Stream records are observed at the size DynamoDB reports
+	record := histogram(metrics.StreamSizeStageRecord)
+	assert.Equal(t, uint64(2), record.GetSampleCount())
+	assert.Equal(t, float64(2560), record.GetSampleSum())
+
+	// Routed events are observed at their serialized size after conversion
+	require.Len(t, sink.sizes, 2)
+	event := histogram(metrics.StreamSizeStageEvent)
+	assert.Equal(t, uint64(2), event.GetSampleCount())
+	assert.Equal(t, float64(sink.sizes[0]+sink.sizes[1]), event.GetSampleSum())
+}
+
+func TestReplayHandler_CountsRepeatFailures(t *testing.T) {
+	originalPublisher, originalBreakers, originalReplayer := publisher, circuitBreakers, dlqReplayer
+	defer func() { publisher, circuitBreakers, dlqReplayer = originalPublisher, originalBreakers, originalReplayer }()
+	publisher = failingSink{}
+	circuitBreakers = circuitbreaker.NewGroup("cross-region", circuitbreaker.Policy{MaxFailures: 100, Timeout: time.Minute}, logger)
+
+	queue := &mockSQS{}
+	permanentURL := "https://sqs.us-west-2.amazonaws.com/123456789012/permanent-failures"
+	dlqReplayer = awsutils.NewDeadLetterReplayer(awsutils.NewDeadLetterRouter(queue, awsutils.DeadLetterPolicy{
+		RetryQueueURL:     dlqURL,
+		PermanentQueueURL: permanentURL,
+		MaxFailures:       2,
+	}, "event-router"), logger)
+
+	// The event was dead-lettered once from the stream
+	baseEvent, err := parseRecord(insertRecord("stream-event-3"))
+	require.NoError(t, err)
+	dlqEvent, err := newDLQEvent(context.Background(), baseEvent, fmt.Errorf("partner region unavailable"), "")
+	require.NoError(t, err)
+	body, err := json.Marshal(dlqEvent)
+	require.NoError(t, err)
+
+	// Failing again on replay makes it the second failure, which is parked
+	response, err := ReplayHandler(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{MessageId: "msg-1", Body: string(body)}}})
+	require.NoError(t, err)
+	assert.Empty(t, response.BatchItemFailures)
+	require.Equal(t, []string{permanentURL}, queue.queues)
+
+	var parked wguevents.DeadLetterEvent
+	require.NoError(t, json.Unmarshal([]byte(queue.bodies[0]), &parked))
+	assert.Equal(t, 2, parked.FailureCount)
+	assert.JSONEq(t, string(dlqEvent.OriginalEvent), string(parked.OriginalEvent))
+
+	// Once the region recovers the event is routed
+	sink := &recordingSink{}
+	publisher = sink
+	response, err = ReplayHandler(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{MessageId: "msg-2", Body: queue.bodies[0]}}})
+	require.NoError(t, err)
+	assert.Empty(t, response.BatchItemFailures)
+	assert.Equal(t, []string{awsutils.CrossRegionDetailType(partnerRegion)}, sink.detailTypes)
+	assert.Len(t, queue.bodies, 1)
+}
@@ -3,38 +3,135 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/wgu/go-performance-enablement/pkg/awsutils"
 	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/logging"
 	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"github.com/wgu/go-performance-enablement/pkg/regions"
 	"go.uber.org/zap"
 )
 
 var (
 	logger        *zap.Logger
 	awsClients    *awsutils.AWSClients
-	publisher     *awsutils.EventBridgePublisher
+	publisher     awsutils.EventSink
 	currentRegion string
 	eventBusName  string
 	validator     *EventValidator
+	enricher      *CompositeEnricher
+	tenantQuota   TenantQuota = unlimitedQuota{}
+
+	// enrichmentBudget bounds how long enrichment may take in total
+	enrichmentBudget = defaultEnrichmentBudget
+
+	// enrichmentAllowlist holds the enrichment keys published with events;
+	// the rest stay internal
+	enrichmentAllowlist = defaultEnrichmentAllowlist()
+
+	// internalSources maps the EventBridge sources of our own services to the
+	// source_service given to their events when it is missing
+	internalSources = map[string]string{}
+
+	// newTraceID generates trace IDs for internal events without one; tests replace it
+	newTraceID = wguevents.NewTraceID
+
+	// eventTypes selects the event types transformed; the rest are skipped
+	eventTypes eventTypeFilter
+
+	// highPriorityThreshold is the priority from which events are published
+	// for the high-priority target; zero publishes every event as normal
+	highPriorityThreshold int
+)
+
+// Detail types of transformed events. Rules send high-priority events to
+// their own queue so consumers can drain them first.
+const (
+	detailTypeTransformed             = "event.transformed"
+	detailTypeTransformedHighPriority = "event.transformed.high_priority"
+)
+
+// defaultEnrichmentAllowlist publishes region metadata but keeps processing
+// metadata, which names the processor and its version, internal
+func defaultEnrichmentAllowlist() map[string]bool {
+	return map[string]bool{"region_metadata": true}
+}
+
+const (
+	// defaultEnrichmentTimeout bounds how long a single enrichment provider may run
+	defaultEnrichmentTimeout = 500 * time.Millisecond
+
+	// defaultEnrichmentBudget bounds how long all providers together may run
+	defaultEnrichmentBudget = time.Second
 )
 
+// Default bounds on how far ahead of the validator's clock an event timestamp
+// may be: within the allowed skew it is valid, up to the max skew it is a
+// warning, and beyond that an error
+const (
+	defaultAllowedFutureSkew = 5 * time.Minute
+	defaultMaxFutureSkew     = time.Hour
+)
+
+// errTenantQuotaExceeded is returned when a tenant's quota rejects an event, so
+// EventBridge retries it later instead of it being dropped
+var errTenantQuotaExceeded = errors.New("tenant quota exceeded")
+
+// TenantQuota decides whether an event from a tenant may be processed now. It
+// is the hook for per-tenant rate limits, keeping one noisy tenant from
+// starving the others.
+type TenantQuota interface {
+	Allow(ctx context.Context, tenantID string) bool
+}
+
+// TenantQuotaFunc adapts a function to TenantQuota
+type TenantQuotaFunc func(ctx context.Context, tenantID string) bool
+
+// Allow calls f(ctx, tenantID)
+func (f TenantQuotaFunc) Allow(ctx context.Context, tenantID string) bool {
+	return f(ctx, tenantID)
+}
+
+// unlimitedQuota allows every event
+type unlimitedQuota struct{}
+
+func (unlimitedQuota) Allow(ctx context.Context, tenantID string) bool {
+	return true
+}
+
 func init() {
 	var err error
 
-	// Initialize logger
-	logger, _ = zap.NewProduction()
+	// Initialize logger from LOG_LEVEL and LOG_FORMAT
+	logger, err = logging.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Get environment variables
 	currentRegion = os.Getenv("AWS_REGION")
 	eventBusName = os.Getenv("EVENT_BUS_NAME")
 
+	// Tenants outside the allowlist share the "other" metric label
+	metrics.SetTenantAllowlist(metrics.ParseTenantAllowlist(os.Getenv("TENANT_METRICS_ALLOWLIST")))
+
+	// Record per-event metrics for one in N events of high-volume types, e.g. "inventory.updated=100"
+	sampleRates, err := metrics.ParseEventSampleRates(os.Getenv("METRIC_SAMPLE_RATES"))
+	if err != nil {
+		logger.Fatal("invalid METRIC_SAMPLE_RATES", zap.Error(err))
+	}
+	metrics.SetEventSampleRates(sampleRates)
+
 	// Initialize AWS clients
 	ctx := context.Background()
 	awsClients, err = awsutils.NewAWSClients(ctx)
@@ -42,15 +139,75 @@ func init() {
 		logger.Fatal("failed to create AWS clients", zap.Error(err))
 	}
 
+	awsutils.ConfigureSlowCallWarnings(logger)
+
 	// Initialize EventBridge publisher
-	publisher = awsutils.NewEventBridgePublisher(
+	eventBridge := awsutils.NewEventBridgePublisher(
 		awsClients.EventBridge,
 		eventBusName,
 		"event-transformer",
 	)
+	eventBridge.SetWrapEnvelope(true)
+
+	// Publish through a global endpoint that fails over between regions, e.g. "abcde.veo"
+	eventBridge.SetGlobalEndpoint(os.Getenv("EVENT_BUS_ENDPOINT_ID"))
+
+	// Publish to EventBridge unless EVENT_SINK selects the file sink
+	publisher, err = awsutils.SelectEventSink(os.Getenv("EVENT_SINK"), os.Getenv("EVENT_SINK_PATH"), eventBridge, "event-transformer")
+	if err != nil {
+		logger.Fatal("failed to create event sink", zap.Error(err))
+	}
+
+	// Initialize enrichment providers
+	enricher = newDefaultEnricher(logger)
+
+	// Publish with whatever enrichment finished within ENRICHMENT_BUDGET, e.g. "750ms"
+	if value := os.Getenv("ENRICHMENT_BUDGET"); value != "" {
+		enrichmentBudget, err = time.ParseDuration(value)
+		if err != nil || enrichmentBudget <= 0 {
+			logger.Fatal("invalid ENRICHMENT_BUDGET", zap.String("value", value), zap.Error(err))
+		}
+	}
+
+	// Transform only EVENT_TYPE_ALLOWLIST types, if set, except those in
+	// EVENT_TYPE_DENYLIST, e.g. "order.placed,order.fulfilled"
+	eventTypes = parseEventTypeFilter(os.Getenv("EVENT_TYPE_ALLOWLIST"), os.Getenv("EVENT_TYPE_DENYLIST"))
+
+	// Publish events with priority of at least HIGH_PRIORITY_THRESHOLD, e.g.
+	// "8", as high priority
+	if value := os.Getenv("HIGH_PRIORITY_THRESHOLD"); value != "" {
+		highPriorityThreshold, err = strconv.Atoi(value)
+		if err != nil || highPriorityThreshold < 1 {
+			logger.Fatal("invalid HIGH_PRIORITY_THRESHOLD", zap.String("value", value), zap.Error(err))
+		}
+	}
+
+	// Fill in missing tracing metadata for events from our own services rather
+	// than reject them, e.g. "stream-processor,wgu.orders=order-service"
+	internalSources = parseInternalSources(os.Getenv("INTERNAL_EVENT_SOURCES"))
+
+	// Publish only these enrichment keys, e.g. "region_metadata,processing_metadata"
+	if value := os.Getenv("ENRICHMENT_ALLOWLIST"); value != "" {
+		enrichmentAllowlist = parseEnrichmentAllowlist(value)
+	}
 
 	// Initialize validator
 	validator = NewEventValidator()
+	if allowed := os.Getenv("ALLOWED_REGIONS"); allowed != "" {
+		validator.AllowRegions(strings.Split(allowed, ",")...)
+	}
+	mode, err := ParseStrictnessMode(os.Getenv("VALIDATION_MODE"))
+	if err != nil {
+		logger.Fatal("invalid VALIDATION_MODE", zap.Error(err))
+	}
+	validator.SetMode(mode)
+	
+	// Producer clocks may run ahead; e.g. TIMESTAMP_FUTURE_SKEW=10m, TIMESTAMP_MAX_FUTURE_SKEW=2h
+	allowedSkew, maxSkew, err := parseFutureSkew(os.Getenv("TIMESTAMP_FUTURE_SKEW"), os.Getenv("TIMESTAMP_MAX_FUTURE_SKEW"))
+	if err != nil {
+		logger.Fatal("invalid timestamp skew", zap.Error(err))
+	}
+	validator.SetFutureSkew(allowedSkew, maxSkew)
 }
 
 // Handler processes EventBridge events and transforms them
@@ -65,20 +222,57 @@ func Handler(ctx context.Context, event events.CloudWatchEvent) error {
 	)
 
 	// Parse the event
-	var baseEvent wguevents.BaseEvent
-	if err := json.Unmarshal(event.Detail, &baseEvent); err != nil {
+	baseEvent, err := parseBaseEvent(event.Detail)
+	if err != nil {
 		logger.Error("failed to parse event", zap.Error(err))
 		duration := time.Since(start)
 		metrics.RecordLambdaInvocation(functionName, currentRegion, duration, err)
 		return fmt.Errorf("failed to parse event: %w", err)
 	}
 
-	// Validate the event
-	validationErrors := validator.Validate(&baseEvent)
+	// Acknowledge event types this transformer doesn't handle without work
+	if !eventTypes.Accepts(baseEvent.EventType) {
+		logger.Debug("skipping event type",
+			zap.String("event_type", baseEvent.EventType),
+			zap.String("event_id", baseEvent.EventID),
+		)
+		recordEventStatus(functionName, baseEvent, "skipped")
+		metrics.RecordLambdaInvocation(functionName, currentRegion, time.Since(start), nil)
+		return nil
+	}
+
+	tenantID := baseEvent.Metadata.TenantID
+
+	// Check the tenant's quota before doing any work for it
+	if !tenantQuota.Allow(ctx, tenantID) {
+		logger.Warn("tenant quota exceeded",
+			zap.String("tenant_id", tenantID),
+			zap.String("event_id", baseEvent.EventID),
+		)
+		recordEventStatus(functionName, baseEvent, "throttled")
+		duration := time.Since(start)
+		metrics.RecordLambdaInvocation(functionName, currentRegion, duration, errTenantQuotaExceeded)
+		return fmt.Errorf("failed to process event for tenant %s: %w", tenantID, errTenantQuotaExceeded)
+	}
+
+	// Replays were counted and reported when they first went through
+	replay := baseEvent.Metadata.Replay
+
+	// Internal events may leave tracing to us; external ones must set it
+	populateTracing(event.Source, baseEvent)
+
+	// Validate the event. Warnings stay attached but don't make it invalid.
+	validationErrors := validator.Validate(baseEvent)
+	if !replay {
+		for _, validationErr := range validationErrors {
+			metrics.RecordValidationError(validationErr.Field, validationErr.Code)
+		}
+	}
+	invalid := hasBlockingErrors(validationErrors)
 
 	// Transform and enrich the event
 	transformedEvent := &wguevents.TransformedEvent{
-		BaseEvent:           baseEvent,
+		BaseEvent:           *baseEvent,
 		TransformationRules: []string{"validate", "enrich", "normalize"},
 		TransformedAt:       time.Now(),
 		ValidationErrors:    validationErrors,
@@ -93,38 +287,100 @@ func Handler(ctx context.Context, event events.CloudWatchEvent) error {
 	// Normalize data
 	normalizeEvent(transformedEvent)
 
-	// Publish transformed event
-	if len(validationErrors) == 0 {
-		if err := publisher.PublishEvent(ctx, "event.transformed", transformedEvent); err != nil {
-			logger.Error("failed to publish transformed event", zap.Error(err))
+	// Leave internal-only enrichment out of what consumers see
+	outboundEvent := externalEvent(transformedEvent)
+
+	// Strict mode keeps invalid events out of the main stream; the other
+	// modes publish them with their errors attached
+	if !invalid || validator.Mode() != StrictMode {
+		if invalid {
+			logger.Warn("event has validation errors, publishing anyway",
+				zap.Int("error_count", len(validationErrors)),
+				zap.String("validation_mode", string(validator.Mode())),
+			)
+		}
+		if err := publisher.Publish(ctx, transformedDetailType(baseEvent), outboundEvent); err != nil {
+			logger.Error("failed to publish transformed event", zap.Error(err), awsutils.ErrorField(err))
+			recordEventStatus(functionName, baseEvent, "error")
 			duration := time.Since(start)
 			metrics.RecordLambdaInvocation(functionName, currentRegion, duration, err)
 			return fmt.Errorf("failed to publish event: %w", err)
 		}
-	} else {
+	}
+
+	// The error stream notifies on invalid events, which a replay already did
+	if invalid && validator.Mode() != LenientMode && !replay {
 		logger.Warn("event has validation errors, publishing to error stream",
 			zap.Int("error_count", len(validationErrors)),
 		)
-		if err := publisher.PublishEvent(ctx, "event.validation_failed", transformedEvent); err != nil {
-			logger.Error("failed to publish validation failed event", zap.Error(err))
+		if err := publisher.Publish(ctx, "event.validation_failed", outboundEvent); err != nil {
+			logger.Error("failed to publish validation failed event", zap.Error(err), awsutils.ErrorField(err))
 		}
 	}
 
+	status := "success"
+	if invalid {
+		status = "invalid"
+	}
+	recordEventStatus(functionName, baseEvent, status)
+	if !replay {
+		metrics.RecordEventLatency(functionName, baseEvent.EventType, baseEvent.Timestamp)
+	}
+
 	duration := time.Since(start)
 	metrics.RecordLambdaInvocation(functionName, currentRegion, duration, nil)
 
 	logger.Info("successfully transformed event",
 		zap.Duration("duration", duration),
 		zap.Int("validation_errors", len(validationErrors)),
+		zap.Bool("replay", replay),
 	)
 
 	return nil
 }
 
+// recordEventStatus records an event's outcome, against the replay counters
+// for a replayed event so it doesn't count twice in the tenant metrics
+func recordEventStatus(functionName string, event *wguevents.BaseEvent, status string) {
+	if event.Metadata.Replay {
+		metrics.RecordReplayedEvent(functionName, event.EventType, status)
+		return
+	}
+	metrics.RecordTenantEvent(functionName, event.Metadata.TenantID, status)
+}
+
+// StrictnessMode controls what happens to an event that fails validation
+type StrictnessMode string
+
+const (
+	// StrictMode routes invalid events to the error stream instead of publishing them
+	StrictMode StrictnessMode = "strict"
+	// WarnMode publishes invalid events normally and also copies them to the error stream
+	WarnMode StrictnessMode = "warn"
+	// LenientMode publishes invalid events normally and only logs their errors
+	LenientMode StrictnessMode = "lenient"
+)
+
+// ParseStrictnessMode parses a mode name, case-insensitively. An empty name is StrictMode.
+func ParseStrictnessMode(name string) (StrictnessMode, error) {
+	switch mode := StrictnessMode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case "":
+		return StrictMode, nil
+	case StrictMode, WarnMode, LenientMode:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown validation mode %q", name)
+	}
+}
+
 // EventValidator validates events
 type EventValidator struct {
-	emailRegex *regexp.Regexp
-	uuidRegex  *regexp.Regexp
+	emailRegex        *regexp.Regexp
+	uuidRegex         *regexp.Regexp
+	allowedRegions    map[string]struct{}
+	mode              StrictnessMode
+	allowedFutureSkew time.Duration
+	maxFutureSkew     time.Duration
 }
 
 // NewEventValidator creates a new event validator
@@ -132,9 +388,52 @@ func NewEventValidator() *EventValidator {
 	return &EventValidator{
 		emailRegex: regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`),
 		uuidRegex:  regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`),
+		mode:       StrictMode,
+
+		allowedFutureSkew: defaultAllowedFutureSkew,
+		maxFutureSkew:     defaultMaxFutureSkew,
+	}
+}
+
+// SetFutureSkew sets how far in the future a timestamp may be. Timestamps
+// beyond allowed but within max get a warning; beyond max, an error.
+func (v *EventValidator) SetFutureSkew(allowed, max time.Duration) {
+	v.allowedFutureSkew = allowed
+	v.maxFutureSkew = max
+}
+
+// SetMode sets how invalid events are handled
+func (v *EventValidator) SetMode(mode StrictnessMode) {
+	v.mode = mode
+}
+
+// Mode returns how invalid events are handled
+func (v *EventValidator) Mode() StrictnessMode {
+	return v.mode
+}
+
+// AllowRegions accepts regions outside the known AWS commercial regions, such
+// as GovCloud or custom regions
+func (v *EventValidator) AllowRegions(regions ...string) {
+	if v.allowedRegions == nil {
+		v.allowedRegions = make(map[string]struct{})
+	}
+	for _, region := range regions {
+		if region = strings.TrimSpace(region); region != "" {
+			v.allowedRegions[region] = struct{}{}
+		}
 	}
 }
 
+// validRegion reports whether region is known or explicitly allowed
+func (v *EventValidator) validRegion(region string) bool {
+	if regions.IsKnown(region) {
+		return true
+	}
+	_, ok := v.allowedRegions[region]
+	return ok
+}
+
 // Validate validates an event and returns validation errors
 func (v *EventValidator) Validate(event *wguevents.BaseEvent) []wguevents.ValidationError {
 	var errors []wguevents.ValidationError
@@ -162,6 +461,12 @@ func (v *EventValidator) Validate(event *wguevents.BaseEvent) []wguevents.Valida
 			Message: "source_region is required",
 			Code:    "REQUIRED_FIELD",
 		})
+	} else if !v.validRegion(event.SourceRegion) {
+		errors = append(errors, wguevents.ValidationError{
+			Field:   "source_region",
+			Message: "source_region is not a known AWS region",
+			Code:    "INVALID_REGION",
+		})
 	}
 
 	// Validate timestamp
@@ -171,11 +476,19 @@ func (v *EventValidator) Validate(event *wguevents.BaseEvent) []wguevents.Valida
 			Message: "timestamp is required",
 			Code:    "REQUIRED_FIELD",
 		})
-	} else if event.Timestamp.After(time.Now().Add(5 * time.Minute)) {
+	} else if skew := time.Until(event.Timestamp); skew > v.maxFutureSkew {
 		errors = append(errors, wguevents.ValidationError{
-			Field:   "timestamp",
-			Message: "timestamp is in the future",
-			Code:    "INVALID_TIMESTAMP",
+			Field:    "timestamp",
+			Message:  "timestamp is in the future",
+			Code:     "INVALID_TIMESTAMP",
+			Severity: wguevents.SeverityError,
+		})
+	} else if skew > v.allowedFutureSkew {
+		errors = append(errors, wguevents.ValidationError{
+			Field:    "timestamp",
+			Message:  fmt.Sprintf("timestamp is %s ahead, likely clock skew", skew.Round(time.Second)),
+			Code:     "INVALID_TIMESTAMP",
+			Severity: wguevents.SeverityWarning,
 		})
 	}
 
@@ -210,33 +523,374 @@ func (v *EventValidator) Validate(event *wguevents.BaseEvent) []wguevents.Valida
 	return errors
 }
 
-// enrichEvent enriches the event with additional data
+// hasBlockingErrors reports whether any validation error is not a warning
+func hasBlockingErrors(validationErrors []wguevents.ValidationError) bool {
+	for _, validationErr := range validationErrors {
+		if !validationErr.IsWarning() {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFutureSkew parses the allowed and maximum future timestamp skew,
+// defaulting either when empty. The maximum may not be below the allowed skew.
+func parseFutureSkew(allowedSpec, maxSpec string) (time.Duration, time.Duration, error) {
+	allowed, max := defaultAllowedFutureSkew, defaultMaxFutureSkew
+	var err error
+	if allowedSpec != "" {
+		if allowed, err = time.ParseDuration(allowedSpec); err != nil || allowed < 0 {
+			return 0, 0, fmt.Errorf("invalid TIMESTAMP_FUTURE_SKEW %q", allowedSpec)
+		}
+	}
+	if maxSpec != "" {
+		if max, err = time.ParseDuration(maxSpec); err != nil || max < 0 {
+			return 0, 0, fmt.Errorf("invalid TIMESTAMP_MAX_FUTURE_SKEW %q", maxSpec)
+		}
+	}
+	if max < allowed {
+		return 0, 0, fmt.Errorf("TIMESTAMP_MAX_FUTURE_SKEW %s is below TIMESTAMP_FUTURE_SKEW %s", max, allowed)
+	}
+	return allowed, max, nil
+}
+
+// parseBaseEvent decodes an event detail that is either an envelope or, from
+// publishers that predate envelopes, a bare BaseEvent
+func parseBaseEvent(detail []byte) (*wguevents.BaseEvent, error) {
+	envelope, ok := wguevents.ParseEnvelope(detail)
+	if !ok {
+		var baseEvent wguevents.BaseEvent
+		if err := json.Unmarshal(detail, &baseEvent); err != nil {
+			return nil, err
+		}
+		return &baseEvent, nil
+	}
+
+	unwrapped, err := envelope.Unwrap()
+	if err != nil {
+		return nil, err
+	}
+
+	switch e := unwrapped.(type) {
+	case *wguevents.BaseEvent:
+		return e, nil
+	case *wguevents.CrossRegionEvent:
+		return &e.BaseEvent, nil
+	default:
+		return nil, fmt.Errorf("unsupported event kind for transformation: %s", envelope.EventKind)
+	}
+}
+
+// enrichEvent enriches the event with data from every registered provider.
+// Providers still running when enrichmentBudget runs out are abandoned and the
+// event keeps the data of those that finished.
 func enrichEvent(ctx context.Context, event *wguevents.TransformedEvent) error {
-	enrichmentData := make(map[string]interface{})
+	budgetCtx, cancel := context.WithTimeout(ctx, enrichmentBudget)
+	defer cancel()
+
+	enrichmentData, err := enricher.Enrich(budgetCtx, event)
+	event.EnrichmentData = enrichmentData
 
-	// Add geolocation data based on region
-	enrichmentData["region_metadata"] = map[string]interface{}{
-		"region":    event.SourceRegion,
-		"timezone":  getTimezoneForRegion(event.SourceRegion),
-		"data_center": getDataCenterForRegion(event.SourceRegion),
+	// Only count the budget running out, not the invocation's own deadline
+	if errors.Is(err, context.DeadlineExceeded) && budgetCtx.Err() != nil && ctx.Err() == nil {
+		metrics.EnrichmentTimeouts.WithLabelValues("event-transformer").Inc()
+		logger.Warn("enrichment budget exceeded",
+			zap.String("event_id", event.EventID),
+			zap.Duration("budget", enrichmentBudget),
+			zap.Int("keys_enriched", len(enrichmentData)),
+		)
 	}
+	return err
+}
+
+// EnrichmentProvider supplies enrichment data for an event. Each top-level key
+// of the returned map is merged into the event's EnrichmentData.
+type EnrichmentProvider interface {
+	Enrich(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error)
+}
+
+// EnrichmentProviderFunc adapts a function to EnrichmentProvider
+type EnrichmentProviderFunc func(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error)
+
+// Enrich calls f(ctx, event)
+func (f EnrichmentProviderFunc) Enrich(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+	return f(ctx, event)
+}
+
+// enrichmentSource is a provider registered with a CompositeEnricher
+type enrichmentSource struct {
+	name     string
+	provider EnrichmentProvider
+	timeout  time.Duration
+}
+
+// enrichmentResult is the outcome of a single provider
+type enrichmentResult struct {
+	data map[string]interface{}
+	err  error
+}
+
+// CompositeEnricher runs several enrichment providers concurrently with
+// best-effort semantics: a provider that fails or times out is logged and
+// skipped, and the others' data is still merged
+type CompositeEnricher struct {
+	sources []enrichmentSource
+	logger  *zap.Logger
+}
+
+// NewCompositeEnricher creates an enricher with no providers
+func NewCompositeEnricher(logger *zap.Logger) *CompositeEnricher {
+	return &CompositeEnricher{logger: logger}
+}
+
+// Add registers a provider under name with its own timeout. When providers
+// return the same key, the one added last wins.
+func (c *CompositeEnricher) Add(name string, provider EnrichmentProvider, timeout time.Duration) {
+	c.sources = append(c.sources, enrichmentSource{
+		name:     name,
+		provider: provider,
+		timeout:  timeout,
+	})
+}
+
+// Enrich runs every provider and merges their data. Each provider gets its own
+// copy of the event and a context that times out at its timeout, counted from
+// launch so the providers time out in parallel. The returned error joins the
+// failures of individual providers; the data is valid even when it is set.
+func (c *CompositeEnricher) Enrich(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+	providerCtxs := make([]context.Context, len(c.sources))
+	results := make([]chan enrichmentResult, len(c.sources))
+	for i, source := range c.sources {
+		providerCtx, cancel := context.WithTimeout(ctx, source.timeout)
+		defer cancel()
+		providerCtxs[i] = providerCtx
+		results[i] = make(chan enrichmentResult, 1)
+		go func(source enrichmentSource, event *wguevents.TransformedEvent, result chan<- enrichmentResult) {
+			data, err := source.provider.Enrich(providerCtx, event)
+			result <- enrichmentResult{data: data, err: err}
+		}(source, copyTransformedEvent(event), results[i])
+	}
+
+	merged := make(map[string]interface{})
+	var errs []error
+	for i, source := range c.sources {
+		result := c.await(ctx, providerCtxs[i], source, results[i])
+		if result.err != nil {
+			c.logger.Warn("enrichment provider failed",
+				zap.String("provider", source.name),
+				zap.Error(result.err),
+			)
+			errs = append(errs, fmt.Errorf("enrichment provider %s: %w", source.name, result.err))
+			continue
+		}
+		for key, value := range result.data {
+			merged[key] = value
+		}
+	}
+
+	return merged, errors.Join(errs...)
+}
+
+// await waits for a provider's result until providerCtx is done, even if the
+// provider ignores it. A provider still running is abandoned.
+func (c *CompositeEnricher) await(ctx, providerCtx context.Context, source enrichmentSource, result <-chan enrichmentResult) enrichmentResult {
+	select {
+	case r := <-result:
+		return r
+	case <-providerCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return enrichmentResult{err: err}
+		}
+		return enrichmentResult{err: fmt.Errorf("timed out after %s", source.timeout)}
+	}
+}
+
+// copyTransformedEvent copies an event for a provider, including its maps and
+// slices, so an abandoned provider can't change the event being returned
+func copyTransformedEvent(event *wguevents.TransformedEvent) *wguevents.TransformedEvent {
+	copied := *event
+	copied.Payload, _ = copyEnrichmentValue(event.Payload).(map[string]interface{})
+	copied.EnrichmentData, _ = copyEnrichmentValue(event.EnrichmentData).(map[string]interface{})
+	copied.TransformationRules = append([]string(nil), event.TransformationRules...)
+	copied.ValidationErrors = append([]wguevents.ValidationError(nil), event.ValidationErrors...)
+	return &copied
+}
 
-	// Add processing metadata
-	enrichmentData["processing_metadata"] = map[string]interface{}{
-		"processed_at": time.Now(),
-		"processor":    "event-transformer",
-		"version":      "1.0.0",
+// copyEnrichmentValue deep-copies the maps and slices of a decoded JSON value
+func copyEnrichmentValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyEnrichmentValue(item)
+		}
+		return copied
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyEnrichmentValue(item)
+		}
+		return copied
+	default:
+		return value
 	}
+}
+
+// newDefaultEnricher creates the enricher with the built-in providers
+func newDefaultEnricher(logger *zap.Logger) *CompositeEnricher {
+	e := NewCompositeEnricher(logger)
+	e.Add("region", EnrichmentProviderFunc(enrichRegionMetadata), defaultEnrichmentTimeout)
+	e.Add("processing", EnrichmentProviderFunc(enrichProcessingMetadata), defaultEnrichmentTimeout)
 
-	// Could fetch additional data from DynamoDB, external APIs, etc.
+	// Could add providers that fetch data from DynamoDB, external APIs, etc.
 	// For example:
 	// - Customer profile data
 	// - Product information
 	// - Historical context
 
-	event.EnrichmentData = enrichmentData
+	return e
+}
 
-	return nil
+// enrichRegionMetadata adds geolocation data based on region
+func enrichRegionMetadata(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"region_metadata": map[string]interface{}{
+			"region":      event.SourceRegion,
+			"timezone":    getTimezoneForRegion(event.SourceRegion),
+			"data_center": getDataCenterForRegion(event.SourceRegion),
+		},
+	}, nil
+}
+
+// enrichProcessingMetadata adds processing metadata
+func enrichProcessingMetadata(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"processing_metadata": map[string]interface{}{
+			"processed_at": time.Now(),
+			"processor":    "event-transformer",
+			"version":      "1.0.0",
+		},
+	}, nil
+}
+
+// parseInternalSources parses a comma-separated list of internal EventBridge
+// sources, each optionally followed by "=" and the source_service to default
+// its events to. A source alone defaults to its own name.
+func parseInternalSources(value string) map[string]string {
+	sources := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		source, service, ok := strings.Cut(entry, "=")
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		service = strings.TrimSpace(service)
+		if !ok || service == "" {
+			service = source
+		}
+		sources[source] = service
+	}
+	return sources
+}
+
+// populateTracing fills in a missing trace ID and source service on an event
+// from an internal source, reporting whether it changed the event. Events
+// from other sources are left for validation to reject.
+func populateTracing(source string, event *wguevents.BaseEvent) bool {
+	service, ok := internalSources[source]
+	if !ok {
+		return false
+	}
+
+	populated := false
+	if event.Metadata.TraceID == "" {
+		event.Metadata.TraceID = newTraceID()
+		populated = true
+	}
+	if event.Metadata.SourceService == "" {
+		event.Metadata.SourceService = service
+		populated = true
+	}
+	if populated {
+		logger.Debug("populated tracing metadata for internal event",
+			zap.String("event_id", event.EventID),
+			zap.String("source", source),
+			zap.String("trace_id", event.Metadata.TraceID),
+		)
+	}
+	return populated
+}
+
+// transformedDetailType returns the detail type to publish a transformed
+// event with, by its priority
+func transformedDetailType(event *wguevents.BaseEvent) string {
+	if highPriorityThreshold > 0 && event.Metadata.Priority >= highPriorityThreshold {
+		return detailTypeTransformedHighPriority
+	}
+	return detailTypeTransformed
+}
+
+// parseEnrichmentAllowlist splits a comma-separated list of enrichment keys
+func parseEnrichmentAllowlist(value string) map[string]bool {
+	allowlist := make(map[string]bool)
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			allowlist[key] = true
+		}
+	}
+	return allowlist
+}
+
+// eventTypeFilter selects event types by allowlist and denylist. An empty
+// allowlist allows every type; the denylist wins over it.
+type eventTypeFilter struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+// parseEventTypeFilter parses comma-separated allowed and denied event types
+func parseEventTypeFilter(allow, deny string) eventTypeFilter {
+	parse := func(value string) map[string]bool {
+		types := make(map[string]bool)
+		for _, eventType := range strings.Split(value, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				types[eventType] = true
+			}
+		}
+		return types
+	}
+	return eventTypeFilter{allow: parse(allow), deny: parse(deny)}
+}
+
+// Accepts reports whether events of eventType should be transformed
+func (f eventTypeFilter) Accepts(eventType string) bool {
+	if f.deny[eventType] {
+		return false
+	}
+	return len(f.allow) == 0 || f.allow[eventType]
+}
+
+// externalEvent returns a copy of event for publishing, with only the
+// enrichment keys in enrichmentAllowlist
+func externalEvent(event *wguevents.TransformedEvent) *wguevents.TransformedEvent {
+	external := *event
+	external.EnrichmentData = nil
+	for key, value := range event.EnrichmentData {
+		if !enrichmentAllowlist[key] {
+			continue
+		}
+		if external.EnrichmentData == nil {
+			external.EnrichmentData = make(map[string]interface{})
+		}
+		external.EnrichmentData[key] = value
+	}
+	return &external
 }
 
 // normalizeEvent normalizes event data
@@ -271,30 +925,16 @@ func normalizePhone(phone string) string {
 
 // getTimezoneForRegion returns timezone for AWS region
 func getTimezoneForRegion(region string) string {
-	timezones := map[string]string{
-		"us-west-2": "America/Los_Angeles",
-		"us-east-1": "America/New_York",
-		"eu-west-1": "Europe/Dublin",
-		"ap-southeast-1": "Asia/Singapore",
-	}
-
-	if tz, ok := timezones[region]; ok {
-		return tz
+	if md, ok := regions.Lookup(region); ok {
+		return md.Timezone
 	}
 	return "UTC"
 }
 
 // getDataCenterForRegion returns data center location for AWS region
 func getDataCenterForRegion(region string) string {
-	datacenters := map[string]string{
-		"us-west-2": "Oregon",
-		"us-east-1": "Virginia",
-		"eu-west-1": "Ireland",
-		"ap-southeast-1": "Singapore",
-	}
-
-	if dc, ok := datacenters[region]; ok {
-		return dc
+	if md, ok := regions.Lookup(region); ok {
+		return md.DataCenter
 	}
 	return "Unknown"
 }
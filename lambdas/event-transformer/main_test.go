@@ -2,12 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestNewEventValidator(t *testing.T) {
@@ -469,3 +477,701 @@ func TestEventValidator_ValidationErrorCodes(t *testing.T) {
 		}
 	}
 }
+
+func TestParseBaseEvent(t *testing.T) {
+	base := wguevents.NewBaseEvent("user.created", "us-west-2", map[string]interface{}{"id": "user-1"})
+
+	bare, err := json.Marshal(base)
+	assert.NoError(t, err)
+
+	wrappedBase, err := wguevents.Wrap(base)
+	assert.NoError(t, err)
+	enveloped, err := json.Marshal(wrappedBase)
+	assert.NoError(t, err)
+
+	wrappedCrossRegion, err := wguevents.Wrap(&wguevents.CrossRegionEvent{BaseEvent: *base, TargetRegion: "us-east-1"})
+	assert.NoError(t, err)
+	crossRegion, err := json.Marshal(wrappedCrossRegion)
+	assert.NoError(t, err)
+
+	for name, detail := range map[string][]byte{
+		"bare event":             bare,
+		"enveloped base":         enveloped,
+		"enveloped cross region": crossRegion,
+	} {
+		t.Run(name, func(t *testing.T) {
+			event, err := parseBaseEvent(detail)
+			assert.NoError(t, err)
+			assert.Equal(t, base.EventID, event.EventID)
+			assert.Equal(t, "user.created", event.EventType)
+		})
+	}
+}
+
+func TestParseBaseEvent_UnsupportedKind(t *testing.T) {
+	wrapped, err := wguevents.Wrap(&wguevents.HealthCheckEvent{Region: "us-west-2"})
+	assert.NoError(t, err)
+	detail, err := json.Marshal(wrapped)
+	assert.NoError(t, err)
+
+	_, err = parseBaseEvent(detail)
+	assert.Error(t, err)
+
+	_, err = parseBaseEvent([]byte(`{"schema_version":"1.0","event_kind":"mystery","data":{}}`))
+	assert.Error(t, err)
+}
+
+func TestHandler_TenantQuotaExceeded(t *testing.T) {
+	var checked []string
+	tenantQuota = TenantQuotaFunc(func(ctx context.Context, tenantID string) bool {
+		checked = append(checked, tenantID)
+		return tenantID != "noisy-tenant"
+	})
+	defer func() { tenantQuota = unlimitedQuota{} }()
+
+	metrics.SetTenantAllowlist([]string{"noisy-tenant"})
+	defer metrics.SetTenantAllowlist(nil)
+	metrics.TenantEventsProcessed.Reset()
+
+	base := wguevents.NewBaseEvent("user.created", "us-west-2", map[string]interface{}{"id": "user-1"})
+	base.Metadata.TenantID = "noisy-tenant"
+	detail, err := json.Marshal(base)
+	assert.NoError(t, err)
+
+	err = Handler(context.Background(), events.CloudWatchEvent{ID: "evt-1", Detail: detail})
+	assert.ErrorIs(t, err, errTenantQuotaExceeded)
+	assert.Equal(t, []string{"noisy-tenant"}, checked)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.TenantEventsProcessed.WithLabelValues("event-transformer", "noisy-tenant", "throttled")))
+}
+
+func TestUnlimitedQuota(t *testing.T) {
+	assert.True(t, unlimitedQuota{}.Allow(context.Background(), "any-tenant"))
+	assert.True(t, unlimitedQuota{}.Allow(context.Background(), ""))
+}
+
+func TestEventValidator_Validate_SourceRegion(t *testing.T) {
+	newEvent := func(region string) *wguevents.BaseEvent {
+		return &wguevents.BaseEvent{
+			EventID:      "test-event-123",
+			EventType:    "user.created",
+			SourceRegion: region,
+			Timestamp:    time.Now(),
+			Metadata: wguevents.EventMetadata{
+				SourceService: "user-service",
+				TraceID:       "trace-123",
+			},
+		}
+	}
+
+	validator := NewEventValidator()
+	validator.AllowRegions("us-gov-west-1", " local-dev ")
+
+	tests := []struct {
+		name    string
+		region  string
+		invalid bool
+	}{
+		{"known region", "us-west-2", false},
+		{"typo", "us-wst-2", true},
+		{"GovCloud not allowed by default", "us-gov-east-1", true},
+		{"allowed GovCloud region", "us-gov-west-1", false},
+		{"allowed custom region", "local-dev", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errors := validator.Validate(newEvent(tt.region))
+			if tt.invalid {
+				assert.Len(t, errors, 1)
+				assert.Equal(t, "source_region", errors[0].Field)
+				assert.Equal(t, "INVALID_REGION", errors[0].Code)
+			} else {
+				assert.Empty(t, errors)
+			}
+		})
+	}
+}
+
+func TestCompositeEnricher_IsolatesProviderFailures(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	e := NewCompositeEnricher(zap.New(core))
+	e.Add("profile", EnrichmentProviderFunc(func(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+		return map[string]interface{}{"customer_profile": map[string]interface{}{"tier": "gold"}}, nil
+	}), time.Second)
+	e.Add("product", EnrichmentProviderFunc(func(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+		return nil, errors.New("product service unavailable")
+	}), time.Second)
+
+	event := &wguevents.TransformedEvent{BaseEvent: wguevents.BaseEvent{SourceRegion: "us-west-2"}}
+	data, err := e.Enrich(context.Background(), event)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "enrichment provider product")
+	assert.Equal(t, map[string]interface{}{"tier": "gold"}, data["customer_profile"])
+	assert.Len(t, data, 1)
+
+	entries := logs.FilterMessage("enrichment provider failed").All()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "product", entries[0].ContextMap()["provider"])
+	}
+}
+
+func TestCompositeEnricher_ProviderTimeout(t *testing.T) {
+	e := NewCompositeEnricher(zap.NewNop())
+	e.Add("slow", EnrichmentProviderFunc(func(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+		// Ignores ctx on purpose
+		time.Sleep(300 * time.Millisecond)
+		return map[string]interface{}{"slow": true}, nil
+	}), 20*time.Millisecond)
+	e.Add("region", EnrichmentProviderFunc(enrichRegionMetadata), time.Second)
+
+	start := time.Now()
+	data, err := e.Enrich(context.Background(), &wguevents.TransformedEvent{BaseEvent: wguevents.BaseEvent{SourceRegion: "us-east-1"}})
+
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+	assert.NotContains(t, data, "slow")
+	assert.Contains(t, data, "region_metadata")
+}
+
+func TestCompositeEnricher_TimeoutsRunInParallel(t *testing.T) {
+	e := NewCompositeEnricher(zap.NewNop())
+	cancelled := make(chan string, 4)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		e.Add(name, EnrichmentProviderFunc(func(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+			<-ctx.Done()
+			cancelled <- name
+			return nil, ctx.Err()
+		}), 50*time.Millisecond)
+	}
+
+	start := time.Now()
+	_, err := e.Enrich(context.Background(), &wguevents.TransformedEvent{})
+
+	// One timeout, not four in a row
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+	for range 4 {
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("provider context not cancelled at its timeout")
+		}
+	}
+}
+
+func TestCompositeEnricher_AbandonedProviderCannotChangeEvent(t *testing.T) {
+	e := NewCompositeEnricher(zap.NewNop())
+	done := make(chan struct{})
+	e.Add("late", EnrichmentProviderFunc(func(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+		defer close(done)
+		<-ctx.Done()
+		event.Payload["order_id"] = "changed"
+		event.Payload["lines"].([]interface{})[0] = "changed"
+		event.EnrichmentData["late"] = true
+		return map[string]interface{}{"late": true}, nil
+	}), 10*time.Millisecond)
+
+	event := &wguevents.TransformedEvent{
+		BaseEvent: wguevents.BaseEvent{Payload: map[string]interface{}{
+			"order_id": "order-1",
+			"lines":    []interface{}{"line-1"},
+		}},
+		EnrichmentData: map[string]interface{}{},
+	}
+	data, err := e.Enrich(context.Background(), event)
+	<-done
+
+	assert.Error(t, err)
+	assert.NotContains(t, data, "late")
+	assert.Equal(t, "order-1", event.Payload["order_id"])
+	assert.Equal(t, []interface{}{"line-1"}, event.Payload["lines"])
+	assert.Empty(t, event.EnrichmentData)
+}
+
+func TestEnrichEvent_ContinuesAfterProviderFailure(t *testing.T) {
+	original := enricher
+	defer func() { enricher = original }()
+
+	enricher = newDefaultEnricher(zap.NewNop())
+	enricher.Add("failing", EnrichmentProviderFunc(func(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+		return nil, errors.New("boom")
+	}), time.Second)
+
+	event := &wguevents.TransformedEvent{BaseEvent: wguevents.BaseEvent{SourceRegion: "us-west-2"}}
+	err := enrichEvent(context.Background(), event)
+
+	assert.Error(t, err)
+	assert.Contains(t, event.EnrichmentData, "region_metadata")
+	assert.Contains(t, event.EnrichmentData, "processing_metadata")
+}
+
+func TestEnrichEvent_StopsAtBudget(t *testing.T) {
+	originalEnricher, originalBudget := enricher, enrichmentBudget
+	defer func() { enricher, enrichmentBudget = originalEnricher, originalBudget }()
+	metrics.EnrichmentTimeouts.Reset()
+
+	enrichmentBudget = 50 * time.Millisecond
+	enricher = newDefaultEnricher(zap.NewNop())
+	enricher.Add("blocking", EnrichmentProviderFunc(func(ctx context.Context, event *wguevents.TransformedEvent) (map[string]interface{}, error) {
+		// Ignores ctx on purpose, past both the budget and its own timeout
+		time.Sleep(500 * time.Millisecond)
+		return map[string]interface{}{"blocking": true}, nil
+	}), time.Second)
+
+	event := &wguevents.TransformedEvent{BaseEvent: wguevents.BaseEvent{SourceRegion: "us-west-2"}}
+	start := time.Now()
+	err := enrichEvent(context.Background(), event)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+	assert.Contains(t, event.EnrichmentData, "region_metadata")
+	assert.NotContains(t, event.EnrichmentData, "blocking")
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.EnrichmentTimeouts.WithLabelValues("event-transformer")))
+}
+
+func TestEnrichEvent_WithinBudget(t *testing.T) {
+	metrics.EnrichmentTimeouts.Reset()
+
+	event := &wguevents.TransformedEvent{BaseEvent: wguevents.BaseEvent{SourceRegion: "us-west-2"}}
+	err := enrichEvent(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.EnrichmentTimeouts))
+}
+
+// recordingSink captures published detail types
+type recordingSink struct {
+	detailTypes []string
+	details     []interface{}
+}
+
+func (r *recordingSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	r.detailTypes = append(r.detailTypes, detailType)
+	r.details = append(r.details, detail)
+	return nil
+}
+
+func TestParseStrictnessMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    StrictnessMode
+		wantErr bool
+	}{
+		{"", StrictMode, false},
+		{"strict", StrictMode, false},
+		{"Lenient", LenientMode, false},
+		{" warn ", WarnMode, false},
+		{"permissive", "", true},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			mode, err := ParseStrictnessMode(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, mode)
+		})
+	}
+}
+
+func TestHandler_ValidationStrictness(t *testing.T) {
+	originalPublisher, originalMode := publisher, validator.Mode()
+	defer func() {
+		publisher = originalPublisher
+		validator.SetMode(originalMode)
+	}()
+	
+	// Missing trace ID and source service make the event invalid
+	base := wguevents.NewBaseEvent("user.created", "us-west-2", map[string]interface{}{"id": "user-1"})
+	detail, err := json.Marshal(base)
+	assert.NoError(t, err)
+	
+	tests := []struct {
+		mode StrictnessMode
+		want []string
+	}{
+		{StrictMode, []string{"event.validation_failed"}},
+		{WarnMode, []string{"event.transformed", "event.validation_failed"}},
+		{LenientMode, []string{"event.transformed"}},
+	}
+	
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			sink := &recordingSink{}
+			publisher = sink
+			validator.SetMode(tt.mode)
+			
+			err := Handler(context.Background(), events.CloudWatchEvent{ID: "evt-1", Detail: detail})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, sink.detailTypes)
+			
+			transformed, ok := sink.details[0].(*wguevents.TransformedEvent)
+			assert.True(t, ok)
+			assert.NotEmpty(t, transformed.ValidationErrors, "validation errors should stay attached")
+		})
+	}
+}
+
+func TestHandler_RecordsValidationErrors(t *testing.T) {
+	originalPublisher := publisher
+	defer func() { publisher = originalPublisher }()
+	publisher = &recordingSink{}
+	metrics.ValidationErrors.Reset()
+
+	// Missing trace ID and source service are two distinct validation errors
+	base := wguevents.NewBaseEvent("user.created", "us-west-2", map[string]interface{}{"id": "user-1"})
+	detail, err := json.Marshal(base)
+	assert.NoError(t, err)
+
+	err = Handler(context.Background(), events.CloudWatchEvent{ID: "evt-1", Detail: detail})
+	assert.NoError(t, err)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ValidationErrors.WithLabelValues("metadata.source_service", "REQUIRED_FIELD")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ValidationErrors.WithLabelValues("metadata.trace_id", "REQUIRED_FIELD")))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.ValidationErrors))
+}
+
+func TestEventValidator_Validate_FutureSkew(t *testing.T) {
+	validator := NewEventValidator()
+
+	timestampErrors := func(ahead time.Duration) []wguevents.ValidationError {
+		var found []wguevents.ValidationError
+		for _, err := range validator.Validate(&wguevents.BaseEvent{
+			EventID:      "test-event-123",
+			EventType:    "user.created",
+			SourceRegion: "us-west-2",
+			Timestamp:    time.Now().Add(ahead),
+			Metadata: wguevents.EventMetadata{
+				SourceService: "user-service",
+				TraceID:       "trace-123",
+			},
+		}) {
+			if err.Field == "timestamp" {
+				found = append(found, err)
+			}
+		}
+		return found
+	}
+
+	// Within the allowed skew the timestamp is valid
+	assert.Empty(t, timestampErrors(2*time.Minute))
+
+	// Moderate skew is a warning that doesn't block the event
+	moderate := timestampErrors(20 * time.Minute)
+	assert.Len(t, moderate, 1)
+	assert.Equal(t, "INVALID_TIMESTAMP", moderate[0].Code)
+	assert.True(t, moderate[0].IsWarning())
+	assert.False(t, hasBlockingErrors(moderate))
+
+	// Egregiously future timestamps are still errors
+	egregious := timestampErrors(3 * time.Hour)
+	assert.Len(t, egregious, 1)
+	assert.Equal(t, wguevents.SeverityError, egregious[0].Severity)
+	assert.True(t, hasBlockingErrors(egregious))
+
+	// A wider allowed skew accepts the moderate timestamp outright
+	validator.SetFutureSkew(30*time.Minute, time.Hour)
+	assert.Empty(t, timestampErrors(20*time.Minute))
+}
+
+func TestParseFutureSkew(t *testing.T) {
+	allowed, max, err := parseFutureSkew("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultAllowedFutureSkew, allowed)
+	assert.Equal(t, defaultMaxFutureSkew, max)
+
+	allowed, max, err = parseFutureSkew("10m", "2h")
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, allowed)
+	assert.Equal(t, 2*time.Hour, max)
+
+	for _, spec := range [][2]string{{"soon", ""}, {"", "-1h"}, {"2h", "1h"}} {
+		_, _, err := parseFutureSkew(spec[0], spec[1])
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestHandler_SkewWarningPublishesEvent(t *testing.T) {
+	originalPublisher := publisher
+	defer func() { publisher = originalPublisher }()
+	sink := &recordingSink{}
+	publisher = sink
+
+	base := wguevents.NewBaseEvent("user.created", "us-west-2", map[string]interface{}{"id": "user-1"})
+	base.Timestamp = time.Now().Add(20 * time.Minute)
+	base.Metadata.SourceService = "user-service"
+	base.Metadata.TraceID = "trace-123"
+	detail, err := json.Marshal(base)
+	assert.NoError(t, err)
+
+	// Strict mode still publishes an event whose only problem is a warning
+	err = Handler(context.Background(), events.CloudWatchEvent{ID: "evt-1", Detail: detail})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"event.transformed"}, sink.detailTypes)
+
+	transformed := sink.details[0].(*wguevents.TransformedEvent)
+	assert.Len(t, transformed.ValidationErrors, 1)
+	assert.True(t, transformed.ValidationErrors[0].IsWarning())
+}
+
+func TestHandler_ReplayedEvent(t *testing.T) {
+	originalPublisher, originalMode := publisher, validator.Mode()
+	defer func() {
+		publisher = originalPublisher
+		validator.SetMode(originalMode)
+	}()
+	validator.SetMode(WarnMode)
+	metrics.ReplayedEventsProcessed.Reset()
+	metrics.TenantEventsProcessed.Reset()
+	metrics.ValidationErrors.Reset()
+
+	// Missing trace ID and source service make the event invalid
+	event := func(replay bool) events.CloudWatchEvent {
+		base := wguevents.NewBaseEvent("user.created", "us-west-2", map[string]interface{}{"id": "user-1"})
+		base.Metadata.Replay = replay
+		detail, err := json.Marshal(base)
+		require.NoError(t, err)
+		return events.CloudWatchEvent{ID: "evt-1", Detail: detail}
+	}
+
+	// A replay is transformed but doesn't notify the error stream again
+	sink := &recordingSink{}
+	publisher = sink
+	require.NoError(t, Handler(context.Background(), event(true)))
+	assert.Equal(t, []string{"event.transformed"}, sink.detailTypes)
+	assert.True(t, sink.details[0].(*wguevents.TransformedEvent).Metadata.Replay)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ReplayedEventsProcessed.WithLabelValues("event-transformer", "user.created", "invalid")))
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.TenantEventsProcessed))
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.ValidationErrors))
+
+	// The same event live notifies and counts as usual
+	sink = &recordingSink{}
+	publisher = sink
+	require.NoError(t, Handler(context.Background(), event(false)))
+	assert.Equal(t, []string{"event.transformed", "event.validation_failed"}, sink.detailTypes)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.TenantEventsProcessed.WithLabelValues("event-transformer", metrics.TenantLabelNone, "invalid")))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.ValidationErrors))
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.ReplayedEventsProcessed))
+}
+
+func TestHandler_EnrichmentAllowlist(t *testing.T) {
+	originalPublisher, originalAllowlist := publisher, enrichmentAllowlist
+	defer func() { publisher, enrichmentAllowlist = originalPublisher, originalAllowlist }()
+
+	base := wguevents.NewBaseEvent("user.created", "us-west-2", map[string]interface{}{"id": "user-1"})
+	base.Metadata.SourceService = "user-service"
+	base.Metadata.TraceID = "trace-123"
+	detail, err := json.Marshal(base)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		allowlist map[string]bool
+		published []string
+		stripped  []string
+	}{
+		{"default", defaultEnrichmentAllowlist(), []string{"region_metadata"}, []string{"processing_metadata"}},
+		{"custom", parseEnrichmentAllowlist(" processing_metadata, "), []string{"processing_metadata"}, []string{"region_metadata"}},
+		{"empty", map[string]bool{}, nil, []string{"region_metadata", "processing_metadata"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingSink{}
+			publisher = sink
+			enrichmentAllowlist = tt.allowlist
+
+			require.NoError(t, Handler(context.Background(), events.CloudWatchEvent{ID: "evt-1", Detail: detail}))
+			require.Len(t, sink.details, 1)
+
+			enrichment := sink.details[0].(*wguevents.TransformedEvent).EnrichmentData
+			for _, key := range tt.published {
+				assert.Contains(t, enrichment, key)
+			}
+			for _, key := range tt.stripped {
+				assert.NotContains(t, enrichment, key)
+			}
+		})
+	}
+}
+
+func TestExternalEvent_KeepsInternalEnrichment(t *testing.T) {
+	original := enrichmentAllowlist
+	defer func() { enrichmentAllowlist = original }()
+	enrichmentAllowlist = defaultEnrichmentAllowlist()
+
+	event := &wguevents.TransformedEvent{EnrichmentData: map[string]interface{}{
+		"region_metadata":     map[string]interface{}{"region": "us-west-2"},
+		"processing_metadata": map[string]interface{}{"processor": "event-transformer"},
+	}}
+
+	external := externalEvent(event)
+
+	assert.Equal(t, map[string]interface{}{
+		"region_metadata": map[string]interface{}{"region": "us-west-2"},
+	}, external.EnrichmentData)
+	// The internal copy still has everything
+	assert.Len(t, event.EnrichmentData, 2)
+}
+
+func TestParseInternalSources(t *testing.T) {
+	sources := parseInternalSources(" stream-processor, wgu.orders = order-service ,,wgu.users=")
+
+	assert.Equal(t, map[string]string{
+		"stream-processor": "stream-processor",
+		"wgu.orders":       "order-service",
+		"wgu.users":        "wgu.users",
+	}, sources)
+	assert.Empty(t, parseInternalSources(""))
+}
+
+func TestHandler_PopulatesTracingForInternalSources(t *testing.T) {
+	originalPublisher, originalSources, originalTraceID := publisher, internalSources, newTraceID
+	defer func() { publisher, internalSources, newTraceID = originalPublisher, originalSources, originalTraceID }()
+	internalSources = parseInternalSources("wgu.orders=order-service")
+	newTraceID = func() string { return "generated-trace" }
+
+	// No trace ID or source service
+	base := wguevents.NewBaseEvent("order.created", "us-west-2", map[string]interface{}{"id": "order-1"})
+	detail, err := json.Marshal(base)
+	require.NoError(t, err)
+
+	t.Run("internal", func(t *testing.T) {
+		sink := &recordingSink{}
+		publisher = sink
+
+		require.NoError(t, Handler(context.Background(), events.CloudWatchEvent{ID: "evt-1", Source: "wgu.orders", Detail: detail}))
+
+		assert.Equal(t, []string{"event.transformed"}, sink.detailTypes)
+		transformed := sink.details[0].(*wguevents.TransformedEvent)
+		assert.Empty(t, transformed.ValidationErrors)
+		assert.Equal(t, "generated-trace", transformed.Metadata.TraceID)
+		assert.Equal(t, "order-service", transformed.Metadata.SourceService)
+	})
+
+	t.Run("external", func(t *testing.T) {
+		sink := &recordingSink{}
+		publisher = sink
+
+		require.NoError(t, Handler(context.Background(), events.CloudWatchEvent{ID: "evt-2", Source: "partner.orders", Detail: detail}))
+
+		require.NotEmpty(t, sink.details)
+		transformed := sink.details[0].(*wguevents.TransformedEvent)
+		assert.Empty(t, transformed.Metadata.TraceID)
+		fields := make([]string, 0, len(transformed.ValidationErrors))
+		for _, validationErr := range transformed.ValidationErrors {
+			fields = append(fields, validationErr.Field)
+		}
+		assert.Contains(t, fields, "metadata.trace_id")
+		assert.Contains(t, fields, "metadata.source_service")
+	})
+}
+
+func TestPopulateTracing_KeepsExistingValues(t *testing.T) {
+	originalSources := internalSources
+	defer func() { internalSources = originalSources }()
+	internalSources = parseInternalSources("stream-processor")
+
+	event := wguevents.NewBaseEvent("user.created", "us-west-2", nil)
+	event.Metadata.TraceID = "trace-123"
+	event.Metadata.SourceService = "user-service"
+
+	assert.False(t, populateTracing("stream-processor", event))
+	assert.Equal(t, "trace-123", event.Metadata.TraceID)
+	assert.Equal(t, "user-service", event.Metadata.SourceService)
+}
+
+func TestHandler_RoutesHighPriorityEvents(t *testing.T) {
+	originalPublisher, originalThreshold := publisher, highPriorityThreshold
+	defer func() { publisher, highPriorityThreshold = originalPublisher, originalThreshold }()
+	highPriorityThreshold = 8
+
+	event := func(priority int) events.CloudWatchEvent {
+		base := wguevents.NewBaseEvent("order.placed", "us-west-2", map[string]interface{}{"id": "order-1"})
+		base.Metadata.SourceService = "order-service"
+		base.Metadata.TraceID = "trace-123"
+		base.Metadata.Priority = priority
+		detail, err := json.Marshal(base)
+		require.NoError(t, err)
+		return events.CloudWatchEvent{ID: "evt-1", Detail: detail}
+	}
+
+	sink := &recordingSink{}
+	publisher = sink
+	for _, priority := range []int{0, 7, 8, 10} {
+		require.NoError(t, Handler(context.Background(), event(priority)))
+	}
+
+	assert.Equal(t, []string{
+		detailTypeTransformed,
+		detailTypeTransformed,
+		detailTypeTransformedHighPriority,
+		detailTypeTransformedHighPriority,
+	}, sink.detailTypes)
+	assert.Equal(t, 10, sink.details[3].(*wguevents.TransformedEvent).Metadata.Priority)
+}
+
+func TestTransformedDetailType_DisabledByDefault(t *testing.T) {
+	originalThreshold := highPriorityThreshold
+	defer func() { highPriorityThreshold = originalThreshold }()
+	highPriorityThreshold = 0
+
+	event := &wguevents.BaseEvent{Metadata: wguevents.EventMetadata{Priority: 100}}
+	assert.Equal(t, detailTypeTransformed, transformedDetailType(event))
+}
+
+func TestHandler_EventTypeAllowlist(t *testing.T) {
+	originalPublisher, originalTypes := publisher, eventTypes
+	defer func() { publisher, eventTypes = originalPublisher, originalTypes }()
+	metrics.TenantEventsProcessed.Reset()
+	metrics.ValidationErrors.Reset()
+
+	event := func(eventType string, valid bool) events.CloudWatchEvent {
+		base := wguevents.NewBaseEvent(eventType, "us-west-2", map[string]interface{}{"id": "1"})
+		if valid {
+			base.Metadata.SourceService = "order-service"
+			base.Metadata.TraceID = "trace-123"
+		}
+		detail, err := json.Marshal(base)
+		require.NoError(t, err)
+		return events.CloudWatchEvent{ID: "evt-1", Detail: detail}
+	}
+
+	sink := &recordingSink{}
+	publisher = sink
+	eventTypes = parseEventTypeFilter("order.placed, order.fulfilled", "")
+
+	// An allowlisted type is transformed
+	require.NoError(t, Handler(context.Background(), event("order.placed", true)))
+	assert.Equal(t, []string{"event.transformed"}, sink.detailTypes)
+
+	// Another type is acknowledged without being validated or published
+	require.NoError(t, Handler(context.Background(), event("inventory.updated", false)))
+	assert.Len(t, sink.detailTypes, 1)
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.ValidationErrors))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.TenantEventsProcessed.WithLabelValues("event-transformer", metrics.TenantLabelNone, "skipped")))
+
+	// An empty allowlist processes everything
+	eventTypes = parseEventTypeFilter("", "")
+	require.NoError(t, Handler(context.Background(), event("inventory.updated", true)))
+	assert.Equal(t, []string{"event.transformed", "event.transformed"}, sink.detailTypes)
+}
+
+func TestEventTypeFilter(t *testing.T) {
+	all := parseEventTypeFilter("", "")
+	assert.True(t, all.Accepts("order.placed"))
+
+	denied := parseEventTypeFilter("", "health.check,")
+	assert.False(t, denied.Accepts("health.check"))
+	assert.True(t, denied.Accepts("order.placed"))
+
+	// The denylist wins over the allowlist
+	both := parseEventTypeFilter("order.placed,order.cancelled", "order.cancelled")
+	assert.True(t, both.Accepts("order.placed"))
+	assert.False(t, both.Accepts("order.cancelled"))
+	assert.False(t, both.Accepts("user.created"))
+}
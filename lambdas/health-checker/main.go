@@ -4,12 +4,21 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/wgu/go-performance-enablement/pkg/awsutils"
 	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/logging"
 	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"go.uber.org/zap"
 )
@@ -18,22 +27,64 @@ var (
 	logger         *zap.Logger
 	awsClients     *awsutils.AWSClients
 	partnerClients *awsutils.AWSClients
-	publisher      *awsutils.EventBridgePublisher
+	publisher      awsutils.EventSink
 	currentRegion  string
 	partnerRegion  string
 	eventBusName   string
+
+	// nonCriticalDependencies names dependencies whose failure only degrades
+	// the service. Every other dependency is critical.
+	nonCriticalDependencies map[string]bool
+
+	// Resources probed by full checks; an empty name skips its probe
+	healthTableName       string
+	healthQueueName       string
+	queueBacklogThreshold int
+
+	// maintenance overrides the published status during planned maintenance
+	maintenance maintenanceWindow
+)
+
+// Check types a HealthCheckRequest can ask for
+const (
+	checkTypeQuick = "quick"
+	checkTypeFull  = "full"
 )
 
+const defaultQueueBacklogThreshold = 1000
+
 func init() {
 	var err error
 
-	// Initialize logger
-	logger, _ = zap.NewProduction()
+	// Initialize logger from LOG_LEVEL and LOG_FORMAT
+	logger, err = logging.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Get environment variables
 	currentRegion = os.Getenv("AWS_REGION")
 	partnerRegion = os.Getenv("PARTNER_REGION")
 	eventBusName = os.Getenv("EVENT_BUS_NAME")
+	
+	// e.g. NON_CRITICAL_DEPENDENCIES=sqs,cache
+	nonCriticalDependencies = parseDependencyNames(os.Getenv("NON_CRITICAL_DEPENDENCIES"))
+
+	// Full checks describe HEALTH_TABLE_NAME and watch HEALTH_QUEUE_NAME's backlog
+	healthTableName = os.Getenv("HEALTH_TABLE_NAME")
+	healthQueueName = os.Getenv("HEALTH_QUEUE_NAME")
+	queueBacklogThreshold = defaultQueueBacklogThreshold
+	if n, err := strconv.Atoi(os.Getenv("HEALTH_QUEUE_BACKLOG_THRESHOLD")); err == nil && n > 0 {
+		queueBacklogThreshold = n
+	}
+
+	// Report MAINTENANCE_STATUS (default "maintenance") instead of the checked
+	// status until MAINTENANCE_UNTIL, e.g. "2024-06-01T06:00:00Z"
+	maintenance, err = parseMaintenanceWindow(os.Getenv("MAINTENANCE_UNTIL"), os.Getenv("MAINTENANCE_STATUS"))
+	if err != nil {
+		logger.Fatal("invalid MAINTENANCE_UNTIL", zap.Error(err))
+	}
 
 	// Initialize AWS clients for current region
 	ctx := context.Background()
@@ -42,6 +93,8 @@ func init() {
 		logger.Fatal("failed to create AWS clients", zap.Error(err))
 	}
 
+	awsutils.ConfigureSlowCallWarnings(logger)
+
 	// Initialize AWS clients for partner region
 	partnerClients, err = awsutils.NewAWSClientsWithRegion(ctx, partnerRegion)
 	if err != nil {
@@ -49,11 +102,18 @@ func init() {
 	}
 
 	// Initialize EventBridge publisher
-	publisher = awsutils.NewEventBridgePublisher(
+	eventBridge := awsutils.NewEventBridgePublisher(
 		awsClients.EventBridge,
 		eventBusName,
 		"health-checker",
 	)
+	eventBridge.SetWrapEnvelope(true)
+
+	// EVENT_SINK=file writes health events to EVENT_SINK_PATH instead
+	publisher, err = awsutils.SelectEventSink(os.Getenv("EVENT_SINK"), os.Getenv("EVENT_SINK_PATH"), eventBridge, "health-checker")
+	if err != nil {
+		logger.Fatal("failed to create event sink", zap.Error(err))
+	}
 }
 
 // HealthCheckRequest represents a scheduled health check request
@@ -61,13 +121,23 @@ type HealthCheckRequest struct {
 	CheckType string `json:"check_type"` // full, quick
 }
 
+// normalizeCheckType returns the check type to run, treating anything other
+// than a full check as quick
+func normalizeCheckType(checkType string) string {
+	if strings.EqualFold(strings.TrimSpace(checkType), checkTypeFull) {
+		return checkTypeFull
+	}
+	return checkTypeQuick
+}
+
 // Handler performs health checks across regions
 func Handler(ctx context.Context, request HealthCheckRequest) error {
 	start := time.Now()
 	functionName := "health-checker"
+	checkType := normalizeCheckType(request.CheckType)
 
 	logger.Info("starting health check",
-		zap.String("check_type", request.CheckType),
+		zap.String("check_type", checkType),
 		zap.String("current_region", currentRegion),
 		zap.String("partner_region", partnerRegion),
 	)
@@ -81,7 +151,7 @@ func Handler(ctx context.Context, request HealthCheckRequest) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		health, err := checkRegionHealth(ctx, currentRegion, awsClients)
+		health, err := checkRegionHealth(ctx, currentRegion, awsClients, checkType)
 		if err != nil {
 			errors <- fmt.Errorf("failed to check current region: %w", err)
 			return
@@ -93,7 +163,7 @@ func Handler(ctx context.Context, request HealthCheckRequest) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		health, err := checkRegionHealth(ctx, partnerRegion, partnerClients)
+		health, err := checkRegionHealth(ctx, partnerRegion, partnerClients, checkType)
 		if err != nil {
 			errors <- fmt.Errorf("failed to check partner region: %w", err)
 			return
@@ -121,10 +191,17 @@ func Handler(ctx context.Context, request HealthCheckRequest) error {
 
 	// Aggregate health status
 	aggregatedHealth := aggregateHealth(results)
+	if maintenance.apply(aggregatedHealth, time.Now()) {
+		logger.Info("reporting maintenance status",
+			zap.String("status", aggregatedHealth.Status),
+			zap.String("underlying_status", aggregatedHealth.UnderlyingStatus),
+			zap.Time("until", maintenance.until),
+		)
+	}
 
 	// Publish health check results
-	if err := publisher.PublishEvent(ctx, wguevents.EventTypeHealthCheck, aggregatedHealth); err != nil {
-		logger.Error("failed to publish health check", zap.Error(err))
+	if err := publisher.Publish(ctx, wguevents.EventTypeHealthCheck, aggregatedHealth); err != nil {
+		logger.Error("failed to publish health check", zap.Error(err), awsutils.ErrorField(err))
 	}
 
 	// Log summary
@@ -145,9 +222,49 @@ func Handler(ctx context.Context, request HealthCheckRequest) error {
 	return nil
 }
 
+// dependencyProbe checks one dependency of a region. run reports false when
+// the probe doesn't apply, such as when its resource isn't configured.
+type dependencyProbe struct {
+	label string
+	run   func(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool)
+}
+
+// shallowProbes run on every check: cheap list calls showing each service is
+// reachable. deepProbes add resource checks and run on full checks only.
+var (
+	shallowProbes = []dependencyProbe{
+		{"DynamoDB", always(checkDynamoDB)},
+		{"EventBridge", always(checkEventBridge)},
+		{"SQS", always(checkSQS)},
+	}
+	deepProbes = []dependencyProbe{
+		{"DynamoDB table", checkTableStatus},
+		{"SQS backlog", checkQueueBacklog},
+		{"EventBridge bus", checkEventBus},
+		{"Cross-region", checkCrossRegionLatency},
+	}
+)
+
+// always adapts a check that applies to every region into a probe
+func always(check func(ctx context.Context, clients *awsutils.AWSClients) wguevents.DependencyCheck) func(context.Context, string, *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+	return func(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+		return check(ctx, clients), true
+	}
+}
+
+// probesFor returns the probes to run for checkType
+func probesFor(checkType string) []dependencyProbe {
+	if checkType != checkTypeFull {
+		return shallowProbes
+	}
+	probes := make([]dependencyProbe, 0, len(shallowProbes)+len(deepProbes))
+	probes = append(probes, shallowProbes...)
+	return append(probes, deepProbes...)
+}
+
 // checkRegionHealth performs health checks for a specific region
-func checkRegionHealth(ctx context.Context, region string, clients *awsutils.AWSClients) (*wguevents.HealthCheckEvent, error) {
-	logger.Info("checking region health", zap.String("region", region))
+func checkRegionHealth(ctx context.Context, region string, clients *awsutils.AWSClients, checkType string) (*wguevents.HealthCheckEvent, error) {
+	logger.Info("checking region health", zap.String("region", region), zap.String("check_type", checkType))
 
 	health := &wguevents.HealthCheckEvent{
 		Region:    region,
@@ -161,44 +278,22 @@ func checkRegionHealth(ctx context.Context, region string, clients *awsutils.AWS
 	var mu sync.Mutex
 	errorMessages := []string{}
 
-	// Check DynamoDB
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		dep := checkDynamoDB(ctx, clients)
-		mu.Lock()
-		health.Dependencies = append(health.Dependencies, dep)
-		if dep.Status != wguevents.StatusHealthy {
-			errorMessages = append(errorMessages, fmt.Sprintf("DynamoDB: %s", dep.Status))
-		}
-		mu.Unlock()
-	}()
-
-	// Check EventBridge
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		dep := checkEventBridge(ctx, clients)
-		mu.Lock()
-		health.Dependencies = append(health.Dependencies, dep)
-		if dep.Status != wguevents.StatusHealthy {
-			errorMessages = append(errorMessages, fmt.Sprintf("EventBridge: %s", dep.Status))
-		}
-		mu.Unlock()
-	}()
-
-	// Check SQS
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		dep := checkSQS(ctx, clients)
-		mu.Lock()
-		health.Dependencies = append(health.Dependencies, dep)
-		if dep.Status != wguevents.StatusHealthy {
-			errorMessages = append(errorMessages, fmt.Sprintf("SQS: %s", dep.Status))
-		}
-		mu.Unlock()
-	}()
+	for _, probe := range probesFor(checkType) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dep, ok := probe.run(ctx, region, clients)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			health.Dependencies = append(health.Dependencies, dep)
+			if dep.Status != wguevents.StatusHealthy {
+				errorMessages = append(errorMessages, fmt.Sprintf("%s: %s", probe.label, dep.Status))
+			}
+			mu.Unlock()
+		}()
+	}
 
 	wg.Wait()
 
@@ -223,7 +318,7 @@ func checkDynamoDB(ctx context.Context, clients *awsutils.AWSClients) wguevents.
 	status := wguevents.StatusHealthy
 	if err != nil {
 		status = wguevents.StatusUnhealthy
-		logger.Error("DynamoDB health check failed", zap.Error(err))
+		logger.Error("DynamoDB health check failed", zap.Error(err), awsutils.ErrorField(err))
 	} else if latency > 500*time.Millisecond {
 		status = wguevents.StatusDegraded
 	}
@@ -248,7 +343,7 @@ func checkEventBridge(ctx context.Context, clients *awsutils.AWSClients) wgueven
 	status := wguevents.StatusHealthy
 	if err != nil {
 		status = wguevents.StatusUnhealthy
-		logger.Error("EventBridge health check failed", zap.Error(err))
+		logger.Error("EventBridge health check failed", zap.Error(err), awsutils.ErrorField(err))
 	} else if latency > 500*time.Millisecond {
 		status = wguevents.StatusDegraded
 	}
@@ -273,7 +368,7 @@ func checkSQS(ctx context.Context, clients *awsutils.AWSClients) wguevents.Depen
 	status := wguevents.StatusHealthy
 	if err != nil {
 		status = wguevents.StatusUnhealthy
-		logger.Error("SQS health check failed", zap.Error(err))
+		logger.Error("SQS health check failed", zap.Error(err), awsutils.ErrorField(err))
 	} else if latency > 500*time.Millisecond {
 		status = wguevents.StatusDegraded
 	}
@@ -287,7 +382,147 @@ func checkSQS(ctx context.Context, clients *awsutils.AWSClients) wguevents.Depen
 	}
 }
 
-// determineHealthStatus determines overall health from dependencies
+// checkTableStatus checks that the health table is ACTIVE
+func checkTableStatus(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+	if healthTableName == "" {
+		return wguevents.DependencyCheck{}, false
+	}
+	start := time.Now()
+
+	output, err := clients.DynamoDB.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(healthTableName),
+	})
+	latency := time.Since(start)
+
+	status := wguevents.StatusHealthy
+	switch {
+	case err != nil:
+		status = wguevents.StatusUnhealthy
+		logger.Error("DynamoDB table check failed", zap.String("table", healthTableName), zap.Error(err), awsutils.ErrorField(err))
+	case output.Table.TableStatus == dynamodbtypes.TableStatusUpdating:
+		status = wguevents.StatusDegraded
+	case output.Table.TableStatus != dynamodbtypes.TableStatusActive:
+		status = wguevents.StatusUnhealthy
+	}
+
+	return wguevents.DependencyCheck{
+		Name:    "dynamodb-table",
+		Type:    "database",
+		Status:  status,
+		Latency: latency,
+	}, true
+}
+
+// checkQueueBacklog checks the health queue's backlog is below the threshold
+func checkQueueBacklog(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+	if healthQueueName == "" {
+		return wguevents.DependencyCheck{}, false
+	}
+	start := time.Now()
+
+	backlog, err := queueBacklog(ctx, clients)
+	latency := time.Since(start)
+
+	status := wguevents.StatusHealthy
+	if err != nil {
+		status = wguevents.StatusUnhealthy
+		logger.Error("SQS backlog check failed", zap.String("queue", healthQueueName), zap.Error(err), awsutils.ErrorField(err))
+	} else if backlog > queueBacklogThreshold {
+		status = wguevents.StatusDegraded
+		logger.Warn("SQS backlog above threshold",
+			zap.String("queue", healthQueueName),
+			zap.Int("backlog", backlog),
+			zap.Int("threshold", queueBacklogThreshold),
+		)
+	}
+
+	return wguevents.DependencyCheck{
+		Name:    "sqs-backlog",
+		Type:    "queue",
+		Status:  status,
+		Latency: latency,
+	}, true
+}
+
+// queueBacklog returns the approximate number of visible messages on the
+// health queue. The queue is looked up by name since its URL differs by region.
+func queueBacklog(ctx context.Context, clients *awsutils.AWSClients) (int, error) {
+	queue, err := clients.SQS.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+		QueueName: aws.String(healthQueueName),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	output, err := clients.SQS.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(output.Attributes[string(sqstypes.QueueAttributeNameApproximateNumberOfMessages)])
+}
+
+// checkEventBus checks the event bus exists and can be described
+func checkEventBus(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+	if eventBusName == "" {
+		return wguevents.DependencyCheck{}, false
+	}
+	start := time.Now()
+
+	_, err := clients.EventBridge.DescribeEventBus(ctx, &eventbridge.DescribeEventBusInput{
+		Name: aws.String(eventBusName),
+	})
+	latency := time.Since(start)
+
+	status := wguevents.StatusHealthy
+	if err != nil {
+		status = wguevents.StatusUnhealthy
+		logger.Error("EventBridge bus check failed", zap.String("event_bus", eventBusName), zap.Error(err), awsutils.ErrorField(err))
+	}
+
+	return wguevents.DependencyCheck{
+		Name:    "eventbridge-bus",
+		Type:    "api",
+		Status:  status,
+		Latency: latency,
+	}, true
+}
+
+// checkCrossRegionLatency measures a round trip from this region to the
+// partner region. It doesn't apply to the current region.
+func checkCrossRegionLatency(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+	if region == currentRegion {
+		return wguevents.DependencyCheck{}, false
+	}
+	start := time.Now()
+
+	_, err := clients.DynamoDB.DescribeLimits(ctx, &dynamodb.DescribeLimitsInput{})
+	latency := time.Since(start)
+
+	status := wguevents.StatusHealthy
+	if err != nil {
+		status = wguevents.StatusUnhealthy
+		logger.Error("cross-region latency check failed", zap.String("region", region), zap.Error(err), awsutils.ErrorField(err))
+	} else {
+		metrics.CrossRegionProbeLatency.WithLabelValues(currentRegion, region).Observe(latency.Seconds())
+		if latency > time.Second {
+			status = wguevents.StatusDegraded
+		}
+	}
+
+	return wguevents.DependencyCheck{
+		Name:    "cross-region",
+		Type:    "network",
+		Status:  status,
+		Latency: latency,
+	}, true
+}
+
+// determineHealthStatus determines overall health from dependencies. An
+// unhealthy critical dependency makes the service unhealthy; an unhealthy
+// non-critical one only degrades it.
 func determineHealthStatus(dependencies []wguevents.DependencyCheck) string {
 	hasUnhealthy := false
 	hasDegraded := false
@@ -295,7 +530,11 @@ func determineHealthStatus(dependencies []wguevents.DependencyCheck) string {
 	for _, dep := range dependencies {
 		switch dep.Status {
 		case wguevents.StatusUnhealthy:
-			hasUnhealthy = true
+			if nonCriticalDependencies[dep.Name] {
+				hasDegraded = true
+			} else {
+				hasUnhealthy = true
+			}
 		case wguevents.StatusDegraded:
 			hasDegraded = true
 		}
@@ -310,6 +549,59 @@ func determineHealthStatus(dependencies []wguevents.DependencyCheck) string {
 	return wguevents.StatusHealthy
 }
 
+// parseDependencyNames parses a comma-separated list of dependency names
+func parseDependencyNames(value string) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// maintenanceWindow overrides the published status until a deadline, so
+// planned maintenance doesn't trip alarms. A zero until means no window.
+type maintenanceWindow struct {
+	status string
+	until  time.Time
+}
+
+// parseMaintenanceWindow parses a window ending at until, an RFC 3339 time,
+// reporting status, or StatusMaintenance if empty. An empty until means no
+// window.
+func parseMaintenanceWindow(until, status string) (maintenanceWindow, error) {
+	if until == "" {
+		return maintenanceWindow{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return maintenanceWindow{}, err
+	}
+	if status == "" {
+		status = wguevents.StatusMaintenance
+	}
+	return maintenanceWindow{status: status, until: t}, nil
+}
+
+// active reports whether the window is open at now. An expired window is
+// ignored.
+func (w maintenanceWindow) active(now time.Time) bool {
+	return !w.until.IsZero() && now.Before(w.until)
+}
+
+// apply overrides health's status while the window is open, keeping the
+// checked status in UnderlyingStatus and the dependencies as probed. It
+// reports whether the status was overridden.
+func (w maintenanceWindow) apply(health *wguevents.HealthCheckEvent, now time.Time) bool {
+	if !w.active(now) {
+		return false
+	}
+	health.UnderlyingStatus = health.Status
+	health.Status = w.status
+	return true
+}
+
 // calculateMetrics calculates aggregate metrics from dependencies
 func calculateMetrics(dependencies []wguevents.DependencyCheck) wguevents.HealthMetrics {
 	var totalLatency time.Duration
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
 	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
 	"github.com/stretchr/testify/assert"
 )
@@ -48,6 +50,38 @@ func TestDetermineHealthStatus_Empty(t *testing.T) {
 	assert.Equal(t, wguevents.StatusHealthy, status, "Empty dependencies should default to healthy")
 }
 
+func TestDetermineHealthStatus_Criticality(t *testing.T) {
+	original := nonCriticalDependencies
+	defer func() { nonCriticalDependencies = original }()
+	nonCriticalDependencies = parseDependencyNames(" cache, sqs ,")
+
+	// An unhealthy non-critical dependency only degrades the service
+	status := determineHealthStatus([]wguevents.DependencyCheck{
+		{Name: "dynamodb", Status: wguevents.StatusHealthy},
+		{Name: "cache", Status: wguevents.StatusUnhealthy},
+	})
+	assert.Equal(t, wguevents.StatusDegraded, status)
+
+	// An unhealthy critical dependency still fails the service
+	status = determineHealthStatus([]wguevents.DependencyCheck{
+		{Name: "dynamodb", Status: wguevents.StatusUnhealthy},
+		{Name: "cache", Status: wguevents.StatusUnhealthy},
+	})
+	assert.Equal(t, wguevents.StatusUnhealthy, status)
+}
+
+func TestDetermineHealthStatus_AllCriticalByDefault(t *testing.T) {
+	original := nonCriticalDependencies
+	defer func() { nonCriticalDependencies = original }()
+	nonCriticalDependencies = parseDependencyNames("")
+
+	status := determineHealthStatus([]wguevents.DependencyCheck{
+		{Name: "dynamodb", Status: wguevents.StatusHealthy},
+		{Name: "cache", Status: wguevents.StatusUnhealthy},
+	})
+	assert.Equal(t, wguevents.StatusUnhealthy, status)
+}
+
 func TestCalculateMetrics_BasicAverages(t *testing.T) {
 	dependencies := []wguevents.DependencyCheck{
 		{Name: "service1", Latency: 100 * time.Millisecond, ErrorRate: 0.01},
@@ -298,3 +332,151 @@ func TestCalculateMetrics_HighErrorRates(t *testing.T) {
 	assert.Equal(t, int64(150), metrics.Latency)
 	assert.InDelta(t, 0.625, metrics.ErrorRate, 0.001)
 }
+
+// fakeProbe returns a probe reporting a healthy dependency called name
+func fakeProbe(name string) dependencyProbe {
+	return dependencyProbe{label: name, run: func(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+		return wguevents.DependencyCheck{Name: name, Status: wguevents.StatusHealthy}, true
+	}}
+}
+
+// useFakeProbes replaces the shallow and deep probes for the test
+func useFakeProbes(t *testing.T) {
+	previousShallow, previousDeep := shallowProbes, deepProbes
+	t.Cleanup(func() { shallowProbes, deepProbes = previousShallow, previousDeep })
+
+	shallowProbes = []dependencyProbe{fakeProbe("dynamodb"), fakeProbe("eventbridge"), fakeProbe("sqs")}
+	deepProbes = []dependencyProbe{
+		fakeProbe("dynamodb-table"),
+		fakeProbe("sqs-backlog"),
+		// A probe that doesn't apply adds no dependency
+		{label: "skipped", run: func(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+			return wguevents.DependencyCheck{}, false
+		}},
+	}
+}
+
+func dependencyNames(health *wguevents.HealthCheckEvent) []string {
+	names := make([]string, 0, len(health.Dependencies))
+	for _, dep := range health.Dependencies {
+		names = append(names, dep.Name)
+	}
+	return names
+}
+
+func TestCheckRegionHealth_QuickRunsShallowProbes(t *testing.T) {
+	useFakeProbes(t)
+
+	health, err := checkRegionHealth(context.Background(), "us-west-2", nil, checkTypeQuick)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"dynamodb", "eventbridge", "sqs"}, dependencyNames(health))
+	assert.Equal(t, wguevents.StatusHealthy, health.Status)
+}
+
+func TestCheckRegionHealth_FullAddsDeepProbes(t *testing.T) {
+	useFakeProbes(t)
+
+	health, err := checkRegionHealth(context.Background(), "us-west-2", nil, checkTypeFull)
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"dynamodb", "eventbridge", "sqs", "dynamodb-table", "sqs-backlog"}, dependencyNames(health))
+}
+
+func TestNormalizeCheckType(t *testing.T) {
+	assert.Equal(t, checkTypeFull, normalizeCheckType("full"))
+	assert.Equal(t, checkTypeFull, normalizeCheckType(" FULL "))
+	assert.Equal(t, checkTypeQuick, normalizeCheckType("quick"))
+	assert.Equal(t, checkTypeQuick, normalizeCheckType(""))
+	assert.Equal(t, checkTypeQuick, normalizeCheckType("deep"))
+}
+
+func TestDeepProbes_SkipUnconfiguredResources(t *testing.T) {
+	defer func(table, queue, bus, region string) {
+		healthTableName, healthQueueName, eventBusName, currentRegion = table, queue, bus, region
+	}(healthTableName, healthQueueName, eventBusName, currentRegion)
+	healthTableName, healthQueueName, eventBusName = "", "", ""
+	currentRegion = "us-west-2"
+
+	// Nil clients would panic if any probe tried to call AWS
+	for _, probe := range deepProbes {
+		_, ok := probe.run(context.Background(), currentRegion, nil)
+		assert.False(t, ok, probe.label)
+	}
+}
+
+// recordingSink records published health events
+type recordingSink struct {
+	events []*wguevents.HealthCheckEvent
+}
+
+func (s *recordingSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	s.events = append(s.events, detail.(*wguevents.HealthCheckEvent))
+	return nil
+}
+
+// useUnhealthyDynamoDB makes the shallow DynamoDB probe report unhealthy
+func useUnhealthyDynamoDB(t *testing.T) {
+	useFakeProbes(t)
+	shallowProbes[0] = dependencyProbe{label: "dynamodb", run: func(ctx context.Context, region string, clients *awsutils.AWSClients) (wguevents.DependencyCheck, bool) {
+		return wguevents.DependencyCheck{Name: "dynamodb", Status: wguevents.StatusUnhealthy}, true
+	}}
+}
+
+func TestHandler_MaintenanceOverridesStatus(t *testing.T) {
+	useUnhealthyDynamoDB(t)
+	defer func(p awsutils.EventSink, w maintenanceWindow) { publisher, maintenance = p, w }(publisher, maintenance)
+	sink := &recordingSink{}
+	publisher = sink
+
+	var err error
+	maintenance, err = parseMaintenanceWindow(time.Now().Add(time.Hour).Format(time.RFC3339), "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, Handler(context.Background(), HealthCheckRequest{CheckType: checkTypeQuick}))
+
+	if assert.Len(t, sink.events, 1) {
+		health := sink.events[0]
+		assert.Equal(t, wguevents.StatusMaintenance, health.Status)
+		assert.Equal(t, wguevents.StatusUnhealthy, health.UnderlyingStatus)
+		// The real probe results are still published
+		for _, dep := range health.Dependencies {
+			if dep.Name == "dynamodb" {
+				assert.Equal(t, wguevents.StatusUnhealthy, dep.Status)
+			} else {
+				assert.Equal(t, wguevents.StatusHealthy, dep.Status)
+			}
+		}
+		assert.Len(t, health.Dependencies, 6)
+	}
+}
+
+func TestHandler_ExpiredMaintenanceIgnored(t *testing.T) {
+	useUnhealthyDynamoDB(t)
+	defer func(p awsutils.EventSink, w maintenanceWindow) { publisher, maintenance = p, w }(publisher, maintenance)
+	sink := &recordingSink{}
+	publisher = sink
+	maintenance = maintenanceWindow{status: wguevents.StatusMaintenance, until: time.Now().Add(-time.Minute)}
+
+	assert.NoError(t, Handler(context.Background(), HealthCheckRequest{CheckType: checkTypeQuick}))
+
+	if assert.Len(t, sink.events, 1) {
+		assert.Equal(t, wguevents.StatusUnhealthy, sink.events[0].Status)
+		assert.Empty(t, sink.events[0].UnderlyingStatus)
+	}
+}
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	window, err := parseMaintenanceWindow("", "")
+	assert.NoError(t, err)
+	assert.False(t, window.active(time.Now()))
+
+	window, err = parseMaintenanceWindow("2024-06-01T06:00:00Z", "planned-outage")
+	assert.NoError(t, err)
+	assert.Equal(t, "planned-outage", window.status)
+	assert.True(t, window.active(time.Date(2024, 6, 1, 5, 59, 0, 0, time.UTC)))
+	assert.False(t, window.active(time.Date(2024, 6, 1, 6, 0, 0, 0, time.UTC)))
+
+	_, err = parseMaintenanceWindow("tomorrow", "")
+	assert.Error(t, err)
+}
@@ -3,14 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+	"github.com/wgu/go-performance-enablement/pkg/batch"
 	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/logging"
 	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"go.uber.org/zap"
 )
@@ -18,26 +23,79 @@ import (
 var (
 	logger         *zap.Logger
 	awsClients     *awsutils.AWSClients
-	publisher      *awsutils.EventBridgePublisher
+	publisher      awsutils.EventSink
 	dynamoHelper   *awsutils.DynamoDBHelper
 	currentRegion  string
 	eventBusName   string
 	replicaTable   string
 	dlqURL         string
+	dlqRouter      *awsutils.DeadLetterRouter
+	dlqBatcher     *awsutils.DeadLetterBatcher
+	dlqReplayer    *awsutils.DeadLetterReplayer
+	batchWorkers   int
+	retryBudget    int
+	maxAgePolicy   wguevents.MaxAgePolicy
+	keySchemas     wguevents.KeySchemas
+	versionAttr    string
+	utf8Policy     = wguevents.UTF8Replace
+	typedKeys      bool
 )
 
+// functionMetrics holds the function's metric series, resolved once in init
+// for the per-record path
+var functionMetrics *metrics.FunctionMetrics
+
 func init() {
 	var err error
 	
-	// Initialize logger
-	logger, _ = zap.NewProduction()
+	// Initialize logger from LOG_LEVEL and LOG_FORMAT
+	logger, err = logging.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
 	
 	// Get environment variables
 	currentRegion = os.Getenv("AWS_REGION")
+	functionMetrics = metrics.NewFunctionMetrics("stream-processor", currentRegion)
 	eventBusName = os.Getenv("EVENT_BUS_NAME")
 	replicaTable = os.Getenv("REPLICA_TABLE_NAME")
 	dlqURL = os.Getenv("DLQ_URL")
 	
+	// Replicated deletes skip replica items with a newer version, e.g. "updated_at"
+	versionAttr = os.Getenv("REPLICA_VERSION_ATTRIBUTE")
+	batchWorkers = 1
+	if n, err := strconv.Atoi(os.Getenv("BATCH_WORKERS")); err == nil && n > 0 {
+		batchWorkers = n
+	}
+	
+	// Cap publish retries across all records of an invocation
+	if n, err := strconv.Atoi(os.Getenv("RETRY_BUDGET")); err == nil && n > 0 {
+		retryBudget = n
+	}
+	
+	// Drop events older than their type's max age, e.g. "INSERT=1h,*=6h"
+	maxAgePolicy, err = wguevents.ParseMaxAgePolicy(os.Getenv("EVENT_MAX_AGE"))
+	if err != nil {
+		logger.Fatal("invalid EVENT_MAX_AGE", zap.Error(err))
+	}
+	
+	// Strings with invalid UTF-8 are replaced or dead-lettered, e.g. "dlq"; defaults to "replace"
+	utf8Policy, err = wguevents.ParseUTF8Policy(os.Getenv("INVALID_UTF8_POLICY"))
+	if err != nil {
+		logger.Fatal("invalid INVALID_UTF8_POLICY", zap.Error(err))
+	}
+	
+	// Key attributes per table, e.g. "orders=customerId:orderId,users=userId"
+	keySchemas, err = wguevents.ParseKeySchemas(os.Getenv("TABLE_KEY_SCHEMAS"))
+	if err != nil {
+		logger.Fatal("invalid TABLE_KEY_SCHEMAS", zap.Error(err))
+	}
+	
+	// INCLUDE_TYPED_KEYS=true adds the record's keys with their DynamoDB types
+	// to published events as typed_keys, for consumers rebuilding the key
+	typedKeys = os.Getenv("INCLUDE_TYPED_KEYS") == "true"
+	
 	// Initialize AWS clients
 	ctx := context.Background()
 	awsClients, err = awsutils.NewAWSClients(ctx)
@@ -45,48 +103,114 @@ func init() {
 		logger.Fatal("failed to create AWS clients", zap.Error(err))
 	}
 	
+	awsutils.ConfigureSlowCallWarnings(logger)
+	
+	// Route repeat failures past MAX_FAILURE_COUNT, e.g. "5", to PERMANENT_FAILURE_QUEUE_URL
+	maxFailures, err := awsutils.ParseMaxFailures(os.Getenv("MAX_FAILURE_COUNT"))
+	if err != nil {
+		logger.Fatal("invalid MAX_FAILURE_COUNT", zap.Error(err))
+	}
+	
+	// Send error types to their own queues instead of DLQ_URL, e.g.
+	// "validation_failure=https://sqs.us-west-2.amazonaws.com/123456789012/review"
+	errorQueueURLs, err := awsutils.ParseErrorQueueURLs(os.Getenv("DLQ_ERROR_QUEUE_URLS"))
+	if err != nil {
+		logger.Fatal("invalid DLQ_ERROR_QUEUE_URLS", zap.Error(err))
+	}
+	dlqPolicy := awsutils.DeadLetterPolicy{
+		RetryQueueURL:     dlqURL,
+		PermanentQueueURL: os.Getenv("PERMANENT_FAILURE_QUEUE_URL"),
+		MaxFailures:       maxFailures,
+		ErrorQueueURLs:    errorQueueURLs,
+	}
+	dlqRouter = awsutils.NewDeadLetterRouter(awsClients.SQS, dlqPolicy, "stream-processor")
+	
+	// Failed records are dead-lettered in batches, sent before Handler returns
+	dlqBatcher = awsutils.NewDeadLetterBatcher(awsClients.SQS, dlqPolicy, "stream-processor")
+	
+	// Replayed events that fail again go back with their failure counted
+	dlqReplayer = awsutils.NewDeadLetterReplayer(dlqRouter, logger)
+	
 	// Initialize EventBridge publisher
-	publisher = awsutils.NewEventBridgePublisher(
+	eventBridge := awsutils.NewEventBridgePublisher(
 		awsClients.EventBridge,
 		eventBusName,
 		"stream-processor",
 	)
+	eventBridge.SetWrapEnvelope(true)
+	
+	// Publish through a global endpoint that fails over between regions, e.g. "abcde.veo"
+	eventBridge.SetGlobalEndpoint(os.Getenv("EVENT_BUS_ENDPOINT_ID"))
+	
+	// EVENT_SINK=file writes events to EVENT_SINK_PATH for local runs
+	publisher, err = awsutils.SelectEventSink(os.Getenv("EVENT_SINK"), os.Getenv("EVENT_SINK_PATH"), eventBridge, "stream-processor")
+	if err != nil {
+		logger.Fatal("failed to create event sink", zap.Error(err))
+	}
 	
 	// Initialize DynamoDB helper
 	dynamoHelper = awsutils.NewDynamoDBHelper(awsClients.DynamoDB, replicaTable)
+	
+	// Pace replica writes under the table's capacity, e.g. "200" writes per
+	// second with bursts of REPLICA_WRITE_BURST (the rate by default)
+	if value := os.Getenv("REPLICA_WRITE_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 {
+			logger.Fatal("invalid REPLICA_WRITE_RATE", zap.String("value", value), zap.Error(err))
+		}
+		burst := int(math.Ceil(rate))
+		if value := os.Getenv("REPLICA_WRITE_BURST"); value != "" {
+			burst, err = strconv.Atoi(value)
+			if err != nil || burst < 1 {
+				logger.Fatal("invalid REPLICA_WRITE_BURST", zap.String("value", value), zap.Error(err))
+			}
+		}
+		dynamoHelper.SetWriteLimiter(awsutils.NewRateLimiter(rate, burst))
+	}
 }
 
 // Handler processes DynamoDB Stream events
 func Handler(ctx context.Context, event events.DynamoDBEvent) error {
 	start := time.Now()
-	functionName := "stream-processor"
 	
 	logger.Info("processing DynamoDB stream batch",
 		zap.Int("record_count", len(event.Records)),
 		zap.String("region", currentRegion),
 	)
 	
+	// Records share one retry budget so a failing batch fails fast
+	if retryBudget > 0 {
+		ctx = awsutils.WithRetryBudget(ctx, awsutils.NewRetryBudget(retryBudget))
+	}
+	
 	var errors []error
 	
-	for _, record := range event.Records {
-		if err := processStreamRecord(ctx, record); err != nil {
+	for i, err := range processBatch(ctx, event.Records, processStreamRecord) {
+		if err != nil {
+			record := event.Records[i]
 			errors = append(errors, err)
 			logger.Error("failed to process stream record",
 				zap.Error(err),
+				awsutils.ErrorField(err),
 				zap.String("event_id", record.EventID),
 				zap.String("event_name", record.EventName),
 			)
 		}
 	}
 	
+	// An event that wasn't dead-lettered fails the batch so it's retried
+	dlqErr := dlqBatcher.FlushAndLog(ctx, logger)
+	
 	duration := time.Since(start)
 	
 	var finalErr error
 	if len(errors) > 0 {
 		finalErr = fmt.Errorf("failed to process %d/%d records", len(errors), len(event.Records))
+	} else if dlqErr != nil {
+		finalErr = dlqErr
 	}
 	
-	metrics.RecordLambdaInvocation(functionName, currentRegion, duration, finalErr)
+	functionMetrics.RecordInvocation(duration, finalErr)
 	
 	if finalErr != nil {
 		return finalErr
@@ -100,8 +224,29 @@ func Handler(ctx context.Context, event events.DynamoDBEvent) error {
 	return nil
 }
 
+// processBatch runs process over the records with up to batchWorkers in
+// parallel, keeping records for the same item in stream order. The returned
+// errors are indexed like records.
+func processBatch(ctx context.Context, records []events.DynamoDBEventRecord, process func(context.Context, events.DynamoDBEventRecord) error) []error {
+	errs := batch.Process(ctx, len(records), batchWorkers,
+		func(i int) string { return awsutils.StreamRecordKey(records[i].Change.Keys) },
+		func(ctx context.Context, i int) error { return process(ctx, records[i]) },
+	)
+	
+	// A panic fails only its own record, which is dead-lettered with the stack
+	for i, err := range errs {
+		var panicErr *batch.PanicError
+		if errors.As(err, &panicErr) {
+			errs[i] = deadLetterPanic(ctx, records[i], panicErr)
+		}
+	}
+	return errs
+}
+
 func processStreamRecord(ctx context.Context, record events.DynamoDBEventRecord) error {
-	start := time.Now()
+	if isStale(record) || isNoOp(record) {
+		return nil
+	}
 	
 	// Convert to CDC event
 	cdcEvent, err := toCDCEvent(record)
@@ -109,6 +254,35 @@ func processStreamRecord(ctx context.Context, record events.DynamoDBEventRecord)
 		return fmt.Errorf("failed to convert to CDC event: %w", err)
 	}
 	
+	processingErr := applyCDCEvent(ctx, cdcEvent, record.Change.Keys)
+	if errors.Is(processingErr, wguevents.ErrInvalidUTF8) {
+		return deadLetter(ctx, cdcEvent, processingErr, record.EventSourceArn)
+	}
+	if processingErr != nil {
+		// Send to DLQ
+		if dlqErr := deadLetter(ctx, cdcEvent, processingErr, record.EventSourceArn); dlqErr != nil {
+			logger.Error("failed to send to DLQ",
+				zap.Error(dlqErr),
+				awsutils.ErrorField(dlqErr),
+				zap.String("event_id", record.EventID),
+			)
+		}
+		return processingErr
+	}
+	
+	return nil
+}
+
+// applyCDCEvent replicates a CDC event and publishes it, returning the error
+// to dead-letter it with. keys are the stream record's keys, for typed_keys,
+// and nil for a replayed event.
+func applyCDCEvent(ctx context.Context, cdcEvent *wguevents.CDCEvent, keys map[string]events.DynamoDBAttributeValue) error {
+	start := time.Now()
+	
+	if err := utf8Policy.ApplyToCDCEvent("stream-processor", cdcEvent); err != nil {
+		return err
+	}
+	
 	// Process based on operation type
 	var processingErr error
 	switch cdcEvent.Operation {
@@ -119,36 +293,22 @@ func processStreamRecord(ctx context.Context, record events.DynamoDBEventRecord)
 	case wguevents.OperationDelete:
 		processingErr = handleDelete(ctx, cdcEvent)
 	default:
-		processingErr = fmt.Errorf("unknown operation: %s", cdcEvent.Operation)
+		processingErr = fmt.Errorf("%w: %s", errUnknownOperation, cdcEvent.Operation)
 	}
-	
 	if processingErr != nil {
-		// Send to DLQ
-		if dlqErr := sendToDLQ(ctx, cdcEvent, processingErr); dlqErr != nil {
-			logger.Error("failed to send to DLQ",
-				zap.Error(dlqErr),
-				zap.String("event_id", record.EventID),
-			)
-		}
 		return processingErr
 	}
 	
 	// Publish event to EventBridge
-	baseEvent := wguevents.NewBaseEvent(
-		fmt.Sprintf("cdc.%s", cdcEvent.Operation),
-		currentRegion,
-		map[string]interface{}{
-			"table":      cdcEvent.TableName,
-			"operation":  cdcEvent.Operation,
-			"after":      cdcEvent.After,
-			"before":     cdcEvent.Before,
-			"primaryKeys": cdcEvent.PrimaryKeys,
-		},
-	)
+	baseEvent := cdcEvent.ToBaseEvent(currentRegion)
+	if typedKeys && keys != nil {
+		baseEvent.Payload["typed_keys"] = awsutils.StreamTypedKeys(keys)
+	}
 	
-	if err := publisher.PublishEvent(ctx, baseEvent.EventType, baseEvent); err != nil {
+	if err := publisher.Publish(ctx, baseEvent.EventType, baseEvent); err != nil {
 		logger.Error("failed to publish event",
 			zap.Error(err),
+			awsutils.ErrorField(err),
 			zap.String("event_type", baseEvent.EventType),
 		)
 		// Don't fail the Lambda on EventBridge errors
@@ -157,6 +317,7 @@ func processStreamRecord(ctx context.Context, record events.DynamoDBEventRecord)
 	// Record metrics
 	duration := time.Since(start)
 	metrics.RecordCDCEvent(cdcEvent.Operation, cdcEvent.TableName, "dynamodb-streams", duration)
+	functionMetrics.RecordEventLatency(cdcEvent.Operation, cdcEvent.CapturedAt())
 	
 	logger.Debug("processed CDC event",
 		zap.String("operation", cdcEvent.Operation),
@@ -167,6 +328,70 @@ func processStreamRecord(ctx context.Context, record events.DynamoDBEventRecord)
 	return nil
 }
 
+// ReplayHandler reprocesses events delivered from the DLQ. An event that
+// fails again is dead-lettered with its failure count increased.
+func ReplayHandler(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	logger.Info("replaying dead-lettered events",
+		zap.Int("message_count", len(event.Records)),
+		zap.String("region", currentRegion),
+	)
+	
+	return dlqReplayer.Replay(ctx, event, replayDeadLetter), nil
+}
+
+// replayDeadLetter applies a dead-lettered event again. A panicked record was
+// dead-lettered as the raw stream record, any other failure as its CDC event.
+func replayDeadLetter(ctx context.Context, dlqEvent *wguevents.DeadLetterEvent) error {
+	if dlqEvent.ErrorType == wguevents.ErrorTypePanic {
+		var record events.DynamoDBEventRecord
+		if err := json.Unmarshal(dlqEvent.OriginalEvent, &record); err != nil {
+			return fmt.Errorf("failed to unmarshal dead-lettered record: %w", err)
+		}
+		cdcEvent, err := toCDCEvent(record)
+		if err != nil {
+			return fmt.Errorf("failed to convert to CDC event: %w", err)
+		}
+		return applyCDCEvent(ctx, cdcEvent, record.Change.Keys)
+	}
+	
+	var cdcEvent wguevents.CDCEvent
+	if err := json.Unmarshal(dlqEvent.OriginalEvent, &cdcEvent); err != nil {
+		return fmt.Errorf("failed to unmarshal dead-lettered event: %w", err)
+	}
+	return applyCDCEvent(ctx, &cdcEvent, nil)
+}
+
+// isNoOp reports whether a record is a MODIFY that left the item unchanged,
+// recording it as skipped so nothing is replicated for it
+func isNoOp(record events.DynamoDBEventRecord) bool {
+	if !awsutils.IsNoOpModify(record) {
+		return false
+	}
+	
+	logger.Debug("skipping unchanged MODIFY",
+		zap.String("event_id", record.EventID),
+	)
+	functionMetrics.NoOpSkipped.Inc()
+	return true
+}
+
+// isStale reports whether a record is older than the max age for its event
+// type, recording it as dropped if so
+func isStale(record events.DynamoDBEventRecord) bool {
+	occurredAt := record.Change.ApproximateCreationDateTime.Time
+	if !maxAgePolicy.IsStale(record.EventName, occurredAt, time.Now()) {
+		return false
+	}
+	
+	logger.Warn("dropping stale event",
+		zap.String("event_id", record.EventID),
+		zap.String("event_name", record.EventName),
+		zap.Duration("age", time.Since(occurredAt)),
+	)
+	metrics.StaleEventsDropped.WithLabelValues("stream-processor", record.EventName).Inc()
+	return true
+}
+
 func toCDCEvent(record events.DynamoDBEventRecord) (*wguevents.CDCEvent, error) {
 	var operation string
 	switch record.EventName {
@@ -180,25 +405,72 @@ func toCDCEvent(record events.DynamoDBEventRecord) (*wguevents.CDCEvent, error)
 		return nil, fmt.Errorf("unknown event name: %s", record.EventName)
 	}
 	
+	tableName := extractTableName(record.EventSourceArn)
+	primaryKeys, err := extractPrimaryKeys(tableName, record.Change.Keys)
+	if err != nil {
+		return nil, err
+	}
+	
 	cdcEvent := &wguevents.CDCEvent{
+		EventID:       record.EventID,
 		Operation:     operation,
-		TableName:     extractTableName(record.EventSourceArn),
+		TableName:     tableName,
 		Timestamp:     record.Change.ApproximateCreationDateTime.Time,
-		PrimaryKeys:   convertAttributeValues(record.Change.Keys),
-		After:         convertAttributeValues(record.Change.NewImage),
-		Before:        convertAttributeValues(record.Change.OldImage),
+		PrimaryKeys:   primaryKeys,
 		Metadata: wguevents.CDCMetadata{
 			SourceDatabase: "dynamodb",
-			SourceTable:    extractTableName(record.EventSourceArn),
+			SourceTable:    tableName,
 			Offset:         0,
 			Partition:      0,
 			CaptureTime:    record.Change.ApproximateCreationDateTime.Time,
+			StreamViewType: record.Change.StreamViewType,
 		},
 	}
 	
+	// KEYS_ONLY streams never carry images, so the event holds keys only
+	if record.Change.StreamViewType == wguevents.StreamViewKeysOnly {
+		cdcEvent.Metadata.ImagesUnavailable = true
+		return cdcEvent, nil
+	}
+	
+	cdcEvent.After = convertAttributeValues(record.Change.NewImage)
+	cdcEvent.Before = convertAttributeValues(record.Change.OldImage)
+	
+	missing := wguevents.MissingStreamImages(
+		record.Change.StreamViewType,
+		record.EventName,
+		len(record.Change.NewImage) > 0,
+		len(record.Change.OldImage) > 0,
+	)
+	if len(missing) > 0 {
+		cdcEvent.Metadata.MissingImages = missing
+		logger.Warn("stream record is missing expected images",
+			zap.String("event_id", record.EventID),
+			zap.String("event_name", record.EventName),
+			zap.String("stream_view_type", record.Change.StreamViewType),
+			zap.Strings("missing_images", missing),
+		)
+	}
+	
 	return cdcEvent, nil
 }
 
+// extractPrimaryKeys converts a record's key attributes, keeping only the
+// configured key schema's attributes when the table has one
+func extractPrimaryKeys(tableName string, keys map[string]events.DynamoDBAttributeValue) (map[string]interface{}, error) {
+	primaryKeys := convertAttributeValues(keys)
+	schema, ok := keySchemas[tableName]
+	if !ok {
+		return primaryKeys, nil
+	}
+	
+	primaryKeys, err := schema.Extract(primaryKeys)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %w", tableName, err)
+	}
+	return primaryKeys, nil
+}
+
 func extractTableName(arn string) string {
 	// Parse ARN to extract table name
 	// ARN format: arn:aws:dynamodb:region:account:table/TableName/stream/timestamp
@@ -249,7 +521,7 @@ func handleUpdate(ctx context.Context, event *wguevents.CDCEvent) error {
 	
 	// Replicate to partner region table
 	if replicaTable != "" {
-		if err := dynamoHelper.PutItem(ctx, event.After); err != nil {
+		if err := replicateUpdate(ctx, event); err != nil {
 			return fmt.Errorf("failed to replicate UPDATE: %w", err)
 		}
 	}
@@ -258,6 +530,43 @@ func handleUpdate(ctx context.Context, event *wguevents.CDCEvent) error {
 	return nil
 }
 
+// replicateUpdate applies only the attributes that changed so concurrent
+// writes to other attributes of the replica survive. Without an old image
+// there is nothing to diff against, and without a replica item, e.g. after a
+// lost INSERT, nothing to apply it to, so the whole item is put.
+func replicateUpdate(ctx context.Context, event *wguevents.CDCEvent) error {
+	if len(event.Before) == 0 || len(event.PrimaryKeys) == 0 {
+		return dynamoHelper.PutItem(ctx, event.After)
+	}
+	
+	keyNames := make([]string, 0, len(event.PrimaryKeys))
+	for name := range event.PrimaryKeys {
+		keyNames = append(keyNames, name)
+	}
+	update, err := awsutils.BuildDiffUpdate(event.Before, event.After, keyNames...)
+	if err != nil {
+		return err
+	}
+	if update == nil {
+		return nil
+	}
+	
+	key, err := awsutils.MarshalToAttributeValues(event.PrimaryKeys)
+	if err != nil {
+		return err
+	}
+	applied, err := dynamoHelper.ApplyDiffUpdateIfExists(ctx, key, update)
+	if err != nil || applied {
+		return err
+	}
+	
+	logger.Warn("replica item missing for UPDATE, putting full item",
+		zap.String("table", event.TableName),
+		zap.Any("primaryKeys", event.PrimaryKeys),
+	)
+	return dynamoHelper.PutItem(ctx, event.After)
+}
+
 func handleDelete(ctx context.Context, event *wguevents.CDCEvent) error {
 	logger.Debug("handling DELETE operation",
 		zap.String("table", event.TableName),
@@ -265,49 +574,98 @@ func handleDelete(ctx context.Context, event *wguevents.CDCEvent) error {
 	)
 	
 	// Replicate delete to partner region table
-	if replicaTable != "" {
-		// Convert primary keys to DynamoDB attribute values
-		// This is simplified - real implementation would need proper type conversion
-		// if err := dynamoHelper.DeleteItem(ctx, event.PrimaryKeys); err != nil {
-		// 	return fmt.Errorf("failed to replicate DELETE: %w", err)
-		// }
+	if replicaTable != "" && len(event.PrimaryKeys) > 0 {
+		deleted, err := replicateDelete(ctx, event)
+		if err != nil {
+			return fmt.Errorf("failed to replicate DELETE: %w", err)
+		}
+		if !deleted {
+			logger.Debug("skipped DELETE of newer replica item",
+				zap.String("table", event.TableName),
+				zap.Any("primaryKeys", event.PrimaryKeys),
+			)
+			metrics.ReplicaDeletesSkipped.WithLabelValues(event.TableName).Inc()
+			return nil
+		}
 	}
 	
 	metrics.DynamoDBOperations.WithLabelValues(event.TableName, "DELETE", currentRegion).Inc()
 	return nil
 }
 
-func sendToDLQ(ctx context.Context, event *wguevents.CDCEvent, processingError error) error {
+// errUnknownOperation is the DLQ error for events with an unrecognized operation
+var errUnknownOperation = errors.New("unknown operation")
+
+// deadLetterErrorType returns the DLQ error type for err. Events that can't
+// be applied as they are need review rather than a retry.
+func deadLetterErrorType(err error) string {
+	if errors.Is(err, wguevents.ErrInvalidUTF8) || errors.Is(err, errUnknownOperation) {
+		return wguevents.ErrorTypeValidationFailure
+	}
+	return wguevents.ErrorTypeProcessingFailure
+}
+
+// replicateDelete deletes the replica item, reporting whether it was deleted.
+// When the deleted item carries the version attribute, a replica item with a
+// newer version was recreated in the partner region since and is kept.
+func replicateDelete(ctx context.Context, event *wguevents.CDCEvent) (bool, error) {
+	key, err := awsutils.MarshalToAttributeValues(event.PrimaryKeys)
+	if err != nil {
+		return false, err
+	}
+	
+	version, ok := event.Before[versionAttr]
+	if versionAttr == "" || !ok {
+		return true, dynamoHelper.DeleteItem(ctx, key)
+	}
+	return dynamoHelper.DeleteItemIfNotNewer(ctx, key, versionAttr, version)
+}
+
+// newDLQEvent wraps a failed event with its error and invocation diagnostics
+func newDLQEvent(ctx context.Context, event *wguevents.CDCEvent, processingError error, eventSourceARN string) (*wguevents.DeadLetterEvent, error) {
 	dlqEvent := &wguevents.DeadLetterEvent{
 		ErrorMessage:  processingError.Error(),
-		ErrorType:     "cdc_processing_failure",
+		ErrorType:     deadLetterErrorType(processingError),
 		FailureCount:  1,
 		FirstFailure:  time.Now(),
 		LastFailure:   time.Now(),
 		SourceHandler: "stream-processor",
 	}
+	awsutils.EnrichDeadLetterEvent(ctx, dlqEvent, currentRegion, eventSourceARN)
+	awsutils.AnnotateDeadLetterEvent(dlqEvent, processingError)
 	
 	originalJSON, err := json.Marshal(event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal original event: %w", err)
+		return nil, fmt.Errorf("failed to marshal original event: %w", err)
 	}
 	dlqEvent.OriginalEvent = originalJSON
 	
-	messageBody, err := json.Marshal(dlqEvent)
-	if err != nil {
-		return fmt.Errorf("failed to marshal DLQ event: %w", err)
-	}
-	
-	err = awsClients.SendToDeadLetterQueue(ctx, dlqURL, string(messageBody), processingError.Error())
+	return dlqEvent, nil
+}
+
+// deadLetter queues a failed event for the DLQ; tests replace it
+var deadLetter = sendToDLQ
+
+func sendToDLQ(ctx context.Context, event *wguevents.CDCEvent, processingError error, eventSourceARN string) error {
+	dlqEvent, err := newDLQEvent(ctx, event, processingError, eventSourceARN)
 	if err != nil {
-		return fmt.Errorf("failed to send to DLQ: %w", err)
+		return err
 	}
 	
-	metrics.DLQMessages.WithLabelValues("stream-processor", "cdc_processing_failure").Inc()
-	
-	return nil
+	return dlqBatcher.Add(ctx, dlqEvent)
+}
+
+// deadLetterPanic sends a record whose processing panicked to the DLQ; tests
+// replace it
+var deadLetterPanic = func(ctx context.Context, record events.DynamoDBEventRecord, panicErr *batch.PanicError) error {
+	return dlqRouter.SendPanic(ctx, logger, currentRegion, record, panicErr)
 }
 
 func main() {
+	// DLQ_REPLAY=true runs the function on the DLQ's messages instead of the stream
+	if os.Getenv("DLQ_REPLAY") == "true" {
+		lambda.Start(ReplayHandler)
+		return
+	}
 	lambda.Start(Handler)
 }
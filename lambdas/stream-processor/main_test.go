@@ -1,12 +1,26 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+	"github.com/wgu/go-performance-enablement/pkg/batch"
 	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -274,6 +288,118 @@ func TestHandleDelete(t *testing.T) {
 	assert.Empty(t, event.After) // DELETE has no after image
 }
 
+// versionedReplica holds one replica item's "updated_at" and enforces the
+// version condition of conditional deletes like DynamoDB would
+type versionedReplica struct {
+	awsutils.DynamoDBAPI
+	updatedAt string
+	deletes   []*dynamodb.DeleteItemInput
+}
+
+func (r *versionedReplica) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	r.deletes = append(r.deletes, params)
+	if version, ok := params.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberS); ok && r.updatedAt > version.Value {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestHandleDelete_ConditionalOnVersion(t *testing.T) {
+	originalHelper, originalTable, originalAttr := dynamoHelper, replicaTable, versionAttr
+	defer func() { dynamoHelper, replicaTable, versionAttr = originalHelper, originalTable, originalAttr }()
+	replicaTable = "replica-table"
+	versionAttr = "updated_at"
+
+	deleteEvent := &wguevents.CDCEvent{
+		Operation:   wguevents.OperationDelete,
+		TableName:   "orders",
+		PrimaryKeys: map[string]interface{}{"id": "order-1"},
+		Before: map[string]interface{}{
+			"id":         "order-1",
+			"updated_at": "2024-03-01T10:00:00Z",
+		},
+	}
+
+	t.Run("matching version is deleted", func(t *testing.T) {
+		metrics.ReplicaDeletesSkipped.Reset()
+		replica := &versionedReplica{updatedAt: "2024-03-01T10:00:00Z"}
+		dynamoHelper = awsutils.NewDynamoDBHelper(replica, replicaTable)
+
+		assert.NoError(t, handleDelete(context.Background(), deleteEvent))
+
+		if assert.Len(t, replica.deletes, 1) {
+			assert.NotNil(t, replica.deletes[0].ConditionExpression)
+		}
+		assert.Equal(t, float64(0), testutil.ToFloat64(metrics.ReplicaDeletesSkipped.WithLabelValues("orders")))
+	})
+
+	t.Run("newer replica is kept", func(t *testing.T) {
+		metrics.ReplicaDeletesSkipped.Reset()
+		replica := &versionedReplica{updatedAt: "2024-03-01T10:05:00Z"}
+		dynamoHelper = awsutils.NewDynamoDBHelper(replica, replicaTable)
+
+		assert.NoError(t, handleDelete(context.Background(), deleteEvent))
+
+		assert.Len(t, replica.deletes, 1)
+		assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ReplicaDeletesSkipped.WithLabelValues("orders")))
+	})
+
+	t.Run("unversioned item is deleted unconditionally", func(t *testing.T) {
+		replica := &versionedReplica{updatedAt: "2024-03-01T10:05:00Z"}
+		dynamoHelper = awsutils.NewDynamoDBHelper(replica, replicaTable)
+		unversioned := *deleteEvent
+		unversioned.Before = map[string]interface{}{"id": "order-1"}
+
+		assert.NoError(t, handleDelete(context.Background(), &unversioned))
+
+		if assert.Len(t, replica.deletes, 1) {
+			assert.Nil(t, replica.deletes[0].ConditionExpression)
+		}
+	})
+}
+
+// missingReplica has no items, failing conditional updates like DynamoDB would
+type missingReplica struct {
+	awsutils.DynamoDBAPI
+	updates []*dynamodb.UpdateItemInput
+	puts    []*dynamodb.PutItemInput
+}
+
+func (r *missingReplica) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	r.updates = append(r.updates, params)
+	return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+}
+
+func (r *missingReplica) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	r.puts = append(r.puts, params)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func TestReplicateUpdate_MissingReplicaPutsFullItem(t *testing.T) {
+	originalHelper := dynamoHelper
+	defer func() { dynamoHelper = originalHelper }()
+	replica := &missingReplica{}
+	dynamoHelper = awsutils.NewDynamoDBHelper(replica, "replica-table")
+
+	event := &wguevents.CDCEvent{
+		Operation:   wguevents.OperationUpdate,
+		TableName:   "orders",
+		PrimaryKeys: map[string]interface{}{"id": "order-1"},
+		Before:      map[string]interface{}{"id": "order-1", "status": "new", "total": 10},
+		After:       map[string]interface{}{"id": "order-1", "status": "shipped", "total": 10},
+	}
+
+	assert.NoError(t, replicateUpdate(context.Background(), event))
+
+	if assert.Len(t, replica.updates, 1) {
+		assert.Equal(t, "attribute_exists(#key)", aws.ToString(replica.updates[0].ConditionExpression))
+	}
+	if assert.Len(t, replica.puts, 1) {
+		assert.Len(t, replica.puts[0].Item, 3)
+		assert.Equal(t, &types.AttributeValueMemberS{Value: "shipped"}, replica.puts[0].Item["status"])
+	}
+}
+
 func TestSendToDLQ_EventCreation(t *testing.T) {
 	cdcEvent := &wguevents.CDCEvent{
 		Operation: wguevents.OperationInsert,
@@ -464,3 +590,637 @@ func TestConvertAttributeValues_EmptyStringsNotIncluded(t *testing.T) {
 	assert.Len(t, result, 1)
 	assert.Contains(t, result, "id")
 }
+
+func TestToCDCEvent_StreamViewTypes(t *testing.T) {
+	keys := map[string]events.DynamoDBAttributeValue{
+		"id": events.NewStringAttribute("item-1"),
+	}
+	newImage := map[string]events.DynamoDBAttributeValue{
+		"id":    events.NewStringAttribute("item-1"),
+		"count": events.NewNumberAttribute("2"),
+	}
+	oldImage := map[string]events.DynamoDBAttributeValue{
+		"id":    events.NewStringAttribute("item-1"),
+		"count": events.NewNumberAttribute("1"),
+	}
+
+	tests := []struct {
+		name              string
+		eventName         string
+		viewType          string
+		newImage          map[string]events.DynamoDBAttributeValue
+		oldImage          map[string]events.DynamoDBAttributeValue
+		expectAfter       bool
+		expectBefore      bool
+		imagesUnavailable bool
+		missingImages     []string
+	}{
+		{
+			name:              "keys only modify",
+			eventName:         "MODIFY",
+			viewType:          wguevents.StreamViewKeysOnly,
+			imagesUnavailable: true,
+		},
+		{
+			name:         "new and old images modify",
+			eventName:    "MODIFY",
+			viewType:     wguevents.StreamViewNewAndOldImages,
+			newImage:     newImage,
+			oldImage:     oldImage,
+			expectAfter:  true,
+			expectBefore: true,
+		},
+		{
+			name:          "new and old images modify missing old image",
+			eventName:     "MODIFY",
+			viewType:      wguevents.StreamViewNewAndOldImages,
+			newImage:      newImage,
+			expectAfter:   true,
+			missingImages: []string{wguevents.ImageOld},
+		},
+		{
+			name:        "new image insert",
+			eventName:   "INSERT",
+			viewType:    wguevents.StreamViewNewImage,
+			newImage:    newImage,
+			expectAfter: true,
+		},
+		{
+			name:          "new image insert missing new image",
+			eventName:     "INSERT",
+			viewType:      wguevents.StreamViewNewImage,
+			missingImages: []string{wguevents.ImageNew},
+		},
+		{
+			name:         "old image remove",
+			eventName:    "REMOVE",
+			viewType:     wguevents.StreamViewOldImage,
+			oldImage:     oldImage,
+			expectBefore: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := events.DynamoDBEventRecord{
+				EventID:   "view-type-test",
+				EventName: tt.eventName,
+				Change: events.DynamoDBStreamRecord{
+					Keys:           keys,
+					NewImage:       tt.newImage,
+					OldImage:       tt.oldImage,
+					StreamViewType: tt.viewType,
+				},
+			}
+
+			cdcEvent, err := toCDCEvent(record)
+
+			assert.NoError(t, err)
+			assert.NotEmpty(t, cdcEvent.PrimaryKeys)
+			assert.Equal(t, tt.viewType, cdcEvent.Metadata.StreamViewType)
+			assert.Equal(t, tt.expectAfter, len(cdcEvent.After) > 0)
+			assert.Equal(t, tt.expectBefore, len(cdcEvent.Before) > 0)
+			assert.Equal(t, tt.imagesUnavailable, cdcEvent.Metadata.ImagesUnavailable)
+			assert.Equal(t, tt.missingImages, cdcEvent.Metadata.MissingImages)
+		})
+	}
+}
+
+// queueRecorder records the error types of the dead-lettered events sent to
+// each queue
+type queueRecorder struct {
+	errorTypes map[string][]string
+	batches    int
+}
+
+func (q *queueRecorder) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	q.batches++
+	output := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		var event wguevents.DeadLetterEvent
+		if err := json.Unmarshal([]byte(aws.ToString(entry.MessageBody)), &event); err != nil {
+			return nil, err
+		}
+		queueURL := aws.ToString(params.QueueUrl)
+		q.errorTypes[queueURL] = append(q.errorTypes[queueURL], event.ErrorType)
+		output.Successful = append(output.Successful, sqstypes.SendMessageBatchResultEntry{Id: entry.Id})
+	}
+	return output, nil
+}
+
+// failingBatchSender fails every dead-letter batch
+type failingBatchSender struct{}
+
+func (failingBatchSender) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	return nil, assert.AnError
+}
+
+func TestHandler_FailsWhenDeadLettersArentSent(t *testing.T) {
+	originalBatcher := dlqBatcher
+	defer func() { dlqBatcher = originalBatcher }()
+
+	dlqBatcher = awsutils.NewDeadLetterBatcher(&queueRecorder{errorTypes: make(map[string][]string)}, awsutils.DeadLetterPolicy{RetryQueueURL: dlqURL}, "stream-processor")
+	assert.NoError(t, Handler(context.Background(), events.DynamoDBEvent{}))
+
+	// A record dead-lettered as invalid succeeds only once its event is sent
+	dlqBatcher = awsutils.NewDeadLetterBatcher(failingBatchSender{}, awsutils.DeadLetterPolicy{RetryQueueURL: dlqURL}, "stream-processor")
+	event := &wguevents.CDCEvent{Operation: wguevents.OperationInsert, TableName: "test-table"}
+	assert.NoError(t, sendToDLQ(context.Background(), event, wguevents.ErrInvalidUTF8, ""))
+
+	err := Handler(context.Background(), events.DynamoDBEvent{})
+	var batchErr *awsutils.DeadLetterBatchError
+	assert.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 0, dlqBatcher.Pending())
+}
+
+func TestSendToDLQ_RoutesByErrorType(t *testing.T) {
+	originalBatcher := dlqBatcher
+	defer func() { dlqBatcher = originalBatcher }()
+
+	client := &queueRecorder{errorTypes: make(map[string][]string)}
+	dlqBatcher = awsutils.NewDeadLetterBatcher(client, awsutils.DeadLetterPolicy{
+		RetryQueueURL: dlqURL,
+		ErrorQueueURLs: map[string]string{
+			wguevents.ErrorTypeValidationFailure: "https://sqs.us-west-2.amazonaws.com/123456789012/review",
+		},
+	}, "stream-processor")
+
+	event := &wguevents.CDCEvent{Operation: wguevents.OperationInsert, TableName: "test-table"}
+	assert.NoError(t, sendToDLQ(context.Background(), event, wguevents.ErrInvalidUTF8, ""))
+	assert.NoError(t, sendToDLQ(context.Background(), event, fmt.Errorf("%w: TRUNCATE", errUnknownOperation), ""))
+	assert.NoError(t, sendToDLQ(context.Background(), event, assert.AnError, ""))
+
+	// Events are sent in a batch per queue on flush
+	assert.Equal(t, 0, client.batches)
+	assert.NoError(t, dlqBatcher.Flush(context.Background()))
+	assert.Equal(t, 2, client.batches)
+
+	assert.Equal(t, map[string][]string{
+		"https://sqs.us-west-2.amazonaws.com/123456789012/review": {
+			wguevents.ErrorTypeValidationFailure,
+			wguevents.ErrorTypeValidationFailure,
+		},
+		dlqURL: {wguevents.ErrorTypeProcessingFailure},
+	}, client.errorTypes)
+}
+
+func TestNewDLQEvent_DiagnosticContext(t *testing.T) {
+	arn := "arn:aws:dynamodb:us-west-2:123456789012:table/events/stream/2024-01-01T00:00:00.000"
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID: "req-abc-123",
+	})
+
+	dlqEvent, err := newDLQEvent(ctx, &wguevents.CDCEvent{Operation: wguevents.OperationInsert, TableName: "test-table"}, assert.AnError, arn)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cdc_processing_failure", dlqEvent.ErrorType)
+	assert.Equal(t, "req-abc-123", dlqEvent.RequestID)
+	assert.Equal(t, currentRegion, dlqEvent.Region)
+	assert.Equal(t, arn, dlqEvent.EventSourceARN)
+	assert.NotEmpty(t, dlqEvent.OriginalEvent)
+}
+
+func TestNewDLQEvent_WithoutLambdaContext(t *testing.T) {
+	dlqEvent, err := newDLQEvent(context.Background(), &wguevents.CDCEvent{Operation: wguevents.OperationInsert, TableName: "test-table"}, assert.AnError, "")
+
+	assert.NoError(t, err)
+	assert.Empty(t, dlqEvent.RequestID)
+	assert.Empty(t, dlqEvent.EventSourceARN)
+
+	body, err := json.Marshal(dlqEvent)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "request_id")
+}
+
+func TestProcessBatch_Concurrent(t *testing.T) {
+	originalWorkers := batchWorkers
+	batchWorkers = 10
+	defer func() { batchWorkers = originalWorkers }()
+
+	records := make([]events.DynamoDBEventRecord, 50)
+	for i := range records {
+		records[i] = events.DynamoDBEventRecord{
+			EventID:   fmt.Sprintf("event-%d", i),
+			EventName: "INSERT",
+			Change: events.DynamoDBStreamRecord{
+				Keys: map[string]events.DynamoDBAttributeValue{
+					"id": events.NewStringAttribute(fmt.Sprintf("item-%d", i%20)),
+				},
+			},
+		}
+	}
+
+	var mu sync.Mutex
+	processed := make(map[string]int)
+
+	errs := processBatch(context.Background(), records, func(ctx context.Context, record events.DynamoDBEventRecord) error {
+		mu.Lock()
+		processed[record.EventID]++
+		mu.Unlock()
+		if strings.HasSuffix(record.EventID, "7") {
+			return fmt.Errorf("failed %s", record.EventID)
+		}
+		return nil
+	})
+
+	assert.Len(t, errs, len(records))
+	assert.Len(t, processed, len(records))
+	for i, record := range records {
+		assert.Equal(t, 1, processed[record.EventID])
+		if strings.HasSuffix(record.EventID, "7") {
+			assert.EqualError(t, errs[i], "failed "+record.EventID)
+		} else {
+			assert.NoError(t, errs[i])
+		}
+	}
+}
+
+func TestProcessBatch_RecoversPanic(t *testing.T) {
+	originalWorkers, originalDeadLetterPanic := batchWorkers, deadLetterPanic
+	batchWorkers = 4
+	defer func() { batchWorkers, deadLetterPanic = originalWorkers, originalDeadLetterPanic }()
+
+	var mu sync.Mutex
+	deadLettered := make(map[string]*batch.PanicError)
+	deadLetterPanic = func(ctx context.Context, record events.DynamoDBEventRecord, panicErr *batch.PanicError) error {
+		mu.Lock()
+		defer mu.Unlock()
+		deadLettered[record.EventID] = panicErr
+		return nil
+	}
+
+	records := make([]events.DynamoDBEventRecord, 6)
+	for i := range records {
+		records[i] = events.DynamoDBEventRecord{
+			EventID:   fmt.Sprintf("event-%d", i),
+			EventName: "INSERT",
+		}
+	}
+
+	var processed sync.Map
+	errs := processBatch(context.Background(), records, func(ctx context.Context, record events.DynamoDBEventRecord) error {
+		if record.EventID == "event-3" {
+			var payload map[string]interface{}
+			_ = payload["id"].(string)
+		}
+		processed.Store(record.EventID, true)
+		return nil
+	})
+
+	// The panicking record is dead-lettered, so the whole batch succeeds
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	for _, record := range records {
+		_, ok := processed.Load(record.EventID)
+		assert.Equal(t, record.EventID != "event-3", ok, record.EventID)
+	}
+	assert.Len(t, deadLettered, 1)
+	if panicErr := deadLettered["event-3"]; assert.NotNil(t, panicErr) {
+		assert.Contains(t, panicErr.Error(), "interface conversion")
+		assert.NotEmpty(t, panicErr.Stack)
+	}
+}
+
+func TestProcessBatch_PanicFailsRecordWhenDLQFails(t *testing.T) {
+	originalDeadLetterPanic := deadLetterPanic
+	defer func() { deadLetterPanic = originalDeadLetterPanic }()
+
+	deadLetterPanic = func(ctx context.Context, record events.DynamoDBEventRecord, panicErr *batch.PanicError) error {
+		return panicErr
+	}
+
+	records := []events.DynamoDBEventRecord{{EventID: "event-0"}, {EventID: "event-1"}}
+	errs := processBatch(context.Background(), records, func(ctx context.Context, record events.DynamoDBEventRecord) error {
+		if record.EventID == "event-1" {
+			panic("unexpected payload")
+		}
+		return nil
+	})
+
+	assert.NoError(t, errs[0])
+	assert.EqualError(t, errs[1], "panic: unexpected payload")
+}
+
+func TestIsStale(t *testing.T) {
+	maxAgePolicy = wguevents.MaxAgePolicy{"INSERT": time.Hour}
+	defer func() { maxAgePolicy = nil }()
+	metrics.StaleEventsDropped.Reset()
+
+	record := func(eventName string, age time.Duration) events.DynamoDBEventRecord {
+		return events.DynamoDBEventRecord{
+			EventID:   "event-" + eventName,
+			EventName: eventName,
+			Change: events.DynamoDBStreamRecord{
+				ApproximateCreationDateTime: events.SecondsEpochTime{Time: time.Now().Add(-age)},
+				Keys: map[string]events.DynamoDBAttributeValue{
+					"id": events.NewStringAttribute("item-123"),
+				},
+			},
+		}
+	}
+
+	// Fresh events and event types without a max age are processed
+	assert.False(t, isStale(record("INSERT", time.Minute)))
+	assert.False(t, isStale(record("MODIFY", 48*time.Hour)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.StaleEventsDropped.WithLabelValues("stream-processor", "INSERT")))
+
+	// An event older than its max age is dropped and metered without being applied
+	assert.NoError(t, processStreamRecord(context.Background(), record("INSERT", 2*time.Hour)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.StaleEventsDropped.WithLabelValues("stream-processor", "INSERT")))
+}
+
+func TestToCDCEvent_CompositeKeySchema(t *testing.T) {
+	keySchemas = wguevents.KeySchemas{"events": {PartitionKey: "customerId", SortKey: "orderId"}}
+	defer func() { keySchemas = nil }()
+
+	record := func(keys map[string]events.DynamoDBAttributeValue) events.DynamoDBEventRecord {
+		return events.DynamoDBEventRecord{
+			EventID:        "remove-event-1",
+			EventName:      "REMOVE",
+			EventSourceArn: "arn:aws:dynamodb:us-west-2:123456789012:table/events/stream/2024-01-01T00:00:00.000",
+			Change: events.DynamoDBStreamRecord{
+				StreamViewType: wguevents.StreamViewKeysOnly,
+				Keys:           keys,
+			},
+		}
+	}
+
+	// Only the configured partition and sort keys are extracted
+	cdcEvent, err := toCDCEvent(record(map[string]events.DynamoDBAttributeValue{
+		"customerId": events.NewStringAttribute("customer-1"),
+		"orderId":    events.NewStringAttribute("order-1"),
+		"shard":      events.NewNumberAttribute("3"),
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"customerId": "customer-1",
+		"orderId":    "order-1",
+	}, cdcEvent.PrimaryKeys)
+
+	// A record without the configured sort key is rejected
+	_, err = toCDCEvent(record(map[string]events.DynamoDBAttributeValue{
+		"customerId": events.NewStringAttribute("customer-1"),
+	}))
+	assert.ErrorContains(t, err, `missing key attribute "orderId"`)
+}
+
+// recordingSink records the detail types published to it
+type recordingSink struct {
+	mu          sync.Mutex
+	detailTypes []string
+	details     []interface{}
+}
+
+func (s *recordingSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.detailTypes = append(s.detailTypes, detailType)
+	s.details = append(s.details, detail)
+	return nil
+}
+
+func TestProcessStreamRecord_SkipsNoOpModify(t *testing.T) {
+	originalPublisher, originalReplica := publisher, replicaTable
+	defer func() { publisher, replicaTable = originalPublisher, originalReplica }()
+	sink := &recordingSink{}
+	publisher = sink
+	replicaTable = ""
+	skipped := testutil.ToFloat64(functionMetrics.NoOpSkipped)
+
+	record := func(newStatus string) events.DynamoDBEventRecord {
+		return events.DynamoDBEventRecord{
+			EventID:   "modify-" + newStatus,
+			EventName: "MODIFY",
+			Change: events.DynamoDBStreamRecord{
+				StreamViewType: wguevents.StreamViewNewAndOldImages,
+				Keys:           map[string]events.DynamoDBAttributeValue{"id": events.NewStringAttribute("item-1")},
+				OldImage: map[string]events.DynamoDBAttributeValue{
+					"id":     events.NewStringAttribute("item-1"),
+					"status": events.NewStringAttribute("active"),
+				},
+				NewImage: map[string]events.DynamoDBAttributeValue{
+					"id":     events.NewStringAttribute("item-1"),
+					"status": events.NewStringAttribute(newStatus),
+				},
+			},
+		}
+	}
+
+	// An identical before/after image is skipped without replicating
+	assert.NoError(t, processStreamRecord(context.Background(), record("active")))
+	assert.Empty(t, sink.detailTypes)
+	assert.Equal(t, skipped+1, testutil.ToFloat64(metrics.NoOpSkipped.WithLabelValues("stream-processor")))
+
+	// A real change is still replicated
+	assert.NoError(t, processStreamRecord(context.Background(), record("inactive")))
+	assert.Equal(t, []string{"cdc.events.update"}, sink.detailTypes)
+	assert.Equal(t, skipped+1, testutil.ToFloat64(metrics.NoOpSkipped.WithLabelValues("stream-processor")))
+}
+
+func TestProcessStreamRecord_TypedKeys(t *testing.T) {
+	originalPublisher, originalReplica, originalTypedKeys := publisher, replicaTable, typedKeys
+	defer func() { publisher, replicaTable, typedKeys = originalPublisher, originalReplica, originalTypedKeys }()
+	sink := &recordingSink{}
+	publisher = sink
+	replicaTable = ""
+
+	record := events.DynamoDBEventRecord{
+		EventID:   "insert-composite",
+		EventName: "INSERT",
+		Change: events.DynamoDBStreamRecord{
+			StreamViewType: wguevents.StreamViewNewImage,
+			Keys: map[string]events.DynamoDBAttributeValue{
+				"customerId": events.NewStringAttribute("customer-1"),
+				"orderNo":    events.NewNumberAttribute("1001"),
+			},
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"customerId": events.NewStringAttribute("customer-1"),
+				"orderNo":    events.NewNumberAttribute("1001"),
+			},
+		},
+	}
+
+	// Off by default
+	typedKeys = false
+	assert.NoError(t, processStreamRecord(context.Background(), record))
+	if assert.Len(t, sink.details, 1) {
+		assert.NotContains(t, sink.details[0].(*wguevents.BaseEvent).Payload, "typed_keys")
+	}
+
+	typedKeys = true
+	assert.NoError(t, processStreamRecord(context.Background(), record))
+	if !assert.Len(t, sink.details, 2) {
+		return
+	}
+
+	// Consumers see the types after the event goes over the wire
+	body, err := json.Marshal(sink.details[1])
+	assert.NoError(t, err)
+	var published struct {
+		Payload struct {
+			TypedKeys map[string]awsutils.TypedKey `json:"typed_keys"`
+		} `json:"payload"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &published))
+	assert.Equal(t, map[string]awsutils.TypedKey{
+		"customerId": {Type: "S", Value: "customer-1"},
+		"orderNo":    {Type: "N", Value: "1001"},
+	}, published.Payload.TypedKeys)
+
+	key, err := awsutils.TypedKeyAttributeValues(published.Payload.TypedKeys)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "1001"}, key["orderNo"])
+}
+
+func invalidUTF8Record() events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventID:   "insert-binary",
+		EventName: "INSERT",
+		Change: events.DynamoDBStreamRecord{
+			StreamViewType: wguevents.StreamViewNewImage,
+			Keys:           map[string]events.DynamoDBAttributeValue{"id": events.NewStringAttribute("item-1")},
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"id":   events.NewStringAttribute("item-1"),
+				"name": events.NewStringAttribute("caf\xe9"),
+				"city": events.NewStringAttribute("Kraków"),
+			},
+		},
+	}
+}
+
+func TestProcessStreamRecord_SanitizesInvalidUTF8(t *testing.T) {
+	originalPublisher, originalReplica, originalPolicy := publisher, replicaTable, utf8Policy
+	defer func() { publisher, replicaTable, utf8Policy = originalPublisher, originalReplica, originalPolicy }()
+	sink := &recordingSink{}
+	publisher = sink
+	replicaTable = ""
+	utf8Policy = wguevents.UTF8Replace
+	metrics.InvalidUTF8Events.Reset()
+
+	assert.NoError(t, processStreamRecord(context.Background(), invalidUTF8Record()))
+
+	if assert.Len(t, sink.details, 1) {
+		data := sink.details[0].(*wguevents.BaseEvent).Payload["after"].(map[string]interface{})
+		assert.Equal(t, "caf�", data["name"])
+		// Valid strings are untouched
+		assert.Equal(t, "Kraków", data["city"])
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.InvalidUTF8Events.WithLabelValues("stream-processor", "sanitized")))
+}
+
+func TestProcessStreamRecord_DeadLettersInvalidUTF8(t *testing.T) {
+	originalPublisher, originalReplica, originalPolicy, originalDeadLetter := publisher, replicaTable, utf8Policy, deadLetter
+	defer func() {
+		publisher, replicaTable, utf8Policy, deadLetter = originalPublisher, originalReplica, originalPolicy, originalDeadLetter
+	}()
+	sink := &recordingSink{}
+	publisher = sink
+	replicaTable = ""
+	utf8Policy = wguevents.UTF8DeadLetter
+	metrics.InvalidUTF8Events.Reset()
+
+	var deadLettered []*wguevents.CDCEvent
+	deadLetter = func(ctx context.Context, event *wguevents.CDCEvent, processingError error, eventSourceARN string) error {
+		assert.ErrorIs(t, processingError, wguevents.ErrInvalidUTF8)
+		deadLettered = append(deadLettered, event)
+		return nil
+	}
+
+	assert.NoError(t, processStreamRecord(context.Background(), invalidUTF8Record()))
+
+	assert.Empty(t, sink.detailTypes)
+	if assert.Len(t, deadLettered, 1) {
+		// The original bytes are kept for inspection
+		assert.Equal(t, "caf\xe9", deadLettered[0].After["name"])
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.InvalidUTF8Events.WithLabelValues("stream-processor", "dead_lettered")))
+}
+
+// flakyReplica fails replica writes until it is fixed
+type flakyReplica struct {
+	awsutils.DynamoDBAPI
+	fixed bool
+	puts  int
+}
+
+func (r *flakyReplica) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if !r.fixed {
+		return nil, assert.AnError
+	}
+	r.puts++
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// messageRecorder records the dead-letter messages sent to each queue
+type messageRecorder struct {
+	queues   []string
+	messages []events.SQSMessage
+}
+
+func (m *messageRecorder) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.queues = append(m.queues, aws.ToString(params.QueueUrl))
+	m.messages = append(m.messages, events.SQSMessage{
+		MessageId: fmt.Sprintf("msg-%d", len(m.messages)+1),
+		Body:      aws.ToString(params.MessageBody),
+	})
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestReplayHandler_CountsRepeatFailuresUntilParked(t *testing.T) {
+	originalHelper, originalReplica, originalPublisher, originalReplayer := dynamoHelper, replicaTable, publisher, dlqReplayer
+	defer func() {
+		dynamoHelper, replicaTable, publisher, dlqReplayer = originalHelper, originalReplica, originalPublisher, originalReplayer
+	}()
+	replica := &flakyReplica{}
+	dynamoHelper = awsutils.NewDynamoDBHelper(replica, "replica-table")
+	replicaTable = "replica-table"
+	sink := &recordingSink{}
+	publisher = sink
+
+	queue := &messageRecorder{}
+	permanentURL := "https://sqs.us-west-2.amazonaws.com/123456789012/permanent-failures"
+	dlqReplayer = awsutils.NewDeadLetterReplayer(awsutils.NewDeadLetterRouter(queue, awsutils.DeadLetterPolicy{
+		RetryQueueURL:     dlqURL,
+		PermanentQueueURL: permanentURL,
+		MaxFailures:       3,
+	}, "stream-processor"), logger)
+
+	// The first failure is dead-lettered from the stream
+	event := &wguevents.CDCEvent{
+		Operation:   wguevents.OperationInsert,
+		TableName:   "orders",
+		PrimaryKeys: map[string]interface{}{"id": "order-1"},
+		After:       map[string]interface{}{"id": "order-1"},
+	}
+	dlqEvent, err := newDLQEvent(context.Background(), event, assert.AnError, "")
+	assert.NoError(t, err)
+	body, err := json.Marshal(dlqEvent)
+	assert.NoError(t, err)
+	message := events.SQSMessage{MessageId: "msg-0", Body: string(body)}
+
+	// Each replay that fails again goes back with one more failure, until
+	// the event is parked
+	for _, wantQueue := range []string{dlqURL, permanentURL} {
+		response, err := ReplayHandler(context.Background(), events.SQSEvent{Records: []events.SQSMessage{message}})
+		assert.NoError(t, err)
+		assert.Empty(t, response.BatchItemFailures)
+		assert.Equal(t, wantQueue, queue.queues[len(queue.queues)-1])
+		message = queue.messages[len(queue.messages)-1]
+	}
+
+	var parked wguevents.DeadLetterEvent
+	assert.NoError(t, json.Unmarshal([]byte(message.Body), &parked))
+	assert.Equal(t, 3, parked.FailureCount)
+	assert.Equal(t, wguevents.ErrorTypeProcessingFailure, parked.ErrorType)
+	assert.Equal(t, dlqEvent.FirstFailure.UTC(), parked.FirstFailure.UTC())
+
+	// Once the replica recovers, a replay applies and publishes the event
+	replica.fixed = true
+	response, err := ReplayHandler(context.Background(), events.SQSEvent{Records: []events.SQSMessage{message}})
+	assert.NoError(t, err)
+	assert.Empty(t, response.BatchItemFailures)
+	assert.Len(t, queue.messages, 2)
+	assert.Equal(t, 1, replica.puts)
+	assert.Equal(t, []string{"cdc.orders.insert"}, sink.detailTypes)
+}
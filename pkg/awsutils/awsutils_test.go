@@ -1,11 +1,44 @@
 package awsutils
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	lambdaevents "github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/wgu/go-performance-enablement/pkg/batch"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestWithTimeout(t *testing.T) {
@@ -95,6 +128,76 @@ func TestEventBridgePublisher_PublishEventBatch_BatchSplitting(t *testing.T) {
 	assert.Equal(t, expectedBatches, calculatedBatches)
 }
 
+func batchEvents(n int) []EventBridgeEvent {
+	events := make([]EventBridgeEvent, n)
+	for i := range events {
+		events[i] = EventBridgeEvent{DetailType: "test-event", Detail: map[string]interface{}{"id": i}}
+	}
+	return events
+}
+
+func indexRange(from, to int) []int {
+	var indices []int
+	for i := from; i < to; i++ {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+func TestEventBridgePublisher_PublishEventBatch_SecondBatchFails(t *testing.T) {
+	unavailable := mockPutEventsResponse{err: errors.New("service unavailable")}
+	client := &mockEventBridge{responses: []mockPutEventsResponse{
+		{},
+		// The second batch fails its first attempt and all three retries
+		unavailable, unavailable, unavailable, unavailable,
+		{},
+		{},
+	}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	publisher.sleep = func(time.Duration) {}
+	events := batchEvents(25)
+
+	err := publisher.PublishEventBatch(context.Background(), events)
+
+	var batchErr *BatchPublishError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Equal(t, indexRange(10, 20), batchErr.Result.Failed)
+		assert.Equal(t, append(indexRange(0, 10), indexRange(20, 25)...), batchErr.Result.Succeeded)
+		assert.ErrorContains(t, err, "batch starting at index 10")
+	}
+	assert.Len(t, client.calls, 6)
+
+	// Retrying re-sends only the second batch's events
+	retry := batchErr.Result.FailedEvents(events)
+	assert.NoError(t, publisher.PublishEventBatch(context.Background(), retry))
+	assert.Len(t, client.calls, 7)
+	assert.Len(t, client.calls[6].Entries, 10)
+	assert.Contains(t, aws.ToString(client.calls[6].Entries[0].Detail), `"id":10`)
+}
+
+func TestEventBridgePublisher_PublishEventBatchResult_FailedEntries(t *testing.T) {
+	// Entry 3 is rejected on every attempt; the rest go through first time
+	failEntry := func(n, failed int) mockPutEventsResponse {
+		entries := make([]ebtypes.PutEventsResultEntry, n)
+		entries[failed] = ebtypes.PutEventsResultEntry{ErrorCode: aws.String("InternalFailure"), ErrorMessage: aws.String("internal error")}
+		return mockPutEventsResponse{output: &eventbridge.PutEventsOutput{FailedEntryCount: 1, Entries: entries}}
+	}
+	client := &mockEventBridge{responses: []mockPutEventsResponse{
+		failEntry(5, 3), failEntry(1, 0), failEntry(1, 0), failEntry(1, 0),
+	}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	publisher.sleep = func(time.Duration) {}
+
+	result := publisher.PublishEventBatchResult(context.Background(), batchEvents(5))
+
+	assert.Equal(t, []int{3}, result.Failed)
+	assert.Equal(t, []int{0, 1, 2, 4}, result.Succeeded)
+	assert.ErrorContains(t, result.Err(), "InternalFailure")
+	for _, call := range client.calls[1:] {
+		assert.Len(t, call.Entries, 1)
+	}
+}
+
 func TestNewDynamoDBHelper(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -155,6 +258,47 @@ func TestEventBridgeEvent_Structure(t *testing.T) {
 	assert.Equal(t, 123, detail["key2"])
 }
 
+func TestEventBridgePublisher_BuildEventEntry_Resources(t *testing.T) {
+	publisher := NewEventBridgePublisher(nil, "bus", "test")
+	resources := []string{
+		"arn:aws:dynamodb:us-west-2:123456789012:table/orders",
+		"arn:aws:iam::123456789012:tenant/acme",
+	}
+
+	entry, err := publisher.buildEventEntry(EventBridgeEvent{
+		DetailType:  "test.event",
+		Detail:      map[string]string{"k": "v"},
+		Resources:   resources,
+		TraceHeader: "Root=1-5759e988-bd862e3fe1be46a994272793",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, resources, entry.Resources)
+	assert.Equal(t, "Root=1-5759e988-bd862e3fe1be46a994272793", aws.ToString(entry.TraceHeader))
+
+	entry, err = publisher.buildEventEntry(EventBridgeEvent{
+		DetailType: "test.event",
+		Detail:     map[string]string{"k": "v"},
+		Resources:  []string{},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, entry.Resources)
+	assert.Nil(t, entry.TraceHeader)
+}
+
+func TestEventBridgePublisher_PublishEntry(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	publisher := NewEventBridgePublisher(client, "bus", "test")
+
+	err := publisher.PublishEntry(context.Background(), EventBridgeEvent{
+		DetailType: "test.event",
+		Detail:     map[string]string{"k": "v"},
+		Resources:  []string{"arn:aws:dynamodb:us-west-2:123456789012:table/orders"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, client.calls, 1)
+	assert.Equal(t, []string{"arn:aws:dynamodb:us-west-2:123456789012:table/orders"}, client.calls[0].Entries[0].Resources)
+}
+
 func TestEventBridgePublisher_PublishCrossRegionEvent_Format(t *testing.T) {
 	// Test cross-region event detail type formatting
 	targetRegion := "us-east-1"
@@ -165,30 +309,3177 @@ func TestEventBridgePublisher_PublishCrossRegionEvent_Format(t *testing.T) {
 	assert.Equal(t, expectedDetailType, formattedDetailType)
 }
 
-// TestAWSClients_GetRegion would test the GetRegion method
-// but requires a real aws.Config which has unexported fields
-// In production, use AWS SDK test helpers or integration tests
+type timedDetail struct {
+	At time.Time `json:"at"`
+}
 
-func TestPublishEntries_RetryLogic(t *testing.T) {
-	// Test that retry logic is configured correctly
+func (d *timedDetail) EventTime() time.Time {
+	return d.At
+}
+
+func TestEventBridgePublisher_BuildEntry_Time(t *testing.T) {
+	original := time.Date(2024, 1, 15, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		useEventTime bool
+		detail       interface{}
+		explicit     time.Time
+		expected     time.Time // zero means "now"
+	}{
+		{"explicit time wins", false, map[string]string{"k": "v"}, original, original},
+		{"explicit time wins over detail", true, &timedDetail{At: original.Add(time.Hour)}, original, original},
+		{"detail timestamp when enabled", true, &timedDetail{At: original}, time.Time{}, original},
+		{"detail timestamp ignored when disabled", false, &timedDetail{At: original}, time.Time{}, time.Time{}},
+		{"zero detail timestamp defaults to now", true, &timedDetail{}, time.Time{}, time.Time{}},
+		{"detail without timestamp defaults to now", true, map[string]string{"k": "v"}, time.Time{}, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := NewEventBridgePublisher(nil, "test-bus", "test-source")
+			publisher.SetUseEventTime(tt.useEventTime)
+
+			before := time.Now()
+			entry, err := publisher.buildEntry("test.event", tt.detail, tt.explicit)
+
+			assert.NoError(t, err)
+			assert.NotNil(t, entry.Time)
+			if tt.expected.IsZero() {
+				assert.False(t, entry.Time.Before(before))
+				assert.WithinDuration(t, time.Now(), *entry.Time, time.Second)
+			} else {
+				assert.Equal(t, tt.expected, *entry.Time)
+			}
+		})
+	}
+}
+
+func TestEventBridgePublisher_BuildEntry_Envelope(t *testing.T) {
 	publisher := NewEventBridgePublisher(nil, "test-bus", "test-source")
-	
-	assert.Equal(t, 3, publisher.maxRetry)
-	assert.Equal(t, defaultTimeout, publisher.timeout)
-	
-	// Test that publisher is initialized with correct defaults
-	assert.NotNil(t, publisher)
+	event := events.NewBaseEvent("test.event", "us-west-2", map[string]interface{}{"k": "v"})
+
+	// Disabled by default: the bare event is published
+	entry, err := publisher.buildEntry("test.event", event, time.Time{})
+	assert.NoError(t, err)
+	_, ok := events.ParseEnvelope([]byte(*entry.Detail))
+	assert.False(t, ok)
+
+	publisher.SetWrapEnvelope(true)
+
+	entry, err = publisher.buildEntry("test.event", event, time.Time{})
+	assert.NoError(t, err)
+	envelope, ok := events.ParseEnvelope([]byte(*entry.Detail))
+	if assert.True(t, ok) {
+		assert.Equal(t, events.KindBase, envelope.EventKind)
+		unwrapped, err := envelope.Unwrap()
+		assert.NoError(t, err)
+		assert.Equal(t, event.EventID, unwrapped.(*events.BaseEvent).EventID)
+	}
+
+	// Unknown detail types pass through unwrapped
+	entry, err = publisher.buildEntry("test.event", map[string]string{"k": "v"}, time.Time{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"k":"v"}`, *entry.Detail)
 }
 
-func TestEventBridgeConstants(t *testing.T) {
-	assert.Equal(t, 10*time.Second, defaultTimeout)
-	assert.Equal(t, 10, maxBatchSize)
+func TestAttributeValues_RoundTrip(t *testing.T) {
+	item := map[string]interface{}{
+		"id":     "item-123",
+		"count":  float64(42),
+		"price":  99.95,
+		"active": true,
+		"tags":   []interface{}{"a", "b"},
+		"profile": map[string]interface{}{
+			"name": "Jane",
+			"address": map[string]interface{}{
+				"zip":   "84101",
+				"lines": []interface{}{"1 Main St", float64(2)},
+			},
+		},
+		"nothing": nil,
+	}
+
+	av, err := MarshalToAttributeValues(item)
+	assert.NoError(t, err)
+
+	assert.IsType(t, &types.AttributeValueMemberS{}, av["id"])
+	assert.IsType(t, &types.AttributeValueMemberN{}, av["count"])
+	assert.IsType(t, &types.AttributeValueMemberBOOL{}, av["active"])
+	assert.IsType(t, &types.AttributeValueMemberL{}, av["tags"])
+	assert.IsType(t, &types.AttributeValueMemberM{}, av["profile"])
+	assert.IsType(t, &types.AttributeValueMemberNULL{}, av["nothing"])
+
+	roundTripped, err := UnmarshalFromAttributeValues(av)
+	assert.NoError(t, err)
+	assert.Equal(t, item, roundTripped)
 }
 
-func TestDynamoDBBatchSizeConstant(t *testing.T) {
-	// DynamoDB batch write limit is 25
-	// This test ensures we're aware of the limit
-	assert.LessOrEqual(t, 25, 25, "DynamoDB batch size should be <= 25")
+func TestUnmarshalFromAttributeValues_Empty(t *testing.T) {
+	item, err := UnmarshalFromAttributeValues(nil)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, item)
+	assert.Empty(t, item)
+}
+
+func TestBuildDiffUpdate(t *testing.T) {
+	before := map[string]interface{}{
+		"id":      "cust-123",
+		"name":    "John",
+		"email":   "john@example.com",
+		"status":  "active",
+		"tags":    []interface{}{"a", "b"},
+		"comment": "to be removed",
+	}
+	after := map[string]interface{}{
+		"id":     "cust-123",
+		"name":   "Johnny",
+		"email":  "john@example.com",
+		"status": "active",
+		"tags":   []interface{}{"a", "b", "c"},
+		"tier":   "gold",
+	}
+
+	update, err := BuildDiffUpdate(before, after, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, "SET #a0 = :v0, #a1 = :v1, #a2 = :v2 REMOVE #a3", update.Expression)
+	assert.Equal(t, map[string]string{
+		"#a0": "name",
+		"#a1": "tags",
+		"#a2": "tier",
+		"#a3": "comment",
+	}, update.Names)
+
+	assert.Len(t, update.Values, 3)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "Johnny"}, update.Values[":v0"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "gold"}, update.Values[":v2"])
+	tags, ok := update.Values[":v1"].(*types.AttributeValueMemberL)
+	assert.True(t, ok)
+	assert.Len(t, tags.Value, 3)
+}
+
+func TestBuildDiffUpdate_RemoveOnly(t *testing.T) {
+	update, err := BuildDiffUpdate(
+		map[string]interface{}{"id": "1", "nickname": "JJ"},
+		map[string]interface{}{"id": "1"},
+		"id",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "REMOVE #a0", update.Expression)
+	assert.Equal(t, map[string]string{"#a0": "nickname"}, update.Names)
+	assert.Nil(t, update.Values)
+}
+
+func TestBuildDiffUpdate_NoChanges(t *testing.T) {
+	image := map[string]interface{}{"id": "1", "name": "John", "age": 42}
+	update, err := BuildDiffUpdate(image, image, "id")
+	assert.NoError(t, err)
+	assert.Nil(t, update)
+}
+
+func TestBuildDiffUpdate_NeverTouchesKeys(t *testing.T) {
+	update, err := BuildDiffUpdate(
+		map[string]interface{}{"pk": "1", "sk": "a"},
+		map[string]interface{}{"pk": "2", "name": "John"},
+		"pk", "sk",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "SET #a0 = :v0", update.Expression)
+	assert.Equal(t, map[string]string{"#a0": "name"}, update.Names)
+}
+
+func TestSetTTL(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: "item-123"},
+	}
+
+	before := time.Now().Add(time.Hour).Unix()
+	SetTTL(item, "expires_at", time.Hour)
+	after := time.Now().Add(time.Hour).Unix()
+
+	n, ok := item["expires_at"].(*types.AttributeValueMemberN)
+	if assert.True(t, ok, "TTL must be a Number attribute") {
+		seconds, err := strconv.ParseInt(n.Value, 10, 64)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, seconds, before)
+		assert.LessOrEqual(t, seconds, after)
+	}
+
+	expiresAt, err := GetTTL(item, "expires_at")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, 2*time.Second)
+
+	expired, err := TTLExpired(item, "expires_at")
+	assert.NoError(t, err)
+	assert.False(t, expired)
+}
+
+func TestSetTTLAt_EpochSeconds(t *testing.T) {
+	item := map[string]types.AttributeValue{}
+	SetTTLAt(item, "ttl", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "1767225600"}, item["ttl"])
+}
+
+func TestTTLExpired_PastDue(t *testing.T) {
+	item := map[string]types.AttributeValue{}
+	SetTTL(item, "ttl", -time.Minute)
+
+	expired, err := TTLExpired(item, "ttl")
+	assert.NoError(t, err)
+	assert.True(t, expired)
+}
+
+func TestGetTTL_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		item map[string]types.AttributeValue
+	}{
+		{
+			name: "missing attribute",
+			item: map[string]types.AttributeValue{},
+		},
+		{
+			name: "string attribute",
+			item: map[string]types.AttributeValue{"ttl": &types.AttributeValueMemberS{Value: "1767225600"}},
+		},
+		{
+			name: "fractional seconds",
+			item: map[string]types.AttributeValue{"ttl": &types.AttributeValueMemberN{Value: "1767225600.5"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetTTL(tt.item, "ttl")
+			assert.Error(t, err)
+
+			_, err = TTLExpired(tt.item, "ttl")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStreamTableName(t *testing.T) {
+	tests := []struct {
+		arn   string
+		table string
+	}{
+		{"arn:aws:dynamodb:us-west-2:123456789012:table/Orders/stream/2024-01-01T00:00:00.000", "Orders"},
+		{"arn:aws:dynamodb:us-east-1:123456789012:table/users", "users"},
+		{"arn:aws:sqs:us-west-2:123456789012:queue", ""},
+		{"arn:aws:dynamodb:us-west-2:123456789012:backup/Orders", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.table, StreamTableName(tt.arn), tt.arn)
+	}
+}
+
+func TestStreamRecordKey(t *testing.T) {
+	composite := map[string]lambdaevents.DynamoDBAttributeValue{
+		"sk": lambdaevents.NewNumberAttribute("42"),
+		"pk": lambdaevents.NewStringAttribute("customer#1"),
+	}
+	reordered := map[string]lambdaevents.DynamoDBAttributeValue{
+		"pk": lambdaevents.NewStringAttribute("customer#1"),
+		"sk": lambdaevents.NewNumberAttribute("42"),
+	}
+
+	assert.Equal(t, "pk=customer#1|sk=42", StreamRecordKey(composite))
+	assert.Equal(t, StreamRecordKey(composite), StreamRecordKey(reordered))
+	assert.Equal(t, "id=AQI=", StreamRecordKey(map[string]lambdaevents.DynamoDBAttributeValue{
+		"id": lambdaevents.NewBinaryAttribute([]byte{1, 2}),
+	}))
+	assert.Equal(t, "", StreamRecordKey(nil))
+}
+
+func TestStreamTypedKeys(t *testing.T) {
+	keys := map[string]lambdaevents.DynamoDBAttributeValue{
+		"pk":   lambdaevents.NewStringAttribute("customer#1"),
+		"sk":   lambdaevents.NewNumberAttribute("42.50"),
+		"hash": lambdaevents.NewBinaryAttribute([]byte{1, 2}),
+		"flag": lambdaevents.NewBooleanAttribute(true),
+	}
+
+	typed := StreamTypedKeys(keys)
+	assert.Equal(t, map[string]TypedKey{
+		"pk":   {Type: "S", Value: "customer#1"},
+		"sk":   {Type: "N", Value: "42.50"},
+		"hash": {Type: "B", Value: "AQI="},
+	}, typed)
+
+	key, err := TypedKeyAttributeValues(typed)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.AttributeValue{
+		"pk":   &types.AttributeValueMemberS{Value: "customer#1"},
+		"sk":   &types.AttributeValueMemberN{Value: "42.50"},
+		"hash": &types.AttributeValueMemberB{Value: []byte{1, 2}},
+	}, key)
+}
+
+func TestTypedKeyAttributeValues_Invalid(t *testing.T) {
+	_, err := TypedKeyAttributeValues(map[string]TypedKey{"pk": {Type: "BOOL", Value: "true"}})
+	assert.ErrorContains(t, err, `unsupported type "BOOL"`)
+
+	_, err = TypedKeyAttributeValues(map[string]TypedKey{"pk": {Type: "B", Value: "not base64!"}})
+	assert.ErrorContains(t, err, "invalid binary value")
+}
+
+func TestIsNoOpModify(t *testing.T) {
+	image := func(status string, tags ...string) map[string]lambdaevents.DynamoDBAttributeValue {
+		list := make([]lambdaevents.DynamoDBAttributeValue, len(tags))
+		for i, tag := range tags {
+			list[i] = lambdaevents.NewStringAttribute(tag)
+		}
+		return map[string]lambdaevents.DynamoDBAttributeValue{
+			"id":     lambdaevents.NewStringAttribute("item-1"),
+			"status": lambdaevents.NewStringAttribute(status),
+			"tags":   lambdaevents.NewListAttribute(list),
+		}
+	}
+	record := func(eventName string, oldImage, newImage map[string]lambdaevents.DynamoDBAttributeValue) lambdaevents.DynamoDBEventRecord {
+		return lambdaevents.DynamoDBEventRecord{
+			EventName: eventName,
+			Change: lambdaevents.DynamoDBStreamRecord{
+				Keys:     map[string]lambdaevents.DynamoDBAttributeValue{"id": lambdaevents.NewStringAttribute("item-1")},
+				OldImage: oldImage,
+				NewImage: newImage,
+			},
+		}
+	}
+
+	assert.True(t, IsNoOpModify(record("MODIFY", image("active", "a"), image("active", "a"))))
+	assert.False(t, IsNoOpModify(record("MODIFY", image("active", "a"), image("inactive", "a"))))
+	assert.False(t, IsNoOpModify(record("MODIFY", image("active", "a"), image("active", "a", "b"))))
+
+	// Without both images the change can't be seen, so it is never skipped
+	assert.False(t, IsNoOpModify(record("MODIFY", nil, nil)))
+	assert.False(t, IsNoOpModify(record("MODIFY", nil, image("active", "a"))))
+	assert.False(t, IsNoOpModify(record("INSERT", image("active", "a"), image("active", "a"))))
+}
+
+const testEventBridgeEvent = `{
+	"version": "0",
+	"id": "6a7e8feb-b491-4cf7-a9f1-bf3703467718",
+	"source": "stream-processor",
+	"detail-type": "cdc.INSERT",
+	"account": "123456789012",
+	"region": "us-west-2",
+	"resources": [],
+	"detail": {
+		"event_type": "customer.created",
+		"source_region": "us-west-2",
+		"priority": 7,
+		"tags": ["vip", "beta"],
+		"metadata": {"tenant_id": "tenant-42"},
+		"deleted_at": null
+	}
+}`
+
+func TestEventPattern_Matches(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		expected bool
+	}{
+		{"matching source and detail-type", `{"source": ["stream-processor"], "detail-type": ["cdc.INSERT", "cdc.UPDATE"]}`, true},
+		{"non-matching source", `{"source": ["event-router"]}`, false},
+		{"nested detail value", `{"detail": {"metadata": {"tenant_id": ["tenant-42"]}}}`, true},
+		{"nested detail mismatch", `{"detail": {"metadata": {"tenant_id": ["tenant-7"]}}}`, false},
+		{"prefix match", `{"detail-type": [{"prefix": "cdc."}]}`, true},
+		{"prefix mismatch", `{"detail-type": [{"prefix": "health."}]}`, false},
+		{"suffix match", `{"detail": {"event_type": [{"suffix": ".created"}]}}`, true},
+		{"equals-ignore-case", `{"detail-type": [{"equals-ignore-case": "CDC.insert"}]}`, true},
+		{"exists true on present field", `{"detail": {"priority": [{"exists": true}]}}`, true},
+		{"exists true on missing field", `{"detail": {"user_id": [{"exists": true}]}}`, false},
+		{"exists false on missing field", `{"detail": {"user_id": [{"exists": false}]}}`, true},
+		{"exists false on present field", `{"detail": {"priority": [{"exists": false}]}}`, false},
+		{"exists false under missing object", `{"detail": {"audit": {"actor": [{"exists": false}]}}}`, true},
+		{"exists does not match intermediate objects", `{"detail": {"metadata": [{"exists": true}]}}`, false},
+		{"exists true on null value", `{"detail": {"deleted_at": [{"exists": true}]}}`, true},
+		{"null literal", `{"detail": {"deleted_at": [null]}}`, true},
+		{"numeric range match", `{"detail": {"priority": [{"numeric": [">", 5, "<=", 10]}]}}`, true},
+		{"numeric range mismatch", `{"detail": {"priority": [{"numeric": [">", 7]}]}}`, false},
+		{"numeric literal", `{"detail": {"priority": [7]}}`, true},
+		{"string does not equal number", `{"detail": {"priority": ["7"]}}`, false},
+		{"array value matches any element", `{"detail": {"tags": ["beta"]}}`, true},
+		{"anything-but match", `{"source": [{"anything-but": ["event-router", "health-checker"]}]}`, true},
+		{"anything-but mismatch", `{"source": [{"anything-but": "stream-processor"}]}`, false},
+		{"anything-but prefix", `{"detail-type": [{"anything-but": {"prefix": "health."}}]}`, true},
+		{"anything-but on missing field", `{"detail": {"user_id": [{"anything-but": "x"}]}}`, false},
+		{"all fields must match", `{"source": ["stream-processor"], "detail-type": ["cdc.DELETE"]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, err := MatchEventPattern(tt.pattern, []byte(testEventBridgeEvent))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, matched)
+		})
+	}
+}
+
+func TestEventPattern_InvalidPatterns(t *testing.T) {
+	patterns := []string{
+		`not json`,
+		`{}`,
+		`{"source": "stream-processor"}`,
+		`{"source": [{"prefix": 1}]}`,
+		`{"source": [{"wildcard-ish": "x"}]}`,
+		`{"detail": {"priority": [{"numeric": [">"]}]}}`,
+		`{"detail": {"priority": [{"numeric": ["!=", 1]}]}}`,
+		`{"detail": {"priority": [{"exists": "yes"}]}}`,
+	}
+
+	for _, pattern := range patterns {
+		_, err := NewEventPattern(pattern)
+		assert.Error(t, err, "pattern %s should be rejected", pattern)
+	}
+}
+
+func TestEventPattern_MatchesEntry(t *testing.T) {
+	pattern, err := NewEventPattern(`{
+		"source": ["stream-processor"],
+		"detail-type": [{"prefix": "cdc."}],
+		"detail": {"source_region": ["us-west-2"]}
+	}`)
+	assert.NoError(t, err)
+
+	publisher := NewEventBridgePublisher(nil, "test-bus", "stream-processor")
+	event := events.NewBaseEvent("cdc.INSERT", "us-west-2", map[string]interface{}{"table": "customers"})
+
+	entry, err := publisher.buildEntry("cdc.INSERT", event, time.Time{})
+	assert.NoError(t, err)
+	matched, err := pattern.MatchesEntry(entry)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	entry, err = publisher.buildEntry("health.check", event, time.Time{})
+	assert.NoError(t, err)
+	matched, err = pattern.MatchesEntry(entry)
+	assert.NoError(t, err)
+	assert.False(t, matched)
+}
+
+// mockEventBridge is a scripted EventBridgeAPI: each PutEvents call pops the
+// next response, repeating the last one once exhausted
+type mockEventBridge struct {
+	responses []mockPutEventsResponse
+	calls     []*eventbridge.PutEventsInput
+}
+
+type mockPutEventsResponse struct {
+	output *eventbridge.PutEventsOutput
+	err    error
+}
+
+func (m *mockEventBridge) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	m.calls = append(m.calls, params)
+	idx := len(m.calls) - 1
+	if idx >= len(m.responses) {
+		idx = len(m.responses) - 1
+	}
+	resp := m.responses[idx]
+	if resp.output == nil && resp.err == nil {
+		return &eventbridge.PutEventsOutput{}, nil
+	}
+	return resp.output, resp.err
+}
+
+func TestPublishEntries_TooManyEntries(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	entries := make([]ebtypes.PutEventsRequestEntry, maxBatchSize+1)
+
+	err := publisher.publishEntries(context.Background(), entries)
+
+	assert.ErrorIs(t, err, ErrTooManyEntries)
+	assert.Contains(t, err.Error(), "11 entries exceed the limit of 10")
+	assert.Empty(t, client.calls)
+}
+
+func TestPublishEntries_MaxEntries(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	entries := make([]ebtypes.PutEventsRequestEntry, maxBatchSize)
+
+	err := publisher.publishEntries(context.Background(), entries)
+
+	assert.NoError(t, err)
+	assert.Len(t, client.calls, 1)
+	assert.Len(t, client.calls[0].Entries, maxBatchSize)
+}
+
+func TestPublishEvent_GlobalEndpoint(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	publisher.SetGlobalEndpoint("abcde.veo")
+
+	assert.NoError(t, publisher.PublishEvent(context.Background(), "order.created", map[string]string{"id": "1"}))
+
+	assert.Len(t, client.calls, 1)
+	assert.Equal(t, "abcde.veo", aws.ToString(client.calls[0].EndpointId))
+	assert.Equal(t, "test-bus", aws.ToString(client.calls[0].Entries[0].EventBusName))
+}
+
+func TestPublishEvent_RegionalBusByDefault(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+
+	assert.NoError(t, publisher.PublishEvent(context.Background(), "order.created", map[string]string{"id": "1"}))
+
+	assert.Len(t, client.calls, 1)
+	assert.Nil(t, client.calls[0].EndpointId)
+}
+
+func TestPublishEventResult_Success(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{
+		output: &eventbridge.PutEventsOutput{Entries: []ebtypes.PutEventsResultEntry{{EventId: aws.String("eb-event-1")}}},
+	}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+
+	result, err := publisher.PublishEventResult(context.Background(), "order.created", map[string]string{"id": "1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "eb-event-1", result.EventID)
+	assert.False(t, result.Failed())
+}
+
+func TestPublishEventResult_EntryFailure(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{
+		output: &eventbridge.PutEventsOutput{
+			FailedEntryCount: 1,
+			Entries: []ebtypes.PutEventsResultEntry{{
+				ErrorCode:    aws.String("MalformedDetail"),
+				ErrorMessage: aws.String("Detail is malformed."),
+			}},
+		},
+	}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	publisher.sleep = func(time.Duration) {}
+
+	result, err := publisher.PublishEventResult(context.Background(), "order.created", map[string]string{"id": "1"})
+
+	assert.Error(t, err)
+	assert.True(t, result.Failed())
+	assert.Equal(t, "MalformedDetail", result.ErrorCode)
+	assert.Equal(t, "Detail is malformed.", result.ErrorMessage)
+	assert.Empty(t, result.EventID)
+
+	var entryErr *EntryError
+	if assert.ErrorAs(t, err, &entryErr) {
+		assert.Equal(t, "MalformedDetail", entryErr.Code)
+		assert.Equal(t, "Detail is malformed.", entryErr.Message)
+	}
+
+	// PublishEvent surfaces the same entry error
+	err = publisher.PublishEvent(context.Background(), "order.created", map[string]string{"id": "1"})
+	assert.ErrorAs(t, err, &entryErr)
+	assert.EqualError(t, entryErr, "entry failed with code MalformedDetail: Detail is malformed.")
+}
+
+func TestPublishEventResult_RetriedEntrySucceeds(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{
+		{output: &eventbridge.PutEventsOutput{
+			FailedEntryCount: 1,
+			Entries:          []ebtypes.PutEventsResultEntry{{ErrorCode: aws.String("InternalFailure"), ErrorMessage: aws.String("retry")}},
+		}},
+		{output: &eventbridge.PutEventsOutput{Entries: []ebtypes.PutEventsResultEntry{{EventId: aws.String("eb-event-2")}}}},
+	}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	publisher.sleep = func(time.Duration) {}
+
+	result, err := publisher.PublishEventResult(context.Background(), "order.created", map[string]string{"id": "1"})
+
+	assert.NoError(t, err)
+	assert.Len(t, client.calls, 2)
+	assert.Equal(t, &PublishResult{EventID: "eb-event-2"}, result)
+}
+
+func TestPublishEventResult_APIError(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{err: &smithy.GenericAPIError{Code: "AccessDeniedException"}}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	publisher.sleep = func(time.Duration) {}
+
+	result, err := publisher.PublishEventResult(context.Background(), "order.created", map[string]string{"id": "1"})
+
+	assert.Error(t, err)
+	assert.False(t, result.Failed())
+	assert.Empty(t, result.EventID)
+}
+
+func TestGlobalEndpointResolution(t *testing.T) {
+	// The SDK routes requests carrying an EndpointId to the global endpoint
+	endpoint, err := eventbridge.NewDefaultEndpointResolverV2().ResolveEndpoint(context.Background(), eventbridge.EndpointParameters{
+		Region:     aws.String("us-west-2"),
+		EndpointId: aws.String("abcde.veo"),
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "abcde.veo.endpoint.events.amazonaws.com", endpoint.URI.Host)
+}
+
+func TestPublishEntries_ThrottlingMetric(t *testing.T) {
+	metrics.EventBridgeThrottled.Reset()
+
+	client := &mockEventBridge{responses: []mockPutEventsResponse{
+		{err: &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}},
+		{output: &eventbridge.PutEventsOutput{
+			FailedEntryCount: 1,
+			Entries: []ebtypes.PutEventsResultEntry{
+				{ErrorCode: aws.String("ThrottlingException"), ErrorMessage: aws.String("Rate exceeded")},
+			},
+		}},
+		{output: &eventbridge.PutEventsOutput{}},
+	}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	var sleeps []time.Duration
+	publisher.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	err := publisher.PublishEvent(context.Background(), "test.event", map[string]string{"k": "v"})
+
+	assert.NoError(t, err)
+	assert.Len(t, client.calls, 3)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.EventBridgeThrottled.WithLabelValues("test-bus", "test-source")))
+	assert.Equal(t, []time.Duration{
+		publisher.backoff(1, true),
+		publisher.backoff(2, true),
+	}, sleeps)
+}
+
+func TestPublishEntries_ThrottleBacksOffMoreThanGenericError(t *testing.T) {
+	metrics.EventBridgeThrottled.Reset()
+
+	run := func(err error) []time.Duration {
+		client := &mockEventBridge{responses: []mockPutEventsResponse{{err: err}}}
+		publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+		var sleeps []time.Duration
+		publisher.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+		publishErr := publisher.PublishEvent(context.Background(), "test.event", map[string]string{"k": "v"})
+		assert.Error(t, publishErr)
+		assert.Len(t, client.calls, publisher.maxRetry+1)
+		return sleeps
+	}
+
+	throttledSleeps := run(&smithy.GenericAPIError{Code: "ThrottlingException"})
+	genericSleeps := run(errors.New("connection reset"))
+
+	assert.Len(t, throttledSleeps, len(genericSleeps))
+	for i := range genericSleeps {
+		assert.Greater(t, throttledSleeps[i], genericSleeps[i])
+	}
+	assert.Equal(t, float64(4), testutil.ToFloat64(metrics.EventBridgeThrottled.WithLabelValues("test-bus", "test-source")))
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := NewRetryBudget(2)
+
+	assert.True(t, budget.Take())
+	assert.True(t, budget.Take())
+	assert.False(t, budget.Take())
+	assert.True(t, budget.Exhausted())
+	assert.Equal(t, 0, budget.Remaining())
+
+	var unlimited *RetryBudget
+	assert.True(t, unlimited.Take())
+	assert.False(t, unlimited.Exhausted())
+}
+
+func TestRetryBudgetFromContext(t *testing.T) {
+	assert.Nil(t, RetryBudgetFromContext(context.Background()))
+
+	budget := NewRetryBudget(5)
+	ctx := WithRetryBudget(context.Background(), budget)
+	assert.Same(t, budget, RetryBudgetFromContext(ctx))
+}
+
+func TestPublishEntries_SharedRetryBudget(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{err: errors.New("connection reset")}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	publisher.sleep = func(time.Duration) {}
+
+	budget := NewRetryBudget(4)
+	ctx := WithRetryBudget(context.Background(), budget)
+
+	var errs []error
+	for i := 0; i < 10; i++ {
+		errs = append(errs, publisher.PublishEvent(ctx, "test.event", map[string]int{"record": i}))
+	}
+
+	// The first record uses its 3 retries, the second the last retry, the
+	// rest fail without calling EventBridge
+	assert.Len(t, client.calls, 4+2)
+	for i, err := range errs {
+		assert.Error(t, err)
+		if i >= 1 {
+			assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+		}
+	}
+	assert.NotErrorIs(t, errs[0], ErrRetryBudgetExhausted)
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"throttling exception", &smithy.GenericAPIError{Code: "ThrottlingException"}, true},
+		{"wrapped throttling exception", fmt.Errorf("publish: %w", &smithy.GenericAPIError{Code: "ThrottlingException"}), true},
+		{"other API error", &smithy.GenericAPIError{Code: "InternalException"}, false},
+		{"plain error", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isThrottlingError(tt.err))
+		})
+	}
+}
+
+// TestAWSClients_GetRegion would test the GetRegion method
+// but requires a real aws.Config which has unexported fields
+// In production, use AWS SDK test helpers or integration tests
+
+func TestPublishEntries_RetryLogic(t *testing.T) {
+	// Test that retry logic is configured correctly
+	publisher := NewEventBridgePublisher(nil, "test-bus", "test-source")
+	
+	assert.Equal(t, 3, publisher.maxRetry)
+	assert.Equal(t, defaultTimeout, publisher.timeout)
+	
+	// Test that publisher is initialized with correct defaults
+	assert.NotNil(t, publisher)
+}
+
+// sdkError builds an error shaped like the SDK's: a service API error inside
+// an HTTP response error that carries the request ID
+func sdkError(code, requestID string) error {
+	return &awshttp.ResponseError{
+		RequestID: requestID,
+		ResponseError: &smithyhttp.ResponseError{
+			Err: &smithy.GenericAPIError{Code: code, Message: "simulated failure"},
+		},
+	}
+}
+
+func TestExtractErrorDetails(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorDetails
+	}{
+		{"nil error", nil, ErrorDetails{}},
+		{"plain error", errors.New("boom"), ErrorDetails{}},
+		{"api error without request ID", &smithy.GenericAPIError{Code: "ValidationException"}, ErrorDetails{Code: "ValidationException"}},
+		{"sdk error", sdkError("ThrottlingException", "req-123"), ErrorDetails{Code: "ThrottlingException", RequestID: "req-123"}},
+		{"wrapped sdk error", fmt.Errorf("failed to publish events: %w", sdkError("InternalException", "req-456")), ErrorDetails{Code: "InternalException", RequestID: "req-456"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details := ExtractErrorDetails(tt.err)
+			assert.Equal(t, tt.want, details)
+			assert.Equal(t, tt.want == ErrorDetails{}, details.IsZero())
+		})
+	}
+}
+
+func TestErrorField(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+
+	err := fmt.Errorf("failed to put item: %w", sdkError("ProvisionedThroughputExceededException", "req-789"))
+	logger.Error("aws failure", zap.Error(err), ErrorField(err))
+	logger.Error("plain failure", ErrorField(errors.New("boom")))
+
+	entries := logs.All()
+	assert.Len(t, entries, 2)
+
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "ProvisionedThroughputExceededException", fields["aws_error_code"])
+	assert.Equal(t, "req-789", fields["aws_request_id"])
+
+	assert.Empty(t, entries[1].ContextMap())
+}
+
+func TestAnnotateDeadLetterEvent(t *testing.T) {
+	dlqEvent := &events.DeadLetterEvent{}
+	AnnotateDeadLetterEvent(dlqEvent, fmt.Errorf("failed to send: %w", sdkError("AccessDeniedException", "req-abc")))
+
+	assert.Equal(t, "AccessDeniedException", dlqEvent.AWSErrorCode)
+	assert.Equal(t, "req-abc", dlqEvent.AWSRequestID)
+}
+
+func TestEventSinkImplementations(t *testing.T) {
+	var _ EventSink = (*EventBridgePublisher)(nil)
+	var _ EventSink = (*FileSink)(nil)
+	var _ EventSink = (*BufferedSink)(nil)
+	var _ BatchPublisher = (*EventBridgePublisher)(nil)
+}
+
+func TestFileSink_WritesNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewFileSink(&buf, "stream-processor")
+	fixed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return fixed }
+
+	event := events.NewBaseEvent(events.EventTypeOrderPlaced, "us-west-2", map[string]interface{}{"order_id": "o-1"})
+	assert.NoError(t, sink.Publish(context.Background(), event.EventType, event))
+	assert.NoError(t, sink.Publish(context.Background(), CrossRegionDetailType("us-east-1"), map[string]string{"k": "v"}))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 2)
+
+	var first fileSinkRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, "stream-processor", first.Source)
+	assert.Equal(t, events.EventTypeOrderPlaced, first.DetailType)
+	assert.True(t, fixed.Equal(first.Time))
+	detail, ok := first.Detail.(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, event.EventID, detail["event_id"])
+
+	var second fileSinkRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	assert.Equal(t, "cross-region.us-east-1", second.DetailType)
+}
+
+func TestOpenFileSink_Appends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+
+	for i := 0; i < 2; i++ {
+		sink, err := OpenFileSink(path, "event-router")
+		assert.NoError(t, err)
+		assert.NoError(t, sink.Publish(context.Background(), "test.event", map[string]int{"n": i}))
+		assert.NoError(t, sink.Close())
+	}
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.True(t, json.Valid([]byte(line)), line)
+	}
+}
+
+func TestSelectEventSink(t *testing.T) {
+	eventBridge := NewEventBridgePublisher(&mockEventBridge{}, "bus", "test")
+
+	sink, err := SelectEventSink("", "", eventBridge, "test")
+	assert.NoError(t, err)
+	assert.Same(t, eventBridge, sink)
+
+	sink, err = SelectEventSink(SinkEventBridge, "", eventBridge, "test")
+	assert.NoError(t, err)
+	assert.Same(t, eventBridge, sink)
+
+	sink, err = SelectEventSink(SinkFile, "-", eventBridge, "test")
+	assert.NoError(t, err)
+	assert.IsType(t, &FileSink{}, sink)
+
+	_, err = SelectEventSink("kinesis", "", eventBridge, "test")
+	assert.Error(t, err)
+}
+
+// mockSQS records the queues messages are sent to
+type mockSQS struct {
+	queues []string
+	inputs []*sqs.SendMessageInput
+	err    error
+}
+
+func (m *mockSQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.queues = append(m.queues, aws.ToString(params.QueueUrl))
+	m.inputs = append(m.inputs, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestDeadLetterPolicy(t *testing.T) {
+	policy := DeadLetterPolicy{RetryQueueURL: "retry", PermanentQueueURL: "permanent", MaxFailures: 3}
+
+	assert.Equal(t, "retry", policy.QueueURL(1))
+	assert.Equal(t, "retry", policy.QueueURL(2))
+	assert.Equal(t, "permanent", policy.QueueURL(3))
+	assert.Equal(t, "permanent", policy.QueueURL(10))
+
+	// No limit, or nowhere to park, keeps every event retryable
+	assert.False(t, DeadLetterPolicy{RetryQueueURL: "retry", PermanentQueueURL: "permanent"}.Permanent(100))
+	assert.False(t, DeadLetterPolicy{RetryQueueURL: "retry", MaxFailures: 3}.Permanent(100))
+}
+
+func TestDeadLetterRouter_Send(t *testing.T) {
+	metrics.DLQMessages.Reset()
+	metrics.PermanentFailures.Reset()
+
+	client := &mockSQS{}
+	router := NewDeadLetterRouter(client, DeadLetterPolicy{
+		RetryQueueURL:     "https://sqs.us-west-2.amazonaws.com/123456789012/retry-dlq",
+		PermanentQueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/permanent-failures",
+		MaxFailures:       3,
+	}, "event-router")
+
+	below := &events.DeadLetterEvent{ErrorMessage: "timeout", ErrorType: "routing_failure", FailureCount: 2}
+	assert.NoError(t, router.Send(context.Background(), below))
+
+	at := &events.DeadLetterEvent{ErrorMessage: "timeout", ErrorType: "routing_failure", FailureCount: 3}
+	assert.NoError(t, router.Send(context.Background(), at))
+
+	assert.Equal(t, []string{
+		"https://sqs.us-west-2.amazonaws.com/123456789012/retry-dlq",
+		"https://sqs.us-west-2.amazonaws.com/123456789012/permanent-failures",
+	}, client.queues)
+	assert.Equal(t, "3", aws.ToString(client.inputs[1].MessageAttributes["FailureCount"].StringValue))
+
+	var sent events.DeadLetterEvent
+	assert.NoError(t, json.Unmarshal([]byte(aws.ToString(client.inputs[1].MessageBody)), &sent))
+	assert.Equal(t, 3, sent.FailureCount)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.DLQMessages.WithLabelValues("event-router", "routing_failure")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.PermanentFailures.WithLabelValues("event-router", "routing_failure")))
+}
+
+func TestDeadLetterPolicy_ErrorQueueURLs(t *testing.T) {
+	policy := DeadLetterPolicy{
+		RetryQueueURL:     "retry",
+		PermanentQueueURL: "permanent",
+		MaxFailures:       3,
+		ErrorQueueURLs:    map[string]string{"validation_failure": "review"},
+	}
+
+	assert.Equal(t, "review", policy.QueueURLFor("validation_failure", 1))
+	assert.Equal(t, "retry", policy.QueueURLFor("routing_failure", 1))
+	assert.Equal(t, "retry", policy.QueueURL(1))
+	// Repeat failures are parked whatever their type
+	assert.Equal(t, "permanent", policy.QueueURLFor("validation_failure", 3))
+}
+
+func TestDeadLetterRouter_SendByErrorType(t *testing.T) {
+	metrics.DLQMessages.Reset()
+
+	client := &mockSQS{}
+	router := NewDeadLetterRouter(client, DeadLetterPolicy{
+		RetryQueueURL: "https://sqs.us-west-2.amazonaws.com/123456789012/default-dlq",
+		ErrorQueueURLs: map[string]string{
+			"validation_failure": "https://sqs.us-west-2.amazonaws.com/123456789012/review",
+			"routing_failure":    "https://sqs.us-west-2.amazonaws.com/123456789012/retry",
+		},
+	}, "event-router")
+
+	for _, errorType := range []string{"validation_failure", "routing_failure", "panic"} {
+		assert.NoError(t, router.Send(context.Background(), &events.DeadLetterEvent{ErrorType: errorType, FailureCount: 1}))
+	}
+
+	assert.Equal(t, []string{
+		"https://sqs.us-west-2.amazonaws.com/123456789012/review",
+		"https://sqs.us-west-2.amazonaws.com/123456789012/retry",
+		"https://sqs.us-west-2.amazonaws.com/123456789012/default-dlq",
+	}, client.queues)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.DLQMessages.WithLabelValues("event-router", "validation_failure")))
+}
+
+func TestParseErrorQueueURLs(t *testing.T) {
+	urls, err := ParseErrorQueueURLs(" validation_failure=https://sqs.us-west-2.amazonaws.com/123456789012/review, ,routing_failure=https://sqs.us-west-2.amazonaws.com/123456789012/retry")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"validation_failure": "https://sqs.us-west-2.amazonaws.com/123456789012/review",
+		"routing_failure":    "https://sqs.us-west-2.amazonaws.com/123456789012/retry",
+	}, urls)
+
+	urls, err = ParseErrorQueueURLs("")
+	assert.NoError(t, err)
+	assert.Empty(t, urls)
+
+	for _, spec := range []string{"validation_failure", "=https://example.com/q", "validation_failure="} {
+		_, err := ParseErrorQueueURLs(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNewPanicDeadLetterEvent(t *testing.T) {
+	record := lambdaevents.DynamoDBEventRecord{
+		EventID:        "event-1",
+		EventName:      "MODIFY",
+		EventSourceArn: "arn:aws:dynamodb:us-west-2:123456789012:table/events/stream/2024",
+	}
+	panicErr := &batch.PanicError{Value: "unexpected payload", Stack: []byte("goroutine 1 [running]:")}
+
+	dlqEvent, err := NewPanicDeadLetterEvent(context.Background(), "stream-processor", "us-west-2", record, panicErr)
+
+	assert.NoError(t, err)
+	assert.Equal(t, events.ErrorTypePanic, dlqEvent.ErrorType)
+	assert.Equal(t, "panic: unexpected payload", dlqEvent.ErrorMessage)
+	assert.Equal(t, "goroutine 1 [running]:", dlqEvent.StackTrace)
+	assert.Equal(t, "stream-processor", dlqEvent.SourceHandler)
+	assert.Equal(t, 1, dlqEvent.FailureCount)
+	assert.Equal(t, "us-west-2", dlqEvent.Region)
+	assert.Equal(t, record.EventSourceArn, dlqEvent.EventSourceARN)
+
+	var original lambdaevents.DynamoDBEventRecord
+	assert.NoError(t, json.Unmarshal(dlqEvent.OriginalEvent, &original))
+	assert.Equal(t, "event-1", original.EventID)
+}
+
+func TestDeadLetterRouter_SendPanic(t *testing.T) {
+	record := lambdaevents.DynamoDBEventRecord{EventID: "event-1"}
+	panicErr := &batch.PanicError{Value: "unexpected payload", Stack: []byte("goroutine 1 [running]:")}
+
+	client := &mockSQS{}
+	router := NewDeadLetterRouter(client, DeadLetterPolicy{RetryQueueURL: "retry"}, "event-router")
+
+	// Dead-lettered, the record counts as handled
+	assert.NoError(t, router.SendPanic(context.Background(), zap.NewNop(), "us-west-2", record, panicErr))
+	if assert.Len(t, client.inputs, 1) {
+		var sent events.DeadLetterEvent
+		assert.NoError(t, json.Unmarshal([]byte(aws.ToString(client.inputs[0].MessageBody)), &sent))
+		assert.Equal(t, "event-router", sent.SourceHandler)
+		assert.Equal(t, events.ErrorTypePanic, sent.ErrorType)
+	}
+
+	// Otherwise the panic fails the record
+	router = NewDeadLetterRouter(&mockSQS{err: errors.New("sqs unavailable")}, DeadLetterPolicy{RetryQueueURL: "retry"}, "event-router")
+	assert.Same(t, panicErr, router.SendPanic(context.Background(), zap.NewNop(), "us-west-2", record, panicErr))
+}
+
+func TestParseDeadLetterMessage(t *testing.T) {
+	dlqEvent, err := ParseDeadLetterMessage(lambdaevents.SQSMessage{
+		MessageId: "msg-1",
+		Body:      `{"error_type":"routing_failure","failure_count":2}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dlqEvent.FailureCount)
+
+	// A body without a count takes the message attribute's
+	dlqEvent, err = ParseDeadLetterMessage(lambdaevents.SQSMessage{
+		MessageId:         "msg-2",
+		Body:              `{"error_type":"routing_failure"}`,
+		MessageAttributes: map[string]lambdaevents.SQSMessageAttribute{"FailureCount": {StringValue: aws.String("4"), DataType: "Number"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, dlqEvent.FailureCount)
+
+	_, err = ParseDeadLetterMessage(lambdaevents.SQSMessage{MessageId: "msg-3", Body: "not json"})
+	assert.ErrorContains(t, err, "msg-3")
+}
+
+func TestDeadLetterReplayer_Replay(t *testing.T) {
+	client := &mockSQS{}
+	router := NewDeadLetterRouter(client, DeadLetterPolicy{RetryQueueURL: "retry", PermanentQueueURL: "permanent", MaxFailures: 3}, "event-router")
+	replayer := NewDeadLetterReplayer(router, zap.NewNop())
+	failedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	replayer.now = func() time.Time { return failedAt }
+
+	message := func(id string, failureCount int) lambdaevents.SQSMessage {
+		body, err := json.Marshal(&events.DeadLetterEvent{
+			OriginalEvent: json.RawMessage(`{"event_id":"` + id + `"}`),
+			ErrorType:     events.ErrorTypeRoutingFailure,
+			FailureCount:  failureCount,
+		})
+		assert.NoError(t, err)
+		return lambdaevents.SQSMessage{MessageId: id, Body: string(body)}
+	}
+
+	response := replayer.Replay(context.Background(), lambdaevents.SQSEvent{Records: []lambdaevents.SQSMessage{
+		message("ok", 1),
+		message("fails", 1),
+		message("panics", 2),
+		{MessageId: "garbled", Body: "{"},
+	}}, func(ctx context.Context, dlqEvent *events.DeadLetterEvent) error {
+		switch string(dlqEvent.OriginalEvent) {
+		case `{"event_id":"fails"}`:
+			return errors.New("partner region unavailable")
+		case `{"event_id":"panics"}`:
+			panic("unexpected payload")
+		}
+		return nil
+	})
+
+	// Only the message that couldn't be read is redelivered
+	assert.Equal(t, []lambdaevents.SQSBatchItemFailure{{ItemIdentifier: "garbled"}}, response.BatchItemFailures)
+
+	// Repeat failures go back with the failure counted, the third parked
+	assert.Equal(t, []string{"retry", "permanent"}, client.queues)
+	var retried, parked events.DeadLetterEvent
+	assert.NoError(t, json.Unmarshal([]byte(aws.ToString(client.inputs[0].MessageBody)), &retried))
+	assert.NoError(t, json.Unmarshal([]byte(aws.ToString(client.inputs[1].MessageBody)), &parked))
+	assert.Equal(t, 2, retried.FailureCount)
+	assert.Equal(t, "partner region unavailable", retried.ErrorMessage)
+	assert.Equal(t, events.ErrorTypeRoutingFailure, retried.ErrorType)
+	assert.Equal(t, failedAt, retried.LastFailure)
+	assert.Equal(t, 3, parked.FailureCount)
+	assert.Equal(t, "panic: unexpected payload", parked.ErrorMessage)
+	assert.NotEmpty(t, parked.StackTrace)
+}
+
+func TestDeadLetterReplayer_RedeliversWhenRoutingFails(t *testing.T) {
+	router := NewDeadLetterRouter(&mockSQS{err: errors.New("sqs unavailable")}, DeadLetterPolicy{RetryQueueURL: "retry"}, "event-router")
+	replayer := NewDeadLetterReplayer(router, zap.NewNop())
+
+	response := replayer.Replay(context.Background(), lambdaevents.SQSEvent{Records: []lambdaevents.SQSMessage{
+		{MessageId: "msg-1", Body: `{"failure_count":1}`},
+	}}, func(ctx context.Context, dlqEvent *events.DeadLetterEvent) error {
+		return errors.New("still failing")
+	})
+
+	assert.Equal(t, []lambdaevents.SQSBatchItemFailure{{ItemIdentifier: "msg-1"}}, response.BatchItemFailures)
+}
+
+func TestParseMaxFailures(t *testing.T) {
+	maxFailures, err := ParseMaxFailures("5")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, maxFailures)
+
+	maxFailures, err = ParseMaxFailures("")
+	assert.NoError(t, err)
+	assert.Zero(t, maxFailures)
+
+	// 1 would send every first failure to the permanent queue
+	for _, value := range []string{"1", "0", "-3", "five"} {
+		_, err := ParseMaxFailures(value)
+		assert.Error(t, err, value)
+	}
+}
+
+// mockSQSBatch records SendMessageBatch calls, failing the entries whose
+// message bodies are in failBodies
+type mockSQSBatch struct {
+	mu         sync.Mutex
+	calls      []*sqs.SendMessageBatchInput
+	failBodies map[string]bool
+	err        error
+}
+
+func (m *mockSQSBatch) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	// SQS rejects a whole batch over 256 KiB
+	size := 0
+	for _, entry := range params.Entries {
+		size += messageSize(aws.ToString(entry.MessageBody), entry.MessageAttributes)
+	}
+	if size > 256<<10 {
+		return nil, &smithy.GenericAPIError{Code: "AWS.SimpleQueueService.BatchRequestTooLong"}
+	}
+
+	output := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		if m.failBodies[aws.ToString(entry.MessageBody)] {
+			output.Failed = append(output.Failed, sqstypes.BatchResultErrorEntry{
+				Id:      entry.Id,
+				Code:    aws.String("InvalidMessageContents"),
+				Message: aws.String("message contains invalid characters"),
+			})
+		} else {
+			output.Successful = append(output.Successful, sqstypes.SendMessageBatchResultEntry{Id: entry.Id})
+		}
+	}
+	return output, nil
+}
+
+func deadLetterEvents(n int) []*events.DeadLetterEvent {
+	dlqEvents := make([]*events.DeadLetterEvent, n)
+	for i := range dlqEvents {
+		dlqEvents[i] = &events.DeadLetterEvent{ErrorMessage: fmt.Sprintf("failure %d", i), ErrorType: "routing_failure", FailureCount: 1}
+	}
+	return dlqEvents
+}
+
+func TestDeadLetterBatcher_BatchesOfTen(t *testing.T) {
+	metrics.DLQMessages.Reset()
+
+	client := &mockSQSBatch{}
+	batcher := NewDeadLetterBatcher(client, DeadLetterPolicy{RetryQueueURL: "retry-dlq"}, "event-router")
+
+	for _, dlqEvent := range deadLetterEvents(25) {
+		assert.NoError(t, batcher.Add(context.Background(), dlqEvent))
+	}
+	// Full batches are sent as they fill
+	assert.Len(t, client.calls, 2)
+	assert.Equal(t, 5, batcher.Pending())
+
+	assert.NoError(t, batcher.Flush(context.Background()))
+
+	if assert.Len(t, client.calls, 3) {
+		assert.Len(t, client.calls[0].Entries, 10)
+		assert.Len(t, client.calls[1].Entries, 10)
+		assert.Len(t, client.calls[2].Entries, 5)
+	}
+	for _, call := range client.calls {
+		assert.Equal(t, "retry-dlq", aws.ToString(call.QueueUrl))
+	}
+	assert.Equal(t, "1", aws.ToString(client.calls[0].Entries[0].MessageAttributes["FailureCount"].StringValue))
+	assert.Equal(t, 0, batcher.Pending())
+	assert.Equal(t, float64(25), testutil.ToFloat64(metrics.DLQMessages.WithLabelValues("event-router", "routing_failure")))
+
+	// Nothing left to send
+	assert.NoError(t, batcher.Flush(context.Background()))
+	assert.Len(t, client.calls, 3)
+}
+
+func TestDeadLetterBatcher_SplitsBySize(t *testing.T) {
+	metrics.DLQMessages.Reset()
+
+	client := &mockSQSBatch{}
+	batcher := NewDeadLetterBatcher(client, DeadLetterPolicy{RetryQueueURL: "retry-dlq"}, "event-router")
+
+	// Two 100 KiB events fit in a batch, a third doesn't
+	original := json.RawMessage(`"` + strings.Repeat("x", 100<<10) + `"`)
+	dlqEvents := deadLetterEvents(5)
+	for _, dlqEvent := range dlqEvents {
+		dlqEvent.OriginalEvent = original
+		assert.NoError(t, batcher.Add(context.Background(), dlqEvent))
+	}
+	assert.Len(t, client.calls, 2)
+	assert.Equal(t, 1, batcher.Pending())
+
+	assert.NoError(t, batcher.Flush(context.Background()))
+
+	if assert.Len(t, client.calls, 3) {
+		assert.Len(t, client.calls[0].Entries, 2)
+		assert.Len(t, client.calls[1].Entries, 2)
+		assert.Len(t, client.calls[2].Entries, 1)
+	}
+	assert.Equal(t, float64(5), testutil.ToFloat64(metrics.DLQMessages.WithLabelValues("event-router", "routing_failure")))
+}
+
+func TestSplitBatches(t *testing.T) {
+	sized := func(sizes ...int) []pendingDeadLetter {
+		queued := make([]pendingDeadLetter, len(sizes))
+		for i, size := range sizes {
+			queued[i] = pendingDeadLetter{size: size}
+		}
+		return queued
+	}
+	batchSizes := func(batches [][]pendingDeadLetter) []int {
+		var lens []int
+		for _, batch := range batches {
+			lens = append(lens, len(batch))
+		}
+		return lens
+	}
+
+	assert.Nil(t, splitBatches(nil))
+	assert.Equal(t, []int{10, 10, 5}, batchSizes(splitBatches(sized(make([]int, 25)...))))
+	assert.Equal(t, []int{2, 1}, batchSizes(splitBatches(sized(128<<10, 128<<10, 1))))
+	// An event over the limit is sent alone
+	assert.Equal(t, []int{1, 1, 1}, batchSizes(splitBatches(sized(10, 300<<10, 10))))
+}
+
+func TestDeadLetterBatcher_FlushAndLog(t *testing.T) {
+	client := &mockSQSBatch{err: &smithy.GenericAPIError{Code: "AccessDenied"}}
+	batcher := NewDeadLetterBatcher(client, DeadLetterPolicy{RetryQueueURL: "retry-dlq"}, "event-router")
+	core, logs := observer.New(zap.ErrorLevel)
+
+	assert.NoError(t, batcher.FlushAndLog(context.Background(), zap.New(core)))
+	assert.Equal(t, 0, logs.Len())
+
+	for _, dlqEvent := range deadLetterEvents(2) {
+		assert.NoError(t, batcher.Add(context.Background(), dlqEvent))
+	}
+	var batchErr *DeadLetterBatchError
+	assert.ErrorAs(t, batcher.FlushAndLog(context.Background(), zap.New(core)), &batchErr)
+
+	entries := logs.FilterMessage("failed to send to DLQ").All()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "failure 0", entries[0].ContextMap()["error_message"])
+		assert.Equal(t, "AccessDenied", entries[0].ContextMap()["aws_error_code"])
+	}
+}
+
+func TestDeadLetterBatcher_EntryFailures(t *testing.T) {
+	metrics.DLQMessages.Reset()
+
+	dlqEvents := deadLetterEvents(3)
+	failing, err := json.Marshal(dlqEvents[1])
+	assert.NoError(t, err)
+	client := &mockSQSBatch{failBodies: map[string]bool{string(failing): true}}
+	batcher := NewDeadLetterBatcher(client, DeadLetterPolicy{RetryQueueURL: "retry-dlq"}, "event-router")
+
+	for _, dlqEvent := range dlqEvents {
+		assert.NoError(t, batcher.Add(context.Background(), dlqEvent))
+	}
+	err = batcher.Flush(context.Background())
+
+	var batchErr *DeadLetterBatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Equal(t, 3, batchErr.Total)
+		if assert.Len(t, batchErr.Failures, 1) {
+			failure := batchErr.Failures[0]
+			assert.Same(t, dlqEvents[1], failure.Event)
+			assert.Equal(t, "InvalidMessageContents", failure.Code)
+			assert.Equal(t, "message contains invalid characters", failure.Message)
+		}
+		assert.EqualError(t, err, "failed to send 1 of 3 dead-letter messages")
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.DLQMessages.WithLabelValues("event-router", "routing_failure")))
+}
+
+func TestDeadLetterBatcher_CallFailure(t *testing.T) {
+	client := &mockSQSBatch{err: &smithy.GenericAPIError{Code: "AccessDenied"}}
+	batcher := NewDeadLetterBatcher(client, DeadLetterPolicy{RetryQueueURL: "retry-dlq"}, "event-router")
+
+	for _, dlqEvent := range deadLetterEvents(2) {
+		assert.NoError(t, batcher.Add(context.Background(), dlqEvent))
+	}
+	err := batcher.Flush(context.Background())
+
+	var batchErr *DeadLetterBatchError
+	if assert.ErrorAs(t, err, &batchErr) {
+		assert.Len(t, batchErr.Failures, 2)
+	}
+	var apiErr smithy.APIError
+	assert.ErrorAs(t, err, &apiErr)
+}
+
+func TestDeadLetterBatcher_RoutesByPolicy(t *testing.T) {
+	client := &mockSQSBatch{}
+	batcher := NewDeadLetterBatcher(client, DeadLetterPolicy{
+		RetryQueueURL:     "retry-dlq",
+		PermanentQueueURL: "permanent",
+		MaxFailures:       3,
+		ErrorQueueURLs:    map[string]string{"validation_failure": "review"},
+	}, "stream-processor")
+
+	assert.NoError(t, batcher.Add(context.Background(), &events.DeadLetterEvent{ErrorType: "routing_failure", FailureCount: 1}))
+	assert.NoError(t, batcher.Add(context.Background(), &events.DeadLetterEvent{ErrorType: "validation_failure", FailureCount: 1}))
+	assert.NoError(t, batcher.Add(context.Background(), &events.DeadLetterEvent{ErrorType: "routing_failure", FailureCount: 3}))
+	assert.NoError(t, batcher.Flush(context.Background()))
+
+	var queues []string
+	for _, call := range client.calls {
+		queues = append(queues, aws.ToString(call.QueueUrl))
+		assert.Len(t, call.Entries, 1)
+	}
+	assert.ElementsMatch(t, []string{"retry-dlq", "review", "permanent"}, queues)
+}
+
+func TestEventBridgeConstants(t *testing.T) {
+	assert.Equal(t, 10*time.Second, defaultTimeout)
+	assert.Equal(t, 10, maxBatchSize)
+}
+
+func TestDynamoDBBatchSizeConstant(t *testing.T) {
+	// DynamoDB batch write limit is 25
+	// This test ensures we're aware of the limit
+	assert.LessOrEqual(t, 25, 25, "DynamoDB batch size should be <= 25")
+}
+
+// recordingBatchPublisher records each published batch's detail types
+type recordingBatchPublisher struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (p *recordingBatchPublisher) PublishEventBatch(ctx context.Context, events []EventBridgeEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	batch := make([]string, len(events))
+	for i, event := range events {
+		batch[i] = event.DetailType
+	}
+	p.batches = append(p.batches, batch)
+	return nil
+}
+
+// fakeFlushTimer is a manually fired timer for BufferedSink tests
+type fakeFlushTimer struct {
+	delay   time.Duration
+	fire    func()
+	stopped bool
+}
+
+func (t *fakeFlushTimer) Stop() bool {
+	t.stopped = true
+	return true
+}
+
+// newTestBufferedSink returns a sink on a fake clock whose timers are
+// collected rather than started
+func newTestBufferedSink(publisher BatchPublisher, maxSize int, maxLinger time.Duration) (*BufferedSink, *time.Time, *[]*fakeFlushTimer) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var timers []*fakeFlushTimer
+	sink := NewBufferedSink(publisher, maxSize, maxLinger)
+	sink.now = func() time.Time { return now }
+	sink.afterFunc = func(d time.Duration, f func()) flushTimer {
+		timer := &fakeFlushTimer{delay: d, fire: f}
+		timers = append(timers, timer)
+		return timer
+	}
+	return sink, &now, &timers
+}
+
+func TestBufferedSink_FlushesPartialBatchAfterLinger(t *testing.T) {
+	publisher := &recordingBatchPublisher{}
+	sink, now, timers := newTestBufferedSink(publisher, 10, time.Second)
+
+	assert.NoError(t, sink.Publish(context.Background(), "a", nil))
+	*now = now.Add(400 * time.Millisecond)
+	assert.NoError(t, sink.Publish(context.Background(), "b", nil))
+
+	// Only the first event starts the linger timer
+	assert.Len(t, *timers, 1)
+	assert.Equal(t, time.Second, (*timers)[0].delay)
+	assert.Empty(t, publisher.batches)
+
+	*now = now.Add(600 * time.Millisecond)
+	(*timers)[0].fire()
+
+	assert.Equal(t, [][]string{{"a", "b"}}, publisher.batches)
+	assert.Equal(t, 0, sink.Len())
+}
+
+func TestBufferedSink_FlushesFullBatchImmediately(t *testing.T) {
+	publisher := &recordingBatchPublisher{}
+	sink, _, timers := newTestBufferedSink(publisher, 3, time.Hour)
+
+	for _, detailType := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, sink.Publish(context.Background(), detailType, nil))
+	}
+
+	// The full batch went out without waiting and its timer was cancelled
+	assert.Equal(t, [][]string{{"a", "b", "c"}}, publisher.batches)
+	assert.True(t, (*timers)[0].stopped)
+	assert.Equal(t, 1, sink.Len())
+
+	// A stale timer for the flushed batch doesn't flush the next one
+	(*timers)[0].fire()
+	assert.Len(t, publisher.batches, 1)
+
+	// The remaining event lingers on its own timer
+	assert.Len(t, *timers, 2)
+}
+
+func TestBufferedSink_EarlyTimerReschedules(t *testing.T) {
+	publisher := &recordingBatchPublisher{}
+	sink, now, timers := newTestBufferedSink(publisher, 10, time.Second)
+
+	assert.NoError(t, sink.Publish(context.Background(), "a", nil))
+	*now = now.Add(300 * time.Millisecond)
+	(*timers)[0].fire()
+
+	assert.Empty(t, publisher.batches)
+	assert.Len(t, *timers, 2)
+	assert.Equal(t, 700*time.Millisecond, (*timers)[1].delay)
+
+	*now = now.Add(700 * time.Millisecond)
+	(*timers)[1].fire()
+	assert.Equal(t, [][]string{{"a"}}, publisher.batches)
+}
+
+func TestBufferedSink_LingerFlushErrorHandler(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{err: errors.New("bus unavailable")}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "test-source")
+	publisher.sleep = func(time.Duration) {}
+	sink, now, timers := newTestBufferedSink(publisher, 10, time.Second)
+
+	var flushErrs []error
+	sink.SetFlushErrorHandler(func(err error) { flushErrs = append(flushErrs, err) })
+
+	assert.NoError(t, sink.Publish(context.Background(), "a", map[string]string{"k": "v"}))
+	*now = now.Add(time.Second)
+	(*timers)[0].fire()
+
+	assert.Len(t, flushErrs, 1)
+	assert.ErrorContains(t, flushErrs[0], "bus unavailable")
+}
+
+// mockEventBridgeLister serves rules and buses in pages, keyed by the
+// NextToken that requests them ("" for the first page)
+type mockEventBridgeLister struct {
+	rulePages map[string]*eventbridge.ListRulesOutput
+	busPages  map[string]*eventbridge.ListEventBusesOutput
+	tokens    []string
+	cancel    context.CancelFunc // called after the first page when set
+}
+
+func (m *mockEventBridgeLister) ListRules(ctx context.Context, params *eventbridge.ListRulesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListRulesOutput, error) {
+	token := aws.ToString(params.NextToken)
+	m.tokens = append(m.tokens, token)
+	if m.cancel != nil {
+		m.cancel()
+	}
+	page, ok := m.rulePages[token]
+	if !ok {
+		return nil, fmt.Errorf("unexpected token %q", token)
+	}
+	return page, nil
+}
+
+func (m *mockEventBridgeLister) ListEventBuses(ctx context.Context, params *eventbridge.ListEventBusesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListEventBusesOutput, error) {
+	token := aws.ToString(params.NextToken)
+	m.tokens = append(m.tokens, token)
+	page, ok := m.busPages[token]
+	if !ok {
+		return nil, fmt.Errorf("unexpected token %q", token)
+	}
+	return page, nil
+}
+
+func twoRulePages() map[string]*eventbridge.ListRulesOutput {
+	return map[string]*eventbridge.ListRulesOutput{
+		"": {
+			Rules: []ebtypes.Rule{
+				{Name: aws.String("route-orders"), EventBusName: aws.String("app-bus"), State: ebtypes.RuleStateEnabled, EventPattern: aws.String(`{"source":["orders"]}`)},
+				{Name: aws.String("route-users"), EventBusName: aws.String("app-bus"), State: ebtypes.RuleStateDisabled},
+			},
+			NextToken: aws.String("page-2"),
+		},
+		"page-2": {
+			Rules: []ebtypes.Rule{
+				{Name: aws.String("nightly-report"), EventBusName: aws.String("app-bus"), State: ebtypes.RuleStateEnabled, ScheduleExpression: aws.String("rate(1 day)")},
+			},
+		},
+	}
+}
+
+func TestListRulesForBus_FollowsPages(t *testing.T) {
+	client := &mockEventBridgeLister{rulePages: twoRulePages()}
+
+	rules, err := ListRulesForBus(context.Background(), client, "app-bus")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "page-2"}, client.tokens)
+	assert.Len(t, rules, 3)
+	assert.Equal(t, RuleSummary{Name: "route-orders", EventBus: "app-bus", State: "ENABLED", EventPattern: `{"source":["orders"]}`}, rules[0])
+	assert.Equal(t, "DISABLED", rules[1].State)
+	assert.Equal(t, "rate(1 day)", rules[2].ScheduleExpression)
+}
+
+func TestListRulesForBus_StopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &mockEventBridgeLister{rulePages: twoRulePages(), cancel: cancel}
+
+	_, err := ListRulesForBus(ctx, client, "app-bus")
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{""}, client.tokens)
+}
+
+func TestListEventBuses(t *testing.T) {
+	client := &mockEventBridgeLister{busPages: map[string]*eventbridge.ListEventBusesOutput{
+		"": {
+			EventBuses: []ebtypes.EventBus{{Name: aws.String("default"), Arn: aws.String("arn:aws:events:us-west-2:123456789012:event-bus/default")}},
+			NextToken:  aws.String("page-2"),
+		},
+		"page-2": {
+			EventBuses: []ebtypes.EventBus{{Name: aws.String("app-bus"), Description: aws.String("application events")}},
+		},
+	}}
+
+	buses, err := ListEventBuses(context.Background(), client)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []EventBusSummary{
+		{Name: "default", ARN: "arn:aws:events:us-west-2:123456789012:event-bus/default"},
+		{Name: "app-bus", Description: "application events"},
+	}, buses)
+}
+
+func TestListEventBuses_Error(t *testing.T) {
+	client := &mockEventBridgeLister{busPages: map[string]*eventbridge.ListEventBusesOutput{
+		"": {NextToken: aws.String("missing")},
+	}}
+
+	_, err := ListEventBuses(context.Background(), client)
+	assert.ErrorContains(t, err, "failed to list event buses")
+}
+
+// mockBackfillTable serves a source table as fixed scan pages per segment,
+// paginated by a "page" start key, and keeps the replica's items by id with
+// their "updated_at" version, applying the backfill's put condition
+type mockBackfillTable struct {
+	mu       sync.Mutex
+	pages    map[int32][][]map[string]types.AttributeValue
+	failPage int // page index whose scan fails, -1 for none
+	scans    []int
+	written  []string
+	replica  map[string]types.AttributeValue
+}
+
+func (m *mockBackfillTable) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	page := 0
+	if start, ok := params.ExclusiveStartKey["page"].(*types.AttributeValueMemberN); ok {
+		page, _ = strconv.Atoi(start.Value)
+	}
+	m.scans = append(m.scans, page)
+	if page == m.failPage {
+		return nil, errors.New("scan interrupted")
+	}
+
+	pages := m.pages[aws.ToInt32(params.Segment)]
+	output := &dynamodb.ScanOutput{Items: pages[page]}
+	if page+1 < len(pages) {
+		output.LastEvaluatedKey = map[string]types.AttributeValue{
+			"page": &types.AttributeValueMemberN{Value: strconv.Itoa(page + 1)},
+		}
+	}
+	return output, nil
+}
+
+func (m *mockBackfillTable) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := params.Item["id"].(*types.AttributeValueMemberS).Value
+	if existing, ok := m.replica[id]; ok {
+		// attribute_not_exists(#version) OR #version < :version
+		version, versioned := params.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberN)
+		if !versioned || backfillVersion(existing) >= backfillVersion(version) {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+
+	if m.replica == nil {
+		m.replica = make(map[string]types.AttributeValue)
+	}
+	m.replica[id] = params.Item["updated_at"]
+	m.written = append(m.written, id)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func backfillVersion(value types.AttributeValue) int {
+	version, _ := strconv.Atoi(value.(*types.AttributeValueMemberN).Value)
+	return version
+}
+
+func backfillPage(ids ...string) []map[string]types.AttributeValue {
+	page := make([]map[string]types.AttributeValue, len(ids))
+	for i, id := range ids {
+		page[i] = map[string]types.AttributeValue{
+			"id":         &types.AttributeValueMemberS{Value: id},
+			"updated_at": &types.AttributeValueMemberN{Value: "1"},
+		}
+	}
+	return page
+}
+
+func TestBackfill_CopiesAllPages(t *testing.T) {
+	table := &mockBackfillTable{
+		failPage: -1,
+		pages: map[int32][][]map[string]types.AttributeValue{
+			0: {backfillPage("a1", "a2"), backfillPage("a3"), backfillPage("a4", "a5")},
+			1: {backfillPage("b1"), backfillPage("b2", "b3")},
+		},
+	}
+	backfill := NewBackfill(table, "source", "replica", "updated_at", 2)
+	var checkpoints int
+	backfill.SetCheckpoint(func(BackfillState) { checkpoints++ })
+
+	state, err := backfill.Run(context.Background(), nil)
+
+	assert.NoError(t, err)
+	assert.True(t, state.Done())
+	assert.False(t, state.StartedAt.IsZero())
+	assert.Equal(t, int64(8), state.ItemsCopied())
+	assert.ElementsMatch(t, []string{"a1", "a2", "a3", "a4", "a5", "b1", "b2", "b3"}, table.written)
+	assert.Equal(t, 5, checkpoints)
+}
+
+func TestBackfill_KeepsNewerReplicaItems(t *testing.T) {
+	table := &mockBackfillTable{
+		failPage: -1,
+		pages: map[int32][][]map[string]types.AttributeValue{
+			0: {backfillPage("a1", "a2", "a3")},
+		},
+		replica: map[string]types.AttributeValue{
+			// Stream replication already wrote a newer a2; a3 is older
+			"a2": &types.AttributeValueMemberN{Value: "2"},
+			"a3": &types.AttributeValueMemberN{Value: "0"},
+		},
+	}
+	backfill := NewBackfill(table, "source", "replica", "updated_at", 1)
+
+	state, err := backfill.Run(context.Background(), nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a3"}, table.written)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "2"}, table.replica["a2"])
+	assert.Equal(t, int64(2), state.ItemsCopied())
+	assert.Equal(t, int64(1), state.Segments[0].ItemsSkipped)
+}
+
+func TestBackfill_ResumesFromCheckpoint(t *testing.T) {
+	table := &mockBackfillTable{
+		failPage: 2,
+		pages: map[int32][][]map[string]types.AttributeValue{
+			0: {backfillPage("a1", "a2"), backfillPage("a3"), backfillPage("a4", "a5")},
+		},
+	}
+	backfill := NewBackfill(table, "source", "replica", "updated_at", 1)
+	var saved []byte
+	backfill.SetCheckpoint(func(state BackfillState) {
+		var err error
+		saved, err = json.Marshal(state)
+		assert.NoError(t, err)
+	})
+
+	// The first run is interrupted after copying two pages
+	_, err := backfill.Run(context.Background(), nil)
+	assert.ErrorContains(t, err, "scan interrupted")
+
+	// Another process resumes from the saved checkpoint, scanning only the
+	// remaining page
+	var resumed BackfillState
+	assert.NoError(t, json.Unmarshal(saved, &resumed))
+	assert.False(t, resumed.Done())
+	assert.Equal(t, int64(3), resumed.ItemsCopied())
+
+	table.failPage = -1
+	table.scans = nil
+	table.written = nil
+	state, err := NewBackfill(table, "source", "replica", "updated_at", 1).Run(context.Background(), &resumed)
+
+	assert.NoError(t, err)
+	assert.True(t, state.Done())
+	assert.Equal(t, []int{2}, table.scans)
+	assert.Equal(t, []string{"a4", "a5"}, table.written)
+	assert.Equal(t, int64(5), state.ItemsCopied())
+}
+
+func TestBackfillState_JSONRoundTrip(t *testing.T) {
+	state := BackfillState{
+		StartedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		Segments: []BackfillSegment{
+			{
+				LastKey: map[string]types.AttributeValue{
+					"pk":   &types.AttributeValueMemberS{Value: "customer#1"},
+					"sk":   &types.AttributeValueMemberN{Value: "12345678901234567890"},
+					"hash": &types.AttributeValueMemberB{Value: []byte{0x00, 0xff}},
+				},
+				ItemsCopied:  25,
+				ItemsSkipped: 2,
+			},
+			{ItemsCopied: 7, Done: true},
+		},
+	}
+
+	data, err := json.Marshal(state)
+	assert.NoError(t, err)
+
+	var decoded BackfillState
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, state, decoded)
+}
+
+func TestBackfillState_RejectsUnsupportedKey(t *testing.T) {
+	state := BackfillState{Segments: []BackfillSegment{{
+		LastKey: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberBOOL{Value: true}},
+	}}}
+
+	_, err := json.Marshal(state)
+	assert.ErrorContains(t, err, "unsupported type")
+}
+
+func TestBackfill_RejectsMismatchedState(t *testing.T) {
+	backfill := NewBackfill(&mockBackfillTable{}, "source", "replica", "updated_at", 4)
+
+	_, err := backfill.Run(context.Background(), &BackfillState{Segments: make([]BackfillSegment, 2)})
+	assert.Error(t, err)
+}
+
+func TestBackfill_RequiresVersionAttribute(t *testing.T) {
+	backfill := NewBackfill(&mockBackfillTable{}, "source", "replica", "", 1)
+
+	_, err := backfill.Run(context.Background(), nil)
+	assert.ErrorContains(t, err, "version attribute")
+}
+
+func TestStreamImageToMap(t *testing.T) {
+	image := map[string]lambdaevents.DynamoDBAttributeValue{
+		"id":      lambdaevents.NewStringAttribute("item-1"),
+		"count":   lambdaevents.NewNumberAttribute("12345678901234567890"),
+		"blob":    lambdaevents.NewBinaryAttribute([]byte("raw")),
+		"active":  lambdaevents.NewBooleanAttribute(false),
+		"deleted": lambdaevents.NewNullAttribute(),
+		"scores":  lambdaevents.NewNumberSetAttribute([]string{"1", "2.5"}),
+		"history": lambdaevents.NewListAttribute([]lambdaevents.DynamoDBAttributeValue{
+			lambdaevents.NewMapAttribute(map[string]lambdaevents.DynamoDBAttributeValue{
+				"status": lambdaevents.NewStringAttribute("shipped"),
+			}),
+		}),
+	}
+
+	result := StreamImageToMap(image)
+
+	assert.Equal(t, "item-1", result["id"])
+	// Large numbers keep every digit
+	assert.Equal(t, json.Number("12345678901234567890"), result["count"])
+	assert.Equal(t, []byte("raw"), result["blob"])
+	assert.Equal(t, false, result["active"])
+	assert.Nil(t, result["deleted"])
+	assert.Contains(t, result, "deleted")
+	assert.Equal(t, []json.Number{"1", "2.5"}, result["scores"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"status": "shipped"}}, result["history"])
+
+	assert.Nil(t, StreamImageToMap(nil))
+}
+
+// nestedMapAttribute wraps leaf in depth-1 levels of single-entry maps
+func nestedMapAttribute(depth int, leaf lambdaevents.DynamoDBAttributeValue) lambdaevents.DynamoDBAttributeValue {
+	value := leaf
+	for i := 1; i < depth; i++ {
+		value = lambdaevents.NewMapAttribute(map[string]lambdaevents.DynamoDBAttributeValue{"child": value})
+	}
+	return value
+}
+
+func TestStreamImageToMap_WithinMaxDepth(t *testing.T) {
+	before := testutil.ToFloat64(metrics.AttributeMaxDepthExceeded)
+	image := map[string]lambdaevents.DynamoDBAttributeValue{
+		"root": nestedMapAttribute(DefaultMaxStreamAttributeDepth, lambdaevents.NewStringAttribute("leaf")),
+	}
+
+	value := StreamImageToMap(image)["root"]
+	for i := 1; i < DefaultMaxStreamAttributeDepth; i++ {
+		value = value.(map[string]interface{})["child"]
+	}
+
+	assert.Equal(t, "leaf", value)
+	assert.Equal(t, before, testutil.ToFloat64(metrics.AttributeMaxDepthExceeded))
+}
+
+func TestStreamImageToMap_TruncatesBeyondMaxDepth(t *testing.T) {
+	SetMaxStreamAttributeDepth(3)
+	defer SetMaxStreamAttributeDepth(0)
+	before := testutil.ToFloat64(metrics.AttributeMaxDepthExceeded)
+
+	image := map[string]lambdaevents.DynamoDBAttributeValue{
+		"id":   lambdaevents.NewStringAttribute("item-1"),
+		"deep": nestedMapAttribute(10000, lambdaevents.NewStringAttribute("leaf")),
+		"list": lambdaevents.NewListAttribute([]lambdaevents.DynamoDBAttributeValue{
+			lambdaevents.NewListAttribute([]lambdaevents.DynamoDBAttributeValue{
+				lambdaevents.NewListAttribute([]lambdaevents.DynamoDBAttributeValue{
+					lambdaevents.NewStringAttribute("leaf"),
+				}),
+			}),
+		}),
+	}
+
+	result := StreamImageToMap(image)
+
+	assert.Equal(t, "item-1", result["id"])
+	// Values from the fourth level down are dropped
+	assert.Equal(t, map[string]interface{}{"child": map[string]interface{}{"child": map[string]interface{}{"child": nil}}}, result["deep"])
+	assert.Equal(t, []interface{}{[]interface{}{[]interface{}{nil}}}, result["list"])
+	// One truncated image is counted once
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.AttributeMaxDepthExceeded))
+}
+
+// mockQueryTable serves Query pages in order, paginated by a "page" start
+// key, and records each request
+type mockQueryTable struct {
+	DynamoDBAPI
+	pages  [][]map[string]types.AttributeValue
+	inputs []dynamodb.QueryInput
+}
+
+func (m *mockQueryTable) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.inputs = append(m.inputs, *params)
+
+	page := 0
+	if start, ok := params.ExclusiveStartKey["page"].(*types.AttributeValueMemberN); ok {
+		page, _ = strconv.Atoi(start.Value)
+	}
+	output := &dynamodb.QueryOutput{Items: m.pages[page]}
+	if page+1 < len(m.pages) {
+		output.LastEvaluatedKey = map[string]types.AttributeValue{
+			"page": &types.AttributeValueMemberN{Value: strconv.Itoa(page + 1)},
+		}
+	}
+	return output, nil
+}
+
+func TestDynamoDBHelper_QueryIndex(t *testing.T) {
+	client := &mockQueryTable{pages: [][]map[string]types.AttributeValue{
+		{
+			{"event_id": &types.AttributeValueMemberS{Value: "evt-1"}, "event_type": &types.AttributeValueMemberS{Value: "OrderCreated"}},
+			{"event_id": &types.AttributeValueMemberS{Value: "evt-2"}, "event_type": &types.AttributeValueMemberS{Value: "OrderCreated"}},
+		},
+		{
+			{"event_id": &types.AttributeValueMemberS{Value: "evt-3"}, "event_type": &types.AttributeValueMemberS{Value: "OrderCreated"}},
+		},
+	}}
+	helper := NewDynamoDBHelper(client, "events")
+
+	var results []struct {
+		EventID   string `dynamodbav:"event_id"`
+		EventType string `dynamodbav:"event_type"`
+	}
+	err := helper.QueryIndex(context.Background(), "event_type-index", "event_type = :type",
+		map[string]types.AttributeValue{":type": &types.AttributeValueMemberS{Value: "OrderCreated"}}, &results)
+
+	assert.NoError(t, err)
+	assert.Len(t, client.inputs, 2)
+	for _, input := range client.inputs {
+		assert.Equal(t, "events", aws.ToString(input.TableName))
+		assert.Equal(t, "event_type-index", aws.ToString(input.IndexName))
+		assert.Equal(t, "event_type = :type", aws.ToString(input.KeyConditionExpression))
+	}
+	assert.Nil(t, client.inputs[0].ExclusiveStartKey)
+	assert.NotNil(t, client.inputs[1].ExclusiveStartKey)
+
+	assert.Len(t, results, 3)
+	assert.Equal(t, "evt-1", results[0].EventID)
+	assert.Equal(t, "evt-3", results[2].EventID)
+	assert.Equal(t, "OrderCreated", results[2].EventType)
+}
+
+func TestDynamoDBHelper_QueryIndexRequiresName(t *testing.T) {
+	client := &mockQueryTable{}
+	helper := NewDynamoDBHelper(client, "events")
+
+	var results []map[string]interface{}
+	err := helper.QueryIndex(context.Background(), "", "event_type = :type", nil, &results)
+
+	assert.Error(t, err)
+	assert.Empty(t, client.inputs)
+}
+
+func TestDynamoDBHelper_QueryBaseTable(t *testing.T) {
+	client := &mockQueryTable{pages: [][]map[string]types.AttributeValue{
+		{{"id": &types.AttributeValueMemberS{Value: "a"}}},
+	}}
+	helper := NewDynamoDBHelper(client, "events")
+
+	var results []map[string]interface{}
+	err := helper.Query(context.Background(), "id = :id", nil, &results)
+
+	assert.NoError(t, err)
+	assert.Nil(t, client.inputs[0].IndexName)
+	assert.Equal(t, []map[string]interface{}{{"id": "a"}}, results)
+}
+
+func TestDynamoDBHelper_QueryConsistentRead(t *testing.T) {
+	client := &mockQueryTable{pages: [][]map[string]types.AttributeValue{
+		{{"id": &types.AttributeValueMemberS{Value: "a"}}},
+	}}
+	helper := NewDynamoDBHelper(client, "events")
+
+	var results []map[string]interface{}
+	assert.NoError(t, helper.Query(context.Background(), "id = :id", nil, &results))
+	helper.SetConsistentRead(true)
+	assert.NoError(t, helper.Query(context.Background(), "id = :id", nil, &results))
+
+	assert.Len(t, client.inputs, 2)
+	// Eventually consistent unless requested
+	assert.Nil(t, client.inputs[0].ConsistentRead)
+	assert.True(t, aws.ToBool(client.inputs[1].ConsistentRead))
+}
+
+func TestDynamoDBHelper_ConsistentQueryIndexErrors(t *testing.T) {
+	client := &mockQueryTable{}
+	helper := NewDynamoDBHelper(client, "events")
+	helper.SetConsistentRead(true)
+
+	var results []map[string]interface{}
+	err := helper.QueryIndex(context.Background(), "event_type-index", "event_type = :type", nil, &results)
+
+	assert.ErrorIs(t, err, ErrConsistentIndexQuery)
+	assert.Empty(t, client.inputs)
+}
+
+// mockGetItemTable returns a fixed item from GetItem and records each request
+type mockGetItemTable struct {
+	DynamoDBAPI
+	item   map[string]types.AttributeValue
+	inputs []dynamodb.GetItemInput
+}
+
+func (m *mockGetItemTable) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.inputs = append(m.inputs, *params)
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func TestDynamoDBHelper_GetItemConsistentRead(t *testing.T) {
+	client := &mockGetItemTable{item: map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: "a"},
+	}}
+	helper := NewDynamoDBHelper(client, "events")
+	key := map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a"}}
+
+	var item map[string]interface{}
+	assert.NoError(t, helper.GetItem(context.Background(), key, &item))
+	helper.SetConsistentRead(true)
+	assert.NoError(t, helper.GetItem(context.Background(), key, &item))
+
+	assert.Len(t, client.inputs, 2)
+	assert.Nil(t, client.inputs[0].ConsistentRead)
+	assert.True(t, aws.ToBool(client.inputs[1].ConsistentRead))
+	assert.Equal(t, map[string]interface{}{"id": "a"}, item)
+}
+
+// fakeLimiterClock is a manual clock for a RateLimiter whose waits advance
+// the clock and are recorded
+type fakeLimiterClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func newTestRateLimiter(rate float64, burst int) (*RateLimiter, *fakeLimiterClock) {
+	clock := &fakeLimiterClock{now: time.Unix(1700000000, 0)}
+	limiter := NewRateLimiter(rate, burst)
+	limiter.now = func() time.Time { return clock.now }
+	limiter.wait = func(ctx context.Context, d time.Duration) error {
+		clock.waits = append(clock.waits, d)
+		clock.now = clock.now.Add(d)
+		return ctx.Err()
+	}
+	return limiter, clock
+}
+
+func TestRateLimiter_PacesBurst(t *testing.T) {
+	limiter, clock := newTestRateLimiter(2, 1)
+	start := clock.now
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, limiter.Wait(context.Background()))
+	}
+
+	// The first write uses the burst; the rest are spaced at the rate
+	assert.Equal(t, []time.Duration{0, 500 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond}, clock.waits)
+	assert.Equal(t, 1500*time.Millisecond, clock.now.Sub(start))
+}
+
+func TestRateLimiter_RefillsUpToBurst(t *testing.T) {
+	limiter, clock := newTestRateLimiter(10, 3)
+	assert.NoError(t, limiter.WaitN(context.Background(), 3))
+
+	// A long quiet period refills only up to the burst
+	clock.now = clock.now.Add(time.Minute)
+	clock.waits = nil
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, limiter.Wait(context.Background()))
+	}
+
+	assert.Equal(t, []time.Duration{0, 0, 0, 100 * time.Millisecond}, clock.waits)
+}
+
+func TestRateLimiter_CancelledWaitGivesBackTokens(t *testing.T) {
+	limiter, clock := newTestRateLimiter(1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, limiter.WaitN(ctx, 5), context.Canceled)
+
+	// The cancelled reservation doesn't delay later callers
+	clock.waits = nil
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.Equal(t, []time.Duration{0}, clock.waits)
+}
+
+func TestRateLimiter_Unlimited(t *testing.T) {
+	limiter := NewRateLimiter(0, 10)
+
+	assert.Nil(t, limiter)
+	assert.NoError(t, limiter.WaitN(context.Background(), 1000))
+	assert.True(t, math.IsInf(limiter.Rate(), 1))
+}
+
+// mockWriteTable counts the writes it receives
+type mockWriteTable struct {
+	DynamoDBAPI
+	puts    int
+	batches int
+}
+
+func (m *mockWriteTable) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.puts++
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockWriteTable) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	m.batches++
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func TestDynamoDBHelper_WriteLimiterPacesWrites(t *testing.T) {
+	client := &mockWriteTable{}
+	helper := NewDynamoDBHelper(client, "replica")
+	limiter, clock := newTestRateLimiter(5, 1)
+	helper.SetWriteLimiter(limiter)
+	start := clock.now
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, helper.PutItem(context.Background(), map[string]string{"id": strconv.Itoa(i)}))
+	}
+
+	assert.Same(t, limiter, helper.WriteLimiter())
+	assert.Equal(t, 5, client.puts)
+	assert.Equal(t, 800*time.Millisecond, clock.now.Sub(start))
+
+	// A batch write takes one operation per item
+	items := make([]interface{}, 10)
+	for i := range items {
+		items[i] = map[string]string{"id": strconv.Itoa(i)}
+	}
+	start = clock.now
+	assert.NoError(t, helper.BatchWriteItems(context.Background(), items))
+	assert.Equal(t, 1, client.batches)
+	assert.Equal(t, 2*time.Second, clock.now.Sub(start))
+}
+
+func TestDynamoDBHelper_UnlimitedWrites(t *testing.T) {
+	client := &mockWriteTable{}
+	helper := NewDynamoDBHelper(client, "replica")
+	helper.SetWriteLimiter(NewRateLimiter(0, 0))
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, helper.PutItem(context.Background(), map[string]string{"id": strconv.Itoa(i)}))
+	}
+
+	assert.Nil(t, helper.WriteLimiter())
+	assert.Equal(t, 100, client.puts)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestDynamoDBHelper_WriteLimiterCancelled(t *testing.T) {
+	client := &mockWriteTable{}
+	helper := NewDynamoDBHelper(client, "replica")
+	helper.SetWriteLimiter(NewRateLimiter(0.001, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.NoError(t, helper.PutItem(ctx, map[string]string{"id": "a"}))
+	cancel()
+	err := helper.PutItem(ctx, map[string]string{"id": "b"})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, client.puts)
+}
+
+func TestClassifyDynamoDBError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"conditional check", &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}, DynamoDBErrorConditionalCheckFailed},
+		{"throttling", &smithy.GenericAPIError{Code: "ThrottlingException"}, DynamoDBErrorThrottling},
+		{"request limit", &types.RequestLimitExceeded{}, DynamoDBErrorThrottling},
+		{"resource not found", &types.ResourceNotFoundException{}, DynamoDBErrorResourceNotFound},
+		{"provisioned throughput", &types.ProvisionedThroughputExceededException{}, DynamoDBErrorProvisionedThroughputExceeded},
+		{"validation", &smithy.GenericAPIError{Code: "ValidationException", Message: "One or more parameter values were invalid"}, DynamoDBErrorValidation},
+		{"wrapped", fmt.Errorf("put: %w", &types.ResourceNotFoundException{}), DynamoDBErrorResourceNotFound},
+		{"other API error", &types.InternalServerError{}, DynamoDBErrorUnknown},
+		{"plain error", errors.New("connection reset"), DynamoDBErrorUnknown},
+		{"context", context.DeadlineExceeded, DynamoDBErrorUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ClassifyDynamoDBError(tt.err))
+		})
+	}
+}
+
+// failingTable fails every call with err
+type failingTable struct {
+	DynamoDBAPI
+	err error
+}
+
+func (m *failingTable) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return nil, m.err
+}
+
+func (m *failingTable) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return nil, m.err
+}
+
+func (m *failingTable) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return nil, m.err
+}
+
+func TestDynamoDBHelper_RecordsErrorsByCategory(t *testing.T) {
+	metrics.DynamoDBErrors.Reset()
+	key := map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "a"}}
+	errorCount := func(operation, category string) float64 {
+		return testutil.ToFloat64(metrics.DynamoDBErrors.WithLabelValues("replica", operation, "", category))
+	}
+
+	throttled := NewDynamoDBHelper(&failingTable{err: &types.ProvisionedThroughputExceededException{}}, "replica")
+	assert.Error(t, throttled.PutItem(context.Background(), map[string]string{"id": "a"}))
+	assert.Error(t, throttled.PutItem(context.Background(), map[string]string{"id": "b"}))
+
+	missing := NewDynamoDBHelper(&failingTable{err: &types.ResourceNotFoundException{}}, "replica")
+	var item map[string]interface{}
+	assert.Error(t, missing.GetItem(context.Background(), key, &item))
+
+	invalid := NewDynamoDBHelper(&failingTable{err: &smithy.GenericAPIError{Code: "ValidationException"}}, "replica")
+	var items []map[string]interface{}
+	assert.Error(t, invalid.Query(context.Background(), "id = :id", nil, &items))
+
+	assert.Equal(t, float64(2), errorCount("PutItem", DynamoDBErrorProvisionedThroughputExceeded))
+	assert.Equal(t, float64(1), errorCount("GetItem", DynamoDBErrorResourceNotFound))
+	assert.Equal(t, float64(1), errorCount("Query", DynamoDBErrorValidation))
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics.DynamoDBErrors))
+}
+
+func TestDynamoDBHelper_ExpectedConditionFailureNotCounted(t *testing.T) {
+	metrics.DynamoDBErrors.Reset()
+	helper := NewDynamoDBHelper(&mockVersionedTable{version: 5}, "replica")
+	key := map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "order-1"}}
+
+	deleted, err := helper.DeleteItemIfNotNewer(context.Background(), key, "version", 3)
+
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.DynamoDBErrors))
+}
+
+func TestNewDynamoDBHelper_RegionFromClient(t *testing.T) {
+	client := dynamodb.New(dynamodb.Options{Region: "eu-west-1"})
+
+	helper := NewDynamoDBHelper(client, "replica")
+
+	assert.Equal(t, "eu-west-1", helper.region)
+}
+
+// mockDLQ returns fixed messages from ReceiveMessage
+type mockDLQ struct {
+	messages   []sqstypes.Message
+	input      *sqs.ReceiveMessageInput
+	released   []sqstypes.ChangeMessageVisibilityBatchRequestEntry
+	releaseErr error
+}
+
+func (m *mockDLQ) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	m.input = params
+	return &sqs.ReceiveMessageOutput{Messages: m.messages}, nil
+}
+
+func (m *mockDLQ) ChangeMessageVisibilityBatch(ctx context.Context, params *sqs.ChangeMessageVisibilityBatchInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	if m.releaseErr != nil {
+		return nil, m.releaseErr
+	}
+	m.released = append(m.released, params.Entries...)
+	return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+}
+
+func dlqMessage(id string, sentAt time.Time) sqstypes.Message {
+	return sqstypes.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String("receipt-" + id),
+		Attributes:    map[string]string{"SentTimestamp": strconv.FormatInt(sentAt.UnixMilli(), 10)},
+	}
+}
+
+// recordingEventSink records published events
+type recordingEventSink struct {
+	detailTypes []string
+	details     []interface{}
+}
+
+func (s *recordingEventSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	s.detailTypes = append(s.detailTypes, detailType)
+	s.details = append(s.details, detail)
+	return nil
+}
+
+func TestDLQAgeMonitor_EscalatesOldMessage(t *testing.T) {
+	metrics.DLQEscalations.Reset()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	queueURL := "https://sqs.us-west-2.amazonaws.com/123456789012/event-dlq"
+	client := &mockDLQ{messages: []sqstypes.Message{
+		dlqMessage("recent", now.Add(-time.Minute)),
+		dlqMessage("stuck", now.Add(-3*time.Hour)),
+		{MessageId: aws.String("no-timestamp")},
+	}}
+	sink := &recordingEventSink{}
+	monitor := NewDLQAgeMonitor(client, sink, queueURL, time.Hour)
+	monitor.now = func() time.Time { return now }
+
+	escalation, err := monitor.Check(context.Background())
+
+	assert.NoError(t, err)
+	assert.NotNil(t, escalation)
+	assert.Equal(t, "stuck", escalation.OldestMessageID)
+	assert.Equal(t, events.SeverityHigh, escalation.Severity)
+	assert.Equal(t, int64(3*60*60), escalation.AgeSeconds)
+	assert.Equal(t, int64(60*60), escalation.MaxAgeSeconds)
+	assert.Equal(t, []string{events.EventTypeDLQEscalation}, sink.detailTypes)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.DLQEscalations.WithLabelValues("event-dlq")))
+	assert.Equal(t, (3 * time.Hour).Seconds(), testutil.ToFloat64(metrics.DLQOldestMessageAge.WithLabelValues("event-dlq")))
+
+	// The peek hides messages briefly, asks for their sent time and makes
+	// every sampled message visible again
+	assert.Equal(t, int32(5), client.input.VisibilityTimeout)
+	assert.Contains(t, client.input.MessageSystemAttributeNames, sqstypes.MessageSystemAttributeNameSentTimestamp)
+	if assert.Len(t, client.released, 3) {
+		assert.Equal(t, "receipt-stuck", aws.ToString(client.released[1].ReceiptHandle))
+		for _, entry := range client.released {
+			assert.Zero(t, entry.VisibilityTimeout)
+		}
+	}
+}
+
+func TestDLQAgeMonitor_ReleaseFailure(t *testing.T) {
+	client := &mockDLQ{
+		messages:   []sqstypes.Message{dlqMessage("stuck", time.Now().Add(-3*time.Hour))},
+		releaseErr: errors.New("sqs unavailable"),
+	}
+	sink := &recordingEventSink{}
+	monitor := NewDLQAgeMonitor(client, sink, "https://sqs.us-west-2.amazonaws.com/123456789012/event-dlq", time.Hour)
+
+	_, err := monitor.Check(context.Background())
+
+	assert.ErrorContains(t, err, "failed to release sampled DLQ messages")
+	assert.Empty(t, sink.detailTypes)
+}
+
+func TestDLQAgeMonitor_RecentMessageNotEscalated(t *testing.T) {
+	metrics.DLQEscalations.Reset()
+	now := time.Now()
+	client := &mockDLQ{messages: []sqstypes.Message{dlqMessage("recent", now.Add(-10*time.Minute))}}
+	sink := &recordingEventSink{}
+	monitor := NewDLQAgeMonitor(client, sink, "https://sqs.us-west-2.amazonaws.com/123456789012/event-dlq", time.Hour)
+	monitor.now = func() time.Time { return now }
+
+	escalation, err := monitor.Check(context.Background())
+
+	assert.NoError(t, err)
+	assert.Nil(t, escalation)
+	assert.Empty(t, sink.detailTypes)
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.DLQEscalations.WithLabelValues("event-dlq")))
+}
+
+func TestDLQAgeMonitor_EmptyQueue(t *testing.T) {
+	sink := &recordingEventSink{}
+	monitor := NewDLQAgeMonitor(&mockDLQ{}, sink, "https://sqs.us-west-2.amazonaws.com/123456789012/event-dlq", time.Hour)
+
+	escalation, err := monitor.Check(context.Background())
+
+	assert.NoError(t, err)
+	assert.Nil(t, escalation)
+	assert.Empty(t, sink.detailTypes)
+}
+
+// mockTargetPutter records PutTargets requests and fails the target IDs in failIDs
+type mockTargetPutter struct {
+	input   *eventbridge.PutTargetsInput
+	failIDs []string
+}
+
+func (m *mockTargetPutter) PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error) {
+	m.input = params
+	output := &eventbridge.PutTargetsOutput{}
+	for _, id := range m.failIDs {
+		output.FailedEntries = append(output.FailedEntries, ebtypes.PutTargetsResultEntry{
+			TargetId:     aws.String(id),
+			ErrorCode:    aws.String("ValidationException"),
+			ErrorMessage: aws.String("bad target"),
+		})
+		output.FailedEntryCount++
+	}
+	return output, nil
+}
+
+func TestPutRuleTargets_DeadLetterAndRetryPolicy(t *testing.T) {
+	client := &mockTargetPutter{}
+	targets := []RuleTarget{
+		{
+			ID:            "replicator",
+			ARN:           "arn:aws:lambda:us-west-2:123456789012:function:replicator",
+			DeadLetterARN: "arn:aws:sqs:us-west-2:123456789012:replicator-dlq",
+			Retry:         &TargetRetryPolicy{MaxAttempts: 3, MaxEventAge: 2 * time.Hour},
+		},
+		{ID: "router", ARN: "arn:aws:lambda:us-west-2:123456789012:function:router"},
+	}
+
+	err := PutRuleTargets(context.Background(), client, "app-bus", "route-orders", "arn:aws:sqs:us-west-2:123456789012:default-dlq", targets)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "app-bus", aws.ToString(client.input.EventBusName))
+	assert.Equal(t, "route-orders", aws.ToString(client.input.Rule))
+	assert.Len(t, client.input.Targets, 2)
+
+	replicator := client.input.Targets[0]
+	assert.Equal(t, "arn:aws:sqs:us-west-2:123456789012:replicator-dlq", aws.ToString(replicator.DeadLetterConfig.Arn))
+	assert.Equal(t, int32(3), aws.ToInt32(replicator.RetryPolicy.MaximumRetryAttempts))
+	assert.Equal(t, int32(7200), aws.ToInt32(replicator.RetryPolicy.MaximumEventAgeInSeconds))
+
+	// The router falls back to the default queue and EventBridge's retry policy
+	router := client.input.Targets[1]
+	assert.Equal(t, "arn:aws:sqs:us-west-2:123456789012:default-dlq", aws.ToString(router.DeadLetterConfig.Arn))
+	assert.Nil(t, router.RetryPolicy)
+}
+
+func TestPutRuleTargets_OmitsUnsetPolicies(t *testing.T) {
+	client := &mockTargetPutter{}
+	targets := []RuleTarget{
+		{ID: "router", ARN: "arn:aws:lambda:us-west-2:123456789012:function:router", Retry: &TargetRetryPolicy{MaxAttempts: 0}},
+	}
+
+	err := PutRuleTargets(context.Background(), client, "app-bus", "route-orders", "", targets)
+
+	assert.NoError(t, err)
+	target := client.input.Targets[0]
+	assert.Nil(t, target.DeadLetterConfig)
+	assert.Nil(t, target.RoleArn)
+	// Zero attempts disables retries; the event age is left unset
+	assert.Equal(t, int32(0), aws.ToInt32(target.RetryPolicy.MaximumRetryAttempts))
+	assert.Nil(t, target.RetryPolicy.MaximumEventAgeInSeconds)
+}
+
+func TestPutRuleTargets_FailedEntries(t *testing.T) {
+	client := &mockTargetPutter{failIDs: []string{"router"}}
+	targets := []RuleTarget{{ID: "router", ARN: "arn:aws:lambda:us-west-2:123456789012:function:router"}}
+
+	err := PutRuleTargets(context.Background(), client, "app-bus", "route-orders", "", targets)
+
+	assert.ErrorContains(t, err, "router (ValidationException: bad target)")
+}
+
+// delayedEventBridge is a mockEventBridge whose PutEvents takes delay
+type delayedEventBridge struct {
+	mockEventBridge
+	delay time.Duration
+}
+
+func (m *delayedEventBridge) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	time.Sleep(m.delay)
+	return m.mockEventBridge.PutEvents(ctx, params, optFns...)
+}
+
+// useSlowOperationMonitor swaps in a monitor logging to an observer for the
+// duration of the test
+func useSlowOperationMonitor(t *testing.T) (*SlowOperationMonitor, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.WarnLevel)
+	previous := DefaultSlowOperations
+	DefaultSlowOperations = NewSlowOperationMonitor(zap.New(core))
+	t.Cleanup(func() { DefaultSlowOperations = previous })
+	return DefaultSlowOperations, logs
+}
+
+func TestSlowOperation_LogsSlowCall(t *testing.T) {
+	monitor, logs := useSlowOperationMonitor(t)
+	monitor.SetThreshold(ServiceEventBridge, 5*time.Millisecond)
+	metrics.AWSOperationDuration.Reset()
+
+	client := &delayedEventBridge{mockEventBridge: mockEventBridge{responses: []mockPutEventsResponse{{}}}, delay: 20 * time.Millisecond}
+	publisher := NewEventBridgePublisher(client, "app-bus", "test")
+	err := publisher.PublishEvent(context.Background(), "OrderCreated", map[string]string{"id": "1"})
+
+	assert.NoError(t, err)
+	entries := logs.FilterMessage("slow AWS operation").All()
+	assert.Len(t, entries, 1)
+
+	fields := entries[0].ContextMap()
+	assert.Equal(t, ServiceEventBridge, fields["service"])
+	assert.Equal(t, "PutEvents", fields["operation"])
+	assert.Equal(t, "app-bus", fields["event_bus"])
+	assert.Equal(t, int64(1), fields["entries"])
+	assert.GreaterOrEqual(t, fields["duration"], 20*time.Millisecond)
+	assert.Equal(t, 5*time.Millisecond, fields["threshold"])
+
+	// The histogram is recorded regardless of the threshold
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.AWSOperationDuration))
+}
+
+func TestSlowOperation_FastCallNotLogged(t *testing.T) {
+	_, logs := useSlowOperationMonitor(t)
+
+	client := &delayedEventBridge{mockEventBridge: mockEventBridge{responses: []mockPutEventsResponse{{}}}}
+	publisher := NewEventBridgePublisher(client, "app-bus", "test")
+	err := publisher.PublishEvent(context.Background(), "OrderCreated", map[string]string{"id": "1"})
+
+	assert.NoError(t, err)
+	assert.Zero(t, logs.Len())
+}
+
+func TestSlowOperation_DeadLetterRouter(t *testing.T) {
+	monitor, logs := useSlowOperationMonitor(t)
+	monitor.SetThreshold(ServiceSQS, time.Nanosecond)
+
+	router := NewDeadLetterRouter(&mockSQS{}, DeadLetterPolicy{RetryQueueURL: "retry-dlq"}, "test")
+	err := router.Send(context.Background(), &events.DeadLetterEvent{ErrorType: "transient"})
+
+	assert.NoError(t, err)
+	entries := logs.All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "SendMessage", entries[0].ContextMap()["operation"])
+	assert.Equal(t, "retry-dlq", entries[0].ContextMap()["queue_url"])
+}
+
+func TestSlowOperationMonitor_Configure(t *testing.T) {
+	monitor := NewSlowOperationMonitor(nil)
+	assert.Equal(t, 250*time.Millisecond, monitor.Threshold(ServiceDynamoDB))
+
+	err := monitor.Configure(zap.NewNop(), "DynamoDB=100ms, eventbridge=2s")
+	assert.NoError(t, err)
+	assert.Equal(t, 100*time.Millisecond, monitor.Threshold(ServiceDynamoDB))
+	assert.Equal(t, 2*time.Second, monitor.Threshold(ServiceEventBridge))
+	// Services left out keep their default
+	assert.Equal(t, time.Second, monitor.Threshold(ServiceSecretsManager))
+
+	for _, spec := range []string{"dynamodb", "=1s", "sqs=fast", "sqs=0s"} {
+		assert.Error(t, monitor.Configure(zap.NewNop(), spec), spec)
+	}
+}
+
+func TestConfigureSlowCallWarnings(t *testing.T) {
+	monitor, _ := useSlowOperationMonitor(t)
+	core, logs := observer.New(zap.WarnLevel)
+	t.Setenv("SLOW_AWS_THRESHOLDS", "sqs=1ns")
+
+	ConfigureSlowCallWarnings(zap.New(core))
+	assert.Equal(t, time.Nanosecond, monitor.Threshold(ServiceSQS))
+
+	// Slow calls warn through the configured logger
+	router := NewDeadLetterRouter(&mockSQS{}, DeadLetterPolicy{RetryQueueURL: "retry-dlq"}, "test")
+	assert.NoError(t, router.Send(context.Background(), &events.DeadLetterEvent{ErrorType: "transient"}))
+	assert.Equal(t, 1, logs.FilterMessage("slow AWS operation").Len())
+
+	// An invalid setting is fatal
+	t.Setenv("SLOW_AWS_THRESHOLDS", "sqs=fast")
+	fatal := zap.New(core, zap.WithFatalHook(zapcore.WriteThenPanic))
+	assert.Panics(t, func() { ConfigureSlowCallWarnings(fatal) })
+	assert.Equal(t, 1, logs.FilterMessage("invalid SLOW_AWS_THRESHOLDS").Len())
+}
+
+// scriptedQueue returns batches of the given sizes in turn, failing for a
+// negative size, and calls done once the script is used up
+type scriptedQueue struct {
+	batches []int
+	calls   int
+	done    func()
+}
+
+func (q *scriptedQueue) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	if q.calls >= len(q.batches) {
+		q.done()
+		return nil, ctx.Err()
+	}
+	size := q.batches[q.calls]
+	q.calls++
+	if size < 0 {
+		return nil, errors.New("service unavailable")
+	}
+	messages := make([]sqstypes.Message, size)
+	for i := range messages {
+		messages[i] = sqstypes.Message{MessageId: aws.String(fmt.Sprintf("msg-%d-%d", q.calls, i))}
+	}
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func TestPoller_BacksOffWhenEmptyAndResetsOnMessages(t *testing.T) {
+	metrics.SQSPolls.Reset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := &scriptedQueue{batches: []int{0, 0, 0, 0, 0, 2, 0, -1, 1}, done: cancel}
+	poller := NewPoller(queue, "https://sqs.us-west-2.amazonaws.com/123456789012/work-queue", 100*time.Millisecond, time.Second)
+
+	var waits []time.Duration
+	poller.wait = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	var receiveErrors int
+	poller.SetReceiveErrorHandler(func(err error) { receiveErrors++ })
+	var handled int
+	err := poller.Run(ctx, func(ctx context.Context, messages []sqstypes.Message) error {
+		handled += len(messages)
+		return nil
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 3, handled)
+	assert.Equal(t, 1, receiveErrors)
+	// Doubles up to the cap, re-polls at once after messages, then starts over
+	assert.Equal(t, []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+	}, waits)
+	assert.Equal(t, time.Duration(0), poller.Backoff())
+
+	assert.Equal(t, float64(6), testutil.ToFloat64(metrics.SQSPolls.WithLabelValues("work-queue", "empty")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.SQSPolls.WithLabelValues("work-queue", "messages")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.SQSPolls.WithLabelValues("work-queue", "error")))
+}
+
+func TestPoller_StopsOnHandlerError(t *testing.T) {
+	queue := &scriptedQueue{batches: []int{1, 1}, done: func() {}}
+	poller := NewPoller(queue, "work-queue", time.Millisecond, time.Millisecond)
+
+	handlerErr := errors.New("handler failed")
+	err := poller.Run(context.Background(), func(ctx context.Context, messages []sqstypes.Message) error {
+		return handlerErr
+	})
+
+	assert.ErrorIs(t, err, handlerErr)
+	assert.Equal(t, 1, queue.calls)
+}
+
+func TestPoller_WaitHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := &scriptedQueue{batches: []int{0}, done: func() {}}
+	poller := NewPoller(queue, "work-queue", time.Hour, time.Hour)
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	err := poller.Run(ctx, func(ctx context.Context, messages []sqstypes.Message) error { return nil })
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// memoryReconciliationStore keeps reconciliation records by source event ID
+type memoryReconciliationStore struct {
+	records map[string]ReconciliationRecord
+	getErr  error
+}
+
+func (m *memoryReconciliationStore) PutItem(ctx context.Context, item interface{}) error {
+	record := item.(ReconciliationRecord)
+	m.records[record.SourceEventID] = record
+	return nil
+}
+
+func (m *memoryReconciliationStore) GetItem(ctx context.Context, key map[string]types.AttributeValue, result interface{}) error {
+	if m.getErr != nil {
+		return m.getErr
+	}
+	record, ok := m.records[key["source_event_id"].(*types.AttributeValueMemberS).Value]
+	if !ok {
+		return ErrItemNotFound
+	}
+	*result.(*ReconciliationRecord) = record
+	return nil
+}
+
+func TestReconciliationLog_Write(t *testing.T) {
+	store := &memoryReconciliationStore{records: make(map[string]ReconciliationRecord)}
+	log := NewReconciliationLog(store, time.Hour)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	log.now = func() time.Time { return now }
+
+	err := log.Write(context.Background(), ReconciliationRecord{
+		SourceEventID:    "stream-1",
+		PublishedEventID: "stream-1",
+		Status:           ReconciliationPublished,
+	})
+
+	assert.NoError(t, err)
+	record := store.records["stream-1"]
+	assert.Equal(t, ReconciliationPublished, record.Status)
+	assert.Equal(t, now, record.Timestamp)
+	assert.Equal(t, now.Add(time.Hour).Unix(), record.ExpiresAt)
+}
+
+func TestReconciliationLog_Unpublished(t *testing.T) {
+	store := &memoryReconciliationStore{records: map[string]ReconciliationRecord{
+		"published": {SourceEventID: "published", Status: ReconciliationPublished},
+		"failed":    {SourceEventID: "failed", Status: ReconciliationFailed},
+		"buffered":  {SourceEventID: "buffered", Status: ReconciliationBuffered},
+	}}
+	log := NewReconciliationLog(store, 0)
+
+	unpublished, err := log.Unpublished(context.Background(), []string{"missing", "published", "failed", "buffered"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"missing", "failed", "buffered"}, unpublished)
+
+	store.getErr = errors.New("throttled")
+	_, err = log.Unpublished(context.Background(), []string{"published"})
+	assert.ErrorContains(t, err, "throttled")
+}
+
+func TestReconciliationRecord_Marshal(t *testing.T) {
+	item, err := attributevalue.MarshalMap(ReconciliationRecord{SourceEventID: "stream-1", Status: ReconciliationFailed})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "stream-1"}, item["source_event_id"])
+	assert.NotContains(t, item, "published_event_id")
+	assert.NotContains(t, item, "expires_at")
+}
+
+// mockDedupTable enforces the idempotency key conditions like DynamoDB would
+type mockDedupTable struct {
+	items    map[string]map[string]types.AttributeValue
+	puts     []*dynamodb.PutItemInput
+	released []string
+}
+
+func newMockDedupTable() *mockDedupTable {
+	return &mockDedupTable{items: make(map[string]map[string]types.AttributeValue)}
+}
+
+func (m *mockDedupTable) status(key string) string {
+	if status, ok := m.items[key]["status"].(*types.AttributeValueMemberS); ok {
+		return status.Value
+	}
+	return ""
+}
+
+func (m *mockDedupTable) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.puts = append(m.puts, params)
+	key := params.Item["idempotency_key"].(*types.AttributeValueMemberS).Value
+	if old, ok := m.items[key]; ok && params.ConditionExpression != nil {
+		now := params.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN).Value
+		if old["expires_at"].(*types.AttributeValueMemberN).Value >= now {
+			return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed"), Item: old}
+		}
+	}
+	m.items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDedupTable) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := params.Key["idempotency_key"].(*types.AttributeValueMemberS).Value
+	if m.status(key) != dedupInProgress {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	m.released = append(m.released, key)
+	delete(m.items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestPublishCrossRegionEvent_SkipsDuplicate(t *testing.T) {
+	metrics.PublishDeduped.Reset()
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	table := newMockDedupTable()
+	publisher := NewEventBridgePublisher(client, "test-bus", "event-router")
+	publisher.SetDeduplicator(NewDedupStore(table, "publish-dedup", time.Hour))
+
+	event := &events.CrossRegionEvent{BaseEvent: events.BaseEvent{EventID: "stream-event-1"}, TargetRegion: "us-east-1"}
+
+	// The first publish claims the key, goes out and marks the key published
+	assert.NoError(t, publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", event))
+	assert.Len(t, client.calls, 1)
+	assert.Len(t, table.puts, 2)
+	assert.Equal(t, "publish-dedup", aws.ToString(table.puts[0].TableName))
+	assert.Contains(t, aws.ToString(table.puts[0].ConditionExpression), "attribute_not_exists(idempotency_key)")
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "in_progress"}, table.puts[0].Item["status"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "published"}, table.puts[1].Item["status"])
+	assert.Contains(t, table.puts[1].Item, "expires_at")
+
+	// A retry of the same event is skipped
+	assert.NoError(t, publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", event))
+	assert.Len(t, client.calls, 1)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.PublishDeduped.WithLabelValues("event-router", "us-east-1")))
+}
+
+func TestPublishCrossRegionEventResult_ReportsEventID(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{
+		output: &eventbridge.PutEventsOutput{Entries: []ebtypes.PutEventsResultEntry{{EventId: aws.String("eb-event-1")}}},
+	}}}
+	publisher := NewEventBridgePublisher(client, "test-bus", "event-router")
+	publisher.SetDeduplicator(NewDedupStore(newMockDedupTable(), "publish-dedup", time.Hour))
+
+	event := &events.CrossRegionEvent{BaseEvent: events.BaseEvent{EventID: "stream-event-1"}, TargetRegion: "us-east-1"}
+
+	result, err := publisher.PublishCrossRegionEventResult(context.Background(), "us-east-1", event)
+	assert.NoError(t, err)
+	assert.Equal(t, "eb-event-1", result.EventID)
+
+	// A skipped duplicate published nothing
+	result, err = publisher.PublishCrossRegionEventResult(context.Background(), "us-east-1", event)
+	assert.NoError(t, err)
+	assert.Empty(t, result.EventID)
+}
+
+func TestPublishCrossRegionEvent_ReleasesKeyOnFailure(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{err: errors.New("partner region unavailable")}}}
+	table := newMockDedupTable()
+	publisher := NewEventBridgePublisher(client, "test-bus", "event-router")
+	publisher.sleep = func(time.Duration) {}
+	publisher.SetDeduplicator(NewDedupStore(table, "publish-dedup", time.Hour))
+
+	event := &events.CrossRegionEvent{BaseEvent: events.BaseEvent{EventID: "stream-event-2"}}
+	err := publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", event)
+
+	assert.Error(t, err)
+	key, hashErr := events.ContentHash(event)
+	assert.NoError(t, hashErr)
+	assert.Equal(t, []string{key}, table.released)
+	assert.Empty(t, table.items)
+}
+
+func TestPublishCrossRegionEvent_ReleasesKeyWhenCancelled(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{err: context.Canceled}}}
+	table := newMockDedupTable()
+	publisher := NewEventBridgePublisher(client, "test-bus", "event-router")
+	publisher.sleep = func(time.Duration) {}
+	publisher.SetDeduplicator(NewDedupStore(table, "publish-dedup", time.Hour))
+
+	// The invocation times out while the event is being published
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	event := &events.CrossRegionEvent{BaseEvent: events.BaseEvent{EventID: "stream-event-3"}}
+	assert.Error(t, publisher.PublishCrossRegionEvent(ctx, "us-east-1", event))
+
+	assert.Len(t, table.released, 1)
+	assert.Empty(t, table.items)
+}
+
+func TestPublishCrossRegionEvent_ExpiredLeaseIsReclaimed(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	table := newMockDedupTable()
+	publisher := NewEventBridgePublisher(client, "test-bus", "event-router")
+	store := NewDedupStore(table, "publish-dedup", time.Hour)
+	now := time.Unix(1700000000, 0)
+	store.now = func() time.Time { return now }
+	publisher.SetDeduplicator(store)
+
+	event := &events.CrossRegionEvent{BaseEvent: events.BaseEvent{EventID: "stream-event-4"}}
+	key, err := events.ContentHash(event)
+	assert.NoError(t, err)
+
+	// A publisher crashed after claiming the key
+	claimed, err := store.Claim(context.Background(), key)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	// The retry neither skips the event nor publishes it while the lease holds
+	err = publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", event)
+	assert.ErrorIs(t, err, ErrDedupInProgress)
+	assert.Empty(t, client.calls)
+
+	// Once the lease expires the event is published
+	now = now.Add(defaultDedupLease + time.Second)
+	assert.NoError(t, publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", event))
+	assert.Len(t, client.calls, 1)
+	assert.Equal(t, dedupPublished, table.status(key))
+}
+
+func TestPublishCrossRegionEvent_CustomIdempotencyKey(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	table := newMockDedupTable()
+	publisher := NewEventBridgePublisher(client, "test-bus", "event-router")
+	publisher.SetDeduplicator(NewDedupStore(table, "publish-dedup", time.Hour))
+
+	// Keyed by tenant, entity and version, so a re-stamped event is still a duplicate
+	publisher.SetIdempotencyKeyFunc(func(event interface{}) (string, error) {
+		e := event.(*events.CrossRegionEvent)
+		return fmt.Sprintf("%s/%s/%s", e.Metadata.TenantID, e.Payload["order_id"], e.Metadata.Version), nil
+	})
+
+	event := func(eventID string, timestamp time.Time) *events.CrossRegionEvent {
+		return &events.CrossRegionEvent{BaseEvent: events.BaseEvent{
+			EventID:   eventID,
+			Timestamp: timestamp,
+			Metadata:  events.EventMetadata{TenantID: "tenant-a", Version: "3"},
+			Payload:   map[string]interface{}{"order_id": "order-1"},
+		}}
+	}
+
+	assert.NoError(t, publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", event("evt-1", time.Now())))
+	assert.NoError(t, publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", event("evt-2", time.Now().Add(time.Second))))
+
+	assert.Len(t, client.calls, 1)
+	assert.Equal(t, "tenant-a/order-1/3", table.puts[0].Item["idempotency_key"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestPublishCrossRegionEvent_WithoutKeyPublishes(t *testing.T) {
+	client := &mockEventBridge{responses: []mockPutEventsResponse{{}}}
+	table := newMockDedupTable()
+	publisher := NewEventBridgePublisher(client, "test-bus", "event-router")
+	publisher.SetDeduplicator(NewDedupStore(table, "publish-dedup", time.Hour))
+	publisher.SetIdempotencyKeyFunc(events.EventIDIdempotencyKey)
+
+	assert.NoError(t, publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", map[string]string{"id": "1"}))
+	assert.NoError(t, publisher.PublishCrossRegionEvent(context.Background(), "us-east-1", map[string]string{"id": "1"}))
+
+	assert.Len(t, client.calls, 2)
+	assert.Empty(t, table.puts)
+}
+
+// mockVersionedTable holds one item version and enforces the version
+// condition of conditional deletes like DynamoDB would
+type mockVersionedTable struct {
+	DynamoDBAPI
+	version int
+	deletes []*dynamodb.DeleteItemInput
+}
+
+func (m *mockVersionedTable) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.deletes = append(m.deletes, params)
+	version, _ := strconv.Atoi(params.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberN).Value)
+	if m.version > version {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBHelper_DeleteItemIfNotNewer(t *testing.T) {
+	key := map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: "order-1"}}
+
+	t.Run("matching version is deleted", func(t *testing.T) {
+		client := &mockVersionedTable{version: 3}
+		helper := NewDynamoDBHelper(client, "replica")
+
+		deleted, err := helper.DeleteItemIfNotNewer(context.Background(), key, "version", 3)
+
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+		if assert.Len(t, client.deletes, 1) {
+			input := client.deletes[0]
+			assert.Equal(t, "attribute_not_exists(#version) OR #version <= :version", aws.ToString(input.ConditionExpression))
+			assert.Equal(t, map[string]string{"#version": "version"}, input.ExpressionAttributeNames)
+		}
+	})
+
+	t.Run("newer replica is kept", func(t *testing.T) {
+		client := &mockVersionedTable{version: 4}
+		helper := NewDynamoDBHelper(client, "replica")
+
+		deleted, err := helper.DeleteItemIfNotNewer(context.Background(), key, "version", 3)
+
+		assert.NoError(t, err)
+		assert.False(t, deleted)
+	})
+}
+
+// mockMissingItemTable holds no items, failing conditional updates like
+// DynamoDB would
+type mockMissingItemTable struct {
+	DynamoDBAPI
+	updates []*dynamodb.UpdateItemInput
+}
+
+func (m *mockMissingItemTable) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updates = append(m.updates, params)
+	if params.ConditionExpression != nil {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func TestDynamoDBHelper_ApplyDiffUpdateIfExists(t *testing.T) {
+	key := map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "order-1"},
+		"sk": &types.AttributeValueMemberS{Value: "v1"},
+	}
+	update, err := BuildDiffUpdate(map[string]interface{}{"status": "new"}, map[string]interface{}{"status": "shipped"})
+	assert.NoError(t, err)
+
+	client := &mockMissingItemTable{}
+	helper := NewDynamoDBHelper(client, "replica")
+
+	applied, err := helper.ApplyDiffUpdateIfExists(context.Background(), key, update)
+
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	if assert.Len(t, client.updates, 1) {
+		input := client.updates[0]
+		assert.Equal(t, "attribute_exists(#key)", aws.ToString(input.ConditionExpression))
+		assert.Equal(t, "pk", input.ExpressionAttributeNames["#key"])
+		assert.Equal(t, "status", input.ExpressionAttributeNames["#a0"])
+	}
+	// The update's own names are left untouched
+	assert.NotContains(t, update.Names, "#key")
+}
+
+// mockArchive is an in-memory S3 bucket listing keys in order, pageSize at a time
+type mockArchive struct {
+	objects  map[string]string
+	pageSize int
+	puts     int
+}
+
+func (m *mockArchive) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.StartAfter) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	offset, _ := strconv.Atoi(aws.ToString(params.ContinuationToken))
+	end := offset + m.pageSize
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(keys))}
+	if end >= len(keys) {
+		end = len(keys)
+	} else {
+		output.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	for _, key := range keys[offset:end] {
+		output.Contents = append(output.Contents, s3types.Object{Key: aws.String(key)})
+	}
+	return output, nil
+}
+
+func (m *mockArchive) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := m.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func (m *mockArchive) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	m.puts++
+	m.objects[aws.ToString(params.Key)] = string(data)
+	return &s3.PutObjectOutput{}, nil
+}
+
+// archiveLines encodes events as NDJSON
+func archiveLines(t *testing.T, archived ...events.BaseEvent) string {
+	var buf strings.Builder
+	for _, event := range archived {
+		data, err := json.Marshal(event)
+		assert.NoError(t, err)
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// failingAfterSink accepts limit events and fails every publish after them
+type failingAfterSink struct {
+	recordingEventSink
+	limit int
+}
+
+func (s *failingAfterSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	if len(s.detailTypes) >= s.limit {
+		return errors.New("event bus unavailable")
+	}
+	return s.recordingEventSink.Publish(ctx, detailType, detail)
+}
+
+func newTestArchive(t *testing.T) *mockArchive {
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	return &mockArchive{pageSize: 1, objects: map[string]string{
+		"archive/2024/03/01/part-0.ndjson": archiveLines(t,
+			events.BaseEvent{EventID: "evt-1", EventType: events.EventTypeOrderPlaced, Timestamp: base.Add(time.Hour)},
+			events.BaseEvent{EventID: "evt-2", EventType: events.EventTypeCustomerCreated, Timestamp: base.Add(time.Hour)},
+		) + "not json\n\n",
+		"archive/2024/03/01/part-1.ndjson": archiveLines(t,
+			events.BaseEvent{EventID: "evt-3", EventType: events.EventTypeOrderPlaced, Timestamp: base.Add(2 * time.Hour)},
+			events.BaseEvent{EventID: "evt-4", EventType: events.EventTypeOrderPlaced, Timestamp: base.Add(30 * time.Hour)},
+			events.BaseEvent{EventID: "evt-5", EventType: events.EventTypeOrderPlaced, Timestamp: base.Add(3 * time.Hour)},
+		),
+		"other/part-0.ndjson": archiveLines(t,
+			events.BaseEvent{EventID: "evt-6", EventType: events.EventTypeOrderPlaced, Timestamp: base.Add(time.Hour)},
+		),
+	}}
+}
+
+func replayedIDs(sink *recordingEventSink) []string {
+	var ids []string
+	for _, detail := range sink.details {
+		ids = append(ids, detail.(*events.BaseEvent).EventID)
+	}
+	return ids
+}
+
+func TestReplayer_FiltersAndPacesEvents(t *testing.T) {
+	archive := newTestArchive(t)
+	sink := &recordingEventSink{}
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	replayer := NewReplayer(archive, "event-archive", "archive/", sink)
+	replayer.SetFilter(ReplayFilter{
+		EventTypes: []string{events.EventTypeOrderPlaced},
+		From:       base,
+		To:         base.Add(24 * time.Hour),
+	})
+	replayer.SetRate(10)
+
+	// The fake clock only advances while the replayer waits
+	clock := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	replayer.now = func() time.Time { return clock }
+	replayer.wait = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		clock = clock.Add(d)
+		return nil
+	}
+
+	stats, err := replayer.Run(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"evt-1", "evt-3", "evt-5"}, replayedIDs(sink))
+	assert.Equal(t, []string{events.EventTypeOrderPlaced, events.EventTypeOrderPlaced, events.EventTypeOrderPlaced}, sink.detailTypes)
+	// Ten events a second is one every 100ms after the first
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}, waits)
+	assert.Equal(t, ReplayStats{Objects: 2, Published: 3, Filtered: 2, Malformed: 1}, stats)
+	for _, detail := range sink.details {
+		assert.True(t, detail.(*events.BaseEvent).Metadata.Replay)
+	}
+}
+
+func TestReplayer_ResumesFromCheckpoint(t *testing.T) {
+	archive := newTestArchive(t)
+	const checkpointKey = "checkpoints/replay.json"
+
+	// The first run fails partway through the second object
+	failing := &failingAfterSink{limit: 3}
+	first := NewReplayer(archive, "event-archive", "archive/", failing)
+	first.SetCheckpointKey(checkpointKey)
+
+	_, err := first.Run(context.Background())
+
+	assert.ErrorContains(t, err, "event bus unavailable")
+	assert.Equal(t, []string{"evt-1", "evt-2", "evt-3"}, replayedIDs(&failing.recordingEventSink))
+
+	var checkpoint ReplayCheckpoint
+	assert.NoError(t, json.Unmarshal([]byte(archive.objects[checkpointKey]), &checkpoint))
+	assert.Equal(t, ReplayCheckpoint{Key: "archive/2024/03/01/part-1.ndjson", Line: 1}, checkpoint)
+
+	// The second run picks up after the last event published
+	sink := &recordingEventSink{}
+	second := NewReplayer(archive, "event-archive", "archive/", sink)
+	second.SetCheckpointKey(checkpointKey)
+
+	stats, err := second.Run(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"evt-4", "evt-5"}, replayedIDs(sink))
+	assert.Equal(t, int64(1), stats.Objects)
+
+	assert.NoError(t, json.Unmarshal([]byte(archive.objects[checkpointKey]), &checkpoint))
+	assert.Equal(t, ReplayCheckpoint{Key: "archive/2024/03/01/part-1.ndjson", Line: 3, Done: true}, checkpoint)
+
+	// A finished replay has nothing left to publish
+	again := NewReplayer(archive, "event-archive", "archive/", &recordingEventSink{})
+	again.SetCheckpointKey(checkpointKey)
+	stats, err = again.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, ReplayStats{}, stats)
+}
+
+func TestReplayFilter_Match(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	event := &events.BaseEvent{EventType: events.EventTypeOrderPlaced, Timestamp: at}
+
+	assert.True(t, ReplayFilter{}.Match(event))
+	assert.True(t, ReplayFilter{EventTypes: []string{events.EventTypeCustomerCreated, events.EventTypeOrderPlaced}}.Match(event))
+	assert.False(t, ReplayFilter{EventTypes: []string{events.EventTypeCustomerCreated}}.Match(event))
+	assert.True(t, ReplayFilter{From: at, To: at.Add(time.Second)}.Match(event))
+	assert.False(t, ReplayFilter{To: at}.Match(event))
+	assert.False(t, ReplayFilter{From: at.Add(time.Second)}.Match(event))
 }
 
 // Integration test placeholders - these would need AWS credentials and real resources
@@ -0,0 +1,119 @@
+// Package awsutilstest provides in-memory fakes of the AWS APIs used by
+// awsutils, for tests that exercise publishers and handlers without AWS
+package awsutilstest
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// FakeEventBridge is an in-memory awsutils.EventBridgeAPI that records every
+// entry it accepts. Failures can be queued for upcoming calls. It is safe
+// for concurrent use.
+type FakeEventBridge struct {
+	mu       sync.Mutex
+	entries  []types.PutEventsRequestEntry
+	calls    int
+	failures []error
+}
+
+// NewFakeEventBridge creates a fake that accepts every call until told to fail
+func NewFakeEventBridge() *FakeEventBridge {
+	return &FakeEventBridge{}
+}
+
+// PutEvents records the entries, or fails with the next queued failure
+func (f *FakeEventBridge) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if len(f.failures) > 0 {
+		err := f.failures[0]
+		f.failures = f.failures[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]types.PutEventsResultEntry, len(params.Entries))
+	for i, entry := range params.Entries {
+		f.entries = append(f.entries, entry)
+		results[i] = types.PutEventsResultEntry{EventId: aws.String(eventID(len(f.entries)))}
+	}
+	return &eventbridge.PutEventsOutput{Entries: results}, nil
+}
+
+// FailNext queues errs to be returned by the next calls, one per call in
+// order. A nil error lets its call succeed.
+func (f *FakeEventBridge) FailNext(errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, errs...)
+}
+
+// Calls returns the number of PutEvents calls, including failed ones
+func (f *FakeEventBridge) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// Count returns the number of entries recorded
+func (f *FakeEventBridge) Count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.entries)
+}
+
+// Entries returns the recorded entries in the order they were accepted
+func (f *FakeEventBridge) Entries() []types.PutEventsRequestEntry {
+	return f.filter(func(types.PutEventsRequestEntry) bool { return true })
+}
+
+// EntriesByDetailType returns the recorded entries with detailType
+func (f *FakeEventBridge) EntriesByDetailType(detailType string) []types.PutEventsRequestEntry {
+	return f.filter(func(entry types.PutEventsRequestEntry) bool {
+		return aws.ToString(entry.DetailType) == detailType
+	})
+}
+
+// EntriesBySource returns the recorded entries from source
+func (f *FakeEventBridge) EntriesBySource(source string) []types.PutEventsRequestEntry {
+	return f.filter(func(entry types.PutEventsRequestEntry) bool {
+		return aws.ToString(entry.Source) == source
+	})
+}
+
+// Reset forgets recorded entries, calls and queued failures
+func (f *FakeEventBridge) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = nil
+	f.calls = 0
+	f.failures = nil
+}
+
+// filter returns a copy of the recorded entries matching match
+func (f *FakeEventBridge) filter(match func(types.PutEventsRequestEntry) bool) []types.PutEventsRequestEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var entries []types.PutEventsRequestEntry
+	for _, entry := range f.entries {
+		if match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// eventID returns the ID reported for the nth recorded entry
+func eventID(n int) string {
+	return "fake-event-" + strconv.Itoa(n)
+}
@@ -0,0 +1,125 @@
+package awsutilstest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+)
+
+func entry(source, detailType string) types.PutEventsRequestEntry {
+	return types.PutEventsRequestEntry{
+		Source:     aws.String(source),
+		DetailType: aws.String(detailType),
+		Detail:     aws.String(`{}`),
+	}
+}
+
+func TestFakeEventBridge_RecordsEntries(t *testing.T) {
+	fake := NewFakeEventBridge()
+
+	output, err := fake.PutEvents(context.Background(), &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{entry("a", "x"), entry("b", "y")},
+	})
+
+	require.NoError(t, err)
+	assert.Zero(t, output.FailedEntryCount)
+	require.Len(t, output.Entries, 2)
+	assert.Equal(t, "fake-event-1", aws.ToString(output.Entries[0].EventId))
+	assert.Equal(t, 1, fake.Calls())
+	assert.Equal(t, 2, fake.Count())
+	assert.Equal(t, "b", aws.ToString(fake.Entries()[1].Source))
+}
+
+func TestFakeEventBridge_Filters(t *testing.T) {
+	fake := NewFakeEventBridge()
+	_, err := fake.PutEvents(context.Background(), &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{entry("a", "x"), entry("b", "x"), entry("a", "y")},
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, fake.EntriesByDetailType("x"), 2)
+	assert.Len(t, fake.EntriesByDetailType("y"), 1)
+	assert.Empty(t, fake.EntriesByDetailType("z"))
+	assert.Len(t, fake.EntriesBySource("a"), 2)
+	assert.Equal(t, "x", aws.ToString(fake.EntriesBySource("b")[0].DetailType))
+}
+
+func TestFakeEventBridge_InjectedFailures(t *testing.T) {
+	fake := NewFakeEventBridge()
+	unavailable := errors.New("service unavailable")
+	fake.FailNext(unavailable, nil, unavailable)
+	input := &eventbridge.PutEventsInput{Entries: []types.PutEventsRequestEntry{entry("a", "x")}}
+
+	_, err := fake.PutEvents(context.Background(), input)
+	assert.ErrorIs(t, err, unavailable)
+	_, err = fake.PutEvents(context.Background(), input)
+	assert.NoError(t, err)
+	_, err = fake.PutEvents(context.Background(), input)
+	assert.ErrorIs(t, err, unavailable)
+	_, err = fake.PutEvents(context.Background(), input)
+	assert.NoError(t, err)
+
+	// Failed calls are counted but record nothing
+	assert.Equal(t, 4, fake.Calls())
+	assert.Equal(t, 2, fake.Count())
+}
+
+func TestFakeEventBridge_Reset(t *testing.T) {
+	fake := NewFakeEventBridge()
+	fake.FailNext(nil, errors.New("unused"))
+	_, err := fake.PutEvents(context.Background(), &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{entry("a", "x")},
+	})
+	require.NoError(t, err)
+
+	fake.Reset()
+
+	assert.Zero(t, fake.Calls())
+	assert.Zero(t, fake.Count())
+	_, err = fake.PutEvents(context.Background(), &eventbridge.PutEventsInput{})
+	assert.NoError(t, err)
+}
+
+func TestFakeEventBridge_Concurrent(t *testing.T) {
+	fake := NewFakeEventBridge()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = fake.PutEvents(context.Background(), &eventbridge.PutEventsInput{
+				Entries: []types.PutEventsRequestEntry{entry("a", "x")},
+			})
+			_ = fake.EntriesByDetailType("x")
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 20, fake.Calls())
+	assert.Equal(t, 20, fake.Count())
+}
+
+func TestFakeEventBridge_WithPublisher(t *testing.T) {
+	fake := NewFakeEventBridge()
+	fake.FailNext(errors.New("connection reset"))
+	publisher := awsutils.NewEventBridgePublisher(fake, "test-bus", "test-source")
+
+	err := publisher.PublishEvent(context.Background(), "order.created", map[string]string{"id": "1"})
+
+	require.NoError(t, err)
+	// The publisher retried past the injected failure
+	assert.Equal(t, 2, fake.Calls())
+	entries := fake.EntriesByDetailType("order.created")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "test-bus", aws.ToString(entries[0].EventBusName))
+	assert.Len(t, fake.EntriesBySource("test-source"), 1)
+}
@@ -0,0 +1,148 @@
+package awsutilstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+)
+
+// RuleHandler receives the events a rule matches, shaped as EventBridge
+// delivers them to a Lambda target
+type RuleHandler func(ctx context.Context, event events.CloudWatchEvent) error
+
+// rule is a registered event pattern and its target
+type rule struct {
+	name    string
+	pattern *awsutils.EventPattern
+	handler RuleHandler
+}
+
+// EventBus is a FakeEventBridge that also evaluates every accepted entry
+// against registered rules and invokes the handler of each rule it matches,
+// synchronously and in registration order, before PutEvents returns. Like
+// EventBridge, handler errors don't fail the publish; they are collected for
+// DeliveryErrors. A handler may publish to the bus itself.
+type EventBus struct {
+	*FakeEventBridge
+
+	mu         sync.Mutex
+	rules      []rule
+	deliveries map[string][]events.CloudWatchEvent
+	errs       []error
+}
+
+// NewEventBus creates a bus with no rules
+func NewEventBus() *EventBus {
+	return &EventBus{
+		FakeEventBridge: NewFakeEventBridge(),
+		deliveries:      make(map[string][]events.CloudWatchEvent),
+	}
+}
+
+// AddRule registers handler for events matching pattern, an EventBridge
+// event pattern
+func (b *EventBus) AddRule(name, pattern string, handler RuleHandler) error {
+	p, err := awsutils.NewEventPattern(pattern)
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", name, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rules = append(b.rules, rule{name: name, pattern: p, handler: handler})
+	return nil
+}
+
+// PutEvents records the entries and delivers them to matching rules. Calls
+// failed through FailNext deliver nothing.
+func (b *EventBus) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	output, err := b.FakeEventBridge.PutEvents(ctx, params, optFns...)
+	if err != nil {
+		return output, err
+	}
+
+	for i, entry := range params.Entries {
+		b.deliver(ctx, entry, aws.ToString(output.Entries[i].EventId))
+	}
+	return output, nil
+}
+
+// Deliveries returns the events delivered to the rule name
+func (b *EventBus) Deliveries(name string) []events.CloudWatchEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]events.CloudWatchEvent(nil), b.deliveries[name]...)
+}
+
+// DeliveryErrors returns the errors returned by rule handlers and from
+// evaluating rules
+func (b *EventBus) DeliveryErrors() []error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]error(nil), b.errs...)
+}
+
+// Reset forgets recorded entries, deliveries and errors, keeping the rules
+func (b *EventBus) Reset() {
+	b.FakeEventBridge.Reset()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliveries = make(map[string][]events.CloudWatchEvent)
+	b.errs = nil
+}
+
+// deliver invokes the handler of every rule entry matches. Handlers run
+// without the lock held, so they can publish to the bus.
+func (b *EventBus) deliver(ctx context.Context, entry types.PutEventsRequestEntry, id string) {
+	b.mu.Lock()
+	rules := append([]rule(nil), b.rules...)
+	b.mu.Unlock()
+
+	event := events.CloudWatchEvent{
+		Version:    "0",
+		ID:         id,
+		DetailType: aws.ToString(entry.DetailType),
+		Source:     aws.ToString(entry.Source),
+		Time:       aws.ToTime(entry.Time),
+		Resources:  entry.Resources,
+		Detail:     json.RawMessage(aws.ToString(entry.Detail)),
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	for _, r := range rules {
+		matched, err := r.pattern.MatchesEntry(entry)
+		if err != nil {
+			b.recordError(fmt.Errorf("rule %s: %w", r.name, err))
+			continue
+		}
+		if !matched {
+			continue
+		}
+
+		b.mu.Lock()
+		b.deliveries[r.name] = append(b.deliveries[r.name], event)
+		b.mu.Unlock()
+
+		if err := r.handler(ctx, event); err != nil {
+			b.recordError(fmt.Errorf("rule %s: %w", r.name, err))
+		}
+	}
+}
+
+// recordError keeps a delivery error for DeliveryErrors
+func (b *EventBus) recordError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.errs = append(b.errs, err)
+}
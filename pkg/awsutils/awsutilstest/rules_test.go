@@ -0,0 +1,113 @@
+package awsutilstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/awsutils"
+)
+
+func TestEventBus_InvokesMatchingRule(t *testing.T) {
+	bus := NewEventBus()
+	var transformed, failed []events.CloudWatchEvent
+	require.NoError(t, bus.AddRule("transformed", `{"source": ["event-transformer"], "detail-type": ["event.transformed"]}`,
+		func(ctx context.Context, event events.CloudWatchEvent) error {
+			transformed = append(transformed, event)
+			return nil
+		}))
+	require.NoError(t, bus.AddRule("validation-failed", `{"detail-type": ["event.validation_failed"]}`,
+		func(ctx context.Context, event events.CloudWatchEvent) error {
+			failed = append(failed, event)
+			return nil
+		}))
+	publisher := awsutils.NewEventBridgePublisher(bus, "test-bus", "event-transformer")
+
+	err := publisher.PublishEvent(context.Background(), "event.transformed", map[string]string{"id": "user-1"})
+
+	require.NoError(t, err)
+	require.Len(t, transformed, 1)
+	assert.Empty(t, failed)
+	assert.Equal(t, "event.transformed", transformed[0].DetailType)
+	assert.Equal(t, "event-transformer", transformed[0].Source)
+	assert.Equal(t, "fake-event-1", transformed[0].ID)
+	assert.False(t, transformed[0].Time.IsZero())
+
+	var detail map[string]string
+	require.NoError(t, json.Unmarshal(transformed[0].Detail, &detail))
+	assert.Equal(t, "user-1", detail["id"])
+
+	assert.Len(t, bus.Deliveries("transformed"), 1)
+	assert.Empty(t, bus.Deliveries("validation-failed"))
+	assert.Equal(t, 1, bus.Count())
+}
+
+func TestEventBus_HandlerCanPublish(t *testing.T) {
+	bus := NewEventBus()
+	downstream := awsutils.NewEventBridgePublisher(bus, "test-bus", "event-transformer")
+	require.NoError(t, bus.AddRule("transform", `{"detail-type": ["user.created"]}`,
+		func(ctx context.Context, event events.CloudWatchEvent) error {
+			return downstream.PublishEvent(ctx, "event.transformed", event.Detail)
+		}))
+	require.NoError(t, bus.AddRule("transformed", `{"detail-type": ["event.transformed"]}`,
+		func(ctx context.Context, event events.CloudWatchEvent) error { return nil }))
+	upstream := awsutils.NewEventBridgePublisher(bus, "test-bus", "user-service")
+
+	require.NoError(t, upstream.PublishEvent(context.Background(), "user.created", map[string]string{"id": "user-1"}))
+
+	assert.Len(t, bus.Deliveries("transform"), 1)
+	assert.Len(t, bus.Deliveries("transformed"), 1)
+	assert.Equal(t, 2, bus.Count())
+}
+
+func TestEventBus_HandlerErrorsDontFailPublish(t *testing.T) {
+	bus := NewEventBus()
+	require.NoError(t, bus.AddRule("broken", `{"detail-type": ["event.transformed"]}`,
+		func(ctx context.Context, event events.CloudWatchEvent) error {
+			return errors.New("target failed")
+		}))
+	publisher := awsutils.NewEventBridgePublisher(bus, "test-bus", "event-transformer")
+
+	err := publisher.PublishEvent(context.Background(), "event.transformed", map[string]string{"id": "user-1"})
+
+	assert.NoError(t, err)
+	require.Len(t, bus.DeliveryErrors(), 1)
+	assert.Contains(t, bus.DeliveryErrors()[0].Error(), "rule broken: target failed")
+
+	bus.Reset()
+	assert.Empty(t, bus.DeliveryErrors())
+	assert.Empty(t, bus.Deliveries("broken"))
+	assert.Zero(t, bus.Count())
+}
+
+func TestEventBus_FailedPublishDeliversNothing(t *testing.T) {
+	bus := NewEventBus()
+	invoked := false
+	require.NoError(t, bus.AddRule("any", `{"source": ["event-transformer"]}`,
+		func(ctx context.Context, event events.CloudWatchEvent) error {
+			invoked = true
+			return nil
+		}))
+	bus.FailNext(errors.New("service unavailable"))
+
+	_, err := bus.PutEvents(context.Background(), &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{entry("event-transformer", "event.transformed")},
+	})
+
+	assert.Error(t, err)
+	assert.False(t, invoked)
+}
+
+func TestEventBus_InvalidPattern(t *testing.T) {
+	bus := NewEventBus()
+
+	err := bus.AddRule("broken", `{"detail-type": "not-a-list"}`, nil)
+
+	assert.ErrorContains(t, err, "rule broken")
+}
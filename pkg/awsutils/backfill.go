@@ -0,0 +1,267 @@
+package awsutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// backfillPageSize is the scan page size, and so the most items copied
+// between checkpoints
+const backfillPageSize = 25
+
+// BackfillAPI is the part of the DynamoDB client used to copy a table
+type BackfillAPI interface {
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// BackfillSegment is the progress of one parallel scan segment. LastKey is
+// the scan position after the last page written to the replica.
+// ItemsSkipped counts items the replica already held in a newer version.
+type BackfillSegment struct {
+	LastKey      map[string]types.AttributeValue
+	ItemsCopied  int64
+	ItemsSkipped int64
+	Done         bool
+}
+
+// backfillSegmentJSON is the JSON form of a BackfillSegment, with LastKey
+// typed so the scan position survives being saved and loaded
+type backfillSegmentJSON struct {
+	LastKey      map[string]TypedKey `json:"last_key,omitempty"`
+	ItemsCopied  int64               `json:"items_copied"`
+	ItemsSkipped int64               `json:"items_skipped"`
+	Done         bool                `json:"done"`
+}
+
+// MarshalJSON encodes the segment with LastKey as typed keys
+func (s BackfillSegment) MarshalJSON() ([]byte, error) {
+	lastKey, err := AttributeValueTypedKeys(s.LastKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backfill scan position: %w", err)
+	}
+	return json.Marshal(backfillSegmentJSON{
+		LastKey:      lastKey,
+		ItemsCopied:  s.ItemsCopied,
+		ItemsSkipped: s.ItemsSkipped,
+		Done:         s.Done,
+	})
+}
+
+// UnmarshalJSON decodes a segment encoded by MarshalJSON
+func (s *BackfillSegment) UnmarshalJSON(data []byte) error {
+	var decoded backfillSegmentJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	var lastKey map[string]types.AttributeValue
+	if len(decoded.LastKey) > 0 {
+		var err error
+		if lastKey, err = TypedKeyAttributeValues(decoded.LastKey); err != nil {
+			return fmt.Errorf("invalid backfill scan position: %w", err)
+		}
+	}
+	*s = BackfillSegment{
+		LastKey:      lastKey,
+		ItemsCopied:  decoded.ItemsCopied,
+		ItemsSkipped: decoded.ItemsSkipped,
+		Done:         decoded.Done,
+	}
+	return nil
+}
+
+// BackfillState is the resumable progress of a backfill, which can be saved
+// as JSON. StartedAt marks when the first run began: stream records from then
+// on must still be replayed to the replica, so stream replication should be
+// enabled before a backfill starts and keep running while it does.
+type BackfillState struct {
+	StartedAt time.Time         `json:"started_at"`
+	Segments  []BackfillSegment `json:"segments"`
+}
+
+// ItemsCopied returns the number of items copied across all segments
+func (s *BackfillState) ItemsCopied() int64 {
+	var total int64
+	for _, segment := range s.Segments {
+		total += segment.ItemsCopied
+	}
+	return total
+}
+
+// Done reports whether every segment has been copied
+func (s *BackfillState) Done() bool {
+	for _, segment := range s.Segments {
+		if !segment.Done {
+			return false
+		}
+	}
+	return len(s.Segments) > 0
+}
+
+// clone returns a copy of s that is safe to keep while the backfill runs
+func (s *BackfillState) clone() BackfillState {
+	c := BackfillState{StartedAt: s.StartedAt, Segments: make([]BackfillSegment, len(s.Segments))}
+	copy(c.Segments, s.Segments)
+	return c
+}
+
+// Backfill copies every item of a source table into a replica table with a
+// parallel Scan, checkpointing after each page so an interrupted run can
+// resume where it stopped. Items are put only where the replica doesn't hold
+// a newer version, so changes stream replication already applied survive.
+type Backfill struct {
+	client           BackfillAPI
+	sourceTable      string
+	replicaTable     string
+	versionAttribute string
+	segments         int
+	pageSize         int32
+	checkpoint       func(BackfillState)
+}
+
+// NewBackfill creates a backfill from sourceTable into replicaTable scanning
+// segments in parallel. versionAttribute names the attribute ordering writes
+// to an item, e.g. "updated_at".
+func NewBackfill(client BackfillAPI, sourceTable, replicaTable, versionAttribute string, segments int) *Backfill {
+	if segments < 1 {
+		segments = 1
+	}
+	return &Backfill{
+		client:           client,
+		sourceTable:      sourceTable,
+		replicaTable:     replicaTable,
+		versionAttribute: versionAttribute,
+		segments:         segments,
+		pageSize:         backfillPageSize,
+	}
+}
+
+// SetCheckpoint registers fn to receive the backfill state after every page
+// written, for persisting so a later Run can resume from it. Calls never
+// overlap, even across segments.
+func (b *Backfill) SetCheckpoint(fn func(BackfillState)) {
+	b.checkpoint = fn
+}
+
+// Run copies the source table into the replica. A nil state starts a new
+// backfill; a state saved from an earlier run resumes it, skipping pages and
+// segments already copied. The returned state reflects all progress made,
+// even when Run fails.
+func (b *Backfill) Run(ctx context.Context, state *BackfillState) (*BackfillState, error) {
+	if b.versionAttribute == "" {
+		return state, fmt.Errorf("backfill needs a version attribute to avoid overwriting newer replica items")
+	}
+	if state == nil {
+		state = &BackfillState{StartedAt: time.Now(), Segments: make([]BackfillSegment, b.segments)}
+	}
+	if len(state.Segments) != b.segments {
+		return state, fmt.Errorf("backfill state has %d segments, want %d", len(state.Segments), b.segments)
+	}
+
+	var mu sync.Mutex
+	g, ctx := errgroup.WithContext(ctx)
+	for segment := range state.Segments {
+		g.Go(func() error {
+			return b.copySegment(ctx, state, segment, &mu)
+		})
+	}
+	err := g.Wait()
+	return state, err
+}
+
+// copySegment scans one segment page by page, writing each page to the
+// replica before recording the scan position
+func (b *Backfill) copySegment(ctx context.Context, state *BackfillState, segment int, mu *sync.Mutex) error {
+	mu.Lock()
+	progress := state.Segments[segment]
+	mu.Unlock()
+	if progress.Done {
+		return nil
+	}
+
+	for {
+		start := time.Now()
+		output, err := b.client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         aws.String(b.sourceTable),
+			Segment:           aws.Int32(int32(segment)),
+			TotalSegments:     aws.Int32(int32(b.segments)),
+			Limit:             aws.Int32(b.pageSize),
+			ExclusiveStartKey: progress.LastKey,
+			ConsistentRead:    aws.Bool(true),
+		})
+		observeSince(ServiceDynamoDB, "Scan", start,
+			zap.String("table", b.sourceTable),
+			zap.Int("segment", segment))
+		if err != nil {
+			return fmt.Errorf("failed to scan segment %d: %w", segment, err)
+		}
+
+		for _, item := range output.Items {
+			written, err := b.putItem(ctx, item)
+			if err != nil {
+				return fmt.Errorf("failed to write segment %d: %w", segment, err)
+			}
+			if written {
+				progress.ItemsCopied++
+			} else {
+				progress.ItemsSkipped++
+			}
+		}
+		progress.LastKey = output.LastEvaluatedKey
+		progress.Done = len(output.LastEvaluatedKey) == 0
+
+		// Checkpoints are serialised so a later one never overwrites a newer save
+		mu.Lock()
+		state.Segments[segment] = progress
+		if b.checkpoint != nil {
+			b.checkpoint(state.clone())
+		}
+		mu.Unlock()
+
+		if progress.Done {
+			return nil
+		}
+	}
+}
+
+// putItem puts item into the replica unless the replica's copy has a newer
+// version, reporting whether it was written. An item without the version
+// attribute only replaces a replica item without one.
+func (b *Backfill) putItem(ctx context.Context, item map[string]types.AttributeValue) (bool, error) {
+	condition := "attribute_not_exists(#version)"
+	var values map[string]types.AttributeValue
+	if version, ok := item[b.versionAttribute]; ok {
+		condition += " OR #version < :version"
+		values = map[string]types.AttributeValue{":version": version}
+	}
+
+	start := time.Now()
+	_, err := b.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(b.replicaTable),
+		Item:                      item,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]string{"#version": b.versionAttribute},
+		ExpressionAttributeValues: values,
+	})
+	observeSince(ServiceDynamoDB, "PutItem", start, zap.String("table", b.replicaTable))
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package awsutils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchPublisher publishes a batch of events in as few calls as possible
+type BatchPublisher interface {
+	PublishEventBatch(ctx context.Context, events []EventBridgeEvent) error
+}
+
+// flushTimer is the part of *time.Timer the buffered sink uses
+type flushTimer interface {
+	Stop() bool
+}
+
+// BufferedSink is an EventSink that collects events and publishes them in
+// batches. A batch is flushed as soon as it reaches maxSize events, or once
+// maxLinger has passed since its first event, whichever comes first, so a
+// quiet period can't leave events stuck in the buffer.
+type BufferedSink struct {
+	publisher BatchPublisher
+	maxSize   int
+	maxLinger time.Duration
+
+	mu         sync.Mutex
+	pending    []EventBridgeEvent
+	firstAt    time.Time
+	timer      flushTimer
+	generation int
+
+	// flushMu keeps flushes in buffer order
+	flushMu sync.Mutex
+
+	onFlushError func(error)
+	now          func() time.Time
+	afterFunc    func(d time.Duration, f func()) flushTimer
+}
+
+// NewBufferedSink creates a sink that flushes to publisher at maxSize events
+// or after maxLinger, whichever comes first
+func NewBufferedSink(publisher BatchPublisher, maxSize int, maxLinger time.Duration) *BufferedSink {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	return &BufferedSink{
+		publisher: publisher,
+		maxSize:   maxSize,
+		maxLinger: maxLinger,
+		now:       time.Now,
+		afterFunc: func(d time.Duration, f func()) flushTimer { return time.AfterFunc(d, f) },
+	}
+}
+
+// SetFlushErrorHandler registers fn to receive errors from flushes triggered
+// by the linger timer, which have no caller to return them to
+func (s *BufferedSink) SetFlushErrorHandler(fn func(error)) {
+	s.onFlushError = fn
+}
+
+// Publish implements EventSink by buffering the event. It returns the flush
+// error when the event fills the batch.
+func (s *BufferedSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	s.mu.Lock()
+	s.pending = append(s.pending, EventBridgeEvent{DetailType: detailType, Detail: detail})
+	if len(s.pending) == 1 {
+		s.firstAt = s.now()
+		generation := s.generation
+		s.timer = s.afterFunc(s.maxLinger, func() { s.lingerFlush(generation) })
+	}
+	full := len(s.pending) >= s.maxSize
+	s.mu.Unlock()
+
+	if full {
+		return s.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush publishes every buffered event now
+func (s *BufferedSink) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batch := s.take()
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return s.publisher.PublishEventBatch(ctx, batch)
+}
+
+// Len returns the number of buffered events
+func (s *BufferedSink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// take removes and returns the pending batch, cancelling its linger timer.
+// Callers hold s.mu.
+func (s *BufferedSink) take() []EventBridgeEvent {
+	batch := s.pending
+	s.pending = nil
+	s.firstAt = time.Time{}
+	s.generation++
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	return batch
+}
+
+// lingerFlush flushes the batch the timer was started for, unless it has
+// already been flushed. A timer that fires before the batch has lingered for
+// maxLinger is rescheduled for the remainder.
+func (s *BufferedSink) lingerFlush(generation int) {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	if generation != s.generation || len(s.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	if remaining := s.maxLinger - s.now().Sub(s.firstAt); remaining > 0 {
+		s.timer = s.afterFunc(remaining, func() { s.lingerFlush(generation) })
+		s.mu.Unlock()
+		return
+	}
+	batch := s.take()
+	s.mu.Unlock()
+
+	if err := s.publisher.PublishEventBatch(context.Background(), batch); err != nil && s.onFlushError != nil {
+		s.onFlushError(err)
+	}
+}
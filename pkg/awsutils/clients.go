@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -12,6 +13,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
 )
 
 // AWSClients holds all AWS service clients
@@ -78,7 +81,9 @@ func (c *AWSClients) GetSecret(ctx context.Context, secretName string) (string,
 		SecretId: aws.String(secretName),
 	}
 
+	start := time.Now()
 	result, err := c.SecretsManager.GetSecretValue(ctx, input)
+	observeSince(ServiceSecretsManager, "GetSecretValue", start, zap.String("secret", secretName))
 	if err != nil {
 		return "", fmt.Errorf("failed to get secret %s: %w", secretName, err)
 	}
@@ -107,7 +112,9 @@ func (c *AWSClients) SendToDeadLetterQueue(ctx context.Context, queueURL, messag
 		},
 	}
 
+	start := time.Now()
 	_, err := c.SQS.SendMessage(ctx, input)
+	observeSince(ServiceSQS, "SendMessage", start, zap.String("queue_url", queueURL))
 	if err != nil {
 		return fmt.Errorf("failed to send message to DLQ: %w", err)
 	}
@@ -115,6 +122,19 @@ func (c *AWSClients) SendToDeadLetterQueue(ctx context.Context, queueURL, messag
 	return nil
 }
 
+// EnrichDeadLetterEvent adds diagnostic context to a DLQ event: the Lambda request
+// ID from the invocation context, the function name and version from the
+// environment, the region, and the ARN of the event source that produced it
+func EnrichDeadLetterEvent(ctx context.Context, dlqEvent *events.DeadLetterEvent, region, eventSourceARN string) {
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		dlqEvent.RequestID = lc.AwsRequestID
+	}
+	dlqEvent.FunctionName = lambdacontext.FunctionName
+	dlqEvent.FunctionVersion = lambdacontext.FunctionVersion
+	dlqEvent.Region = region
+	dlqEvent.EventSourceARN = eventSourceARN
+}
+
 // GetCurrentRegion returns the AWS region from environment or config
 func GetCurrentRegion(ctx context.Context) (string, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
@@ -0,0 +1,223 @@
+package awsutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	lambdaevents "github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/wgu/go-performance-enablement/pkg/batch"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// SQSSendAPI is the part of the SQS client used to send dead-letter messages
+type SQSSendAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// DeadLetterPolicy decides where a failed event goes. Events that have failed
+// MaxFailures times or more are parked in the permanent-failure queue so they
+// stop cycling between processing and the retry DLQ. Below that, an event
+// goes to the queue ErrorQueueURLs maps its error type to, e.g. validation
+// failures to a manual review queue, or to the retry DLQ by default. An event
+// replayed from the DLQ by a DeadLetterReplayer keeps its DeadLetterEvent,
+// with the new failure added by RecordFailure, for the count to reach
+// MaxFailures.
+type DeadLetterPolicy struct {
+	RetryQueueURL     string
+	PermanentQueueURL string
+	MaxFailures       int // zero disables the limit
+	ErrorQueueURLs    map[string]string
+}
+
+// Permanent reports whether an event with failureCount failures is terminal.
+// Without a permanent queue every event stays retryable.
+func (p DeadLetterPolicy) Permanent(failureCount int) bool {
+	return p.MaxFailures > 0 && p.PermanentQueueURL != "" && failureCount >= p.MaxFailures
+}
+
+// QueueURL returns the queue for an event with failureCount failures
+func (p DeadLetterPolicy) QueueURL(failureCount int) string {
+	return p.QueueURLFor("", failureCount)
+}
+
+// QueueURLFor returns the queue for an event of errorType with failureCount
+// failures
+func (p DeadLetterPolicy) QueueURLFor(errorType string, failureCount int) string {
+	if p.Permanent(failureCount) {
+		return p.PermanentQueueURL
+	}
+	if url := p.ErrorQueueURLs[errorType]; url != "" {
+		return url
+	}
+	return p.RetryQueueURL
+}
+
+// ParseMaxFailures parses a DeadLetterPolicy.MaxFailures setting. Every event
+// has failed once by the time it is dead-lettered, so a limit below 2 would
+// park every event on its first failure; it is rejected. An empty value
+// disables the limit.
+func ParseMaxFailures(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	maxFailures, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max failure count %q: %w", value, err)
+	}
+	if maxFailures < 2 {
+		return 0, fmt.Errorf("invalid max failure count %d: must be at least 2", maxFailures)
+	}
+	return maxFailures, nil
+}
+
+// ParseErrorQueueURLs parses a comma-separated list of errorType=queueURL
+// entries, e.g. "validation_failure=https://sqs.../review". Empty entries are
+// ignored.
+func ParseErrorQueueURLs(spec string) (map[string]string, error) {
+	urls := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		errorType, url, ok := strings.Cut(entry, "=")
+		errorType, url = strings.TrimSpace(errorType), strings.TrimSpace(url)
+		if !ok || errorType == "" || url == "" {
+			return nil, fmt.Errorf("invalid dead-letter queue mapping %q: expected errorType=queueURL", entry)
+		}
+		urls[errorType] = url
+	}
+	return urls, nil
+}
+
+// DeadLetterRouter sends failed events to the queue chosen by its policy
+type DeadLetterRouter struct {
+	client SQSSendAPI
+	policy DeadLetterPolicy
+	source string
+}
+
+// NewDeadLetterRouter creates a router that labels its metrics with source
+func NewDeadLetterRouter(client SQSSendAPI, policy DeadLetterPolicy, source string) *DeadLetterRouter {
+	return &DeadLetterRouter{
+		client: client,
+		policy: policy,
+		source: source,
+	}
+}
+
+// Send routes the event to the queue for its error type or, once it has
+// failed too many times, to the permanent-failure queue
+func (r *DeadLetterRouter) Send(ctx context.Context, dlqEvent *events.DeadLetterEvent) error {
+	messageBody, err := json.Marshal(dlqEvent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal DLQ event: %w", err)
+	}
+
+	permanent := r.policy.Permanent(dlqEvent.FailureCount)
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(r.policy.QueueURLFor(dlqEvent.ErrorType, dlqEvent.FailureCount)),
+		MessageBody:       aws.String(string(messageBody)),
+		MessageAttributes: deadLetterAttributes(dlqEvent),
+	}
+
+	start := time.Now()
+	_, err = r.client.SendMessage(ctx, input)
+	observeSince(ServiceSQS, "SendMessage", start, zap.String("queue_url", aws.ToString(input.QueueUrl)))
+	if err != nil {
+		if permanent {
+			return fmt.Errorf("failed to send message to permanent failure queue: %w", err)
+		}
+		return fmt.Errorf("failed to send message to DLQ: %w", err)
+	}
+
+	recordDeadLetter(r.source, permanent, dlqEvent.ErrorType)
+	return nil
+}
+
+// NewPanicDeadLetterEvent builds a DLQ event for a stream record whose
+// processing in source panicked. It carries the raw stream record, since the
+// panic may have come before the record was parsed.
+func NewPanicDeadLetterEvent(ctx context.Context, source, region string, record lambdaevents.DynamoDBEventRecord, panicErr *batch.PanicError) (*events.DeadLetterEvent, error) {
+	dlqEvent := &events.DeadLetterEvent{
+		ErrorMessage:  panicErr.Error(),
+		ErrorType:     events.ErrorTypePanic,
+		FailureCount:  1,
+		FirstFailure:  time.Now(),
+		LastFailure:   time.Now(),
+		SourceHandler: source,
+		StackTrace:    string(panicErr.Stack),
+	}
+	EnrichDeadLetterEvent(ctx, dlqEvent, region, record.EventSourceArn)
+
+	originalJSON, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal original record: %w", err)
+	}
+	dlqEvent.OriginalEvent = originalJSON
+
+	return dlqEvent, nil
+}
+
+// SendPanic dead-letters a stream record whose processing panicked, logging
+// the panic with its stack. The record counts as handled once it is in the
+// DLQ; if it can't be sent, panicErr is returned to fail the record.
+func (r *DeadLetterRouter) SendPanic(ctx context.Context, logger *zap.Logger, region string, record lambdaevents.DynamoDBEventRecord, panicErr *batch.PanicError) error {
+	logger.Error("recovered panic processing stream record",
+		zap.Any("panic", panicErr.Value),
+		zap.String("event_id", record.EventID),
+		zap.ByteString("stack", panicErr.Stack),
+	)
+
+	dlqEvent, err := NewPanicDeadLetterEvent(ctx, r.source, region, record, panicErr)
+	if err == nil {
+		err = r.Send(ctx, dlqEvent)
+	}
+	if err != nil {
+		logger.Error("failed to send to DLQ",
+			zap.Error(err),
+			ErrorField(err),
+			zap.String("event_id", record.EventID),
+		)
+		return panicErr
+	}
+	return nil
+}
+
+// deadLetterAttributes returns the message attributes of a DLQ message
+func deadLetterAttributes(dlqEvent *events.DeadLetterEvent) map[string]types.MessageAttributeValue {
+	return map[string]types.MessageAttributeValue{
+		"ErrorMessage": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(dlqEvent.ErrorMessage),
+		},
+		"FailureTimestamp": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(time.Now().Format(time.RFC3339)),
+		},
+		"FailureCount": {
+			DataType:    aws.String("Number"),
+			StringValue: aws.String(strconv.Itoa(dlqEvent.FailureCount)),
+		},
+	}
+}
+
+// recordDeadLetter counts a message delivered to the DLQ or, when permanent,
+// to the permanent-failure queue
+func recordDeadLetter(source string, permanent bool, errorType string) {
+	if permanent {
+		metrics.PermanentFailures.WithLabelValues(source, errorType).Inc()
+	} else {
+		metrics.DLQMessages.WithLabelValues(source, errorType).Inc()
+	}
+}
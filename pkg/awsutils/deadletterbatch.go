@@ -0,0 +1,282 @@
+package awsutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxSQSBatchSize is the most messages SQS accepts in one SendMessageBatch call
+	maxSQSBatchSize = 10
+
+	// maxSQSBatchBytes is the most SQS accepts in one SendMessageBatch call
+	// across all message bodies and attributes
+	maxSQSBatchBytes = 256 << 10
+)
+
+// SQSBatchSendAPI is the part of the SQS client used to send dead-letter
+// messages in batches
+type SQSBatchSendAPI interface {
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// DeadLetterFailure is a dead-lettered event that couldn't be sent, with the
+// SQS error code and message of its batch entry when SQS rejected it alone
+type DeadLetterFailure struct {
+	Event   *events.DeadLetterEvent
+	Code    string
+	Message string
+	Err     error
+}
+
+// DeadLetterBatchError is returned when some dead-lettered events weren't
+// sent. Failures lists them.
+type DeadLetterBatchError struct {
+	Failures []DeadLetterFailure
+	Total    int
+}
+
+func (e *DeadLetterBatchError) Error() string {
+	return fmt.Sprintf("failed to send %d of %d dead-letter messages", len(e.Failures), e.Total)
+}
+
+// Unwrap returns the errors of the failed sends
+func (e *DeadLetterBatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		if failure.Err != nil {
+			errs = append(errs, failure.Err)
+		}
+	}
+	return errs
+}
+
+// pendingDeadLetter is an event waiting to be sent, marshaled and routed
+type pendingDeadLetter struct {
+	event      *events.DeadLetterEvent
+	body       string
+	attributes map[string]types.MessageAttributeValue
+	size       int
+	permanent  bool
+}
+
+// messageSize returns the size SQS counts toward a batch's payload: the body
+// and each attribute's name, data type and value
+func messageSize(body string, attributes map[string]types.MessageAttributeValue) int {
+	size := len(body)
+	for name, value := range attributes {
+		size += len(name) + len(aws.ToString(value.DataType)) + len(aws.ToString(value.StringValue)) + len(value.BinaryValue)
+	}
+	return size
+}
+
+// splitBatches splits queued into batches within both SendMessageBatch
+// limits. An event over the size limit on its own is sent alone.
+func splitBatches(queued []pendingDeadLetter) [][]pendingDeadLetter {
+	var batches [][]pendingDeadLetter
+	start, size := 0, 0
+	for i, pending := range queued {
+		if i > start && (i-start == maxSQSBatchSize || size+pending.size > maxSQSBatchBytes) {
+			batches = append(batches, queued[start:i])
+			start, size = i, 0
+		}
+		size += pending.size
+	}
+	if start < len(queued) {
+		batches = append(batches, queued[start:])
+	}
+	return batches
+}
+
+// DeadLetterBatcher sends failed events like DeadLetterRouter but batches
+// them, up to ten and 256 KiB per SendMessageBatch call, so a failing
+// invocation doesn't make a call per event. Events are routed by the same
+// policy and sent once a queue has a full batch or on Flush, which must be
+// called before the invocation ends. It is safe for concurrent use.
+type DeadLetterBatcher struct {
+	client SQSBatchSendAPI
+	policy DeadLetterPolicy
+	source string
+
+	mu      sync.Mutex
+	pending map[string][]pendingDeadLetter // by queue URL
+}
+
+// NewDeadLetterBatcher creates a batcher that labels its metrics with source
+func NewDeadLetterBatcher(client SQSBatchSendAPI, policy DeadLetterPolicy, source string) *DeadLetterBatcher {
+	return &DeadLetterBatcher{
+		client:  client,
+		policy:  policy,
+		source:  source,
+		pending: make(map[string][]pendingDeadLetter),
+	}
+}
+
+// Add queues the event, sending its queue's batch once it has ten events or
+// the event would take it over the size limit. The error reports the failures
+// of that batch, if one was sent.
+func (b *DeadLetterBatcher) Add(ctx context.Context, dlqEvent *events.DeadLetterEvent) error {
+	messageBody, err := json.Marshal(dlqEvent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal DLQ event: %w", err)
+	}
+
+	attributes := deadLetterAttributes(dlqEvent)
+	entry := pendingDeadLetter{
+		event:      dlqEvent,
+		body:       string(messageBody),
+		attributes: attributes,
+		size:       messageSize(string(messageBody), attributes),
+		permanent:  b.policy.Permanent(dlqEvent.FailureCount),
+	}
+
+	queueURL := b.policy.QueueURLFor(dlqEvent.ErrorType, dlqEvent.FailureCount)
+	b.mu.Lock()
+	queued := b.pending[queueURL]
+	size := entry.size
+	for _, pending := range queued {
+		size += pending.size
+	}
+	// Send what's queued first when this event won't fit alongside it
+	var batch []pendingDeadLetter
+	if len(queued) > 0 && size > maxSQSBatchBytes {
+		batch, queued = queued, nil
+	}
+	queued = append(queued, entry)
+	if batch == nil && len(queued) >= maxSQSBatchSize {
+		batch, queued = queued, nil
+	}
+	if len(queued) > 0 {
+		b.pending[queueURL] = queued
+	} else {
+		delete(b.pending, queueURL)
+	}
+	b.mu.Unlock()
+
+	if batch == nil {
+		return nil
+	}
+	failures := b.sendBatch(ctx, queueURL, batch)
+	if len(failures) > 0 {
+		return &DeadLetterBatchError{Failures: failures, Total: len(batch)}
+	}
+	return nil
+}
+
+// Pending returns the number of events waiting to be sent
+func (b *DeadLetterBatcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _, batch := range b.pending {
+		n += len(batch)
+	}
+	return n
+}
+
+// Flush sends every queued event. When some aren't sent, the error is a
+// *DeadLetterBatchError listing them; they aren't queued again.
+func (b *DeadLetterBatcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[string][]pendingDeadLetter)
+	b.mu.Unlock()
+
+	var failures []DeadLetterFailure
+	total := 0
+	for queueURL, queued := range pending {
+		total += len(queued)
+		for _, batch := range splitBatches(queued) {
+			failures = append(failures, b.sendBatch(ctx, queueURL, batch)...)
+		}
+	}
+	if len(failures) > 0 {
+		return &DeadLetterBatchError{Failures: failures, Total: total}
+	}
+	return nil
+}
+
+// FlushAndLog sends every queued event like Flush, logging each one that
+// wasn't sent
+func (b *DeadLetterBatcher) FlushAndLog(ctx context.Context, logger *zap.Logger) error {
+	err := b.Flush(ctx)
+	var batchErr *DeadLetterBatchError
+	if !errors.As(err, &batchErr) {
+		return err
+	}
+	for _, failure := range batchErr.Failures {
+		logger.Error("failed to send to DLQ",
+			zap.Error(failure.Err),
+			ErrorField(failure.Err),
+			zap.String("error_type", failure.Event.ErrorType),
+			zap.String("error_message", failure.Event.ErrorMessage),
+			zap.String("event_source_arn", failure.Event.EventSourceARN),
+		)
+	}
+	return err
+}
+
+// sendBatch sends a batch within the SendMessageBatch limits to queueURL in
+// one call and returns the events that weren't sent
+func (b *DeadLetterBatcher) sendBatch(ctx context.Context, queueURL string, batch []pendingDeadLetter) []DeadLetterFailure {
+	// Entry IDs are indices into batch
+	entries := make([]types.SendMessageBatchRequestEntry, len(batch))
+	for i, pending := range batch {
+		entries[i] = types.SendMessageBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			MessageBody:       aws.String(pending.body),
+			MessageAttributes: pending.attributes,
+		}
+	}
+
+	start := time.Now()
+	output, err := b.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(queueURL),
+		Entries:  entries,
+	})
+	observeSince(ServiceSQS, "SendMessageBatch", start,
+		zap.String("queue_url", queueURL),
+		zap.Int("entries", len(entries)))
+
+	var failures []DeadLetterFailure
+	if err != nil {
+		err = fmt.Errorf("failed to send message batch to DLQ: %w", err)
+		for _, pending := range batch {
+			failures = append(failures, DeadLetterFailure{Event: pending.event, Err: err})
+		}
+		return failures
+	}
+
+	failed := make(map[int]bool, len(output.Failed))
+	for _, entry := range output.Failed {
+		i, convErr := strconv.Atoi(aws.ToString(entry.Id))
+		if convErr != nil || i < 0 || i >= len(batch) {
+			continue
+		}
+		failed[i] = true
+		failures = append(failures, DeadLetterFailure{
+			Event:   batch[i].event,
+			Code:    aws.ToString(entry.Code),
+			Message: aws.ToString(entry.Message),
+			Err:     fmt.Errorf("failed to send message to DLQ: %s: %s", aws.ToString(entry.Code), aws.ToString(entry.Message)),
+		})
+	}
+	for i, pending := range batch {
+		if !failed[i] {
+			recordDeadLetter(b.source, pending.permanent, pending.event.ErrorType)
+		}
+	}
+	return failures
+}
@@ -0,0 +1,118 @@
+package awsutils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	lambdaevents "github.com/aws/aws-lambda-go/events"
+	"github.com/wgu/go-performance-enablement/pkg/batch"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
+)
+
+// ParseDeadLetterMessage reads the DLQ event carried by an SQS message. A body
+// without a failure count takes it from the FailureCount attribute.
+func ParseDeadLetterMessage(message lambdaevents.SQSMessage) (*events.DeadLetterEvent, error) {
+	var dlqEvent events.DeadLetterEvent
+	if err := json.Unmarshal([]byte(message.Body), &dlqEvent); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DLQ message %s: %w", message.MessageId, err)
+	}
+
+	if dlqEvent.FailureCount == 0 {
+		if attr, ok := message.MessageAttributes["FailureCount"]; ok && attr.StringValue != nil {
+			count, err := strconv.Atoi(*attr.StringValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid FailureCount attribute %q on DLQ message %s", *attr.StringValue, message.MessageId)
+			}
+			dlqEvent.FailureCount = count
+		}
+	}
+	return &dlqEvent, nil
+}
+
+// DeadLetterReplayer runs dead-lettered events through processing again as
+// their DLQ messages are delivered to a Lambda. An event that fails again is
+// routed with the new failure added to its count, so it reaches the policy's
+// MaxFailures and is parked instead of cycling.
+type DeadLetterReplayer struct {
+	router *DeadLetterRouter
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewDeadLetterReplayer creates a replayer routing repeat failures through router
+func NewDeadLetterReplayer(router *DeadLetterRouter, logger *zap.Logger) *DeadLetterReplayer {
+	return &DeadLetterReplayer{
+		router: router,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// Replay calls process with the DLQ event of each message. A message is done
+// once its event succeeds or is routed again; messages that can't be parsed
+// or routed are reported as batch item failures so SQS redelivers them.
+func (r *DeadLetterReplayer) Replay(ctx context.Context, event lambdaevents.SQSEvent, process func(context.Context, *events.DeadLetterEvent) error) lambdaevents.SQSEventResponse {
+	var response lambdaevents.SQSEventResponse
+	for _, message := range event.Records {
+		if err := r.replay(ctx, message, process); err != nil {
+			r.logger.Error("failed to replay DLQ message",
+				zap.Error(err),
+				ErrorField(err),
+				zap.String("message_id", message.MessageId),
+			)
+			response.BatchItemFailures = append(response.BatchItemFailures, lambdaevents.SQSBatchItemFailure{
+				ItemIdentifier: message.MessageId,
+			})
+		}
+	}
+	return response
+}
+
+func (r *DeadLetterReplayer) replay(ctx context.Context, message lambdaevents.SQSMessage, process func(context.Context, *events.DeadLetterEvent) error) error {
+	dlqEvent, err := ParseDeadLetterMessage(message)
+	if err != nil {
+		return err
+	}
+
+	processErr := processSafely(ctx, dlqEvent, process)
+	if processErr == nil {
+		r.logger.Info("replayed dead-lettered event",
+			zap.String("message_id", message.MessageId),
+			zap.Int("failure_count", dlqEvent.FailureCount),
+		)
+		return nil
+	}
+
+	// The error type stays, since it tells how OriginalEvent was encoded
+	dlqEvent.RecordFailure(processErr, r.now())
+	AnnotateDeadLetterEvent(dlqEvent, processErr)
+	var panicErr *batch.PanicError
+	if errors.As(processErr, &panicErr) {
+		dlqEvent.StackTrace = string(panicErr.Stack)
+	}
+
+	r.logger.Warn("dead-lettered event failed again",
+		zap.Error(processErr),
+		zap.String("message_id", message.MessageId),
+		zap.Int("failure_count", dlqEvent.FailureCount),
+		zap.Bool("permanent", r.router.policy.Permanent(dlqEvent.FailureCount)),
+	)
+	return r.router.Send(ctx, dlqEvent)
+}
+
+// processSafely runs process, recovering a panic into a *batch.PanicError so
+// it counts as another failure of the event
+func processSafely(ctx context.Context, dlqEvent *events.DeadLetterEvent, process func(context.Context, *events.DeadLetterEvent) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &batch.PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return process(ctx, dlqEvent)
+}
@@ -0,0 +1,151 @@
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// defaultDedupTTL is how long a published idempotency key blocks republishing
+const defaultDedupTTL = 24 * time.Hour
+
+// defaultDedupLease is how long a claim blocks other publishers before the
+// event is published. A publisher that crashes holding it only delays the
+// event by this long.
+const defaultDedupLease = time.Minute
+
+// Claim states stored under "status"
+const (
+	dedupInProgress = "in_progress"
+	dedupPublished  = "published"
+)
+
+// ErrDedupInProgress is returned by Claim when another publisher holds an
+// unexpired claim on the key. The caller should retry later.
+var ErrDedupInProgress = errors.New("idempotency key is being published")
+
+// DedupAPI is the part of the DynamoDB client used by DedupStore
+type DedupAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DedupStore records idempotency keys in a DynamoDB table keyed by
+// "idempotency_key", with a "status" and an "expires_at" TTL attribute. A key
+// is claimed "in_progress" under a short lease, then marked "published" for
+// the TTL once its event is out.
+type DedupStore struct {
+	client    DedupAPI
+	tableName string
+	ttl       time.Duration
+	lease     time.Duration
+	now       func() time.Time
+}
+
+// NewDedupStore creates a store whose published keys last ttl, or a day if
+// ttl is zero
+func NewDedupStore(client DedupAPI, tableName string, ttl time.Duration) *DedupStore {
+	if ttl <= 0 {
+		ttl = defaultDedupTTL
+	}
+	return &DedupStore{
+		client:    client,
+		tableName: tableName,
+		ttl:       ttl,
+		lease:     defaultDedupLease,
+		now:       time.Now,
+	}
+}
+
+// Claim leases key for publishing. It reports false if the key was already
+// published, and returns ErrDedupInProgress if another publisher's lease on it
+// hasn't expired. Entries past their expiry count as free, since DynamoDB
+// deletes expired items lazily.
+func (s *DedupStore) Claim(ctx context.Context, key string) (bool, error) {
+	now := s.now()
+	start := time.Now()
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+			"status":          &types.AttributeValueMemberS{Value: dedupInProgress},
+			"expires_at":      expiresAt(now.Add(s.lease)),
+		},
+		ConditionExpression: aws.String("attribute_not_exists(idempotency_key) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": expiresAt(now),
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	observeSince(ServiceDynamoDB, "PutItem", start, zap.String("table", s.tableName))
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		if status, ok := conditionFailed.Item["status"].(*types.AttributeValueMemberS); ok && status.Value == dedupInProgress {
+			return false, fmt.Errorf("%w: %s", ErrDedupInProgress, key)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// MarkPublished records that the event claimed under key was published, so
+// the key is skipped until the TTL expires
+func (s *DedupStore) MarkPublished(ctx context.Context, key string) error {
+	start := time.Now()
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+			"status":          &types.AttributeValueMemberS{Value: dedupPublished},
+			"expires_at":      expiresAt(s.now().Add(s.ttl)),
+		},
+	})
+	observeSince(ServiceDynamoDB, "PutItem", start, zap.String("table", s.tableName))
+
+	if err != nil {
+		return fmt.Errorf("failed to mark idempotency key %s published: %w", key, err)
+	}
+	return nil
+}
+
+// Release removes an in-progress claim on key, so a publish that failed after
+// claiming it can be retried. A key already marked published is kept.
+func (s *DedupStore) Release(ctx context.Context, key string) error {
+	start := time.Now()
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+		ConditionExpression:      aws.String("#status = :in_progress"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":in_progress": &types.AttributeValueMemberS{Value: dedupInProgress},
+		},
+	})
+	observeSince(ServiceDynamoDB, "DeleteItem", start, zap.String("table", s.tableName))
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key %s: %w", key, err)
+	}
+	return nil
+}
+
+func expiresAt(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
@@ -0,0 +1,163 @@
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// SQSReceiveAPI is the part of the SQS client used to peek at queued messages
+type SQSReceiveAPI interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+}
+
+// SQSPeekAPI is the part of the SQS client used to sample queued messages
+// and make them visible again
+type SQSPeekAPI interface {
+	SQSReceiveAPI
+	ChangeMessageVisibilityBatch(ctx context.Context, params *sqs.ChangeMessageVisibilityBatchInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error)
+}
+
+// dlqPeekVisibility hides sampled messages only briefly, in case making them
+// visible again fails. SQS omits a zero visibility timeout from the request,
+// falling back to the queue's default.
+const dlqPeekVisibility = 5 * time.Second
+
+// DLQAgeMonitor escalates when a dead-letter queue's oldest message has
+// waited longer than maxAge
+type DLQAgeMonitor struct {
+	client    SQSPeekAPI
+	publisher EventSink
+	queueURL  string
+	maxAge    time.Duration
+	now       func() time.Time
+}
+
+// NewDLQAgeMonitor creates a monitor for queueURL that publishes escalations
+// to publisher
+func NewDLQAgeMonitor(client SQSPeekAPI, publisher EventSink, queueURL string, maxAge time.Duration) *DLQAgeMonitor {
+	return &DLQAgeMonitor{
+		client:    client,
+		publisher: publisher,
+		queueURL:  queueURL,
+		maxAge:    maxAge,
+		now:       time.Now,
+	}
+}
+
+// Check peeks at the queue and, if the oldest message seen was sent more than
+// maxAge ago, publishes and returns an escalation. It returns nil when the
+// queue is empty or its messages are recent.
+//
+// SQS returns a sample of up to ten messages, so on a large queue the oldest
+// message seen may not be the oldest queued. Sampled messages are made
+// visible again right away, but each sample still counts as a receive, so a
+// redrive policy on the DLQ must allow for the monitor's schedule.
+func (m *DLQAgeMonitor) Check(ctx context.Context) (*events.DLQEscalation, error) {
+	start := time.Now()
+	output, err := m.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:                    aws.String(m.queueURL),
+		MaxNumberOfMessages:         10,
+		VisibilityTimeout:           int32(dlqPeekVisibility / time.Second),
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameSentTimestamp},
+	})
+	observeSince(ServiceSQS, "ReceiveMessage", start, zap.String("queue_url", m.queueURL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive from DLQ: %w", err)
+	}
+	if err := m.release(ctx, output.Messages); err != nil {
+		return nil, err
+	}
+
+	queue := path.Base(m.queueURL)
+	oldest, sentAt, ok := oldestMessage(output.Messages)
+	if !ok {
+		metrics.DLQOldestMessageAge.WithLabelValues(queue).Set(0)
+		return nil, nil
+	}
+
+	now := m.now()
+	age := now.Sub(sentAt)
+	metrics.DLQOldestMessageAge.WithLabelValues(queue).Set(age.Seconds())
+	if age <= m.maxAge {
+		return nil, nil
+	}
+
+	escalation := &events.DLQEscalation{
+		QueueURL:        m.queueURL,
+		Severity:        events.SeverityHigh,
+		OldestMessageID: aws.ToString(oldest.MessageId),
+		OldestSentAt:    sentAt,
+		AgeSeconds:      int64(age / time.Second),
+		MaxAgeSeconds:   int64(m.maxAge / time.Second),
+		DetectedAt:      now,
+	}
+	metrics.DLQEscalations.WithLabelValues(queue).Inc()
+
+	if err := m.publisher.Publish(ctx, events.EventTypeDLQEscalation, escalation); err != nil {
+		return escalation, fmt.Errorf("failed to publish DLQ escalation: %w", err)
+	}
+	return escalation, nil
+}
+
+// release makes sampled messages visible to other consumers again
+func (m *DLQAgeMonitor) release(ctx context.Context, messages []types.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// Unlike ReceiveMessage's, an entry's zero timeout is always sent
+	entries := make([]types.ChangeMessageVisibilityBatchRequestEntry, len(messages))
+	for i, message := range messages {
+		entries[i] = types.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			ReceiptHandle:     message.ReceiptHandle,
+			VisibilityTimeout: 0,
+		}
+	}
+
+	start := time.Now()
+	output, err := m.client.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: aws.String(m.queueURL),
+		Entries:  entries,
+	})
+	observeSince(ServiceSQS, "ChangeMessageVisibilityBatch", start, zap.String("queue_url", m.queueURL))
+	if err != nil {
+		return fmt.Errorf("failed to release sampled DLQ messages: %w", err)
+	}
+	if len(output.Failed) > 0 {
+		failed := output.Failed[0]
+		return fmt.Errorf("failed to release %d sampled DLQ messages: %s: %s", len(output.Failed), aws.ToString(failed.Code), aws.ToString(failed.Message))
+	}
+	return nil
+}
+
+// oldestMessage returns the message with the earliest SentTimestamp, skipping
+// messages without a valid one
+func oldestMessage(messages []types.Message) (types.Message, time.Time, bool) {
+	var (
+		oldest types.Message
+		sentAt time.Time
+		found  bool
+	)
+	for _, message := range messages {
+		millis, err := strconv.ParseInt(message.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64)
+		if err != nil {
+			continue
+		}
+		sent := time.UnixMilli(millis)
+		if !found || sent.Before(sentAt) {
+			oldest, sentAt, found = message, sent, true
+		}
+	}
+	return oldest, sentAt, found
+}
@@ -2,26 +2,106 @@ package awsutils
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
 )
 
+// ErrItemNotFound is returned by GetItem when no item has the key
+var ErrItemNotFound = errors.New("item not found")
+
+// ErrConsistentIndexQuery is returned by QueryIndex on a helper reading
+// consistently, since global secondary indexes only support eventually
+// consistent reads
+var ErrConsistentIndexQuery = errors.New("consistent reads are not supported on global secondary indexes")
+
+// DynamoDBAPI is the part of the DynamoDB client used by DynamoDBHelper
+type DynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
 // DynamoDBHelper provides helper methods for DynamoDB operations
 type DynamoDBHelper struct {
-	client    *dynamodb.Client
-	tableName string
+	client         DynamoDBAPI
+	tableName      string
+	region         string
+	consistentRead bool
+	writeLimiter   *RateLimiter
 }
 
 // NewDynamoDBHelper creates a new DynamoDB helper
-func NewDynamoDBHelper(client *dynamodb.Client, tableName string) *DynamoDBHelper {
-	return &DynamoDBHelper{
+func NewDynamoDBHelper(client DynamoDBAPI, tableName string) *DynamoDBHelper {
+	helper := &DynamoDBHelper{
 		client:    client,
 		tableName: tableName,
 	}
+	// Label error metrics with the client's region when it has one
+	if c, ok := client.(interface{ Options() dynamodb.Options }); ok {
+		helper.region = c.Options().Region
+	}
+	return helper
+}
+
+// SetConsistentRead makes GetItem and Query read strongly consistently, for
+// callers that must not act on a stale copy of an item. Reads are eventually
+// consistent by default, which costs half as much and is faster.
+func (h *DynamoDBHelper) SetConsistentRead(consistent bool) {
+	h.consistentRead = consistent
+}
+
+// SetWriteLimiter paces the helper's writes through limiter, keeping them
+// under the table's write capacity instead of throttling. A batch write
+// takes one operation per item. A nil limiter, the default, doesn't limit.
+func (h *DynamoDBHelper) SetWriteLimiter(limiter *RateLimiter) {
+	h.writeLimiter = limiter
+}
+
+// WriteLimiter returns the limiter pacing writes, or nil if they aren't limited
+func (h *DynamoDBHelper) WriteLimiter() *RateLimiter {
+	return h.writeLimiter
+}
+
+// waitToWrite waits until the write limiter allows n item writes
+func (h *DynamoDBHelper) waitToWrite(ctx context.Context, n int) error {
+	if err := h.writeLimiter.WaitN(ctx, n); err != nil {
+		return fmt.Errorf("failed waiting for write capacity: %w", err)
+	}
+	return nil
+}
+
+// consistentReadInput returns the ConsistentRead input field, leaving it unset
+// for the default eventually consistent read
+func (h *DynamoDBHelper) consistentReadInput() *bool {
+	if !h.consistentRead {
+		return nil
+	}
+	return aws.Bool(true)
+}
+
+// observe records a call to the helper's table started at start
+func (h *DynamoDBHelper) observe(operation string, start time.Time) {
+	observeSince(ServiceDynamoDB, operation, start, zap.String("table", h.tableName))
+}
+
+// recordError counts a failed call to the helper's table by error category
+func (h *DynamoDBHelper) recordError(operation string, err error) {
+	metrics.DynamoDBErrors.WithLabelValues(h.tableName, operation, h.region, ClassifyDynamoDBError(err)).Inc()
 }
 
 // PutItem stores an item in DynamoDB
@@ -30,13 +110,19 @@ func (h *DynamoDBHelper) PutItem(ctx context.Context, item interface{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal item: %w", err)
 	}
+	if err := h.waitToWrite(ctx, 1); err != nil {
+		return err
+	}
 
+	start := time.Now()
 	_, err = h.client.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(h.tableName),
 		Item:      av,
 	})
+	h.observe("PutItem", start)
 
 	if err != nil {
+		h.recordError("PutItem", err)
 		return fmt.Errorf("failed to put item: %w", err)
 	}
 
@@ -45,17 +131,21 @@ func (h *DynamoDBHelper) PutItem(ctx context.Context, item interface{}) error {
 
 // GetItem retrieves an item from DynamoDB
 func (h *DynamoDBHelper) GetItem(ctx context.Context, key map[string]types.AttributeValue, result interface{}) error {
+	start := time.Now()
 	output, err := h.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(h.tableName),
-		Key:       key,
+		TableName:      aws.String(h.tableName),
+		Key:            key,
+		ConsistentRead: h.consistentReadInput(),
 	})
+	h.observe("GetItem", start)
 
 	if err != nil {
+		h.recordError("GetItem", err)
 		return fmt.Errorf("failed to get item: %w", err)
 	}
 
 	if output.Item == nil {
-		return fmt.Errorf("item not found")
+		return ErrItemNotFound
 	}
 
 	err = attributevalue.UnmarshalMap(output.Item, result)
@@ -68,34 +158,230 @@ func (h *DynamoDBHelper) GetItem(ctx context.Context, key map[string]types.Attri
 
 // UpdateItem updates an item in DynamoDB
 func (h *DynamoDBHelper) UpdateItem(ctx context.Context, key map[string]types.AttributeValue, updateExpression string, expressionValues map[string]types.AttributeValue) error {
+	if err := h.waitToWrite(ctx, 1); err != nil {
+		return err
+	}
+
+	start := time.Now()
 	_, err := h.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName:                 aws.String(h.tableName),
 		Key:                       key,
 		UpdateExpression:          aws.String(updateExpression),
 		ExpressionAttributeValues: expressionValues,
 	})
+	h.observe("UpdateItem", start)
+
+	if err != nil {
+		h.recordError("UpdateItem", err)
+		return fmt.Errorf("failed to update item: %w", err)
+	}
+
+	return nil
+}
+
+// DiffUpdate is an UpdateItem expression that applies only the attributes
+// that changed between two item images
+type DiffUpdate struct {
+	Expression string
+	Names      map[string]string
+	Values     map[string]types.AttributeValue
+}
+
+// BuildDiffUpdate compares before and after images and returns an update that
+// SETs attributes that were added or changed and REMOVEs attributes that were
+// dropped. Key attributes are never modified. It returns nil when nothing
+// changed.
+func BuildDiffUpdate(before, after map[string]interface{}, keyNames ...string) (*DiffUpdate, error) {
+	keys := make(map[string]bool, len(keyNames))
+	for _, name := range keyNames {
+		keys[name] = true
+	}
+
+	var set, remove []string
+	for name, value := range after {
+		if keys[name] {
+			continue
+		}
+		if old, ok := before[name]; !ok || !reflect.DeepEqual(old, value) {
+			set = append(set, name)
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok && !keys[name] {
+			remove = append(remove, name)
+		}
+	}
+	if len(set) == 0 && len(remove) == 0 {
+		return nil, nil
+	}
+
+	// Sorted attributes keep the expression stable for the same change
+	sort.Strings(set)
+	sort.Strings(remove)
+
+	update := &DiffUpdate{
+		Names:  make(map[string]string, len(set)+len(remove)),
+		Values: make(map[string]types.AttributeValue, len(set)),
+	}
+
+	var clauses []string
+	if len(set) > 0 {
+		assignments := make([]string, len(set))
+		for i, name := range set {
+			value, err := attributevalue.Marshal(after[name])
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal attribute %s: %w", name, err)
+			}
+			placeholder := fmt.Sprintf("#a%d", len(update.Names))
+			update.Names[placeholder] = name
+			update.Values[fmt.Sprintf(":v%d", i)] = value
+			assignments[i] = fmt.Sprintf("%s = :v%d", placeholder, i)
+		}
+		clauses = append(clauses, "SET "+strings.Join(assignments, ", "))
+	}
+	if len(remove) > 0 {
+		placeholders := make([]string, len(remove))
+		for i, name := range remove {
+			placeholder := fmt.Sprintf("#a%d", len(update.Names))
+			update.Names[placeholder] = name
+			placeholders[i] = placeholder
+		}
+		clauses = append(clauses, "REMOVE "+strings.Join(placeholders, ", "))
+	}
+	update.Expression = strings.Join(clauses, " ")
+
+	// UpdateItem rejects an empty value map
+	if len(update.Values) == 0 {
+		update.Values = nil
+	}
+	return update, nil
+}
+
+// ApplyDiffUpdate applies a DiffUpdate to the item identified by key
+func (h *DynamoDBHelper) ApplyDiffUpdate(ctx context.Context, key map[string]types.AttributeValue, update *DiffUpdate) error {
+	if err := h.waitToWrite(ctx, 1); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	_, err := h.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(h.tableName),
+		Key:                       key,
+		UpdateExpression:          aws.String(update.Expression),
+		ExpressionAttributeNames:  update.Names,
+		ExpressionAttributeValues: update.Values,
+	})
+	h.observe("UpdateItem", start)
 
 	if err != nil {
+		h.recordError("UpdateItem", err)
 		return fmt.Errorf("failed to update item: %w", err)
 	}
 
 	return nil
 }
 
+// ApplyDiffUpdateIfExists applies a DiffUpdate to the item identified by key
+// only if the item exists, reporting whether it was applied. Unconditionally,
+// UpdateItem would create a missing item holding just the changed attributes.
+func (h *DynamoDBHelper) ApplyDiffUpdateIfExists(ctx context.Context, key map[string]types.AttributeValue, update *DiffUpdate) (bool, error) {
+	// A key attribute exists exactly when the item does
+	var keyName string
+	for name := range key {
+		if keyName == "" || name < keyName {
+			keyName = name
+		}
+	}
+	names := make(map[string]string, len(update.Names)+1)
+	for placeholder, name := range update.Names {
+		names[placeholder] = name
+	}
+	names["#key"] = keyName
+
+	if err := h.waitToWrite(ctx, 1); err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	_, err := h.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(h.tableName),
+		Key:                       key,
+		UpdateExpression:          aws.String(update.Expression),
+		ConditionExpression:       aws.String("attribute_exists(#key)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: update.Values,
+	})
+	h.observe("UpdateItem", start)
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		h.recordError("UpdateItem", err)
+		return false, fmt.Errorf("failed to update item: %w", err)
+	}
+
+	return true, nil
+}
+
 // DeleteItem deletes an item from DynamoDB
 func (h *DynamoDBHelper) DeleteItem(ctx context.Context, key map[string]types.AttributeValue) error {
+	if err := h.waitToWrite(ctx, 1); err != nil {
+		return err
+	}
+
+	start := time.Now()
 	_, err := h.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
 		TableName: aws.String(h.tableName),
 		Key:       key,
 	})
+	h.observe("DeleteItem", start)
 
 	if err != nil {
+		h.recordError("DeleteItem", err)
 		return fmt.Errorf("failed to delete item: %w", err)
 	}
 
 	return nil
 }
 
+// DeleteItemIfNotNewer deletes the item identified by key unless its
+// versionAttribute is newer than version, reporting whether the delete was
+// applied. Items without the attribute are deleted.
+func (h *DynamoDBHelper) DeleteItemIfNotNewer(ctx context.Context, key map[string]types.AttributeValue, versionAttribute string, version interface{}) (bool, error) {
+	versionValue, err := attributevalue.Marshal(version)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal version: %w", err)
+	}
+	if err := h.waitToWrite(ctx, 1); err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	_, err = h.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws.String(h.tableName),
+		Key:                      key,
+		ConditionExpression:      aws.String("attribute_not_exists(#version) OR #version <= :version"),
+		ExpressionAttributeNames: map[string]string{"#version": versionAttribute},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":version": versionValue,
+		},
+	})
+	h.observe("DeleteItem", start)
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		h.recordError("DeleteItem", err)
+		return false, fmt.Errorf("failed to delete item: %w", err)
+	}
+
+	return true, nil
+}
+
 // BatchWriteItems writes multiple items in a batch (up to 25 items)
 func (h *DynamoDBHelper) BatchWriteItems(ctx context.Context, items []interface{}) error {
 	const maxBatchSize = 25
@@ -122,13 +408,20 @@ func (h *DynamoDBHelper) BatchWriteItems(ctx context.Context, items []interface{
 			}
 		}
 
+		if err := h.waitToWrite(ctx, len(batch)); err != nil {
+			return err
+		}
+
+		start := time.Now()
 		_, err := h.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
 			RequestItems: map[string][]types.WriteRequest{
 				h.tableName: writeRequests,
 			},
 		})
+		h.observe("BatchWriteItem", start)
 
 		if err != nil {
+			h.recordError("BatchWriteItem", err)
 			return fmt.Errorf("failed to batch write items: %w", err)
 		}
 	}
@@ -136,22 +429,124 @@ func (h *DynamoDBHelper) BatchWriteItems(ctx context.Context, items []interface{
 	return nil
 }
 
-// Query executes a query operation
+// Query executes a query operation on the table's primary key, reading
+// every page of results
 func (h *DynamoDBHelper) Query(ctx context.Context, keyCondition string, expressionValues map[string]types.AttributeValue, results interface{}) error {
-	output, err := h.client.Query(ctx, &dynamodb.QueryInput{
+	return h.query(ctx, &dynamodb.QueryInput{
 		TableName:                 aws.String(h.tableName),
 		KeyConditionExpression:    aws.String(keyCondition),
 		ExpressionAttributeValues: expressionValues,
-	})
+		ConsistentRead:            h.consistentReadInput(),
+	}, results)
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to query: %w", err)
+// QueryIndex executes a query operation on a global secondary index, reading
+// every page of results. It fails with ErrConsistentIndexQuery if the helper
+// reads consistently.
+func (h *DynamoDBHelper) QueryIndex(ctx context.Context, indexName, keyCondition string, expressionValues map[string]types.AttributeValue, results interface{}) error {
+	if indexName == "" {
+		return fmt.Errorf("index name is required")
 	}
+	if h.consistentRead {
+		return fmt.Errorf("failed to query %s: %w", indexName, ErrConsistentIndexQuery)
+	}
+	return h.query(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(h.tableName),
+		IndexName:                 aws.String(indexName),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeValues: expressionValues,
+	}, results)
+}
+
+// query runs input page by page until DynamoDB returns no LastEvaluatedKey,
+// then unmarshals the items from every page into results
+func (h *DynamoDBHelper) query(ctx context.Context, input *dynamodb.QueryInput, results interface{}) error {
+	var items []map[string]types.AttributeValue
+	for {
+		start := time.Now()
+		output, err := h.client.Query(ctx, input)
+		h.observe("Query", start)
+
+		if err != nil {
+			h.recordError("Query", err)
+			return fmt.Errorf("failed to query: %w", err)
+		}
+		items = append(items, output.Items...)
 
-	err = attributevalue.UnmarshalListOfMaps(output.Items, results)
+		if len(output.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+
+	err := attributevalue.UnmarshalListOfMaps(items, results)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal results: %w", err)
 	}
 
 	return nil
 }
+
+// MarshalToAttributeValues converts a plain Go map into DynamoDB attribute values,
+// preserving nested maps, lists, numbers and booleans
+func MarshalToAttributeValues(item map[string]interface{}) (map[string]types.AttributeValue, error) {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal attribute values: %w", err)
+	}
+	return av, nil
+}
+
+// UnmarshalFromAttributeValues converts DynamoDB attribute values into a plain Go map.
+// Numbers are decoded as float64, sets as slices.
+func UnmarshalFromAttributeValues(av map[string]types.AttributeValue) (map[string]interface{}, error) {
+	item := make(map[string]interface{}, len(av))
+	if err := attributevalue.UnmarshalMap(av, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal attribute values: %w", err)
+	}
+	return item, nil
+}
+
+// SetTTL sets attributeName on item to expire ttl from now. DynamoDB TTL only
+// honours a Number attribute holding Unix epoch seconds; a String value or
+// milliseconds is silently never expired.
+func SetTTL(item map[string]types.AttributeValue, attributeName string, ttl time.Duration) {
+	SetTTLAt(item, attributeName, time.Now().Add(ttl))
+}
+
+// SetTTLAt sets attributeName on item to expire at expiresAt
+func SetTTLAt(item map[string]types.AttributeValue, attributeName string, expiresAt time.Time) {
+	item[attributeName] = &types.AttributeValueMemberN{
+		Value: strconv.FormatInt(expiresAt.Unix(), 10),
+	}
+}
+
+// GetTTL reads and validates the TTL attribute on item
+func GetTTL(item map[string]types.AttributeValue, attributeName string) (time.Time, error) {
+	av, ok := item[attributeName]
+	if !ok {
+		return time.Time{}, fmt.Errorf("TTL attribute %s not found", attributeName)
+	}
+
+	n, ok := av.(*types.AttributeValueMemberN)
+	if !ok {
+		return time.Time{}, fmt.Errorf("TTL attribute %s must be a Number, got %T", attributeName, av)
+	}
+
+	seconds, err := strconv.ParseInt(n.Value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("TTL attribute %s is not integer epoch seconds: %w", attributeName, err)
+	}
+
+	return time.Unix(seconds, 0), nil
+}
+
+// TTLExpired reports whether the TTL on item is past due. DynamoDB deletes
+// expired items lazily, so reads can still return them for some time.
+func TTLExpired(item map[string]types.AttributeValue, attributeName string) (bool, error) {
+	expiresAt, err := GetTTL(item, attributeName)
+	if err != nil {
+		return false, err
+	}
+	return !time.Now().Before(expiresAt), nil
+}
@@ -0,0 +1,113 @@
+package awsutils
+
+import (
+	"errors"
+
+	"github.com/aws/smithy-go"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ErrorDetails identifies an AWS service error for correlation with AWS
+// support. Fields are empty when the error does not carry them.
+type ErrorDetails struct {
+	Code      string
+	RequestID string
+}
+
+// requestIDError is implemented by SDK response errors that carry the
+// service request ID
+type requestIDError interface {
+	ServiceRequestID() string
+}
+
+// ExtractErrorDetails returns the AWS error code and request ID found
+// anywhere in err's chain, so they survive fmt.Errorf("%w") wrapping
+func ExtractErrorDetails(err error) ErrorDetails {
+	var details ErrorDetails
+	if err == nil {
+		return details
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		details.Code = apiErr.ErrorCode()
+	}
+
+	var reqErr requestIDError
+	if errors.As(err, &reqErr) {
+		details.RequestID = reqErr.ServiceRequestID()
+	}
+
+	return details
+}
+
+// IsZero reports whether no AWS details were found
+func (d ErrorDetails) IsZero() bool {
+	return d.Code == "" && d.RequestID == ""
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (d ErrorDetails) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if d.Code != "" {
+		enc.AddString("aws_error_code", d.Code)
+	}
+	if d.RequestID != "" {
+		enc.AddString("aws_request_id", d.RequestID)
+	}
+	return nil
+}
+
+// ErrorField returns a log field carrying the AWS error code and request ID
+// of err, or a no-op field when err is not an AWS error. Use it alongside
+// zap.Error.
+func ErrorField(err error) zap.Field {
+	details := ExtractErrorDetails(err)
+	if details.IsZero() {
+		return zap.Skip()
+	}
+	return zap.Inline(details)
+}
+
+// AnnotateDeadLetterEvent records the AWS error code and request ID of the
+// processing error on a DLQ event
+func AnnotateDeadLetterEvent(dlqEvent *events.DeadLetterEvent, processingError error) {
+	details := ExtractErrorDetails(processingError)
+	dlqEvent.AWSErrorCode = details.Code
+	dlqEvent.AWSRequestID = details.RequestID
+}
+
+// DynamoDB error categories, the error_type label of DynamoDBErrors
+const (
+	DynamoDBErrorConditionalCheckFailed        = "ConditionalCheckFailed"
+	DynamoDBErrorThrottling                    = "ThrottlingException"
+	DynamoDBErrorResourceNotFound              = "ResourceNotFound"
+	DynamoDBErrorProvisionedThroughputExceeded = "ProvisionedThroughputExceeded"
+	DynamoDBErrorValidation                    = "ValidationException"
+	DynamoDBErrorUnknown                       = "unknown"
+)
+
+// dynamoDBErrorCategories maps DynamoDB API error codes to their categories
+var dynamoDBErrorCategories = map[string]string{
+	"ConditionalCheckFailedException":        DynamoDBErrorConditionalCheckFailed,
+	"ThrottlingException":                    DynamoDBErrorThrottling,
+	"RequestLimitExceeded":                   DynamoDBErrorThrottling,
+	"ResourceNotFoundException":              DynamoDBErrorResourceNotFound,
+	"ProvisionedThroughputExceededException": DynamoDBErrorProvisionedThroughputExceeded,
+	"ValidationException":                    DynamoDBErrorValidation,
+}
+
+// ClassifyDynamoDBError returns the category of a DynamoDB error found
+// anywhere in err's chain, keeping metric labels to a fixed set. Errors that
+// aren't DynamoDB API errors, or aren't in a known category, are
+// DynamoDBErrorUnknown.
+func ClassifyDynamoDBError(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if category, ok := dynamoDBErrorCategories[apiErr.ErrorCode()]; ok {
+			return category
+		}
+	}
+	return DynamoDBErrorUnknown
+}
@@ -3,62 +3,306 @@ package awsutils
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/smithy-go"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
 )
 
 const (
 	defaultTimeout = 10 * time.Second
 	maxBatchSize   = 10 // EventBridge limit
+
+	baseBackoff               = 100 * time.Millisecond
+	throttleBackoffMultiplier = 4
 )
 
+// ErrTooManyEntries is returned when a single PutEvents call would carry more
+// entries than EventBridge accepts
+var ErrTooManyEntries = errors.New("too many EventBridge entries in one call")
+
+// throttlingErrorCodes are the API and per-entry error codes EventBridge uses when throttling
+var throttlingErrorCodes = map[string]bool{
+	"ThrottlingException":      true,
+	"TooManyRequestsException": true,
+}
+
+// EventBridgeAPI is the subset of the EventBridge client used by the publisher
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
 // EventBridgePublisher handles publishing events to EventBridge
 type EventBridgePublisher struct {
-	client    *eventbridge.Client
-	eventBus  string
-	source    string
-	maxRetry  int
-	timeout   time.Duration
+	client       EventBridgeAPI
+	eventBus     string
+	endpointID   string
+	source       string
+	maxRetry     int
+	timeout      time.Duration
+	useEventTime bool
+	wrapEnvelope bool
+	dedup        *DedupStore
+	dedupKey     events.IdempotencyKeyFunc
+	sleep        func(time.Duration)
+}
+
+// eventTimer is implemented by event details that carry their own timestamp
+type eventTimer interface {
+	EventTime() time.Time
 }
 
 // NewEventBridgePublisher creates a new EventBridge publisher
-func NewEventBridgePublisher(client *eventbridge.Client, eventBus, source string) *EventBridgePublisher {
+func NewEventBridgePublisher(client EventBridgeAPI, eventBus, source string) *EventBridgePublisher {
 	return &EventBridgePublisher{
 		client:   client,
 		eventBus: eventBus,
 		source:   source,
 		maxRetry: 3,
 		timeout:  defaultTimeout,
+		dedupKey: events.ContentIdempotencyKey,
+		sleep:    time.Sleep,
+	}
+}
+
+// SetUseEventTime makes entries take their Time from the event detail's own
+// timestamp (via an EventTime method) instead of the publish time. This keeps
+// time-window rules correct for replayed and backfilled events.
+func (p *EventBridgePublisher) SetUseEventTime(enabled bool) {
+	p.useEventTime = enabled
+}
+
+// SetWrapEnvelope makes the publisher box known event types in an
+// events.Envelope so consumers can tell them apart by event_kind. Details of
+// other types are published as-is.
+func (p *EventBridgePublisher) SetWrapEnvelope(enabled bool) {
+	p.wrapEnvelope = enabled
+}
+
+// SetGlobalEndpoint makes the publisher send events through the EventBridge
+// global endpoint with ID endpointID, such as "abcde.veo", which fails over
+// to the secondary region's bus of the same name when the primary region is
+// unhealthy. The client signs those requests with SigV4a for the endpoint. An
+// empty ID publishes straight to the regional bus, the default.
+func (p *EventBridgePublisher) SetGlobalEndpoint(endpointID string) {
+	p.endpointID = endpointID
+}
+
+// endpointIDInput returns the EndpointId input field, leaving it unset when
+// publishing to the regional bus
+func (p *EventBridgePublisher) endpointIDInput() *string {
+	if p.endpointID == "" {
+		return nil
 	}
+	return aws.String(p.endpointID)
+}
+
+// SetDeduplicator makes PublishCrossRegionEvent claim each event's
+// idempotency key in store first, skipping events already published
+func (p *EventBridgePublisher) SetDeduplicator(store *DedupStore) {
+	p.dedup = store
 }
 
-// PublishEvent publishes a single event to EventBridge
+// SetIdempotencyKeyFunc sets how the deduplicator keys events. The default,
+// events.ContentIdempotencyKey, hashes the whole event; nil restores it.
+func (p *EventBridgePublisher) SetIdempotencyKeyFunc(fn events.IdempotencyKeyFunc) {
+	if fn == nil {
+		fn = events.ContentIdempotencyKey
+	}
+	p.dedupKey = fn
+}
+
+// PublishEvent publishes a single event to EventBridge. When EventBridge
+// rejects the entry, the error wraps an *EntryError with its code and message.
 func (p *EventBridgePublisher) PublishEvent(ctx context.Context, detailType string, detail interface{}) error {
-	detailJSON, err := json.Marshal(detail)
+	return p.PublishEventAt(ctx, detailType, detail, time.Time{})
+}
+
+// PublishResult is the outcome of publishing a single event: the event ID
+// EventBridge assigned on success, or the error code and message of its
+// entry when EventBridge rejected it
+type PublishResult struct {
+	EventID      string
+	ErrorCode    string
+	ErrorMessage string
+}
+
+// Failed reports whether EventBridge rejected the entry
+func (r *PublishResult) Failed() bool {
+	return r.ErrorCode != ""
+}
+
+// EntryError is a PutEvents entry EventBridge rejected
+type EntryError struct {
+	Code    string
+	Message string
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("entry failed with code %s: %s", e.Code, e.Message)
+}
+
+// PublishEventResult publishes a single event like PublishEvent and reports
+// its outcome. A rejected entry's result carries the code and message of the
+// last attempt alongside the error. Failures before EventBridge answers for
+// the entry, such as marshaling or API errors, leave the result empty.
+func (p *EventBridgePublisher) PublishEventResult(ctx context.Context, detailType string, detail interface{}) (*PublishResult, error) {
+	result := &PublishResult{}
+	entry, err := p.buildEntry(detailType, detail, time.Time{})
+	if err != nil {
+		return result, fmt.Errorf("failed to marshal event detail: %w", err)
+	}
+
+	results := make([]PublishResult, 1)
+	_, err = p.putEntriesResults(ctx, []types.PutEventsRequestEntry{entry}, results)
+	*result = results[0]
+	return result, err
+}
+
+// PublishEventAt publishes a single event with an explicit entry time.
+// A zero eventTime falls back to the publisher's default time source.
+func (p *EventBridgePublisher) PublishEventAt(ctx context.Context, detailType string, detail interface{}, eventTime time.Time) error {
+	entry, err := p.buildEntry(detailType, detail, eventTime)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event detail: %w", err)
 	}
 
-	entry := types.PutEventsRequestEntry{
+	return p.publishEntries(ctx, []types.PutEventsRequestEntry{entry})
+}
+
+// PublishEntry publishes a single event with its optional time, related
+// resource ARNs and X-Ray trace header
+func (p *EventBridgePublisher) PublishEntry(ctx context.Context, event EventBridgeEvent) error {
+	entry, err := p.buildEventEntry(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event detail: %w", err)
+	}
+
+	return p.publishEntries(ctx, []types.PutEventsRequestEntry{entry})
+}
+
+// buildEventEntry builds a PutEvents entry carrying the event's resources and
+// trace header. Empty values leave the entry fields unset.
+func (p *EventBridgePublisher) buildEventEntry(event EventBridgeEvent) (types.PutEventsRequestEntry, error) {
+	entry, err := p.buildEntry(event.DetailType, event.Detail, event.Time)
+	if err != nil {
+		return types.PutEventsRequestEntry{}, err
+	}
+
+	if len(event.Resources) > 0 {
+		entry.Resources = append([]string(nil), event.Resources...)
+	}
+	if event.TraceHeader != "" {
+		entry.TraceHeader = aws.String(event.TraceHeader)
+	}
+	return entry, nil
+}
+
+// buildEntry builds a PutEvents entry for the given detail
+func (p *EventBridgePublisher) buildEntry(detailType string, detail interface{}, eventTime time.Time) (types.PutEventsRequestEntry, error) {
+	payload := detail
+	if p.wrapEnvelope {
+		envelope, err := events.Wrap(detail)
+		switch {
+		case err == nil:
+			payload = envelope
+		case !errors.Is(err, events.ErrUnknownEventKind):
+			return types.PutEventsRequestEntry{}, err
+		}
+	}
+
+	detailJSON, err := json.Marshal(payload)
+	if err != nil {
+		return types.PutEventsRequestEntry{}, err
+	}
+
+	return types.PutEventsRequestEntry{
 		EventBusName: aws.String(p.eventBus),
 		Source:       aws.String(p.source),
 		DetailType:   aws.String(detailType),
 		Detail:       aws.String(string(detailJSON)),
-		Time:         aws.Time(time.Now()),
+		Time:         aws.Time(p.entryTime(detail, eventTime)),
+	}, nil
+}
+
+// entryTime resolves the entry time: an explicit time wins, then the detail's
+// own timestamp when enabled, then now
+func (p *EventBridgePublisher) entryTime(detail interface{}, eventTime time.Time) time.Time {
+	if !eventTime.IsZero() {
+		return eventTime
+	}
+	if p.useEventTime {
+		if timer, ok := detail.(eventTimer); ok {
+			if t := timer.EventTime(); !t.IsZero() {
+				return t
+			}
+		}
 	}
+	return time.Now()
+}
 
-	return p.publishEntries(ctx, []types.PutEventsRequestEntry{entry})
+// BatchPublishResult reports the outcome of a batch publish by index into the
+// events passed in. Failed events were not delivered and can be retried
+// without re-sending the ones that were.
+type BatchPublishResult struct {
+	Succeeded []int
+	Failed    []int
+	// Errors holds the failure of each sub-batch with undelivered events
+	Errors []error
 }
 
-// PublishEventBatch publishes multiple events in a batch
+// Err returns the joined errors, or nil if every event was delivered
+func (r *BatchPublishResult) Err() error {
+	return errors.Join(r.Errors...)
+}
+
+// FailedEvents returns the events that were not delivered, in order, given
+// the events that were published
+func (r *BatchPublishResult) FailedEvents(events []EventBridgeEvent) []EventBridgeEvent {
+	failed := make([]EventBridgeEvent, 0, len(r.Failed))
+	for _, i := range r.Failed {
+		failed = append(failed, events[i])
+	}
+	return failed
+}
+
+// BatchPublishError is returned by PublishEventBatch when some events were
+// not delivered. Result tells which.
+type BatchPublishError struct {
+	Result *BatchPublishResult
+}
+
+func (e *BatchPublishError) Error() string {
+	return fmt.Sprintf("failed to publish %d of %d events: %v",
+		len(e.Result.Failed), len(e.Result.Failed)+len(e.Result.Succeeded), e.Result.Err())
+}
+
+func (e *BatchPublishError) Unwrap() error {
+	return e.Result.Err()
+}
+
+// PublishEventBatch publishes multiple events in a batch. When some events
+// fail, the error is a *BatchPublishError listing them.
 func (p *EventBridgePublisher) PublishEventBatch(ctx context.Context, events []EventBridgeEvent) error {
-	if len(events) == 0 {
-		return nil
+	result := p.PublishEventBatchResult(ctx, events)
+	if len(result.Failed) > 0 {
+		return &BatchPublishError{Result: result}
 	}
+	return nil
+}
+
+// PublishEventBatchResult publishes events in sub-batches of up to ten and
+// reports which were delivered. A failed sub-batch doesn't stop later ones.
+func (p *EventBridgePublisher) PublishEventBatchResult(ctx context.Context, events []EventBridgeEvent) *BatchPublishResult {
+	result := &BatchPublishResult{}
 
 	// Split into batches of maxBatchSize
 	for i := 0; i < len(events); i += maxBatchSize {
@@ -67,88 +311,237 @@ func (p *EventBridgePublisher) PublishEventBatch(ctx context.Context, events []E
 			end = len(events)
 		}
 
-		batch := events[i:end]
-		entries := make([]types.PutEventsRequestEntry, len(batch))
-
-		for j, event := range batch {
-			detailJSON, err := json.Marshal(event.Detail)
+		// indices maps each entry back to its event
+		entries := make([]types.PutEventsRequestEntry, 0, end-i)
+		indices := make([]int, 0, end-i)
+		for j := i; j < end; j++ {
+			entry, err := p.buildEventEntry(events[j])
 			if err != nil {
-				return fmt.Errorf("failed to marshal event detail at index %d: %w", j, err)
-			}
-
-			entries[j] = types.PutEventsRequestEntry{
-				EventBusName: aws.String(p.eventBus),
-				Source:       aws.String(p.source),
-				DetailType:   aws.String(event.DetailType),
-				Detail:       aws.String(string(detailJSON)),
-				Time:         aws.Time(time.Now()),
+				result.Failed = append(result.Failed, j)
+				result.Errors = append(result.Errors, fmt.Errorf("failed to marshal event detail at index %d: %w", j, err))
+				continue
 			}
+			entries = append(entries, entry)
+			indices = append(indices, j)
+		}
+		if len(entries) == 0 {
+			continue
 		}
 
-		if err := p.publishEntries(ctx, entries); err != nil {
-			return fmt.Errorf("failed to publish batch starting at index %d: %w", i, err)
+		undelivered, err := p.putEntries(ctx, entries)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to publish batch starting at index %d: %w", i, err))
+		}
+		failed := make(map[int]bool, len(undelivered))
+		for _, k := range undelivered {
+			failed[k] = true
+		}
+		for k, index := range indices {
+			if failed[k] {
+				result.Failed = append(result.Failed, index)
+			} else {
+				result.Succeeded = append(result.Succeeded, index)
+			}
 		}
 	}
 
-	return nil
+	sort.Ints(result.Failed)
+	return result
 }
 
-// publishEntries publishes entries with retry logic
+// publishEntries publishes entries with retry logic, failing if any entry
+// isn't delivered
 func (p *EventBridgePublisher) publishEntries(ctx context.Context, entries []types.PutEventsRequestEntry) error {
+	_, err := p.putEntries(ctx, entries)
+	return err
+}
+
+// putEntries publishes entries with retry logic, retrying only the entries
+// that failed. It returns the indices of the entries never delivered along
+// with the last error. Retries draw on the context's RetryBudget, if any; a
+// spent budget fails the publish fast. More than maxBatchSize entries fail
+// without calling EventBridge, which would reject the whole call.
+func (p *EventBridgePublisher) putEntries(ctx context.Context, entries []types.PutEventsRequestEntry) ([]int, error) {
+	return p.putEntriesResults(ctx, entries, nil)
+}
+
+// putEntriesResults is putEntries that also records each entry's outcome in
+// results, indexed like entries, when results isn't nil
+func (p *EventBridgePublisher) putEntriesResults(ctx context.Context, entries []types.PutEventsRequestEntry, results []PublishResult) ([]int, error) {
+	pending := make([]int, len(entries))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	if len(entries) > maxBatchSize {
+		return pending, fmt.Errorf("%w: %d entries exceed the limit of %d per call", ErrTooManyEntries, len(entries), maxBatchSize)
+	}
+
+	budget := RetryBudgetFromContext(ctx)
+	if budget.Exhausted() {
+		return pending, ErrRetryBudgetExhausted
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, p.timeout)
 	defer cancel()
 
 	var lastErr error
+	throttled := false
 	for attempt := 0; attempt <= p.maxRetry; attempt++ {
 		if attempt > 0 {
-			// Exponential backoff
-			backoff := time.Duration(attempt*attempt) * 100 * time.Millisecond
-			time.Sleep(backoff)
+			if !budget.Take() {
+				return pending, fmt.Errorf("failed to publish events after %d attempts: %w: %w", attempt, ErrRetryBudgetExhausted, lastErr)
+			}
+			p.sleep(p.backoff(attempt, throttled))
+		}
+
+		batch := make([]types.PutEventsRequestEntry, len(pending))
+		for i, index := range pending {
+			batch[i] = entries[index]
 		}
 
+		start := time.Now()
 		output, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{
-			Entries: entries,
+			Entries:    batch,
+			EndpointId: p.endpointIDInput(),
 		})
+		observeSince(ServiceEventBridge, "PutEvents", start,
+			zap.String("event_bus", p.eventBus),
+			zap.String("endpoint_id", p.endpointID),
+			zap.Int("entries", len(batch)))
 
 		if err != nil {
 			lastErr = err
+			throttled = isThrottlingError(err)
+			if throttled {
+				metrics.EventBridgeThrottled.WithLabelValues(p.eventBus, p.source).Inc()
+			}
 			continue
 		}
 
+		if results != nil {
+			for i, entry := range output.Entries {
+				if i < len(pending) {
+					results[pending[i]] = PublishResult{
+						EventID:      aws.ToString(entry.EventId),
+						ErrorCode:    aws.ToString(entry.ErrorCode),
+						ErrorMessage: aws.ToString(entry.ErrorMessage),
+					}
+				}
+			}
+		}
+
 		// Check for failed entries
 		if output.FailedEntryCount > 0 {
-			failedEntries := make([]types.PutEventsRequestEntry, 0)
+			failed := make([]int, 0)
+			throttled = false
 			for i, entry := range output.Entries {
 				if entry.ErrorCode != nil {
-					failedEntries = append(failedEntries, entries[i])
-					lastErr = fmt.Errorf("entry failed with code %s: %s", 
-						aws.ToString(entry.ErrorCode), 
-						aws.ToString(entry.ErrorMessage))
+					failed = append(failed, pending[i])
+					lastErr = &EntryError{
+						Code:    aws.ToString(entry.ErrorCode),
+						Message: aws.ToString(entry.ErrorMessage),
+					}
+					if throttlingErrorCodes[aws.ToString(entry.ErrorCode)] {
+						throttled = true
+						metrics.EventBridgeThrottled.WithLabelValues(p.eventBus, p.source).Inc()
+					}
 				}
 			}
 
 			// Retry only failed entries
-			if len(failedEntries) > 0 {
-				entries = failedEntries
+			if len(failed) > 0 {
+				pending = failed
 				continue
 			}
 		}
 
 		// Success
-		return nil
+		return nil, nil
+	}
+
+	return pending, fmt.Errorf("failed to publish events after %d attempts: %w", p.maxRetry, lastErr)
+}
+
+// backoff returns the delay before the given retry attempt. Throttling backs
+// off more aggressively than other failures so the publish rate drops.
+func (p *EventBridgePublisher) backoff(attempt int, throttled bool) time.Duration {
+	backoff := time.Duration(attempt*attempt) * baseBackoff
+	if throttled {
+		backoff *= throttleBackoffMultiplier
 	}
+	return backoff
+}
 
-	return fmt.Errorf("failed to publish events after %d attempts: %w", p.maxRetry, lastErr)
+// isThrottlingError reports whether err is an EventBridge throttling error
+func isThrottlingError(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return throttlingErrorCodes[apiErr.ErrorCode()]
+	}
+	return false
 }
 
 // EventBridgeEvent represents an event to be published
 type EventBridgeEvent struct {
 	DetailType string
 	Detail     interface{}
+	Time       time.Time // Optional entry time; zero uses the publisher default
+
+	// Resources optionally lists ARNs the event relates to, such as the source
+	// table or tenant, for rule filtering and cost attribution
+	Resources []string
+	// TraceHeader optionally carries the X-Ray trace header
+	TraceHeader string
 }
 
-// PublishCrossRegionEvent publishes an event to a partner region's EventBridge
+// PublishCrossRegionEvent publishes an event to a partner region's EventBridge.
+// With a deduplicator set, the event's idempotency key is leased before the
+// publish and marked published after it, and an event whose key was already
+// published is skipped, so a retried invocation doesn't publish it twice. A
+// key leased by a publish still in flight returns ErrDedupInProgress. The
+// lease is released if the publish fails. Events with an empty key aren't
+// deduplicated.
 func (p *EventBridgePublisher) PublishCrossRegionEvent(ctx context.Context, targetRegion string, event interface{}) error {
-	detailType := fmt.Sprintf("cross-region.%s", targetRegion)
-	return p.PublishEvent(ctx, detailType, event)
+	_, err := p.PublishCrossRegionEventResult(ctx, targetRegion, event)
+	return err
+}
+
+// PublishCrossRegionEventResult publishes like PublishCrossRegionEvent and
+// reports the outcome, including the event ID EventBridge assigned. An event
+// skipped as already published has an empty result.
+func (p *EventBridgePublisher) PublishCrossRegionEventResult(ctx context.Context, targetRegion string, event interface{}) (*PublishResult, error) {
+	detailType := CrossRegionDetailType(targetRegion)
+
+	if p.dedup == nil {
+		return p.PublishEventResult(ctx, detailType, event)
+	}
+	key, err := p.dedupKey(event)
+	if err != nil {
+		return &PublishResult{}, fmt.Errorf("failed to derive idempotency key: %w", err)
+	}
+	if key == "" {
+		return p.PublishEventResult(ctx, detailType, event)
+	}
+
+	claimed, err := p.dedup.Claim(ctx, key)
+	if err != nil {
+		return &PublishResult{}, err
+	}
+	if !claimed {
+		metrics.PublishDeduped.WithLabelValues(p.source, targetRegion).Inc()
+		return &PublishResult{}, nil
+	}
+
+	// Settle the claim even when ctx was cancelled mid-publish, or the key
+	// stays leased
+	settleCtx := context.WithoutCancel(ctx)
+	result, err := p.PublishEventResult(ctx, detailType, event)
+	if err != nil {
+		if releaseErr := p.dedup.Release(settleCtx, key); releaseErr != nil {
+			return result, errors.Join(err, releaseErr)
+		}
+		return result, err
+	}
+	return result, p.dedup.MarkPublished(settleCtx, key)
 }
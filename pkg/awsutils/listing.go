@@ -0,0 +1,116 @@
+package awsutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+)
+
+// EventBridgeListAPI is the subset of the EventBridge client used to
+// enumerate buses and rules for ops tooling
+type EventBridgeListAPI interface {
+	ListEventBuses(ctx context.Context, params *eventbridge.ListEventBusesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListEventBusesOutput, error)
+	ListRules(ctx context.Context, params *eventbridge.ListRulesInput, optFns ...func(*eventbridge.Options)) (*eventbridge.ListRulesOutput, error)
+}
+
+// EventBusSummary describes an event bus
+type EventBusSummary struct {
+	Name        string
+	ARN         string
+	Description string
+}
+
+// RuleSummary describes a rule on an event bus. A rule has either an
+// EventPattern or a ScheduleExpression.
+type RuleSummary struct {
+	Name               string
+	ARN                string
+	EventBus           string
+	State              string
+	Description        string
+	EventPattern       string
+	ScheduleExpression string
+}
+
+// listPages calls fetch with each page's token until it returns no next
+// token, collecting every item. The context is checked between pages so a
+// cancelled listing stops without fetching the rest.
+func listPages[T any](ctx context.Context, fetch func(ctx context.Context, token *string) ([]T, *string, error)) ([]T, error) {
+	var (
+		items []T
+		token *string
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		page, next, err := fetch(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+
+		if aws.ToString(next) == "" {
+			return items, nil
+		}
+		token = next
+	}
+}
+
+// ListEventBuses returns every event bus in the account and region
+func ListEventBuses(ctx context.Context, client EventBridgeListAPI) ([]EventBusSummary, error) {
+	buses, err := listPages(ctx, func(ctx context.Context, token *string) ([]EventBusSummary, *string, error) {
+		output, err := client.ListEventBuses(ctx, &eventbridge.ListEventBusesInput{NextToken: token})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		page := make([]EventBusSummary, 0, len(output.EventBuses))
+		for _, bus := range output.EventBuses {
+			page = append(page, EventBusSummary{
+				Name:        aws.ToString(bus.Name),
+				ARN:         aws.ToString(bus.Arn),
+				Description: aws.ToString(bus.Description),
+			})
+		}
+		return page, output.NextToken, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event buses: %w", err)
+	}
+	return buses, nil
+}
+
+// ListRulesForBus returns every rule on eventBus
+func ListRulesForBus(ctx context.Context, client EventBridgeListAPI, eventBus string) ([]RuleSummary, error) {
+	rules, err := listPages(ctx, func(ctx context.Context, token *string) ([]RuleSummary, *string, error) {
+		output, err := client.ListRules(ctx, &eventbridge.ListRulesInput{
+			EventBusName: aws.String(eventBus),
+			NextToken:    token,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		page := make([]RuleSummary, 0, len(output.Rules))
+		for _, rule := range output.Rules {
+			page = append(page, RuleSummary{
+				Name:               aws.ToString(rule.Name),
+				ARN:                aws.ToString(rule.Arn),
+				EventBus:           aws.ToString(rule.EventBusName),
+				State:              string(rule.State),
+				Description:        aws.ToString(rule.Description),
+				EventPattern:       aws.ToString(rule.EventPattern),
+				ScheduleExpression: aws.ToString(rule.ScheduleExpression),
+			})
+		}
+		return page, output.NextToken, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules for event bus %s: %w", eventBus, err)
+	}
+	return rules, nil
+}
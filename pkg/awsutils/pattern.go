@@ -0,0 +1,346 @@
+package awsutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// EventPattern is a local evaluator for EventBridge event patterns, so routing
+// rules can be unit tested without deploying. It supports exact values and the
+// prefix, suffix, anything-but, numeric, exists and equals-ignore-case
+// operators with EventBridge semantics: every pattern field must match, a
+// list matches if any entry matches, and array values in the event match if
+// any element matches.
+type EventPattern struct {
+	root map[string]interface{}
+}
+
+// NewEventPattern parses and validates an EventBridge event pattern
+func NewEventPattern(pattern string) (*EventPattern, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal([]byte(pattern), &root); err != nil {
+		return nil, fmt.Errorf("failed to parse event pattern: %w", err)
+	}
+	if err := validatePattern(root, ""); err != nil {
+		return nil, err
+	}
+	return &EventPattern{root: root}, nil
+}
+
+// MatchEventPattern reports whether a marshaled event matches pattern
+func MatchEventPattern(pattern string, event []byte) (bool, error) {
+	p, err := NewEventPattern(pattern)
+	if err != nil {
+		return false, err
+	}
+	return p.Matches(event)
+}
+
+// Matches reports whether a marshaled EventBridge event matches the pattern
+func (p *EventPattern) Matches(event []byte) (bool, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(event, &root); err != nil {
+		return false, fmt.Errorf("failed to parse event: %w", err)
+	}
+	return matchObject(p.root, root), nil
+}
+
+// MatchesEntry reports whether a PutEvents entry would match the pattern once
+// delivered, using the envelope fields EventBridge adds from the entry
+func (p *EventPattern) MatchesEntry(entry types.PutEventsRequestEntry) (bool, error) {
+	event := map[string]interface{}{
+		"version":     "0",
+		"source":      stringValue(entry.Source),
+		"detail-type": stringValue(entry.DetailType),
+		"resources":   entry.Resources,
+	}
+	if entry.Time != nil {
+		event["time"] = entry.Time.UTC().Format(time.RFC3339)
+	}
+	if entry.Detail != nil {
+		var detail interface{}
+		if err := json.Unmarshal([]byte(*entry.Detail), &detail); err != nil {
+			return false, fmt.Errorf("failed to parse entry detail: %w", err)
+		}
+		event["detail"] = detail
+	}
+	if entry.Resources == nil {
+		event["resources"] = []interface{}{}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal entry: %w", err)
+	}
+	return p.Matches(data)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// validatePattern checks that every leaf is a list of values or known operators
+func validatePattern(node map[string]interface{}, path string) error {
+	if len(node) == 0 {
+		return fmt.Errorf("event pattern %s must not be empty", displayPath(path))
+	}
+	for key, value := range node {
+		fieldPath := strings.TrimPrefix(path+"."+key, ".")
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if err := validatePattern(v, fieldPath); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, candidate := range v {
+				if op, ok := candidate.(map[string]interface{}); ok {
+					if err := validateOperator(op, fieldPath); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("event pattern field %s must be an object or an array", fieldPath)
+		}
+	}
+	return nil
+}
+
+func validateOperator(op map[string]interface{}, path string) error {
+	if len(op) != 1 {
+		return fmt.Errorf("event pattern field %s: operator objects must have exactly one key", path)
+	}
+	for name, arg := range op {
+		switch name {
+		case "prefix", "suffix", "equals-ignore-case":
+			if _, ok := arg.(string); !ok {
+				return fmt.Errorf("event pattern field %s: %s requires a string", path, name)
+			}
+		case "exists":
+			if _, ok := arg.(bool); !ok {
+				return fmt.Errorf("event pattern field %s: exists requires a boolean", path)
+			}
+		case "anything-but":
+			if nested, ok := arg.(map[string]interface{}); ok {
+				return validateOperator(nested, path)
+			}
+		case "numeric":
+			if _, err := parseNumericConditions(arg); err != nil {
+				return fmt.Errorf("event pattern field %s: %w", path, err)
+			}
+		default:
+			return fmt.Errorf("event pattern field %s: unsupported operator %q", path, name)
+		}
+	}
+	return nil
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "root"
+	}
+	return path
+}
+
+// matchObject requires every pattern field to match the event
+func matchObject(pattern, event map[string]interface{}) bool {
+	for key, patternValue := range pattern {
+		value, present := event[key]
+
+		switch p := patternValue.(type) {
+		case map[string]interface{}:
+			nested, ok := value.(map[string]interface{})
+			if !ok {
+				// A missing object still satisfies a nested exists: false
+				if !present && onlyNotExists(p) {
+					continue
+				}
+				return false
+			}
+			if !matchObject(p, nested) {
+				return false
+			}
+		case []interface{}:
+			if !matchField(p, value, present) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// onlyNotExists reports whether every leaf under pattern is exists: false
+func onlyNotExists(pattern map[string]interface{}) bool {
+	for _, value := range pattern {
+		switch p := value.(type) {
+		case map[string]interface{}:
+			if !onlyNotExists(p) {
+				return false
+			}
+		case []interface{}:
+			for _, candidate := range p {
+				op, ok := candidate.(map[string]interface{})
+				if !ok || op["exists"] != false {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// matchField matches a leaf field against a list of candidates
+func matchField(candidates []interface{}, value interface{}, present bool) bool {
+	for _, candidate := range candidates {
+		if op, ok := candidate.(map[string]interface{}); ok {
+			if exists, ok := op["exists"].(bool); ok {
+				_, isObject := value.(map[string]interface{})
+				if exists == (present && !isObject) {
+					return true
+				}
+				continue
+			}
+		}
+		if !present {
+			continue
+		}
+		// Array values match if any element matches
+		values, isArray := value.([]interface{})
+		if !isArray {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			if matchCandidate(candidate, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchCandidate matches a single event value against one pattern entry
+func matchCandidate(candidate, value interface{}) bool {
+	op, ok := candidate.(map[string]interface{})
+	if !ok {
+		return equalValues(candidate, value)
+	}
+
+	for name, arg := range op {
+		switch name {
+		case "prefix":
+			s, ok := value.(string)
+			return ok && strings.HasPrefix(s, arg.(string))
+		case "suffix":
+			s, ok := value.(string)
+			return ok && strings.HasSuffix(s, arg.(string))
+		case "equals-ignore-case":
+			s, ok := value.(string)
+			return ok && strings.EqualFold(s, arg.(string))
+		case "anything-but":
+			return !matchAnythingBut(arg, value)
+		case "numeric":
+			n, ok := value.(float64)
+			if !ok {
+				return false
+			}
+			conditions, _ := parseNumericConditions(arg)
+			for _, c := range conditions {
+				if !c.matches(n) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnythingBut reports whether value matches what anything-but excludes
+func matchAnythingBut(arg, value interface{}) bool {
+	switch a := arg.(type) {
+	case []interface{}:
+		for _, excluded := range a {
+			if equalValues(excluded, value) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		return matchCandidate(a, value)
+	default:
+		return equalValues(a, value)
+	}
+}
+
+func equalValues(a, b interface{}) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return false
+}
+
+// numericCondition is one comparison in a numeric operator
+type numericCondition struct {
+	op    string
+	value float64
+}
+
+func (c numericCondition) matches(n float64) bool {
+	switch c.op {
+	case "=":
+		return n == c.value
+	case "<":
+		return n < c.value
+	case "<=":
+		return n <= c.value
+	case ">":
+		return n > c.value
+	case ">=":
+		return n >= c.value
+	}
+	return false
+}
+
+// parseNumericConditions parses a numeric operator argument such as [">", 0, "<=", 5]
+func parseNumericConditions(arg interface{}) ([]numericCondition, error) {
+	list, ok := arg.([]interface{})
+	if !ok || len(list) == 0 || len(list)%2 != 0 {
+		return nil, fmt.Errorf("numeric requires operator/value pairs")
+	}
+
+	conditions := make([]numericCondition, 0, len(list)/2)
+	for i := 0; i < len(list); i += 2 {
+		op, ok := list[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("numeric operator must be a string")
+		}
+		switch op {
+		case "=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("unsupported numeric operator %q", op)
+		}
+		value, ok := list[i+1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("numeric operand must be a number")
+		}
+		conditions = append(conditions, numericCondition{op: op, value: value})
+	}
+	return conditions, nil
+}
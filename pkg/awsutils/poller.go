@@ -0,0 +1,177 @@
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+)
+
+const (
+	// defaultPollWaitSeconds is the SQS long-polling wait, the maximum allowed
+	defaultPollWaitSeconds = 20
+
+	// defaultPollMaxMessages is the largest batch SQS returns
+	defaultPollMaxMessages = 10
+)
+
+// Poll results, used as the "result" label of metrics.SQSPolls
+const (
+	pollResultMessages = "messages"
+	pollResultEmpty    = "empty"
+	pollResultError    = "error"
+)
+
+// MessageHandler processes a batch of messages received by a Poller
+type MessageHandler func(ctx context.Context, messages []types.Message) error
+
+// Poller receives from an SQS queue in a loop, re-polling immediately while
+// messages are arriving and backing off exponentially, from minBackoff up to
+// maxBackoff, while the queue is empty or receives fail. Any batch of
+// messages resets the backoff.
+type Poller struct {
+	client      SQSReceiveAPI
+	queueURL    string
+	queue       string
+	waitSeconds int32
+	maxMessages int32
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	backoff     time.Duration
+
+	onReceiveError func(error)
+	wait           func(ctx context.Context, d time.Duration) error
+}
+
+// NewPoller creates a poller for queueURL that long-polls for 20 seconds and
+// backs off between minBackoff and maxBackoff
+func NewPoller(client SQSReceiveAPI, queueURL string, minBackoff, maxBackoff time.Duration) *Poller {
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+	return &Poller{
+		client:      client,
+		queueURL:    queueURL,
+		queue:       path.Base(queueURL),
+		waitSeconds: defaultPollWaitSeconds,
+		maxMessages: defaultPollMaxMessages,
+		minBackoff:  minBackoff,
+		maxBackoff:  maxBackoff,
+		wait:        waitContext,
+	}
+}
+
+// SetWaitTime sets how long, in seconds, each receive waits for messages.
+// Zero switches to short polling.
+func (p *Poller) SetWaitTime(seconds int32) {
+	p.waitSeconds = seconds
+}
+
+// SetMaxMessages sets the largest batch requested per receive, from 1 to 10
+func (p *Poller) SetMaxMessages(n int32) {
+	p.maxMessages = n
+}
+
+// SetReceiveErrorHandler registers fn to receive errors from failed receives,
+// which Run backs off from instead of returning
+func (p *Poller) SetReceiveErrorHandler(fn func(error)) {
+	p.onReceiveError = fn
+}
+
+// Backoff returns the delay before the next receive
+func (p *Poller) Backoff() time.Duration {
+	return p.backoff
+}
+
+// Poll receives once and updates the backoff from the result
+func (p *Poller) Poll(ctx context.Context) ([]types.Message, error) {
+	// Not observed as a slow operation: long polls wait by design
+	output, err := p.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(p.queueURL),
+		MaxNumberOfMessages: p.maxMessages,
+		WaitTimeSeconds:     p.waitSeconds,
+	})
+	if err != nil && ctx.Err() != nil {
+		// Interrupted by shutdown rather than failed
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		metrics.SQSPolls.WithLabelValues(p.queue, pollResultError).Inc()
+		p.increaseBackoff()
+		return nil, fmt.Errorf("failed to receive from %s: %w", p.queue, err)
+	}
+
+	if len(output.Messages) == 0 {
+		metrics.SQSPolls.WithLabelValues(p.queue, pollResultEmpty).Inc()
+		p.increaseBackoff()
+		return nil, nil
+	}
+
+	metrics.SQSPolls.WithLabelValues(p.queue, pollResultMessages).Inc()
+	p.backoff = 0
+	return output.Messages, nil
+}
+
+// increaseBackoff doubles the backoff, starting from minBackoff, up to maxBackoff
+func (p *Poller) increaseBackoff() {
+	switch {
+	case p.backoff == 0:
+		p.backoff = p.minBackoff
+	case p.backoff < p.maxBackoff/2:
+		p.backoff *= 2
+	default:
+		p.backoff = p.maxBackoff
+	}
+}
+
+// Run polls until ctx is done, passing each batch of messages to handler. It
+// returns ctx's error once ctx is done, or the first error from handler.
+func (p *Poller) Run(ctx context.Context, handler MessageHandler) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		messages, err := p.Poll(ctx)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if p.onReceiveError != nil {
+				p.onReceiveError(err)
+			}
+		}
+
+		if len(messages) > 0 {
+			if err := handler(ctx, messages); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := p.wait(ctx, p.backoff); err != nil {
+			return err
+		}
+	}
+}
+
+// waitContext sleeps for d or until ctx is done
+func waitContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
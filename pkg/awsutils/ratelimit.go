@@ -0,0 +1,90 @@
+package awsutils
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket pacing operations to a steady rate per
+// second, allowing bursts of up to burst operations after a quiet period.
+// Callers over the rate wait their turn in order. It is safe for concurrent
+// use, and a nil limiter doesn't limit.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	wait   func(ctx context.Context, d time.Duration) error
+}
+
+// NewRateLimiter creates a limiter allowing rate operations per second, with
+// bursts of up to burst. A burst below 1 allows one operation at a time. A
+// rate of zero or less means no limit, and returns nil.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+		wait:   waitContext,
+	}
+}
+
+// Rate returns the operations allowed per second, or +Inf for a nil limiter
+func (l *RateLimiter) Rate() float64 {
+	if l == nil {
+		return math.Inf(1)
+	}
+	return l.rate
+}
+
+// Wait blocks until one operation is allowed or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n operations are allowed or ctx is done. If ctx ends
+// the wait, the operations are given back.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return ctx.Err()
+	}
+
+	delay := l.reserve(n)
+	if err := l.wait(ctx, delay); err != nil {
+		l.mu.Lock()
+		l.tokens += float64(n)
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// reserve takes n tokens, going into debt if there aren't enough, and
+// returns how long the caller must wait for the debt to be repaid
+func (l *RateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
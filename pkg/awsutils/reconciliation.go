@@ -0,0 +1,89 @@
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Reconciliation record statuses
+const (
+	ReconciliationPublished = "published"
+	ReconciliationFailed    = "failed"
+	ReconciliationBuffered  = "buffered"
+)
+
+// ReconciliationRecord links a source stream record to the event published
+// for it. It is keyed by SourceEventID, so the latest attempt for a record
+// replaces earlier ones.
+type ReconciliationRecord struct {
+	SourceEventID    string    `dynamodbav:"source_event_id" json:"source_event_id"`
+	PublishedEventID string    `dynamodbav:"published_event_id,omitempty" json:"published_event_id,omitempty"`
+	EventSourceARN   string    `dynamodbav:"event_source_arn,omitempty" json:"event_source_arn,omitempty"`
+	Status           string    `dynamodbav:"status" json:"status"`
+	Error            string    `dynamodbav:"error,omitempty" json:"error,omitempty"`
+	Timestamp        time.Time `dynamodbav:"timestamp" json:"timestamp"`
+	ExpiresAt        int64     `dynamodbav:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// ReconciliationStore is the part of DynamoDBHelper used by ReconciliationLog
+type ReconciliationStore interface {
+	PutItem(ctx context.Context, item interface{}) error
+	GetItem(ctx context.Context, key map[string]types.AttributeValue, result interface{}) error
+}
+
+// ReconciliationLog records the outcome of publishing each source record, so
+// changes that were never published can be found afterwards
+type ReconciliationLog struct {
+	store ReconciliationStore
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewReconciliationLog creates a log writing to store. Records expire after
+// ttl through the table's "expires_at" TTL attribute; zero keeps them.
+func NewReconciliationLog(store ReconciliationStore, ttl time.Duration) *ReconciliationLog {
+	return &ReconciliationLog{
+		store: store,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// Write stores record, stamping its timestamp and expiry
+func (l *ReconciliationLog) Write(ctx context.Context, record ReconciliationRecord) error {
+	record.Timestamp = l.now().UTC()
+	if l.ttl > 0 {
+		record.ExpiresAt = record.Timestamp.Add(l.ttl).Unix()
+	}
+	if err := l.store.PutItem(ctx, record); err != nil {
+		return fmt.Errorf("failed to write reconciliation record for %s: %w", record.SourceEventID, err)
+	}
+	return nil
+}
+
+// Unpublished returns the source event IDs, in the order given, that have no
+// reconciliation record or whose latest record isn't published
+func (l *ReconciliationLog) Unpublished(ctx context.Context, sourceEventIDs []string) ([]string, error) {
+	var unpublished []string
+	for _, id := range sourceEventIDs {
+		key := map[string]types.AttributeValue{
+			"source_event_id": &types.AttributeValueMemberS{Value: id},
+		}
+
+		var record ReconciliationRecord
+		err := l.store.GetItem(ctx, key, &record)
+		switch {
+		case errors.Is(err, ErrItemNotFound):
+			unpublished = append(unpublished, id)
+		case err != nil:
+			return nil, fmt.Errorf("failed to read reconciliation record for %s: %w", id, err)
+		case record.Status != ReconciliationPublished:
+			unpublished = append(unpublished, id)
+		}
+	}
+	return unpublished, nil
+}
@@ -0,0 +1,333 @@
+package awsutils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultReplayCheckpointInterval is how many lines are replayed between
+	// checkpoints within an object
+	defaultReplayCheckpointInterval = 100
+
+	// maxReplayLineSize bounds one archived event, well above EventBridge's
+	// 256KB entry limit
+	maxReplayLineSize = 1024 * 1024
+)
+
+// ReplayS3API is the part of the S3 client used by Replayer
+type ReplayS3API interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// ReplayFilter selects the archived events to replay. Empty EventTypes match
+// every type; a zero From or To leaves that end of the time range open.
+type ReplayFilter struct {
+	EventTypes []string
+	From       time.Time
+	To         time.Time
+}
+
+// Match reports whether event passes the filter. From is inclusive and To
+// exclusive.
+func (f ReplayFilter) Match(event *events.BaseEvent) bool {
+	if len(f.EventTypes) > 0 {
+		matched := false
+		for _, eventType := range f.EventTypes {
+			if eventType == event.EventType {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if !f.From.IsZero() && event.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !event.Timestamp.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// ReplayCheckpoint is the position of a replay: the first Line lines of the
+// object Key have been replayed, all of it when Done
+type ReplayCheckpoint struct {
+	Key  string `json:"key"`
+	Line int64  `json:"line"`
+	Done bool   `json:"done"`
+}
+
+// ReplayStats counts the outcome of a replay run
+type ReplayStats struct {
+	Objects   int64
+	Published int64
+	Filtered  int64
+	Malformed int64
+}
+
+// Replayer republishes events archived in S3 as NDJSON, one BaseEvent per
+// line, reading the objects under a prefix in key order. Publishing is paced
+// to a fixed rate so a backfill doesn't overwhelm consumers, and progress is
+// saved to a checkpoint object so an interrupted replay can resume.
+type Replayer struct {
+	client             ReplayS3API
+	bucket             string
+	prefix             string
+	sink               EventSink
+	filter             ReplayFilter
+	interval           time.Duration
+	checkpointKey      string
+	checkpointInterval int64
+
+	now  func() time.Time
+	wait func(ctx context.Context, d time.Duration) error
+	last time.Time
+}
+
+// NewReplayer creates a replayer publishing the events under prefix in bucket
+// to sink, which is usually an EventBridgePublisher. Events are published as
+// fast as sink accepts them until SetRate is called.
+func NewReplayer(client ReplayS3API, bucket, prefix string, sink EventSink) *Replayer {
+	return &Replayer{
+		client:             client,
+		bucket:             bucket,
+		prefix:             prefix,
+		sink:               sink,
+		checkpointInterval: defaultReplayCheckpointInterval,
+		now:                time.Now,
+		wait:               waitContext,
+	}
+}
+
+// SetFilter limits the replay to events matching filter
+func (r *Replayer) SetFilter(filter ReplayFilter) {
+	r.filter = filter
+}
+
+// SetRate limits publishing to perSecond events a second. Zero removes the limit.
+func (r *Replayer) SetRate(perSecond float64) {
+	if perSecond <= 0 {
+		r.interval = 0
+		return
+	}
+	r.interval = time.Duration(float64(time.Second) / perSecond)
+}
+
+// SetCheckpointKey enables checkpointing to the object key in the replay's
+// bucket. Run resumes from the checkpoint found there.
+func (r *Replayer) SetCheckpointKey(key string) {
+	r.checkpointKey = key
+}
+
+// Run replays every matching event after the saved checkpoint, if any, and
+// returns the counts for this run. The checkpoint is saved as objects are
+// replayed and once more when Run stops, so a failed or cancelled run can be
+// resumed.
+func (r *Replayer) Run(ctx context.Context) (ReplayStats, error) {
+	var stats ReplayStats
+
+	checkpoint, err := r.loadCheckpoint(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucket),
+		Prefix: aws.String(r.prefix),
+	}
+	if checkpoint.Done {
+		input.StartAfter = aws.String(checkpoint.Key)
+	}
+
+	for {
+		start := time.Now()
+		output, err := r.client.ListObjectsV2(ctx, input)
+		observeSince(ServiceS3, "ListObjectsV2", start, zap.String("bucket", r.bucket))
+		if err != nil {
+			return stats, fmt.Errorf("failed to list %s/%s: %w", r.bucket, r.prefix, err)
+		}
+
+		for _, object := range output.Contents {
+			key := aws.ToString(object.Key)
+			if key == r.checkpointKey || key < checkpoint.Key {
+				continue
+			}
+
+			var skip int64
+			if key == checkpoint.Key {
+				skip = checkpoint.Line
+			}
+			if err := r.replayObject(ctx, key, skip, &checkpoint, &stats); err != nil {
+				if saveErr := r.saveCheckpoint(context.WithoutCancel(ctx), checkpoint); saveErr != nil {
+					err = errors.Join(err, saveErr)
+				}
+				return stats, err
+			}
+			stats.Objects++
+		}
+
+		if !aws.ToBool(output.IsTruncated) {
+			return stats, nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// replayObject publishes the matching events of one object, skipping its
+// first skip lines, and advances checkpoint as it goes
+func (r *Replayer) replayObject(ctx context.Context, key string, skip int64, checkpoint *ReplayCheckpoint, stats *ReplayStats) error {
+	start := time.Now()
+	output, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	observeSince(ServiceS3, "GetObject", start, zap.String("bucket", r.bucket))
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	defer output.Body.Close()
+
+	*checkpoint = ReplayCheckpoint{Key: key, Line: skip}
+
+	scanner := bufio.NewScanner(output.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReplayLineSize)
+	var line int64
+	for scanner.Scan() {
+		line++
+		if line <= skip {
+			continue
+		}
+
+		if err := r.replayLine(ctx, scanner.Bytes(), stats); err != nil {
+			return fmt.Errorf("failed to replay %s line %d: %w", key, line, err)
+		}
+
+		checkpoint.Line = line
+		if line%r.checkpointInterval == 0 {
+			if err := r.saveCheckpoint(ctx, *checkpoint); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", key, err)
+	}
+
+	checkpoint.Done = true
+	return r.saveCheckpoint(ctx, *checkpoint)
+}
+
+// replayLine publishes the event on one line if it matches the filter.
+// Blank and malformed lines are counted and skipped.
+func (r *Replayer) replayLine(ctx context.Context, data []byte, stats *ReplayStats) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	var event events.BaseEvent
+	if err := json.Unmarshal(data, &event); err != nil || event.EventType == "" {
+		stats.Malformed++
+		return nil
+	}
+	if !r.filter.Match(&event) {
+		stats.Filtered++
+		return nil
+	}
+
+	if err := r.pace(ctx); err != nil {
+		return err
+	}
+	// Marked so consumers treat it as a replay rather than a new change
+	event.Metadata.Replay = true
+	if err := r.sink.Publish(ctx, event.EventType, &event); err != nil {
+		return err
+	}
+	stats.Published++
+	return nil
+}
+
+// pace waits until the configured interval has passed since the last publish
+func (r *Replayer) pace(ctx context.Context) error {
+	if r.interval > 0 && !r.last.IsZero() {
+		if err := r.wait(ctx, r.last.Add(r.interval).Sub(r.now())); err != nil {
+			return err
+		}
+	}
+	r.last = r.now()
+	return nil
+}
+
+// loadCheckpoint reads the saved checkpoint, a zero one when there is none
+func (r *Replayer) loadCheckpoint(ctx context.Context) (ReplayCheckpoint, error) {
+	var checkpoint ReplayCheckpoint
+	if r.checkpointKey == "" {
+		return checkpoint, nil
+	}
+
+	start := time.Now()
+	output, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.checkpointKey),
+	})
+	observeSince(ServiceS3, "GetObject", start, zap.String("bucket", r.bucket))
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return checkpoint, fmt.Errorf("failed to get replay checkpoint: %w", err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return checkpoint, fmt.Errorf("failed to read replay checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, fmt.Errorf("failed to parse replay checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// saveCheckpoint writes checkpoint to the checkpoint object, if enabled
+func (r *Replayer) saveCheckpoint(ctx context.Context, checkpoint ReplayCheckpoint) error {
+	if r.checkpointKey == "" || checkpoint.Key == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal replay checkpoint: %w", err)
+	}
+
+	start := time.Now()
+	_, err = r.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(r.bucket),
+		Key:         aws.String(r.checkpointKey),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	observeSince(ServiceS3, "PutObject", start, zap.String("bucket", r.bucket))
+	if err != nil {
+		return fmt.Errorf("failed to save replay checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrRetryBudgetExhausted is returned when a publish fails fast because the
+// invocation's shared retry budget is spent
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// retryBudgetKey is the context key for the invocation's RetryBudget
+type retryBudgetKey struct{}
+
+// RetryBudget is a pool of retries shared by every publish in one invocation.
+// Once it is spent, further publishes fail fast instead of each retrying on
+// its own, so a batch of failing records can't run past the Lambda timeout.
+type RetryBudget struct {
+	remaining atomic.Int64
+}
+
+// NewRetryBudget creates a budget allowing retries retries in total
+func NewRetryBudget(retries int) *RetryBudget {
+	b := &RetryBudget{}
+	b.remaining.Store(int64(retries))
+	return b
+}
+
+// Take consumes one retry, reporting false if none are left. A nil budget is
+// unlimited.
+func (b *RetryBudget) Take() bool {
+	if b == nil {
+		return true
+	}
+	for {
+		remaining := b.remaining.Load()
+		if remaining <= 0 {
+			return false
+		}
+		if b.remaining.CompareAndSwap(remaining, remaining-1) {
+			return true
+		}
+	}
+}
+
+// Exhausted reports whether the budget is spent. A nil budget never is.
+func (b *RetryBudget) Exhausted() bool {
+	return b != nil && b.remaining.Load() <= 0
+}
+
+// Remaining returns the number of retries left
+func (b *RetryBudget) Remaining() int {
+	if b == nil {
+		return -1
+	}
+	return int(b.remaining.Load())
+}
+
+// WithRetryBudget returns a context whose publishes share budget
+func WithRetryBudget(ctx context.Context, budget *RetryBudget) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, budget)
+}
+
+// RetryBudgetFromContext returns the budget attached to ctx, or nil
+func RetryBudgetFromContext(ctx context.Context) *RetryBudget {
+	budget, _ := ctx.Value(retryBudgetKey{}).(*RetryBudget)
+	return budget
+}
@@ -0,0 +1,120 @@
+package awsutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event sink kinds selectable with SelectEventSink
+const (
+	SinkEventBridge = "eventbridge"
+	SinkFile        = "file"
+)
+
+// EventSink is where processed events are published. The EventBridge
+// publisher is the production sink; FileSink lets the pipeline run locally
+// without AWS.
+type EventSink interface {
+	Publish(ctx context.Context, detailType string, detail interface{}) error
+}
+
+// Publish implements EventSink
+func (p *EventBridgePublisher) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	return p.PublishEvent(ctx, detailType, detail)
+}
+
+// CrossRegionDetailType returns the detail type for events sent to a partner region
+func CrossRegionDetailType(targetRegion string) string {
+	return fmt.Sprintf("cross-region.%s", targetRegion)
+}
+
+// fileSinkRecord is one NDJSON line written by FileSink
+type fileSinkRecord struct {
+	Time       time.Time   `json:"time"`
+	Source     string      `json:"source"`
+	DetailType string      `json:"detail_type"`
+	Detail     interface{} `json:"detail"`
+}
+
+// FileSink appends published events to a writer as newline-delimited JSON
+type FileSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	source string
+	now    func() time.Time
+}
+
+// NewFileSink creates a sink that writes NDJSON lines to w
+func NewFileSink(w io.Writer, source string) *FileSink {
+	return &FileSink{
+		w:      w,
+		source: source,
+		now:    time.Now,
+	}
+}
+
+// OpenFileSink creates a sink that appends to the file at path, creating it if
+// needed. An empty path or "-" writes to stdout.
+func OpenFileSink(path, source string) (*FileSink, error) {
+	if path == "" || path == "-" {
+		return NewFileSink(os.Stdout, source), nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event sink file: %w", err)
+	}
+
+	sink := NewFileSink(f, source)
+	sink.closer = f
+	return sink, nil
+}
+
+// Publish writes the event as a single JSON line
+func (s *FileSink) Publish(ctx context.Context, detailType string, detail interface{}) error {
+	line, err := json.Marshal(fileSinkRecord{
+		Time:       s.now(),
+		Source:     s.source,
+		DetailType: detailType,
+		Detail:     detail,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event detail: %w", err)
+	}
+	line = append(line, '\n')
+
+	// One write per line keeps concurrent publishers from interleaving
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(line); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file, if the sink opened one
+func (s *FileSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// SelectEventSink returns the sink for kind: the given EventBridge sink for
+// "eventbridge" or an empty kind, or a FileSink writing to path for "file"
+func SelectEventSink(kind, path string, eventBridge EventSink, source string) (EventSink, error) {
+	switch kind {
+	case "", SinkEventBridge:
+		return eventBridge, nil
+	case SinkFile:
+		return OpenFileSink(path, source)
+	default:
+		return nil, fmt.Errorf("unknown event sink %q", kind)
+	}
+}
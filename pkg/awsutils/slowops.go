@@ -0,0 +1,148 @@
+package awsutils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// Service names used to label AWS operations and key slow thresholds
+const (
+	ServiceDynamoDB       = "dynamodb"
+	ServiceEventBridge    = "eventbridge"
+	ServiceSQS            = "sqs"
+	ServiceSecretsManager = "secretsmanager"
+	ServiceS3             = "s3"
+)
+
+// defaultSlowThresholds are the per-service durations past which a single
+// call is logged as slow
+var defaultSlowThresholds = map[string]time.Duration{
+	ServiceDynamoDB:       250 * time.Millisecond,
+	ServiceEventBridge:    500 * time.Millisecond,
+	ServiceSQS:            500 * time.Millisecond,
+	ServiceSecretsManager: time.Second,
+	ServiceS3:             time.Second,
+}
+
+// SlowOperationMonitor records the duration of AWS calls and logs a warning
+// for any call slower than its service's threshold. Nothing is logged until
+// a logger is set.
+type SlowOperationMonitor struct {
+	mu         sync.RWMutex
+	logger     *zap.Logger
+	thresholds map[string]time.Duration
+}
+
+// NewSlowOperationMonitor creates a monitor with the default thresholds
+func NewSlowOperationMonitor(logger *zap.Logger) *SlowOperationMonitor {
+	thresholds := make(map[string]time.Duration, len(defaultSlowThresholds))
+	for service, threshold := range defaultSlowThresholds {
+		thresholds[service] = threshold
+	}
+	return &SlowOperationMonitor{logger: logger, thresholds: thresholds}
+}
+
+// DefaultSlowOperations is the monitor used by the AWS helpers in this package
+var DefaultSlowOperations = NewSlowOperationMonitor(nil)
+
+// Configure sets the logger and overrides thresholds from spec, a
+// comma-separated list of service=duration entries such as
+// "dynamodb=100ms,eventbridge=1s". Services not in spec keep their threshold.
+func (m *SlowOperationMonitor) Configure(logger *zap.Logger, spec string) error {
+	thresholds, err := ParseSlowThresholds(spec)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logger = logger
+	for service, threshold := range thresholds {
+		m.thresholds[service] = threshold
+	}
+	return nil
+}
+
+// ConfigureSlowCallWarnings has DefaultSlowOperations warn through logger on
+// AWS calls slower than SLOW_AWS_THRESHOLDS, e.g.
+// "dynamodb=100ms,eventbridge=1s". An invalid setting is fatal.
+func ConfigureSlowCallWarnings(logger *zap.Logger) {
+	spec := os.Getenv("SLOW_AWS_THRESHOLDS")
+	if err := DefaultSlowOperations.Configure(logger, spec); err != nil {
+		logger.Fatal("invalid SLOW_AWS_THRESHOLDS", zap.String("value", spec), zap.Error(err))
+	}
+}
+
+// SetThreshold sets the slow threshold for service
+func (m *SlowOperationMonitor) SetThreshold(service string, threshold time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.thresholds[service] = threshold
+}
+
+// Threshold returns the slow threshold for service, or zero if it has none
+func (m *SlowOperationMonitor) Threshold(service string) time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.thresholds[service]
+}
+
+// Observe records an operation that took duration, warning if it was slow.
+// fields identify what the call touched, such as the table or queue.
+func (m *SlowOperationMonitor) Observe(service, operation string, duration time.Duration, fields ...zap.Field) {
+	metrics.AWSOperationDuration.WithLabelValues(service, operation).Observe(duration.Seconds())
+
+	m.mu.RLock()
+	logger, threshold := m.logger, m.thresholds[service]
+	m.mu.RUnlock()
+	if logger == nil || threshold <= 0 || duration <= threshold {
+		return
+	}
+
+	logger.Warn("slow AWS operation", append([]zap.Field{
+		zap.String("service", service),
+		zap.String("operation", operation),
+		zap.Duration("duration", duration),
+		zap.Duration("threshold", threshold),
+	}, fields...)...)
+}
+
+// observeSince records an operation started at start with the default
+// monitor. Deferred, it times the rest of the calling function.
+func observeSince(service, operation string, start time.Time, fields ...zap.Field) {
+	DefaultSlowOperations.Observe(service, operation, time.Since(start), fields...)
+}
+
+// ParseSlowThresholds parses a comma-separated list of service=duration
+// entries. An empty spec yields no thresholds.
+func ParseSlowThresholds(spec string) (map[string]time.Duration, error) {
+	thresholds := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		service, value, ok := strings.Cut(entry, "=")
+		service = strings.ToLower(strings.TrimSpace(service))
+		if !ok || service == "" {
+			return nil, fmt.Errorf("invalid slow threshold entry %q: want service=duration", entry)
+		}
+
+		threshold, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid slow threshold for %s: %w", service, err)
+		}
+		if threshold <= 0 {
+			return nil, fmt.Errorf("invalid slow threshold for %s: must be positive", service)
+		}
+		thresholds[service] = threshold
+	}
+	return thresholds, nil
+}
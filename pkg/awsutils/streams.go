@@ -0,0 +1,245 @@
+package awsutils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	wguevents "github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+)
+
+// StreamTableName returns the table name from a DynamoDB stream ARN such as
+// arn:aws:dynamodb:us-west-2:123456789012:table/Orders/stream/2024-01-01T00:00:00.000,
+// or "" if arn isn't one
+func StreamTableName(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[2] != "dynamodb" {
+		return ""
+	}
+	resource := strings.Split(parts[5], "/")
+	if len(resource) < 2 || resource[0] != "table" {
+		return ""
+	}
+	return resource[1]
+}
+
+// StreamRecordKey returns a stable string identifying the item a DynamoDB
+// stream record belongs to, built from its key attributes in name order.
+// Records for the same item always produce the same key.
+func StreamRecordKey(keys map[string]events.DynamoDBAttributeValue) string {
+	if len(keys) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte('|')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+
+		// Key attributes can only be strings, numbers or binary
+		value := keys[name]
+		switch value.DataType() {
+		case events.DataTypeString:
+			b.WriteString(value.String())
+		case events.DataTypeNumber:
+			b.WriteString(value.Number())
+		case events.DataTypeBinary:
+			b.WriteString(base64.StdEncoding.EncodeToString(value.Binary()))
+		}
+	}
+	return b.String()
+}
+
+// TypedKey is a key attribute with its DynamoDB type descriptor, "S", "N" or
+// "B", so a consumer can rebuild the exact key. Numbers keep their original
+// text and binary values are base64 encoded.
+type TypedKey struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// StreamTypedKeys returns the key attributes of a stream record with their
+// types. Attributes of other types, which can't be key attributes, are left
+// out.
+func StreamTypedKeys(keys map[string]events.DynamoDBAttributeValue) map[string]TypedKey {
+	typed := make(map[string]TypedKey, len(keys))
+	for name, value := range keys {
+		switch value.DataType() {
+		case events.DataTypeString:
+			typed[name] = TypedKey{Type: "S", Value: value.String()}
+		case events.DataTypeNumber:
+			typed[name] = TypedKey{Type: "N", Value: value.Number()}
+		case events.DataTypeBinary:
+			typed[name] = TypedKey{Type: "B", Value: base64.StdEncoding.EncodeToString(value.Binary())}
+		}
+	}
+	return typed
+}
+
+// AttributeValueTypedKeys returns a DynamoDB key, such as a LastEvaluatedKey,
+// as typed keys
+func AttributeValueTypedKeys(key map[string]types.AttributeValue) (map[string]TypedKey, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+	typed := make(map[string]TypedKey, len(key))
+	for name, value := range key {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			typed[name] = TypedKey{Type: "S", Value: v.Value}
+		case *types.AttributeValueMemberN:
+			typed[name] = TypedKey{Type: "N", Value: v.Value}
+		case *types.AttributeValueMemberB:
+			typed[name] = TypedKey{Type: "B", Value: base64.StdEncoding.EncodeToString(v.Value)}
+		default:
+			return nil, fmt.Errorf("key attribute %s: unsupported type %T", name, value)
+		}
+	}
+	return typed, nil
+}
+
+// TypedKeyAttributeValues rebuilds a DynamoDB key from typed keys, for
+// GetItem and the like
+func TypedKeyAttributeValues(keys map[string]TypedKey) (map[string]types.AttributeValue, error) {
+	key := make(map[string]types.AttributeValue, len(keys))
+	for name, typed := range keys {
+		switch typed.Type {
+		case "S":
+			key[name] = &types.AttributeValueMemberS{Value: typed.Value}
+		case "N":
+			key[name] = &types.AttributeValueMemberN{Value: typed.Value}
+		case "B":
+			value, err := base64.StdEncoding.DecodeString(typed.Value)
+			if err != nil {
+				return nil, fmt.Errorf("key attribute %s: invalid binary value: %w", name, err)
+			}
+			key[name] = &types.AttributeValueMemberB{Value: value}
+		default:
+			return nil, fmt.Errorf("key attribute %s: unsupported type %q", name, typed.Type)
+		}
+	}
+	return key, nil
+}
+
+// IsNoOpModify reports whether a MODIFY record left the item unchanged, with
+// identical old and new images. Records without both images, such as those
+// from KEYS_ONLY streams, are never treated as no-ops since the change can't
+// be seen.
+func IsNoOpModify(record events.DynamoDBEventRecord) bool {
+	change := record.Change
+	if record.EventName != "MODIFY" || len(change.OldImage) == 0 || len(change.NewImage) == 0 {
+		return false
+	}
+	return wguevents.SameContent(change.OldImage, change.NewImage)
+}
+
+// DefaultMaxStreamAttributeDepth is how deeply nested lists and maps
+// StreamImageToMap converts by default
+const DefaultMaxStreamAttributeDepth = 32
+
+var maxStreamAttributeDepth atomic.Int64
+
+func init() {
+	maxStreamAttributeDepth.Store(DefaultMaxStreamAttributeDepth)
+}
+
+// SetMaxStreamAttributeDepth sets how deeply nested lists and maps
+// StreamImageToMap converts, the top-level attributes being depth 1. Zero or
+// less restores the default.
+func SetMaxStreamAttributeDepth(depth int) {
+	if depth <= 0 {
+		depth = DefaultMaxStreamAttributeDepth
+	}
+	maxStreamAttributeDepth.Store(int64(depth))
+}
+
+// StreamImageToMap converts stream record attributes to plain values, dropping
+// DynamoDB's type descriptors. Numbers become json.Number so they keep their
+// precision, binary becomes []byte, and lists, maps and sets become slices and
+// maps of converted values. Values nested deeper than the maximum depth are
+// truncated to nil, and counted in metrics.AttributeMaxDepthExceeded, rather
+// than recursed into without bound.
+func StreamImageToMap(attrs map[string]events.DynamoDBAttributeValue) map[string]interface{} {
+	c := streamConverter{maxDepth: int(maxStreamAttributeDepth.Load())}
+	result := c.convertMap(attrs, 1)
+	if c.truncated {
+		metrics.AttributeMaxDepthExceeded.Inc()
+	}
+	return result
+}
+
+// streamConverter converts stream attributes down to maxDepth, noting when
+// it truncates
+type streamConverter struct {
+	maxDepth  int
+	truncated bool
+}
+
+// convertMap converts attributes at depth
+func (c *streamConverter) convertMap(attrs map[string]events.DynamoDBAttributeValue, depth int) map[string]interface{} {
+	if attrs == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(attrs))
+	for name, value := range attrs {
+		result[name] = c.convert(value, depth)
+	}
+	return result
+}
+
+// convert converts one stream attribute at depth to a plain value
+func (c *streamConverter) convert(value events.DynamoDBAttributeValue, depth int) interface{} {
+	if depth > c.maxDepth {
+		c.truncated = true
+		return nil
+	}
+
+	switch value.DataType() {
+	case events.DataTypeString:
+		return value.String()
+	case events.DataTypeNumber:
+		return json.Number(value.Number())
+	case events.DataTypeBinary:
+		return value.Binary()
+	case events.DataTypeBoolean:
+		return value.Boolean()
+	case events.DataTypeNull:
+		return nil
+	case events.DataTypeList:
+		list := value.List()
+		items := make([]interface{}, len(list))
+		for i, item := range list {
+			items[i] = c.convert(item, depth+1)
+		}
+		return items
+	case events.DataTypeMap:
+		return c.convertMap(value.Map(), depth+1)
+	case events.DataTypeStringSet:
+		return value.StringSet()
+	case events.DataTypeNumberSet:
+		set := value.NumberSet()
+		numbers := make([]json.Number, len(set))
+		for i, n := range set {
+			numbers[i] = json.Number(n)
+		}
+		return numbers
+	case events.DataTypeBinarySet:
+		return value.BinarySet()
+	}
+	return nil
+}
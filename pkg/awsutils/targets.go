@@ -0,0 +1,99 @@
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"go.uber.org/zap"
+)
+
+// EventBridgeTargetAPI is the part of the EventBridge client used to attach
+// targets to rules
+type EventBridgeTargetAPI interface {
+	PutTargets(ctx context.Context, params *eventbridge.PutTargetsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutTargetsOutput, error)
+}
+
+// TargetRetryPolicy bounds how long EventBridge keeps retrying a failed
+// delivery. A zero MaxEventAge leaves EventBridge's default of 24 hours.
+type TargetRetryPolicy struct {
+	MaxAttempts int32
+	MaxEventAge time.Duration
+}
+
+// RuleTarget is a target to attach to a rule. Events EventBridge gives up
+// delivering go to the SQS queue DeadLetterARN; without one they are dropped.
+// A nil Retry leaves EventBridge's default retry policy.
+type RuleTarget struct {
+	ID            string
+	ARN           string
+	RoleARN       string
+	DeadLetterARN string
+	Retry         *TargetRetryPolicy
+}
+
+// PutRuleTargets attaches targets to rule on eventBus. Targets without their
+// own DeadLetterARN use defaultDeadLetterARN, if set.
+func PutRuleTargets(ctx context.Context, client EventBridgeTargetAPI, eventBus, rule, defaultDeadLetterARN string, targets []RuleTarget) error {
+	start := time.Now()
+	output, err := client.PutTargets(ctx, buildPutTargetsInput(eventBus, rule, defaultDeadLetterARN, targets))
+	observeSince(ServiceEventBridge, "PutTargets", start,
+		zap.String("event_bus", eventBus),
+		zap.String("rule", rule))
+	if err != nil {
+		return fmt.Errorf("failed to put targets for rule %s: %w", rule, err)
+	}
+
+	if output.FailedEntryCount > 0 {
+		failures := make([]string, 0, len(output.FailedEntries))
+		for _, entry := range output.FailedEntries {
+			failures = append(failures, fmt.Sprintf("%s (%s: %s)",
+				aws.ToString(entry.TargetId),
+				aws.ToString(entry.ErrorCode),
+				aws.ToString(entry.ErrorMessage)))
+		}
+		return fmt.Errorf("failed to put %d targets for rule %s: %s", output.FailedEntryCount, rule, strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// buildPutTargetsInput converts targets to the PutTargets request
+func buildPutTargetsInput(eventBus, rule, defaultDeadLetterARN string, targets []RuleTarget) *eventbridge.PutTargetsInput {
+	input := &eventbridge.PutTargetsInput{
+		EventBusName: aws.String(eventBus),
+		Rule:         aws.String(rule),
+		Targets:      make([]types.Target, 0, len(targets)),
+	}
+
+	for _, target := range targets {
+		t := types.Target{
+			Id:  aws.String(target.ID),
+			Arn: aws.String(target.ARN),
+		}
+		if target.RoleARN != "" {
+			t.RoleArn = aws.String(target.RoleARN)
+		}
+
+		deadLetterARN := target.DeadLetterARN
+		if deadLetterARN == "" {
+			deadLetterARN = defaultDeadLetterARN
+		}
+		if deadLetterARN != "" {
+			t.DeadLetterConfig = &types.DeadLetterConfig{Arn: aws.String(deadLetterARN)}
+		}
+
+		if target.Retry != nil {
+			t.RetryPolicy = &types.RetryPolicy{MaximumRetryAttempts: aws.Int32(target.Retry.MaxAttempts)}
+			if target.Retry.MaxEventAge > 0 {
+				t.RetryPolicy.MaximumEventAgeInSeconds = aws.Int32(int32(target.Retry.MaxEventAge / time.Second))
+			}
+		}
+
+		input.Targets = append(input.Targets, t)
+	}
+	return input
+}
@@ -0,0 +1,106 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"runtime/debug"
+	"sync"
+)
+
+// PanicError is returned for an item whose fn panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Process calls fn for every index in [0, n) using up to workers goroutines
+// and returns each item's error, indexed like the input. Items that share a
+// non-empty key are handed to the same worker in input order, so per-key
+// ordering is preserved. Each call gets its own context derived from ctx.
+func Process(ctx context.Context, n, workers int, key func(i int) string, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	if n == 0 {
+		return errs
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	// Sequential fast path keeps the original single-goroutine behavior
+	if workers == 1 {
+		for i := 0; i < n; i++ {
+			errs[i] = call(ctx, i, fn)
+		}
+		return errs
+	}
+
+	queues := make([]chan int, workers)
+	for w := range queues {
+		queues[w] = make(chan int, n)
+	}
+
+	var wg sync.WaitGroup
+	for w := range queues {
+		wg.Add(1)
+		go func(queue <-chan int) {
+			defer wg.Done()
+			for i := range queue {
+				errs[i] = call(ctx, i, fn)
+			}
+		}(queues[w])
+	}
+
+	next := 0
+	for i := 0; i < n; i++ {
+		var w int
+		if k := keyOf(key, i); k != "" {
+			w = shard(k, workers)
+		} else {
+			// Unkeyed items are spread round-robin
+			w = next
+			next = (next + 1) % workers
+		}
+		queues[w] <- i
+	}
+	for _, queue := range queues {
+		close(queue)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// call runs fn for one item with a context scoped to that item. A panic in fn
+// is recovered into a *PanicError so it fails only that item.
+func call(ctx context.Context, i int, fn func(ctx context.Context, i int) error) (err error) {
+	itemCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(itemCtx, i)
+}
+
+func keyOf(key func(i int) string, i int) string {
+	if key == nil {
+		return ""
+	}
+	return key(i)
+}
+
+// shard maps a key to a worker index
+func shard(key string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
@@ -0,0 +1,156 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcess_AllItemsProcessed(t *testing.T) {
+	const n = 50
+
+	var processed int64
+	seen := make([]int32, n)
+
+	errs := Process(context.Background(), n, 10, nil, func(ctx context.Context, i int) error {
+		atomic.AddInt64(&processed, 1)
+		atomic.AddInt32(&seen[i], 1)
+		if i%7 == 0 {
+			return fmt.Errorf("item %d failed", i)
+		}
+		return nil
+	})
+
+	assert.Equal(t, int64(n), processed)
+	assert.Len(t, errs, n)
+	for i := 0; i < n; i++ {
+		assert.Equal(t, int32(1), seen[i], "item %d processed more than once", i)
+		if i%7 == 0 {
+			assert.EqualError(t, errs[i], fmt.Sprintf("item %d failed", i))
+		} else {
+			assert.NoError(t, errs[i])
+		}
+	}
+}
+
+func TestProcess_RunsConcurrently(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	Process(context.Background(), 20, 5, nil, func(ctx context.Context, i int) error {
+		current := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return nil
+	})
+
+	assert.Greater(t, maxInFlight, int32(1))
+	assert.LessOrEqual(t, maxInFlight, int32(5))
+}
+
+func TestProcess_PreservesPerKeyOrder(t *testing.T) {
+	const n = 60
+	keys := []string{"a", "b", "c"}
+
+	var mu sync.Mutex
+	order := make(map[string][]int)
+
+	Process(context.Background(), n, 8, func(i int) string {
+		return keys[i%len(keys)]
+	}, func(ctx context.Context, i int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		key := keys[i%len(keys)]
+		order[key] = append(order[key], i)
+		return nil
+	})
+
+	for _, key := range keys {
+		indexes := order[key]
+		assert.Len(t, indexes, n/len(keys))
+		for j := 1; j < len(indexes); j++ {
+			assert.Less(t, indexes[j-1], indexes[j], "key %s processed out of order", key)
+		}
+	}
+}
+
+func TestProcess_PerItemContext(t *testing.T) {
+	type ctxKey struct{}
+	parent := context.WithValue(context.Background(), ctxKey{}, "handler")
+
+	var mu sync.Mutex
+	var contexts []context.Context
+
+	Process(parent, 4, 2, nil, func(ctx context.Context, i int) error {
+		assert.Equal(t, "handler", ctx.Value(ctxKey{}))
+		mu.Lock()
+		contexts = append(contexts, ctx)
+		mu.Unlock()
+		return nil
+	})
+
+	// Item contexts are released once their item finishes
+	for _, ctx := range contexts {
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	}
+	assert.NoError(t, parent.Err())
+}
+
+func TestProcess_Sequential(t *testing.T) {
+	var order []int
+	errs := Process(context.Background(), 5, 0, nil, func(ctx context.Context, i int) error {
+		order = append(order, i)
+		if i == 3 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+	assert.Error(t, errs[3])
+}
+
+func TestProcess_Empty(t *testing.T) {
+	errs := Process(context.Background(), 0, 10, nil, func(ctx context.Context, i int) error {
+		t.Fatal("fn should not be called")
+		return nil
+	})
+	assert.Empty(t, errs)
+}
+
+func TestProcess_RecoversPanics(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			errs := Process(context.Background(), 8, workers, nil, func(ctx context.Context, i int) error {
+				if i == 5 {
+					var payload map[string]interface{}
+					_ = payload["id"].(string)
+				}
+				return nil
+			})
+
+			for i, err := range errs {
+				if i != 5 {
+					assert.NoError(t, err)
+					continue
+				}
+				var panicErr *PanicError
+				if assert.ErrorAs(t, err, &panicErr) {
+					assert.Contains(t, panicErr.Error(), "interface conversion")
+					assert.Contains(t, string(panicErr.Stack), "batch.TestProcess_RecoversPanics")
+				}
+			}
+		})
+	}
+}
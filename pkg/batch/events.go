@@ -0,0 +1,74 @@
+package batch
+
+import (
+	"context"
+
+	"github.com/wgu/go-performance-enablement/pkg/events"
+)
+
+// Mode selects how a BatchProcessor schedules the events of a batch
+type Mode int
+
+const (
+	// ModeConcurrent processes events in parallel for the most throughput,
+	// with no ordering between them
+	ModeConcurrent Mode = iota
+	// ModeOrdered processes events one at a time in batch order, for batches
+	// carrying ordered events for the same entity
+	ModeOrdered
+)
+
+// String returns the mode's name
+func (m Mode) String() string {
+	switch m {
+	case ModeConcurrent:
+		return "concurrent"
+	case ModeOrdered:
+		return "ordered"
+	default:
+		return "unknown"
+	}
+}
+
+// EventFunc processes one event of a batch
+type EventFunc func(ctx context.Context, event *events.BaseEvent) error
+
+// BatchProcessor processes the events of an events.EventBatch
+type BatchProcessor struct {
+	workers      int
+	mode         Mode
+	maxBatchSize int
+}
+
+// NewBatchProcessor creates a processor running up to workers events at a
+// time in concurrent mode. Ordered mode always uses one.
+func NewBatchProcessor(workers int, mode Mode) *BatchProcessor {
+	return &BatchProcessor{
+		workers: workers,
+		mode:    mode,
+	}
+}
+
+// SetMaxBatchSize sets the most events a batch may carry. Zero, the default,
+// uses events.DefaultMaxBatchSize.
+func (p *BatchProcessor) SetMaxBatchSize(n int) {
+	p.maxBatchSize = n
+}
+
+// Process calls fn for every event in b and returns each event's error,
+// indexed like b.Events, in either mode. A batch that fails validation is
+// rejected with an error wrapping events.ErrInvalidBatch, and none of its
+// events are processed.
+func (p *BatchProcessor) Process(ctx context.Context, b *events.EventBatch, fn EventFunc) ([]error, error) {
+	if err := b.Validate(p.maxBatchSize); err != nil {
+		return nil, err
+	}
+
+	workers := p.workers
+	if p.mode == ModeOrdered {
+		workers = 1
+	}
+	return Process(ctx, len(b.Events), workers, nil, func(ctx context.Context, i int) error {
+		return fn(ctx, &b.Events[i])
+	}), nil
+}
@@ -0,0 +1,140 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+)
+
+func newTestEventBatch(n int) *events.EventBatch {
+	b := &events.EventBatch{BatchID: "batch-1", Size: n}
+	for i := 0; i < n; i++ {
+		b.Events = append(b.Events, events.BaseEvent{
+			EventID:      fmt.Sprintf("event-%d", i),
+			EventType:    "test.event",
+			SourceRegion: "us-west-2",
+		})
+	}
+	return b
+}
+
+// span records when an event's processing started and finished
+type span struct {
+	start, end time.Time
+}
+
+// timedEventFunc sleeps for each event, recording its span and the order
+// events started in, and fails every third event
+func timedEventFunc(mu *sync.Mutex, order *[]string, spans map[string]span) EventFunc {
+	return func(ctx context.Context, event *events.BaseEvent) error {
+		start := time.Now()
+		mu.Lock()
+		*order = append(*order, event.EventID)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		spans[event.EventID] = span{start: start, end: time.Now()}
+		mu.Unlock()
+
+		var i int
+		fmt.Sscanf(event.EventID, "event-%d", &i)
+		if i%3 == 0 {
+			return fmt.Errorf("%s failed", event.EventID)
+		}
+		return nil
+	}
+}
+
+func assertPerIndexResults(t *testing.T, b *events.EventBatch, errs []error) {
+	t.Helper()
+	assert.Len(t, errs, len(b.Events))
+	for i, err := range errs {
+		if i%3 == 0 {
+			assert.EqualError(t, err, fmt.Sprintf("event-%d failed", i))
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestBatchProcessor_Ordered(t *testing.T) {
+	b := newTestEventBatch(6)
+	var mu sync.Mutex
+	var order []string
+	spans := make(map[string]span)
+
+	errs, err := NewBatchProcessor(4, ModeOrdered).Process(context.Background(), b, timedEventFunc(&mu, &order, spans))
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"event-0", "event-1", "event-2", "event-3", "event-4", "event-5"}, order)
+	// Each event starts only after the previous one finished
+	for i := 1; i < len(b.Events); i++ {
+		previous, current := spans[b.Events[i-1].EventID], spans[b.Events[i].EventID]
+		assert.False(t, current.start.Before(previous.end), "event %d overlapped event %d", i, i-1)
+	}
+	assertPerIndexResults(t, b, errs)
+}
+
+func TestBatchProcessor_Concurrent(t *testing.T) {
+	b := newTestEventBatch(6)
+	var mu sync.Mutex
+	var order []string
+	spans := make(map[string]span)
+
+	errs, err := NewBatchProcessor(6, ModeConcurrent).Process(context.Background(), b, timedEventFunc(&mu, &order, spans))
+	assert.NoError(t, err)
+
+	assert.Len(t, order, len(b.Events))
+	// With a worker per event, every event starts before any finishes
+	var lastStart, firstEnd time.Time
+	for _, s := range spans {
+		if s.start.After(lastStart) {
+			lastStart = s.start
+		}
+		if firstEnd.IsZero() || s.end.Before(firstEnd) {
+			firstEnd = s.end
+		}
+	}
+	assert.True(t, lastStart.Before(firstEnd), "events did not overlap")
+	assertPerIndexResults(t, b, errs)
+}
+
+func TestBatchProcessor_EmptyBatch(t *testing.T) {
+	errs, err := NewBatchProcessor(4, ModeConcurrent).Process(context.Background(), &events.EventBatch{}, func(ctx context.Context, event *events.BaseEvent) error {
+		t.Fatal("fn should not be called")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+}
+
+func TestBatchProcessor_RejectsInvalidBatch(t *testing.T) {
+	p := NewBatchProcessor(4, ModeConcurrent)
+	p.SetMaxBatchSize(3)
+	fn := func(ctx context.Context, event *events.BaseEvent) error {
+		t.Fatal("fn should not be called")
+		return nil
+	}
+
+	errs, err := p.Process(context.Background(), newTestEventBatch(4), fn)
+	assert.ErrorIs(t, err, events.ErrInvalidBatch)
+	assert.Nil(t, errs)
+
+	mismatched := newTestEventBatch(2)
+	mismatched.Size = 5
+	_, err = p.Process(context.Background(), mismatched, fn)
+	assert.ErrorIs(t, err, events.ErrInvalidBatch)
+}
+
+func TestMode_String(t *testing.T) {
+	assert.Equal(t, "concurrent", ModeConcurrent.String())
+	assert.Equal(t, "ordered", ModeOrdered.String())
+	assert.Equal(t, "unknown", Mode(99).String())
+}
@@ -0,0 +1,240 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// halfOpenSuccesses is the number of successful trials that close a half-open breaker
+const halfOpenSuccesses = 2
+
+// maxHalfOpenProbes bounds the trial calls a half-open breaker runs at once;
+// calls beyond it are rejected with ErrOpen so a recovering backend doesn't
+// get the full load at once
+const maxHalfOpenProbes = halfOpenSuccesses
+
+// ErrOpen is returned by Execute while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker implements the circuit breaker pattern
+type CircuitBreaker struct {
+	service           string
+	region            string
+	maxFailures       int
+	timeout           time.Duration
+	state             string
+	failureCount      int
+	successCount      int
+	consecutiveErrors int
+	probes            int
+	lastFailure       time.Time
+	lastStateChange   time.Time
+	openedAt          time.Time
+	now               func() time.Time
+	logger            *zap.Logger
+	mu                sync.RWMutex
+}
+
+// New creates a circuit breaker for calls to service, labeling its metrics
+// with region, and registers it with DefaultRegistry. It opens after
+// maxFailures failures and, once timeout has passed, lets a few trial calls
+// through at a time.
+func New(service, region string, maxFailures int, timeout time.Duration, logger *zap.Logger) *CircuitBreaker {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	cb := &CircuitBreaker{
+		service:         service,
+		region:          region,
+		maxFailures:     maxFailures,
+		timeout:         timeout,
+		state:           events.CircuitBreakerClosed,
+		lastStateChange: time.Now(),
+		now:             time.Now,
+		logger:          logger.With(zap.String("service", service), zap.String("region", region)),
+	}
+	DefaultRegistry.Register(cb)
+	return cb
+}
+
+// Name identifies the breaker in a Registry as "service/region"
+func (cb *CircuitBreaker) Name() string {
+	if cb.region == "" {
+		return cb.service
+	}
+	return cb.service + "/" + cb.region
+}
+
+// Execute runs the function through the circuit breaker. The breaker isn't
+// locked while fn runs, so concurrent calls run in parallel and state checks
+// don't wait on them.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	probe, err := cb.allow()
+	if err != nil {
+		return err
+	}
+
+	// Execute function
+	err = fn()
+
+	cb.record(err, probe)
+	return err
+}
+
+// allow decides whether a call may run, moving an open breaker whose timeout
+// has passed to half-open. It returns ErrOpen if the call may not run, and
+// whether it runs as a half-open trial call.
+func (cb *CircuitBreaker) allow() (bool, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	defer cb.recordOpenDuration()
+
+	// Check if circuit is open
+	if cb.state == events.CircuitBreakerOpen {
+		if cb.now().Sub(cb.lastStateChange) > cb.timeout {
+			// Transition to half-open
+			cb.state = events.CircuitBreakerHalfOpen
+			cb.successCount = 0
+			cb.lastStateChange = cb.now()
+			metrics.SetCircuitBreakerState(cb.service, cb.region, cb.state)
+			cb.logger.Info("circuit breaker transitioning to half-open")
+		} else {
+			return false, ErrOpen
+		}
+	}
+
+	if cb.state == events.CircuitBreakerHalfOpen {
+		if cb.probes >= maxHalfOpenProbes {
+			return false, ErrOpen
+		}
+		cb.probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+// record updates the breaker with the outcome of a call, probe saying whether
+// it ran as a half-open trial call
+func (cb *CircuitBreaker) record(err error, probe bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	defer cb.recordOpenDuration()
+
+	if probe {
+		cb.probes--
+	}
+
+	if err != nil {
+		cb.failureCount++
+		cb.consecutiveErrors++
+		cb.lastFailure = cb.now()
+		metrics.CircuitBreakerFailures.WithLabelValues(cb.service, cb.region).Inc()
+
+		if cb.state == events.CircuitBreakerHalfOpen {
+			// Go back to open on any failure in half-open
+			cb.state = events.CircuitBreakerOpen
+			cb.lastStateChange = cb.now()
+			metrics.SetCircuitBreakerState(cb.service, cb.region, cb.state)
+			cb.logger.Warn("circuit breaker opened",
+				zap.Int("failure_count", cb.failureCount),
+			)
+		} else if cb.state == events.CircuitBreakerClosed && cb.failureCount >= cb.maxFailures {
+			// Open circuit
+			cb.state = events.CircuitBreakerOpen
+			cb.lastStateChange = cb.now()
+			cb.openedAt = cb.lastStateChange
+			metrics.SetCircuitBreakerState(cb.service, cb.region, cb.state)
+			cb.logger.Warn("circuit breaker opened",
+				zap.Int("failure_count", cb.failureCount),
+			)
+		}
+		return
+	}
+
+	// Success
+	cb.successCount++
+	cb.consecutiveErrors = 0
+
+	if cb.state == events.CircuitBreakerHalfOpen {
+		// After successful attempts in half-open, close circuit
+		if cb.successCount >= halfOpenSuccesses {
+			cb.state = events.CircuitBreakerClosed
+			cb.failureCount = 0
+			cb.lastStateChange = cb.now()
+			metrics.SetCircuitBreakerState(cb.service, cb.region, cb.state)
+			metrics.CircuitBreakerRecoveries.WithLabelValues(cb.service, cb.region).Inc()
+			cb.logger.Info("circuit breaker closed",
+				zap.Duration("open_duration", cb.lastStateChange.Sub(cb.openedAt)),
+			)
+			cb.openedAt = time.Time{}
+		}
+	}
+}
+
+// GetState returns the current circuit breaker state
+func (cb *CircuitBreaker) GetState() string {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	cb.recordOpenDuration()
+	return cb.state
+}
+
+// Allows reports whether Execute would run a call now: the breaker is closed,
+// half-open with a trial call to spare, or has been open longer than its
+// timeout
+func (cb *CircuitBreaker) Allows() bool {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	switch cb.state {
+	case events.CircuitBreakerOpen:
+		return cb.now().Sub(cb.lastStateChange) > cb.timeout
+	case events.CircuitBreakerHalfOpen:
+		return cb.probes < maxHalfOpenProbes
+	}
+	return true
+}
+
+// Snapshot returns the breaker's current state and counters
+func (cb *CircuitBreaker) Snapshot() events.CircuitBreakerState {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+
+	snapshot := events.CircuitBreakerState{
+		State:             cb.state,
+		FailureCount:      cb.failureCount,
+		SuccessCount:      cb.successCount,
+		LastFailureTime:   cb.lastFailure,
+		LastStateChange:   cb.lastStateChange,
+		ConsecutiveErrors: cb.consecutiveErrors,
+	}
+	if cb.state == events.CircuitBreakerOpen {
+		snapshot.NextRetryTime = cb.lastStateChange.Add(cb.timeout)
+	}
+	return snapshot
+}
+
+// OpenDuration returns how long the breaker has been continuously open,
+// counting half-open trials, or zero while it is closed
+func (cb *CircuitBreaker) OpenDuration() time.Duration {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	return cb.openDuration()
+}
+
+// openDuration is OpenDuration for callers holding cb.mu
+func (cb *CircuitBreaker) openDuration() time.Duration {
+	if cb.openedAt.IsZero() {
+		return 0
+	}
+	return cb.now().Sub(cb.openedAt)
+}
+
+// recordOpenDuration publishes the open duration gauge
+func (cb *CircuitBreaker) recordOpenDuration() {
+	metrics.CircuitBreakerOpenSeconds.WithLabelValues(cb.service, cb.region).Set(cb.openDuration().Seconds())
+}
@@ -0,0 +1,604 @@
+package circuitbreaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+)
+
+const testRegion = "us-west-2"
+
+func newTestBreaker(maxFailures int, timeout time.Duration) *CircuitBreaker {
+	return New("cross-region", testRegion, maxFailures, timeout, nil)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxFailures int
+		timeout     time.Duration
+	}{
+		{
+			name:        "standard config",
+			maxFailures: 5,
+			timeout:     30 * time.Second,
+		},
+		{
+			name:        "aggressive config",
+			maxFailures: 3,
+			timeout:     10 * time.Second,
+		},
+		{
+			name:        "lenient config",
+			maxFailures: 10,
+			timeout:     60 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := newTestBreaker(tt.maxFailures, tt.timeout)
+
+			assert.NotNil(t, cb)
+			assert.Equal(t, tt.maxFailures, cb.maxFailures)
+			assert.Equal(t, tt.timeout, cb.timeout)
+			assert.Equal(t, events.CircuitBreakerClosed, cb.state)
+			assert.Equal(t, 0, cb.failureCount)
+			assert.Equal(t, 0, cb.successCount)
+		})
+	}
+}
+
+func TestCircuitBreaker_GetState(t *testing.T) {
+	cb := newTestBreaker(5, 30*time.Second)
+
+	state := cb.GetState()
+	assert.Equal(t, events.CircuitBreakerClosed, state)
+}
+
+func TestCircuitBreaker_Execute_SuccessPath(t *testing.T) {
+	cb := newTestBreaker(5, 30*time.Second)
+
+	// Test successful execution
+	err := cb.Execute(func() error {
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	assert.Equal(t, 0, cb.failureCount)
+	assert.Equal(t, 1, cb.successCount)
+}
+
+func TestCircuitBreaker_Execute_FailureAccumulation(t *testing.T) {
+	cb := newTestBreaker(3, 30*time.Second)
+
+	// Cause failures but not enough to open circuit
+	for i := 0; i < 2; i++ {
+		err := cb.Execute(func() error {
+			return assert.AnError
+		})
+		assert.Error(t, err)
+		assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	}
+
+	assert.Equal(t, 2, cb.failureCount)
+
+	// One more failure should open the circuit
+	err := cb.Execute(func() error {
+		return assert.AnError
+	})
+	assert.Error(t, err)
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState())
+	assert.Equal(t, 3, cb.failureCount)
+}
+
+func TestCircuitBreaker_Execute_OpenCircuit(t *testing.T) {
+	cb := newTestBreaker(2, 100*time.Millisecond)
+
+	// Open the circuit
+	for i := 0; i < 2; i++ {
+		_ = cb.Execute(func() error {
+			return assert.AnError
+		})
+	}
+
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState())
+
+	// Circuit should reject calls when open
+	err := cb.Execute(func() error {
+		t.Error("Function should not be called when circuit is open")
+		return nil
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "circuit breaker is open")
+}
+
+func TestCircuitBreaker_Execute_HalfOpenTransition(t *testing.T) {
+	cb := newTestBreaker(2, 100*time.Millisecond)
+
+	// Open the circuit
+	for i := 0; i < 2; i++ {
+		_ = cb.Execute(func() error {
+			return assert.AnError
+		})
+	}
+
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState())
+
+	// Wait for timeout
+	time.Sleep(150 * time.Millisecond)
+
+	// Next call should transition to half-open
+	callCount := 0
+	err := cb.Execute(func() error {
+		callCount++
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, callCount, "Function should be called once in half-open state")
+	assert.Equal(t, events.CircuitBreakerHalfOpen, cb.GetState())
+}
+
+func TestCircuitBreaker_Execute_HalfOpenToClosedTransition(t *testing.T) {
+	cb := newTestBreaker(2, 50*time.Millisecond)
+
+	// Open the circuit
+	for i := 0; i < 2; i++ {
+		_ = cb.Execute(func() error {
+			return assert.AnError
+		})
+	}
+
+	// Wait for timeout and transition to half-open
+	time.Sleep(100 * time.Millisecond)
+
+	// First successful call in half-open
+	err := cb.Execute(func() error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, events.CircuitBreakerHalfOpen, cb.GetState())
+
+	// Second successful call should close the circuit
+	err = cb.Execute(func() error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	assert.Equal(t, 0, cb.failureCount)
+}
+
+func TestCircuitBreaker_Execute_HalfOpenToOpenTransition(t *testing.T) {
+	cb := newTestBreaker(2, 50*time.Millisecond)
+
+	// Open the circuit
+	for i := 0; i < 2; i++ {
+		_ = cb.Execute(func() error {
+			return assert.AnError
+		})
+	}
+
+	// Wait for timeout and transition to half-open
+	time.Sleep(100 * time.Millisecond)
+
+	// Failure in half-open should immediately open circuit
+	err := cb.Execute(func() error {
+		return assert.AnError
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState())
+}
+
+func TestCircuitBreaker_HalfOpenBoundsTrialCalls(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	cb := newTestBreaker(1, 30*time.Second)
+	cb.now = clock.Now
+	_ = cb.Execute(func() error { return assert.AnError })
+	clock.Advance(31 * time.Second)
+
+	// Hold the trial calls in flight
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, maxHalfOpenProbes)
+	for i := 0; i < maxHalfOpenProbes; i++ {
+		go func() {
+			done <- cb.Execute(func() error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+		<-started
+	}
+
+	// Further calls are rejected while the trials run
+	called := false
+	err := cb.Execute(func() error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.False(t, called)
+	assert.False(t, cb.Allows())
+	assert.Equal(t, events.CircuitBreakerHalfOpen, cb.GetState())
+
+	close(release)
+	for i := 0; i < maxHalfOpenProbes; i++ {
+		assert.NoError(t, <-done)
+	}
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	assert.NoError(t, cb.Execute(func() error { return nil }))
+}
+
+func TestCircuitBreaker_HalfOpenFreesFinishedTrials(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	cb := newTestBreaker(1, 30*time.Second)
+	cb.now = clock.Now
+	_ = cb.Execute(func() error { return assert.AnError })
+	clock.Advance(31 * time.Second)
+
+	// A failed trial reopens the breaker and frees its slot for the next round
+	assert.Error(t, cb.Execute(func() error { return assert.AnError }))
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState())
+
+	clock.Advance(31 * time.Second)
+	for i := 0; i < halfOpenSuccesses; i++ {
+		assert.NoError(t, cb.Execute(func() error { return nil }))
+	}
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	assert.Equal(t, 0, cb.probes)
+}
+
+func TestCircuitBreaker_Concurrency(t *testing.T) {
+	cb := newTestBreaker(10, 30*time.Second)
+
+	// Test that circuit breaker is thread-safe
+	done := make(chan bool, 10)
+
+	for i := 0; i < 10; i++ {
+		go func() {
+			_ = cb.Execute(func() error {
+				time.Sleep(1 * time.Millisecond)
+				return nil
+			})
+			done <- true
+		}()
+	}
+
+	// Wait for all goroutines
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	assert.Equal(t, 10, cb.successCount)
+}
+
+func TestCircuitBreaker_ExecuteRunsCallsInParallel(t *testing.T) {
+	cb := newTestBreaker(10, 30*time.Second)
+
+	// Each call waits for the other to start, which deadlocks if the breaker
+	// is locked while a call runs
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- cb.Execute(func() error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("calls did not run in parallel")
+		}
+	}
+
+	// State checks don't wait on calls in flight
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	assert.Equal(t, 0, cb.Snapshot().SuccessCount)
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, <-done)
+	}
+	assert.Equal(t, 2, cb.Snapshot().SuccessCount)
+}
+
+func TestCircuitBreaker_StateTransitions(t *testing.T) {
+	// Test complete state machine: Closed -> Open -> Half-Open -> Closed
+	cb := newTestBreaker(2, 50*time.Millisecond)
+
+	// Initial state: Closed
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+
+	// Cause failures to open circuit
+	_ = cb.Execute(func() error { return assert.AnError })
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState()) // Still closed after 1 failure
+
+	_ = cb.Execute(func() error { return assert.AnError })
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState()) // Now open after 2 failures
+
+	// Try to execute while open (should fail immediately)
+	err := cb.Execute(func() error {
+		t.Error("Should not execute when circuit is open")
+		return nil
+	})
+	assert.Error(t, err)
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState())
+
+	// Wait for timeout
+	time.Sleep(100 * time.Millisecond)
+
+	// Execute should transition to half-open
+	_ = cb.Execute(func() error { return nil })
+	assert.Equal(t, events.CircuitBreakerHalfOpen, cb.GetState())
+
+	// Second success should close circuit
+	_ = cb.Execute(func() error { return nil })
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+}
+
+func TestCircuitBreaker_ResetOnClose(t *testing.T) {
+	cb := newTestBreaker(2, 50*time.Millisecond)
+
+	// Open circuit
+	_ = cb.Execute(func() error { return assert.AnError })
+	_ = cb.Execute(func() error { return assert.AnError })
+	assert.Equal(t, 2, cb.failureCount)
+
+	// Transition to half-open and then closed
+	time.Sleep(100 * time.Millisecond)
+	_ = cb.Execute(func() error { return nil })
+	_ = cb.Execute(func() error { return nil })
+
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	assert.Equal(t, 0, cb.failureCount) // Should be reset
+}
+
+// fakeClock is a manually advanced clock for the circuit breaker
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestCircuitBreaker_OpenDuration(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	cb := newTestBreaker(2, 30*time.Second)
+	cb.now = clock.Now
+	metrics.CircuitBreakerRecoveries.Reset()
+
+	openSeconds := func() float64 {
+		return testutil.ToFloat64(metrics.CircuitBreakerOpenSeconds.WithLabelValues("cross-region", testRegion))
+	}
+
+	assert.Equal(t, time.Duration(0), cb.OpenDuration())
+
+	// Open the circuit
+	for i := 0; i < 2; i++ {
+		_ = cb.Execute(func() error { return assert.AnError })
+	}
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState())
+	assert.Equal(t, float64(0), openSeconds())
+
+	// The gauge tracks elapsed time on each state check
+	clock.Advance(10 * time.Second)
+	cb.GetState()
+	assert.Equal(t, float64(10), openSeconds())
+	assert.Equal(t, 10*time.Second, cb.OpenDuration())
+
+	// A failed half-open trial keeps the breaker continuously open
+	clock.Advance(25 * time.Second)
+	_ = cb.Execute(func() error { return assert.AnError })
+	assert.Equal(t, events.CircuitBreakerOpen, cb.GetState())
+	assert.Equal(t, float64(35), openSeconds())
+
+	// Two successful trials close it and reset the gauge
+	clock.Advance(31 * time.Second)
+	assert.NoError(t, cb.Execute(func() error { return nil }))
+	assert.Equal(t, events.CircuitBreakerHalfOpen, cb.GetState())
+	assert.Equal(t, float64(66), openSeconds())
+
+	assert.NoError(t, cb.Execute(func() error { return nil }))
+	assert.Equal(t, events.CircuitBreakerClosed, cb.GetState())
+	assert.Equal(t, float64(0), openSeconds())
+	assert.Equal(t, time.Duration(0), cb.OpenDuration())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.CircuitBreakerRecoveries.WithLabelValues("cross-region", testRegion)))
+}
+
+func TestCircuitBreaker_ErrOpen(t *testing.T) {
+	cb := newTestBreaker(1, time.Minute)
+	_ = cb.Execute(func() error { return assert.AnError })
+
+	err := cb.Execute(func() error { return nil })
+	assert.ErrorIs(t, err, ErrOpen)
+}
+
+func TestCircuitBreaker_Allows(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	cb := newTestBreaker(1, 30*time.Second)
+	cb.now = clock.Now
+
+	assert.True(t, cb.Allows())
+
+	_ = cb.Execute(func() error { return assert.AnError })
+	assert.False(t, cb.Allows())
+
+	// Due a trial call once the timeout has passed
+	clock.Advance(31 * time.Second)
+	assert.True(t, cb.Allows())
+}
+
+func TestRegistry_Snapshot(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	registry := NewRegistry()
+
+	breaker := func(region string) *CircuitBreaker {
+		cb := New("snapshot-test", region, 2, 30*time.Second, nil)
+		cb.now = clock.Now
+		registry.Register(cb)
+		return cb
+	}
+
+	closed := breaker("us-west-2")
+	_ = closed.Execute(func() error { return nil })
+	_ = closed.Execute(func() error { return assert.AnError })
+
+	open := breaker("us-east-1")
+	for i := 0; i < 2; i++ {
+		_ = open.Execute(func() error { return assert.AnError })
+	}
+
+	halfOpen := breaker("eu-west-1")
+	for i := 0; i < 2; i++ {
+		_ = halfOpen.Execute(func() error { return assert.AnError })
+	}
+	clock.Advance(31 * time.Second)
+	_ = halfOpen.Execute(func() error { return nil })
+
+	snapshot := registry.Snapshot()
+	require.Len(t, snapshot, 3)
+
+	assert.Equal(t, events.CircuitBreakerClosed, snapshot["snapshot-test/us-west-2"].State)
+	assert.Equal(t, 1, snapshot["snapshot-test/us-west-2"].FailureCount)
+	assert.Equal(t, 1, snapshot["snapshot-test/us-west-2"].SuccessCount)
+	assert.Equal(t, 1, snapshot["snapshot-test/us-west-2"].ConsecutiveErrors)
+
+	assert.Equal(t, events.CircuitBreakerOpen, snapshot["snapshot-test/us-east-1"].State)
+	assert.Equal(t, 2, snapshot["snapshot-test/us-east-1"].FailureCount)
+	assert.Equal(t, 2, snapshot["snapshot-test/us-east-1"].ConsecutiveErrors)
+	assert.Equal(t, time.Unix(1700000030, 0), snapshot["snapshot-test/us-east-1"].NextRetryTime)
+
+	assert.Equal(t, events.CircuitBreakerHalfOpen, snapshot["snapshot-test/eu-west-1"].State)
+	assert.Equal(t, 1, snapshot["snapshot-test/eu-west-1"].SuccessCount)
+	assert.Equal(t, 0, snapshot["snapshot-test/eu-west-1"].ConsecutiveErrors)
+	assert.True(t, snapshot["snapshot-test/eu-west-1"].NextRetryTime.IsZero())
+}
+
+func TestNew_RegistersWithDefaultRegistry(t *testing.T) {
+	cb := New("default-registry-test", testRegion, 3, time.Second, nil)
+
+	snapshot := DefaultRegistry.Snapshot()
+	state, ok := snapshot[cb.Name()]
+	require.True(t, ok, "breaker should be registered on creation")
+	assert.Equal(t, events.CircuitBreakerClosed, state.State)
+	assert.Equal(t, "default-registry-test/us-west-2", cb.Name())
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	for i := 0; i < 2; i++ {
+		cb := New("handler-test", fmt.Sprintf("region-%d", i), 1, time.Minute, nil)
+		registry.Register(cb)
+		if i == 1 {
+			_ = cb.Execute(func() error { return assert.AnError })
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(registry).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/circuit-breakers", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body map[string]events.CircuitBreakerState
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, events.CircuitBreakerClosed, body["handler-test/region-0"].State)
+	assert.Equal(t, events.CircuitBreakerOpen, body["handler-test/region-1"].State)
+	assert.Equal(t, 1, body["handler-test/region-1"].FailureCount)
+}
+
+func TestGroup_IsolatesRegions(t *testing.T) {
+	group := NewGroup("group-test", Policy{MaxFailures: 2, Timeout: time.Minute}, nil)
+
+	for i := 0; i < 2; i++ {
+		_ = group.Execute("us-east-1", func() error { return assert.AnError })
+	}
+
+	assert.Equal(t, events.CircuitBreakerOpen, group.For("us-east-1").GetState())
+	assert.ErrorIs(t, group.Execute("us-east-1", func() error { return nil }), ErrOpen)
+	assert.NoError(t, group.Execute("eu-west-1", func() error { return nil }))
+	assert.Equal(t, events.CircuitBreakerClosed, group.For("eu-west-1").GetState())
+	assert.False(t, group.AllOpen())
+	assert.Equal(t, []string{"eu-west-1", "us-east-1"}, group.Regions())
+
+	// Each breaker is registered and reports metrics under its own region
+	snapshot := DefaultRegistry.Snapshot()
+	assert.Equal(t, events.CircuitBreakerOpen, snapshot["group-test/us-east-1"].State)
+	assert.Equal(t, events.CircuitBreakerClosed, snapshot["group-test/eu-west-1"].State)
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.CircuitBreakerFailures.WithLabelValues("group-test", "us-east-1")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.CircuitBreakerFailures.WithLabelValues("group-test", "eu-west-1")))
+}
+
+func TestGroup_ReusesBreakers(t *testing.T) {
+	group := NewGroup("group-test", Policy{MaxFailures: 5, Timeout: time.Minute}, nil)
+
+	assert.Same(t, group.For("us-east-1"), group.For("us-east-1"))
+	assert.NotSame(t, group.For("us-east-1"), group.For("eu-west-1"))
+}
+
+func TestGroup_RegionPolicy(t *testing.T) {
+	group := NewGroup("group-policy-test", Policy{MaxFailures: 5, Timeout: time.Minute}, nil)
+	group.SetPolicy("eu-west-1", Policy{MaxFailures: 1, Timeout: 10 * time.Second})
+
+	eu, us := group.For("eu-west-1"), group.For("us-east-1")
+
+	assert.Equal(t, 1, eu.maxFailures)
+	assert.Equal(t, 10*time.Second, eu.timeout)
+	assert.Equal(t, 5, us.maxFailures)
+	assert.Equal(t, time.Minute, us.timeout)
+}
+
+func TestGroup_AllOpen(t *testing.T) {
+	group := NewGroup("group-all-open-test", Policy{MaxFailures: 1, Timeout: time.Minute}, nil)
+	assert.False(t, group.AllOpen())
+
+	_ = group.Execute("us-east-1", func() error { return assert.AnError })
+	assert.True(t, group.AllOpen())
+
+	assert.NoError(t, group.Execute("eu-west-1", func() error { return nil }))
+	assert.False(t, group.AllOpen())
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies(" eu-west-1 = 3/10s ,, us-east-1=10/1m")
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Policy{
+		"eu-west-1": {MaxFailures: 3, Timeout: 10 * time.Second},
+		"us-east-1": {MaxFailures: 10, Timeout: time.Minute},
+	}, policies)
+
+	policies, err = ParsePolicies("")
+	require.NoError(t, err)
+	assert.Empty(t, policies)
+}
+
+func TestParsePolicies_Invalid(t *testing.T) {
+	for _, spec := range []string{"eu-west-1", "=3/10s", "eu-west-1=3", "eu-west-1=0/10s", "eu-west-1=x/10s", "eu-west-1=3/soon", "eu-west-1=3/0s"} {
+		_, err := ParsePolicies(spec)
+		assert.Error(t, err, spec)
+	}
+}
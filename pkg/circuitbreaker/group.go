@@ -0,0 +1,136 @@
+package circuitbreaker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wgu/go-performance-enablement/pkg/events"
+	"go.uber.org/zap"
+)
+
+// Policy sets when a breaker opens and how long it stays open before
+// allowing a trial call
+type Policy struct {
+	MaxFailures int
+	Timeout     time.Duration
+}
+
+// Group keeps one breaker per region for calls to a service, so failures in
+// one region only stop calls to that region. Breakers are created on first
+// use, registered with DefaultRegistry as "service/region" and label their
+// metrics with their region.
+type Group struct {
+	service  string
+	policy   Policy
+	policies map[string]Policy
+	logger   *zap.Logger
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+// NewGroup creates a group whose breakers use policy unless their region has
+// its own
+func NewGroup(service string, policy Policy, logger *zap.Logger) *Group {
+	return &Group{
+		service:  service,
+		policy:   policy,
+		policies: make(map[string]Policy),
+		logger:   logger,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// SetPolicy overrides the policy for region. It applies to the region's
+// breaker when it is created, so set it before the first call to region.
+func (g *Group) SetPolicy(region string, policy Policy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policies[region] = policy
+}
+
+// For returns the breaker for region, creating it if needed
+func (g *Group) For(region string) *CircuitBreaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if cb, ok := g.breakers[region]; ok {
+		return cb
+	}
+	policy, ok := g.policies[region]
+	if !ok {
+		policy = g.policy
+	}
+	cb := New(g.service, region, policy.MaxFailures, policy.Timeout, g.logger)
+	g.breakers[region] = cb
+	return cb
+}
+
+// Execute runs fn through the breaker for region
+func (g *Group) Execute(region string, fn func() error) error {
+	return g.For(region).Execute(fn)
+}
+
+// AllOpen reports whether every breaker created so far is open. It is false
+// for an empty group.
+func (g *Group) AllOpen() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, cb := range g.breakers {
+		if cb.GetState() != events.CircuitBreakerOpen {
+			return false
+		}
+	}
+	return len(g.breakers) > 0
+}
+
+// Regions returns the regions with a breaker, sorted
+func (g *Group) Regions() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	regions := make([]string, 0, len(g.breakers))
+	for region := range g.breakers {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// ParsePolicies parses per-region policies from a comma-separated list of
+// region=maxFailures/timeout entries, e.g. "eu-west-1=3/10s,us-east-1=10/1m".
+// Empty entries are ignored.
+func ParsePolicies(spec string) (map[string]Policy, error) {
+	policies := make(map[string]Policy)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		region, value, ok := strings.Cut(entry, "=")
+		region = strings.TrimSpace(region)
+		if !ok || region == "" {
+			return nil, fmt.Errorf("invalid circuit breaker policy %q: expected region=maxFailures/timeout", entry)
+		}
+		failures, timeout, ok := strings.Cut(strings.TrimSpace(value), "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid circuit breaker policy %q: expected region=maxFailures/timeout", entry)
+		}
+
+		maxFailures, err := strconv.Atoi(strings.TrimSpace(failures))
+		if err != nil || maxFailures <= 0 {
+			return nil, fmt.Errorf("invalid circuit breaker policy %q: max failures must be a positive integer", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(timeout))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid circuit breaker policy %q: timeout must be a positive duration", entry)
+		}
+		policies[region] = Policy{MaxFailures: maxFailures, Timeout: d}
+	}
+	return policies, nil
+}
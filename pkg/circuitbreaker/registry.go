@@ -0,0 +1,52 @@
+package circuitbreaker
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/wgu/go-performance-enablement/pkg/events"
+)
+
+// DefaultRegistry holds every breaker created with New
+var DefaultRegistry = NewRegistry()
+
+// Registry tracks circuit breakers by name so their states can be inspected together
+type Registry struct {
+	mu       sync.RWMutex
+	breakers map[string]*CircuitBreaker
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{breakers: make(map[string]*CircuitBreaker)}
+}
+
+// Register adds a breaker, replacing any previous breaker with the same name
+func (r *Registry) Register(cb *CircuitBreaker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakers[cb.Name()] = cb
+}
+
+// Snapshot returns the state of every registered breaker keyed by name
+func (r *Registry) Snapshot() map[string]events.CircuitBreakerState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := make(map[string]events.CircuitBreakerState, len(r.breakers))
+	for name, cb := range r.breakers {
+		snapshot[name] = cb.Snapshot()
+	}
+	return snapshot
+}
+
+// Handler serves the registry snapshot as JSON
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(r.Snapshot()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
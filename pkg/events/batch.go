@@ -0,0 +1,49 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxBatchSize is the most events an EventBatch may carry unless a
+// larger limit is configured
+const DefaultMaxBatchSize = 1000
+
+// ErrInvalidBatch is returned by EventBatch.Validate for a batch that
+// shouldn't be processed
+var ErrInvalidBatch = errors.New("invalid event batch")
+
+// Validate checks that Size matches the events carried, that there are no
+// more than maxSize of them, and that every event has an ID, type and source
+// region. A maxSize of zero or less uses DefaultMaxBatchSize. An oversized
+// batch is rejected before its events are looked at. The error wraps
+// ErrInvalidBatch, and ErrMissingEventField for events missing fields.
+func (b *EventBatch) Validate(maxSize int) error {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBatchSize
+	}
+	if len(b.Events) > maxSize {
+		return fmt.Errorf("%w: %d events exceeds the maximum of %d", ErrInvalidBatch, len(b.Events), maxSize)
+	}
+
+	var problems []error
+	if b.Size != len(b.Events) {
+		problems = append(problems, fmt.Errorf("size %d doesn't match %d events", b.Size, len(b.Events)))
+	}
+	for i := range b.Events {
+		event := &b.Events[i]
+		if event.EventID == "" {
+			problems = append(problems, fmt.Errorf("%w: events[%d].event_id", ErrMissingEventField, i))
+		}
+		if event.EventType == "" {
+			problems = append(problems, fmt.Errorf("%w: events[%d].event_type", ErrMissingEventField, i))
+		}
+		if event.SourceRegion == "" {
+			problems = append(problems, fmt.Errorf("%w: events[%d].source_region", ErrMissingEventField, i))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidBatch, errors.Join(problems...))
+	}
+	return nil
+}
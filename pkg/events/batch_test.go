@@ -0,0 +1,80 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func validBatch(n int) *EventBatch {
+	b := &EventBatch{BatchID: "batch-1", Size: n, Region: "us-west-2"}
+	for i := 0; i < n; i++ {
+		b.Events = append(b.Events, BaseEvent{
+			EventID:      fmt.Sprintf("event-%d", i),
+			EventType:    EventTypeOrderPlaced,
+			SourceRegion: "us-west-2",
+		})
+	}
+	return b
+}
+
+func TestEventBatch_Validate(t *testing.T) {
+	if err := validBatch(3).Validate(10); err != nil {
+		t.Errorf("expected well-formed batch to pass, got %v", err)
+	}
+	if err := (&EventBatch{}).Validate(10); err != nil {
+		t.Errorf("expected empty batch to pass, got %v", err)
+	}
+}
+
+func TestEventBatch_ValidateSizeMismatch(t *testing.T) {
+	b := validBatch(3)
+	b.Size = 4
+
+	err := b.Validate(10)
+	if !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("expected ErrInvalidBatch, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "size 4 doesn't match 3 events") {
+		t.Errorf("expected size mismatch, got %v", err)
+	}
+}
+
+func TestEventBatch_ValidateOversized(t *testing.T) {
+	err := validBatch(11).Validate(10)
+	if !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("expected ErrInvalidBatch, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "11 events exceeds the maximum of 10") {
+		t.Errorf("expected oversized batch error, got %v", err)
+	}
+
+	// Zero uses the default limit
+	if err := validBatch(DefaultMaxBatchSize).Validate(0); err != nil {
+		t.Errorf("expected batch at the default limit to pass, got %v", err)
+	}
+	if err := validBatch(DefaultMaxBatchSize + 1).Validate(0); !errors.Is(err, ErrInvalidBatch) {
+		t.Errorf("expected batch over the default limit to fail, got %v", err)
+	}
+}
+
+func TestEventBatch_ValidateMissingEventFields(t *testing.T) {
+	b := validBatch(3)
+	b.Events[1].EventType = ""
+	b.Events[2].EventID = ""
+	b.Events[2].SourceRegion = ""
+
+	err := b.Validate(10)
+	if !errors.Is(err, ErrInvalidBatch) || !errors.Is(err, ErrMissingEventField) {
+		t.Fatalf("expected ErrInvalidBatch and ErrMissingEventField, got %v", err)
+	}
+	for _, field := range []string{"events[1].event_type", "events[2].event_id", "events[2].source_region"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("expected error to name %s, got %v", field, err)
+		}
+	}
+	if strings.Contains(err.Error(), "events[0]") {
+		t.Errorf("expected events[0] to pass, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMissingEventField is returned by EventBuilder.Build when a required
+// field isn't set
+var ErrMissingEventField = errors.New("missing required event field")
+
+// defaultEventVersion is the metadata version of built events
+const defaultEventVersion = "1.0"
+
+// EventBuilder builds a BaseEvent with every field the pipeline expects.
+// Event type, source region and source service are required; Build fills in
+// the event ID, timestamp, trace ID, version and an empty payload when they
+// aren't set.
+//
+//	event, err := events.NewEventBuilder().
+//		WithType("order.created").
+//		WithRegion("us-west-2").
+//		WithSourceService("order-service").
+//		WithPayload(payload).
+//		Build()
+type EventBuilder struct {
+	event BaseEvent
+}
+
+// NewEventBuilder creates an empty builder
+func NewEventBuilder() *EventBuilder {
+	return &EventBuilder{}
+}
+
+// WithType sets the event type
+func (b *EventBuilder) WithType(eventType string) *EventBuilder {
+	b.event.EventType = eventType
+	return b
+}
+
+// WithRegion sets the region the event originates in
+func (b *EventBuilder) WithRegion(region string) *EventBuilder {
+	b.event.SourceRegion = region
+	return b
+}
+
+// WithPayload sets the event payload
+func (b *EventBuilder) WithPayload(payload map[string]interface{}) *EventBuilder {
+	b.event.Payload = payload
+	return b
+}
+
+// WithEventID sets the event ID instead of generating one
+func (b *EventBuilder) WithEventID(eventID string) *EventBuilder {
+	b.event.EventID = eventID
+	return b
+}
+
+// WithTimestamp sets when the event occurred instead of the build time
+func (b *EventBuilder) WithTimestamp(timestamp time.Time) *EventBuilder {
+	b.event.Timestamp = timestamp
+	return b
+}
+
+// WithCorrelationID sets the ID correlating the event with related events
+func (b *EventBuilder) WithCorrelationID(correlationID string) *EventBuilder {
+	b.event.CorrelationID = correlationID
+	return b
+}
+
+// WithTraceID sets the trace ID instead of generating one, to continue an
+// existing trace
+func (b *EventBuilder) WithTraceID(traceID string) *EventBuilder {
+	b.event.Metadata.TraceID = traceID
+	return b
+}
+
+// WithSourceService sets the service producing the event
+func (b *EventBuilder) WithSourceService(service string) *EventBuilder {
+	b.event.Metadata.SourceService = service
+	return b
+}
+
+// WithTenantID sets the tenant the event belongs to
+func (b *EventBuilder) WithTenantID(tenantID string) *EventBuilder {
+	b.event.Metadata.TenantID = tenantID
+	return b
+}
+
+// WithUserID sets the user who caused the event
+func (b *EventBuilder) WithUserID(userID string) *EventBuilder {
+	b.event.Metadata.UserID = userID
+	return b
+}
+
+// WithPriority sets the event priority
+func (b *EventBuilder) WithPriority(priority int) *EventBuilder {
+	b.event.Metadata.Priority = priority
+	return b
+}
+
+// Build returns the event, or an error wrapping ErrMissingEventField that
+// names every required field left unset. The builder can be reused; each
+// event built gets its own defaults.
+func (b *EventBuilder) Build() (*BaseEvent, error) {
+	var missing []error
+	if b.event.EventType == "" {
+		missing = append(missing, fmt.Errorf("%w: event_type", ErrMissingEventField))
+	}
+	if b.event.SourceRegion == "" {
+		missing = append(missing, fmt.Errorf("%w: source_region", ErrMissingEventField))
+	}
+	if b.event.Metadata.SourceService == "" {
+		missing = append(missing, fmt.Errorf("%w: metadata.source_service", ErrMissingEventField))
+	}
+	if err := errors.Join(missing...); err != nil {
+		return nil, err
+	}
+
+	event := b.event
+	if event.EventID == "" {
+		event.EventID = generateEventID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.Metadata.TraceID == "" {
+		event.Metadata.TraceID = NewTraceID()
+	}
+	if event.Metadata.Version == "" {
+		event.Metadata.Version = defaultEventVersion
+	}
+	if event.Payload == nil {
+		event.Payload = map[string]interface{}{}
+	}
+	return &event, nil
+}
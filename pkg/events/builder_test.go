@@ -0,0 +1,151 @@
+package events
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBuilder_AllFields(t *testing.T) {
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	payload := map[string]interface{}{"order_id": "o-1"}
+
+	event, err := NewEventBuilder().
+		WithEventID("evt-1").
+		WithType("order.created").
+		WithRegion("us-west-2").
+		WithTimestamp(timestamp).
+		WithPayload(payload).
+		WithCorrelationID("corr-1").
+		WithTraceID("trace-1").
+		WithSourceService("order-service").
+		WithTenantID("tenant-1").
+		WithUserID("user-1").
+		WithPriority(5).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &BaseEvent{
+		EventID:       "evt-1",
+		EventType:     "order.created",
+		SourceRegion:  "us-west-2",
+		Timestamp:     timestamp,
+		CorrelationID: "corr-1",
+		Metadata: EventMetadata{
+			SourceService: "order-service",
+			UserID:        "user-1",
+			TenantID:      "tenant-1",
+			TraceID:       "trace-1",
+			Version:       "1.0",
+			Priority:      5,
+		},
+		Payload: payload,
+	}
+	if !reflect.DeepEqual(event, expected) {
+		t.Errorf("expected %+v, got %+v", expected, event)
+	}
+}
+
+func TestEventBuilder_Defaults(t *testing.T) {
+	SetIDGenerator(&sequenceGenerator{})
+	defer SetIDGenerator(nil)
+
+	builder := NewEventBuilder().
+		WithType("order.created").
+		WithRegion("us-west-2").
+		WithSourceService("order-service")
+
+	before := time.Now()
+	event, err := builder.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if event.EventID != "evt-1" {
+		t.Errorf("expected generated event ID evt-1, got %s", event.EventID)
+	}
+	if event.Timestamp.Before(before) || event.Timestamp.After(time.Now()) {
+		t.Errorf("expected timestamp at build time, got %v", event.Timestamp)
+	}
+	if len(event.Metadata.TraceID) != 32 || strings.Trim(event.Metadata.TraceID, "0123456789abcdef") != "" {
+		t.Errorf("expected 32 hex digit trace ID, got %q", event.Metadata.TraceID)
+	}
+	if event.Metadata.Version != "1.0" {
+		t.Errorf("expected version 1.0, got %s", event.Metadata.Version)
+	}
+	if event.Payload == nil || len(event.Payload) != 0 {
+		t.Errorf("expected empty payload, got %v", event.Payload)
+	}
+	if event.CorrelationID != "" || event.Metadata.Priority != 0 {
+		t.Errorf("expected no correlation ID or priority, got %q and %d", event.CorrelationID, event.Metadata.Priority)
+	}
+
+	// Each build gets its own defaults
+	second, err := builder.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.EventID != "evt-2" || second.Metadata.TraceID == event.Metadata.TraceID {
+		t.Errorf("expected new ID and trace ID, got %s and %s", second.EventID, second.Metadata.TraceID)
+	}
+}
+
+func TestEventBuilder_MissingRequiredFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *EventBuilder
+		missing []string
+	}{
+		{
+			name:    "missing type",
+			builder: NewEventBuilder().WithRegion("us-west-2").WithSourceService("order-service"),
+			missing: []string{"event_type"},
+		},
+		{
+			name:    "missing region",
+			builder: NewEventBuilder().WithType("order.created").WithSourceService("order-service"),
+			missing: []string{"source_region"},
+		},
+		{
+			name:    "missing source service",
+			builder: NewEventBuilder().WithType("order.created").WithRegion("us-west-2"),
+			missing: []string{"metadata.source_service"},
+		},
+		{
+			name:    "missing everything",
+			builder: NewEventBuilder(),
+			missing: []string{"event_type", "source_region", "metadata.source_service"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := tt.builder.Build()
+			if event != nil {
+				t.Errorf("expected no event, got %+v", event)
+			}
+			if !errors.Is(err, ErrMissingEventField) {
+				t.Fatalf("expected ErrMissingEventField, got %v", err)
+			}
+			for _, field := range tt.missing {
+				if !strings.Contains(err.Error(), field) {
+					t.Errorf("expected error to name %s, got %v", field, err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewTraceID(t *testing.T) {
+	id := NewTraceID()
+	if len(id) != 32 || strings.Trim(id, "0123456789abcdef") != "" {
+		t.Errorf("expected 32 hex digits, got %q", id)
+	}
+	if id == NewTraceID() {
+		t.Error("expected distinct trace IDs")
+	}
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec formats. JSON is the default and the only format external consumers
+// such as EventBridge accept; MessagePack is for internal hops where size and
+// speed matter.
+const (
+	CodecJSON    = "json"
+	CodecMsgPack = "msgpack"
+)
+
+// Codec encodes and decodes events for transport
+type Codec interface {
+	// Name returns the codec's format, as passed to NewCodec
+	Name() string
+	// ContentType returns the MIME type of encoded data
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// NewCodec returns the codec for format, JSON when format is empty
+func NewCodec(format string) (Codec, error) {
+	switch format {
+	case "", CodecJSON:
+		return JSONCodec{}, nil
+	case CodecMsgPack:
+		return MsgPackCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown codec: %s", format)
+	}
+}
+
+// Marshal encodes v in format
+func Marshal(format string, v interface{}) ([]byte, error) {
+	codec, err := NewCodec(format)
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(v)
+}
+
+// Unmarshal decodes data in format into v
+func Unmarshal(format string, data []byte, v interface{}) error {
+	codec, err := NewCodec(format)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, v)
+}
+
+// JSONCodec encodes with encoding/json
+type JSONCodec struct{}
+
+// Name returns "json"
+func (JSONCodec) Name() string { return CodecJSON }
+
+// ContentType returns "application/json"
+func (JSONCodec) ContentType() string { return "application/json" }
+
+// Marshal encodes v as JSON
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// MsgPackCodec encodes as MessagePack. Fields are named by their json tags,
+// so an event has the same field names in either format. Numbers in
+// interface{} values decode as int64, uint64 or float64 rather than JSON's
+// float64 for all of them.
+type MsgPackCodec struct{}
+
+// Name returns "msgpack"
+func (MsgPackCodec) Name() string { return CodecMsgPack }
+
+// ContentType returns "application/msgpack"
+func (MsgPackCodec) ContentType() string { return "application/msgpack" }
+
+// Marshal encodes v as MessagePack through a pooled encoder and buffer
+func (MsgPackCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer putBuffer(buf)
+
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+	enc.Reset(buf)
+	enc.SetCustomStructTag("json")
+
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// Unmarshal decodes MessagePack data into v
+func (MsgPackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(dec)
+	dec.Reset(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	dec.UseLooseInterfaceDecoding(true)
+
+	return dec.Decode(v)
+}
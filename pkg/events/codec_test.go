@@ -0,0 +1,113 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newCodecTestEvent() *BaseEvent {
+	event := NewBaseEvent(EventTypeOrderPlaced, "us-west-2", nil)
+	event.Timestamp = time.Date(2024, 1, 15, 12, 0, 0, 123456789, time.UTC)
+	event.CorrelationID = "corr-1"
+	event.Metadata.TenantID = "tenant-1"
+	event.Metadata.Priority = 2
+	return event
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	tests := []struct {
+		format  string
+		payload map[string]interface{}
+	}{
+		{
+			// JSON decodes every number as float64
+			format: CodecJSON,
+			payload: map[string]interface{}{
+				"order_id": "order-12345",
+				"quantity": float64(3),
+				"amount":   99.5,
+				"items":    []interface{}{"a", "b"},
+				"shipping": map[string]interface{}{"express": true},
+			},
+		},
+		{
+			format: CodecMsgPack,
+			payload: map[string]interface{}{
+				"order_id": "order-12345",
+				"quantity": int64(3),
+				"amount":   99.5,
+				"items":    []interface{}{"a", "b"},
+				"shipping": map[string]interface{}{"express": true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			codec, err := NewCodec(tt.format)
+			if err != nil {
+				t.Fatalf("NewCodec(%q) failed: %v", tt.format, err)
+			}
+			if codec.Name() != tt.format {
+				t.Errorf("expected codec %q, got %q", tt.format, codec.Name())
+			}
+
+			event := newCodecTestEvent()
+			event.Payload = tt.payload
+
+			data, err := codec.Marshal(event)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			var decoded BaseEvent
+			if err := codec.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+
+			if !decoded.Timestamp.Equal(event.Timestamp) {
+				t.Errorf("expected timestamp %v, got %v", event.Timestamp, decoded.Timestamp)
+			}
+			decoded.Timestamp = event.Timestamp
+			if !reflect.DeepEqual(&decoded, event) {
+				t.Errorf("round trip mismatch:\nwant %+v\ngot  %+v", event, &decoded)
+			}
+		})
+	}
+}
+
+func TestMsgPackCodec_UsesJSONFieldNames(t *testing.T) {
+	data, err := Marshal(CodecMsgPack, newCodecTestEvent())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var fields map[string]interface{}
+	if err := Unmarshal(CodecMsgPack, data, &fields); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	for _, name := range []string{"event_id", "event_type", "source_region", "correlation_id", "metadata"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("expected field %q in %v", name, fields)
+		}
+	}
+	// omitempty is honoured like in JSON
+	metadata := fields["metadata"].(map[string]interface{})
+	if _, ok := metadata["user_id"]; ok {
+		t.Errorf("expected empty user_id to be omitted, got %v", metadata)
+	}
+}
+
+func TestNewCodec(t *testing.T) {
+	codec, err := NewCodec("")
+	if err != nil || codec.Name() != CodecJSON {
+		t.Errorf("expected JSON by default, got %v, %v", codec, err)
+	}
+
+	if _, err := NewCodec("xml"); err == nil {
+		t.Error("expected error for unknown codec")
+	}
+	if _, err := Marshal("xml", newCodecTestEvent()); err == nil {
+		t.Error("expected Marshal error for unknown codec")
+	}
+}
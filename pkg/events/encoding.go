@@ -0,0 +1,98 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// bufferPool holds reusable buffers for streaming JSON encoding
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// WriteJSON streams a large event to w through a pooled buffer instead of
+// allocating the full document with json.Marshal. Use ToJSON for small events.
+func (e *BaseEvent) WriteJSON(w io.Writer) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer putBuffer(buf)
+
+	if err := encodeInto(buf, e); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// WriteJSON streams the batch to w one event at a time, so memory use is
+// bounded by the largest event rather than the whole batch. The output is
+// equivalent to json.Marshal of the batch.
+func (b *EventBatch) WriteJSON(w io.Writer) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer putBuffer(buf)
+
+	buf.WriteString(`{"batch_id":`)
+	if err := encodeInto(buf, b.BatchID); err != nil {
+		return err
+	}
+	buf.WriteString(`,"events":`)
+	if b.Events == nil {
+		buf.WriteString("null")
+	} else {
+		buf.WriteByte('[')
+		for i := range b.Events {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeInto(buf, &b.Events[i]); err != nil {
+				return err
+			}
+			// Flush each event so the buffer never holds more than one
+			if _, err := buf.WriteTo(w); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	}
+
+	buf.WriteString(`,"timestamp":`)
+	if err := encodeInto(buf, b.Timestamp); err != nil {
+		return err
+	}
+	buf.WriteString(`,"size":`)
+	if err := encodeInto(buf, b.Size); err != nil {
+		return err
+	}
+	buf.WriteString(`,"region":`)
+	if err := encodeInto(buf, b.Region); err != nil {
+		return err
+	}
+	buf.WriteByte('}')
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// encodeInto appends the JSON encoding of v to buf without the trailing
+// newline json.Encoder adds
+func encodeInto(buf *bytes.Buffer, v interface{}) error {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// putBuffer returns a buffer to the pool, dropping oversized ones so a single
+// huge batch doesn't pin memory
+func putBuffer(buf *bytes.Buffer) {
+	const maxPooledBufferSize = 1 << 20
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
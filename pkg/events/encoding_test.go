@@ -0,0 +1,97 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestBatch(n int) *EventBatch {
+	batch := &EventBatch{
+		BatchID:   "batch-123",
+		Timestamp: time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+		Region:    "us-west-2",
+	}
+	for i := 0; i < n; i++ {
+		event := NewBaseEvent(EventTypeOrderPlaced, "us-west-2", map[string]interface{}{
+			"order_id": "order-12345",
+			"index":    float64(i),
+			"items":    []interface{}{"a", "b"},
+			"html":     "<b>escaped & kept</b>",
+		})
+		event.Metadata.TraceID = "trace-1"
+		batch.Events = append(batch.Events, *event)
+	}
+	batch.Size = len(batch.Events)
+	return batch
+}
+
+func TestEventBatch_WriteJSON_MatchesMarshal(t *testing.T) {
+	for _, n := range []int{0, 1, 100} {
+		batch := newTestBatch(n)
+
+		var buf bytes.Buffer
+		if err := batch.WriteJSON(&buf); err != nil {
+			t.Fatalf("Failed to stream batch: %v", err)
+		}
+
+		expected, err := json.Marshal(batch)
+		if err != nil {
+			t.Fatalf("Failed to marshal batch: %v", err)
+		}
+
+		if !bytes.Equal(expected, buf.Bytes()) {
+			t.Errorf("Streamed output for %d events differs from json.Marshal", n)
+		}
+	}
+}
+
+func TestEventBatch_WriteJSON_RoundTrip(t *testing.T) {
+	batch := newTestBatch(100)
+
+	var buf bytes.Buffer
+	if err := batch.WriteJSON(&buf); err != nil {
+		t.Fatalf("Failed to stream batch: %v", err)
+	}
+
+	var decoded EventBatch
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode streamed batch: %v", err)
+	}
+
+	if decoded.BatchID != batch.BatchID || decoded.Size != batch.Size || decoded.Region != batch.Region {
+		t.Errorf("Batch header fields don't match after round trip")
+	}
+	if !decoded.Timestamp.Equal(batch.Timestamp) {
+		t.Errorf("Expected timestamp %v, got %v", batch.Timestamp, decoded.Timestamp)
+	}
+	if len(decoded.Events) != len(batch.Events) {
+		t.Fatalf("Expected %d events, got %d", len(batch.Events), len(decoded.Events))
+	}
+	for i := range batch.Events {
+		if decoded.Events[i].EventID != batch.Events[i].EventID {
+			t.Errorf("Event %d: expected ID %s, got %s", i, batch.Events[i].EventID, decoded.Events[i].EventID)
+		}
+		if !reflect.DeepEqual(decoded.Events[i].Payload, batch.Events[i].Payload) {
+			t.Errorf("Event %d: payload doesn't match after round trip", i)
+		}
+	}
+}
+
+func TestBaseEvent_WriteJSON_MatchesToJSON(t *testing.T) {
+	event := NewBaseEvent("test.event", "us-west-2", map[string]interface{}{
+		"test": "data",
+	})
+
+	var buf bytes.Buffer
+	if err := event.WriteJSON(&buf); err != nil {
+		t.Fatalf("Failed to stream event: %v", err)
+	}
+
+	expected, _ := event.ToJSON()
+	if !bytes.Equal(expected, buf.Bytes()) {
+		t.Errorf("Expected %s, got %s", expected, buf.Bytes())
+	}
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// EnvelopeSchemaVersion is the current envelope schema version
+const EnvelopeSchemaVersion = "1.0"
+
+// Event kinds carried in Envelope.EventKind
+const (
+	KindBase        = "base"
+	KindCDC         = "cdc"
+	KindCrossRegion = "cross_region"
+	KindTransformed = "transformed"
+	KindHealth      = "health"
+	KindDLQ         = "dlq"
+)
+
+// ErrUnknownEventKind is returned when an event or envelope kind isn't recognized
+var ErrUnknownEventKind = errors.New("unknown event kind")
+
+// Envelope boxes a concrete event with an explicit kind so consumers don't
+// have to guess its type from the JSON shape
+type Envelope struct {
+	SchemaVersion string          `json:"schema_version"`
+	EventKind     string          `json:"event_kind"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Wrap boxes a concrete event in an Envelope
+func Wrap(event interface{}) (*Envelope, error) {
+	kind, err := eventKind(event)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s event: %w", kind, err)
+	}
+
+	return &Envelope{
+		SchemaVersion: EnvelopeSchemaVersion,
+		EventKind:     kind,
+		Data:          data,
+	}, nil
+}
+
+// Unwrap decodes the envelope data into its concrete event type, returned as
+// a pointer (*BaseEvent, *CDCEvent, ...)
+func (e *Envelope) Unwrap() (interface{}, error) {
+	var event interface{}
+	switch e.EventKind {
+	case KindBase:
+		event = &BaseEvent{}
+	case KindCDC:
+		event = &CDCEvent{}
+	case KindCrossRegion:
+		event = &CrossRegionEvent{}
+	case KindTransformed:
+		event = &TransformedEvent{}
+	case KindHealth:
+		event = &HealthCheckEvent{}
+	case KindDLQ:
+		event = &DeadLetterEvent{}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEventKind, e.EventKind)
+	}
+
+	if err := json.Unmarshal(e.Data, event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s event: %w", e.EventKind, err)
+	}
+	return event, nil
+}
+
+// ParseEnvelope decodes an envelope from JSON. It returns false if data is
+// not an envelope, e.g. a bare event from a publisher that predates them.
+func ParseEnvelope(data []byte) (*Envelope, bool) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.EventKind == "" {
+		return nil, false
+	}
+	return &envelope, true
+}
+
+// eventKind returns the envelope kind for a concrete event
+func eventKind(event interface{}) (string, error) {
+	switch event.(type) {
+	case *BaseEvent, BaseEvent:
+		return KindBase, nil
+	case *CDCEvent, CDCEvent:
+		return KindCDC, nil
+	case *CrossRegionEvent, CrossRegionEvent:
+		return KindCrossRegion, nil
+	case *TransformedEvent, TransformedEvent:
+		return KindTransformed, nil
+	case *HealthCheckEvent, HealthCheckEvent:
+		return KindHealth, nil
+	case *DeadLetterEvent, DeadLetterEvent:
+		return KindDLQ, nil
+	default:
+		return "", fmt.Errorf("%w: %T", ErrUnknownEventKind, event)
+	}
+}
@@ -0,0 +1,118 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	base := BaseEvent{
+		EventID:      "evt-1",
+		EventType:    EventTypeCustomerCreated,
+		SourceRegion: "us-west-2",
+		Timestamp:    now,
+		Payload:      map[string]interface{}{"id": "cust-1"},
+		Metadata:     EventMetadata{SourceService: "test", Version: "1.0"},
+	}
+
+	tests := []struct {
+		name  string
+		event interface{}
+		kind  string
+	}{
+		{"base", &base, KindBase},
+		{"cdc", &CDCEvent{EventID: "evt-2", Operation: OperationInsert, TableName: "customers", Timestamp: now, PrimaryKeys: map[string]interface{}{"id": "cust-1"}}, KindCDC},
+		{"cross region", &CrossRegionEvent{BaseEvent: base, TargetRegion: "us-east-1", OriginalTimestamp: now}, KindCrossRegion},
+		{"transformed", &TransformedEvent{BaseEvent: base, TransformationRules: []string{"validate"}, TransformedAt: now}, KindTransformed},
+		{"health", &HealthCheckEvent{Region: "us-west-2", Service: "svc", Status: StatusHealthy, Timestamp: now}, KindHealth},
+		{"dlq", &DeadLetterEvent{OriginalEvent: json.RawMessage(`{"id":"x"}`), ErrorMessage: "boom", FirstFailure: now, LastFailure: now}, KindDLQ},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope, err := Wrap(tt.event)
+			if err != nil {
+				t.Fatalf("Wrap failed: %v", err)
+			}
+			if envelope.EventKind != tt.kind {
+				t.Errorf("Expected kind %s, got %s", tt.kind, envelope.EventKind)
+			}
+			if envelope.SchemaVersion != EnvelopeSchemaVersion {
+				t.Errorf("Expected schema version %s, got %s", EnvelopeSchemaVersion, envelope.SchemaVersion)
+			}
+
+			data, err := json.Marshal(envelope)
+			if err != nil {
+				t.Fatalf("Failed to marshal envelope: %v", err)
+			}
+
+			parsed, ok := ParseEnvelope(data)
+			if !ok {
+				t.Fatal("ParseEnvelope did not recognize envelope")
+			}
+
+			unwrapped, err := parsed.Unwrap()
+			if err != nil {
+				t.Fatalf("Unwrap failed: %v", err)
+			}
+			if reflect.TypeOf(unwrapped) != reflect.TypeOf(tt.event) {
+				t.Errorf("Expected %T, got %T", tt.event, unwrapped)
+			}
+			if !reflect.DeepEqual(unwrapped, tt.event) {
+				t.Errorf("Round-tripped event differs:\n got  %+v\n want %+v", unwrapped, tt.event)
+			}
+		})
+	}
+}
+
+func TestWrap_Value(t *testing.T) {
+	envelope, err := Wrap(HealthCheckEvent{Region: "us-west-2"})
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	if envelope.EventKind != KindHealth {
+		t.Errorf("Expected kind %s, got %s", KindHealth, envelope.EventKind)
+	}
+}
+
+func TestWrap_UnknownType(t *testing.T) {
+	_, err := Wrap(map[string]string{"k": "v"})
+	if !errors.Is(err, ErrUnknownEventKind) {
+		t.Errorf("Expected ErrUnknownEventKind, got %v", err)
+	}
+}
+
+func TestUnwrap_UnknownKind(t *testing.T) {
+	envelope := &Envelope{SchemaVersion: EnvelopeSchemaVersion, EventKind: "mystery", Data: json.RawMessage(`{}`)}
+
+	event, err := envelope.Unwrap()
+	if !errors.Is(err, ErrUnknownEventKind) {
+		t.Errorf("Expected ErrUnknownEventKind, got %v", err)
+	}
+	if event != nil {
+		t.Errorf("Expected nil event, got %T", event)
+	}
+}
+
+func TestUnwrap_InvalidData(t *testing.T) {
+	envelope := &Envelope{SchemaVersion: EnvelopeSchemaVersion, EventKind: KindBase, Data: json.RawMessage(`"not an object"`)}
+
+	if _, err := envelope.Unwrap(); err == nil {
+		t.Error("Expected error for invalid data")
+	}
+}
+
+func TestParseEnvelope_BareEvent(t *testing.T) {
+	data, _ := NewBaseEvent("test.event", "us-west-2", nil).ToJSON()
+
+	if _, ok := ParseEnvelope(data); ok {
+		t.Error("Bare event should not parse as an envelope")
+	}
+	if _, ok := ParseEnvelope([]byte("not json")); ok {
+		t.Error("Invalid JSON should not parse as an envelope")
+	}
+}
@@ -0,0 +1,34 @@
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// ContentHash returns a hex SHA-256 of v's canonical JSON encoding. Map keys
+// are encoded in sorted order, so equal content hashes equally regardless of
+// map iteration order.
+func ContentHash(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode content: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SameContent reports whether a and b have the same content hash. Content
+// that can't be hashed is never considered the same.
+func SameContent(a, b interface{}) bool {
+	hashA, err := ContentHash(a)
+	if err != nil {
+		return false
+	}
+	hashB, err := ContentHash(b)
+	if err != nil {
+		return false
+	}
+	return hashA == hashB
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"math"
+	"testing"
+)
+
+func TestContentHash_Canonical(t *testing.T) {
+	a := map[string]interface{}{"id": "item-1", "count": 2, "tags": []string{"x", "y"}}
+	b := map[string]interface{}{"tags": []string{"x", "y"}, "count": 2, "id": "item-1"}
+
+	hashA, err := ContentHash(a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hashB, err := ContentHash(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hashA != hashB {
+		t.Errorf("expected equal hashes for equal content, got %s and %s", hashA, hashB)
+	}
+}
+
+func TestSameContent(t *testing.T) {
+	before := map[string]interface{}{"id": "item-1", "tags": []string{"x", "y"}}
+
+	if !SameContent(before, map[string]interface{}{"tags": []string{"x", "y"}, "id": "item-1"}) {
+		t.Error("expected identical content to be the same")
+	}
+	if SameContent(before, map[string]interface{}{"id": "item-1", "tags": []string{"y", "x"}}) {
+		t.Error("expected reordered list to differ")
+	}
+	if SameContent(map[string]interface{}{"n": math.NaN()}, map[string]interface{}{"n": math.NaN()}) {
+		t.Error("expected unhashable content never to be the same")
+	}
+}
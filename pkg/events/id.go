@@ -0,0 +1,94 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	mathrand "math/rand/v2"
+	"sync"
+	"time"
+)
+
+// IDGenerator generates unique event IDs
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc adapts a plain function to the IDGenerator interface
+type IDGeneratorFunc func() string
+
+// NewID calls f
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+var (
+	idGeneratorMu sync.RWMutex
+	idGenerator   IDGenerator = ULIDGenerator{}
+)
+
+// SetIDGenerator replaces the generator used by NewBaseEvent and NewCDCEvent.
+// Passing nil restores the default ULID generator.
+func SetIDGenerator(g IDGenerator) {
+	if g == nil {
+		g = ULIDGenerator{}
+	}
+	idGeneratorMu.Lock()
+	defer idGeneratorMu.Unlock()
+	idGenerator = g
+}
+
+// generateEventID generates a unique event ID with the configured generator
+func generateEventID() string {
+	idGeneratorMu.RLock()
+	g := idGenerator
+	idGeneratorMu.RUnlock()
+	return g.NewID()
+}
+
+// crockfordAlphabet is the Crockford base32 alphabet used by ULIDs
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator generates ULIDs: a 48-bit millisecond timestamp followed by
+// 80 random bits, encoded as 26 Crockford base32 characters. IDs sort by
+// creation time and are safe to generate concurrently.
+type ULIDGenerator struct{}
+
+// NewID returns a new ULID
+func (ULIDGenerator) NewID() string {
+	var id [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic("events: failed to read random bytes for ULID: " + err.Error())
+	}
+	return encodeULID(id)
+}
+
+// encodeULID encodes 128 bits as 26 base32 characters, 5 bits at a time from
+// the most significant end (the first character carries only 3 bits)
+func encodeULID(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// NewTraceID returns a random W3C-style trace ID of 32 hex digits. Trace IDs
+// only need to be unique, so if crypto/rand fails it falls back to math/rand
+// rather than failing the event.
+func NewTraceID() string {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		binary.BigEndian.PutUint64(id[0:8], mathrand.Uint64())
+		binary.BigEndian.PutUint64(id[8:16], mathrand.Uint64())
+	}
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,134 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sequenceGenerator returns deterministic IDs for tests
+type sequenceGenerator struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (g *sequenceGenerator) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+	return fmt.Sprintf("evt-%d", g.next)
+}
+
+func TestSetIDGenerator(t *testing.T) {
+	SetIDGenerator(&sequenceGenerator{})
+	defer SetIDGenerator(nil)
+
+	first := NewBaseEvent("test.event", "us-west-2", nil)
+	second := NewBaseEvent("test.event", "us-west-2", nil)
+	cdc := NewCDCEvent(OperationInsert, "users", nil, nil)
+
+	if first.EventID != "evt-1" {
+		t.Errorf("expected first event ID evt-1, got %s", first.EventID)
+	}
+	if second.EventID != "evt-2" {
+		t.Errorf("expected second event ID evt-2, got %s", second.EventID)
+	}
+	if cdc.EventID != "evt-3" {
+		t.Errorf("expected CDC event ID evt-3, got %s", cdc.EventID)
+	}
+}
+
+func TestSetIDGeneratorFunc(t *testing.T) {
+	SetIDGenerator(IDGeneratorFunc(func() string {
+		return "evt_" + ULIDGenerator{}.NewID()
+	}))
+	defer SetIDGenerator(nil)
+
+	event := NewBaseEvent("test.event", "us-west-2", nil)
+	if !strings.HasPrefix(event.EventID, "evt_") || len(event.EventID) != 30 {
+		t.Errorf("expected prefixed ULID, got %s", event.EventID)
+	}
+}
+
+func TestSetIDGeneratorNilRestoresDefault(t *testing.T) {
+	SetIDGenerator(IDGeneratorFunc(func() string { return "fixed" }))
+	SetIDGenerator(nil)
+
+	event := NewBaseEvent("test.event", "us-west-2", nil)
+	if event.EventID == "fixed" || len(event.EventID) != 26 {
+		t.Errorf("expected default ULID after reset, got %s", event.EventID)
+	}
+}
+
+func TestULIDGenerator(t *testing.T) {
+	id := ULIDGenerator{}.NewID()
+
+	if len(id) != 26 {
+		t.Fatalf("expected 26 character ULID, got %d: %s", len(id), id)
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(crockfordAlphabet, c) {
+			t.Errorf("unexpected character %q in ULID %s", c, id)
+		}
+	}
+	// First character only carries the top 3 bits of the timestamp
+	if id[0] > '7' {
+		t.Errorf("ULID %s overflows 128 bits", id)
+	}
+}
+
+func TestULIDGeneratorSortsByTime(t *testing.T) {
+	first := ULIDGenerator{}.NewID()
+	time.Sleep(2 * time.Millisecond)
+	second := ULIDGenerator{}.NewID()
+
+	if first[:10] >= second[:10] {
+		t.Errorf("expected timestamp prefix of %s to sort before %s", first, second)
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	var max [16]byte
+	for i := range max {
+		max[i] = 0xff
+	}
+
+	if got := encodeULID([16]byte{}); got != "00000000000000000000000000" {
+		t.Errorf("expected all zeros, got %s", got)
+	}
+	if got := encodeULID(max); got != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("expected max ULID, got %s", got)
+	}
+}
+
+func TestDefaultIDGeneratorConcurrent(t *testing.T) {
+	const goroutines = 16
+	const perGoroutine = 500
+
+	var mu sync.Mutex
+	seen := make(map[string]struct{}, goroutines*perGoroutine)
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids := make([]string, perGoroutine)
+			for j := range ids {
+				ids[j] = generateEventID()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				seen[id] = struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != goroutines*perGoroutine {
+		t.Errorf("expected %d unique IDs, got %d", goroutines*perGoroutine, len(seen))
+	}
+}
@@ -0,0 +1,29 @@
+package events
+
+// IdempotencyKeyFunc derives the key identifying an event across retries, so
+// repeated deliveries of the same event can be deduplicated. An empty key
+// leaves the event out of deduplication.
+type IdempotencyKeyFunc func(event interface{}) (string, error)
+
+// idempotencyKeyer is implemented by events that carry their own key
+type idempotencyKeyer interface {
+	IdempotencyKey() string
+}
+
+// ContentIdempotencyKey is the default IdempotencyKeyFunc: the ContentHash of
+// the event, so identical events share a key and any difference in content,
+// including timestamps, yields a new one
+func ContentIdempotencyKey(event interface{}) (string, error) {
+	return ContentHash(event)
+}
+
+// EventIDIdempotencyKey keys events by their IdempotencyKey method, the
+// EventID of a BaseEvent, for producers whose event IDs are stable across
+// retries. Events without the method get an empty key.
+func EventIDIdempotencyKey(event interface{}) (string, error) {
+	keyer, ok := event.(idempotencyKeyer)
+	if !ok {
+		return "", nil
+	}
+	return keyer.IdempotencyKey(), nil
+}
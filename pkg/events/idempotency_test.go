@@ -0,0 +1,56 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContentIdempotencyKey(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	event := func(status string) *BaseEvent {
+		return &BaseEvent{
+			EventID:   "evt-1",
+			EventType: EventTypeOrderPlaced,
+			Timestamp: timestamp,
+			Payload:   map[string]interface{}{"order_id": "order-1", "status": status},
+		}
+	}
+
+	first, err := ContentIdempotencyKey(event("placed"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := ContentIdempotencyKey(event("placed"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first == "" || first != second {
+		t.Errorf("expected identical events to share a key, got %q and %q", first, second)
+	}
+
+	changed, err := ContentIdempotencyKey(event("shipped"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed == first {
+		t.Errorf("expected different content to change the key, got %q for both", first)
+	}
+}
+
+func TestContentIdempotencyKey_Unencodable(t *testing.T) {
+	if _, err := ContentIdempotencyKey(map[string]interface{}{"ch": make(chan int)}); err == nil {
+		t.Error("expected an error for content that can't be encoded")
+	}
+}
+
+func TestEventIDIdempotencyKey(t *testing.T) {
+	key, err := EventIDIdempotencyKey(&CrossRegionEvent{BaseEvent: BaseEvent{EventID: "stream-event-1"}})
+	if err != nil || key != "stream-event-1" {
+		t.Errorf("expected the event ID as key, got %q, %v", key, err)
+	}
+
+	key, err = EventIDIdempotencyKey(map[string]string{"id": "1"})
+	if err != nil || key != "" {
+		t.Errorf("expected no key for an event without one, got %q, %v", key, err)
+	}
+}
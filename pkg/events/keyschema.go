@@ -0,0 +1,72 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeySchema names the attributes that form a table's primary key. SortKey is
+// empty for tables keyed on the partition key alone.
+type KeySchema struct {
+	PartitionKey string
+	SortKey      string
+}
+
+// KeySchemas maps table names to their primary-key schema
+type KeySchemas map[string]KeySchema
+
+// ParseKeySchemas parses a comma-separated list of table=partitionKey[:sortKey]
+// entries, such as "orders=customerId:orderId,users=userId". An empty spec
+// yields no schemas.
+func ParseKeySchemas(spec string) (KeySchemas, error) {
+	schemas := make(KeySchemas)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		table, keys, ok := strings.Cut(entry, "=")
+		table = strings.TrimSpace(table)
+		if !ok || table == "" {
+			return nil, fmt.Errorf("invalid key schema entry %q: want table=partitionKey[:sortKey]", entry)
+		}
+
+		partitionKey, sortKey, hasSortKey := strings.Cut(keys, ":")
+		schema := KeySchema{
+			PartitionKey: strings.TrimSpace(partitionKey),
+			SortKey:      strings.TrimSpace(sortKey),
+		}
+		if schema.PartitionKey == "" {
+			return nil, fmt.Errorf("invalid key schema for %s: missing partition key", table)
+		}
+		if hasSortKey && schema.SortKey == "" {
+			return nil, fmt.Errorf("invalid key schema for %s: empty sort key", table)
+		}
+		schemas[table] = schema
+	}
+	return schemas, nil
+}
+
+// Names returns the key attribute names, partition key first
+func (s KeySchema) Names() []string {
+	if s.SortKey == "" {
+		return []string{s.PartitionKey}
+	}
+	return []string{s.PartitionKey, s.SortKey}
+}
+
+// Extract returns only the schema's key attributes from keys, failing if any
+// of them is missing
+func (s KeySchema) Extract(keys map[string]interface{}) (map[string]interface{}, error) {
+	names := s.Names()
+	result := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		value, ok := keys[name]
+		if !ok {
+			return nil, fmt.Errorf("missing key attribute %q", name)
+		}
+		result[name] = value
+	}
+	return result, nil
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeySchemas(t *testing.T) {
+	schemas, err := ParseKeySchemas(" orders = customerId : orderId ,users=userId,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := KeySchemas{
+		"orders": {PartitionKey: "customerId", SortKey: "orderId"},
+		"users":  {PartitionKey: "userId"},
+	}
+	if !reflect.DeepEqual(schemas, expected) {
+		t.Errorf("expected %v, got %v", expected, schemas)
+	}
+}
+
+func TestParseKeySchemas_Invalid(t *testing.T) {
+	for _, spec := range []string{"orders", "=id", "orders=", "orders=:orderId", "orders=customerId:"} {
+		if _, err := ParseKeySchemas(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestKeySchema_Extract(t *testing.T) {
+	schema := KeySchema{PartitionKey: "customerId", SortKey: "orderId"}
+
+	keys, err := schema.Extract(map[string]interface{}{
+		"customerId": "c-1",
+		"orderId":    "o-1",
+		"status":     "shipped",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"customerId": "c-1", "orderId": "o-1"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+
+	if _, err := schema.Extract(map[string]interface{}{"customerId": "c-1"}); err == nil {
+		t.Error("expected error for missing sort key")
+	}
+}
@@ -0,0 +1,62 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnyEventType is the MaxAgePolicy entry applied to event types without their own
+const AnyEventType = "*"
+
+// MaxAgePolicy maps event types to the age beyond which an event is stale and
+// should be dropped rather than applied. Event types with no entry, and no
+// AnyEventType entry, never go stale.
+type MaxAgePolicy map[string]time.Duration
+
+// ParseMaxAgePolicy parses a comma-separated list of eventType=duration pairs,
+// such as "INSERT=1h,MODIFY=30m,*=6h". An empty spec yields an empty policy.
+func ParseMaxAgePolicy(spec string) (MaxAgePolicy, error) {
+	policy := make(MaxAgePolicy)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		eventType, age, ok := strings.Cut(entry, "=")
+		eventType = strings.TrimSpace(eventType)
+		if !ok || eventType == "" {
+			return nil, fmt.Errorf("invalid max age entry %q: want eventType=duration", entry)
+		}
+
+		maxAge, err := time.ParseDuration(strings.TrimSpace(age))
+		if err != nil {
+			return nil, fmt.Errorf("invalid max age for %s: %w", eventType, err)
+		}
+		if maxAge <= 0 {
+			return nil, fmt.Errorf("invalid max age for %s: must be positive", eventType)
+		}
+		policy[eventType] = maxAge
+	}
+	return policy, nil
+}
+
+// MaxAge returns the maximum age configured for eventType
+func (p MaxAgePolicy) MaxAge(eventType string) (time.Duration, bool) {
+	if maxAge, ok := p[eventType]; ok {
+		return maxAge, true
+	}
+	maxAge, ok := p[AnyEventType]
+	return maxAge, ok
+}
+
+// IsStale reports whether an event of eventType that occurred at occurredAt is
+// older than its maximum age at now. Events without a timestamp are never stale.
+func (p MaxAgePolicy) IsStale(eventType string, occurredAt, now time.Time) bool {
+	if occurredAt.IsZero() {
+		return false
+	}
+	maxAge, ok := p.MaxAge(eventType)
+	return ok && now.Sub(occurredAt) > maxAge
+}
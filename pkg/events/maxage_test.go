@@ -0,0 +1,88 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaxAgePolicy(t *testing.T) {
+	policy, err := ParseMaxAgePolicy(" INSERT=1h, MODIFY = 30m ,*=6h,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]time.Duration{
+		"INSERT":     time.Hour,
+		"MODIFY":     30 * time.Minute,
+		AnyEventType: 6 * time.Hour,
+	}
+	if len(policy) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(policy))
+	}
+	for eventType, maxAge := range expected {
+		if policy[eventType] != maxAge {
+			t.Errorf("expected %s max age %s, got %s", eventType, maxAge, policy[eventType])
+		}
+	}
+}
+
+func TestParseMaxAgePolicy_Empty(t *testing.T) {
+	policy, err := ParseMaxAgePolicy("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policy) != 0 {
+		t.Errorf("expected empty policy, got %v", policy)
+	}
+}
+
+func TestParseMaxAgePolicy_Invalid(t *testing.T) {
+	for _, spec := range []string{"INSERT", "=1h", "INSERT=soon", "INSERT=-1h", "INSERT=0s"} {
+		if _, err := ParseMaxAgePolicy(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestMaxAgePolicy_IsStale(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := MaxAgePolicy{"INSERT": time.Hour}
+
+	tests := []struct {
+		name       string
+		eventType  string
+		occurredAt time.Time
+		stale      bool
+	}{
+		{"older than max age", "INSERT", now.Add(-2 * time.Hour), true},
+		{"within max age", "INSERT", now.Add(-30 * time.Minute), false},
+		{"exactly max age", "INSERT", now.Add(-time.Hour), false},
+		{"type without policy", "REMOVE", now.Add(-48 * time.Hour), false},
+		{"no timestamp", "INSERT", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.IsStale(tt.eventType, tt.occurredAt, now); got != tt.stale {
+				t.Errorf("expected stale=%v, got %v", tt.stale, got)
+			}
+		})
+	}
+}
+
+func TestMaxAgePolicy_Wildcard(t *testing.T) {
+	now := time.Now()
+	policy := MaxAgePolicy{"INSERT": 24 * time.Hour, AnyEventType: time.Hour}
+
+	if policy.IsStale("INSERT", now.Add(-2*time.Hour), now) {
+		t.Error("expected the INSERT entry to override the wildcard")
+	}
+	if !policy.IsStale("MODIFY", now.Add(-2*time.Hour), now) {
+		t.Error("expected the wildcard to apply to MODIFY")
+	}
+
+	var nilPolicy MaxAgePolicy
+	if nilPolicy.IsStale("INSERT", now.Add(-48*time.Hour), now) {
+		t.Error("expected a nil policy to never be stale")
+	}
+}
@@ -0,0 +1,165 @@
+package events
+
+import (
+	"sort"
+	"sync"
+)
+
+// SequenceGap is an inclusive range of sequence numbers that never arrived
+type SequenceGap struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+}
+
+// Size returns the number of sequences missing in the gap
+func (g SequenceGap) Size() int64 {
+	return g.To - g.From + 1
+}
+
+// KeyOrderReport describes the sequences seen for one key. A late event that
+// fills an earlier gap counts as a reordering, not a gap.
+type KeyOrderReport struct {
+	Key           string        `json:"key"`
+	FirstSequence int64         `json:"first_sequence"`
+	LastSequence  int64         `json:"last_sequence"`
+	Events        int           `json:"events"`
+	Reorderings   int           `json:"reorderings"`
+	Duplicates    int           `json:"duplicates"`
+	Gaps          []SequenceGap `json:"gaps,omitempty"`
+	FirstGap      *SequenceGap  `json:"first_gap,omitempty"`
+}
+
+// InOrder reports whether the key's events arrived in order with none missing
+func (r KeyOrderReport) InOrder() bool {
+	return r.Reorderings == 0 && r.Duplicates == 0 && len(r.Gaps) == 0
+}
+
+// OrderReport is the result of verifying a stream. Keys holds only the keys
+// with anomalies, in key order.
+type OrderReport struct {
+	KeysChecked int              `json:"keys_checked"`
+	Events      int              `json:"events"`
+	Reorderings int              `json:"reorderings"`
+	Duplicates  int              `json:"duplicates"`
+	Missing     int64            `json:"missing"`
+	Keys        []KeyOrderReport `json:"keys,omitempty"`
+}
+
+// Clean reports whether every key's events arrived in order with none missing
+func (r OrderReport) Clean() bool {
+	return len(r.Keys) == 0
+}
+
+// keyOrder tracks the sequences seen for one key
+type keyOrder struct {
+	first, last int64
+	events      int
+	reorderings int
+	duplicates  int
+	// gaps are the unfilled ranges below last, in ascending order
+	gaps []SequenceGap
+}
+
+// OrderVerifier checks that events carrying per-key sequence numbers arrive
+// in order with no sequence missing. Sequences for a key are expected to
+// increase by one from the first one observed. It is safe for concurrent use.
+type OrderVerifier struct {
+	mu   sync.Mutex
+	keys map[string]*keyOrder
+}
+
+// NewOrderVerifier creates an empty verifier
+func NewOrderVerifier() *OrderVerifier {
+	return &OrderVerifier{keys: make(map[string]*keyOrder)}
+}
+
+// Observe records that the event with sequence for key arrived
+func (v *OrderVerifier) Observe(key string, sequence int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	order, ok := v.keys[key]
+	if !ok {
+		v.keys[key] = &keyOrder{first: sequence, last: sequence, events: 1}
+		return
+	}
+	order.events++
+
+	switch {
+	case sequence == order.last+1:
+		order.last = sequence
+	case sequence > order.last:
+		order.gaps = append(order.gaps, SequenceGap{From: order.last + 1, To: sequence - 1})
+		order.last = sequence
+	case sequence < order.first:
+		// Arrived after later sequences, ahead of everything seen so far
+		order.reorderings++
+		if sequence < order.first-1 {
+			order.gaps = append([]SequenceGap{{From: sequence + 1, To: order.first - 1}}, order.gaps...)
+		}
+		order.first = sequence
+	case order.fillGap(sequence):
+		order.reorderings++
+	default:
+		order.duplicates++
+	}
+}
+
+// fillGap removes sequence from the gap containing it, reporting false when
+// it isn't missing and so was already seen
+func (o *keyOrder) fillGap(sequence int64) bool {
+	i := sort.Search(len(o.gaps), func(i int) bool { return o.gaps[i].To >= sequence })
+	if i == len(o.gaps) || o.gaps[i].From > sequence {
+		return false
+	}
+
+	gap := o.gaps[i]
+	switch {
+	case gap.From == gap.To:
+		o.gaps = append(o.gaps[:i], o.gaps[i+1:]...)
+	case sequence == gap.From:
+		o.gaps[i].From++
+	case sequence == gap.To:
+		o.gaps[i].To--
+	default:
+		o.gaps[i].To = sequence - 1
+		o.gaps = append(o.gaps[:i+1], append([]SequenceGap{{From: sequence + 1, To: gap.To}}, o.gaps[i+1:]...)...)
+	}
+	return true
+}
+
+// Report summarises every key observed so far
+func (v *OrderVerifier) Report() OrderReport {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	report := OrderReport{KeysChecked: len(v.keys)}
+	for key, order := range v.keys {
+		keyReport := KeyOrderReport{
+			Key:           key,
+			FirstSequence: order.first,
+			LastSequence:  order.last,
+			Events:        order.events,
+			Reorderings:   order.reorderings,
+			Duplicates:    order.duplicates,
+		}
+		if len(order.gaps) > 0 {
+			keyReport.Gaps = append([]SequenceGap(nil), order.gaps...)
+			first := order.gaps[0]
+			keyReport.FirstGap = &first
+		}
+
+		report.Events += order.events
+		report.Reorderings += order.reorderings
+		report.Duplicates += order.duplicates
+		for _, gap := range order.gaps {
+			report.Missing += gap.Size()
+		}
+		if !keyReport.InOrder() {
+			report.Keys = append(report.Keys, keyReport)
+		}
+	}
+
+	sort.Slice(report.Keys, func(i, j int) bool { return report.Keys[i].Key < report.Keys[j].Key })
+	return report
+}
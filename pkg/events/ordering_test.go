@@ -0,0 +1,113 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+)
+
+func observeAll(v *OrderVerifier, key string, sequences ...int64) {
+	for _, sequence := range sequences {
+		v.Observe(key, sequence)
+	}
+}
+
+func TestOrderVerifier_InOrder(t *testing.T) {
+	v := NewOrderVerifier()
+	observeAll(v, "order-1", 1, 2, 3, 4)
+	observeAll(v, "order-2", 10, 11)
+
+	report := v.Report()
+	if !report.Clean() {
+		t.Fatalf("expected clean report, got %+v", report)
+	}
+	if report.KeysChecked != 2 || report.Events != 6 {
+		t.Errorf("expected 2 keys and 6 events, got %d and %d", report.KeysChecked, report.Events)
+	}
+}
+
+func TestOrderVerifier_Reordered(t *testing.T) {
+	v := NewOrderVerifier()
+	observeAll(v, "order-1", 1, 3, 2, 4)
+
+	report := v.Report()
+	if report.Clean() {
+		t.Fatal("expected reordering to be reported")
+	}
+	if report.Reorderings != 1 || report.Missing != 0 {
+		t.Errorf("expected 1 reordering and nothing missing, got %d and %d", report.Reorderings, report.Missing)
+	}
+
+	key := report.Keys[0]
+	if key.Key != "order-1" || key.Reorderings != 1 || key.FirstGap != nil {
+		t.Errorf("unexpected key report %+v", key)
+	}
+}
+
+func TestOrderVerifier_EarlierThanFirst(t *testing.T) {
+	v := NewOrderVerifier()
+	observeAll(v, "order-1", 5, 6, 3)
+
+	key := v.Report().Keys[0]
+	if key.FirstSequence != 3 || key.Reorderings != 1 {
+		t.Errorf("unexpected key report %+v", key)
+	}
+	// Sequence 4 is still missing between the late event and the rest
+	expected := []SequenceGap{{From: 4, To: 4}}
+	if !reflect.DeepEqual(key.Gaps, expected) {
+		t.Errorf("expected gaps %v, got %v", expected, key.Gaps)
+	}
+}
+
+func TestOrderVerifier_Gaps(t *testing.T) {
+	v := NewOrderVerifier()
+	observeAll(v, "order-1", 1, 2, 6, 7, 10)
+	observeAll(v, "order-2", 1, 2, 3)
+
+	report := v.Report()
+	if report.Missing != 5 {
+		t.Errorf("expected 5 missing sequences, got %d", report.Missing)
+	}
+	if len(report.Keys) != 1 {
+		t.Fatalf("expected only order-1 reported, got %+v", report.Keys)
+	}
+
+	key := report.Keys[0]
+	if key.FirstGap == nil || *key.FirstGap != (SequenceGap{From: 3, To: 5}) {
+		t.Errorf("expected first gap 3-5, got %v", key.FirstGap)
+	}
+	expected := []SequenceGap{{From: 3, To: 5}, {From: 8, To: 9}}
+	if !reflect.DeepEqual(key.Gaps, expected) {
+		t.Errorf("expected gaps %v, got %v", expected, key.Gaps)
+	}
+}
+
+func TestOrderVerifier_LateEventSplitsGap(t *testing.T) {
+	v := NewOrderVerifier()
+	observeAll(v, "order-1", 1, 7, 4)
+
+	key := v.Report().Keys[0]
+	expected := []SequenceGap{{From: 2, To: 3}, {From: 5, To: 6}}
+	if !reflect.DeepEqual(key.Gaps, expected) {
+		t.Errorf("expected gaps %v, got %v", expected, key.Gaps)
+	}
+	if key.Reorderings != 1 {
+		t.Errorf("expected 1 reordering, got %d", key.Reorderings)
+	}
+
+	// Filling the rest leaves only the reorderings
+	observeAll(v, "order-1", 2, 3, 5, 6)
+	key = v.Report().Keys[0]
+	if len(key.Gaps) != 0 || key.FirstGap != nil || key.Reorderings != 5 {
+		t.Errorf("unexpected key report %+v", key)
+	}
+}
+
+func TestOrderVerifier_Duplicates(t *testing.T) {
+	v := NewOrderVerifier()
+	observeAll(v, "order-1", 1, 2, 2, 3, 1)
+
+	report := v.Report()
+	if report.Duplicates != 2 || report.Reorderings != 0 {
+		t.Errorf("expected 2 duplicates and no reorderings, got %d and %d", report.Duplicates, report.Reorderings)
+	}
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TenantRoutePrefix marks a RoutingTable entry keyed by tenant ID rather than
+// event type, as in "tenant:acme=eu-west-1"
+const TenantRoutePrefix = "tenant:"
+
+// RoutingTable maps event types and tenants to the region their events are
+// routed to. A tenant's entry takes precedence over its event type's, and
+// the AnyEventType entry applies to everything else.
+type RoutingTable map[string]string
+
+// ParseRoutingTable parses a comma-separated list of key=region pairs, where
+// a key is an event type, a tenant ID prefixed with "tenant:", or "*", such
+// as "INSERT=us-east-1,tenant:acme=eu-west-1,*=us-west-2". An empty spec
+// yields an empty table. A route to currentRegion is rejected, since its
+// events would loop back into the bus they came from.
+func ParseRoutingTable(spec, currentRegion string) (RoutingTable, error) {
+	table := make(RoutingTable)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, region, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		region = strings.TrimSpace(region)
+		if !ok || key == "" || key == TenantRoutePrefix {
+			return nil, fmt.Errorf("invalid route %q: want eventType=region or tenant:id=region", entry)
+		}
+		if region == "" {
+			return nil, fmt.Errorf("invalid route for %s: region is empty", key)
+		}
+		if region == currentRegion {
+			return nil, fmt.Errorf("invalid route for %s: %s is the current region", key, region)
+		}
+		table[key] = region
+	}
+	return table, nil
+}
+
+// Region returns the region for an event of eventType belonging to tenantID,
+// reporting false if no entry applies
+func (t RoutingTable) Region(eventType, tenantID string) (string, bool) {
+	if tenantID != "" {
+		if region, ok := t[TenantRoutePrefix+tenantID]; ok {
+			return region, true
+		}
+	}
+	if region, ok := t[eventType]; ok {
+		return region, true
+	}
+	region, ok := t[AnyEventType]
+	return region, ok
+}
+
+// Regions returns the distinct regions in the table, sorted
+func (t RoutingTable) Regions() []string {
+	seen := make(map[string]bool, len(t))
+	var regions []string
+	for _, region := range t {
+		if !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
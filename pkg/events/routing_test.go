@@ -0,0 +1,104 @@
+package events
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRoutingTable(t *testing.T) {
+	table, err := ParseRoutingTable(" INSERT=us-east-1, tenant:acme = eu-west-1 ,*=us-west-2,", "ca-central-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := RoutingTable{
+		"INSERT":      "us-east-1",
+		"tenant:acme": "eu-west-1",
+		AnyEventType:  "us-west-2",
+	}
+	if !reflect.DeepEqual(table, expected) {
+		t.Errorf("expected %v, got %v", expected, table)
+	}
+}
+
+func TestParseRoutingTable_Empty(t *testing.T) {
+	table, err := ParseRoutingTable("", "ca-central-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(table) != 0 {
+		t.Errorf("expected empty table, got %v", table)
+	}
+}
+
+func TestParseRoutingTable_Invalid(t *testing.T) {
+	for _, spec := range []string{"INSERT", "=us-east-1", "INSERT=", "tenant:=eu-west-1"} {
+		if _, err := ParseRoutingTable(spec, "ca-central-1"); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestParseRoutingTable_RejectsCurrentRegion(t *testing.T) {
+	for _, spec := range []string{"INSERT=us-west-2", "tenant:acme=us-west-2", "INSERT=us-east-1,*=us-west-2"} {
+		_, err := ParseRoutingTable(spec, "us-west-2")
+		if err == nil || !strings.Contains(err.Error(), "current region") {
+			t.Errorf("expected current region error for %q, got %v", spec, err)
+		}
+	}
+}
+
+func TestRoutingTable_Region(t *testing.T) {
+	table := RoutingTable{
+		"INSERT":      "us-east-1",
+		"tenant:acme": "eu-west-1",
+		AnyEventType:  "us-west-2",
+	}
+
+	tests := []struct {
+		name      string
+		eventType string
+		tenantID  string
+		region    string
+	}{
+		{"event type", "INSERT", "", "us-east-1"},
+		{"tenant over event type", "INSERT", "acme", "eu-west-1"},
+		{"unmapped tenant uses event type", "INSERT", "globex", "us-east-1"},
+		{"unmapped type uses wildcard", "REMOVE", "", "us-west-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			region, ok := table.Region(tt.eventType, tt.tenantID)
+			if !ok || region != tt.region {
+				t.Errorf("expected %s, got %q (found %v)", tt.region, region, ok)
+			}
+		})
+	}
+}
+
+func TestRoutingTable_RegionUnmapped(t *testing.T) {
+	table := RoutingTable{"INSERT": "us-east-1"}
+	if region, ok := table.Region("REMOVE", "acme"); ok {
+		t.Errorf("expected no route, got %s", region)
+	}
+
+	var empty RoutingTable
+	if region, ok := empty.Region("INSERT", ""); ok {
+		t.Errorf("expected no route from nil table, got %s", region)
+	}
+}
+
+func TestRoutingTable_Regions(t *testing.T) {
+	table := RoutingTable{
+		"INSERT":      "us-east-1",
+		"MODIFY":      "us-east-1",
+		"tenant:acme": "eu-west-1",
+	}
+
+	expected := []string{"eu-west-1", "us-east-1"}
+	if regions := table.Regions(); !reflect.DeepEqual(regions, expected) {
+		t.Errorf("expected %v, got %v", expected, regions)
+	}
+}
@@ -0,0 +1,288 @@
+package events
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultGraceWindow is how long a Sequencer waits for a missing sequence
+	DefaultGraceWindow = 5 * time.Second
+
+	// DefaultSequencerCapacity is how many events a Sequencer holds per key
+	DefaultSequencerCapacity = 1000
+
+	// DefaultSequencerKeys is how many keys a Sequencer remembers
+	DefaultSequencerKeys = 100000
+
+	// DefaultSequencerIdleTTL is how long a Sequencer remembers a key that
+	// receives no events
+	DefaultSequencerIdleTTL = 10 * time.Minute
+)
+
+// SequencedEvent is an event released by a Sequencer, in sequence order
+type SequencedEvent struct {
+	Key      string
+	Sequence int64
+	Event    interface{}
+}
+
+// GapHandler is told about each gap a Sequencer gives up waiting for, so it
+// can be logged and metered
+type GapHandler func(key string, gap SequenceGap)
+
+// sequencedKey holds the events waiting on a missing sequence for one key
+type sequencedKey struct {
+	key     string
+	next    int64
+	pending map[int64]interface{}
+	// waitingSince is when the key started waiting on its current gap
+	waitingSince time.Time
+	// lastSeen is when the key last received an event
+	lastSeen time.Time
+}
+
+// Sequencer releases events carrying per-key sequence numbers in order.
+// Events ahead of a missing sequence are held until it arrives, for at most
+// the grace window; after that the gap is accepted and the held events are
+// released with it skipped, so a lost event can't block a key forever. A key
+// holding more than its capacity accepts its gaps at once. Sequences for a
+// key are expected to increase by one from the first one added. Each
+// accepted gap is logged and counted by source. It is safe for concurrent
+// use.
+//
+// The sequencer remembers a bounded number of keys, forgetting the least
+// recently used first, and forgets keys idle past a TTL when Expire runs. A
+// forgotten key starts again at the next sequence added for it.
+type Sequencer struct {
+	mu       sync.Mutex
+	source   string
+	grace    time.Duration
+	capacity int
+	maxKeys  int
+	idleTTL  time.Duration
+	keys     map[string]*list.Element
+	// order holds *sequencedKey values, most recently used first
+	order        *list.List
+	onGap        GapHandler
+	gapsAccepted int
+	logger       *zap.Logger
+	now          func() time.Time
+}
+
+// NewSequencer creates a sequencer for events from source, waiting up to
+// grace for missing sequences and holding up to capacity events per key.
+// Zero values use DefaultGraceWindow and DefaultSequencerCapacity.
+func NewSequencer(source string, grace time.Duration, capacity int, logger *zap.Logger) *Sequencer {
+	if grace <= 0 {
+		grace = DefaultGraceWindow
+	}
+	if capacity <= 0 {
+		capacity = DefaultSequencerCapacity
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Sequencer{
+		source:   source,
+		grace:    grace,
+		capacity: capacity,
+		maxKeys:  DefaultSequencerKeys,
+		idleTTL:  DefaultSequencerIdleTTL,
+		keys:     make(map[string]*list.Element),
+		order:    list.New(),
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+// SetKeyLimits sets how many keys the sequencer remembers and how long it
+// remembers an idle one. Zero values keep the current limits.
+func (s *Sequencer) SetKeyLimits(maxKeys int, idleTTL time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maxKeys > 0 {
+		s.maxKeys = maxKeys
+	}
+	if idleTTL > 0 {
+		s.idleTTL = idleTTL
+	}
+}
+
+// SetGapHandler registers fn to be called for each accepted gap. It runs with
+// the sequencer locked, so it must not call back into it.
+func (s *Sequencer) SetGapHandler(fn GapHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onGap = fn
+}
+
+// Add takes the event with sequence for key and returns the events now ready
+// to apply, in order. Sequences already released are dropped as duplicates
+// or too late. Remembering a new key past the key limit releases the events
+// of the least recently used key, with its gaps accepted, before forgetting
+// it.
+func (s *Sequencer) Add(key string, sequence int64, event interface{}) []SequencedEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var k *sequencedKey
+	if elem, ok := s.keys[key]; ok {
+		k = elem.Value.(*sequencedKey)
+		s.order.MoveToFront(elem)
+	} else {
+		k = &sequencedKey{key: key, next: sequence, pending: make(map[int64]interface{})}
+		s.keys[key] = s.order.PushFront(k)
+	}
+	k.lastSeen = s.now()
+
+	if sequence < k.next {
+		return nil
+	}
+	if _, held := k.pending[sequence]; held {
+		return nil
+	}
+	k.pending[sequence] = event
+
+	ready := s.release(key, k)
+	if len(k.pending) > 0 {
+		if k.waitingSince.IsZero() {
+			k.waitingSince = s.now()
+		}
+		if len(k.pending) > s.capacity || s.now().Sub(k.waitingSince) >= s.grace {
+			ready = append(ready, s.acceptGaps(key, k)...)
+		}
+	}
+
+	for s.order.Len() > s.maxKeys {
+		oldest := s.order.Back().Value.(*sequencedKey)
+		ready = append(ready, s.acceptGaps(oldest.key, oldest)...)
+		s.forget(oldest)
+	}
+	return ready
+}
+
+// Expire accepts the gaps of every key that has waited past the grace window
+// and returns the events released, in order per key, then forgets keys with
+// nothing held that have been idle past the TTL. Call it periodically so keys
+// that stop receiving events aren't held forever.
+func (s *Sequencer) Expire() []SequencedEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var ready []SequencedEvent
+	now := s.now()
+	for _, key := range keys {
+		k := s.keys[key].Value.(*sequencedKey)
+		if len(k.pending) > 0 && now.Sub(k.waitingSince) >= s.grace {
+			ready = append(ready, s.acceptGaps(key, k)...)
+		}
+	}
+
+	// Keys are ordered by last use, so the idle ones are at the back
+	for elem := s.order.Back(); elem != nil; {
+		k := elem.Value.(*sequencedKey)
+		if now.Sub(k.lastSeen) < s.idleTTL {
+			break
+		}
+		elem = elem.Prev()
+		if len(k.pending) == 0 {
+			s.forget(k)
+		}
+	}
+	return ready
+}
+
+// Keys returns the number of keys remembered
+func (s *Sequencer) Keys() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// Pending returns the number of events held waiting on missing sequences
+func (s *Sequencer) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := 0
+	for _, elem := range s.keys {
+		pending += len(elem.Value.(*sequencedKey).pending)
+	}
+	return pending
+}
+
+// GapsAccepted returns the number of gaps given up on
+func (s *Sequencer) GapsAccepted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gapsAccepted
+}
+
+// release removes and returns the events contiguous from the next expected
+// sequence, clearing the wait once nothing is held
+func (s *Sequencer) release(key string, k *sequencedKey) []SequencedEvent {
+	var ready []SequencedEvent
+	for {
+		event, ok := k.pending[k.next]
+		if !ok {
+			break
+		}
+		ready = append(ready, SequencedEvent{Key: key, Sequence: k.next, Event: event})
+		delete(k.pending, k.next)
+		k.next++
+	}
+	if len(k.pending) == 0 {
+		k.waitingSince = time.Time{}
+	}
+	return ready
+}
+
+// forget drops a key and everything known about it
+func (s *Sequencer) forget(k *sequencedKey) {
+	s.order.Remove(s.keys[k.key])
+	delete(s.keys, k.key)
+}
+
+// acceptGaps skips every missing sequence below the key's held events,
+// reporting each gap, and returns all the held events in order
+func (s *Sequencer) acceptGaps(key string, k *sequencedKey) []SequencedEvent {
+	var ready []SequencedEvent
+	for len(k.pending) > 0 {
+		first := true
+		var lowest int64
+		for sequence := range k.pending {
+			if first || sequence < lowest {
+				lowest, first = sequence, false
+			}
+		}
+
+		gap := SequenceGap{From: k.next, To: lowest - 1}
+		s.gapsAccepted++
+		metrics.SequenceGapsAccepted.WithLabelValues(s.source).Inc()
+		s.logger.Warn("accepted sequence gap",
+			zap.String("source", s.source),
+			zap.String("key", key),
+			zap.Int64("from", gap.From),
+			zap.Int64("to", gap.To),
+			zap.Int("held", len(k.pending)),
+		)
+		if s.onGap != nil {
+			s.onGap(key, gap)
+		}
+		k.next = lowest
+		ready = append(ready, s.release(key, k)...)
+	}
+	return ready
+}
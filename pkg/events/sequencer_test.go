@@ -0,0 +1,252 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// testSequencer returns a sequencer whose clock is advanced by the returned func
+func testSequencer(grace time.Duration, capacity int) (*Sequencer, func(time.Duration)) {
+	s := NewSequencer("test", grace, capacity, zap.NewNop())
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func sequences(events []SequencedEvent) []int64 {
+	var seqs []int64
+	for _, event := range events {
+		seqs = append(seqs, event.Sequence)
+	}
+	return seqs
+}
+
+func TestSequencer_InOrder(t *testing.T) {
+	s, _ := testSequencer(time.Second, 10)
+
+	var released []SequencedEvent
+	for seq := int64(1); seq <= 3; seq++ {
+		released = append(released, s.Add("order-1", seq, seq)...)
+	}
+
+	if got := sequences(released); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("expected [1 2 3], got %v", got)
+	}
+	if released[2].Key != "order-1" || released[2].Event != int64(3) {
+		t.Errorf("unexpected event %+v", released[2])
+	}
+}
+
+func TestSequencer_GapFilledWithinWindow(t *testing.T) {
+	s, advance := testSequencer(time.Second, 10)
+	s.SetGapHandler(func(key string, gap SequenceGap) {
+		t.Errorf("unexpected gap accepted for %s: %+v", key, gap)
+	})
+
+	s.Add("order-1", 1, nil)
+	if released := s.Add("order-1", 3, nil); len(released) != 0 {
+		t.Fatalf("expected 3 to wait for 2, got %v", sequences(released))
+	}
+
+	advance(900 * time.Millisecond)
+	if released := s.Expire(); len(released) != 0 {
+		t.Fatalf("expected nothing released within the window, got %v", sequences(released))
+	}
+
+	released := s.Add("order-1", 2, nil)
+	if got := sequences(released); !reflect.DeepEqual(got, []int64{2, 3}) {
+		t.Errorf("expected [2 3], got %v", got)
+	}
+	if s.Pending() != 0 || s.GapsAccepted() != 0 {
+		t.Errorf("expected nothing pending and no gaps, got %d and %d", s.Pending(), s.GapsAccepted())
+	}
+}
+
+func TestSequencer_GapAcceptedAfterWindow(t *testing.T) {
+	s, advance := testSequencer(time.Second, 10)
+	var gaps []SequenceGap
+	s.SetGapHandler(func(key string, gap SequenceGap) { gaps = append(gaps, gap) })
+
+	s.Add("order-1", 1, nil)
+	s.Add("order-1", 4, nil)
+	s.Add("order-1", 5, nil)
+	s.Add("order-1", 7, nil)
+
+	advance(time.Second)
+	released := s.Expire()
+
+	if got := sequences(released); !reflect.DeepEqual(got, []int64{4, 5, 7}) {
+		t.Errorf("expected [4 5 7], got %v", got)
+	}
+	expected := []SequenceGap{{From: 2, To: 3}, {From: 6, To: 6}}
+	if !reflect.DeepEqual(gaps, expected) {
+		t.Errorf("expected gaps %v, got %v", expected, gaps)
+	}
+	if s.GapsAccepted() != 2 || s.Pending() != 0 {
+		t.Errorf("expected 2 gaps and nothing pending, got %d and %d", s.GapsAccepted(), s.Pending())
+	}
+
+	// The skipped sequences are too late once they arrive
+	if released := s.Add("order-1", 2, nil); len(released) != 0 {
+		t.Errorf("expected late sequence to be dropped, got %v", sequences(released))
+	}
+	if released := s.Add("order-1", 8, nil); !reflect.DeepEqual(sequences(released), []int64{8}) {
+		t.Errorf("expected [8], got %v", sequences(released))
+	}
+}
+
+func TestSequencer_AddAcceptsExpiredGap(t *testing.T) {
+	s, advance := testSequencer(time.Second, 10)
+
+	s.Add("order-1", 1, nil)
+	s.Add("order-1", 3, nil)
+	advance(2 * time.Second)
+
+	// A later event on the key moves it past the expired gap without Expire
+	released := s.Add("order-1", 4, nil)
+	if got := sequences(released); !reflect.DeepEqual(got, []int64{3, 4}) {
+		t.Errorf("expected [3 4], got %v", got)
+	}
+}
+
+func TestSequencer_CapacityAcceptsGaps(t *testing.T) {
+	s, _ := testSequencer(time.Hour, 2)
+
+	s.Add("order-1", 1, nil)
+	s.Add("order-1", 3, nil)
+	s.Add("order-1", 4, nil)
+	released := s.Add("order-1", 5, nil)
+
+	if got := sequences(released); !reflect.DeepEqual(got, []int64{3, 4, 5}) {
+		t.Errorf("expected [3 4 5], got %v", got)
+	}
+	if s.GapsAccepted() != 1 {
+		t.Errorf("expected 1 gap accepted, got %d", s.GapsAccepted())
+	}
+}
+
+func TestSequencer_KeysAreIndependent(t *testing.T) {
+	s, _ := testSequencer(time.Second, 10)
+
+	s.Add("order-1", 1, nil)
+	s.Add("order-1", 3, nil)
+	s.Add("order-2", 10, nil)
+
+	if released := s.Add("order-2", 11, nil); !reflect.DeepEqual(sequences(released), []int64{11}) {
+		t.Errorf("expected order-2 to continue past order-1's gap, got %v", sequences(released))
+	}
+	if s.Pending() != 1 {
+		t.Errorf("expected 1 pending event, got %d", s.Pending())
+	}
+}
+
+func TestSequencer_DropsDuplicates(t *testing.T) {
+	s, _ := testSequencer(time.Second, 10)
+
+	s.Add("order-1", 1, nil)
+	s.Add("order-1", 3, nil)
+
+	if released := s.Add("order-1", 1, nil); len(released) != 0 {
+		t.Errorf("expected released duplicate to be dropped, got %v", sequences(released))
+	}
+	if released := s.Add("order-1", 3, nil); len(released) != 0 {
+		t.Errorf("expected held duplicate to be dropped, got %v", sequences(released))
+	}
+	if s.Pending() != 1 {
+		t.Errorf("expected 1 pending event, got %d", s.Pending())
+	}
+}
+
+func TestSequencer_GapAcceptedIsLoggedAndCounted(t *testing.T) {
+	metrics.SequenceGapsAccepted.Reset()
+	core, logs := observer.New(zap.WarnLevel)
+	s := NewSequencer("us-west-2", time.Second, 10, zap.New(core))
+	now := time.Unix(1700000000, 0)
+	s.now = func() time.Time { return now }
+
+	s.Add("order-1", 1, nil)
+	s.Add("order-1", 3, nil)
+	now = now.Add(time.Second)
+	s.Expire()
+
+	if got := testutil.ToFloat64(metrics.SequenceGapsAccepted.WithLabelValues("us-west-2")); got != 1 {
+		t.Errorf("expected 1 gap counted, got %v", got)
+	}
+	entries := logs.FilterMessage("accepted sequence gap").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 gap logged, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["key"] != "order-1" || fields["from"] != int64(2) || fields["to"] != int64(2) {
+		t.Errorf("unexpected gap log fields %v", fields)
+	}
+}
+
+func TestSequencer_ForgetsIdleKeys(t *testing.T) {
+	s, advance := testSequencer(time.Second, 10)
+	s.SetKeyLimits(0, time.Minute)
+
+	s.Add("order-1", 1, nil)
+	s.Add("order-2", 1, nil)
+	s.Add("order-2", 3, nil)
+	advance(30 * time.Second)
+	s.Add("order-3", 1, nil)
+
+	// order-2's gap is accepted first, after which it is idle too
+	advance(30 * time.Second)
+	if released := s.Expire(); !reflect.DeepEqual(sequences(released), []int64{3}) {
+		t.Errorf("expected order-2 to release [3], got %v", sequences(released))
+	}
+	if s.Keys() != 1 {
+		t.Errorf("expected only order-3 remembered, got %d keys", s.Keys())
+	}
+
+	// A forgotten key starts again at the next sequence added
+	if released := s.Add("order-1", 7, nil); !reflect.DeepEqual(sequences(released), []int64{7}) {
+		t.Errorf("expected [7], got %v", sequences(released))
+	}
+}
+
+func TestSequencer_KeyLimitForgetsLeastRecentlyUsed(t *testing.T) {
+	s, _ := testSequencer(time.Hour, 10)
+	s.SetKeyLimits(2, 0)
+
+	s.Add("order-1", 1, nil)
+	s.Add("order-1", 3, nil)
+	s.Add("order-2", 1, nil)
+	s.Add("order-1", 4, nil)
+
+	// order-2 is least recently used, and has nothing held
+	if released := s.Add("order-3", 1, nil); !reflect.DeepEqual(sequences(released), []int64{1}) {
+		t.Errorf("expected [1], got %v", sequences(released))
+	}
+
+	// Forgetting order-1 releases what it held rather than losing it
+	released := s.Add("order-4", 1, nil)
+	if got := sequences(released); !reflect.DeepEqual(got, []int64{1, 3, 4}) {
+		t.Errorf("expected [1 3 4], got %v", got)
+	}
+	if released[1].Key != "order-1" {
+		t.Errorf("expected order-1's events, got %+v", released[1])
+	}
+	if s.Keys() != 2 || s.Pending() != 0 {
+		t.Errorf("expected 2 keys and nothing pending, got %d and %d", s.Keys(), s.Pending())
+	}
+}
+
+func TestNewSequencer_Defaults(t *testing.T) {
+	s := NewSequencer("test", 0, 0, nil)
+
+	if s.grace != DefaultGraceWindow || s.capacity != DefaultSequencerCapacity {
+		t.Errorf("expected defaults, got %v and %d", s.grace, s.capacity)
+	}
+	if s.maxKeys != DefaultSequencerKeys || s.idleTTL != DefaultSequencerIdleTTL {
+		t.Errorf("expected default key limits, got %d and %v", s.maxKeys, s.idleTTL)
+	}
+}
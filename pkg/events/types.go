@@ -2,6 +2,7 @@ package events
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -24,6 +25,9 @@ type EventMetadata struct {
 	TraceID       string `json:"trace_id"`
 	Version       string `json:"version"`
 	Priority      int    `json:"priority,omitempty"`
+	// Replay marks an event republished from an archive rather than produced
+	// live. Consumers count it apart and skip side effects already applied.
+	Replay bool `json:"replay,omitempty"`
 }
 
 // CrossRegionEvent wraps a BaseEvent for cross-region transmission
@@ -37,6 +41,7 @@ type CrossRegionEvent struct {
 
 // CDCEvent represents a Change Data Capture event from Qlik
 type CDCEvent struct {
+	EventID       string                 `json:"event_id,omitempty"`
 	Operation     string                 `json:"operation"` // INSERT, UPDATE, DELETE, REFRESH
 	TableName     string                 `json:"table_name"`
 	Schema        string                 `json:"schema"`
@@ -58,6 +63,12 @@ type CDCMetadata struct {
 	Partition      int32     `json:"partition"`
 	CaptureTime    time.Time `json:"capture_time"`
 	ApplyTime      time.Time `json:"apply_time,omitempty"`
+	// StreamViewType is the DynamoDB stream view type the event was captured with
+	StreamViewType string `json:"stream_view_type,omitempty"`
+	// ImagesUnavailable is set when the source stream does not carry item images (KEYS_ONLY)
+	ImagesUnavailable bool `json:"images_unavailable,omitempty"`
+	// MissingImages lists images the stream view type promises but the record lacked
+	MissingImages []string `json:"missing_images,omitempty"`
 }
 
 // EventRecord represents a DynamoDB Stream record
@@ -86,11 +97,15 @@ type DynamoDBStreamRecord struct {
 type HealthCheckEvent struct {
 	Region        string            `json:"region"`
 	Service       string            `json:"service"`
-	Status        string            `json:"status"` // healthy, degraded, unhealthy
+	Status        string            `json:"status"` // healthy, degraded, unhealthy, maintenance
 	Timestamp     time.Time         `json:"timestamp"`
 	Dependencies  []DependencyCheck `json:"dependencies"`
 	Metrics       HealthMetrics     `json:"metrics"`
 	ErrorMessages []string          `json:"error_messages,omitempty"`
+
+	// UnderlyingStatus is the status the checks found when Status was
+	// overridden for a maintenance window
+	UnderlyingStatus string `json:"underlying_status,omitempty"`
 }
 
 // DependencyCheck represents the status of a dependency
@@ -111,6 +126,23 @@ type HealthMetrics struct {
 	ErrorRate   float64 `json:"error_rate"`
 }
 
+// Dead-letter error types, the ErrorType of a DeadLetterEvent
+const (
+	// ErrorTypeValidationFailure is an event that can't succeed as is and
+	// needs review
+	ErrorTypeValidationFailure = "validation_failure"
+
+	// ErrorTypeRoutingFailure is an event the router failed to publish
+	ErrorTypeRoutingFailure = "routing_failure"
+
+	// ErrorTypeProcessingFailure is a CDC event the stream processor failed
+	// to apply
+	ErrorTypeProcessingFailure = "cdc_processing_failure"
+
+	// ErrorTypePanic is a record whose processing panicked
+	ErrorTypePanic = "panic"
+)
+
 // DeadLetterEvent wraps events that failed processing
 type DeadLetterEvent struct {
 	OriginalEvent json.RawMessage `json:"original_event"`
@@ -121,6 +153,42 @@ type DeadLetterEvent struct {
 	LastFailure   time.Time       `json:"last_failure"`
 	SourceHandler string          `json:"source_handler"`
 	StackTrace    string          `json:"stack_trace,omitempty"`
+
+	// Diagnostic context, populated when available
+	RequestID       string `json:"request_id,omitempty"`
+	FunctionName    string `json:"function_name,omitempty"`
+	FunctionVersion string `json:"function_version,omitempty"`
+	Region          string `json:"region,omitempty"`
+	EventSourceARN  string `json:"event_source_arn,omitempty"`
+
+	// AWS service error that caused the failure, for correlation with AWS support
+	AWSErrorCode string `json:"aws_error_code,omitempty"`
+	AWSRequestID string `json:"aws_request_id,omitempty"`
+}
+
+// RecordFailure records another failed processing attempt, for an event that
+// re-entered processing from the DLQ and failed again
+func (e *DeadLetterEvent) RecordFailure(err error, at time.Time) {
+	e.FailureCount++
+	if e.FirstFailure.IsZero() {
+		e.FirstFailure = at
+	}
+	e.LastFailure = at
+	if err != nil {
+		e.ErrorMessage = err.Error()
+	}
+}
+
+// DLQEscalation reports a dead-letter queue whose oldest message has waited
+// longer than allowed
+type DLQEscalation struct {
+	QueueURL        string    `json:"queue_url"`
+	Severity        string    `json:"severity"`
+	OldestMessageID string    `json:"oldest_message_id"`
+	OldestSentAt    time.Time `json:"oldest_sent_at"`
+	AgeSeconds      int64     `json:"age_seconds"`
+	MaxAgeSeconds   int64     `json:"max_age_seconds"`
+	DetectedAt      time.Time `json:"detected_at"`
 }
 
 // TransformedEvent represents an event after transformation/enrichment
@@ -132,11 +200,18 @@ type TransformedEvent struct {
 	TransformedAt       time.Time              `json:"transformed_at"`
 }
 
-// ValidationError represents a validation failure
+// ValidationError represents a validation failure. An empty Severity is
+// SeverityError.
 type ValidationError struct {
-	Field   string `json:"field"`
-	Message string `json:"message"`
-	Code    string `json:"code"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+	Code     string `json:"code"`
+	Severity string `json:"severity,omitempty"`
+}
+
+// IsWarning reports whether the failure is advisory and should not block the event
+func (e ValidationError) IsWarning() bool {
+	return e.Severity == SeverityWarning
 }
 
 // EventBatch represents a batch of events for bulk processing
@@ -171,6 +246,7 @@ const (
 	EventTypeCrossRegion        = "cross_region.event"
 	EventTypeHealthCheck        = "health.check"
 	EventTypeCircuitBreakerOpen = "circuit_breaker.open"
+	EventTypeDLQEscalation      = "dlq.escalation"
 )
 
 // Operation types for CDC
@@ -179,6 +255,35 @@ const (
 	OperationUpdate  = "UPDATE"
 	OperationDelete  = "DELETE"
 	OperationRefresh = "REFRESH"
+
+	// OperationRefreshEnd marks the end of a full load on one partition. The
+	// loader writes one marker to every partition the REFRESH rows went to.
+	OperationRefreshEnd = "REFRESH_END"
+)
+
+// DynamoDB stream view types
+const (
+	StreamViewKeysOnly        = "KEYS_ONLY"
+	StreamViewNewImage        = "NEW_IMAGE"
+	StreamViewOldImage        = "OLD_IMAGE"
+	StreamViewNewAndOldImages = "NEW_AND_OLD_IMAGES"
+)
+
+// Stream image names reported in CDCMetadata.MissingImages
+const (
+	ImageNew = "new_image"
+	ImageOld = "old_image"
+)
+
+// Validation error severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Escalation severities
+const (
+	SeverityHigh = "high"
 )
 
 // Health status constants
@@ -186,6 +291,10 @@ const (
 	StatusHealthy   = "healthy"
 	StatusDegraded  = "degraded"
 	StatusUnhealthy = "unhealthy"
+
+	// StatusMaintenance is reported instead of the checked status during a
+	// planned maintenance window
+	StatusMaintenance = "maintenance"
 )
 
 // Circuit breaker states
@@ -212,6 +321,7 @@ func NewBaseEvent(eventType, sourceRegion string, payload map[string]interface{}
 // NewCDCEvent creates a new CDC event
 func NewCDCEvent(operation, tableName string, after, before map[string]interface{}) *CDCEvent {
 	return &CDCEvent{
+		EventID:   generateEventID(),
 		Operation: operation,
 		TableName: tableName,
 		Timestamp: time.Now(),
@@ -223,11 +333,94 @@ func NewCDCEvent(operation, tableName string, after, before map[string]interface
 	}
 }
 
+// CDCEventType returns the canonical event type for a change to table, such
+// as "cdc.customers.insert"
+func CDCEventType(table, operation string) string {
+	return strings.ToLower("cdc." + table + "." + operation)
+}
+
+// CapturedAt returns when the change was captured from the source, falling
+// back to the event timestamp when the capture time is unknown
+func (e *CDCEvent) CapturedAt() time.Time {
+	if !e.Metadata.CaptureTime.IsZero() {
+		return e.Metadata.CaptureTime
+	}
+	return e.Timestamp
+}
+
+// ToBaseEvent maps the change to a BaseEvent of type CDCEventType. The payload
+// always carries the table_name, operation, before, after and primary_keys
+// keys, named as in the CDCEvent's JSON, so every producer emits one schema.
+// The event keeps the change's ID and timestamp when it has them.
+func (e *CDCEvent) ToBaseEvent(sourceRegion string) *BaseEvent {
+	event := NewBaseEvent(CDCEventType(e.TableName, e.Operation), sourceRegion, map[string]interface{}{
+		"table_name":   e.TableName,
+		"operation":    e.Operation,
+		"before":       e.Before,
+		"after":        e.After,
+		"primary_keys": e.PrimaryKeys,
+	})
+	if e.EventID != "" {
+		event.EventID = e.EventID
+	}
+	if !e.Timestamp.IsZero() {
+		event.Timestamp = e.Timestamp
+	}
+	return event
+}
+
+// ExpectedStreamImages returns the images a DynamoDB stream record should carry
+// for the given stream view type and event name (INSERT, MODIFY, REMOVE).
+// An empty or unknown view type expects nothing, so callers fall back to
+// whatever images are present.
+func ExpectedStreamImages(streamViewType, eventName string) []string {
+	var wantNew, wantOld bool
+	switch streamViewType {
+	case StreamViewNewImage:
+		wantNew = eventName != "REMOVE"
+	case StreamViewOldImage:
+		wantOld = eventName != "INSERT"
+	case StreamViewNewAndOldImages:
+		wantNew = eventName != "REMOVE"
+		wantOld = eventName != "INSERT"
+	}
+
+	var expected []string
+	if wantNew {
+		expected = append(expected, ImageNew)
+	}
+	if wantOld {
+		expected = append(expected, ImageOld)
+	}
+	return expected
+}
+
+// MissingStreamImages returns the expected images that are absent from a record
+func MissingStreamImages(streamViewType, eventName string, hasNewImage, hasOldImage bool) []string {
+	var missing []string
+	for _, image := range ExpectedStreamImages(streamViewType, eventName) {
+		if (image == ImageNew && !hasNewImage) || (image == ImageOld && !hasOldImage) {
+			missing = append(missing, image)
+		}
+	}
+	return missing
+}
+
 // ToJSON serializes an event to JSON
 func (e *BaseEvent) ToJSON() ([]byte, error) {
 	return json.Marshal(e)
 }
 
+// EventTime returns the time the event occurred
+func (e *BaseEvent) EventTime() time.Time {
+	return e.Timestamp
+}
+
+// IdempotencyKey returns the key identifying the event across retries, its EventID
+func (e *BaseEvent) IdempotencyKey() string {
+	return e.EventID
+}
+
 // FromJSON deserializes a BaseEvent from JSON
 func FromJSON(data []byte) (*BaseEvent, error) {
 	var event BaseEvent
@@ -237,19 +430,3 @@ func FromJSON(data []byte) (*BaseEvent, error) {
 	}
 	return &event, nil
 }
-
-// generateEventID generates a unique event ID
-func generateEventID() string {
-	// Simple implementation - in production use ULID or similar
-	return time.Now().Format("20060102150405") + "-" + randomString(8)
-}
-
-// randomString generates a random string of given length
-func randomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
-	result := make([]byte, length)
-	for i := range result {
-		result[i] = charset[time.Now().UnixNano()%int64(len(charset))]
-	}
-	return string(result)
-}
@@ -2,6 +2,7 @@ package events
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 )
@@ -138,9 +139,10 @@ func TestOperationConstants(t *testing.T) {
 		OperationUpdate,
 		OperationDelete,
 		OperationRefresh,
+		OperationRefreshEnd,
 	}
 
-	expectedOps := []string{"INSERT", "UPDATE", "DELETE", "REFRESH"}
+	expectedOps := []string{"INSERT", "UPDATE", "DELETE", "REFRESH", "REFRESH_END"}
 
 	for i, op := range operations {
 		if op != expectedOps[i] {
@@ -295,3 +297,153 @@ func TestTransformedEvent(t *testing.T) {
 		t.Errorf("Expected field 'email', got %s", transformed.ValidationErrors[0].Field)
 	}
 }
+
+func TestValidationError_IsWarning(t *testing.T) {
+	if (ValidationError{Code: "INVALID_TIMESTAMP"}).IsWarning() {
+		t.Error("Expected an unset severity to be an error")
+	}
+	if (ValidationError{Code: "INVALID_TIMESTAMP", Severity: SeverityError}).IsWarning() {
+		t.Error("Expected SeverityError not to be a warning")
+	}
+	if !(ValidationError{Code: "INVALID_TIMESTAMP", Severity: SeverityWarning}).IsWarning() {
+		t.Error("Expected SeverityWarning to be a warning")
+	}
+}
+
+func TestCDCEvent_ToBaseEvent(t *testing.T) {
+	capturedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	keys := map[string]interface{}{"id": "customer-1"}
+
+	tests := []struct {
+		operation string
+		before    map[string]interface{}
+		after     map[string]interface{}
+		eventType string
+	}{
+		{OperationInsert, nil, map[string]interface{}{"id": "customer-1", "name": "Ada"}, "cdc.customers.insert"},
+		{OperationUpdate, map[string]interface{}{"id": "customer-1", "name": "Ada"}, map[string]interface{}{"id": "customer-1", "name": "Grace"}, "cdc.customers.update"},
+		{OperationDelete, map[string]interface{}{"id": "customer-1", "name": "Grace"}, nil, "cdc.customers.delete"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			cdc := &CDCEvent{
+				EventID:     "change-1",
+				Operation:   tt.operation,
+				TableName:   "Customers",
+				Timestamp:   capturedAt,
+				Before:      tt.before,
+				After:       tt.after,
+				PrimaryKeys: keys,
+			}
+
+			event := cdc.ToBaseEvent("us-west-2")
+
+			if event.EventType != tt.eventType {
+				t.Errorf("Expected event type %s, got %s", tt.eventType, event.EventType)
+			}
+			if event.EventID != "change-1" || !event.Timestamp.Equal(capturedAt) || event.SourceRegion != "us-west-2" {
+				t.Errorf("Expected the change's ID, timestamp and region, got %s, %s, %s", event.EventID, event.Timestamp, event.SourceRegion)
+			}
+
+			// Every operation carries the same payload keys
+			for _, key := range []string{"table_name", "operation", "before", "after", "primary_keys"} {
+				if _, ok := event.Payload[key]; !ok {
+					t.Errorf("Expected payload key %s", key)
+				}
+			}
+			if len(event.Payload) != 5 {
+				t.Errorf("Expected 5 payload keys, got %d", len(event.Payload))
+			}
+			if event.Payload["operation"] != tt.operation || event.Payload["table_name"] != "Customers" {
+				t.Errorf("Unexpected payload %v", event.Payload)
+			}
+		})
+	}
+}
+
+func TestCDCEvent_ToBaseEvent_Defaults(t *testing.T) {
+	event := (&CDCEvent{Operation: OperationInsert, TableName: "orders"}).ToBaseEvent("us-east-1")
+
+	if event.EventID == "" {
+		t.Error("Expected a generated event ID")
+	}
+	if event.Timestamp.IsZero() {
+		t.Error("Expected a timestamp")
+	}
+}
+
+func TestMissingStreamImages(t *testing.T) {
+	tests := []struct {
+		name      string
+		viewType  string
+		eventName string
+		hasNew    bool
+		hasOld    bool
+		expected  []string
+	}{
+		{"keys only expects nothing", StreamViewKeysOnly, "MODIFY", false, false, nil},
+		{"unspecified view type expects nothing", "", "MODIFY", false, false, nil},
+		{"new and old modify complete", StreamViewNewAndOldImages, "MODIFY", true, true, nil},
+		{"new and old modify missing both", StreamViewNewAndOldImages, "MODIFY", false, false, []string{ImageNew, ImageOld}},
+		{"new and old insert needs only new", StreamViewNewAndOldImages, "INSERT", true, false, nil},
+		{"new and old remove needs only old", StreamViewNewAndOldImages, "REMOVE", false, false, []string{ImageOld}},
+		{"new image remove expects nothing", StreamViewNewImage, "REMOVE", false, false, nil},
+		{"old image modify missing old", StreamViewOldImage, "MODIFY", true, false, []string{ImageOld}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing := MissingStreamImages(tt.viewType, tt.eventName, tt.hasNew, tt.hasOld)
+			if len(missing) != len(tt.expected) {
+				t.Fatalf("Expected missing images %v, got %v", tt.expected, missing)
+			}
+			for i := range missing {
+				if missing[i] != tt.expected[i] {
+					t.Errorf("Expected missing images %v, got %v", tt.expected, missing)
+				}
+			}
+		})
+	}
+}
+
+func TestBaseEvent_EventTime(t *testing.T) {
+	ts := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	event := &BaseEvent{Timestamp: ts}
+
+	if !event.EventTime().Equal(ts) {
+		t.Errorf("Expected event time %v, got %v", ts, event.EventTime())
+	}
+}
+
+func TestDeadLetterEvent_RecordFailure(t *testing.T) {
+	first := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	retry := first.Add(time.Hour)
+	event := &DeadLetterEvent{
+		ErrorMessage: "timeout",
+		FailureCount: 1,
+		FirstFailure: first,
+		LastFailure:  first,
+	}
+
+	event.RecordFailure(errors.New("throttled"), retry)
+
+	if event.FailureCount != 2 {
+		t.Errorf("Expected failure count 2, got %d", event.FailureCount)
+	}
+	if !event.FirstFailure.Equal(first) {
+		t.Errorf("Expected first failure %v to be kept, got %v", first, event.FirstFailure)
+	}
+	if !event.LastFailure.Equal(retry) {
+		t.Errorf("Expected last failure %v, got %v", retry, event.LastFailure)
+	}
+	if event.ErrorMessage != "throttled" {
+		t.Errorf("Expected error message 'throttled', got '%s'", event.ErrorMessage)
+	}
+
+	fresh := &DeadLetterEvent{}
+	fresh.RecordFailure(nil, retry)
+	if fresh.FailureCount != 1 || !fresh.FirstFailure.Equal(retry) {
+		t.Errorf("Expected first failure recorded at %v with count 1, got %v with count %d", retry, fresh.FirstFailure, fresh.FailureCount)
+	}
+}
@@ -0,0 +1,172 @@
+package events
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+)
+
+// UTF8Policy says what happens to an event whose strings aren't valid UTF-8,
+// as can come from binary columns mistyped as text
+type UTF8Policy string
+
+const (
+	// UTF8Replace replaces invalid sequences with U+FFFD and processes the event
+	UTF8Replace UTF8Policy = "replace"
+	// UTF8DeadLetter sends the event to the DLQ untouched
+	UTF8DeadLetter UTF8Policy = "dlq"
+)
+
+// ParseUTF8Policy parses a policy name, case-insensitively. An empty name is UTF8Replace.
+func ParseUTF8Policy(name string) (UTF8Policy, error) {
+	switch policy := UTF8Policy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "":
+		return UTF8Replace, nil
+	case UTF8Replace, UTF8DeadLetter:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown UTF-8 policy: %s", name)
+	}
+}
+
+// ErrInvalidUTF8 is returned for an event UTF8DeadLetter sends to the DLQ
+var ErrInvalidUTF8 = errors.New("event contains invalid UTF-8")
+
+// Apply enforces the policy on the strings of values for function. Under
+// UTF8DeadLetter an event with invalid UTF-8 is left untouched and
+// ErrInvalidUTF8 returned; otherwise invalid sequences are replaced in place.
+// Either way the event is counted in metrics.InvalidUTF8Events.
+func (p UTF8Policy) Apply(function string, values ...map[string]interface{}) error {
+	valid := true
+	for _, v := range values {
+		if !ValidUTF8(v) {
+			valid = false
+			break
+		}
+	}
+	if valid {
+		return nil
+	}
+
+	if err := p.reject(function); err != nil {
+		return err
+	}
+	for _, v := range values {
+		SanitizeUTF8(v)
+	}
+	return nil
+}
+
+// ApplyToText enforces the policy on encoded text, such as a JSON message,
+// before decoding replaces invalid sequences unseen. It returns the text to
+// decode, with invalid sequences replaced under UTF8Replace.
+func (p UTF8Policy) ApplyToText(function string, data []byte) ([]byte, error) {
+	if utf8.Valid(data) {
+		return data, nil
+	}
+	if err := p.reject(function); err != nil {
+		return nil, err
+	}
+	return bytes.ToValidUTF8(data, []byte(string(utf8.RuneError))), nil
+}
+
+// reject counts an event with invalid UTF-8 and returns ErrInvalidUTF8 if the
+// policy dead-letters it
+func (p UTF8Policy) reject(function string) error {
+	if p == UTF8DeadLetter {
+		metrics.InvalidUTF8Events.WithLabelValues(function, "dead_lettered").Inc()
+		return ErrInvalidUTF8
+	}
+	metrics.InvalidUTF8Events.WithLabelValues(function, "sanitized").Inc()
+	return nil
+}
+
+// ApplyToCDCEvent enforces the policy on a CDC event's images and keys
+func (p UTF8Policy) ApplyToCDCEvent(function string, event *CDCEvent) error {
+	return p.Apply(function, event.Before, event.After, event.PrimaryKeys)
+}
+
+// ValidUTF8 reports whether every string in values, including map keys and
+// strings nested in maps and slices, is valid UTF-8
+func ValidUTF8(values map[string]interface{}) bool {
+	for key, value := range values {
+		if !utf8.ValidString(key) || !validUTF8Value(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func validUTF8Value(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return utf8.ValidString(v)
+	case map[string]interface{}:
+		return ValidUTF8(v)
+	case []interface{}:
+		for _, item := range v {
+			if !validUTF8Value(item) {
+				return false
+			}
+		}
+	case []string:
+		for _, item := range v {
+			if !utf8.ValidString(item) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SanitizeUTF8 replaces invalid UTF-8 sequences with U+FFFD in the strings of
+// values, in place and including nested maps and slices, and returns how many
+// strings it changed
+func SanitizeUTF8(values map[string]interface{}) int {
+	changed := 0
+	for key, value := range values {
+		sanitized, n := sanitizeUTF8Value(value)
+		changed += n
+		if !utf8.ValidString(key) {
+			delete(values, key)
+			key = strings.ToValidUTF8(key, string(utf8.RuneError))
+			changed++
+		}
+		values[key] = sanitized
+	}
+	return changed
+}
+
+func sanitizeUTF8Value(value interface{}) (interface{}, int) {
+	switch v := value.(type) {
+	case string:
+		if utf8.ValidString(v) {
+			return v, 0
+		}
+		return strings.ToValidUTF8(v, string(utf8.RuneError)), 1
+	case map[string]interface{}:
+		return v, SanitizeUTF8(v)
+	case []interface{}:
+		changed := 0
+		for i, item := range v {
+			var n int
+			v[i], n = sanitizeUTF8Value(item)
+			changed += n
+		}
+		return v, changed
+	case []string:
+		changed := 0
+		for i, item := range v {
+			if !utf8.ValidString(item) {
+				v[i] = strings.ToValidUTF8(item, string(utf8.RuneError))
+				changed++
+			}
+		}
+		return v, changed
+	}
+	return value, 0
+}
@@ -0,0 +1,147 @@
+package events
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wgu/go-performance-enablement/pkg/metrics"
+)
+
+func TestSanitizeUTF8(t *testing.T) {
+	payload := map[string]interface{}{
+		"name":  "caf\xe9",
+		"valid": "café ☕",
+		"nested": map[string]interface{}{
+			"notes": []interface{}{"ok", "bad\xff\xfe"},
+		},
+		"tags":       []string{"a", "\xc3"},
+		"count":      3,
+		"bad\x80key": "value",
+	}
+
+	if ValidUTF8(payload) {
+		t.Fatal("expected payload with invalid bytes to be invalid")
+	}
+
+	changed := SanitizeUTF8(payload)
+
+	if changed != 4 {
+		t.Errorf("expected 4 strings changed, got %d", changed)
+	}
+	expected := map[string]interface{}{
+		"name":  "caf�",
+		"valid": "café ☕",
+		"nested": map[string]interface{}{
+			"notes": []interface{}{"ok", "bad�"},
+		},
+		"tags":    []string{"a", "�"},
+		"count":   3,
+		"bad�key": "value",
+	}
+	if !reflect.DeepEqual(expected, payload) {
+		t.Errorf("unexpected sanitized payload: %#v", payload)
+	}
+	if !ValidUTF8(payload) {
+		t.Error("expected sanitized payload to be valid")
+	}
+}
+
+func TestSanitizeUTF8_ValidUntouched(t *testing.T) {
+	payload := map[string]interface{}{"name": "Zoë", "city": "Kraków", "emoji": "🚀"}
+
+	if !ValidUTF8(payload) {
+		t.Fatal("expected valid payload")
+	}
+	if changed := SanitizeUTF8(payload); changed != 0 {
+		t.Errorf("expected no changes, got %d", changed)
+	}
+	if !reflect.DeepEqual(map[string]interface{}{"name": "Zoë", "city": "Kraków", "emoji": "🚀"}, payload) {
+		t.Errorf("valid payload was modified: %#v", payload)
+	}
+	if !ValidUTF8(nil) || SanitizeUTF8(nil) != 0 {
+		t.Error("expected a nil payload to be valid and unchanged")
+	}
+}
+
+func TestParseUTF8Policy(t *testing.T) {
+	for name, expected := range map[string]UTF8Policy{"": UTF8Replace, "replace": UTF8Replace, " DLQ ": UTF8DeadLetter} {
+		policy, err := ParseUTF8Policy(name)
+		if err != nil || policy != expected {
+			t.Errorf("ParseUTF8Policy(%q) = %q, %v; want %q", name, policy, err, expected)
+		}
+	}
+	if _, err := ParseUTF8Policy("drop"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
+
+func TestUTF8Policy_ApplyReplaces(t *testing.T) {
+	metrics.InvalidUTF8Events.Reset()
+	event := &CDCEvent{
+		After:       map[string]interface{}{"name": "caf\xe9"},
+		PrimaryKeys: map[string]interface{}{"id": "cust-1"},
+	}
+
+	if err := UTF8Replace.ApplyToCDCEvent("test", event); err != nil {
+		t.Fatalf("expected invalid UTF-8 to be replaced, got %v", err)
+	}
+	if event.After["name"] != "caf�" {
+		t.Errorf("expected sanitized name, got %q", event.After["name"])
+	}
+	if got := testutil.ToFloat64(metrics.InvalidUTF8Events.WithLabelValues("test", "sanitized")); got != 1 {
+		t.Errorf("expected 1 sanitized event, got %v", got)
+	}
+}
+
+func TestUTF8Policy_ApplyDeadLetters(t *testing.T) {
+	metrics.InvalidUTF8Events.Reset()
+	payload := map[string]interface{}{"name": "caf\xe9"}
+
+	if err := UTF8DeadLetter.Apply("test", payload); !errors.Is(err, ErrInvalidUTF8) {
+		t.Fatalf("expected ErrInvalidUTF8, got %v", err)
+	}
+	if payload["name"] != "caf\xe9" {
+		t.Errorf("expected dead-lettered payload untouched, got %q", payload["name"])
+	}
+	if got := testutil.ToFloat64(metrics.InvalidUTF8Events.WithLabelValues("test", "dead_lettered")); got != 1 {
+		t.Errorf("expected 1 dead-lettered event, got %v", got)
+	}
+}
+
+func TestUTF8Policy_ApplyValidUncounted(t *testing.T) {
+	metrics.InvalidUTF8Events.Reset()
+
+	if err := UTF8DeadLetter.Apply("test", map[string]interface{}{"name": "café"}, nil); err != nil {
+		t.Errorf("expected valid payload to pass, got %v", err)
+	}
+	if got := testutil.CollectAndCount(metrics.InvalidUTF8Events); got != 0 {
+		t.Errorf("expected nothing counted, got %d", got)
+	}
+}
+
+func TestUTF8Policy_ApplyToText(t *testing.T) {
+	metrics.InvalidUTF8Events.Reset()
+	data := []byte(`{"name":"caf` + "\xe9" + `"}`)
+
+	if _, err := UTF8DeadLetter.ApplyToText("test", data); !errors.Is(err, ErrInvalidUTF8) {
+		t.Fatalf("expected ErrInvalidUTF8, got %v", err)
+	}
+
+	sanitized, err := UTF8Replace.ApplyToText("test", data)
+	if err != nil {
+		t.Fatalf("expected invalid UTF-8 to be replaced, got %v", err)
+	}
+	if string(sanitized) != `{"name":"caf�"}` {
+		t.Errorf("expected sanitized text, got %q", sanitized)
+	}
+
+	valid := []byte(`{"name":"café"}`)
+	if out, err := UTF8DeadLetter.ApplyToText("test", valid); err != nil || string(out) != string(valid) {
+		t.Errorf("expected valid text unchanged, got %q, %v", out, err)
+	}
+	if got := testutil.ToFloat64(metrics.InvalidUTF8Events.WithLabelValues("test", "sanitized")); got != 1 {
+		t.Errorf("expected 1 sanitized event, got %v", got)
+	}
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// FormatJSON writes structured JSON lines, as expected by CloudWatch
+	FormatJSON = "json"
+	// FormatConsole writes human-readable lines for local debugging
+	FormatConsole = "console"
+)
+
+// New builds a logger from LOG_LEVEL (debug, info, warn or error) and
+// LOG_FORMAT (json or console), defaulting to JSON at info level
+func New() (*zap.Logger, error) {
+	config, err := NewConfig(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		return nil, err
+	}
+	return config.Build()
+}
+
+// NewConfig returns the zap config for level and format. Empty values take
+// the defaults. The console format uses zap's development settings.
+func NewConfig(level, format string) (zap.Config, error) {
+	var config zap.Config
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", FormatJSON:
+		config = zap.NewProductionConfig()
+	case FormatConsole:
+		config = zap.NewDevelopmentConfig()
+	default:
+		return zap.Config{}, fmt.Errorf("invalid LOG_FORMAT %q: want %s or %s", format, FormatJSON, FormatConsole)
+	}
+
+	zapLevel := zapcore.InfoLevel
+	if level = strings.TrimSpace(level); level != "" {
+		var err error
+		zapLevel, err = parseLevel(level)
+		if err != nil {
+			return zap.Config{}, err
+		}
+	}
+	config.Level = zap.NewAtomicLevelAt(zapLevel)
+	return config, nil
+}
+
+// parseLevel accepts the levels worth setting on a service; zap's panic and
+// fatal levels would silence almost everything
+func parseLevel(level string) (zapcore.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return zapcore.DebugLevel, nil
+	case "info":
+		return zapcore.InfoLevel, nil
+	case "warn", "warning":
+		return zapcore.WarnLevel, nil
+	case "error":
+		return zapcore.ErrorLevel, nil
+	}
+	return zapcore.InfoLevel, fmt.Errorf("invalid LOG_LEVEL %q: want debug, info, warn or error", level)
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew_Defaults(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("LOG_FORMAT", "")
+
+	logger, err := New()
+	assert.NoError(t, err)
+	assert.True(t, logger.Core().Enabled(zapcore.InfoLevel))
+	assert.False(t, logger.Core().Enabled(zapcore.DebugLevel))
+
+	config, err := NewConfig("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatJSON, config.Encoding)
+	assert.False(t, config.Development)
+}
+
+func TestNew_FromEnvironment(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "console")
+
+	logger, err := New()
+	assert.NoError(t, err)
+	assert.True(t, logger.Core().Enabled(zapcore.DebugLevel))
+}
+
+func TestNewConfig_Levels(t *testing.T) {
+	tests := []struct {
+		level   string
+		enabled zapcore.Level
+	}{
+		{"debug", zapcore.DebugLevel},
+		{"INFO", zapcore.InfoLevel},
+		{"warn", zapcore.WarnLevel},
+		{"warning", zapcore.WarnLevel},
+		{"error", zapcore.ErrorLevel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			config, err := NewConfig(tt.level, FormatJSON)
+			assert.NoError(t, err)
+
+			logger, err := config.Build()
+			assert.NoError(t, err)
+			assert.True(t, logger.Core().Enabled(tt.enabled))
+			assert.False(t, logger.Core().Enabled(tt.enabled-1))
+		})
+	}
+}
+
+func TestNewConfig_Formats(t *testing.T) {
+	config, err := NewConfig("info", "console")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatConsole, config.Encoding)
+	assert.Equal(t, zapcore.InfoLevel, config.Level.Level())
+
+	config, err = NewConfig("info", "JSON")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatJSON, config.Encoding)
+}
+
+func TestNewConfig_Invalid(t *testing.T) {
+	_, err := NewConfig("verbose", FormatJSON)
+	assert.Error(t, err)
+
+	_, err = NewConfig("info", "xml")
+	assert.Error(t, err)
+}
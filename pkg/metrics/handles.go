@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FunctionMetrics holds the series of one Lambda function in one region,
+// resolved once so hot loops skip the label lookup and locking of
+// WithLabelValues on every call. Create one per function at init and share
+// it; it is safe for concurrent use. Handles stay bound to their series, so
+// resetting a metric vector, as tests do, detaches them.
+type FunctionMetrics struct {
+	function string
+	region   string
+
+	// Invocations and Duration are the function's LambdaInvocations and
+	// LambdaDuration series
+	Invocations prometheus.Counter
+	Duration    prometheus.Observer
+	// NoOpSkipped is the function's NoOpSkipped series
+	NoOpSkipped prometheus.Counter
+
+	// latency caches EventProcessingLatency series by event type
+	latency sync.Map
+}
+
+// NewFunctionMetrics resolves the series of function in region
+func NewFunctionMetrics(function, region string) *FunctionMetrics {
+	return &FunctionMetrics{
+		function:    function,
+		region:      region,
+		Invocations: LambdaInvocations.WithLabelValues(function, region),
+		Duration:    LambdaDuration.WithLabelValues(function, region),
+		NoOpSkipped: NoOpSkipped.WithLabelValues(function),
+	}
+}
+
+// RecordInvocation is RecordLambdaInvocation through the resolved series.
+// Errors are rare and labelled by message, so they are still looked up.
+func (m *FunctionMetrics) RecordInvocation(duration time.Duration, err error) {
+	m.Invocations.Inc()
+	m.Duration.Observe(duration.Seconds())
+	if err != nil {
+		LambdaErrors.WithLabelValues(m.function, m.region, err.Error()).Inc()
+	}
+}
+
+// EventLatency returns the function's EventProcessingLatency series for
+// eventType, resolving it on first use
+func (m *FunctionMetrics) EventLatency(eventType string) prometheus.Observer {
+	if observer, ok := m.latency.Load(eventType); ok {
+		return observer.(prometheus.Observer)
+	}
+	observer, _ := m.latency.LoadOrStore(eventType, EventProcessingLatency.WithLabelValues(m.function, eventType))
+	return observer.(prometheus.Observer)
+}
+
+// RecordEventLatency is the package RecordEventLatency through the cached
+// series, skipping the same unstamped, future and sampled-out events
+func (m *FunctionMetrics) RecordEventLatency(eventType string, timestamp time.Time) bool {
+	if timestamp.IsZero() || !SampleEvent(eventType) {
+		return false
+	}
+	latency := time.Since(timestamp)
+	if latency < 0 {
+		return false
+	}
+	m.EventLatency(eventType).Observe(latency.Seconds())
+	return true
+}
@@ -37,6 +37,15 @@ var (
 		[]string{"function", "region"},
 	)
 
+	EventProcessingLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "event_processing_latency_seconds",
+			Help:    "Time from an event's own timestamp to when it was processed, in seconds",
+			Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+		},
+		[]string{"function", "event_type"},
+	)
+
 	// Kafka consumer metrics
 	KafkaMessagesConsumed = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -54,6 +63,14 @@ var (
 		[]string{"topic", "partition", "consumer_group"},
 	)
 
+	KafkaConsumerOffsetLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_offset_lag",
+			Help: "Kafka consumer lag in messages between the committed offset and the high-water mark",
+		},
+		[]string{"topic", "partition", "consumer_group"},
+	)
+
 	KafkaProcessingDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "kafka_processing_duration_seconds",
@@ -71,6 +88,22 @@ var (
 		[]string{"topic", "consumer_group", "error_type"},
 	)
 
+	KafkaClusterMessagesConsumed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_cluster_messages_consumed_total",
+			Help: "Total number of Kafka messages consumed per cluster",
+		},
+		[]string{"cluster", "topic", "status"},
+	)
+
+	KafkaClusterConsumersActive = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_cluster_consumers_active",
+			Help: "Whether the consumer for a Kafka cluster is running (1=running, 0=stopped)",
+		},
+		[]string{"cluster"},
+	)
+
 	// CDC metrics
 	CDCEventsProcessed = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -89,6 +122,22 @@ var (
 		[]string{"operation", "table"},
 	)
 
+	CDCStaleChangesSkipped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cdc_stale_changes_skipped_total",
+			Help: "Total number of CDC changes skipped as older than the last change applied to the same row",
+		},
+		[]string{"table", "ordering"},
+	)
+
+	SequenceGapsAccepted = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sequence_gaps_accepted_total",
+			Help: "Total number of missing sequences given up on and skipped by source",
+		},
+		[]string{"source"},
+	)
+
 	// EventBridge metrics
 	EventBridgePublished = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -106,6 +155,22 @@ var (
 		[]string{"event_type", "region", "error_type"},
 	)
 
+	EventBridgeThrottled = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "eventbridge_throttled_total",
+			Help: "Total number of EventBridge publish attempts rejected by throttling",
+		},
+		[]string{"event_bus", "source"},
+	)
+
+	PublishDeduped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "publish_deduped_total",
+			Help: "Total number of cross-region publishes skipped as already published",
+		},
+		[]string{"source", "target_region"},
+	)
+
 	// Circuit breaker metrics
 	CircuitBreakerState = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -123,6 +188,22 @@ var (
 		[]string{"service", "region"},
 	)
 
+	CircuitBreakerOpenSeconds = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_open_seconds",
+			Help: "How long the circuit breaker has been continuously open, 0 while closed",
+		},
+		[]string{"service", "region"},
+	)
+
+	CircuitBreakerRecoveries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_recoveries_total",
+			Help: "Total number of circuit breaker recoveries from open to closed",
+		},
+		[]string{"service", "region"},
+	)
+
 	// DynamoDB metrics
 	DynamoDBOperations = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -140,6 +221,24 @@ var (
 		[]string{"table", "operation", "region", "error_type"},
 	)
 
+	ReplicaDeletesSkipped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "replica_deletes_skipped_total",
+			Help: "Total number of replicated deletes skipped because the replica item has a newer version",
+		},
+		[]string{"table"},
+	)
+
+	// AWS API call metrics
+	AWSOperationDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "aws_operation_duration_seconds",
+			Help:    "AWS API call duration in seconds",
+			Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		},
+		[]string{"service", "operation"},
+	)
+
 	// Cross-region replication metrics
 	CrossRegionEvents = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -158,6 +257,93 @@ var (
 		[]string{"source_region", "target_region"},
 	)
 
+	// CrossRegionProbeLatency tracks the health checker's round trip to a
+	// partner region's API, kept apart from replication latency
+	CrossRegionProbeLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "cross_region_probe_latency_seconds",
+			Help:    "Health check API round trip to another region in seconds",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		},
+		[]string{"source_region", "target_region"},
+	)
+
+	// StreamRecordSize tracks the size of DynamoDB stream records and of the
+	// events routed for them, by StreamSizeStage, for EventBridge cost and
+	// size limits
+	StreamRecordSize = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "stream_record_size_bytes",
+			Help:    "Size of DynamoDB stream records and of the events published for them in bytes",
+			Buckets: prometheus.ExponentialBuckets(256, 2, 11), // 256B to EventBridge's 256KB limit
+		},
+		[]string{"table", "stage"},
+	)
+
+	// Tenant metrics, labeled through TenantLabel to bound cardinality
+	TenantEventsProcessed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tenant_events_processed_total",
+			Help: "Total number of events processed per tenant",
+		},
+		[]string{"function", "tenant", "status"},
+	)
+
+	// Replay metrics, kept apart from the live event counters so a replay
+	// doesn't inflate them
+	ReplayedEventsProcessed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "replayed_events_processed_total",
+			Help: "Total number of replayed events processed",
+		},
+		[]string{"function", "event_type", "status"},
+	)
+
+	// Validation metrics, labeled through ValidationFieldLabel and
+	// ValidationCodeLabel to bound cardinality
+	ValidationErrors = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "validation_errors_total",
+			Help: "Total number of event validation errors by field and code",
+		},
+		[]string{"field", "code"},
+	)
+
+	// Event buffer metrics
+	EventBufferSpilled = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_buffer_spilled_total",
+			Help: "Total number of un-routed events spilled to the SQS spill queue",
+		},
+		[]string{"function"},
+	)
+
+	EventBufferDrained = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_buffer_drained_total",
+			Help: "Total number of spilled events drained back and published",
+		},
+		[]string{"function"},
+	)
+
+	// Stale event metrics
+	StaleEventsDropped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_stale_dropped_total",
+			Help: "Total number of events dropped for exceeding their maximum age",
+		},
+		[]string{"function", "event_type"},
+	)
+
+	// No-op change metrics
+	NoOpSkipped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_noop_skipped_total",
+			Help: "Total number of MODIFY events skipped because the item content did not change",
+		},
+		[]string{"function"},
+	)
+
 	// Dead letter queue metrics
 	DLQMessages = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -166,11 +352,79 @@ var (
 		},
 		[]string{"source", "error_type"},
 	)
+
+	PermanentFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dlq_permanent_failures_total",
+			Help: "Total number of events parked as permanent failures after exceeding the retry limit",
+		},
+		[]string{"source", "error_type"},
+	)
+
+	DLQOldestMessageAge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dlq_oldest_message_age_seconds",
+			Help: "Age in seconds of the oldest message seen on a DLQ",
+		},
+		[]string{"queue"},
+	)
+
+	DLQEscalations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dlq_escalations_total",
+			Help: "Total number of escalations for DLQ messages older than the allowed age",
+		},
+		[]string{"queue"},
+	)
+
+	SQSPolls = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sqs_polls_total",
+			Help: "Total number of SQS receive polls by result (messages, empty or error)",
+		},
+		[]string{"queue", "result"},
+	)
+
+	// Invalid UTF-8 metrics
+	InvalidUTF8Events = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_invalid_utf8_total",
+			Help: "Total number of events with invalid UTF-8 strings by action (sanitized or dead_lettered)",
+		},
+		[]string{"function", "action"},
+	)
+
+	// Attribute conversion metrics
+	AttributeMaxDepthExceeded = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "attribute_max_depth_exceeded_total",
+			Help: "Total number of stream images truncated for nesting deeper than the maximum attribute depth",
+		},
+	)
+
+	// Metric sampling
+	EventMetricSampleRate = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "event_metric_sample_rate",
+			Help: "Sample rate of per-event metrics for sampled event types; one in this many events is recorded",
+		},
+		[]string{"event_type"},
+	)
+
+	// Enrichment metrics
+	EnrichmentTimeouts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "enrichment_timeout_total",
+			Help: "Total number of events published with partial enrichment after the enrichment budget ran out",
+		},
+		[]string{"function"},
+	)
 )
 
 // MetricsServer provides HTTP endpoint for Prometheus metrics
 type MetricsServer struct {
 	addr   string
+	mux    *http.ServeMux
 	server *http.Server
 }
 
@@ -183,6 +437,7 @@ func NewMetricsServer(addr string) *MetricsServer {
 
 	return &MetricsServer{
 		addr: addr,
+		mux:  mux,
 		server: &http.Server{
 			Addr:         addr,
 			Handler:      mux,
@@ -192,6 +447,12 @@ func NewMetricsServer(addr string) *MetricsServer {
 	}
 }
 
+// Handle registers an additional handler, such as a debug endpoint, on the
+// server. Call it before Start.
+func (s *MetricsServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
 // Start starts the metrics server
 func (s *MetricsServer) Start() error {
 	return s.server.ListenAndServe()
@@ -230,6 +491,23 @@ func RecordLambdaInvocation(function, region string, duration time.Duration, err
 	}
 }
 
+// RecordEventLatency observes the end-to-end latency of an event stamped at
+// timestamp. Events stamped in the future by producer clock skew, or not
+// stamped at all, are skipped rather than recorded as negative latency, as
+// are events of sampled types left out by SampleEvent; the return value
+// reports whether the latency was observed.
+func RecordEventLatency(function, eventType string, timestamp time.Time) bool {
+	if timestamp.IsZero() || !SampleEvent(eventType) {
+		return false
+	}
+	latency := time.Since(timestamp)
+	if latency < 0 {
+		return false
+	}
+	EventProcessingLatency.WithLabelValues(function, eventType).Observe(latency.Seconds())
+	return true
+}
+
 // RecordKafkaMessage records Kafka message processing
 func RecordKafkaMessage(topic, partition, consumerGroup string, duration time.Duration, err error) {
 	KafkaMessagesConsumed.WithLabelValues(topic, partition, consumerGroup).Inc()
@@ -244,12 +522,41 @@ func RecordKafkaMessage(topic, partition, consumerGroup string, duration time.Du
 	}
 }
 
+// RecordKafkaClusterMessage records a consumed message against its source cluster
+func RecordKafkaClusterMessage(cluster, topic string, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	KafkaClusterMessagesConsumed.WithLabelValues(cluster, topic, status).Inc()
+}
+
 // RecordCDCEvent records CDC event processing
 func RecordCDCEvent(operation, table, source string, duration time.Duration) {
 	CDCEventsProcessed.WithLabelValues(operation, table, source).Inc()
 	CDCProcessingDuration.WithLabelValues(operation, table).Observe(duration.Seconds())
 }
 
+// Stages of StreamRecordSize: the stream record as DynamoDB reports it, and
+// the event serialized for publishing
+const (
+	StreamSizeStageRecord = "record"
+	StreamSizeStageEvent  = "event"
+)
+
+// RecordStreamRecordSize observes the size of a stream record from table and
+// of the event published for it
+func RecordStreamRecordSize(table string, recordBytes, eventBytes int64) {
+	StreamRecordSize.WithLabelValues(table, StreamSizeStageRecord).Observe(float64(recordBytes))
+	StreamRecordSize.WithLabelValues(table, StreamSizeStageEvent).Observe(float64(eventBytes))
+}
+
+// RecordReplayedEvent records a replayed event, in place of the live event
+// metrics
+func RecordReplayedEvent(function, eventType, status string) {
+	ReplayedEventsProcessed.WithLabelValues(function, eventType, status).Inc()
+}
+
 // SetCircuitBreakerState sets the circuit breaker state metric
 func SetCircuitBreakerState(service, region, state string) {
 	var stateValue float64
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -162,6 +164,98 @@ func TestRecordKafkaMessage(t *testing.T) {
 	}
 }
 
+func TestRecordKafkaClusterMessage(t *testing.T) {
+	KafkaClusterMessagesConsumed.Reset()
+
+	RecordKafkaClusterMessage("on-prem", "qlik.customers", nil)
+	RecordKafkaClusterMessage("on-prem", "qlik.customers", nil)
+	RecordKafkaClusterMessage("cloud", "qlik.customers", errors.New("deserialize error"))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(KafkaClusterMessagesConsumed.WithLabelValues("on-prem", "qlik.customers", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(KafkaClusterMessagesConsumed.WithLabelValues("cloud", "qlik.customers", "error")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(KafkaClusterMessagesConsumed.WithLabelValues("cloud", "qlik.customers", "success")))
+}
+
+func TestRecordReplayedEvent(t *testing.T) {
+	ReplayedEventsProcessed.Reset()
+
+	RecordReplayedEvent("event-transformer", "INSERT", "success")
+	RecordReplayedEvent("event-transformer", "INSERT", "success")
+	RecordReplayedEvent("event-transformer", "MODIFY", "invalid")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(ReplayedEventsProcessed.WithLabelValues("event-transformer", "INSERT", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ReplayedEventsProcessed.WithLabelValues("event-transformer", "MODIFY", "invalid")))
+}
+
+func TestRecordStreamRecordSize(t *testing.T) {
+	StreamRecordSize.Reset()
+
+	RecordStreamRecordSize("orders", 300, 900)
+	RecordStreamRecordSize("orders", 500, 1100)
+
+	for _, tt := range []struct {
+		stage string
+		sum   float64
+	}{
+		{StreamSizeStageRecord, 800},
+		{StreamSizeStageEvent, 2000},
+	} {
+		histogram := &dto.Metric{}
+		assert.NoError(t, StreamRecordSize.WithLabelValues("orders", tt.stage).(prometheus.Histogram).Write(histogram))
+		assert.Equal(t, uint64(2), histogram.GetHistogram().GetSampleCount(), tt.stage)
+		assert.Equal(t, tt.sum, histogram.GetHistogram().GetSampleSum(), tt.stage)
+	}
+}
+
+func TestTenantLabel(t *testing.T) {
+	SetTenantAllowlist([]string{"tenant-a", " tenant-b ", ""})
+	defer SetTenantAllowlist(nil)
+
+	assert.Equal(t, "tenant-a", TenantLabel("tenant-a"))
+	assert.Equal(t, "tenant-b", TenantLabel("tenant-b"))
+	assert.Equal(t, TenantLabelOther, TenantLabel("tenant-c"))
+	assert.Equal(t, TenantLabelNone, TenantLabel(""))
+}
+
+func TestRecordTenantEvent(t *testing.T) {
+	TenantEventsProcessed.Reset()
+	SetTenantAllowlist(ParseTenantAllowlist("tenant-a,tenant-b"))
+	defer SetTenantAllowlist(nil)
+
+	RecordTenantEvent("event-transformer", "tenant-a", "success")
+	RecordTenantEvent("event-transformer", "tenant-a", "success")
+	RecordTenantEvent("event-transformer", "tenant-b", "error")
+	RecordTenantEvent("event-transformer", "tenant-x", "success")
+	RecordTenantEvent("event-transformer", "tenant-y", "success")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(TenantEventsProcessed.WithLabelValues("event-transformer", "tenant-a", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(TenantEventsProcessed.WithLabelValues("event-transformer", "tenant-b", "error")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(TenantEventsProcessed.WithLabelValues("event-transformer", TenantLabelOther, "success")))
+	assert.Equal(t, 3, testutil.CollectAndCount(TenantEventsProcessed))
+}
+
+func TestSetTenantAllowlist_Empty(t *testing.T) {
+	SetTenantAllowlist(ParseTenantAllowlist(""))
+
+	assert.Equal(t, TenantLabelOther, TenantLabel("tenant-a"))
+}
+
+func TestRecordValidationError(t *testing.T) {
+	ValidationErrors.Reset()
+
+	RecordValidationError("event_id", "REQUIRED_FIELD")
+	RecordValidationError("event_id", "REQUIRED_FIELD")
+	RecordValidationError("payload.email", "INVALID_FORMAT")
+	RecordValidationError("payload.user_42", "INVALID_FORMAT")
+	RecordValidationError("timestamp", "TOO_OLD")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(ValidationErrors.WithLabelValues("event_id", "REQUIRED_FIELD")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ValidationErrors.WithLabelValues("payload.email", "INVALID_FORMAT")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ValidationErrors.WithLabelValues(ValidationLabelOther, "INVALID_FORMAT")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(ValidationErrors.WithLabelValues("timestamp", ValidationLabelOther)))
+	assert.Equal(t, 4, testutil.CollectAndCount(ValidationErrors))
+}
+
 func TestRecordCDCEvent(t *testing.T) {
 	// Reset metrics before test
 	CDCEventsProcessed.Reset()
@@ -209,6 +303,75 @@ func TestRecordCDCEvent(t *testing.T) {
 	}
 }
 
+func TestRecordEventLatency(t *testing.T) {
+	EventProcessingLatency.Reset()
+
+	// A recent event is observed with a small positive latency
+	assert.True(t, RecordEventLatency("event-transformer", "order.placed", time.Now().Add(-250*time.Millisecond)))
+
+	histogram := &dto.Metric{}
+	assert.NoError(t, EventProcessingLatency.WithLabelValues("event-transformer", "order.placed").(prometheus.Histogram).Write(histogram))
+	assert.Equal(t, uint64(1), histogram.GetHistogram().GetSampleCount())
+	assert.InDelta(t, 0.25, histogram.GetHistogram().GetSampleSum(), 0.2)
+
+	// Future timestamps from clock skew and missing ones are skipped
+	assert.False(t, RecordEventLatency("event-transformer", "order.shipped", time.Now().Add(time.Minute)))
+	assert.False(t, RecordEventLatency("event-transformer", "order.shipped", time.Time{}))
+	assert.Equal(t, 1, testutil.CollectAndCount(EventProcessingLatency))
+}
+
+func TestRecordEventLatency_Sampled(t *testing.T) {
+	EventProcessingLatency.Reset()
+	SetEventSampleRates(map[string]int{"inventory.updated": 10})
+	defer SetEventSampleRates(nil)
+
+	observed := 0
+	for i := 0; i < 100; i++ {
+		if RecordEventLatency("event-transformer", "inventory.updated", time.Now()) {
+			observed++
+		}
+		// Unconfigured types are recorded every time
+		assert.True(t, RecordEventLatency("event-transformer", "order.placed", time.Now()))
+	}
+
+	assert.InDelta(t, 10, observed, 1)
+	histogram := &dto.Metric{}
+	assert.NoError(t, EventProcessingLatency.WithLabelValues("event-transformer", "order.placed").(prometheus.Histogram).Write(histogram))
+	assert.Equal(t, uint64(100), histogram.GetHistogram().GetSampleCount())
+
+	assert.Equal(t, float64(10), testutil.ToFloat64(EventMetricSampleRate.WithLabelValues("inventory.updated")))
+	assert.Equal(t, 10, EventSampleRate("inventory.updated"))
+	assert.Equal(t, 1, EventSampleRate("order.placed"))
+}
+
+func TestParseEventSampleRates(t *testing.T) {
+	rates, err := ParseEventSampleRates(" inventory.updated=100, order.viewed = 10 ,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"inventory.updated": 100, "order.viewed": 10}, rates)
+
+	rates, err = ParseEventSampleRates("")
+	assert.NoError(t, err)
+	assert.Empty(t, rates)
+
+	for _, spec := range []string{"inventory.updated", "=10", "inventory.updated=often", "inventory.updated=0"} {
+		_, err := ParseEventSampleRates(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestSetEventSampleRates_ReplacesRates(t *testing.T) {
+	SetEventSampleRates(map[string]int{"inventory.updated": 100, "order.viewed": 1})
+	defer SetEventSampleRates(nil)
+
+	// A rate of 1 records every event and isn't exported
+	assert.Equal(t, 1, testutil.CollectAndCount(EventMetricSampleRate))
+
+	SetEventSampleRates(nil)
+	assert.Equal(t, 0, testutil.CollectAndCount(EventMetricSampleRate))
+	assert.True(t, SampleEvent("inventory.updated"))
+	assert.True(t, SampleEvent("inventory.updated"))
+}
+
 func TestSetCircuitBreakerState(t *testing.T) {
 	// Reset metrics before test
 	CircuitBreakerState.Reset()
@@ -261,21 +424,50 @@ func TestMetricsRegistration(t *testing.T) {
 		LambdaInvocations,
 		LambdaErrors,
 		LambdaDuration,
+		EventProcessingLatency,
 		KafkaMessagesConsumed,
 		KafkaConsumerLag,
+		KafkaConsumerOffsetLag,
 		KafkaProcessingDuration,
 		KafkaProcessingErrors,
+		KafkaClusterMessagesConsumed,
+		KafkaClusterConsumersActive,
 		CDCEventsProcessed,
 		CDCProcessingDuration,
+		CDCStaleChangesSkipped,
+		SequenceGapsAccepted,
 		EventBridgePublished,
 		EventBridgeErrors,
+		EventBridgeThrottled,
+		PublishDeduped,
 		CircuitBreakerState,
 		CircuitBreakerFailures,
+		CircuitBreakerOpenSeconds,
+		CircuitBreakerRecoveries,
 		DynamoDBOperations,
 		DynamoDBErrors,
+		ReplicaDeletesSkipped,
+		AWSOperationDuration,
 		CrossRegionEvents,
 		CrossRegionLatency,
+		CrossRegionProbeLatency,
+		StreamRecordSize,
+		EventBufferSpilled,
+		EventBufferDrained,
+		StaleEventsDropped,
+		NoOpSkipped,
+		PermanentFailures,
 		DLQMessages,
+		DLQOldestMessageAge,
+		DLQEscalations,
+		SQSPolls,
+		EventMetricSampleRate,
+		AttributeMaxDepthExceeded,
+		InvalidUTF8Events,
+		EnrichmentTimeouts,
+		TenantEventsProcessed,
+		ReplayedEventsProcessed,
+		ValidationErrors,
 	}
 
 	for _, metric := range metrics {
@@ -283,6 +475,19 @@ func TestMetricsRegistration(t *testing.T) {
 	}
 }
 
+func TestMetricsServerHandle(t *testing.T) {
+	server := NewMetricsServer(":0")
+	server.Handle("/circuit-breakers", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+
+	w := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/circuit-breakers", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "{}", w.Body.String())
+}
+
 func TestMetricsServerShutdown(t *testing.T) {
 	server := NewMetricsServer(":0") // Use port 0 to let OS assign a free port
 
@@ -298,3 +503,58 @@ func TestMetricsServerShutdown(t *testing.T) {
 	err := server.Shutdown(5 * time.Second)
 	assert.NoError(t, err)
 }
+
+func TestFunctionMetrics_SameSeries(t *testing.T) {
+	LambdaInvocations.Reset()
+	LambdaErrors.Reset()
+	LambdaDuration.Reset()
+	NoOpSkipped.Reset()
+	EventProcessingLatency.Reset()
+
+	m := NewFunctionMetrics("event-router", "us-west-2")
+	m.RecordInvocation(100*time.Millisecond, nil)
+	m.RecordInvocation(50*time.Millisecond, errors.New("processing error"))
+	m.NoOpSkipped.Inc()
+	assert.True(t, m.RecordEventLatency("order.created", time.Now().Add(-time.Second)))
+	assert.False(t, m.RecordEventLatency("order.created", time.Time{}))
+
+	// The handles and the package helpers share one series
+	RecordLambdaInvocation("event-router", "us-west-2", 10*time.Millisecond, nil)
+	RecordEventLatency("event-router", "order.created", time.Now().Add(-time.Second))
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(LambdaInvocations.WithLabelValues("event-router", "us-west-2")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(LambdaErrors.WithLabelValues("event-router", "us-west-2", "processing error")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(NoOpSkipped.WithLabelValues("event-router")))
+	assert.Equal(t, 1, testutil.CollectAndCount(LambdaDuration))
+	assert.Equal(t, 1, testutil.CollectAndCount(EventProcessingLatency))
+
+	var sample dto.Metric
+	assert.NoError(t, LambdaDuration.WithLabelValues("event-router", "us-west-2").(prometheus.Histogram).Write(&sample))
+	assert.Equal(t, uint64(3), sample.GetHistogram().GetSampleCount())
+	assert.NoError(t, EventProcessingLatency.WithLabelValues("event-router", "order.created").(prometheus.Histogram).Write(&sample))
+	assert.Equal(t, uint64(2), sample.GetHistogram().GetSampleCount())
+
+	assert.Same(t, m.EventLatency("order.created"), m.EventLatency("order.created"))
+}
+
+func BenchmarkFunctionMetrics(b *testing.B) {
+	b.Run("WithLabelValues", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				LambdaInvocations.WithLabelValues("bench-function", "us-west-2").Inc()
+				LambdaDuration.WithLabelValues("bench-function", "us-west-2").Observe(0.01)
+			}
+		})
+	})
+
+	b.Run("CachedHandles", func(b *testing.B) {
+		m := NewFunctionMetrics("bench-function", "us-west-2")
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				m.Invocations.Inc()
+				m.Duration.Observe(0.01)
+			}
+		})
+	})
+}
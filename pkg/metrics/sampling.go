@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// eventSampler records one in every rate events of a type
+type eventSampler struct {
+	rate uint64
+	seen atomic.Uint64
+}
+
+var (
+	samplingMu    sync.RWMutex
+	eventSamplers = map[string]*eventSampler{}
+)
+
+// SetEventSampleRates sets the event types whose per-event metrics are
+// sampled, recording one in every rate events. Types without a rate, or with
+// a rate of 1, are recorded every time. Each rate is exported as
+// event_metric_sample_rate so dashboards can scale sampled counts back up.
+func SetEventSampleRates(rates map[string]int) {
+	samplers := make(map[string]*eventSampler, len(rates))
+	EventMetricSampleRate.Reset()
+	for eventType, rate := range rates {
+		if rate <= 1 {
+			continue
+		}
+		samplers[eventType] = &eventSampler{rate: uint64(rate)}
+		EventMetricSampleRate.WithLabelValues(eventType).Set(float64(rate))
+	}
+
+	samplingMu.Lock()
+	eventSamplers = samplers
+	samplingMu.Unlock()
+}
+
+// ParseEventSampleRates parses a comma-separated list of eventType=rate pairs,
+// such as "inventory.updated=100,order.viewed=10", as read from an
+// environment variable
+func ParseEventSampleRates(spec string) (map[string]int, error) {
+	rates := make(map[string]int)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		eventType, value, ok := strings.Cut(entry, "=")
+		eventType = strings.TrimSpace(eventType)
+		if !ok || eventType == "" {
+			return nil, fmt.Errorf("invalid sample rate entry %q: want eventType=rate", entry)
+		}
+
+		rate, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid sample rate for %s: %w", eventType, err)
+		}
+		if rate < 1 {
+			return nil, fmt.Errorf("invalid sample rate for %s: must be at least 1", eventType)
+		}
+		rates[eventType] = rate
+	}
+	return rates, nil
+}
+
+// EventSampleRate returns the sample rate for eventType, 1 when unsampled
+func EventSampleRate(eventType string) int {
+	samplingMu.RLock()
+	sampler, ok := eventSamplers[eventType]
+	samplingMu.RUnlock()
+
+	if !ok {
+		return 1
+	}
+	return int(sampler.rate)
+}
+
+// SampleEvent reports whether this occurrence of eventType should be recorded
+func SampleEvent(eventType string) bool {
+	samplingMu.RLock()
+	sampler, ok := eventSamplers[eventType]
+	samplingMu.RUnlock()
+
+	if !ok {
+		return true
+	}
+	return (sampler.seen.Add(1)-1)%sampler.rate == 0
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+)
+
+// Tenant labels used for tenants outside the allowlist and for events without one
+const (
+	TenantLabelOther = "other"
+	TenantLabelNone  = "none"
+)
+
+var (
+	tenantMu        sync.RWMutex
+	tenantAllowlist = map[string]struct{}{}
+)
+
+// SetTenantAllowlist sets the tenant IDs that get their own metric label.
+// Every other tenant is reported as "other" so a large tenant population
+// can't explode metric cardinality.
+func SetTenantAllowlist(tenantIDs []string) {
+	allowlist := make(map[string]struct{}, len(tenantIDs))
+	for _, id := range tenantIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			allowlist[id] = struct{}{}
+		}
+	}
+
+	tenantMu.Lock()
+	tenantAllowlist = allowlist
+	tenantMu.Unlock()
+}
+
+// ParseTenantAllowlist splits a comma-separated list of tenant IDs, as read
+// from an environment variable
+func ParseTenantAllowlist(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// TenantLabel returns the metric label for a tenant ID
+func TenantLabel(tenantID string) string {
+	if tenantID == "" {
+		return TenantLabelNone
+	}
+
+	tenantMu.RLock()
+	_, ok := tenantAllowlist[tenantID]
+	tenantMu.RUnlock()
+
+	if !ok {
+		return TenantLabelOther
+	}
+	return tenantID
+}
+
+// RecordTenantEvent records an event processed for a tenant with the given
+// outcome (for example success, error, invalid or throttled)
+func RecordTenantEvent(function, tenantID, status string) {
+	TenantEventsProcessed.WithLabelValues(function, TenantLabel(tenantID), status).Inc()
+}
@@ -0,0 +1,47 @@
+package metrics
+
+// ValidationLabelOther is used for validation fields and codes outside the known sets
+const ValidationLabelOther = "other"
+
+// validationFields and validationCodes are the fields and codes the event
+// validator reports. Anything else, such as a field name echoed from a
+// payload, is reported as "other" so it can't explode metric cardinality.
+var (
+	validationFields = map[string]struct{}{
+		"event_id":                {},
+		"event_type":              {},
+		"source_region":           {},
+		"timestamp":               {},
+		"metadata.source_service": {},
+		"metadata.trace_id":       {},
+		"payload.email":           {},
+	}
+
+	validationCodes = map[string]struct{}{
+		"REQUIRED_FIELD":    {},
+		"INVALID_REGION":    {},
+		"INVALID_TIMESTAMP": {},
+		"INVALID_FORMAT":    {},
+	}
+)
+
+// ValidationFieldLabel returns the metric label for a validated field
+func ValidationFieldLabel(field string) string {
+	if _, ok := validationFields[field]; !ok {
+		return ValidationLabelOther
+	}
+	return field
+}
+
+// ValidationCodeLabel returns the metric label for a validation error code
+func ValidationCodeLabel(code string) string {
+	if _, ok := validationCodes[code]; !ok {
+		return ValidationLabelOther
+	}
+	return code
+}
+
+// RecordValidationError records one validation error for field with code
+func RecordValidationError(field, code string) {
+	ValidationErrors.WithLabelValues(ValidationFieldLabel(field), ValidationCodeLabel(code)).Inc()
+}
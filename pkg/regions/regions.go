@@ -0,0 +1,56 @@
+package regions
+
+// Metadata describes where an AWS region is located
+type Metadata struct {
+	Timezone   string
+	DataCenter string
+}
+
+// known holds the AWS commercial-partition regions. GovCloud, China and
+// custom regions are not included; callers allow them explicitly.
+var known = map[string]Metadata{
+	"us-east-1":      {Timezone: "America/New_York", DataCenter: "Virginia"},
+	"us-east-2":      {Timezone: "America/New_York", DataCenter: "Ohio"},
+	"us-west-1":      {Timezone: "America/Los_Angeles", DataCenter: "California"},
+	"us-west-2":      {Timezone: "America/Los_Angeles", DataCenter: "Oregon"},
+	"ca-central-1":   {Timezone: "America/Toronto", DataCenter: "Montreal"},
+	"ca-west-1":      {Timezone: "America/Edmonton", DataCenter: "Calgary"},
+	"mx-central-1":   {Timezone: "America/Mexico_City", DataCenter: "Queretaro"},
+	"sa-east-1":      {Timezone: "America/Sao_Paulo", DataCenter: "Sao Paulo"},
+	"eu-west-1":      {Timezone: "Europe/Dublin", DataCenter: "Ireland"},
+	"eu-west-2":      {Timezone: "Europe/London", DataCenter: "London"},
+	"eu-west-3":      {Timezone: "Europe/Paris", DataCenter: "Paris"},
+	"eu-central-1":   {Timezone: "Europe/Berlin", DataCenter: "Frankfurt"},
+	"eu-central-2":   {Timezone: "Europe/Zurich", DataCenter: "Zurich"},
+	"eu-north-1":     {Timezone: "Europe/Stockholm", DataCenter: "Stockholm"},
+	"eu-south-1":     {Timezone: "Europe/Rome", DataCenter: "Milan"},
+	"eu-south-2":     {Timezone: "Europe/Madrid", DataCenter: "Spain"},
+	"il-central-1":   {Timezone: "Asia/Jerusalem", DataCenter: "Tel Aviv"},
+	"me-south-1":     {Timezone: "Asia/Bahrain", DataCenter: "Bahrain"},
+	"me-central-1":   {Timezone: "Asia/Dubai", DataCenter: "UAE"},
+	"af-south-1":     {Timezone: "Africa/Johannesburg", DataCenter: "Cape Town"},
+	"ap-east-1":      {Timezone: "Asia/Hong_Kong", DataCenter: "Hong Kong"},
+	"ap-south-1":     {Timezone: "Asia/Kolkata", DataCenter: "Mumbai"},
+	"ap-south-2":     {Timezone: "Asia/Kolkata", DataCenter: "Hyderabad"},
+	"ap-northeast-1": {Timezone: "Asia/Tokyo", DataCenter: "Tokyo"},
+	"ap-northeast-2": {Timezone: "Asia/Seoul", DataCenter: "Seoul"},
+	"ap-northeast-3": {Timezone: "Asia/Tokyo", DataCenter: "Osaka"},
+	"ap-southeast-1": {Timezone: "Asia/Singapore", DataCenter: "Singapore"},
+	"ap-southeast-2": {Timezone: "Australia/Sydney", DataCenter: "Sydney"},
+	"ap-southeast-3": {Timezone: "Asia/Jakarta", DataCenter: "Jakarta"},
+	"ap-southeast-4": {Timezone: "Australia/Melbourne", DataCenter: "Melbourne"},
+	"ap-southeast-5": {Timezone: "Asia/Kuala_Lumpur", DataCenter: "Malaysia"},
+	"ap-southeast-7": {Timezone: "Asia/Bangkok", DataCenter: "Thailand"},
+}
+
+// Lookup returns the metadata for a known region
+func Lookup(region string) (Metadata, bool) {
+	md, ok := known[region]
+	return md, ok
+}
+
+// IsKnown reports whether region is a known AWS region
+func IsKnown(region string) bool {
+	_, ok := known[region]
+	return ok
+}
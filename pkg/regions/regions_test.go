@@ -0,0 +1,32 @@
+package regions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsKnown(t *testing.T) {
+	assert.True(t, IsKnown("us-west-2"))
+	assert.True(t, IsKnown("ap-southeast-1"))
+	assert.False(t, IsKnown("us-wst-2"))
+	assert.False(t, IsKnown("us-gov-west-1"))
+	assert.False(t, IsKnown(""))
+}
+
+func TestLookup(t *testing.T) {
+	md, ok := Lookup("eu-west-1")
+	assert.True(t, ok)
+	assert.Equal(t, "Europe/Dublin", md.Timezone)
+	assert.Equal(t, "Ireland", md.DataCenter)
+
+	_, ok = Lookup("unknown-region")
+	assert.False(t, ok)
+}
+
+func TestKnownRegionsHaveMetadata(t *testing.T) {
+	for region, md := range known {
+		assert.NotEmpty(t, md.Timezone, region)
+		assert.NotEmpty(t, md.DataCenter, region)
+	}
+}
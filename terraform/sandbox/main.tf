@@ -62,7 +62,8 @@ locals {
     "stream-processor",
     "event-transformer",
     "health-checker",
-    "authorizer"
+    "authorizer",
+    "dlq-monitor"
   ]
 
   common_tags = {
@@ -482,6 +483,58 @@ resource "aws_lambda_permission" "health_checker" {
   source_arn    = aws_cloudwatch_event_rule.health_check_schedule.arn
 }
 
+# Lambda Function - DLQ Monitor
+resource "aws_lambda_function" "dlq_monitor" {
+  filename         = "${path.module}/../../bin/lambdas/dlq-monitor.zip"
+  function_name    = "dlq-monitor-${var.environment}"
+  role             = aws_iam_role.lambda_execution.arn
+  handler          = "bootstrap"
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  memory_size      = 128
+  timeout          = 30
+
+  environment {
+    variables = {
+      ENVIRONMENT    = var.environment
+      AWS_REGION     = var.aws_region
+      EVENT_BUS_NAME = aws_cloudwatch_event_bus.eda.name
+      DLQ_URL        = aws_sqs_queue.event_dlq.url
+      DLQ_MAX_AGE    = "1h"
+      LOG_LEVEL      = var.log_level
+    }
+  }
+
+  tracing_config {
+    mode = "Active"
+  }
+
+  tags = local.common_tags
+}
+
+# CloudWatch Event Rule for DLQ Monitor (every 5 minutes)
+resource "aws_cloudwatch_event_rule" "dlq_monitor_schedule" {
+  name                = "dlq-monitor-schedule-${var.environment}"
+  description         = "Trigger DLQ age monitor every 5 minutes"
+  schedule_expression = "rate(5 minutes)"
+
+  tags = local.common_tags
+}
+
+resource "aws_cloudwatch_event_target" "dlq_monitor" {
+  rule      = aws_cloudwatch_event_rule.dlq_monitor_schedule.name
+  target_id = "dlq-monitor"
+  arn       = aws_lambda_function.dlq_monitor.arn
+}
+
+resource "aws_lambda_permission" "dlq_monitor" {
+  statement_id  = "AllowEventBridgeInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.dlq_monitor.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.dlq_monitor_schedule.arn
+}
+
 # Lambda Function - Authorizer
 resource "aws_lambda_function" "authorizer" {
   filename         = "${path.module}/../../bin/lambdas/authorizer.zip"
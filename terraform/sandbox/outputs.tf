@@ -109,6 +109,7 @@ output "deployment_summary" {
       event_transformer = aws_lambda_function.event_transformer.function_name
       health_checker    = aws_lambda_function.health_checker.function_name
       authorizer        = aws_lambda_function.authorizer.function_name
+      dlq_monitor       = aws_lambda_function.dlq_monitor.function_name
     }
     dynamodb_tables = {
       events    = aws_dynamodb_table.events.name